@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Tokens holds the credentials returned by the auth endpoints
+type Tokens struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	UserID       uint      `json:"user_id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+}
+
+// RegisterRequest holds the fields for registering a new user
+type RegisterRequest struct {
+	Email     string `json:"email"`
+	Password  string `json:"password"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// Login authenticates with email and password and stores the returned tokens
+func (c *Client) Login(ctx context.Context, email, password string) (*Tokens, error) {
+	var tokens Tokens
+	body := map[string]string{"email": email, "password": password}
+	if err := c.send(ctx, http.MethodPost, "/api/v1/auth/login", nil, body, &tokens, ""); err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&tokens)
+	return &tokens, nil
+}
+
+// Register creates a new user account and stores the returned tokens
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (*Tokens, error) {
+	var tokens Tokens
+	if err := c.send(ctx, http.MethodPost, "/api/v1/auth/register", nil, req, &tokens, ""); err != nil {
+		return nil, err
+	}
+
+	c.setTokens(&tokens)
+	return &tokens, nil
+}
+
+// Refresh exchanges the refresh token for new tokens
+func (c *Client) Refresh(ctx context.Context) (*Tokens, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := c.refreshLocked(ctx); err != nil {
+		return nil, err
+	}
+
+	tokens := *c.tokens
+	return &tokens, nil
+}
+
+// Tokens returns a copy of the current tokens, e.g. to persist them between runs
+func (c *Client) Tokens() (Tokens, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tokens == nil {
+		return Tokens{}, false
+	}
+	return *c.tokens, true
+}
+
+// SetTokens replaces the current tokens
+func (c *Client) SetTokens(tokens Tokens) {
+	c.setTokens(&tokens)
+}
+
+// setTokens stores tokens under the client lock
+func (c *Client) setTokens(tokens *Tokens) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.tokens = tokens
+}
+
+// accessToken returns a valid access token, refreshing it if it is about to expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tokens == nil {
+		return "", ErrNotAuthenticated
+	}
+
+	if !c.tokens.ExpiresAt.IsZero() && time.Until(c.tokens.ExpiresAt) < refreshMargin {
+		if err := c.refreshLocked(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return c.tokens.Token, nil
+}
+
+// forceRefresh refreshes the tokens unless another request already replaced the rejected token
+func (c *Client) forceRefresh(ctx context.Context, rejected string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.tokens == nil {
+		return "", ErrNotAuthenticated
+	}
+
+	if c.tokens.Token == rejected {
+		if err := c.refreshLocked(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return c.tokens.Token, nil
+}
+
+// refreshLocked calls the refresh endpoint; the caller must hold the client lock
+func (c *Client) refreshLocked(ctx context.Context) error {
+	if c.tokens == nil || c.tokens.RefreshToken == "" {
+		return ErrNotAuthenticated
+	}
+
+	var tokens Tokens
+	body := map[string]string{"refresh_token": c.tokens.RefreshToken}
+	if err := c.send(ctx, http.MethodPost, "/api/v1/auth/refresh", nil, body, &tokens, ""); err != nil {
+		return err
+	}
+
+	c.tokens = &tokens
+	return nil
+}
+
+// GetCurrentUser returns the authenticated user's profile
+func (c *Client) GetCurrentUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.do(ctx, http.MethodGet, apiV1+"/users/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,203 @@
+// Package client provides a typed Go client for the Digital Egiz backend REST API.
+//
+// The client manages access and refresh tokens: it refreshes the access token shortly
+// before it expires and retries a request once if the server rejects the token.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// refreshMargin is how long before expiry the access token is refreshed
+const refreshMargin = 30 * time.Second
+
+// apiV1 is the path prefix of the versioned API
+const apiV1 = "/api/v1"
+
+// ErrNotAuthenticated is returned when a request needs a token but the client has none
+var ErrNotAuthenticated = errors.New("client is not authenticated")
+
+// APIError is returned when the server responds with a non-2xx status
+type APIError struct {
+	StatusCode int          `json:"-"`
+	Message    string       `json:"error"`
+	Errors     []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes a validation failure of a single request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	if len(e.Errors) > 0 {
+		parts := make([]string, len(e.Errors))
+		for i, fe := range e.Errors {
+			parts[i] = fe.Field + ": " + fe.Message
+		}
+		return fmt.Sprintf("api error %d: %s (%s)", e.StatusCode, e.Message, strings.Join(parts, "; "))
+	}
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound returns true if err is an API error with status 404
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// Client is a Digital Egiz API client. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mutex  sync.Mutex
+	tokens *Tokens
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTokens starts the client with previously obtained tokens
+func WithTokens(tokens Tokens) Option {
+	return func(c *Client) {
+		c.tokens = &tokens
+	}
+}
+
+// New creates a client for the backend at baseURL (e.g. "http://localhost:8080")
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do sends an authenticated request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = c.send(ctx, method, path, query, body, out, token)
+
+	// The token may have been revoked or expired early; refresh once and retry
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if token, refreshErr := c.forceRefresh(ctx, token); refreshErr == nil {
+			return c.send(ctx, method, path, query, body, out, token)
+		}
+	}
+
+	return err
+}
+
+// send performs a single HTTP request
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body, out interface{}, token string) error {
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// pagination returns query parameters for a page request
+func pagination(page, limit int) url.Values {
+	query := url.Values{}
+	if page > 0 {
+		query.Set("page", fmt.Sprint(page))
+	}
+	if limit > 0 {
+		query.Set("limit", fmt.Sprint(limit))
+	}
+	return query
+}
+
+// collectPages calls fetch for consecutive pages until all items have been read
+func collectPages[T any](fetch func(page int) ([]T, int64, error)) ([]T, error) {
+	var all []T
+	for page := 1; ; page++ {
+		items, total, err := fetch(page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if len(items) == 0 || int64(len(all)) >= total {
+			return all, nil
+		}
+	}
+}
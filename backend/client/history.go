@@ -0,0 +1,185 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TimeseriesQuery selects raw time-series data of a twin feature.
+// Zero Start, End and Limit use the server defaults.
+type TimeseriesQuery struct {
+	FeaturePath string
+	Start       time.Time
+	End         time.Time
+	Limit       int
+	// Offset skips the first points in the requested order
+	Offset int
+	// Ascending returns the earliest points first; by default the latest come first
+	Ascending bool
+	// Fields limits the returned columns (e.g. "time", "value_num")
+	Fields []string
+}
+
+// AggregatedQuery selects aggregated time-series data of a twin feature
+type AggregatedQuery struct {
+	FeaturePath string
+	Start       time.Time
+	End         time.Time
+	// Interval is the bucket size, e.g. "5m", "1h" or "1d"
+	Interval string
+}
+
+// AlertQuery selects alerts of a twin
+type AlertQuery struct {
+	Start    time.Time
+	End      time.Time
+	Severity string
+	Limit    int
+}
+
+// MLPredictionQuery selects ML predictions of a twin
+type MLPredictionQuery struct {
+	TaskID string
+	Start  time.Time
+	End    time.Time
+	Limit  int
+}
+
+// historyPath returns the path of a twin history endpoint
+func historyPath(twinID uint, endpoint string) string {
+	return fmt.Sprintf("%s/twins/%d/history/%s", apiV1, twinID, endpoint)
+}
+
+// setTimeRange adds non-zero start and end times to a query
+func setTimeRange(query url.Values, start, end time.Time) {
+	if !start.IsZero() {
+		query.Set("start", start.UTC().Format(time.RFC3339))
+	}
+	if !end.IsZero() {
+		query.Set("end", end.UTC().Format(time.RFC3339))
+	}
+}
+
+// setLimit adds a positive limit to a query
+func setLimit(query url.Values, limit int) {
+	if limit > 0 {
+		query.Set("limit", fmt.Sprint(limit))
+	}
+}
+
+// GetTimeseries returns raw time-series data of a twin feature
+func (c *Client) GetTimeseries(ctx context.Context, twinID uint, q TimeseriesQuery) ([]TimeseriesPoint, error) {
+	query := url.Values{}
+	query.Set("feature_path", q.FeaturePath)
+	setTimeRange(query, q.Start, q.End)
+	setLimit(query, q.Limit)
+	if q.Offset > 0 {
+		query.Set("offset", fmt.Sprint(q.Offset))
+	}
+	if q.Ascending {
+		query.Set("order", "asc")
+	}
+	if len(q.Fields) > 0 {
+		query.Set("fields", strings.Join(q.Fields, ","))
+	}
+
+	var result struct {
+		Data []TimeseriesPoint `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "timeseries"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetLatestTimeseries returns the latest value of a twin feature
+func (c *Client) GetLatestTimeseries(ctx context.Context, twinID uint, featurePath string, fields ...string) (*TimeseriesPoint, error) {
+	query := url.Values{}
+	query.Set("feature_path", featurePath)
+	if len(fields) > 0 {
+		query.Set("fields", strings.Join(fields, ","))
+	}
+
+	var result struct {
+		Data TimeseriesPoint `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "timeseries/latest"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
+
+// GetAggregated returns aggregated time-series data of a twin feature
+func (c *Client) GetAggregated(ctx context.Context, twinID uint, q AggregatedQuery) ([]AggregatedPoint, error) {
+	query := url.Values{}
+	query.Set("feature_path", q.FeaturePath)
+	query.Set("interval", q.Interval)
+	setTimeRange(query, q.Start, q.End)
+
+	var result struct {
+		Data []AggregatedPoint `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "aggregated"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetAlerts returns alerts of a twin
+func (c *Client) GetAlerts(ctx context.Context, twinID uint, q AlertQuery) ([]Alert, error) {
+	query := url.Values{}
+	setTimeRange(query, q.Start, q.End)
+	setLimit(query, q.Limit)
+	if q.Severity != "" {
+		query.Set("severity", q.Severity)
+	}
+
+	var result struct {
+		Data []Alert `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "alerts"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// AcknowledgeAlert acknowledges an alert of a twin. The note is stored with the
+// acknowledgement and is required for severities the server's ack policy lists.
+func (c *Client) AcknowledgeAlert(ctx context.Context, twinID uint, alertID, note string) error {
+	body := map[string]string{"alert_id": alertID, "note": note}
+	return c.do(ctx, http.MethodPost, historyPath(twinID, "alerts/acknowledge"), nil, body, nil)
+}
+
+// GetMLPredictions returns predictions of an ML task for a twin
+func (c *Client) GetMLPredictions(ctx context.Context, twinID uint, q MLPredictionQuery) ([]MLPrediction, error) {
+	query := url.Values{}
+	query.Set("task_id", q.TaskID)
+	setTimeRange(query, q.Start, q.End)
+	setLimit(query, q.Limit)
+
+	var result struct {
+		Data []MLPrediction `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "ml-predictions"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// GetLatestMLPrediction returns the latest prediction of an ML task for a twin
+func (c *Client) GetLatestMLPrediction(ctx context.Context, twinID uint, taskID string) (*MLPrediction, error) {
+	query := url.Values{}
+	query.Set("task_id", taskID)
+
+	var result struct {
+		Data MLPrediction `json:"data"`
+	}
+	if err := c.do(ctx, http.MethodGet, historyPath(twinID, "ml-predictions/latest"), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Data, nil
+}
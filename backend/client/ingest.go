@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// IngestValue is a feature value pushed for a twin.
+// A zero Timestamp uses the time the server receives the value.
+type IngestValue struct {
+	Feature   string          `json:"feature"`
+	Value     json.RawMessage `json:"value"`
+	Timestamp *time.Time      `json:"timestamp,omitempty"`
+}
+
+// IngestResult reports how many values were stored and which were rejected
+type IngestResult struct {
+	Stored   int               `json:"stored"`
+	Rejected []IngestRejection `json:"rejected,omitempty"`
+}
+
+// IngestRejection describes a value of a batch that was not stored
+type IngestRejection struct {
+	Index     int    `json:"index"`
+	FeatureID string `json:"feature_id"`
+	Error     string `json:"error"`
+}
+
+// NewIngestValue builds an ingest value from any JSON-encodable value
+func NewIngestValue(feature string, value interface{}, timestamp time.Time) (IngestValue, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return IngestValue{}, fmt.Errorf("failed to encode value of %s: %w", feature, err)
+	}
+
+	v := IngestValue{Feature: feature, Value: data}
+	if !timestamp.IsZero() {
+		v.Timestamp = &timestamp
+	}
+	return v, nil
+}
+
+// Ingest pushes a single feature value of a twin
+func (c *Client) Ingest(ctx context.Context, twinID uint, value IngestValue) (*IngestResult, error) {
+	var result IngestResult
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/twins/%d/ingest", apiV1, twinID), nil, value, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// IngestBatch pushes several feature values of a twin
+func (c *Client) IngestBatch(ctx context.Context, twinID uint, values []IngestValue) (*IngestResult, error) {
+	var result IngestResult
+	body := map[string][]IngestValue{"values": values}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/twins/%d/ingest/batch", apiV1, twinID), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
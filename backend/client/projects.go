@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// ProjectPage is a page of projects
+type ProjectPage struct {
+	Projects   []Project  `json:"projects"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// ListProjects returns one page of the projects the user has access to
+func (c *Client) ListProjects(ctx context.Context, page, limit int) (*ProjectPage, error) {
+	var result ProjectPage
+	if err := c.do(ctx, http.MethodGet, apiV1+"/projects", pagination(page, limit), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAllProjects returns all projects the user has access to, reading every page
+func (c *Client) ListAllProjects(ctx context.Context, pageSize int) ([]Project, error) {
+	return collectPages(func(page int) ([]Project, int64, error) {
+		result, err := c.ListProjects(ctx, page, pageSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		return result.Projects, result.Pagination.Total, nil
+	})
+}
+
+// GetProject returns a project by ID
+func (c *Client) GetProject(ctx context.Context, id uint) (*Project, error) {
+	var project Project
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%d", apiV1, id), nil, nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// CreateProject creates a new project owned by the user
+func (c *Client) CreateProject(ctx context.Context, req ProjectRequest) (*Project, error) {
+	var project Project
+	if err := c.do(ctx, http.MethodPost, apiV1+"/projects", nil, req, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// UpdateProject updates a project
+func (c *Client) UpdateProject(ctx context.Context, id uint, req ProjectRequest) (*Project, error) {
+	var project Project
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/projects/%d", apiV1, id), nil, req, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+// DeleteProject deletes a project
+func (c *Client) DeleteProject(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/projects/%d", apiV1, id), nil, nil, nil)
+}
+
+// ListProjectMembers returns the members of a project
+func (c *Client) ListProjectMembers(ctx context.Context, projectID uint) ([]ProjectMember, error) {
+	var result struct {
+		Members []ProjectMember `json:"members"`
+	}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%d/members", apiV1, projectID), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Members, nil
+}
+
+// AddProjectMember adds a user to a project with the given role
+func (c *Client) AddProjectMember(ctx context.Context, projectID, userID uint, role string) (*ProjectMember, error) {
+	var member ProjectMember
+	body := map[string]interface{}{"user_id": userID, "role": role}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%d/members", apiV1, projectID), nil, body, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// UpdateProjectMember changes a member's role
+func (c *Client) UpdateProjectMember(ctx context.Context, projectID, userID uint, role string) (*ProjectMember, error) {
+	var member ProjectMember
+	body := map[string]string{"role": role}
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/projects/%d/members/%d", apiV1, projectID, userID), nil, body, &member); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveProjectMember removes a user from a project
+func (c *Client) RemoveProjectMember(ctx context.Context, projectID, userID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/projects/%d/members/%d", apiV1, projectID, userID), nil, nil, nil)
+}
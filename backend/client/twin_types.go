@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// TwinTypePage is a page of twin types
+type TwinTypePage struct {
+	TwinTypes  []TwinType `json:"twin_types"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// ListTwinTypes returns one page of twin types
+func (c *Client) ListTwinTypes(ctx context.Context, page, limit int) (*TwinTypePage, error) {
+	var result TwinTypePage
+	if err := c.do(ctx, http.MethodGet, apiV1+"/twin-types", pagination(page, limit), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAllTwinTypes returns all twin types, reading every page
+func (c *Client) ListAllTwinTypes(ctx context.Context, pageSize int) ([]TwinType, error) {
+	return collectPages(func(page int) ([]TwinType, int64, error) {
+		result, err := c.ListTwinTypes(ctx, page, pageSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		return result.TwinTypes, result.Pagination.Total, nil
+	})
+}
+
+// GetTwinType returns a twin type by ID
+func (c *Client) GetTwinType(ctx context.Context, id uint) (*TwinType, error) {
+	var twinType TwinType
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/twin-types/%d", apiV1, id), nil, nil, &twinType); err != nil {
+		return nil, err
+	}
+	return &twinType, nil
+}
+
+// CreateTwinType creates a new twin type
+func (c *Client) CreateTwinType(ctx context.Context, req TwinTypeRequest) (*TwinType, error) {
+	var twinType TwinType
+	if err := c.do(ctx, http.MethodPost, apiV1+"/twin-types", nil, req, &twinType); err != nil {
+		return nil, err
+	}
+	return &twinType, nil
+}
+
+// UpdateTwinType updates a twin type
+func (c *Client) UpdateTwinType(ctx context.Context, id uint, req TwinTypeRequest) (*TwinType, error) {
+	var twinType TwinType
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/twin-types/%d", apiV1, id), nil, req, &twinType); err != nil {
+		return nil, err
+	}
+	return &twinType, nil
+}
+
+// DeleteTwinType deletes a twin type
+func (c *Client) DeleteTwinType(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/twin-types/%d", apiV1, id), nil, nil, nil)
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TwinPage is a page of twins
+type TwinPage struct {
+	Twins []Twin `json:"twins"`
+	Total int64  `json:"total"`
+	Page  int    `json:"page"`
+	Size  int    `json:"size"`
+}
+
+// ListTwins returns one page of the twins in a project; with tags, only twins carrying all of them
+func (c *Client) ListTwins(ctx context.Context, projectID uint, page, size int, tags ...string) (*TwinPage, error) {
+	query := url.Values{}
+	query.Set("project_id", fmt.Sprint(projectID))
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	if page > 0 {
+		query.Set("page", fmt.Sprint(page))
+	}
+	if size > 0 {
+		query.Set("size", fmt.Sprint(size))
+	}
+
+	var result TwinPage
+	if err := c.do(ctx, http.MethodGet, apiV1+"/twins", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListAllTwins returns all twins in a project, reading every page
+func (c *Client) ListAllTwins(ctx context.Context, projectID uint, pageSize int, tags ...string) ([]Twin, error) {
+	return collectPages(func(page int) ([]Twin, int64, error) {
+		result, err := c.ListTwins(ctx, projectID, page, pageSize, tags...)
+		if err != nil {
+			return nil, 0, err
+		}
+		return result.Twins, result.Total, nil
+	})
+}
+
+// GetTwin returns a twin by ID
+func (c *Client) GetTwin(ctx context.Context, id uint) (*Twin, error) {
+	var twin Twin
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/twins/%d", apiV1, id), nil, nil, &twin); err != nil {
+		return nil, err
+	}
+	return &twin, nil
+}
+
+// GetTwinFields returns only the selected JSON fields of a twin (e.g. "name", "type.name")
+func (c *Client) GetTwinFields(ctx context.Context, id uint, fields ...string) (map[string]interface{}, error) {
+	query := url.Values{}
+	query.Set("fields", strings.Join(fields, ","))
+
+	var twin map[string]interface{}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/twins/%d", apiV1, id), query, nil, &twin); err != nil {
+		return nil, err
+	}
+	return twin, nil
+}
+
+// CreateTwin creates a new twin
+func (c *Client) CreateTwin(ctx context.Context, req CreateTwinRequest) (*Twin, error) {
+	var twin Twin
+	if err := c.do(ctx, http.MethodPost, apiV1+"/twins", nil, req, &twin); err != nil {
+		return nil, err
+	}
+	return &twin, nil
+}
+
+// UpdateTwin updates a twin
+func (c *Client) UpdateTwin(ctx context.Context, id uint, req UpdateTwinRequest) (*Twin, error) {
+	var twin Twin
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("%s/twins/%d", apiV1, id), nil, req, &twin); err != nil {
+		return nil, err
+	}
+	return &twin, nil
+}
+
+// DeleteTwin deletes a twin
+func (c *Client) DeleteTwin(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/twins/%d", apiV1, id), nil, nil, nil)
+}
+
+// twinTags is the response of the tag endpoints
+type twinTags struct {
+	Tags []string `json:"tags"`
+}
+
+// AddTwinTags adds tags to a twin and returns its resulting tags
+func (c *Client) AddTwinTags(ctx context.Context, id uint, tags ...string) ([]string, error) {
+	var result twinTags
+	body := map[string][]string{"tags": tags}
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("%s/twins/%d/tags", apiV1, id), nil, body, &result); err != nil {
+		return nil, err
+	}
+	return result.Tags, nil
+}
+
+// RemoveTwinTag removes a tag from a twin and returns its remaining tags
+func (c *Client) RemoveTwinTag(ctx context.Context, id uint, tag string) ([]string, error) {
+	var result twinTags
+	path := fmt.Sprintf("%s/twins/%d/tags/%s", apiV1, id, url.PathEscape(tag))
+	if err := c.do(ctx, http.MethodDelete, path, nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tags, nil
+}
+
+// ListProjectTwinTags returns the distinct twin tags used in a project
+func (c *Client) ListProjectTwinTags(ctx context.Context, projectID uint) ([]string, error) {
+	query := url.Values{}
+	query.Set("project_id", fmt.Sprint(projectID))
+
+	var result twinTags
+	if err := c.do(ctx, http.MethodGet, apiV1+"/twins/tags", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tags, nil
+}
+
+// ModelFormat describes a 3D model format accepted for twin model URLs
+type ModelFormat struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	MIMETypes  []string `json:"mime_types"`
+}
+
+// ListModelFormats returns the 3D model formats the server accepts
+func (c *Client) ListModelFormats(ctx context.Context) ([]ModelFormat, error) {
+	var result struct {
+		Formats []ModelFormat `json:"formats"`
+	}
+	if err := c.do(ctx, http.MethodGet, apiV1+"/model-formats", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Formats, nil
+}
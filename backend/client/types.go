@@ -0,0 +1,164 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Pagination holds the paging information of list responses
+type Pagination struct {
+	Total int64 `json:"total"`
+	Page  int   `json:"page"`
+	Limit int   `json:"limit"`
+}
+
+// User represents a user profile
+type User struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Role      string `json:"role"`
+	Active    bool   `json:"active"`
+}
+
+// Project represents a project
+type Project struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	CreatedBy   uint            `json:"created_by"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+	Members     []ProjectMember `json:"members,omitempty"`
+}
+
+// ProjectMember represents a member of a project
+type ProjectMember struct {
+	ID        uint   `json:"id"`
+	ProjectID uint   `json:"project_id"`
+	UserID    uint   `json:"user_id"`
+	Role      string `json:"role"`
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+}
+
+// ProjectRequest holds the fields for creating or updating a project
+type ProjectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// TwinType represents a twin type
+type TwinType struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Version     string          `json:"version"`
+	SchemaJSON  json.RawMessage `json:"schema_json"`
+	CreatedBy   uint            `json:"created_by"`
+	CreatedAt   string          `json:"created_at"`
+	UpdatedAt   string          `json:"updated_at"`
+}
+
+// TwinTypeRequest holds the fields for creating or updating a twin type
+type TwinTypeRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Version     string          `json:"version"`
+	SchemaJSON  json.RawMessage `json:"schema_json"`
+}
+
+// Twin represents a digital twin
+type Twin struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	DittoID     string          `json:"ditto_id"`
+	TypeID      uint            `json:"type_id"`
+	ProjectID   uint            `json:"project_id"`
+	ModelURL    string          `json:"model_url"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	Tags        []string        `json:"tags"`
+	CreatedBy   uint            `json:"created_by"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// CreateTwinRequest holds the fields for creating a twin.
+// Either DittoID or LocalName must be set.
+type CreateTwinRequest struct {
+	Name        string `json:"name"`
+	TypeID      uint   `json:"type_id"`
+	ProjectID   uint   `json:"project_id"`
+	DittoID     string `json:"ditto_id,omitempty"`
+	LocalName   string `json:"local_name,omitempty"`
+	Description string `json:"description,omitempty"`
+	ModelURL    string `json:"model_url,omitempty"`
+}
+
+// UpdateTwinRequest holds the fields for updating a twin
+type UpdateTwinRequest struct {
+	Name        string `json:"name"`
+	DittoID     string `json:"ditto_id"`
+	Description string `json:"description"`
+	ModelURL    string `json:"model_url"`
+}
+
+// TimeseriesPoint represents a single time-series value.
+// When a request selects fields, unselected values are left empty.
+type TimeseriesPoint struct {
+	Time        time.Time `json:"time"`
+	TwinID      string    `json:"twin_id"`
+	FeaturePath string    `json:"feature_path"`
+	ValueType   string    `json:"value_type"`
+	ValueNum    float64   `json:"value_num,omitempty"`
+	ValueBool   *bool     `json:"value_bool,omitempty"`
+	ValueStr    string    `json:"value_str,omitempty"`
+	ValueJSON   string    `json:"value_json,omitempty"`
+	Source      string    `json:"source"`
+}
+
+// AggregatedPoint represents aggregated time-series data for one interval
+type AggregatedPoint struct {
+	TimeInterval time.Time `json:"time_interval"`
+	TwinID       string    `json:"twin_id"`
+	FeaturePath  string    `json:"feature_path"`
+	IntervalType string    `json:"interval_type"`
+	Min          float64   `json:"min"`
+	Max          float64   `json:"max"`
+	Avg          float64   `json:"avg"`
+	Sum          float64   `json:"sum"`
+	Count        int       `json:"count"`
+	FirstTime    time.Time `json:"first_time"`
+	LastTime     time.Time `json:"last_time"`
+}
+
+// Alert represents an alert raised for a twin
+type Alert struct {
+	Time         time.Time `json:"time"`
+	AlertID      string    `json:"alert_id"`
+	TwinID       string    `json:"twin_id"`
+	FeaturePath  string    `json:"feature_path,omitempty"`
+	Severity     string    `json:"severity"`
+	Message      string    `json:"message"`
+	ValueJSON    string    `json:"value_json,omitempty"`
+	Source       string    `json:"source"`
+	Acknowledged bool      `json:"acknowledged"`
+	AckBy        string    `json:"ack_by,omitempty"`
+	AckTime      time.Time `json:"ack_time,omitempty"`
+	AckNote      string    `json:"ack_note,omitempty"`
+}
+
+// MLPrediction represents a prediction made by an ML task for a twin
+type MLPrediction struct {
+	Time           time.Time `json:"time"`
+	TwinID         string    `json:"twin_id"`
+	TaskID         string    `json:"task_id"`
+	PredictionType string    `json:"prediction_type"`
+	ScoreNum       float64   `json:"score_num,omitempty"`
+	LabelStr       string    `json:"label_str,omitempty"`
+	DetailsJSON    string    `json:"details_json,omitempty"`
+	ModelVersion   string    `json:"model_version"`
+}
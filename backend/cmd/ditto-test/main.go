@@ -68,7 +68,7 @@ func main() {
 	defer manager.Disconnect()
 
 	// Subscribe to all thing events
-	if err := manager.SubscribeToThings(""); err != nil {
+	if err := manager.SubscribeToThings("", nil); err != nil {
 		logger.Error("Failed to subscribe to things", zap.Error(err))
 		os.Exit(1)
 	}
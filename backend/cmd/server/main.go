@@ -12,7 +12,6 @@ import (
 	"github.com/digital-egiz/backend/internal/api"
 	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db"
-	"github.com/digital-egiz/backend/internal/kafka"
 	"github.com/digital-egiz/backend/internal/services"
 	"github.com/digital-egiz/backend/internal/utils"
 	"go.uber.org/zap"
@@ -40,6 +39,7 @@ func main() {
 		zap.String("environment", cfg.Server.Environment),
 		zap.Int("port", cfg.Server.Port),
 		zap.Bool("development", cfg.Server.IsDevelopment()),
+		zap.String("kafka_startup_mode", cfg.Kafka.StartupMode),
 	)
 
 	// Initialize database
@@ -50,20 +50,21 @@ func main() {
 	defer closeDatabase(logger, database)
 
 	// Check database connectivity
-	if err := checkDatabaseConnection(database); err != nil {
+	if err := database.VerifyConnection(); err != nil {
 		logger.Fatal("Database connectivity check failed", zap.Error(err))
 	}
-	logger.Info("Database connection established successfully")
 
-	// Initialize Kafka
-	kafkaManager, err := initKafka(logger, cfg)
-	if err != nil {
-		logger.Fatal("Failed to initialize Kafka", zap.Error(err))
-	}
-	defer closeKafka(logger, kafkaManager)
+	// Initialize services; Kafka outages only degrade ingest unless fail-fast is configured
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Initialize service provider
-	serviceProvider := initServiceProvider(logger, database, kafkaManager, cfg)
+	// Watch database connectivity so a Postgres restart is noticed and recovered from
+	database.StartHealthCheck(ctx)
+
+	serviceProvider := services.NewServiceProvider(logger, cfg, database)
+	if err := serviceProvider.Initialize(ctx); err != nil {
+		logger.Fatal("Failed to initialize services", zap.Error(err))
+	}
 
 	// Initialize API router
 	router := api.NewRouter(cfg, logger, database, serviceProvider)
@@ -71,7 +72,7 @@ func main() {
 
 	// Create HTTP server
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Server.Port),
+		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
 		Handler:      router.GetEngine(),
 		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(cfg.Server.WriteTimeout) * time.Second,
@@ -87,7 +88,7 @@ func main() {
 	}()
 
 	// Graceful shutdown
-	gracefulShutdown(logger, server, kafkaManager)
+	gracefulShutdown(logger, server, serviceProvider)
 }
 
 // initDatabase initializes the database connection
@@ -95,11 +96,11 @@ func initDatabase(logger *utils.Logger, cfg *config.Config) (*db.Database, error
 	logger.Info("Initializing database connection",
 		zap.String("host", cfg.Database.Host),
 		zap.Int("port", cfg.Database.Port),
-		zap.String("name", cfg.Database.Name),
+		zap.String("name", cfg.Database.DBName),
 		zap.String("user", cfg.Database.User),
 	)
 
-	database, err := db.NewDatabase(cfg.Database, logger)
+	database, err := db.NewDatabase(&cfg.Database, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
@@ -115,82 +116,8 @@ func closeDatabase(logger *utils.Logger, database *db.Database) {
 	}
 }
 
-// checkDatabaseConnection verifies the database connection works
-func checkDatabaseConnection(database *db.Database) error {
-	sqlDB, err := database.DB.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
-	}
-
-	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
-	}
-
-	return nil
-}
-
-// initKafka initializes the Kafka connection
-func initKafka(logger *utils.Logger, cfg *config.Config) (*kafka.Manager, error) {
-	logger.Info("Initializing Kafka connection",
-		zap.Strings("brokers", cfg.Kafka.Brokers),
-		zap.String("consumerGroup", cfg.Kafka.ConsumerGroup),
-	)
-
-	kafkaManager, err := kafka.NewManager(cfg.Kafka, logger)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize Kafka: %w", err)
-	}
-
-	return kafkaManager, nil
-}
-
-// closeKafka closes the Kafka connection
-func closeKafka(logger *utils.Logger, kafkaManager *kafka.Manager) {
-	logger.Info("Closing Kafka connection")
-	if err := kafkaManager.Close(); err != nil {
-		logger.Error("Error closing Kafka connection", zap.Error(err))
-	}
-}
-
-// initServiceProvider initializes all services
-func initServiceProvider(logger *utils.Logger, database *db.Database, kafkaManager *kafka.Manager, cfg *config.Config) *services.ServiceProvider {
-	logger.Info("Initializing service provider")
-
-	// Create repository factory
-	repositoryFactory := db.NewRepositoryFactory(database)
-
-	// Create service provider
-	serviceProvider := services.NewServiceProvider(
-		database,
-		kafkaManager,
-		cfg,
-		logger,
-		repositoryFactory,
-	)
-
-	// Initialize Kafka handlers
-	kafkaHandler := services.NewKafkaHandler(
-		serviceProvider.GetTwinService(),
-		serviceProvider.GetProjectService(),
-		serviceProvider.GetHistoryService(),
-		database,
-		logger,
-	)
-
-	// Add consumer handlers
-	err := kafkaManager.RegisterConsumerHandlers(kafkaHandler)
-	if err != nil {
-		logger.Error("Failed to register Kafka handlers", zap.Error(err))
-	}
-
-	// Start Kafka consumers
-	kafkaManager.StartConsumers()
-
-	return serviceProvider
-}
-
 // gracefulShutdown handles graceful shutdown of the server
-func gracefulShutdown(logger *utils.Logger, server *http.Server, kafkaManager *kafka.Manager) {
+func gracefulShutdown(logger *utils.Logger, server *http.Server, serviceProvider *services.ServiceProvider) {
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -203,15 +130,16 @@ func gracefulShutdown(logger *utils.Logger, server *http.Server, kafkaManager *k
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// First stop Kafka consumers to prevent processing new messages
-	logger.Info("Stopping Kafka consumers")
-	kafkaManager.StopConsumers()
-
-	// Then shutdown the server
+	// Shutdown the server
 	logger.Info("Shutting down HTTP server")
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("HTTP server forced to shutdown", zap.Error(err))
 	}
 
+	// Then stop ingest, flush buffers and close connections within the same deadline
+	if err := serviceProvider.Shutdown(ctx); err != nil {
+		logger.Error("Failed to shut down services", zap.Error(err))
+	}
+
 	logger.Info("Server gracefully stopped")
 }
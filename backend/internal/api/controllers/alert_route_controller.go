@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAlertRouteRequest represents the request to create an alert route
+type CreateAlertRouteRequest struct {
+	// TwinID limits the route to one twin of the project
+	TwinID      *uint    `json:"twin_id"`
+	Position    int      `json:"position"`
+	Severities  []string `json:"severities"`
+	FeaturePath string   `json:"feature_path"`
+	Channel     string   `json:"channel" binding:"required"`
+	Recipients  []string `json:"recipients"`
+}
+
+// AlertRouteController handles alert routing endpoints
+type AlertRouteController struct {
+	alertRouting   *services.AlertRoutingService
+	projectService *services.ProjectService
+	logger         *utils.Logger
+}
+
+// NewAlertRouteController creates a new alert route controller
+func NewAlertRouteController(
+	alertRouting *services.AlertRoutingService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *AlertRouteController {
+	return &AlertRouteController{
+		alertRouting:   alertRouting,
+		projectService: projectService,
+		logger:         logger.Named("alert_route_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (ac *AlertRouteController) RegisterRoutes(router *gin.RouterGroup) {
+	projectAuth := middleware.NewProjectAuthMiddleware(ac.projectService)
+
+	// Routes decide who gets paged, so like webhooks only owners manage them
+	routes := router.Group("/projects/:id/alert-routes")
+	routes.Use(projectAuth.RequireProjectOwner())
+	{
+		routes.GET("", ac.ListAlertRoutes)
+		routes.POST("", ac.CreateAlertRoute)
+		routes.DELETE("/:routeId", ac.DeleteAlertRoute)
+	}
+}
+
+// ListAlertRoutes lists the alert routes of a project
+// @Summary List alert routes
+// @Description Returns the alert routes of a project and its twins in evaluation order (owner only)
+// @Tags alerts
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.AlertRoute "Alert routes"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /projects/{id}/alert-routes [get]
+func (ac *AlertRouteController) ListAlertRoutes(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	routes, err := ac.alertRouting.ListRoutes(uint(projectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, routes)
+}
+
+// CreateAlertRoute creates an alert route
+// @Summary Create alert route
+// @Description Routes the stored alerts of the project, or of one of its twins, matching the severities and feature path to recipients of a delivery channel. Routes of a twin are evaluated before those of its project, each by position, and the first matching route wins; alerts matching no route are pushed to the project's websocket clients on the twin's alert topic and sent to the project's webhooks. A feature path ending in "*" matches by prefix; without recipients the channel's default recipients are used.
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param route body CreateAlertRouteRequest true "Alert route"
+// @Success 201 {object} models.AlertRoute "Created alert route"
+// @Failure 400 {object} map[string]string "Invalid route or unknown target"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /projects/{id}/alert-routes [post]
+func (ac *AlertRouteController) CreateAlertRoute(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req CreateAlertRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	createdBy, _ := userID.(uint)
+
+	route := &models.AlertRoute{
+		ProjectID:   uint(projectID),
+		TwinID:      req.TwinID,
+		Position:    req.Position,
+		Severities:  strings.Join(req.Severities, ","),
+		FeaturePath: req.FeaturePath,
+		Channel:     req.Channel,
+		Recipients:  strings.Join(req.Recipients, ","),
+		CreatedBy:   createdBy,
+	}
+
+	if err := ac.alertRouting.CreateRoute(route); err != nil {
+		if err.Error() == "database error" || err.Error() == "failed to create alert route" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, route)
+}
+
+// DeleteAlertRoute deletes an alert route
+// @Summary Delete alert route
+// @Description Deletes an alert route of a project (owner only)
+// @Tags alerts
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param routeId path int true "Alert route ID"
+// @Success 204 "No content"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Alert route not found"
+// @Router /projects/{id}/alert-routes/{routeId} [delete]
+func (ac *AlertRouteController) DeleteAlertRoute(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	routeID, err := strconv.ParseUint(c.Param("routeId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert route ID"})
+		return
+	}
+
+	if err := ac.alertRouting.DeleteRoute(uint(projectID), uint(routeID)); err != nil {
+		if err.Error() == "alert route not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
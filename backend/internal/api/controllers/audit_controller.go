@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// AuditExportRequest defines the query parameters for exporting the audit log
+type AuditExportRequest struct {
+	From time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	To   time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+}
+
+// AuditController exposes the audit log to administrators
+type AuditController struct {
+	auditService *services.AuditService
+	logger       *utils.Logger
+}
+
+// NewAuditController creates a new audit controller
+func NewAuditController(auditService *services.AuditService, logger *utils.Logger) *AuditController {
+	return &AuditController{
+		auditService: auditService,
+		logger:       logger.Named("audit_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the audit controller
+func (ac *AuditController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/audit/export", ac.Export)
+}
+
+// Export returns a signed, hash-chained archive of the audit log for a time range
+// @Summary Export audit log
+// @Description Returns the audit entries recorded in [from, to) with their hash chain and an HMAC-SHA256 signature (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param from query string true "Start time (ISO8601)"
+// @Param to query string true "End time (ISO8601), exclusive"
+// @Success 200 {object} services.AuditArchive "Signed audit archive"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /admin/audit/export [get]
+func (ac *AuditController) Export(c *gin.Context) {
+	var req AuditExportRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	archive, err := ac.auditService.Export(req.From, req.To)
+	if err != nil {
+		if err.Error() == "end time must be after start time" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ac.logger.Error("Failed to export audit log", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s-%s.json", archive.From.Format("20060102T150405Z"), archive.To.Format("20060102T150405Z"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.JSON(http.StatusOK, archive)
+}
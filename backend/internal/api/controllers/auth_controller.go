@@ -77,13 +77,14 @@ func (ac *AuthController) RegisterRoutes(router *gin.RouterGroup) {
 // @Param login_request body LoginRequest true "Login credentials"
 // @Success 200 {object} TokenResponse "Login successful"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Invalid credentials"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /auth/login [post]
 func (ac *AuthController) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -136,13 +137,14 @@ func (ac *AuthController) Login(c *gin.Context) {
 // @Param register_request body RegisterRequest true "Registration information"
 // @Success 201 {object} TokenResponse "Registration successful"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 409 {object} map[string]string "Email already exists"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /auth/register [post]
 func (ac *AuthController) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -207,13 +209,14 @@ func (ac *AuthController) Register(c *gin.Context) {
 // @Param refresh_request body RefreshRequest true "Refresh token"
 // @Success 200 {object} TokenResponse "Token refresh successful"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Invalid refresh token"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /auth/refresh [post]
 func (ac *AuthController) RefreshToken(c *gin.Context) {
 	var req RefreshRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
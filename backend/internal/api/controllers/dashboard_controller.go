@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// SaveDashboardRequest represents the request to save a dashboard layout
+type SaveDashboardRequest struct {
+	// Layout is stored as given; the backend only checks that it is JSON
+	Layout json.RawMessage `json:"layout" binding:"required"`
+	// Personal saves the layout for the current user only instead of the whole project
+	Personal bool `json:"personal"`
+}
+
+// DashboardController handles the dashboard layouts of projects
+type DashboardController struct {
+	dashboardService *services.DashboardService
+	projectService   *services.ProjectService
+	logger           *utils.Logger
+}
+
+// NewDashboardController creates a new dashboard controller
+func NewDashboardController(
+	dashboardService *services.DashboardService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *DashboardController {
+	return &DashboardController{
+		dashboardService: dashboardService,
+		projectService:   projectService,
+		logger:           logger.Named("dashboard_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (dc *DashboardController) RegisterRoutes(router *gin.RouterGroup) {
+	projectAuth := middleware.NewProjectAuthMiddleware(dc.projectService)
+
+	// Every member may read dashboards and keep personal ones; shared ones need editors
+	dashboards := router.Group("/projects/:id/dashboards")
+	dashboards.Use(projectAuth.RequireProjectViewer())
+	{
+		dashboards.GET("", dc.ListDashboards)
+		dashboards.GET("/:name", dc.GetDashboard)
+		dashboards.PUT("/:name", dc.SaveDashboard)
+		dashboards.DELETE("/:name", dc.DeleteDashboard)
+	}
+}
+
+// ListDashboards lists the dashboards of a project
+// @Summary List dashboards
+// @Description Returns the shared dashboards of a project and the current user's personal ones, without their layouts (project members only)
+// @Tags dashboards
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.DashboardLayout "Dashboards"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /projects/{id}/dashboards [get]
+func (dc *DashboardController) ListDashboards(c *gin.Context) {
+	projectID, ok := dashboardProjectID(c)
+	if !ok {
+		return
+	}
+
+	layouts, err := dc.dashboardService.List(projectID, dc.currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layouts)
+}
+
+// GetDashboard returns a dashboard layout
+// @Summary Get dashboard
+// @Description Returns a dashboard of a project by name; the current user's personal dashboard takes precedence over the shared one (project members only)
+// @Tags dashboards
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param name path string true "Dashboard name"
+// @Success 200 {object} models.DashboardLayout "Dashboard"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Dashboard not found"
+// @Router /projects/{id}/dashboards/{name} [get]
+func (dc *DashboardController) GetDashboard(c *gin.Context) {
+	projectID, ok := dashboardProjectID(c)
+	if !ok {
+		return
+	}
+
+	layout, err := dc.dashboardService.Get(projectID, dc.currentUserID(c), c.Param("name"))
+	if err != nil {
+		if err.Error() == "dashboard not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// SaveDashboard creates or replaces a dashboard layout
+// @Summary Save dashboard
+// @Description Saves a JSON dashboard layout under a name, shared with the project (editors only) or personal to the current user (any member)
+// @Tags dashboards
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param name path string true "Dashboard name"
+// @Param dashboard body SaveDashboardRequest true "Dashboard layout"
+// @Success 200 {object} models.DashboardLayout "Saved dashboard"
+// @Failure 400 {object} map[string]string "Invalid layout"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 413 {object} map[string]string "Layout too large"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Router /projects/{id}/dashboards/{name} [put]
+func (dc *DashboardController) SaveDashboard(c *gin.Context) {
+	projectID, ok := dashboardProjectID(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxDashboardLayoutSize+1024)
+	var req SaveDashboardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrDashboardTooLarge.Error()})
+			return
+		}
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	userID, ok := dc.dashboardScope(c, req.Personal)
+	if !ok {
+		return
+	}
+
+	layout := &models.DashboardLayout{
+		ProjectID: projectID,
+		UserID:    userID,
+		Name:      c.Param("name"),
+		Layout:    models.JSON(req.Layout),
+		UpdatedBy: dc.currentUserID(c),
+	}
+	if err := dc.dashboardService.Save(layout); err != nil {
+		switch {
+		case errors.Is(err, services.ErrDashboardTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case err.Error() == "database error":
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, layout)
+}
+
+// DeleteDashboard deletes a dashboard layout
+// @Summary Delete dashboard
+// @Description Deletes a shared dashboard (editors only) or, with personal=true, the current user's personal one
+// @Tags dashboards
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param name path string true "Dashboard name"
+// @Param personal query bool false "Delete the personal dashboard"
+// @Success 204 "Dashboard deleted"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Dashboard not found"
+// @Router /projects/{id}/dashboards/{name} [delete]
+func (dc *DashboardController) DeleteDashboard(c *gin.Context) {
+	projectID, ok := dashboardProjectID(c)
+	if !ok {
+		return
+	}
+
+	personal, _ := strconv.ParseBool(c.Query("personal"))
+	userID, ok := dc.dashboardScope(c, personal)
+	if !ok {
+		return
+	}
+
+	if err := dc.dashboardService.Delete(projectID, userID, c.Param("name")); err != nil {
+		if err.Error() == "dashboard not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// dashboardScope returns the user ID a dashboard is saved under: the current user's for
+// personal dashboards, 0 for shared ones, which only editors and owners may change
+func (dc *DashboardController) dashboardScope(c *gin.Context, personal bool) (uint, bool) {
+	if personal {
+		return dc.currentUserID(c), true
+	}
+
+	role, _ := c.Get("project_role")
+	if role != string(models.ProjectRoleOwner) && role != string(models.ProjectRoleEditor) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only project editors may change shared dashboards"})
+		return 0, false
+	}
+	return 0, true
+}
+
+// currentUserID returns the ID of the authenticated user
+func (dc *DashboardController) currentUserID(c *gin.Context) uint {
+	userID, _ := c.Get("user_id")
+	uid, _ := userID.(uint)
+	return uid
+}
+
+// dashboardProjectID parses the project ID of the request
+func dashboardProjectID(c *gin.Context) (uint, bool) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return 0, false
+	}
+	return uint(projectID), true
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// DatabaseController exposes database diagnostics to administrators
+type DatabaseController struct {
+	slowQueries *db.SlowQueryLog
+	logger      *utils.Logger
+}
+
+// NewDatabaseController creates a new database controller; slowQueries is nil when the
+// slow-query log is disabled
+func NewDatabaseController(slowQueries *db.SlowQueryLog, logger *utils.Logger) *DatabaseController {
+	return &DatabaseController{
+		slowQueries: slowQueries,
+		logger:      logger.Named("database_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the database controller
+func (dc *DatabaseController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/db/slow-queries", dc.GetSlowQueries)
+}
+
+// GetSlowQueries returns the slow-query counters
+// @Summary Get slow-query metrics
+// @Description Returns how many statements took at least the slow-query threshold, overall and by operation (statement kind and table), most frequent first. Each slow statement is also logged at warn with its SQL, call site and request ID (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} db.SlowQueryStats "Slow-query metrics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Slow-query log disabled"
+// @Router /admin/db/slow-queries [get]
+func (dc *DatabaseController) GetSlowQueries(c *gin.Context) {
+	if dc.slowQueries == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slow-query log is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, dc.slowQueries.Stats())
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// DittoController exposes Ditto connection information for administrators
+type DittoController struct {
+	dittoManager *ditto.Manager
+	kafkaHandler *services.KafkaHandler
+	logger       *utils.Logger
+}
+
+// NewDittoController creates a new Ditto controller
+func NewDittoController(dittoManager *ditto.Manager, kafkaHandler *services.KafkaHandler, logger *utils.Logger) *DittoController {
+	return &DittoController{
+		dittoManager: dittoManager,
+		kafkaHandler: kafkaHandler,
+		logger:       logger.Named("ditto_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the Ditto controller
+func (dc *DittoController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/ditto/breaker", dc.GetBreakerStats)
+	router.GET("/ditto/forwarding", dc.GetForwardingStats)
+}
+
+// GetBreakerStats returns the state of the circuit breaker guarding Ditto API requests
+// @Summary Get Ditto circuit breaker state
+// @Description Returns the breaker state (closed, open, half_open), consecutive failures and how often it opened or rejected requests (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} ditto.BreakerStats "Circuit breaker state"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Ditto not initialized"
+// @Router /admin/ditto/breaker [get]
+func (dc *DittoController) GetBreakerStats(c *gin.Context) {
+	if dc.dittoManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ditto is not initialized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dc.dittoManager.BreakerStats())
+}
+
+// GetForwardingStats returns how many Ditto WebSocket events were forwarded to Kafka or dropped
+// @Summary Get Ditto forwarding counts
+// @Description Returns the number of Ditto WebSocket events forwarded to Kafka and dropped by namespace or as unmanaged things (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.DittoForwardStats "Forwarding counts"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Kafka handler not initialized"
+// @Router /admin/ditto/forwarding [get]
+func (dc *DittoController) GetForwardingStats(c *gin.Context) {
+	if dc.kafkaHandler == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka handler is not initialized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dc.kafkaHandler.DittoForwardStats())
+}
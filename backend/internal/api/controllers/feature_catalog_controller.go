@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureCatalogController lets administrators maintain the feature catalog
+type FeatureCatalogController struct {
+	featureCatalog *services.FeatureCatalogService
+	logger         *utils.Logger
+}
+
+// NewFeatureCatalogController creates a new feature catalog controller
+func NewFeatureCatalogController(featureCatalog *services.FeatureCatalogService, logger *utils.Logger) *FeatureCatalogController {
+	return &FeatureCatalogController{
+		featureCatalog: featureCatalog,
+		logger:         logger.Named("feature_catalog_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the feature catalog controller
+func (fc *FeatureCatalogController) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/feature-catalog/rebuild", fc.Rebuild)
+}
+
+// Rebuild repopulates the feature catalog from the stored time-series data
+// @Summary Rebuild feature catalog
+// @Description Rescans the time-series data of one twin, or of all twins, and replaces their feature catalog entries with the distinct feature paths, the value type and time of each path's latest point. Twins are rebuilt one at a time (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param twinId query int false "Only rebuild the entries of this twin"
+// @Success 200 {object} services.FeatureCatalogRebuild "Rebuilt twins and feature entries"
+// @Failure 400 {object} map[string]string "Invalid twin ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /admin/feature-catalog/rebuild [post]
+func (fc *FeatureCatalogController) Rebuild(c *gin.Context) {
+	var twinID uint64
+	if param := c.Query("twinId"); param != "" {
+		var err error
+		twinID, err = strconv.ParseUint(param, 10, 32)
+		if err != nil || twinID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+			return
+		}
+	}
+
+	result, err := fc.featureCatalog.Rebuild(c.Request.Context(), uint(twinID))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -1,10 +1,14 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/services"
 	"github.com/digital-egiz/backend/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -17,6 +21,16 @@ type TimeseriesRequest struct {
 	End         time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
 	FeaturePath string    `form:"feature_path" binding:"required"`
 	Limit       int       `form:"limit"`
+	Offset      int       `form:"offset"`
+	Order       string    `form:"order"`
+	Fields      string    `form:"fields"`
+	Source      string    `form:"source"`
+	// Unit to convert numeric values to from the feature's stored unit
+	Convert string `form:"convert"`
+	// Predicates on the stored value of each point
+	ValueGT string `form:"value_gt"`
+	ValueLT string `form:"value_lt"`
+	ValueEQ string `form:"value_eq"`
 }
 
 // AggregatedRequest defines the query parameters for aggregated data
@@ -25,6 +39,48 @@ type AggregatedRequest struct {
 	End         time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
 	FeaturePath string    `form:"feature_path" binding:"required"`
 	Interval    string    `form:"interval" binding:"required"`
+	// Unit to convert numeric values to from the feature's stored unit
+	Convert string `form:"convert"`
+}
+
+// ChartRequest defines the query parameters for a chart's aggregated trend and raw detail
+type ChartRequest struct {
+	Start       time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	End         time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	FeaturePath string    `form:"feature_path" binding:"required"`
+	Interval    string    `form:"interval" binding:"required"`
+	// Focused range within start and end whose raw points are returned
+	FocusStart time.Time `form:"focus_start" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	FocusEnd   time.Time `form:"focus_end" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	Limit      int       `form:"limit"`
+}
+
+// CompareRequest defines the query parameters for comparing two time ranges of a feature
+type CompareRequest struct {
+	FeaturePath string `form:"feature_path" binding:"required"`
+	Interval    string `form:"interval" binding:"required"`
+	// Baseline range, e.g. before maintenance
+	BaselineStart time.Time `form:"baseline_start" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	BaselineEnd   time.Time `form:"baseline_end" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	// Range compared to the baseline, e.g. after maintenance
+	CompareStart time.Time `form:"compare_start" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+	CompareEnd   time.Time `form:"compare_end" time_format:"2006-01-02T15:04:05Z07:00" binding:"required"`
+}
+
+// ExportRequest defines the query parameters for exporting history
+type ExportRequest struct {
+	Start time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End   time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Type of the exported rows: raw (default), aggregated or alerts
+	Type string `form:"type"`
+	// Format of the export: csv (default) or ndjson
+	Format      string `form:"format"`
+	FeaturePath string `form:"feature_path"`
+	Interval    string `form:"interval"`
+	Source      string `form:"source"`
+	Severity    string `form:"severity"`
+	// Acknowledged only exports acknowledged (true) or open (false) alerts
+	Acknowledged *bool `form:"acknowledged"`
 }
 
 // AlertsRequest defines the query parameters for alert data
@@ -37,15 +93,30 @@ type AlertsRequest struct {
 
 // MLPredictionRequest defines the query parameters for ML prediction data
 type MLPredictionRequest struct {
-	Start  time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
-	End    time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
-	TaskID string    `form:"task_id" binding:"required"`
-	Limit  int       `form:"limit"`
+	Start          time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End            time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	TaskID         string    `form:"task_id" binding:"required"`
+	Limit          int       `form:"limit"`
+	Offset         int       `form:"offset"`
+	PredictionType string    `form:"prediction_type" binding:"omitempty,oneof=anomaly classification regression"`
+	MinScore       *float64  `form:"min_score"`
+	Label          string    `form:"label"`
+}
+
+// AttributeHistoryRequest defines the query parameters for attribute history
+type AttributeHistoryRequest struct {
+	Start time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End   time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	// Path of the attribute, e.g. "firmwareVersion" or "location"; nested attributes are included
+	Path  string `form:"path"`
+	Limit int    `form:"limit"`
 }
 
 // AcknowledgeAlertRequest defines the request body for acknowledging an alert
 type AcknowledgeAlertRequest struct {
 	AlertID string `json:"alert_id" binding:"required"`
+	// Note is the reason for acknowledging; required for some severities
+	Note string `json:"note" binding:"max=2000"`
 }
 
 // HistoryController handles history data requests
@@ -65,27 +136,129 @@ func NewHistoryController(historyService *services.HistoryService, logger *utils
 // RegisterRoutes registers the history routes
 func (c *HistoryController) RegisterRoutes(router *gin.RouterGroup) {
 	// Routes under /twins/:id/history
+	router.Use(c.ResolveFeatureAlias)
 	router.GET("/timeseries", c.GetTimeseriesData)
 	router.GET("/timeseries/latest", c.GetLatestTimeseriesData)
-	router.GET("/aggregated", c.GetAggregatedData)
+	router.GET("/aggregated", c.LimitHeavyQueries, c.GetAggregatedData)
+	router.GET("/chart", c.LimitHeavyQueries, c.GetChartData)
+	router.GET("/compare", c.LimitHeavyQueries, c.CompareRanges)
+	router.GET("/export", c.LimitHeavyQueries, c.ExportHistory)
 	router.GET("/alerts", c.GetAlertData)
 	router.POST("/alerts/acknowledge", c.AcknowledgeAlert)
 	router.GET("/ml-predictions", c.GetMLPredictionData)
 	router.GET("/ml-predictions/latest", c.GetLatestMLPrediction)
 }
 
+// RegisterTwinRoutes registers the history routes directly under /twins
+func (c *HistoryController) RegisterTwinRoutes(router *gin.RouterGroup) {
+	router.GET("/:id/state", c.GetTwinState)
+	router.GET("/:id/features", c.ListTwinFeatures)
+	router.GET("/:id/attribute-history", c.GetAttributeHistory)
+}
+
+// RegisterAdminRoutes registers the admin-only history routes
+func (c *HistoryController) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/cache/history", c.GetCacheStats)
+	router.GET("/history/queries", c.GetQueryStats)
+}
+
+// ResolveFeatureAlias replaces a feature_path naming an alias of the twin's type with the full
+// path it stands for, so every history route accepts aliases. Full paths are left as they are.
+func (c *HistoryController) ResolveFeatureAlias(ctx *gin.Context) {
+	// The URL is read directly as gin caches the query once it is first parsed
+	query := ctx.Request.URL.Query()
+	name := query.Get("feature_path")
+	// Aliases never contain "/", so paths with one need no lookup
+	if name == "" || strings.Contains(name, "/") {
+		ctx.Next()
+		return
+	}
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.Next()
+		return
+	}
+
+	path, err := c.historyService.ResolveFeaturePath(uint(twinID), name)
+	if err != nil {
+		// Handlers answer for twins that do not exist
+		if err.Error() == "twin not found" {
+			ctx.Next()
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve feature path"})
+		return
+	}
+	if path != name {
+		query.Set("feature_path", path)
+		ctx.Request.URL.RawQuery = query.Encode()
+	}
+	ctx.Next()
+}
+
+// LimitHeavyQueries admits an expensive history read only while a query slot is free,
+// answering 503 with Retry-After otherwise instead of queuing the request
+func (c *HistoryController) LimitHeavyQueries(ctx *gin.Context) {
+	release, err := c.historyService.HeavyQueries().Acquire()
+	if err != nil {
+		if retryAfter := c.historyService.HeavyQueryRetryAfter(); retryAfter > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+		}
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Too many concurrent history queries, retry later"})
+		return
+	}
+	defer release()
+	ctx.Next()
+}
+
+// GetQueryStats returns the in-flight count of expensive history reads
+// @Summary Get history query concurrency metrics
+// @Description Returns how many expensive history reads are in flight, the limit and how many were rejected (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.QueryLimiterStats "Query concurrency metrics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /admin/history/queries [get]
+func (c *HistoryController) GetQueryStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.historyService.HeavyQueries().Stats())
+}
+
+// GetCacheStats returns history query cache metrics
+// @Summary Get history cache metrics
+// @Description Returns hit/miss counts of the aggregated and history query cache (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.QueryCacheStats "Cache metrics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /admin/cache/history [get]
+func (c *HistoryController) GetCacheStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.historyService.CacheStats())
+}
+
 // GetTimeseriesData returns time-series data for a twin
 // @Summary Get time-series data
 // @Description Returns time-series data for a twin and feature path
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
-// @Param feature_path query string true "Feature path"
+// @Param feature_path query string true "Feature path or alias"
 // @Param start query string false "Start time (ISO8601)"
 // @Param end query string false "End time (ISO8601)"
 // @Param limit query int false "Limit results"
+// @Param offset query int false "Number of points to skip"
+// @Param order query string false "Time order, asc or desc (default desc); limit and offset apply in this order"
+// @Param fields query string false "Comma-separated fields to return (e.g. time,value_num)"
+// @Param source query string false "Only return points from this source: ditto-ws, ditto-kafka, http-ingest, mqtt, simulator or ml-derived"
+// @Param convert query string false "Unit to convert numeric values to (e.g. F, kPa, ft); the feature must have a compatible unit"
+// @Param value_gt query number false "Only return points of a numeric feature with a stored value above this"
+// @Param value_lt query number false "Only return points of a numeric feature with a stored value below this"
+// @Param value_eq query string false "Only return points with this stored value, parsed as the feature's number, boolean or string type"
 // @Success 200 {array} models.TimeseriesData "Time-series data"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 404 {object} map[string]string "Twin not found"
@@ -116,10 +289,50 @@ func (c *HistoryController) GetTimeseriesData(ctx *gin.Context) {
 	if req.Limit <= 0 || req.Limit > 1000 {
 		req.Limit = 100 // Default limit
 	}
+	if req.Offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+		return
+	}
+	if req.Order == "" {
+		req.Order = "desc"
+	}
+	if req.Order != "asc" && req.Order != "desc" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+	if req.Source != "" && !services.IsValidSource(req.Source) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown source " + req.Source})
+		return
+	}
 
-	// Get data from service
-	data, err := c.historyService.GetTimeseriesData(uint(twinID), req.FeaturePath, req.Start, req.End, req.Limit)
+	// Get data from service, reading only the requested columns
+	fields := utils.ParseFields(req.Fields)
+	columns := fields
+	if req.Convert != "" && len(fields) > 0 {
+		// Only numeric points are converted, so their type is read even when not returned
+		columns = append(append([]string(nil), fields...), "value_type")
+	}
+	page := services.TimeseriesPage{Limit: req.Limit, Offset: req.Offset, Ascending: req.Order == "asc", Source: req.Source}
+	filter := services.ValueFilter{GreaterThan: req.ValueGT, LessThan: req.ValueLT, Equal: req.ValueEQ}
+	page.Value, err = c.historyService.ParseValuePredicate(ctx.Request.Context(), uint(twinID), req.FeaturePath, filter)
 	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidValuePredicate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve time-series data"})
+		}
+		return
+	}
+	data, err := c.historyService.GetTimeseriesData(ctx.Request.Context(), uint(twinID), req.FeaturePath, req.Start, req.End, page, columns...)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid field") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		c.logger.Error("Failed to get time-series data",
 			zap.Uint64("twin_id", twinID),
 			zap.String("feature_path", req.FeaturePath),
@@ -134,14 +347,155 @@ func (c *HistoryController) GetTimeseriesData(ctx *gin.Context) {
 		return
 	}
 
+	meta := gin.H{
+		"twin_id":      twinID,
+		"feature_path": req.FeaturePath,
+		"start":        req.Start,
+		"end":          req.End,
+		"order":        req.Order,
+		"limit":        req.Limit,
+		"offset":       req.Offset,
+		"count":        len(data),
+	}
+	if req.Convert != "" {
+		conversion, ok := c.unitConversion(ctx, uint(twinID), req.FeaturePath, req.Convert)
+		if !ok {
+			return
+		}
+		data = conversion.Timeseries(data)
+		meta["unit"] = conversion.To
+	}
+
+	projected, err := utils.ProjectFields(data, fields)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve time-series data"})
+		return
+	}
+
+	utils.Render(ctx, http.StatusOK, gin.H{
+		"data": projected,
+		"meta": meta,
+	})
+}
+
+// GetTwinState handles getting the latest value of each primary feature of a twin.
+// ?all=true returns every stored feature instead.
+func (c *HistoryController) GetTwinState(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	all, _ := strconv.ParseBool(ctx.DefaultQuery("all", "false"))
+	state, err := c.historyService.GetTwinState(ctx.Request.Context(), uint(twinID), all)
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+			return
+		}
+
+		c.logger.Error("Failed to get twin state", zap.Uint64("twin_id", twinID), zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve twin state"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, state)
+}
+
+// FeatureListRequest defines the query of a twin's feature listing
+type FeatureListRequest struct {
+	Q      string `form:"q"`
+	Limit  int    `form:"limit"`
+	Offset int    `form:"offset"`
+}
+
+// ListTwinFeatures handles listing the features a twin has recorded values for
+// @Summary List twin features
+// @Description Returns a page of the features a twin has recorded values for, ordered by path, with the type and time of each feature's latest value, its alias, and the display metadata its twin type declares for it (order, group, icon, unit and range) as in the twin detail. The listing is read from the feature catalog kept on ingest.
+// @Tags history
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param q query string false "Only list features whose path or alias contains this, ignoring case"
+// @Param limit query int false "Features per page (default 100, capped by history.max_feature_page_size)"
+// @Param offset query int false "Features to skip"
+// @Success 200 {object} services.FeatureList "Page of features and the number matching"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /twins/{id}/features [get]
+func (c *HistoryController) ListTwinFeatures(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req FeatureListRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit and offset must not be negative"})
+		return
+	}
+
+	features, err := c.historyService.ListFeatures(ctx.Request.Context(), uint(twinID), services.FeatureListQuery{
+		Search: req.Q,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+			return
+		}
+
+		c.logger.Error("Failed to list twin features", zap.Uint64("twin_id", twinID), zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list twin features"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, features)
+}
+
+// GetAttributeHistory handles listing the changes of a twin's Ditto attributes, newest first
+func (c *HistoryController) GetAttributeHistory(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req AttributeHistoryRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	changes, err := c.historyService.GetAttributeHistory(uint(twinID), req.Path, req.Start, req.End, req.Limit)
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+			return
+		}
+
+		c.logger.Error("Failed to get attribute history",
+			zap.Uint64("twin_id", twinID),
+			zap.String("path", req.Path),
+			zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attribute history"})
+		return
+	}
+
 	ctx.JSON(http.StatusOK, gin.H{
-		"data": data,
+		"data": changes,
 		"meta": gin.H{
-			"twin_id":      twinID,
-			"feature_path": req.FeaturePath,
-			"start":        req.Start,
-			"end":          req.End,
-			"count":        len(data),
+			"twin_id": twinID,
+			"path":    req.Path,
+			"count":   len(changes),
 		},
 	})
 }
@@ -151,10 +505,11 @@ func (c *HistoryController) GetTimeseriesData(ctx *gin.Context) {
 // @Description Returns the latest time-series data point for a twin and feature path
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
-// @Param feature_path query string true "Feature path"
+// @Param feature_path query string true "Feature path or alias"
+// @Param fields query string false "Comma-separated fields to return (e.g. time,value_num)"
 // @Success 200 {object} models.TimeseriesData "Latest time-series data"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 404 {object} map[string]string "Twin not found or no data available"
@@ -175,9 +530,15 @@ func (c *HistoryController) GetLatestTimeseriesData(ctx *gin.Context) {
 		return
 	}
 
-	// Get data from service
-	data, err := c.historyService.GetLatestTimeseriesData(uint(twinID), featurePath)
+	// Get data from service, reading only the requested columns
+	fields := utils.ParseFields(ctx.Query("fields"))
+	data, err := c.historyService.GetLatestTimeseriesData(ctx.Request.Context(), uint(twinID), featurePath, fields...)
 	if err != nil {
+		if strings.HasPrefix(err.Error(), "invalid field") {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		c.logger.Error("Failed to get latest time-series data",
 			zap.Uint64("twin_id", twinID),
 			zap.String("feature_path", featurePath),
@@ -197,8 +558,14 @@ func (c *HistoryController) GetLatestTimeseriesData(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"data": data,
+	projected, err := utils.ProjectFields(data, fields)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve latest time-series data"})
+		return
+	}
+
+	utils.Render(ctx, http.StatusOK, gin.H{
+		"data": projected,
 		"meta": gin.H{
 			"twin_id":      twinID,
 			"feature_path": featurePath,
@@ -211,13 +578,14 @@ func (c *HistoryController) GetLatestTimeseriesData(ctx *gin.Context) {
 // @Description Returns aggregated time-series data for a twin and feature path
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
-// @Param feature_path query string true "Feature path"
+// @Param feature_path query string true "Feature path or alias"
 // @Param start query string true "Start time (ISO8601)"
 // @Param end query string true "End time (ISO8601)"
 // @Param interval query string true "Aggregation interval (1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon)"
+// @Param convert query string false "Unit to convert values to (e.g. F, kPa, ft); the feature must have a compatible unit"
 // @Success 200 {array} models.AggregatedData "Aggregated time-series data"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 404 {object} map[string]string "Twin not found"
@@ -239,7 +607,7 @@ func (c *HistoryController) GetAggregatedData(ctx *gin.Context) {
 	}
 
 	// Get data from service
-	data, err := c.historyService.GetAggregatedData(uint(twinID), req.FeaturePath, req.Start, req.End, req.Interval)
+	data, err := c.historyService.GetAggregatedData(ctx.Request.Context(), uint(twinID), req.FeaturePath, req.Start, req.End, req.Interval)
 	if err != nil {
 		c.logger.Error("Failed to get aggregated data",
 			zap.Uint64("twin_id", twinID),
@@ -252,34 +620,313 @@ func (c *HistoryController) GetAggregatedData(ctx *gin.Context) {
 			return
 		}
 
-		if err.Error() == "invalid interval" {
+		if strings.HasPrefix(err.Error(), "invalid interval") {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval. Supported values: 1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon"})
 			return
 		}
 
+		if errors.Is(err, services.ErrTooManyBuckets) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve aggregated data"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	meta := gin.H{
+		"twin_id":      twinID,
+		"feature_path": req.FeaturePath,
+		"start":        req.Start,
+		"end":          req.End,
+		"interval":     req.Interval,
+		"count":        len(data),
+	}
+	if req.Convert != "" {
+		conversion, ok := c.unitConversion(ctx, uint(twinID), req.FeaturePath, req.Convert)
+		if !ok {
+			return
+		}
+		data = conversion.Aggregated(data)
+		meta["unit"] = conversion.To
+	}
+
+	utils.Render(ctx, http.StatusOK, gin.H{
 		"data": data,
+		"meta": meta,
+	})
+}
+
+// GetChartData returns aggregated data for a range and raw data for a focused range within it
+// @Summary Get chart data
+// @Description Returns aggregated buckets for the full range plus raw points, oldest first, for a focused sub-range
+// @Tags history
+// @Accept json
+// @Produce json,application/msgpack
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param feature_path query string true "Feature path or alias"
+// @Param start query string true "Start time (ISO8601)"
+// @Param end query string true "End time (ISO8601)"
+// @Param interval query string true "Aggregation interval (1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon)"
+// @Param focus_start query string true "Start of the raw range (ISO8601), not before start"
+// @Param focus_end query string true "End of the raw range (ISO8601), not after end"
+// @Param limit query int false "Maximum raw points (default and maximum 1000)"
+// @Success 200 {object} map[string]interface{} "Aggregated and raw data"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /twins/{id}/history/chart [get]
+func (c *HistoryController) GetChartData(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req ChartRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chart, err := c.historyService.GetChartData(ctx.Request.Context(), services.ChartQuery{
+		TwinID:      uint(twinID),
+		FeaturePath: req.FeaturePath,
+		Start:       req.Start,
+		End:         req.End,
+		Interval:    req.Interval,
+		FocusStart:  req.FocusStart,
+		FocusEnd:    req.FocusEnd,
+		RawLimit:    req.Limit,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidChartRange), errors.Is(err, services.ErrTooManyBuckets):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "invalid interval"):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval. Supported values: 1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon"})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+		default:
+			c.logger.Error("Failed to get chart data",
+				zap.Uint64("twin_id", twinID),
+				zap.String("feature_path", req.FeaturePath),
+				zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chart data"})
+		}
+		return
+	}
+
+	utils.Render(ctx, http.StatusOK, gin.H{
+		"aggregated": chart.Aggregated,
+		"raw":        chart.Raw,
+		"meta": gin.H{
+			"twin_id":          twinID,
+			"feature_path":     req.FeaturePath,
+			"start":            req.Start,
+			"end":              req.End,
+			"interval":         req.Interval,
+			"focus_start":      req.FocusStart,
+			"focus_end":        req.FocusEnd,
+			"aggregated_count": len(chart.Aggregated),
+			"raw_count":        len(chart.Raw),
+			"raw_limit":        chart.RawLimit,
+			// The focused range holds more points than were returned
+			"raw_truncated": len(chart.Raw) == chart.RawLimit,
+		},
+	})
+}
+
+// CompareRanges returns the aggregated series of two time ranges of a feature, aligned, with the change between them
+// @Summary Compare two time ranges
+// @Description Returns the aggregated buckets of a baseline and a comparison range of the same feature, paired by their offset from the start of each range so they can be overlaid, with the sample-weighted mean, minimum and maximum of each range and their change. Percentages are relative to the baseline and null if it is 0.
+// @Tags history
+// @Accept json
+// @Produce json,application/msgpack
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param feature_path query string true "Feature path or alias"
+// @Param interval query string true "Aggregation interval (1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon)"
+// @Param baseline_start query string true "Start of the baseline range (ISO8601)"
+// @Param baseline_end query string true "End of the baseline range (ISO8601)"
+// @Param compare_start query string true "Start of the compared range (ISO8601)"
+// @Param compare_end query string true "End of the compared range (ISO8601)"
+// @Success 200 {object} map[string]interface{} "Aligned series, range summaries and their change"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Failure 503 {object} map[string]string "Too many concurrent history queries"
+// @Router /twins/{id}/history/compare [get]
+func (c *HistoryController) CompareRanges(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req CompareRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comparison, err := c.historyService.CompareRanges(ctx.Request.Context(), services.CompareQuery{
+		TwinID:      uint(twinID),
+		FeaturePath: req.FeaturePath,
+		Interval:    req.Interval,
+		Baseline:    services.TimeRange{Start: req.BaselineStart, End: req.BaselineEnd},
+		Comparison:  services.TimeRange{Start: req.CompareStart, End: req.CompareEnd},
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidCompareRange), errors.Is(err, services.ErrTooManyBuckets):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "invalid interval"):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid interval. Supported values: 1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon"})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+		default:
+			c.logger.Error("Failed to compare time ranges",
+				zap.Uint64("twin_id", twinID),
+				zap.String("feature_path", req.FeaturePath),
+				zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compare time ranges"})
+		}
+		return
+	}
+
+	utils.Render(ctx, http.StatusOK, gin.H{
+		"baseline":   comparison.Baseline,
+		"comparison": comparison.Comparison,
+		"delta":      comparison.Delta,
+		"series":     comparison.Series,
 		"meta": gin.H{
 			"twin_id":      twinID,
 			"feature_path": req.FeaturePath,
-			"start":        req.Start,
-			"end":          req.End,
 			"interval":     req.Interval,
-			"count":        len(data),
+			"bucket_count": len(comparison.Series),
 		},
 	})
 }
 
+// ExportHistory streams a twin's raw points, aggregated buckets or alerts as CSV or NDJSON
+// @Summary Export history
+// @Description Streams the raw points or aggregated buckets of a feature, or the alerts of a twin, oldest first. CSV exports start with a header row naming the columns.
+// @Tags history
+// @Produce text/csv,application/x-ndjson
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param type query string false "Rows to export: raw (default), aggregated or alerts"
+// @Param format query string false "csv (default) or ndjson"
+// @Param start query string false "Start time (ISO8601), default 24 hours ago"
+// @Param end query string false "End time (ISO8601), default now"
+// @Param feature_path query string false "Feature path or alias, required for raw and aggregated exports"
+// @Param interval query string false "Aggregation interval for aggregated exports (1m, 5m, 15m, 30m, 1h, 6h, 12h, 1d, 1w, 1mon)"
+// @Param source query string false "Only export raw points from this source"
+// @Param severity query string false "Only export alerts of this severity (info, warning, error, critical)"
+// @Param acknowledged query bool false "Only export acknowledged (true) or open (false) alerts"
+// @Success 200 {string} string "Exported rows"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Failure 503 {object} map[string]string "Too many concurrent history queries"
+// @Router /twins/{id}/history/export [get]
+func (c *HistoryController) ExportHistory(ctx *gin.Context) {
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req ExportRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Default values
+	if req.Start.IsZero() {
+		req.Start = time.Now().Add(-24 * time.Hour) // Default to last 24 hours
+	}
+	if req.End.IsZero() {
+		req.End = time.Now()
+	}
+	if req.Type == "" {
+		req.Type = services.ExportRaw
+	}
+	if req.Format == "" {
+		req.Format = services.ExportCSV
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	userRole, _ := ctx.Get("user_role")
+
+	export, err := c.historyService.PrepareExport(services.ExportQuery{
+		TwinID:       uint(twinID),
+		Type:         req.Type,
+		Format:       req.Format,
+		Start:        req.Start,
+		End:          req.End,
+		FeaturePath:  req.FeaturePath,
+		Interval:     req.Interval,
+		Source:       req.Source,
+		Severity:     req.Severity,
+		Acknowledged: req.Acknowledged,
+		UserID:       uid,
+		IsAdmin:      userRole == string(models.RoleAdmin),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidExport), errors.Is(err, services.ErrTooManyBuckets):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrExportAccessDenied):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Twin not found"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export history"})
+		}
+		return
+	}
+
+	ctx.Header("Content-Type", export.ContentType())
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename()))
+	// Long exports outlast the server's write timeout, which would cut the connection mid-stream
+	_ = http.NewResponseController(ctx.Writer).SetWriteDeadline(time.Time{})
+	ctx.Status(http.StatusOK)
+	// The status is sent with the first row, so a failure after it can only cut the export short
+	if err := export.WriteTo(ctx.Request.Context(), ctx.Writer); err != nil {
+		c.logger.Error("Export ended early",
+			zap.Uint64("twin_id", twinID),
+			zap.String("type", req.Type),
+			zap.Error(err))
+	}
+}
+
+// unitConversion looks up the conversion of a feature's values to the requested unit,
+// writing the error response if there is none
+func (c *HistoryController) unitConversion(ctx *gin.Context, twinID uint, featurePath, unit string) (*services.UnitConversion, bool) {
+	conversion, err := c.historyService.FeatureUnitConversion(twinID, featurePath, unit)
+	if err != nil {
+		if errors.Is(err, services.ErrUnitConversion) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert values"})
+		return nil, false
+	}
+	return conversion, true
+}
+
 // GetAlertData returns alert data for a twin
 // @Summary Get alert data
 // @Description Returns alert data for a twin
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
 // @Param start query string false "Start time (ISO8601)"
@@ -318,7 +965,7 @@ func (c *HistoryController) GetAlertData(ctx *gin.Context) {
 	}
 
 	// Get data from service
-	data, err := c.historyService.GetAlertData(uint(twinID), req.Start, req.End, req.Severity, req.Limit)
+	data, err := c.historyService.GetAlertData(ctx.Request.Context(), uint(twinID), req.Start, req.End, req.Severity, req.Limit)
 	if err != nil {
 		c.logger.Error("Failed to get alert data",
 			zap.Uint64("twin_id", twinID),
@@ -339,7 +986,7 @@ func (c *HistoryController) GetAlertData(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	utils.Render(ctx, http.StatusOK, gin.H{
 		"data": data,
 		"meta": gin.H{
 			"twin_id":  twinID,
@@ -353,7 +1000,7 @@ func (c *HistoryController) GetAlertData(ctx *gin.Context) {
 
 // AcknowledgeAlert acknowledges an alert
 // @Summary Acknowledge alert
-// @Description Acknowledges an alert
+// @Description Acknowledges an alert. A note explaining the acknowledgement is required for severities configured in the ack policy (by default critical and error).
 // @Tags history
 // @Accept json
 // @Produce json
@@ -362,6 +1009,7 @@ func (c *HistoryController) GetAlertData(ctx *gin.Context) {
 // @Param request body AcknowledgeAlertRequest true "Acknowledge alert request"
 // @Success 200 {object} map[string]string "Alert acknowledged"
 // @Failure 400 {object} map[string]string "Bad request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Note required for this severity"
 // @Failure 404 {object} map[string]string "Alert not found or already acknowledged"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /twins/{id}/history/alerts/acknowledge [post]
@@ -388,7 +1036,19 @@ func (c *HistoryController) AcknowledgeAlert(ctx *gin.Context) {
 	}
 
 	// Acknowledge alert
-	if err := c.historyService.AcknowledgeAlert(req.AlertID, userID.(uint)); err != nil {
+	if err := c.historyService.AcknowledgeAlert(req.AlertID, userID.(uint), req.Note); err != nil {
+		if strings.HasPrefix(err.Error(), "ack note required") {
+			ctx.JSON(http.StatusUnprocessableEntity, utils.ValidationErrorResponse{
+				Error: "Validation failed",
+				Errors: []utils.ValidationError{{
+					Field:   "note",
+					Rule:    "required",
+					Message: err.Error(),
+				}},
+			})
+			return
+		}
+
 		c.logger.Error("Failed to acknowledge alert",
 			zap.String("alert_id", req.AlertID),
 			zap.Uint("user_id", userID.(uint)),
@@ -411,14 +1071,18 @@ func (c *HistoryController) AcknowledgeAlert(ctx *gin.Context) {
 // @Description Returns ML prediction data for a twin and task
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
 // @Param task_id query string true "ML task ID"
 // @Param start query string false "Start time (ISO8601)"
 // @Param end query string false "End time (ISO8601)"
 // @Param limit query int false "Limit results"
-// @Success 200 {array} models.MLPredictionData "ML prediction data"
+// @Param offset query int false "Number of matching predictions to skip"
+// @Param prediction_type query string false "Only predictions of this type (anomaly, classification, regression)"
+// @Param min_score query number false "Only predictions scoring at least this"
+// @Param label query string false "Only predictions with this label"
+// @Success 200 {array} models.MLPredictionData "ML prediction data, with the total number of matching predictions in meta"
 // @Failure 400 {object} map[string]string "Bad request"
 // @Failure 404 {object} map[string]string "Twin not found"
 // @Failure 500 {object} map[string]string "Server error"
@@ -448,9 +1112,14 @@ func (c *HistoryController) GetMLPredictionData(ctx *gin.Context) {
 	if req.Limit <= 0 || req.Limit > 1000 {
 		req.Limit = 100 // Default limit
 	}
+	if req.Offset < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "offset must not be negative"})
+		return
+	}
 
 	// Get data from service
-	data, err := c.historyService.GetMLPredictionData(uint(twinID), req.TaskID, req.Start, req.End, req.Limit)
+	filter := services.MLPredictionFilter{PredictionType: req.PredictionType, MinScore: req.MinScore, Label: req.Label}
+	data, total, err := c.historyService.GetMLPredictionData(ctx.Request.Context(), uint(twinID), req.TaskID, req.Start, req.End, filter, req.Limit, req.Offset)
 	if err != nil {
 		c.logger.Error("Failed to get ML prediction data",
 			zap.Uint64("twin_id", twinID),
@@ -466,14 +1135,20 @@ func (c *HistoryController) GetMLPredictionData(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	utils.Render(ctx, http.StatusOK, gin.H{
 		"data": data,
 		"meta": gin.H{
-			"twin_id": twinID,
-			"task_id": req.TaskID,
-			"start":   req.Start,
-			"end":     req.End,
-			"count":   len(data),
+			"twin_id":         twinID,
+			"task_id":         req.TaskID,
+			"start":           req.Start,
+			"end":             req.End,
+			"prediction_type": req.PredictionType,
+			"min_score":       req.MinScore,
+			"label":           req.Label,
+			"count":           len(data),
+			"total":           total,
+			"limit":           req.Limit,
+			"offset":          req.Offset,
 		},
 	})
 }
@@ -483,7 +1158,7 @@ func (c *HistoryController) GetMLPredictionData(ctx *gin.Context) {
 // @Description Returns the latest ML prediction for a twin and task
 // @Tags history
 // @Accept json
-// @Produce json
+// @Produce json,application/msgpack
 // @Security Bearer
 // @Param id path int true "Twin ID"
 // @Param task_id query string true "ML task ID"
@@ -508,7 +1183,7 @@ func (c *HistoryController) GetLatestMLPrediction(ctx *gin.Context) {
 	}
 
 	// Get data from service
-	data, err := c.historyService.GetLatestMLPrediction(uint(twinID), taskID)
+	data, err := c.historyService.GetLatestMLPrediction(ctx.Request.Context(), uint(twinID), taskID)
 	if err != nil {
 		c.logger.Error("Failed to get latest ML prediction",
 			zap.Uint64("twin_id", twinID),
@@ -529,7 +1204,7 @@ func (c *HistoryController) GetLatestMLPrediction(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
+	utils.Render(ctx, http.StatusOK, gin.H{
 		"data": data,
 		"meta": gin.H{
 			"twin_id": twinID,
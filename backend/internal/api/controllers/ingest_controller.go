@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// IngestValueRequest represents a feature value pushed for a twin.
+// The timestamp defaults to the time the value is received. Devices resending buffered values
+// number them per feature with an increasing sequence, so values already ingested are dropped.
+type IngestValueRequest struct {
+	Feature   string          `json:"feature" binding:"required"`
+	Value     json.RawMessage `json:"value" binding:"required"`
+	Timestamp *time.Time      `json:"timestamp"`
+	Sequence  *uint64         `json:"sequence" binding:"omitempty,min=1"`
+}
+
+// IngestBatchRequest represents several feature values pushed for a twin
+type IngestBatchRequest struct {
+	Values []IngestValueRequest `json:"values" binding:"required,min=1,dive"`
+}
+
+// IngestController handles pushing feature values over HTTP, for deployments without Kafka
+type IngestController struct {
+	ingestService  *services.IngestService
+	twinService    *services.TwinService
+	projectService *services.ProjectService
+	logger         *utils.Logger
+}
+
+// NewIngestController creates a new ingest controller
+func NewIngestController(
+	ingestService *services.IngestService,
+	twinService *services.TwinService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *IngestController {
+	return &IngestController{
+		ingestService:  ingestService,
+		twinService:    twinService,
+		projectService: projectService,
+		logger:         logger.Named("ingest_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the twins router group
+func (ic *IngestController) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:id/ingest", ic.IngestValue)
+	router.POST("/:id/ingest/batch", ic.IngestBatch)
+}
+
+// RegisterAdminRoutes registers the admin-only ingest routes
+func (ic *IngestController) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/ingest/timestamps", ic.GetTimestampStats)
+}
+
+// GetTimestampStats returns the counts of ingested points timestamped outside the accepted window
+// @Summary Get out-of-window timestamp metrics
+// @Description Returns how many ingested points were timestamped too far in the future or the past since startup, and how many of them were rejected or clamped (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.TimestampStats "Timestamp metrics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /admin/ingest/timestamps [get]
+func (ic *IngestController) GetTimestampStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ic.ingestService.TimestampStats())
+}
+
+// IngestValue stores a single feature value of a twin
+// @Summary Ingest a feature value
+// @Description Stores a feature value of a twin through the same processing as Kafka ingestion (project editors only). A value with a sequence at or below the feature's last ingested sequence is dropped and counted as a duplicate.
+// @Tags ingest
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param request body IngestValueRequest true "Feature value"
+// @Success 201 {object} services.IngestResult "Stored values"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 422 {object} map[string]string "Value rejected by the feature's type policy or the project's timestamp policy"
+// @Failure 429 {object} map[string]string "Ingest rate limit exceeded"
+// @Router /twins/{id}/ingest [post]
+func (ic *IngestController) IngestValue(ctx *gin.Context) {
+	twin, ok := ic.authorizeTwin(ctx)
+	if !ok {
+		return
+	}
+
+	var req IngestValueRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	result, ok := ic.ingest(ctx, twin, []IngestValueRequest{req})
+	if !ok {
+		return
+	}
+
+	if len(result.Rejected) > 0 {
+		rejection := result.Rejected[0]
+		if errors.Is(rejection.Err, services.ErrTypeViolation) || errors.Is(rejection.Err, services.ErrTimestampOutOfRange) {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": rejection.Error})
+			return
+		}
+		ic.logger.Error("Failed to ingest value", zap.Uint("twin_id", twin.ID), zap.Error(rejection.Err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": rejection.Error})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, result)
+}
+
+// IngestBatch stores several feature values of a twin
+// @Summary Ingest a batch of feature values
+// @Description Stores feature values of a twin through the same processing as Kafka ingestion (project editors only). Values rejected by their feature's type policy are listed in the response; numbered values already ingested are dropped and counted as duplicates.
+// @Tags ingest
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param request body IngestBatchRequest true "Feature values"
+// @Success 201 {object} services.IngestResult "Stored and rejected values"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 429 {object} map[string]string "Ingest rate limit exceeded"
+// @Router /twins/{id}/ingest/batch [post]
+func (ic *IngestController) IngestBatch(ctx *gin.Context) {
+	twin, ok := ic.authorizeTwin(ctx)
+	if !ok {
+		return
+	}
+
+	var req IngestBatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	result, ok := ic.ingest(ctx, twin, req.Values)
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, result)
+}
+
+// authorizeTwin loads the twin of the request and checks the user may edit its project
+func (ic *IngestController) authorizeTwin(ctx *gin.Context) (*models.Twin, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return nil, false
+	}
+
+	twin, err := ic.twinService.GetByID(uint(id))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	// Admins may ingest into every project
+	if userRole, _ := ctx.Get("user_role"); userRole == string(models.RoleAdmin) {
+		return twin, true
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	hasAccess, err := ic.projectService.CheckAccess(twin.ProjectID, uid, models.ProjectRoleEditor)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+		return nil, false
+	}
+	if !hasAccess {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+		return nil, false
+	}
+
+	return twin, true
+}
+
+// ingest passes request values to the ingest service and writes the error response if it fails
+func (ic *IngestController) ingest(ctx *gin.Context, twin *models.Twin, values []IngestValueRequest) (*services.IngestResult, bool) {
+	featureValues := make([]services.FeatureValue, len(values))
+	for i, value := range values {
+		featureValues[i] = services.FeatureValue{FeatureID: value.Feature, Data: value.Value}
+		if value.Timestamp != nil {
+			featureValues[i].Timestamp = *value.Timestamp
+		}
+		if value.Sequence != nil {
+			featureValues[i].Sequence = *value.Sequence
+		}
+	}
+
+	result, err := ic.ingestService.Ingest(twin, featureValues)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrIngestRateLimited):
+			ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case err.Error() == "database error":
+			ic.logger.Error("Failed to ingest values", zap.Uint("twin_id", twin.ID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	return result, true
+}
@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// KafkaController exposes Kafka runtime information for administrators
+type KafkaController struct {
+	kafkaManager   *kafka.Manager
+	dlqReprocessor *kafka.DLQReprocessor
+	logger         *utils.Logger
+}
+
+// DLQReplayRequest selects the topic whose dead-lettered messages are replayed
+type DLQReplayRequest struct {
+	Topic string `json:"topic" binding:"required"`
+}
+
+// defaultDLQInspectLimit is the number of dead-lettered messages returned when no limit is given
+const defaultDLQInspectLimit = 50
+
+// NewKafkaController creates a new Kafka controller
+func NewKafkaController(kafkaManager *kafka.Manager, dlqReprocessor *kafka.DLQReprocessor, logger *utils.Logger) *KafkaController {
+	return &KafkaController{
+		kafkaManager:   kafkaManager,
+		dlqReprocessor: dlqReprocessor,
+		logger:         logger.Named("kafka_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the Kafka controller
+func (kc *KafkaController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/kafka/consumers", kc.ListConsumers)
+	router.GET("/kafka/consumers/:name", kc.GetConsumer)
+	router.GET("/dlq", kc.InspectDLQ)
+	router.POST("/dlq/replay", kc.ReplayDLQ)
+}
+
+// ListConsumers returns the registered Kafka consumers
+// @Summary List Kafka consumers
+// @Description Returns registered consumers with their topics, group and running state (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Registered consumers"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Kafka not initialized"
+// @Router /admin/kafka/consumers [get]
+func (kc *KafkaController) ListConsumers(c *gin.Context) {
+	if kc.kafkaManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka is not initialized"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":    kc.kafkaManager.ListConsumers(),
+		"running": kc.kafkaManager.IsRunning(),
+	})
+}
+
+// GetConsumer returns the progress and error diagnostics of a Kafka consumer
+// @Summary Get Kafka consumer diagnostics
+// @Description Returns a consumer's last processed offset and time, last error, consecutive failures, paused state and health status (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Consumer name"
+// @Success 200 {object} kafka.ConsumerDiagnostics "Consumer diagnostics"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Consumer not found"
+// @Failure 503 {object} map[string]string "Kafka not initialized"
+// @Router /admin/kafka/consumers/{name} [get]
+func (kc *KafkaController) GetConsumer(c *gin.Context) {
+	if kc.kafkaManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka is not initialized"})
+		return
+	}
+
+	diagnostics, err := kc.kafkaManager.GetConsumer(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, kafka.ErrConsumerNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Consumer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get consumer diagnostics"})
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnostics)
+}
+
+// InspectDLQ returns the dead-letter counts of all topics, or the messages waiting in one topic's DLQ
+// @Summary Inspect dead-lettered messages
+// @Description Without a topic, returns pending and replay counts per topic. With a topic, also returns its waiting messages (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param topic query string false "Topic whose DLQ messages are listed"
+// @Param limit query int false "Maximum messages to list (default 50)"
+// @Success 200 {object} map[string]interface{} "DLQ stats and messages"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Kafka not running"
+// @Router /admin/dlq [get]
+func (kc *KafkaController) InspectDLQ(c *gin.Context) {
+	if kc.dlqReprocessor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka is not initialized"})
+		return
+	}
+
+	topic := c.Query("topic")
+	if topic == "" {
+		stats, err := kc.dlqReprocessor.Stats()
+		if err != nil {
+			kc.respondDLQError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": stats})
+		return
+	}
+
+	limit := defaultDLQInspectLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+		limit = parsed
+	}
+
+	messages, stats, err := kc.dlqReprocessor.Inspect(c.Request.Context(), topic, limit)
+	if err != nil {
+		kc.respondDLQError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": messages, "stats": stats})
+}
+
+// ReplayDLQ re-applies the original handlers to the dead-lettered messages of a topic
+// @Summary Replay dead-lettered messages
+// @Description Replays a topic's DLQ: handled messages are removed, failing ones are requeued or parked after the maximum attempts (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body DLQReplayRequest true "Topic to replay"
+// @Success 200 {object} kafka.DLQReplayResult "Replay outcome"
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Kafka not running"
+// @Router /admin/dlq/replay [post]
+func (kc *KafkaController) ReplayDLQ(c *gin.Context) {
+	if kc.dlqReprocessor == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka is not initialized"})
+		return
+	}
+
+	var req DLQReplayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := kc.dlqReprocessor.Replay(c.Request.Context(), req.Topic)
+	if err != nil {
+		kc.respondDLQError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// respondDLQError maps a DLQ operation error to a response
+func (kc *KafkaController) respondDLQError(c *gin.Context, err error) {
+	if errors.Is(err, kafka.ErrKafkaNotRunning) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Kafka is not running"})
+		return
+	}
+
+	kc.logger.Error("DLQ operation failed", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access the DLQ"})
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MaintenanceRequest switches maintenance mode on or off
+type MaintenanceRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Reason  string `json:"reason" binding:"max=500"`
+}
+
+// MaintenanceController lets administrators switch maintenance mode
+type MaintenanceController struct {
+	maintenance *services.MaintenanceService
+	logger      *utils.Logger
+}
+
+// NewMaintenanceController creates a new maintenance controller
+func NewMaintenanceController(maintenance *services.MaintenanceService, logger *utils.Logger) *MaintenanceController {
+	return &MaintenanceController{
+		maintenance: maintenance,
+		logger:      logger.Named("maintenance_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the maintenance controller
+func (mc *MaintenanceController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/maintenance", mc.GetStatus)
+	router.PUT("/maintenance", mc.SetMode)
+}
+
+// GetStatus returns the maintenance mode state
+// @Summary Get maintenance mode
+// @Description Returns whether maintenance mode is on, since when and which components it paused (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.MaintenanceStatus "Maintenance state"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /admin/maintenance [get]
+func (mc *MaintenanceController) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, mc.maintenance.Status())
+}
+
+// SetMode switches maintenance mode on or off
+// @Summary Switch maintenance mode
+// @Description Turns maintenance mode on or off. While on, mutating endpoints return 503 with Retry-After and Kafka consumers are paused; reads keep working (admin only)
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body MaintenanceRequest true "Maintenance mode"
+// @Success 200 {object} services.MaintenanceStatus "Maintenance state"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 500 {object} map[string]string "Some components could not be paused or resumed"
+// @Router /admin/maintenance [put]
+func (mc *MaintenanceController) SetMode(c *gin.Context) {
+	var req MaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	var err error
+	if *req.Enabled {
+		err = mc.maintenance.Enable(req.Reason)
+	} else {
+		err = mc.maintenance.Disable()
+	}
+	if err != nil {
+		mc.logger.Error("Failed to switch maintenance mode", zap.Bool("enabled", *req.Enabled), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Maintenance mode switched, but some components failed: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mc.maintenance.Status())
+}
@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MLBackfillRequest represents a request to re-send historical values of a twin to an ML task
+type MLBackfillRequest struct {
+	TaskID uint      `json:"task_id" binding:"required"`
+	Start  time.Time `json:"start" binding:"required"`
+	End    time.Time `json:"end" binding:"required"`
+}
+
+// MLBackfillController handles backfilling ML tasks with historical twin values
+type MLBackfillController struct {
+	backfillService *services.MLBackfillService
+	twinService     *services.TwinService
+	projectService  *services.ProjectService
+	logger          *utils.Logger
+}
+
+// NewMLBackfillController creates a new ML backfill controller
+func NewMLBackfillController(
+	backfillService *services.MLBackfillService,
+	twinService *services.TwinService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *MLBackfillController {
+	return &MLBackfillController{
+		backfillService: backfillService,
+		twinService:     twinService,
+		projectService:  projectService,
+		logger:          logger.Named("ml_backfill_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the twins router group
+func (bc *MLBackfillController) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:id/ml/backfill", bc.StartBackfill)
+	router.GET("/:id/ml/backfill/:jobId", bc.GetBackfill)
+}
+
+// StartBackfill starts sending the stored values of a twin within a window to an ML task
+// @Summary Backfill an ML task
+// @Description Sends the stored values of the twin's features mapped to the task, between start and end, to the ML input topic in time order (project owners only). Outputs for backfilled values are stored without writeback or notifications.
+// @Tags ml
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param request body MLBackfillRequest true "Task and time range"
+// @Success 202 {object} models.MLBackfillJob "Started backfill job"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found or task not bound to it"
+// @Failure 409 {object} map[string]string "Backfill already running"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 503 {object} map[string]string "ML backfill not available"
+// @Router /twins/{id}/ml/backfill [post]
+func (bc *MLBackfillController) StartBackfill(ctx *gin.Context) {
+	twin, ok := bc.authorizeTwin(ctx)
+	if !ok {
+		return
+	}
+
+	var req MLBackfillRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	job, err := bc.backfillService.Backfill(twin, req.TaskID, req.Start, req.End, uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidBackfillRange):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBackfillRunning):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrBackfillUnavailable):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		case err.Error() == "ML task is not bound to the twin":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			bc.logger.Error("Failed to start ML backfill", zap.Uint("twin_id", twin.ID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+// GetBackfill returns the status of a backfill job
+// @Summary Get ML backfill status
+// @Description Returns the status and number of sent values of a backfill job of the twin (project owners only)
+// @Tags ml
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param jobId path int true "Backfill job ID"
+// @Success 200 {object} models.MLBackfillJob "Backfill job"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin or job not found"
+// @Router /twins/{id}/ml/backfill/{jobId} [get]
+func (bc *MLBackfillController) GetBackfill(ctx *gin.Context) {
+	twin, ok := bc.authorizeTwin(ctx)
+	if !ok {
+		return
+	}
+
+	jobID, err := strconv.ParseUint(ctx.Param("jobId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := bc.backfillService.GetJob(twin.ID, uint(jobID))
+	if err != nil {
+		if err.Error() == "backfill job not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+// authorizeTwin loads the twin of the request and checks the user owns its project
+func (bc *MLBackfillController) authorizeTwin(ctx *gin.Context) (*models.Twin, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return nil, false
+	}
+
+	twin, err := bc.twinService.GetByID(uint(id))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	// Admins may backfill every project
+	if userRole, _ := ctx.Get("user_role"); userRole == string(models.RoleAdmin) {
+		return twin, true
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	hasAccess, err := bc.projectService.CheckAccess(twin.ProjectID, uid, models.ProjectRoleOwner)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+		return nil, false
+	}
+	if !hasAccess {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+		return nil, false
+	}
+
+	return twin, true
+}
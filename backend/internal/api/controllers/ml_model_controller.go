@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// MLModelController handles ML model registry endpoints
+type MLModelController struct {
+	mlModelService *services.MLModelService
+	logger         *utils.Logger
+}
+
+// NewMLModelController creates a new ML model controller
+func NewMLModelController(mlModelService *services.MLModelService, logger *utils.Logger) *MLModelController {
+	return &MLModelController{
+		mlModelService: mlModelService,
+		logger:         logger.Named("ml_model_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (mc *MLModelController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/ml/models/export", mc.ExportModels)
+	router.POST("/ml/models/import", mc.ImportModels)
+}
+
+// ExportModels exports the ML model registry
+// @Summary Export ML models
+// @Description Returns the metadata of every registered ML model, with its input and output schemas, as a bundle that can be imported into another environment
+// @Tags ml
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} services.MLModelBundle "ML model bundle"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /ml/models/export [get]
+func (mc *MLModelController) ExportModels(c *gin.Context) {
+	bundle, err := mc.mlModelService.Export()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, bundle)
+}
+
+// ImportModels imports an ML model bundle
+// @Summary Import ML models
+// @Description Creates or updates the models of a bundle by model ID. Models need a name, version and known type, and their schemas must be valid JSON Schemas; models listed twice, or whose type would no longer match the ML tasks using them, conflict. The bundle is imported all or nothing (admin only)
+// @Tags ml
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param bundle body services.MLModelBundle true "ML model bundle"
+// @Success 200 {object} services.MLModelImportResult "Created, updated and unchanged models"
+// @Failure 400 {object} map[string]string "Invalid bundle"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} services.MLModelImportResult "Conflicting models, nothing imported"
+// @Failure 422 {object} services.MLModelImportResult "Invalid models, nothing imported"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /ml/models/import [post]
+func (mc *MLModelController) ImportModels(c *gin.Context) {
+	// The registry is shared by every project
+	if userRole, _ := c.Get("user_role"); userRole != string(models.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	var bundle services.MLModelBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bundle: " + err.Error()})
+		return
+	}
+
+	result, err := mc.mlModelService.Import(&bundle)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "unsupported bundle format") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch {
+	case len(result.Errors) > 0:
+		c.JSON(http.StatusUnprocessableEntity, result)
+	case len(result.Conflicts) > 0:
+		c.JSON(http.StatusConflict, result)
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
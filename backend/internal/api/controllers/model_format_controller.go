@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ModelFormatController serves the 3D model formats accepted for twin models
+type ModelFormatController struct {
+	logger *utils.Logger
+}
+
+// NewModelFormatController creates a new model format controller
+func NewModelFormatController(logger *utils.Logger) *ModelFormatController {
+	return &ModelFormatController{
+		logger: logger.Named("model_format_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (mc *ModelFormatController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/model-formats", mc.ListModelFormats)
+}
+
+// ListModelFormats returns the supported 3D model formats
+// @Summary Get supported 3D model formats
+// @Description Returns the 3D model formats accepted for twin model URLs, with their file extensions and MIME types
+// @Tags twins
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string][]models.ModelFormat "Supported model formats"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /model-formats [get]
+func (mc *ModelFormatController) ListModelFormats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{"formats": models.SupportedModelFormats})
+}
@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// NotificationController handles websocket connections for real-time notifications
+type NotificationController struct {
+	notificationService *services.NotificationService
+	upgrader            websocket.Upgrader
+	logger              *utils.Logger
+}
+
+// NewNotificationController creates a new notification controller.
+// checkOrigin decides which browser origins may open a websocket connection.
+func NewNotificationController(
+	notificationService *services.NotificationService,
+	checkOrigin func(r *http.Request) bool,
+	logger *utils.Logger,
+) *NotificationController {
+	return &NotificationController{
+		notificationService: notificationService,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     checkOrigin,
+		},
+		logger: logger.Named("notification_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the notification controller
+func (nc *NotificationController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/ws", nc.Connect)
+}
+
+// RegisterAdminRoutes registers the admin-only notification routes
+func (nc *NotificationController) RegisterAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/websocket/connections", nc.GetConnectionStats)
+}
+
+// Connect upgrades the request to a websocket connection
+// @Summary Open notification websocket
+// @Description Upgrades the connection to a websocket that streams twin updates, alerts and ML predictions. Clients may send {"action":"subscribe_aggregate","twin_id":1,"feature_path":"temperature","interval":"1m"} to receive the aggregate of the current bucket of a twin feature they may view as points are ingested; the reply is a "subscribed" message naming the topic to unsubscribe from, or a "subscription_error".
+// @Tags notifications
+// @Security Bearer
+// @Param project_id query int false "Project ID to receive project notifications for"
+// @Success 101 "Switching protocols"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Origin not allowed"
+// @Router /ws [get]
+func (nc *NotificationController) Connect(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var projectID uint64
+	if value := c.Query("project_id"); value != "" {
+		var err error
+		projectID, err = strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+			return
+		}
+	}
+
+	if !nc.upgrader.CheckOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+		return
+	}
+
+	conn, err := nc.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		nc.logger.Warn("Failed to upgrade websocket connection", zap.Error(err))
+		return
+	}
+
+	// Over a connection limit the service closes the socket with a close frame explaining why
+	userRole, _ := c.Get("user_role")
+	isAdmin := userRole == string(models.RoleAdmin)
+	if _, err := nc.notificationService.RegisterClient(conn, userID.(uint), uint(projectID), isAdmin); err != nil {
+		nc.logger.Info("Websocket connection refused", zap.Uint("user_id", userID.(uint)), zap.Error(err))
+	}
+}
+
+// GetConnectionStats returns the number of open websocket connections in total and per user
+// @Summary Get websocket connection counts
+// @Description Returns the number of open notification websocket connections in total and per user (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Connection counts"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /admin/websocket/connections [get]
+func (nc *NotificationController) GetConnectionStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"total": nc.notificationService.ClientCount(),
+		"users": nc.notificationService.ConnectionCounts(),
+	})
+}
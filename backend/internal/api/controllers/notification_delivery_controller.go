@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationDeliveryController handles notification delivery receipt endpoints
+type NotificationDeliveryController struct {
+	deliveryService *services.DeliveryService
+	projectService  *services.ProjectService
+	logger          *utils.Logger
+}
+
+// NewNotificationDeliveryController creates a new notification delivery controller
+func NewNotificationDeliveryController(
+	deliveryService *services.DeliveryService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *NotificationDeliveryController {
+	return &NotificationDeliveryController{
+		deliveryService: deliveryService,
+		projectService:  projectService,
+		logger:          logger.Named("notification_delivery_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (dc *NotificationDeliveryController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/notifications/:id/deliveries", dc.GetDeliveries)
+}
+
+// GetDeliveries returns the delivery receipts of a notification
+// @Summary Get notification delivery receipts
+// @Description Returns the outcome of a notification's delivery to each recipient of each channel. Pending deliveries are retried with backoff until they succeed or are marked failed.
+// @Tags notifications
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Notification ID"
+// @Success 200 {object} services.NotificationReceipt "Notification and delivery receipts"
+// @Failure 400 {object} map[string]string "Invalid notification ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Notification not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /notifications/{id}/deliveries [get]
+func (dc *NotificationDeliveryController) GetDeliveries(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	receipt, err := dc.deliveryService.Deliveries(uint(id))
+	if err != nil {
+		if err.Error() == "notification not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Admins may read the receipts of every project
+	if userRole, _ := ctx.Get("user_role"); userRole != string(models.RoleAdmin) {
+		userID, _ := ctx.Get("user_id")
+		uid, _ := userID.(uint)
+		hasAccess, err := dc.projectService.CheckAccess(receipt.Notification.ProjectID, uid, models.ProjectRoleViewer)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+			return
+		}
+		if !hasAccess {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, receipt)
+}
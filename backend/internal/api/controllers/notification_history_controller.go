@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationHistoryController handles the notification history endpoint
+type NotificationHistoryController struct {
+	history        *services.NotificationHistory
+	projectService *services.ProjectService
+	logger         *utils.Logger
+}
+
+// NewNotificationHistoryController creates a new notification history controller
+func NewNotificationHistoryController(
+	history *services.NotificationHistory,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *NotificationHistoryController {
+	return &NotificationHistoryController{
+		history:        history,
+		projectService: projectService,
+		logger:         logger.Named("notification_history_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (hc *NotificationHistoryController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/notifications", hc.ListNotifications)
+}
+
+// NotificationHistoryRequest defines the query parameters of the notification history
+type NotificationHistoryRequest struct {
+	ProjectID uint `form:"project_id"`
+	// Comma-separated notification types and severities
+	Type     string    `form:"type"`
+	Severity string    `form:"severity"`
+	Start    time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End      time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	Page     int       `form:"page"`
+	Size     int       `form:"size"`
+}
+
+// ListNotifications returns the notifications sent to the user's projects and to everyone
+// @Summary List past notifications
+// @Description Returns the real-time notifications sent to the user's projects and to every client, newest first, so users can review what they missed while offline
+// @Tags notifications
+// @Produce json
+// @Security Bearer
+// @Param project_id query int false "Only notifications of this project"
+// @Param type query string false "Comma-separated notification types, e.g. alert,ml_prediction"
+// @Param severity query string false "Comma-separated severities"
+// @Param start query string false "Start time (RFC3339)"
+// @Param end query string false "End time (RFC3339)"
+// @Param page query int false "Page number" default(1)
+// @Param size query int false "Page size" default(50)
+// @Success 200 {object} services.NotificationHistoryPage "Notifications"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /notifications [get]
+func (hc *NotificationHistoryController) ListNotifications(ctx *gin.Context) {
+	var req NotificationHistoryRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	query := services.NotificationHistoryQuery{
+		NotificationRecordFilter: repository.NotificationRecordFilter{
+			ProjectID:  req.ProjectID,
+			Types:      splitQueryList(req.Type),
+			Severities: splitQueryList(req.Severity),
+			Start:      req.Start,
+			End:        req.End,
+		},
+		Page:     req.Page,
+		PageSize: req.Size,
+	}
+
+	// Admins see the notifications of every project
+	if userRole, _ := ctx.Get("user_role"); userRole != string(models.RoleAdmin) {
+		query.UserID = uid
+		if req.ProjectID != 0 {
+			hasAccess, err := hc.projectService.CheckAccess(req.ProjectID, uid, models.ProjectRoleViewer)
+			if err != nil {
+				ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+				return
+			}
+			if !hasAccess {
+				ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+				return
+			}
+		}
+	}
+
+	page, err := hc.history.List(query)
+	if err != nil {
+		if err.Error() == "database error" {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+// splitQueryList splits a comma-separated query parameter, dropping empty items
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,13 +16,14 @@ import (
 
 // ProjectResponse represents a project in responses
 type ProjectResponse struct {
-	ID          uint                    `json:"id"`
-	Name        string                  `json:"name"`
-	Description string                  `json:"description"`
-	CreatedBy   uint                    `json:"created_by"`
-	CreatedAt   string                  `json:"created_at"`
-	UpdatedAt   string                  `json:"updated_at"`
-	Members     []ProjectMemberResponse `json:"members,omitempty"`
+	ID              uint                    `json:"id"`
+	Name            string                  `json:"name"`
+	Description     string                  `json:"description"`
+	TimestampPolicy string                  `json:"timestamp_policy,omitempty"`
+	CreatedBy       uint                    `json:"created_by"`
+	CreatedAt       string                  `json:"created_at"`
+	UpdatedAt       string                  `json:"updated_at"`
+	Members         []ProjectMemberResponse `json:"members,omitempty"`
 }
 
 // ProjectMemberResponse represents a project member in responses
@@ -39,12 +41,16 @@ type ProjectMemberResponse struct {
 type CreateProjectRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	// TimestampPolicy overrides the server's policy for points timestamped too far in the future or the past
+	TimestampPolicy string `json:"timestamp_policy" binding:"omitempty,oneof=accept reject clamp"`
 }
 
 // UpdateProjectRequest represents the request to update a project
 type UpdateProjectRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// TimestampPolicy replaces the project's timestamp policy if set
+	TimestampPolicy string `json:"timestamp_policy" binding:"omitempty,oneof=accept reject clamp"`
 }
 
 // AddMemberRequest represents the request to add a member to a project
@@ -92,6 +98,7 @@ func (pc *ProjectController) RegisterRoutes(router *gin.RouterGroup) {
 
 			// Editor access required
 			project.PUT("", projectAuth.RequireProjectEditor(), pc.UpdateProject)
+			project.PUT("/ml-pause", projectAuth.RequireProjectEditor(), pc.SetMLPause)
 
 			// Owner access required
 			project.DELETE("", projectAuth.RequireProjectOwner(), pc.DeleteProject)
@@ -160,12 +167,13 @@ func (pc *ProjectController) ListProjects(c *gin.Context) {
 	response := make([]ProjectResponse, len(projects))
 	for i, project := range projects {
 		response[i] = ProjectResponse{
-			ID:          project.ID,
-			Name:        project.Name,
-			Description: project.Description,
-			CreatedBy:   project.CreatedBy,
-			CreatedAt:   project.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:   project.UpdatedAt.Format(time.RFC3339),
+			ID:              project.ID,
+			Name:            project.Name,
+			Description:     project.Description,
+			TimestampPolicy: project.TimestampPolicy,
+			CreatedBy:       project.CreatedBy,
+			CreatedAt:       project.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:       project.UpdatedAt.Format(time.RFC3339),
 		}
 	}
 
@@ -189,7 +197,9 @@ func (pc *ProjectController) ListProjects(c *gin.Context) {
 // @Param project body CreateProjectRequest true "Project information"
 // @Success 201 {object} ProjectResponse "Created project"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Project name already exists"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /projects [post]
 func (pc *ProjectController) CreateProject(c *gin.Context) {
@@ -202,31 +212,37 @@ func (pc *ProjectController) CreateProject(c *gin.Context) {
 
 	var req CreateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
 	// Create new project
 	project := &models.Project{
-		Name:        req.Name,
-		Description: req.Description,
-		CreatedBy:   userID.(uint),
+		Name:            req.Name,
+		Description:     req.Description,
+		TimestampPolicy: req.TimestampPolicy,
+		CreatedBy:       userID.(uint),
 	}
 
 	// Save project to database
 	if err := pc.projectService.Create(project); err != nil {
+		if err.Error() == "project with this name already exists" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		pc.logger.Error("Failed to create project", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
 		return
 	}
 
 	c.JSON(http.StatusCreated, ProjectResponse{
-		ID:          project.ID,
-		Name:        project.Name,
-		Description: project.Description,
-		CreatedBy:   project.CreatedBy,
-		CreatedAt:   project.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   project.UpdatedAt.Format(time.RFC3339),
+		ID:              project.ID,
+		Name:            project.Name,
+		Description:     project.Description,
+		TimestampPolicy: project.TimestampPolicy,
+		CreatedBy:       project.CreatedBy,
+		CreatedAt:       project.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       project.UpdatedAt.Format(time.RFC3339),
 	})
 }
 
@@ -313,13 +329,14 @@ func (pc *ProjectController) GetProject(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, ProjectResponse{
-		ID:          project.ID,
-		Name:        project.Name,
-		Description: project.Description,
-		CreatedBy:   project.CreatedBy,
-		CreatedAt:   project.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   project.UpdatedAt.Format(time.RFC3339),
-		Members:     memberResponses,
+		ID:              project.ID,
+		Name:            project.Name,
+		Description:     project.Description,
+		TimestampPolicy: project.TimestampPolicy,
+		CreatedBy:       project.CreatedBy,
+		CreatedAt:       project.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       project.UpdatedAt.Format(time.RFC3339),
+		Members:         memberResponses,
 	})
 }
 
@@ -334,9 +351,11 @@ func (pc *ProjectController) GetProject(c *gin.Context) {
 // @Param project body UpdateProjectRequest true "Project information"
 // @Success 200 {object} ProjectResponse "Updated project"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Forbidden"
 // @Failure 404 {object} map[string]string "Project not found"
+// @Failure 409 {object} map[string]string "Project name already exists"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /projects/{id} [put]
 func (pc *ProjectController) UpdateProject(c *gin.Context) {
@@ -356,7 +375,7 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 
 	var req UpdateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -395,24 +414,79 @@ func (pc *ProjectController) UpdateProject(c *gin.Context) {
 		project.Name = req.Name
 	}
 	project.Description = req.Description
+	if req.TimestampPolicy != "" {
+		project.TimestampPolicy = req.TimestampPolicy
+	}
 
 	// Save project to database
 	if err := pc.projectService.Update(project); err != nil {
+		if err.Error() == "project with this name already exists" {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		pc.logger.Error("Failed to update project", zap.Uint("project_id", uint(id)), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
 		return
 	}
 
 	c.JSON(http.StatusOK, ProjectResponse{
-		ID:          project.ID,
-		Name:        project.Name,
-		Description: project.Description,
-		CreatedBy:   project.CreatedBy,
-		CreatedAt:   project.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   project.UpdatedAt.Format(time.RFC3339),
+		ID:              project.ID,
+		Name:            project.Name,
+		Description:     project.Description,
+		TimestampPolicy: project.TimestampPolicy,
+		CreatedBy:       project.CreatedBy,
+		CreatedAt:       project.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       project.UpdatedAt.Format(time.RFC3339),
 	})
 }
 
+// SetMLPause pauses or resumes forwarding the values of a project's twins to ML
+// @Summary Pause ML forwarding
+// @Description Pauses or resumes forwarding the values of all twins in a project to ML, optionally until a given time. Values keep being stored while paused.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param pause body MLPauseRequest true "Pause state"
+// @Success 200 {object} MLPauseResponse "Pause state"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Project not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /projects/{id}/ml-pause [put]
+func (pc *ProjectController) SetMLPause(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req MLPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	project, err := pc.projectService.SetMLPause(uint(id), *req.Paused, req.Until)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMLPause):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err.Error() == "project not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		default:
+			pc.logger.Error("Failed to set ML pause", zap.Uint("project_id", uint(id)), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set ML pause"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, MLPauseResponse{Paused: project.MLPaused, Until: project.MLPausedUntil})
+}
+
 // DeleteProject deletes a project by ID
 // @Summary Delete project
 // @Description Deletes a project by ID if the user is the owner or an admin
@@ -575,6 +649,7 @@ func (pc *ProjectController) ListMembers(c *gin.Context) {
 // @Param member body AddMemberRequest true "Member information"
 // @Success 201 {object} ProjectMemberResponse "Added member"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Forbidden"
 // @Failure 404 {object} map[string]string "Project not found"
@@ -598,7 +673,7 @@ func (pc *ProjectController) AddMember(c *gin.Context) {
 
 	var req AddMemberRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -669,6 +744,7 @@ func (pc *ProjectController) AddMember(c *gin.Context) {
 // @Param member body UpdateMemberRequest true "Member information"
 // @Success 200 {object} ProjectMemberResponse "Updated member"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Forbidden"
 // @Failure 404 {object} map[string]string "Project or member not found"
@@ -697,7 +773,7 @@ func (pc *ProjectController) UpdateMember(c *gin.Context) {
 
 	var req UpdateMemberRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
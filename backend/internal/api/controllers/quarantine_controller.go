@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultQuarantineLimit = 100
+	maxQuarantineLimit     = 1000
+)
+
+// QuarantineRequest defines the query parameters for reviewing quarantined points
+type QuarantineRequest struct {
+	FeaturePath string    `form:"feature_path"`
+	Start       time.Time `form:"start" time_format:"2006-01-02T15:04:05Z07:00"`
+	End         time.Time `form:"end" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit       int       `form:"limit" binding:"omitempty,min=1"`
+	Offset      int       `form:"offset" binding:"omitempty,min=0"`
+}
+
+// QuarantineController handles reviewing the values quarantined during ingestion
+type QuarantineController struct {
+	quarantineService *services.QuarantineService
+	twinService       *services.TwinService
+	projectService    *services.ProjectService
+	logger            *utils.Logger
+}
+
+// NewQuarantineController creates a new quarantine controller
+func NewQuarantineController(
+	quarantineService *services.QuarantineService,
+	twinService *services.TwinService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *QuarantineController {
+	return &QuarantineController{
+		quarantineService: quarantineService,
+		twinService:       twinService,
+		projectService:    projectService,
+		logger:            logger.Named("quarantine_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the twins router group
+func (qc *QuarantineController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:id/quarantine", qc.ListQuarantine)
+	router.POST("/:id/quarantine/:pointId/release", qc.ReleasePoint)
+	router.DELETE("/:id/quarantine/:pointId", qc.DiscardPoint)
+}
+
+// ListQuarantine returns the values of a twin quarantined as implausible
+// @Summary List quarantined values
+// @Description Returns a page of the twin's values that were outside the plausible range of their feature binding, newest first, with the number quarantined per feature
+// @Tags twins
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param feature_path query string false "Only values of this feature"
+// @Param start query string false "Start time (RFC3339)"
+// @Param end query string false "End time (RFC3339)"
+// @Param limit query int false "Maximum number of values (default 100, max 1000)"
+// @Param offset query int false "Number of values to skip"
+// @Success 200 {object} services.QuarantineReview "Quarantined values"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin not found"
+// @Router /twins/{id}/quarantine [get]
+func (qc *QuarantineController) ListQuarantine(ctx *gin.Context) {
+	twin, ok := qc.authorizeTwin(ctx, models.ProjectRoleViewer)
+	if !ok {
+		return
+	}
+
+	var req QuarantineRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultQuarantineLimit
+	}
+	if req.Limit > maxQuarantineLimit {
+		req.Limit = maxQuarantineLimit
+	}
+
+	review, err := qc.quarantineService.List(ctx.Request.Context(), twin, repository.QuarantineFilter{
+		FeaturePath: req.FeaturePath,
+		Start:       req.Start,
+		End:         req.End,
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, review)
+}
+
+// ReleasePoint stores a quarantined value in the twin's time series
+// @Summary Release a quarantined value
+// @Description Stores a quarantined value in the twin's time series, rounded to the feature's precision, and removes it from quarantine (project editors only)
+// @Tags twins
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param pointId path int true "Quarantined value ID"
+// @Success 200 {object} models.TimeseriesData "Stored value"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin or quarantined value not found"
+// @Router /twins/{id}/quarantine/{pointId}/release [post]
+func (qc *QuarantineController) ReleasePoint(ctx *gin.Context) {
+	twin, ok := qc.authorizeTwin(ctx, models.ProjectRoleEditor)
+	if !ok {
+		return
+	}
+	pointID, ok := qc.pointID(ctx)
+	if !ok {
+		return
+	}
+
+	point, err := qc.quarantineService.Release(twin, pointID)
+	if err != nil {
+		if errors.Is(err, services.ErrQuarantinedPointNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, point)
+}
+
+// DiscardPoint deletes a quarantined value
+// @Summary Discard a quarantined value
+// @Description Deletes a quarantined value without storing it (project editors only)
+// @Tags twins
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param pointId path int true "Quarantined value ID"
+// @Success 204 "Value discarded"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin or quarantined value not found"
+// @Router /twins/{id}/quarantine/{pointId} [delete]
+func (qc *QuarantineController) DiscardPoint(ctx *gin.Context) {
+	twin, ok := qc.authorizeTwin(ctx, models.ProjectRoleEditor)
+	if !ok {
+		return
+	}
+	pointID, ok := qc.pointID(ctx)
+	if !ok {
+		return
+	}
+
+	if err := qc.quarantineService.Discard(twin, pointID); err != nil {
+		if errors.Is(err, services.ErrQuarantinedPointNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// pointID parses the quarantined point ID of the request
+func (qc *QuarantineController) pointID(ctx *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(ctx.Param("pointId"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarantined value ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// authorizeTwin loads the twin of the request and checks the user has the role in its project
+func (qc *QuarantineController) authorizeTwin(ctx *gin.Context, role models.ProjectRole) (*models.Twin, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return nil, false
+	}
+
+	twin, err := qc.twinService.GetByID(uint(id))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	// Admins may review every project
+	if userRole, _ := ctx.Get("user_role"); userRole == string(models.RoleAdmin) {
+		return twin, true
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	hasAccess, err := qc.projectService.CheckAccess(twin.ProjectID, uid, role)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+		return nil, false
+	}
+	if !hasAccess {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+		return nil, false
+	}
+
+	return twin, true
+}
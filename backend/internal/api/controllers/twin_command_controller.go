@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// FeatureConditionRequest requires a feature property to currently hold a value
+type FeatureConditionRequest struct {
+	Feature  string          `json:"feature" binding:"required"`
+	Property string          `json:"property" binding:"required"`
+	Value    json.RawMessage `json:"value" binding:"required"`
+}
+
+// SetFeaturePropertyRequest represents a feature property written to a twin's thing, optionally
+// only if the twin is in a given state
+type SetFeaturePropertyRequest struct {
+	Value     json.RawMessage          `json:"value" binding:"required"`
+	Condition *FeatureConditionRequest `json:"condition"`
+}
+
+// TwinCommandController handles writing feature state of twins to Ditto
+type TwinCommandController struct {
+	twinCommands   *services.TwinCommandService
+	twinService    *services.TwinService
+	projectService *services.ProjectService
+	logger         *utils.Logger
+}
+
+// NewTwinCommandController creates a new twin command controller
+func NewTwinCommandController(
+	twinCommands *services.TwinCommandService,
+	twinService *services.TwinService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *TwinCommandController {
+	return &TwinCommandController{
+		twinCommands:   twinCommands,
+		twinService:    twinService,
+		projectService: projectService,
+		logger:         logger.Named("twin_command_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the twins router group
+func (tc *TwinCommandController) RegisterRoutes(router *gin.RouterGroup) {
+	router.PUT("/:id/features/:featureId/properties/*property", tc.SetFeatureProperty)
+}
+
+// SetFeatureProperty writes a feature property of a twin to Ditto
+// @Summary Set a feature property
+// @Description Creates or replaces a feature property of the twin's Ditto thing (project editors only). With a condition the change is only applied if the condition's feature property currently equals its value, checked by Ditto when applying the change; otherwise 409 is returned and the thing is left unchanged.
+// @Tags twins
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin ID"
+// @Param featureId path string true "Feature ID"
+// @Param property path string true "Property path, e.g. state or status/mode"
+// @Param request body SetFeaturePropertyRequest true "Property value and optional condition"
+// @Success 204 "Property set"
+// @Failure 400 {object} map[string]string "Invalid request or condition"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Twin or thing not found"
+// @Failure 409 {object} map[string]string "Twin is not in the required state"
+// @Failure 503 {object} map[string]string "Ditto unavailable"
+// @Router /twins/{id}/features/{featureId}/properties/{property} [put]
+func (tc *TwinCommandController) SetFeatureProperty(ctx *gin.Context) {
+	if tc.twinCommands == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ditto is not initialized"})
+		return
+	}
+
+	twin, ok := tc.authorizeTwin(ctx)
+	if !ok {
+		return
+	}
+
+	property := strings.Trim(ctx.Param("property"), "/")
+	if property == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Property path is required"})
+		return
+	}
+
+	var req SetFeaturePropertyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	var condition *services.FeatureCondition
+	if req.Condition != nil {
+		condition = &services.FeatureCondition{
+			Feature:  req.Condition.Feature,
+			Property: req.Condition.Property,
+			Value:    req.Condition.Value,
+		}
+	}
+
+	err := tc.twinCommands.SetFeatureProperty(ctx.Request.Context(), twin, ctx.Param("featureId"), property, req.Value, condition)
+	if err != nil {
+		var dittoErr *ditto.DittoError
+		switch {
+		case errors.Is(err, services.ErrConditionFailed):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "invalid condition"):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case ditto.IsUnavailableError(err):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "Ditto is unavailable"})
+		case errors.As(err, &dittoErr) && dittoErr.Status == http.StatusNotFound:
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "Thing not found in Ditto"})
+		case errors.As(err, &dittoErr) && dittoErr.Status < http.StatusInternalServerError:
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": dittoErr.Message})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update feature property"})
+		}
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
+
+// authorizeTwin loads the twin of the request and checks the user may edit its project
+func (tc *TwinCommandController) authorizeTwin(ctx *gin.Context) (*models.Twin, bool) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 32)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return nil, false
+	}
+
+	twin, err := tc.twinService.GetByID(uint(id))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return nil, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if userRole, _ := ctx.Get("user_role"); userRole == string(models.RoleAdmin) {
+		return twin, true
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	hasAccess, err := tc.projectService.CheckAccess(twin.ProjectID, uid, models.ProjectRoleEditor)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+		return nil, false
+	}
+	if !hasAccess {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions for this project"})
+		return nil, false
+	}
+
+	return twin, true
+}
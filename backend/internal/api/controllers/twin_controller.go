@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/services"
@@ -27,30 +31,113 @@ func NewTwinController(twinService *services.TwinService, logger *utils.Logger)
 	}
 }
 
+// TwinResponse is the wire format of a twin
+type TwinResponse struct {
+	ID          uint            `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	DittoID     string          `json:"ditto_id"`
+	TypeID      uint            `json:"type_id"`
+	ProjectID   uint            `json:"project_id"`
+	ModelURL    string          `json:"model_url,omitempty"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	Tags        []string        `json:"tags"`
+	// Features returned by the twin state by default; empty uses those of the twin type
+	PrimaryFeatures []string `json:"primary_features"`
+	// Days the twin's data is kept; omitted uses the retention of the twin type
+	RawRetentionDays        *int             `json:"raw_retention_days,omitempty"`
+	AggregatedRetentionDays *int             `json:"aggregated_retention_days,omitempty"`
+	CreatedBy               uint             `json:"created_by"`
+	CreatedAt               time.Time        `json:"created_at"`
+	UpdatedAt               time.Time        `json:"updated_at"`
+	Type                    *TwinTypeSummary `json:"type,omitempty"`
+}
+
+// TwinTypeSummary is the twin type embedded in a twin response
+type TwinTypeSummary struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// newTwinResponse maps a twin to its wire format; the type is included when it was loaded
+func newTwinResponse(twin *models.Twin) TwinResponse {
+	response := TwinResponse{
+		ID:                      twin.ID,
+		Name:                    twin.Name,
+		Description:             twin.Description,
+		DittoID:                 twin.DittoID,
+		TypeID:                  twin.TypeID,
+		ProjectID:               twin.ProjectID,
+		ModelURL:                twin.ModelURL,
+		Metadata:                json.RawMessage(twin.Metadata),
+		Tags:                    []string(twin.Tags),
+		PrimaryFeatures:         []string(twin.PrimaryFeatures),
+		RawRetentionDays:        twin.RawRetentionDays,
+		AggregatedRetentionDays: twin.AggregatedRetentionDays,
+		CreatedBy:               twin.CreatedBy,
+		CreatedAt:               twin.CreatedAt,
+		UpdatedAt:               twin.UpdatedAt,
+	}
+	if response.Tags == nil {
+		response.Tags = []string{}
+	}
+	if response.PrimaryFeatures == nil {
+		response.PrimaryFeatures = []string{}
+	}
+	if twin.Type.ID != 0 {
+		response.Type = &TwinTypeSummary{ID: twin.Type.ID, Name: twin.Type.Name, Version: twin.Type.Version}
+	}
+	return response
+}
+
 // RegisterRoutes registers the twin routes
 func (c *TwinController) RegisterRoutes(router *gin.RouterGroup) {
 	router.POST("", c.CreateTwin)
 	router.GET("", c.ListTwins)
+	router.POST("/status", c.GetTwinStatus)
 	router.GET("/:id", c.GetTwin)
 	router.PUT("/:id", c.UpdateTwin)
 	router.DELETE("/:id", c.DeleteTwin)
+	router.GET("/:id/access", c.GetTwinAccess)
+
+	// Tag routes
+	router.GET("/tags", c.ListProjectTags)
+	router.POST("/:id/tags", c.AddTags)
+	router.DELETE("/:id/tags/:tag", c.RemoveTag)
+
+	// Pausing ML forwarding
+	router.PUT("/:id/ml-pause", c.SetMLPause)
 
 	// Model bindings routes
 	router.POST("/:id/bindings", c.CreateModelBinding)
 	router.GET("/:id/bindings", c.ListModelBindings)
 	router.PUT("/bindings/:bindingId", c.UpdateModelBinding)
 	router.DELETE("/bindings/:bindingId", c.DeleteModelBinding)
+
+	// Feature ingestion bindings routes
+	router.PUT("/:id/feature-bindings", c.SaveFeatureBinding)
+	router.GET("/:id/feature-bindings", c.ListFeatureBindings)
+	router.DELETE("/feature-bindings/:bindingId", c.DeleteFeatureBinding)
 }
 
 // CreateTwinRequest defines the request body for creating a twin
 type CreateTwinRequest struct {
 	Name      string `json:"name" binding:"required"`
-	DittoID   string `json:"dittoId" binding:"required"`
-	TypeID    uint   `json:"typeId" binding:"required"`
-	ProjectID uint   `json:"projectId" binding:"required"`
+	TypeID    uint   `json:"type_id" binding:"required"`
+	ProjectID uint   `json:"project_id" binding:"required"`
+	// Either a full Ditto ID in the project's namespace or a local name to build it from
+	DittoID   string `json:"ditto_id" binding:"required_without=LocalName"`
+	LocalName string `json:"local_name" binding:"required_without=DittoID"`
 	// Optional fields
 	Description string `json:"description"`
-	ModelURL    string `json:"modelUrl"`
+	ModelURL    string `json:"model_url"`
+	// Features returned by the twin state by default, overriding those of the twin type
+	PrimaryFeatures []string `json:"primary_features"`
+	// Days the twin's raw and aggregated data is kept, overriding the retention of the twin
+	// type; 0 keeps the data forever
+	RawRetentionDays        *int `json:"raw_retention_days"`
+	AggregatedRetentionDays *int `json:"aggregated_retention_days"`
 }
 
 // CreateTwin handles creating a new twin
@@ -58,7 +145,7 @@ func (c *TwinController) CreateTwin(ctx *gin.Context) {
 	// Parse the request body
 	var req CreateTwinRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		utils.HandleValidationErrors(ctx, err)
 		return
 	}
 
@@ -69,24 +156,42 @@ func (c *TwinController) CreateTwin(ctx *gin.Context) {
 		return
 	}
 
+	// Build the Ditto ID from the project namespace when only a local name is given
+	dittoID := req.DittoID
+	if dittoID == "" {
+		var err error
+		dittoID, err = c.twinService.BuildDittoID(req.ProjectID, req.LocalName)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Create twin object
 	twin := &models.Twin{
-		Name:        req.Name,
-		DittoID:     req.DittoID,
-		TypeID:      req.TypeID,
-		ProjectID:   req.ProjectID,
-		Description: req.Description,
-		ModelURL:    req.ModelURL,
-		CreatedBy:   userID.(uint),
+		Name:                    req.Name,
+		DittoID:                 dittoID,
+		TypeID:                  req.TypeID,
+		ProjectID:               req.ProjectID,
+		Description:             req.Description,
+		ModelURL:                req.ModelURL,
+		PrimaryFeatures:         req.PrimaryFeatures,
+		RawRetentionDays:        req.RawRetentionDays,
+		AggregatedRetentionDays: req.AggregatedRetentionDays,
+		CreatedBy:               userID.(uint),
 	}
 
 	// Create the twin
 	if err := c.twinService.Create(twin); err != nil {
+		if err.Error() == "twin with this name already exists in the project" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, twin)
+	ctx.JSON(http.StatusCreated, newTwinResponse(twin))
 }
 
 // GetTwin handles getting a twin by ID
@@ -105,21 +210,29 @@ func (c *TwinController) GetTwin(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, twin)
+	// Return only the requested fields, if any
+	response, err := utils.ProjectFields(newTwinResponse(twin), utils.ParseFields(ctx.Query("fields")))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build response"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, response)
 }
 
 // ListTwinsResponse defines the response for listing twins
 type ListTwinsResponse struct {
-	Twins []models.Twin `json:"twins"`
-	Total int64         `json:"total"`
-	Page  int           `json:"page"`
-	Size  int           `json:"size"`
+	Twins []TwinResponse `json:"twins"`
+	Total int64          `json:"total"`
+	Page  int            `json:"page"`
+	Size  int            `json:"size"`
 }
 
-// ListTwins handles listing twins for a project
+// ListTwins handles listing twins for a project.
+// Repeated tag parameters (?tag=line:A&tag=zone:north) return only twins carrying all of them.
 func (c *TwinController) ListTwins(ctx *gin.Context) {
 	// Parse query parameters
-	projectID, err := strconv.ParseUint(ctx.Query("projectId"), 10, 64)
+	projectID, err := strconv.ParseUint(ctx.Query("project_id"), 10, 64)
 	if err != nil || projectID == 0 {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing project ID"})
 		return
@@ -136,7 +249,7 @@ func (c *TwinController) ListTwins(ctx *gin.Context) {
 	}
 
 	// Get twins
-	twins, total, err := c.twinService.ListByProject(uint(projectID), page, size)
+	twins, total, err := c.twinService.ListByProject(uint(projectID), page, size, ctx.QueryArray("tag")...)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -144,21 +257,250 @@ func (c *TwinController) ListTwins(ctx *gin.Context) {
 
 	// Prepare response
 	response := ListTwinsResponse{
-		Twins: twins,
+		Twins: make([]TwinResponse, len(twins)),
 		Total: total,
 		Page:  page,
 		Size:  size,
 	}
+	for i := range twins {
+		response.Twins[i] = newTwinResponse(&twins[i])
+	}
 
 	ctx.JSON(http.StatusOK, response)
 }
 
+// TwinStatusRequest defines the request body for a batch twin status query:
+// either the twins to report on or a project whose twins are all reported
+type TwinStatusRequest struct {
+	TwinIDs   []uint `json:"twin_ids" binding:"required_without=ProjectID"`
+	ProjectID uint   `json:"project_id" binding:"required_without=TwinIDs"`
+}
+
+// TwinStatusResponse defines the response body of a batch twin status query
+type TwinStatusResponse struct {
+	Twins []services.TwinStatus `json:"twins"`
+	// Missing lists requested twin IDs that don't exist or are not accessible
+	Missing []uint `json:"missing"`
+}
+
+// GetTwinStatus handles reporting the last-seen time and active alerts of many twins at once
+func (c *TwinController) GetTwinStatus(ctx *gin.Context) {
+	var req TwinStatusRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+	if req.ProjectID != 0 && len(req.TwinIDs) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Specify either twin IDs or a project ID, not both"})
+		return
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	userRole, _ := ctx.Get("user_role")
+
+	report, err := c.twinService.Status(ctx.Request.Context(), services.TwinStatusQuery{
+		TwinIDs:   req.TwinIDs,
+		ProjectID: req.ProjectID,
+		UserID:    uid,
+		IsAdmin:   userRole == string(models.RoleAdmin),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTooManyStatusTwins):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrStatusAccessDenied):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case err.Error() == "project not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, TwinStatusResponse{Twins: report.Statuses, Missing: report.Missing})
+}
+
+// GetTwinAccess handles listing the users who can access a twin, for its project owners and admins
+func (c *TwinController) GetTwinAccess(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	twin, err := c.twinService.GetByID(uint(id))
+	if err != nil {
+		if err.Error() == "twin not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	userRole, _ := ctx.Get("user_role")
+	allowed, err := c.twinService.CanManageAccess(twin, uid, userRole == string(models.RoleAdmin))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check project access"})
+		return
+	}
+	if !allowed {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "Only project owners and admins can view twin access"})
+		return
+	}
+
+	access, err := c.twinService.ListAccess(twin.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"twin_id":    twin.ID,
+		"project_id": twin.ProjectID,
+		"users":      access,
+	})
+}
+
+// TwinTagsRequest defines the request body for adding tags to a twin
+type TwinTagsRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1"`
+}
+
+// AddTags handles adding tags to a twin
+func (c *TwinController) AddTags(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req TwinTagsRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	tags, err := c.twinService.AddTags(uint(id), req.Tags)
+	if err != nil {
+		c.respondTagError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// RemoveTag handles removing a tag from a twin
+func (c *TwinController) RemoveTag(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	tags, err := c.twinService.RemoveTags(uint(id), []string{ctx.Param("tag")})
+	if err != nil {
+		c.respondTagError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// MLPauseRequest defines the request body for pausing or resuming ML forwarding
+type MLPauseRequest struct {
+	Paused *bool `json:"paused" binding:"required"`
+	// Optional end of the pause, after which values are forwarded again
+	Until *time.Time `json:"until"`
+}
+
+// MLPauseResponse describes the ML pause set on a twin or project
+type MLPauseResponse struct {
+	Paused bool       `json:"ml_paused"`
+	Until  *time.Time `json:"ml_paused_until,omitempty"`
+}
+
+// SetMLPause handles pausing or resuming forwarding a twin's values to ML
+func (c *TwinController) SetMLPause(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	var req MLPauseRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	twin, err := c.twinService.SetMLPause(uint(id), *req.Paused, req.Until)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMLPause):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, MLPauseResponse{Paused: twin.MLPaused, Until: twin.MLPausedUntil})
+}
+
+// ListProjectTags handles listing all twin tags used in a project
+func (c *TwinController) ListProjectTags(ctx *gin.Context) {
+	projectID, err := strconv.ParseUint(ctx.Query("project_id"), 10, 64)
+	if err != nil || projectID == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing project ID"})
+		return
+	}
+
+	tags, err := c.twinService.ListProjectTags(uint(projectID))
+	if err != nil {
+		if err.Error() == "project not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// respondTagError maps tag service errors to HTTP responses
+func (c *TwinController) respondTagError(ctx *gin.Context, err error) {
+	switch {
+	case err.Error() == "twin not found":
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case strings.HasPrefix(err.Error(), "invalid tag"):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
 // UpdateTwinRequest defines the request body for updating a twin
 type UpdateTwinRequest struct {
 	Name        string `json:"name" binding:"required"`
-	DittoID     string `json:"dittoId" binding:"required"`
+	DittoID     string `json:"ditto_id" binding:"required"`
 	Description string `json:"description"`
-	ModelURL    string `json:"modelUrl"`
+	ModelURL    string `json:"model_url"`
+	// Primary features replace the current ones when given; an empty list falls back to the type's
+	PrimaryFeatures []string `json:"primary_features"`
+	// Retention overriding that of the twin type; omitted keeps the current override
+	RawRetentionDays        *int `json:"raw_retention_days"`
+	AggregatedRetentionDays *int `json:"aggregated_retention_days"`
+	// ClearRetention removes both overrides before the ones given are applied, so the twin
+	// falls back to the retention of its type
+	ClearRetention bool `json:"clear_retention"`
 }
 
 // UpdateTwin handles updating a twin
@@ -173,7 +515,7 @@ func (c *TwinController) UpdateTwin(ctx *gin.Context) {
 	// Parse the request body
 	var req UpdateTwinRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		utils.HandleValidationErrors(ctx, err)
 		return
 	}
 
@@ -189,14 +531,31 @@ func (c *TwinController) UpdateTwin(ctx *gin.Context) {
 	existingTwin.DittoID = req.DittoID
 	existingTwin.Description = req.Description
 	existingTwin.ModelURL = req.ModelURL
+	if req.PrimaryFeatures != nil {
+		existingTwin.PrimaryFeatures = req.PrimaryFeatures
+	}
+	if req.ClearRetention {
+		existingTwin.RawRetentionDays = nil
+		existingTwin.AggregatedRetentionDays = nil
+	}
+	if req.RawRetentionDays != nil {
+		existingTwin.RawRetentionDays = req.RawRetentionDays
+	}
+	if req.AggregatedRetentionDays != nil {
+		existingTwin.AggregatedRetentionDays = req.AggregatedRetentionDays
+	}
 
 	// Update twin
 	if err := c.twinService.Update(existingTwin); err != nil {
+		if err.Error() == "twin with this name already exists in the project" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, existingTwin)
+	ctx.JSON(http.StatusOK, newTwinResponse(existingTwin))
 }
 
 // DeleteTwin handles deleting a twin
@@ -219,9 +578,9 @@ func (c *TwinController) DeleteTwin(ctx *gin.Context) {
 
 // ModelBindingRequest defines the request body for creating/updating a model binding
 type ModelBindingRequest struct {
-	PartID      string `json:"partId" binding:"required"`
-	FeaturePath string `json:"featurePath" binding:"required"`
-	BindingType string `json:"bindingType" binding:"required"`
+	PartID      string `json:"part_id" binding:"required"`
+	FeaturePath string `json:"feature_path" binding:"required"`
+	BindingType string `json:"binding_type" binding:"required"`
 	Properties  string `json:"properties"` // JSON-encoded properties
 }
 
@@ -237,7 +596,7 @@ func (c *TwinController) CreateModelBinding(ctx *gin.Context) {
 	// Parse the request body
 	var req ModelBindingRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		utils.HandleValidationErrors(ctx, err)
 		return
 	}
 
@@ -298,7 +657,7 @@ func (c *TwinController) UpdateModelBinding(ctx *gin.Context) {
 	// Parse the request body
 	var req ModelBindingRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		utils.HandleValidationErrors(ctx, err)
 		return
 	}
 
@@ -345,3 +704,131 @@ func (c *TwinController) DeleteModelBinding(ctx *gin.Context) {
 
 	ctx.Status(http.StatusNoContent)
 }
+
+// FeatureBindingRequest defines the request body for configuring feature ingestion
+type FeatureBindingRequest struct {
+	FeaturePath     string `json:"feature_path" binding:"required"`
+	ArrayMode       string `json:"array_mode" binding:"omitempty,oneof=expand object"`
+	ArrayTimeField  string `json:"array_time_field"`
+	ArrayValueField string `json:"array_value_field"`
+	// Expected value type; off-type values are coerced when possible, otherwise handled per typeViolationMode
+	ExpectedType            string `json:"expected_type" binding:"omitempty,oneof=number boolean string object"`
+	TypeViolationMode       string `json:"type_violation_mode" binding:"omitempty,oneof=reject drop null error"`
+	ViolationAlertThreshold int    `json:"violation_alert_threshold" binding:"omitempty,min=1"`
+	// Decimal places numeric values are rounded to; omitted stores values as received
+	Precision    *int `json:"precision" binding:"omitempty,min=0,max=15"`
+	KeepRawValue bool `json:"keep_raw_value"`
+	// Seconds of numeric samples stored as one rolled-up point; omitted stores every sample
+	RollupWindow   int  `json:"rollup_window" binding:"omitempty,min=1,max=3600"`
+	RollupKeepLast bool `json:"rollup_keep_last"`
+	// Unit numeric values are sent in, e.g. "C" or "bar"; omitted stores unitless values
+	Unit string `json:"unit"`
+	// Corrections of numeric values, each in effect from its time until the next one
+	Calibrations []CalibrationRequest `json:"calibrations" binding:"omitempty,dive"`
+	// When calibrations are applied: on read (query, the default) or before storing (ingest)
+	CalibrationMode string `json:"calibration_mode" binding:"omitempty,oneof=query ingest"`
+	// Plausible range of numeric values; values outside it are quarantined for review instead of stored
+	PlausibleMin *float64 `json:"plausible_min"`
+	PlausibleMax *float64 `json:"plausible_max"`
+}
+
+// CalibrationRequest defines a calibration period of a feature binding
+type CalibrationRequest struct {
+	EffectiveFrom time.Time `json:"effective_from" binding:"required"`
+	Offset        float64   `json:"offset"`
+	// Omitted keeps the scale, i.e. 1
+	Multiplier *float64 `json:"multiplier"`
+}
+
+// SaveFeatureBinding handles creating or replacing a feature binding
+func (c *TwinController) SaveFeatureBinding(ctx *gin.Context) {
+	// Get twin ID from URL
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	// Parse the request body
+	var req FeatureBindingRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(ctx, err)
+		return
+	}
+
+	binding := &models.FeatureBinding{
+		TwinID:                  uint(twinID),
+		FeaturePath:             req.FeaturePath,
+		ArrayMode:               req.ArrayMode,
+		ArrayTimeField:          req.ArrayTimeField,
+		ArrayValueField:         req.ArrayValueField,
+		ExpectedType:            req.ExpectedType,
+		TypeViolationMode:       req.TypeViolationMode,
+		ViolationAlertThreshold: req.ViolationAlertThreshold,
+		Precision:               req.Precision,
+		KeepRawValue:            req.KeepRawValue,
+		RollupWindow:            req.RollupWindow,
+		RollupKeepLast:          req.RollupKeepLast,
+		Unit:                    req.Unit,
+		Calibrations:            make(models.Calibrations, 0, len(req.Calibrations)),
+		CalibrationMode:         req.CalibrationMode,
+		PlausibleMin:            req.PlausibleMin,
+		PlausibleMax:            req.PlausibleMax,
+	}
+	for _, calibration := range req.Calibrations {
+		multiplier := 1.0
+		if calibration.Multiplier != nil {
+			multiplier = *calibration.Multiplier
+		}
+		binding.Calibrations = append(binding.Calibrations, models.Calibration{
+			EffectiveFrom: calibration.EffectiveFrom,
+			Offset:        calibration.Offset,
+			Multiplier:    multiplier,
+		})
+	}
+
+	// Save the binding
+	if err := c.twinService.SaveFeatureBinding(binding); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, binding)
+}
+
+// ListFeatureBindings handles listing feature bindings for a twin
+func (c *TwinController) ListFeatureBindings(ctx *gin.Context) {
+	// Get twin ID from URL
+	twinID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	// Get bindings
+	bindings, err := c.twinService.ListFeatureBindings(uint(twinID))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, bindings)
+}
+
+// DeleteFeatureBinding handles deleting a feature binding
+func (c *TwinController) DeleteFeatureBinding(ctx *gin.Context) {
+	// Get binding ID from URL
+	bindingID, err := strconv.ParseUint(ctx.Param("bindingId"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid binding ID"})
+		return
+	}
+
+	// Delete binding
+	if err := c.twinService.DeleteFeatureBinding(uint(bindingID)); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Status(http.StatusNoContent)
+}
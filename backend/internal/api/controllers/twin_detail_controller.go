@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// TwinDetailController handles the composed twin detail used by twin pages
+type TwinDetailController struct {
+	detailService *services.TwinDetailService
+	logger        *utils.Logger
+}
+
+// NewTwinDetailController creates a new twin detail controller
+func NewTwinDetailController(detailService *services.TwinDetailService, logger *utils.Logger) *TwinDetailController {
+	return &TwinDetailController{
+		detailService: detailService,
+		logger:        logger.Named("twin_detail_controller"),
+	}
+}
+
+// RegisterRoutes registers the twin detail route under /twins
+func (c *TwinDetailController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:id/detail", c.GetTwinDetail)
+}
+
+// GetTwinDetail handles getting a twin together with the sections listed in ?include=,
+// e.g. include=type,bindings,model,state,alerts,features. Viewer access to the twin's project
+// grants every section. Sections that fail are listed under "errors" while the others are still
+// returned.
+func (c *TwinDetailController) GetTwinDetail(ctx *gin.Context) {
+	id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin ID"})
+		return
+	}
+
+	include, err := services.ParseTwinDetailInclude(ctx.Query("include"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _ := ctx.Get("user_id")
+	uid, _ := userID.(uint)
+	userRole, _ := ctx.Get("user_role")
+
+	detail, err := c.detailService.Get(ctx.Request.Context(), services.TwinDetailQuery{
+		TwinID:  uint(id),
+		Include: include,
+		UserID:  uid,
+		IsAdmin: userRole == string(models.RoleAdmin),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwinDetailAccessDenied):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case err.Error() == "twin not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	response := gin.H{"twin": newTwinResponse(detail.Twin), "ml_pause": detail.MLPause}
+	for name, value := range detail.Sections {
+		if twinType, ok := value.(*models.TwinType); ok {
+			response[name] = newTwinTypeResponse(twinType)
+			continue
+		}
+		response[name] = value
+	}
+	if len(detail.Errors) > 0 {
+		response["errors"] = detail.Errors
+	}
+
+	ctx.JSON(http.StatusOK, response)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/digital-egiz/backend/internal/db/models"
@@ -15,14 +16,51 @@ import (
 
 // TwinTypeResponse represents a twin type in responses
 type TwinTypeResponse struct {
-	ID          uint            `json:"id"`
-	Name        string          `json:"name"`
-	Description string          `json:"description"`
-	Version     string          `json:"version"`
-	SchemaJSON  json.RawMessage `json:"schema_json"`
-	CreatedBy   uint            `json:"created_by"`
-	CreatedAt   string          `json:"created_at"`
-	UpdatedAt   string          `json:"updated_at"`
+	ID              uint                     `json:"id"`
+	Name            string                   `json:"name"`
+	Description     string                   `json:"description"`
+	Version         string                   `json:"version"`
+	SchemaJSON      json.RawMessage          `json:"schema_json"`
+	PrimaryFeatures []string                 `json:"primary_features"`
+	FeatureMetadata []models.FeatureMetadata `json:"feature_metadata"`
+	FeatureAliases  []models.FeatureAlias    `json:"feature_aliases"`
+	// Days the data of the type's twins is kept; omitted uses the global retention
+	RawRetentionDays        *int   `json:"raw_retention_days,omitempty"`
+	AggregatedRetentionDays *int   `json:"aggregated_retention_days,omitempty"`
+	Definition              string `json:"definition,omitempty"`
+	CreatedBy               uint   `json:"created_by"`
+	CreatedAt               string `json:"created_at"`
+	UpdatedAt               string `json:"updated_at"`
+}
+
+// newTwinTypeResponse maps a twin type to its wire format
+func newTwinTypeResponse(twinType *models.TwinType) TwinTypeResponse {
+	response := TwinTypeResponse{
+		ID:                      twinType.ID,
+		Name:                    twinType.Name,
+		Description:             twinType.Description,
+		Version:                 twinType.Version,
+		SchemaJSON:              json.RawMessage(twinType.SchemaJSON),
+		PrimaryFeatures:         []string(twinType.PrimaryFeatures),
+		FeatureMetadata:         []models.FeatureMetadata(twinType.FeatureMetadata),
+		FeatureAliases:          []models.FeatureAlias(twinType.FeatureAliases),
+		RawRetentionDays:        twinType.RawRetentionDays,
+		AggregatedRetentionDays: twinType.AggregatedRetentionDays,
+		Definition:              twinType.Definition,
+		CreatedBy:               twinType.CreatedBy,
+		CreatedAt:               twinType.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:               twinType.UpdatedAt.Format(time.RFC3339),
+	}
+	if response.PrimaryFeatures == nil {
+		response.PrimaryFeatures = []string{}
+	}
+	if response.FeatureMetadata == nil {
+		response.FeatureMetadata = []models.FeatureMetadata{}
+	}
+	if response.FeatureAliases == nil {
+		response.FeatureAliases = []models.FeatureAlias{}
+	}
+	return response
 }
 
 // CreateTwinTypeRequest represents the request to create a twin type
@@ -31,6 +69,16 @@ type CreateTwinTypeRequest struct {
 	Description string          `json:"description"`
 	Version     string          `json:"version" binding:"required"`
 	SchemaJSON  json.RawMessage `json:"schema_json" binding:"required"`
+	// Features returned by the state of the type's twins by default
+	PrimaryFeatures []string `json:"primary_features"`
+	// Display order, group, icon, unit and expected range of features declared by the schema
+	FeatureMetadata []models.FeatureMetadata `json:"feature_metadata"`
+	// Short names the history API accepts in place of full feature paths
+	FeatureAliases []models.FeatureAlias `json:"feature_aliases"`
+	// Days the raw and aggregated data of the type's twins is kept, unless a twin overrides
+	// them; omitted uses the global retention and 0 keeps the data forever
+	RawRetentionDays        *int `json:"raw_retention_days"`
+	AggregatedRetentionDays *int `json:"aggregated_retention_days"`
 }
 
 // UpdateTwinTypeRequest represents the request to update a twin type
@@ -39,6 +87,81 @@ type UpdateTwinTypeRequest struct {
 	Description string          `json:"description"`
 	Version     string          `json:"version" binding:"required"`
 	SchemaJSON  json.RawMessage `json:"schema_json" binding:"required"`
+	// Features returned by the state of the type's twins by default
+	PrimaryFeatures []string `json:"primary_features"`
+	// Display order, group, icon, unit and expected range of features declared by the schema
+	FeatureMetadata []models.FeatureMetadata `json:"feature_metadata"`
+	// Short names the history API accepts in place of full feature paths
+	FeatureAliases []models.FeatureAlias `json:"feature_aliases"`
+	// Days the raw and aggregated data of the type's twins is kept, unless a twin overrides
+	// them; omitted keeps the current retention and 0 keeps the data forever
+	RawRetentionDays        *int `json:"raw_retention_days"`
+	AggregatedRetentionDays *int `json:"aggregated_retention_days"`
+	// ClearRetention removes both retention windows before the ones given are applied, so the
+	// type's twins fall back to the global retention
+	ClearRetention bool `json:"clear_retention"`
+}
+
+// UpsertTwinTypeResponse is a twin type applied by name and version, with whether it was
+// created, updated or unchanged
+type UpsertTwinTypeResponse struct {
+	TwinTypeResponse
+	Result string `json:"result"`
+}
+
+// ValidateSchemaRequest represents the request to check a twin type schema before saving it
+type ValidateSchemaRequest struct {
+	// SchemaJSON is the schema, as JSON or as a string holding its text
+	SchemaJSON json.RawMessage `json:"schema_json" binding:"required"`
+	// Instance is an optional sample document validated against the schema, as JSON or as a string holding its text
+	Instance json.RawMessage `json:"instance"`
+}
+
+// CompatCheckRequest represents the request to check the schema of a new twin type version
+// against the type's existing twins
+type CompatCheckRequest struct {
+	// SchemaJSON is the schema of the new version, as JSON or as a string holding its text
+	SchemaJSON json.RawMessage `json:"schema_json" binding:"required"`
+}
+
+// rawOrText returns the document of a field that holds either JSON or a string of JSON text,
+// so editors can submit text that is not yet well-formed
+func rawOrText(field json.RawMessage) []byte {
+	var text string
+	if err := json.Unmarshal(field, &text); err == nil {
+		return []byte(text)
+	}
+	return field
+}
+
+// TwinTypeUsageBinding is an ML task binding of a twin using a twin type
+type TwinTypeUsageBinding struct {
+	ID       uint              `json:"id"`
+	TaskID   uint              `json:"task_id"`
+	TaskName string            `json:"task_name"`
+	TaskType models.MLTaskType `json:"task_type"`
+	ModelID  string            `json:"model_id"`
+	Active   bool              `json:"active"`
+}
+
+// TwinTypeUsageTwin is a twin using a twin type, with its ML task bindings
+type TwinTypeUsageTwin struct {
+	ID        uint                   `json:"id"`
+	Name      string                 `json:"name"`
+	DittoID   string                 `json:"ditto_id"`
+	ProjectID uint                   `json:"project_id"`
+	Bindings  []TwinTypeUsageBinding `json:"bindings"`
+}
+
+// TwinTypeUsageResponse describes what depends on a twin type
+type TwinTypeUsageResponse struct {
+	TwinTypeID   uint                `json:"twin_type_id"`
+	TwinCount    int64               `json:"twin_count"`
+	ProjectCount int64               `json:"project_count"`
+	BindingCount int64               `json:"binding_count"`
+	MLTaskCount  int64               `json:"ml_task_count"`
+	Twins        []TwinTypeUsageTwin `json:"twins"`
+	Pagination   gin.H               `json:"pagination"`
 }
 
 // TwinTypeController handles twin type management endpoints
@@ -61,7 +184,11 @@ func (tc *TwinTypeController) RegisterRoutes(router *gin.RouterGroup) {
 	{
 		twinTypes.GET("", tc.ListTwinTypes)
 		twinTypes.POST("", tc.CreateTwinType)
+		twinTypes.PUT("", tc.UpsertTwinType)
+		twinTypes.POST("/validate", tc.ValidateSchema)
 		twinTypes.GET("/:id", tc.GetTwinType)
+		twinTypes.GET("/:id/usage", tc.GetTwinTypeUsage)
+		twinTypes.POST("/:id/versions/:version/compat-check", tc.CheckVersionCompatibility)
 		twinTypes.PUT("/:id", tc.UpdateTwinType)
 		twinTypes.DELETE("/:id", tc.DeleteTwinType)
 	}
@@ -101,17 +228,8 @@ func (tc *TwinTypeController) ListTwinTypes(c *gin.Context) {
 
 	// Map twin types to response objects
 	response := make([]TwinTypeResponse, len(twinTypes))
-	for i, twinType := range twinTypes {
-		response[i] = TwinTypeResponse{
-			ID:          twinType.ID,
-			Name:        twinType.Name,
-			Description: twinType.Description,
-			Version:     twinType.Version,
-			SchemaJSON:  json.RawMessage(twinType.SchemaJSON),
-			CreatedBy:   twinType.CreatedBy,
-			CreatedAt:   twinType.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:   twinType.UpdatedAt.Format(time.RFC3339),
-		}
+	for i := range twinTypes {
+		response[i] = newTwinTypeResponse(&twinTypes[i])
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -134,6 +252,7 @@ func (tc *TwinTypeController) ListTwinTypes(c *gin.Context) {
 // @Param twin_type body CreateTwinTypeRequest true "Twin type information"
 // @Success 201 {object} TwinTypeResponse "Created twin type"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Server error"
 // @Router /twin-types [post]
@@ -147,7 +266,7 @@ func (tc *TwinTypeController) CreateTwinType(c *gin.Context) {
 
 	var req CreateTwinTypeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -159,30 +278,184 @@ func (tc *TwinTypeController) CreateTwinType(c *gin.Context) {
 
 	// Create new twin type
 	twinType := &models.TwinType{
-		Name:        req.Name,
-		Description: req.Description,
-		Version:     req.Version,
-		SchemaJSON:  models.JSON(req.SchemaJSON),
-		CreatedBy:   userID.(uint),
+		Name:                    req.Name,
+		Description:             req.Description,
+		Version:                 req.Version,
+		SchemaJSON:              models.JSON(req.SchemaJSON),
+		PrimaryFeatures:         req.PrimaryFeatures,
+		FeatureMetadata:         req.FeatureMetadata,
+		FeatureAliases:          req.FeatureAliases,
+		RawRetentionDays:        req.RawRetentionDays,
+		AggregatedRetentionDays: req.AggregatedRetentionDays,
+		CreatedBy:               userID.(uint),
 	}
 
 	// Save twin type to database
 	if err := tc.twinTypeService.Create(twinType); err != nil {
+		if isFeatureSettingError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		tc.logger.Error("Failed to create twin type", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, TwinTypeResponse{
-		ID:          twinType.ID,
-		Name:        twinType.Name,
-		Description: twinType.Description,
-		Version:     twinType.Version,
-		SchemaJSON:  json.RawMessage(twinType.SchemaJSON),
-		CreatedBy:   twinType.CreatedBy,
-		CreatedAt:   twinType.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   twinType.UpdatedAt.Format(time.RFC3339),
-	})
+	c.JSON(http.StatusCreated, newTwinTypeResponse(twinType))
+}
+
+// UpsertTwinType creates a twin type or brings the one of the same name up to date
+// @Summary Apply a twin type
+// @Description Creates the twin type if none has its name, and otherwise updates it, so provisioning can re-apply the same definitions. A version's schema is immutable: re-applying a known version only updates its description, primary features, feature metadata, feature aliases and retention, and conflicts if the schema differs. A newer version replaces the type's version and schema; an older one conflicts.
+// @Tags twin-types
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param twin_type body CreateTwinTypeRequest true "Twin type information"
+// @Success 200 {object} UpsertTwinTypeResponse "Updated or unchanged twin type"
+// @Success 201 {object} UpsertTwinTypeResponse "Created twin type"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Schema of an existing version differs, or the version is not newer than the stored one"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /twin-types [put]
+func (tc *TwinTypeController) UpsertTwinType(c *gin.Context) {
+	// Get current user ID
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		return
+	}
+
+	var req CreateTwinTypeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	// Validate JSON schema (must be valid JSON)
+	if !json.Valid(req.SchemaJSON) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON schema"})
+		return
+	}
+
+	twinType := &models.TwinType{
+		Name:                    req.Name,
+		Description:             req.Description,
+		Version:                 req.Version,
+		SchemaJSON:              models.JSON(req.SchemaJSON),
+		PrimaryFeatures:         req.PrimaryFeatures,
+		FeatureMetadata:         req.FeatureMetadata,
+		FeatureAliases:          req.FeatureAliases,
+		RawRetentionDays:        req.RawRetentionDays,
+		AggregatedRetentionDays: req.AggregatedRetentionDays,
+		CreatedBy:               userID.(uint),
+	}
+
+	result, err := tc.twinTypeService.Upsert(twinType)
+	if err != nil {
+		switch {
+		case isFeatureSettingError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "twin type version conflict"):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			tc.logger.Error("Failed to apply twin type", zap.String("name", req.Name), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if result == services.TwinTypeCreated {
+		status = http.StatusCreated
+	}
+	c.JSON(status, UpsertTwinTypeResponse{TwinTypeResponse: newTwinTypeResponse(twinType), Result: result})
+}
+
+// ValidateSchema checks a twin type schema, and optionally a sample instance, without saving
+// @Summary Validate a twin type schema
+// @Description Checks that schema_json is well-formed JSON and a valid JSON Schema (draft-07 unless it declares draft-04 or draft-06), and validates the optional instance against it. Problems are reported with their location: a JSON pointer, or the line and column of a syntax error.
+// @Tags twin-types
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param request body ValidateSchemaRequest true "Schema and optional sample instance"
+// @Success 200 {object} utils.SchemaCheck "Validation result"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Router /twin-types/validate [post]
+func (tc *TwinTypeController) ValidateSchema(c *gin.Context) {
+	var req ValidateSchemaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	var instance []byte
+	if len(req.Instance) > 0 && string(req.Instance) != "null" {
+		instance = rawOrText(req.Instance)
+	}
+
+	c.JSON(http.StatusOK, utils.CheckJSONSchema(rawOrText(req.SchemaJSON), instance))
+}
+
+// CheckVersionCompatibility checks the schema of a new twin type version against a sample of the type's twins
+// @Summary Check a new twin type version against existing twins
+// @Description Validates the latest values of a random sample of the type's twins against the schema of a new version, before it is published. A feature breaks if its value is valid under the current schema but not under the new one, or if the new schema no longer declares it. The sample holds 50 twins unless set, at most 500.
+// @Tags twin-types
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin type ID"
+// @Param version path string true "New version"
+// @Param sample query int false "Number of twins to check" default(50)
+// @Param request body CompatCheckRequest true "Schema of the new version"
+// @Success 200 {object} services.SchemaCompatReport "Compatibility report"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Twin type not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /twin-types/{id}/versions/{version}/compat-check [post]
+func (tc *TwinTypeController) CheckVersionCompatibility(c *gin.Context) {
+	// Parse twin type ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin type ID"})
+		return
+	}
+
+	sample := 0
+	if raw := c.Query("sample"); raw != "" {
+		if sample, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sample size"})
+			return
+		}
+	}
+
+	var req CompatCheckRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	report, err := tc.twinTypeService.CheckCompatibility(c.Request.Context(), uint(id), c.Param("version"),
+		models.JSON(rawOrText(req.SchemaJSON)), sample)
+	if err != nil {
+		switch {
+		case err.Error() == "twin type not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Twin type not found"})
+		case strings.HasPrefix(err.Error(), "invalid "):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			tc.logger.Error("Failed to check twin type compatibility", zap.Uint("id", uint(id)), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check compatibility"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
 }
 
 // GetTwinType returns a twin type by ID
@@ -217,15 +490,89 @@ func (tc *TwinTypeController) GetTwinType(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, TwinTypeResponse{
-		ID:          twinType.ID,
-		Name:        twinType.Name,
-		Description: twinType.Description,
-		Version:     twinType.Version,
-		SchemaJSON:  json.RawMessage(twinType.SchemaJSON),
-		CreatedBy:   twinType.CreatedBy,
-		CreatedAt:   twinType.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   twinType.UpdatedAt.Format(time.RFC3339),
+	c.JSON(http.StatusOK, newTwinTypeResponse(twinType))
+}
+
+// GetTwinTypeUsage returns what depends on a twin type
+// @Summary Get twin type usage
+// @Description Returns the twins using a twin type, paginated, with the ML task bindings tied to them, and totals over all of its twins
+// @Tags twin-types
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Twin type ID"
+// @Param page query int false "Page number (1-based)" default(1)
+// @Param limit query int false "Page size" default(20)
+// @Success 200 {object} TwinTypeUsageResponse "Twin type usage"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Twin type not found"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /twin-types/{id}/usage [get]
+func (tc *TwinTypeController) GetTwinTypeUsage(c *gin.Context) {
+	// Parse twin type ID
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid twin type ID"})
+		return
+	}
+
+	// Parse pagination parameters
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	report, err := tc.twinTypeService.Usage(uint(id), page, limit)
+	if err != nil {
+		if err.Error() == "twin type not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Twin type not found"})
+			return
+		}
+		tc.logger.Error("Failed to get twin type usage", zap.Uint("id", uint(id)), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve twin type usage"})
+		return
+	}
+
+	twins := make([]TwinTypeUsageTwin, len(report.Twins))
+	for i, twin := range report.Twins {
+		bindings := make([]TwinTypeUsageBinding, 0, len(report.Bindings[twin.ID]))
+		for _, binding := range report.Bindings[twin.ID] {
+			bindings = append(bindings, TwinTypeUsageBinding{
+				ID:       binding.ID,
+				TaskID:   binding.TaskID,
+				TaskName: binding.Task.Name,
+				TaskType: binding.Task.Type,
+				ModelID:  binding.Task.ModelID,
+				Active:   binding.Active,
+			})
+		}
+		twins[i] = TwinTypeUsageTwin{
+			ID:        twin.ID,
+			Name:      twin.Name,
+			DittoID:   twin.DittoID,
+			ProjectID: twin.ProjectID,
+			Bindings:  bindings,
+		}
+	}
+
+	c.JSON(http.StatusOK, TwinTypeUsageResponse{
+		TwinTypeID:   uint(id),
+		TwinCount:    report.Usage.Twins,
+		ProjectCount: report.Usage.Projects,
+		BindingCount: report.Usage.Bindings,
+		MLTaskCount:  report.Usage.Tasks,
+		Twins:        twins,
+		Pagination: gin.H{
+			"total": report.Usage.Twins,
+			"page":  page,
+			"limit": limit,
+		},
 	})
 }
 
@@ -240,6 +587,7 @@ func (tc *TwinTypeController) GetTwinType(c *gin.Context) {
 // @Param twin_type body UpdateTwinTypeRequest true "Twin type information"
 // @Success 200 {object} TwinTypeResponse "Updated twin type"
 // @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 404 {object} map[string]string "Twin type not found"
 // @Failure 500 {object} map[string]string "Server error"
@@ -254,7 +602,7 @@ func (tc *TwinTypeController) UpdateTwinType(c *gin.Context) {
 
 	var req UpdateTwinTypeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		utils.HandleValidationErrors(c, err)
 		return
 	}
 
@@ -281,24 +629,38 @@ func (tc *TwinTypeController) UpdateTwinType(c *gin.Context) {
 	twinType.Description = req.Description
 	twinType.Version = req.Version
 	twinType.SchemaJSON = models.JSON(req.SchemaJSON)
+	if req.PrimaryFeatures != nil {
+		twinType.PrimaryFeatures = req.PrimaryFeatures
+	}
+	if req.FeatureMetadata != nil {
+		twinType.FeatureMetadata = req.FeatureMetadata
+	}
+	if req.FeatureAliases != nil {
+		twinType.FeatureAliases = req.FeatureAliases
+	}
+	if req.ClearRetention {
+		twinType.RawRetentionDays = nil
+		twinType.AggregatedRetentionDays = nil
+	}
+	if req.RawRetentionDays != nil {
+		twinType.RawRetentionDays = req.RawRetentionDays
+	}
+	if req.AggregatedRetentionDays != nil {
+		twinType.AggregatedRetentionDays = req.AggregatedRetentionDays
+	}
 
 	// Save twin type to database
 	if err := tc.twinTypeService.Update(twinType); err != nil {
+		if isFeatureSettingError(err) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		tc.logger.Error("Failed to update twin type", zap.Uint("id", uint(id)), zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, TwinTypeResponse{
-		ID:          twinType.ID,
-		Name:        twinType.Name,
-		Description: twinType.Description,
-		Version:     twinType.Version,
-		SchemaJSON:  json.RawMessage(twinType.SchemaJSON),
-		CreatedBy:   twinType.CreatedBy,
-		CreatedAt:   twinType.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   twinType.UpdatedAt.Format(time.RFC3339),
-	})
+	c.JSON(http.StatusOK, newTwinTypeResponse(twinType))
 }
 
 // DeleteTwinType deletes a twin type by ID
@@ -335,3 +697,13 @@ func (tc *TwinTypeController) DeleteTwinType(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Twin type deleted successfully"})
 }
+
+// isFeatureSettingError reports whether a twin type was rejected for its primary features,
+// feature metadata, feature aliases or retention
+func isFeatureSettingError(err error) bool {
+	message := err.Error()
+	return strings.HasPrefix(message, "invalid primary feature") ||
+		strings.HasPrefix(message, "invalid feature metadata") ||
+		strings.HasPrefix(message, "invalid feature alias") ||
+		strings.HasPrefix(message, "invalid retention")
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateWebhookRequest represents the request to create a webhook subscription
+type CreateWebhookRequest struct {
+	URL        string   `json:"url" binding:"required,url"`
+	Secret     string   `json:"secret" binding:"omitempty,min=16"`
+	EventTypes []string `json:"event_types"`
+}
+
+// TestWebhookRequest represents the request to send a test event to a webhook
+type TestWebhookRequest struct {
+	EventType string `json:"event_type" binding:"required"`
+}
+
+// WebhookController handles webhook subscription endpoints
+type WebhookController struct {
+	webhookService *services.WebhookService
+	projectService *services.ProjectService
+	logger         *utils.Logger
+}
+
+// NewWebhookController creates a new webhook controller
+func NewWebhookController(
+	webhookService *services.WebhookService,
+	projectService *services.ProjectService,
+	logger *utils.Logger,
+) *WebhookController {
+	return &WebhookController{
+		webhookService: webhookService,
+		projectService: projectService,
+		logger:         logger.Named("webhook_controller"),
+	}
+}
+
+// RegisterRoutes registers the controller's routes with the router group
+func (wc *WebhookController) RegisterRoutes(router *gin.RouterGroup) {
+	projectAuth := middleware.NewProjectAuthMiddleware(wc.projectService)
+
+	// Webhooks carry project data to external systems, so only owners manage them
+	webhooks := router.Group("/projects/:id/webhooks")
+	webhooks.Use(projectAuth.RequireProjectOwner())
+	{
+		webhooks.GET("", wc.ListWebhooks)
+		webhooks.POST("", wc.CreateWebhook)
+		webhooks.DELETE("/:webhookId", wc.DeleteWebhook)
+		webhooks.POST("/:webhookId/test", wc.TestWebhook)
+	}
+}
+
+// ListWebhooks lists the webhook subscriptions of a project
+// @Summary List webhook subscriptions
+// @Description Returns the webhook subscriptions of a project (owner only)
+// @Tags webhooks
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Success 200 {array} models.WebhookSubscription "Webhook subscriptions"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Server error"
+// @Router /projects/{id}/webhooks [get]
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	subscriptions, err := wc.webhookService.ListSubscriptions(uint(projectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, subscriptions)
+}
+
+// CreateWebhook creates a webhook subscription
+// @Summary Create webhook subscription
+// @Description Subscribes a URL to project events. The signing secret is only returned in this response.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param webhook body CreateWebhookRequest true "Webhook subscription"
+// @Success 201 {object} map[string]interface{} "Created subscription with secret"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /projects/{id}/webhooks [post]
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	createdBy, _ := userID.(uint)
+
+	subscription := &models.WebhookSubscription{
+		ProjectID:  uint(projectID),
+		URL:        req.URL,
+		Secret:     req.Secret,
+		EventTypes: strings.Join(req.EventTypes, ","),
+		CreatedBy:  createdBy,
+	}
+
+	if err := wc.webhookService.CreateSubscription(subscription); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"subscription": subscription,
+		"secret":       subscription.Secret,
+	})
+}
+
+// DeleteWebhook deletes a webhook subscription
+// @Summary Delete webhook subscription
+// @Description Deletes a webhook subscription of a project (owner only)
+// @Tags webhooks
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook subscription ID"
+// @Success 204 "No content"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Webhook subscription not found"
+// @Router /projects/{id}/webhooks/{webhookId} [delete]
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("webhookId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if err := wc.webhookService.DeleteSubscription(uint(projectID), uint(webhookID)); err != nil {
+		if err.Error() == "webhook subscription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// TestWebhook sends a sample event to a webhook subscription
+// @Summary Send test webhook event
+// @Description Delivers a signed sample event of the chosen type and returns the receiver's status and latency. The event is not stored.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Security Bearer
+// @Param id path int true "Project ID"
+// @Param webhookId path int true "Webhook subscription ID"
+// @Param request body TestWebhookRequest true "Event type"
+// @Success 200 {object} services.WebhookDeliveryResult "Delivery result"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 422 {object} utils.ValidationErrorResponse "Validation failed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Webhook subscription not found"
+// @Router /projects/{id}/webhooks/{webhookId}/test [post]
+func (wc *WebhookController) TestWebhook(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("webhookId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var req TestWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.HandleValidationErrors(c, err)
+		return
+	}
+
+	result, err := wc.webhookService.SendTestEvent(uint(projectID), uint(webhookID), req.EventType)
+	if err != nil {
+		switch {
+		case err.Error() == "webhook subscription not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "unknown event type"):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
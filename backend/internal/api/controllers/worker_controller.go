@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// WorkerController lets administrators inspect and control the background workers
+type WorkerController struct {
+	registry *lifecycle.Registry
+	logger   *utils.Logger
+}
+
+// NewWorkerController creates a new worker controller for the workers of a lifecycle registry
+func NewWorkerController(registry *lifecycle.Registry, logger *utils.Logger) *WorkerController {
+	return &WorkerController{
+		registry: registry,
+		logger:   logger.Named("worker_controller"),
+	}
+}
+
+// RegisterRoutes registers the routes for the worker controller
+func (wc *WorkerController) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/workers", wc.ListWorkers)
+	router.POST("/workers/:name/trigger", wc.TriggerWorker)
+	router.POST("/workers/:name/pause", wc.PauseWorker)
+	router.POST("/workers/:name/resume", wc.ResumeWorker)
+}
+
+// ListWorkers returns the state of each background worker
+// @Summary List background workers
+// @Description Returns each background worker with its state, schedule, last run, next run and last error (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Success 200 {object} map[string]interface{} "Background workers"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 503 {object} map[string]string "Workers not initialized"
+// @Router /admin/workers [get]
+func (wc *WorkerController) ListWorkers(c *gin.Context) {
+	if wc.registry == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Background workers are not initialized"})
+		return
+	}
+
+	workers := wc.registry.Workers()
+	statuses := make([]lifecycle.WorkerStatus, len(workers))
+	for i, worker := range workers {
+		statuses[i] = worker.Status()
+	}
+	c.JSON(http.StatusOK, gin.H{"data": statuses})
+}
+
+// TriggerWorker runs a background worker's job on demand
+// @Summary Trigger a background worker
+// @Description Queues a run of the worker's job, which starts as soon as a running one finishes. Paused workers can be triggered (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Worker name"
+// @Success 202 {object} lifecycle.WorkerStatus "Run queued"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Worker not found"
+// @Failure 409 {object} map[string]string "Worker stopped, disabled or only run on request"
+// @Failure 503 {object} map[string]string "Workers not initialized"
+// @Router /admin/workers/{name}/trigger [post]
+func (wc *WorkerController) TriggerWorker(c *gin.Context) {
+	worker, ok := wc.worker(c)
+	if !ok {
+		return
+	}
+
+	if err := worker.Trigger(); err != nil {
+		if errors.Is(err, lifecycle.ErrWorkerNotRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Worker is stopped or disabled"})
+			return
+		}
+		if errors.Is(err, lifecycle.ErrWorkerOnDemand) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Worker only runs on request"})
+			return
+		}
+		wc.logger.Error("Failed to trigger worker", zap.String("worker", worker.Name()), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trigger worker"})
+		return
+	}
+
+	wc.logger.Info("Worker triggered", zap.String("worker", worker.Name()))
+	c.JSON(http.StatusAccepted, worker.Status())
+}
+
+// PauseWorker skips a background worker's scheduled runs
+// @Summary Pause a background worker
+// @Description Skips the worker's scheduled runs until it is resumed; a running job finishes (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Worker name"
+// @Success 200 {object} lifecycle.WorkerStatus "Worker paused"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Worker not found"
+// @Failure 503 {object} map[string]string "Workers not initialized"
+// @Router /admin/workers/{name}/pause [post]
+func (wc *WorkerController) PauseWorker(c *gin.Context) {
+	worker, ok := wc.worker(c)
+	if !ok {
+		return
+	}
+
+	worker.Pause()
+	wc.logger.Info("Worker paused", zap.String("worker", worker.Name()))
+	c.JSON(http.StatusOK, worker.Status())
+}
+
+// ResumeWorker runs a paused background worker on schedule again
+// @Summary Resume a background worker
+// @Description Runs the worker's job on schedule again (admin only)
+// @Tags admin
+// @Produce json
+// @Security Bearer
+// @Param name path string true "Worker name"
+// @Success 200 {object} lifecycle.WorkerStatus "Worker resumed"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Worker not found"
+// @Failure 503 {object} map[string]string "Workers not initialized"
+// @Router /admin/workers/{name}/resume [post]
+func (wc *WorkerController) ResumeWorker(c *gin.Context) {
+	worker, ok := wc.worker(c)
+	if !ok {
+		return
+	}
+
+	worker.Resume()
+	wc.logger.Info("Worker resumed", zap.String("worker", worker.Name()))
+	c.JSON(http.StatusOK, worker.Status())
+}
+
+// worker looks up the worker named in the path, responding with an error if there is none
+func (wc *WorkerController) worker(c *gin.Context) (lifecycle.Worker, bool) {
+	if wc.registry == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Background workers are not initialized"})
+		return nil, false
+	}
+
+	worker, ok := wc.registry.Worker(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Worker not found"})
+		return nil, false
+	}
+	return worker, true
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware records mutating requests in the audit log once they are handled.
+// It must run after authentication so the acting user is known.
+func AuditMiddleware(auditService *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auditService.Enabled() {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		entry := &models.AuditEntry{
+			Time:     start,
+			Method:   c.Request.Method,
+			Path:     c.Request.URL.Path,
+			Status:   c.Writer.Status(),
+			ClientIP: c.ClientIP(),
+		}
+		if userID, ok := c.Get("user_id"); ok {
+			if id, ok := userID.(uint); ok {
+				entry.UserID = &id
+			}
+		}
+
+		// Failures are logged by the service; the response has already been written
+		_ = auditService.Record(entry)
+	}
+}
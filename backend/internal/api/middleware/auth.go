@@ -7,6 +7,7 @@ import (
 
 	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -16,7 +17,8 @@ var TokenExpiredError = errors.New("token_expired")
 
 // AuthMiddleware provides JWT authentication middleware for Gin
 type AuthMiddleware struct {
-	jwtConfig *config.JWTConfig
+	jwtConfig   *config.JWTConfig
+	replayGuard *services.TokenReplayGuard
 }
 
 // NewAuthMiddleware creates a new authentication middleware
@@ -26,6 +28,11 @@ func NewAuthMiddleware(jwtConfig *config.JWTConfig) *AuthMiddleware {
 	}
 }
 
+// SetReplayGuard rejects tokens presented by another client than the one they were first seen from
+func (am *AuthMiddleware) SetReplayGuard(replayGuard *services.TokenReplayGuard) {
+	am.replayGuard = replayGuard
+}
+
 // RequireAuth middleware ensures that a valid JWT token is present in the request
 func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -58,6 +65,27 @@ func (am *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
+		// Reject stolen tokens replayed from another client
+		if am.replayGuard != nil {
+			if err := am.replayGuard.Check(claims, c.ClientIP(), c.GetHeader("User-Agent")); err != nil {
+				switch {
+				case errors.Is(err, services.ErrTokenReplayed):
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"error": "Token was presented by another client",
+						"code":  "token_replayed",
+					})
+				case errors.Is(err, services.ErrTokenUnidentified):
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"error": "Token has no ID, sign in again",
+						"code":  "token_unidentified",
+					})
+				default:
+					c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to verify token"})
+				}
+				return
+			}
+		}
+
 		// Set user claims in context for later use
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
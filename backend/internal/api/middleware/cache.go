@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// expiredDate is sent as Expires on responses that must not be stored
+var expiredDate = time.Unix(0, 0).UTC().Format(http.TimeFormat)
+
+// CacheControlMiddleware sends the Cache-Control and Expires headers configured for the
+// route of successful GET requests. Cacheable responses also get an ETag, so clients can
+// revalidate them with If-None-Match and receive 304 Not Modified when unchanged. Responses
+// to authenticated requests are only cacheable by the client, never by shared caches.
+func CacheControlMiddleware(cfg *config.ServerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		maxAge, ok := cfg.RouteCacheControl(c.FullPath())
+		if !ok || isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		if maxAge < 0 {
+			c.Header("Cache-Control", "no-store")
+			c.Header("Expires", expiredDate)
+			c.Next()
+			return
+		}
+
+		cw := &cacheWriter{ResponseWriter: c.Writer}
+		c.Writer = cw
+		c.Next()
+		c.Writer = cw.ResponseWriter
+
+		if cw.streaming {
+			return
+		}
+		if cw.Status() != http.StatusOK {
+			cw.flush()
+			return
+		}
+
+		scope := "public"
+		if c.GetHeader("Authorization") != "" {
+			scope = "private"
+		}
+		header := cw.Header()
+		if maxAge == 0 {
+			header.Set("Cache-Control", scope+", no-cache")
+			header.Set("Expires", expiredDate)
+		} else {
+			header.Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", scope, maxAge))
+			header.Set("Expires", time.Now().Add(time.Duration(maxAge)*time.Second).UTC().Format(http.TimeFormat))
+		}
+		if header.Get("ETag") == "" {
+			sum := sha256.Sum256(cw.body.Bytes())
+			header.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		}
+
+		if etagMatches(c.GetHeader("If-None-Match"), header.Get("ETag")) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			cw.status = http.StatusNotModified
+			cw.body.Reset()
+		}
+		cw.flush()
+	}
+}
+
+// etagMatches reports whether an If-None-Match header lists an ETag, compared weakly
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheWriter holds a handler's response until its caching headers are known. A handler
+// flushing its output streams it instead, without caching headers.
+type cacheWriter struct {
+	gin.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+// WriteHeader records the status code to send
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.streaming {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow defers sending the headers until the response is complete
+func (w *cacheWriter) WriteHeaderNow() {
+	if w.streaming {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Write buffers the handler's output
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.body.Write(data)
+}
+
+// WriteString buffers the handler's output
+func (w *cacheWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Status returns the status code the handler set
+func (w *cacheWriter) Status() int {
+	if w.streaming {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Size returns the number of bytes written by the handler
+func (w *cacheWriter) Size() int {
+	if w.streaming {
+		return w.ResponseWriter.Size()
+	}
+	return w.body.Len()
+}
+
+// Written reports whether the handler has responded
+func (w *cacheWriter) Written() bool {
+	return w.streaming || w.status != 0 || w.body.Len() > 0
+}
+
+// Flush switches to streaming, sending what was buffered so far
+func (w *cacheWriter) Flush() {
+	if !w.streaming {
+		w.flush()
+		w.streaming = true
+	}
+	w.ResponseWriter.Flush()
+}
+
+// flush sends the buffered status and output
+func (w *cacheWriter) flush() {
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+	w.body.Reset()
+}
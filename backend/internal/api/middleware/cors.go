@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	corsAllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsAllowHeaders = []string{"Authorization", "Content-Type", "Origin"}
+)
+
+// corsMaxAge is how long (in seconds) browsers may cache a preflight response
+const corsMaxAge = 12 * 60 * 60
+
+// OriginMatcher checks request origins against the configured allow list.
+// Entries are either exact origins ("https://app.acme.dev"), patterns where
+// "*" stands for a single host label or port ("https://*.preview.acme.dev"),
+// or a lone "*" that allows any origin.
+type OriginMatcher struct {
+	exact    map[string]bool
+	patterns []*regexp.Regexp
+	allowAll bool
+}
+
+// NewOriginMatcher compiles the allowed origins once so requests only pay for matching
+func NewOriginMatcher(origins []string) *OriginMatcher {
+	m := &OriginMatcher{
+		exact: make(map[string]bool),
+	}
+
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			m.allowAll = true
+		case strings.Contains(origin, "*"):
+			parts := strings.Split(origin, "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
+			}
+			m.patterns = append(m.patterns, regexp.MustCompile("^"+strings.Join(parts, "[a-z0-9-]+")+"$"))
+		default:
+			m.exact[origin] = true
+		}
+	}
+
+	return m
+}
+
+// Match reports whether the origin is allowed and whether it matched an exact entry.
+// Only exact matches may be served with credentials.
+func (m *OriginMatcher) Match(origin string) (allowed bool, exact bool) {
+	origin = strings.ToLower(origin)
+	if origin == "" {
+		return false, false
+	}
+
+	if m.exact[origin] {
+		return true, true
+	}
+
+	for _, pattern := range m.patterns {
+		if pattern.MatchString(origin) {
+			return true, false
+		}
+	}
+
+	return m.allowAll, false
+}
+
+// sameOrigin reports whether a request's origin is the host it was sent to, as for pages
+// served by the backend itself. The scheme is not compared, since TLS may end at a proxy.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// CheckOrigin can be used as websocket.Upgrader.CheckOrigin.
+// Requests without an Origin header come from non-browser clients and are allowed,
+// as are same-origin requests.
+func (m *OriginMatcher) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(r, origin) {
+		return true
+	}
+
+	allowed, _ := m.Match(origin)
+	return allowed
+}
+
+// CORSMiddleware applies CORS headers for allowed origins and rejects all other cross-origin requests
+func CORSMiddleware(matcher *OriginMatcher) gin.HandlerFunc {
+	allowMethods := strings.Join(corsAllowMethods, ", ")
+	allowHeaders := strings.Join(corsAllowHeaders, ", ")
+	maxAge := strconv.Itoa(corsMaxAge)
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			// Same-origin or non-browser request
+			c.Next()
+			return
+		}
+		if sameOrigin(c.Request, origin) {
+			// Browsers send the origin of same-origin POST requests too; they need no CORS headers
+			c.Next()
+			return
+		}
+
+		allowed, exact := matcher.Match(origin)
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+		if exact {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// Answer preflight requests directly
+		if c.Request.Method == http.MethodOptions {
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+			header.Set("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecation describes a deprecated route and what replaces it
+type Deprecation struct {
+	// Since is when the route was deprecated; zero sends "Deprecation: true"
+	Since time.Time
+	// Sunset is when the route stops responding; zero omits the Sunset header
+	Sunset time.Time
+	// Successor maps a request path to the path replacing it; nil or "" omits the Link header
+	Successor func(path string) string
+}
+
+// DeprecationMiddleware marks responses of deprecated routes with the Deprecation (RFC 9745)
+// and Sunset (RFC 8594) headers, linking to the successor route when there is one
+func DeprecationMiddleware(d Deprecation) gin.HandlerFunc {
+	deprecation := "true"
+	if !d.Since.IsZero() {
+		deprecation = fmt.Sprintf("@%d", d.Since.Unix())
+	}
+	sunset := ""
+	if !d.Sunset.IsZero() {
+		sunset = d.Sunset.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		if sunset != "" {
+			c.Header("Sunset", sunset)
+		}
+		if d.Successor != nil {
+			if successor := d.Successor(c.Request.URL.Path); successor != "" {
+				c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+			}
+		}
+		c.Next()
+	}
+}
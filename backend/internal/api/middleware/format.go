@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseFormatMiddleware negotiates the format handlers using utils.Render respond with.
+// JSON is always available; MessagePack only when enabled in the configuration.
+func ResponseFormatMiddleware(cfg *config.ServerConfig) gin.HandlerFunc {
+	formats := []string{utils.FormatJSON}
+	if cfg.MsgPackEnabled {
+		formats = append(formats, utils.FormatMsgPack)
+	}
+
+	return func(c *gin.Context) {
+		if len(formats) > 1 {
+			// The response depends on the Accept header, so caches must key on it
+			c.Header("Vary", "Accept")
+		}
+		utils.SetResponseFormat(c, utils.NegotiateFormat(c.GetHeader("Accept"), formats))
+		c.Next()
+	}
+}
@@ -45,6 +45,9 @@ func LoggingMiddleware(logger *utils.Logger) gin.HandlerFunc {
 		if exists {
 			logFields = append(logFields, zap.Any("user_id", userID))
 		}
+		if requestID := c.GetString("request_id"); requestID != "" {
+			logFields = append(logFields, zap.String("request_id", requestID))
+		}
 
 		// Log based on status code
 		switch {
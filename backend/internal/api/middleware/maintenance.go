@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// MaintenanceMiddleware rejects mutating requests with 503 and a Retry-After header while
+// maintenance mode is on. Reads are served as usual, and the routes in exempt (route
+// patterns such as "/api/v1/auth/login") stay writable so admins can sign in and switch
+// maintenance mode off.
+func MaintenanceMiddleware(maintenance *services.MaintenanceService, exempt ...string) gin.HandlerFunc {
+	exemptRoutes := make(map[string]bool, len(exempt))
+	for _, route := range exempt {
+		exemptRoutes[route] = true
+	}
+
+	return func(c *gin.Context) {
+		if maintenance == nil || !maintenance.Enabled() {
+			c.Next()
+			return
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if exemptRoutes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", strconv.Itoa(int(maintenance.RetryAfter().Seconds())))
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service is in maintenance mode, writes are temporarily disabled"})
+	}
+}
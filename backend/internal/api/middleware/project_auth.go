@@ -32,7 +32,7 @@ func (pa *ProjectAuthMiddleware) RequireProjectRole(requiredRoles ...models.Proj
 		projectIDStr := c.Param("id")
 		if projectIDStr == "" {
 			// Try to get from query parameters
-			projectIDStr = c.Query("projectId")
+			projectIDStr = c.Query("project_id")
 			if projectIDStr == "" {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Project ID is required"})
 				c.Abort()
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID identifying a request in the logs of every component
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs taken from clients, which end up in every log line
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware returns a middleware that identifies each request, keeping the ID a
+// proxy or client sent or generating one. The ID is echoed in the response and attached to
+// the request context, so database and service logs can be traced back to the request.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(utils.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+	}
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
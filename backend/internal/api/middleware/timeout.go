@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// TimeoutMiddleware returns a middleware that bounds how long a route may take.
+// When the route's timeout passes, the request context is canceled, so queries run
+// with it are aborted, and the client gets a 504 response; anything the handler
+// writes afterwards is discarded. Websocket upgrades are never timed out.
+func TimeoutMiddleware(cfg *config.ServerConfig, logger *utils.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout := cfg.RouteTimeout(c.FullPath())
+		if timeout <= 0 || isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		tw := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx, header: make(http.Header), timeout: timeout}
+		c.Writer = tw
+
+		done := make(chan struct{})
+		panicked := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+				close(done)
+			}()
+			c.Next()
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				tw.timeOut()
+			}
+			// The handler still owns the gin context, so let it return before the context is reused
+			<-done
+		}
+
+		if tw.hasTimedOut() {
+			logger.Warn("Request timed out",
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Duration("timeout", timeout))
+		}
+
+		c.Writer = tw.ResponseWriter
+		select {
+		case p := <-panicked:
+			panic(p)
+		default:
+		}
+	}
+}
+
+// isWebSocketUpgrade reports whether the request asks for a websocket connection
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// timeoutWriter buffers a handler's headers and drops its output once the request has timed out
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx     context.Context
+	timeout time.Duration
+
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	started  bool
+	timedOut bool
+}
+
+// Header returns the handler's headers, which are copied to the response on the first write
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader records the status code to send
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow sends the headers unless the request has timed out
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.startLocked()
+}
+
+// Write sends the handler's output unless the request has timed out
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.startLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString sends the handler's output unless the request has timed out
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Status returns the status code the handler set
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started || w.timedOut {
+		return w.ResponseWriter.Status()
+	}
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Written reports whether the response has been started
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.started || w.timedOut
+}
+
+// Flush flushes the handler's output unless the request has timed out
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.startLocked() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// startLocked sends the handler's headers on its first write and reports whether
+// the handler may write. A handler that fails because its context expired yields
+// the timeout response rather than its own error.
+func (w *timeoutWriter) startLocked() bool {
+	if w.timedOut {
+		return false
+	}
+	if w.started {
+		return true
+	}
+	if errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timeOutLocked()
+		return false
+	}
+
+	target := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		target[key] = values
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	w.ResponseWriter.WriteHeaderNow()
+	w.started = true
+	return true
+}
+
+// hasTimedOut reports whether the timeout response was sent
+func (w *timeoutWriter) hasTimedOut() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.timedOut
+}
+
+// timeOut sends the timeout response unless the handler has started its own response
+func (w *timeoutWriter) timeOut() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		w.timeOutLocked()
+	}
+}
+
+// timeOutLocked writes the 504 response once
+func (w *timeoutWriter) timeOutLocked() {
+	if w.timedOut {
+		return
+	}
+	w.timedOut = true
+
+	body := fmt.Sprintf(`{"error":"Request exceeded the time limit of %s"}`, w.timeout)
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+	_, _ = w.ResponseWriter.Write([]byte(body))
+	w.ResponseWriter.Flush()
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/digital-egiz/backend/internal/api/controllers"
 	"github.com/digital-egiz/backend/internal/api/middleware"
@@ -9,12 +12,20 @@ import (
 	"github.com/digital-egiz/backend/internal/db"
 	"github.com/digital-egiz/backend/internal/services"
 	"github.com/digital-egiz/backend/internal/utils"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
 
+// readinessTimeout bounds the dependency checks done by /readyz
+const readinessTimeout = 2 * time.Second
+
+// Unversioned auth routes under /api are kept as deprecated aliases of /api/v1 for one release
+var (
+	legacyAuthDeprecated = time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+	legacyAuthSunset     = time.Date(2027, time.January, 14, 0, 0, 0, 0, time.UTC)
+)
+
 // Router manages the API routes and controllers
 type Router struct {
 	engine             *gin.Engine
@@ -29,6 +40,7 @@ type Router struct {
 	twinTypeController *controllers.TwinTypeController
 	twinController     *controllers.TwinController
 	historyController  *controllers.HistoryController
+	originMatcher      *middleware.OriginMatcher
 }
 
 // NewRouter creates a new Router instance
@@ -47,18 +59,27 @@ func NewRouter(
 
 	// Use the logger and recovery middleware
 	engine.Use(gin.Recovery())
+	engine.Use(middleware.RequestIDMiddleware())
 	engine.Use(middleware.LoggingMiddleware(logger))
 
-	// Configure CORS
-	corsConfig := cors.DefaultConfig()
-	corsConfig.AllowAllOrigins = true
-	corsConfig.AllowCredentials = true
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Authorization", "Content-Type", "Origin"}
-	engine.Use(cors.New(corsConfig))
+	// Configure CORS; the same origin rules apply to websocket upgrades
+	originMatcher := middleware.NewOriginMatcher(config.Server.AllowedOrigins)
+	engine.Use(middleware.CORSMiddleware(originMatcher))
+
+	// Cancel requests that exceed their route's time limit
+	engine.Use(middleware.TimeoutMiddleware(&config.Server, logger))
+
+	// Pick JSON or MessagePack responses from the Accept header
+	engine.Use(middleware.ResponseFormatMiddleware(&config.Server))
+
+	// Let clients and CDNs cache the responses of routes configured as cacheable
+	engine.Use(middleware.CacheControlMiddleware(&config.Server))
 
 	// Create JWT auth middleware
 	authMiddleware := middleware.NewAuthMiddleware(&config.JWT)
+	if serviceProvider != nil {
+		authMiddleware.SetReplayGuard(serviceProvider.GetTokenReplayGuard())
+	}
 
 	return &Router{
 		engine:          engine,
@@ -67,16 +88,32 @@ func NewRouter(
 		authMiddleware:  authMiddleware,
 		serviceProvider: serviceProvider,
 		db:              db,
+		originMatcher:   originMatcher,
 	}
 }
 
+// maintenanceExemptRoutes stay writable in maintenance mode so admins can sign in and switch it off
+var maintenanceExemptRoutes = []string{
+	"/api/v1/auth/login",
+	"/api/v1/auth/refresh",
+	"/api/auth/login",
+	"/api/auth/refresh",
+	"/api/v1/admin/maintenance",
+}
+
 // SetupRoutes configures all API routes
 func (r *Router) SetupRoutes() {
+	// Reject writes while in maintenance mode
+	r.engine.Use(middleware.MaintenanceMiddleware(r.serviceProvider.GetMaintenanceService(), maintenanceExemptRoutes...))
+
 	// Health check endpoint (no auth required)
 	r.engine.GET("/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	// Readiness endpoint (no auth required)
+	r.engine.GET("/readyz", r.readiness)
+
 	// API version group - all main API routes are under /api/v1
 	r.apiV1 = r.engine.Group("/api/v1")
 
@@ -84,7 +121,19 @@ func (r *Router) SetupRoutes() {
 	userService := services.NewUserService(r.db, r.logger)
 	projectService := services.NewProjectService(r.db, r.logger)
 	twinTypeService := services.NewTwinTypeService(r.db, r.logger)
-	twinService := services.NewTwinService(r.db, r.logger)
+	twinService := services.NewTwinService(r.db, &r.config.Ditto, r.logger)
+	twinService.SetStatusConfig(&r.config.TwinStatus)
+	if policies := r.serviceProvider.GetProjectPolicyService(); policies != nil {
+		projectService.SetPolicyService(policies)
+		twinService.SetPolicyService(policies)
+	}
+	if subscriptions := r.serviceProvider.GetDittoSubscriptions(); subscriptions != nil {
+		projectService.SetDittoSubscriptions(subscriptions)
+	}
+	projectService.SetMLPauseCache(r.serviceProvider.GetMLPauseCache())
+	twinService.SetMLPauseCache(r.serviceProvider.GetMLPauseCache())
+	webhookService := services.NewWebhookService(r.db, r.logger)
+	webhookService.SetAllowPrivateNetworks(r.config.Notifications.WebhookAllowPrivateNetworks)
 	historyService := r.serviceProvider.GetHistoryService()
 
 	// Setup controllers
@@ -94,30 +143,80 @@ func (r *Router) SetupRoutes() {
 	r.twinTypeController = controllers.NewTwinTypeController(twinTypeService, r.logger)
 	r.twinController = controllers.NewTwinController(twinService, r.logger)
 	r.historyController = controllers.NewHistoryController(historyService, r.logger)
+	webhookController := controllers.NewWebhookController(webhookService, projectService, r.logger)
+	notificationController := controllers.NewNotificationController(
+		r.serviceProvider.GetNotificationService(),
+		r.originMatcher.CheckOrigin,
+		r.logger,
+	)
 
 	// Register auth routes (no auth required)
-	authController.RegisterRoutes(r.engine.Group("/api"))
+	authController.RegisterRoutes(r.apiV1)
+
+	// Deprecated unversioned aliases of the auth routes
+	legacyRoutes := r.engine.Group("/api")
+	legacyRoutes.Use(middleware.DeprecationMiddleware(middleware.Deprecation{
+		Since:  legacyAuthDeprecated,
+		Sunset: legacyAuthSunset,
+		Successor: func(path string) string {
+			return "/api/v1" + strings.TrimPrefix(path, "/api")
+		},
+	}))
+	authController.RegisterRoutes(legacyRoutes)
 
 	// Routes that require authentication
 	authorizedRoutes := r.apiV1.Group("")
 	authorizedRoutes.Use(r.authMiddleware.RequireAuth())
+	authorizedRoutes.Use(middleware.AuditMiddleware(r.serviceProvider.GetAuditService()))
 
 	// Register routes that require authentication
 	r.userController.RegisterRoutes(authorizedRoutes)
 	r.projectController.RegisterRoutes(authorizedRoutes)
 	r.twinTypeController.RegisterRoutes(authorizedRoutes)
+	webhookController.RegisterRoutes(authorizedRoutes)
+	controllers.NewDashboardController(services.NewDashboardService(r.db, r.logger), projectService, r.logger).RegisterRoutes(authorizedRoutes)
+	notificationController.RegisterRoutes(authorizedRoutes)
+	controllers.NewNotificationDeliveryController(r.serviceProvider.GetDeliveryService(), projectService, r.logger).RegisterRoutes(authorizedRoutes)
+	controllers.NewAlertRouteController(r.serviceProvider.GetAlertRoutingService(), projectService, r.logger).RegisterRoutes(authorizedRoutes)
+	controllers.NewNotificationHistoryController(r.serviceProvider.GetNotificationHistory(), projectService, r.logger).RegisterRoutes(authorizedRoutes)
+	controllers.NewModelFormatController(r.logger).RegisterRoutes(authorizedRoutes)
+	controllers.NewMLModelController(services.NewMLModelService(r.db, r.logger), r.logger).RegisterRoutes(authorizedRoutes)
 
 	// Group for twin endpoints
 	twinsRoutes := authorizedRoutes.Group("/twins")
 	r.twinController.RegisterRoutes(twinsRoutes)
+	ingestController := controllers.NewIngestController(r.serviceProvider.GetIngestService(), twinService, projectService, r.logger)
+	ingestController.RegisterRoutes(twinsRoutes)
+	controllers.NewMLBackfillController(r.serviceProvider.GetMLBackfillService(), twinService, projectService, r.logger).RegisterRoutes(twinsRoutes)
+	controllers.NewQuarantineController(services.NewQuarantineService(r.db, r.logger), twinService, projectService, r.logger).RegisterRoutes(twinsRoutes)
+	var twinCommands *services.TwinCommandService
+	if dittoManager := r.serviceProvider.GetDittoManager(); dittoManager != nil {
+		twinCommands = services.NewTwinCommandService(dittoManager, r.logger)
+	}
+	controllers.NewTwinCommandController(twinCommands, twinService, projectService, r.logger).RegisterRoutes(twinsRoutes)
 
 	// Register history routes under each twin
 	twinHistoryRoutes := twinsRoutes.Group("/:id/history")
 	r.historyController.RegisterRoutes(twinHistoryRoutes)
+	r.historyController.RegisterTwinRoutes(twinsRoutes)
+	controllers.NewTwinDetailController(
+		services.NewTwinDetailService(twinService, historyService, projectService, r.logger),
+		r.logger,
+	).RegisterRoutes(twinsRoutes)
 
 	// Admin-only routes
 	adminRoutes := authorizedRoutes.Group("/admin")
 	adminRoutes.Use(r.authMiddleware.RequireAdmin())
+	controllers.NewKafkaController(r.serviceProvider.GetKafkaManager(), r.serviceProvider.GetDLQReprocessor(), r.logger).RegisterRoutes(adminRoutes)
+	controllers.NewDittoController(r.serviceProvider.GetDittoManager(), r.serviceProvider.GetKafkaHandler(), r.logger).RegisterRoutes(adminRoutes)
+	r.historyController.RegisterAdminRoutes(adminRoutes)
+	ingestController.RegisterAdminRoutes(adminRoutes)
+	notificationController.RegisterAdminRoutes(adminRoutes)
+	controllers.NewAuditController(r.serviceProvider.GetAuditService(), r.logger).RegisterRoutes(adminRoutes)
+	controllers.NewMaintenanceController(r.serviceProvider.GetMaintenanceService(), r.logger).RegisterRoutes(adminRoutes)
+	controllers.NewFeatureCatalogController(r.serviceProvider.GetFeatureCatalogService(), r.logger).RegisterRoutes(adminRoutes)
+	controllers.NewDatabaseController(r.db.SlowQueries(), r.logger).RegisterRoutes(adminRoutes)
+	controllers.NewWorkerController(r.serviceProvider.GetLifecycle(), r.logger).RegisterRoutes(adminRoutes)
 
 	// Add Swagger documentation if not in production
 	if !r.config.Server.IsProduction() {
@@ -127,6 +226,54 @@ func (r *Router) SetupRoutes() {
 	r.logger.Info("API routes setup completed")
 }
 
+// readiness reports whether the service can handle traffic.
+// By default both reads and ingest are required; "?scope=read" only requires the database,
+// so read-only endpoints stay in rotation while Kafka is unavailable or in maintenance mode.
+func (r *Router) readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := gin.H{"database": "ok", "kafka": "ok"}
+	readReady := true
+	ingestReady := true
+
+	if !r.db.Healthy() || r.db.Ping(ctx) != nil {
+		checks["database"] = "unavailable"
+		readReady = false
+		ingestReady = false
+	}
+
+	if r.serviceProvider == nil || !r.serviceProvider.IsKafkaReady() {
+		checks["kafka"] = "unavailable"
+		ingestReady = false
+	}
+
+	maintenance := r.serviceProvider != nil && r.serviceProvider.GetMaintenanceService().Enabled()
+	if maintenance {
+		ingestReady = false
+	}
+
+	ready := ingestReady
+	if c.Query("scope") == "read" {
+		ready = readReady
+	}
+
+	status := http.StatusOK
+	statusText := "ready"
+	if !ready {
+		status = http.StatusServiceUnavailable
+		statusText = "not_ready"
+	}
+
+	c.JSON(status, gin.H{
+		"status":      statusText,
+		"read":        readReady,
+		"ingest":      ingestReady,
+		"maintenance": maintenance,
+		"checks":      checks,
+	})
+}
+
 // GetEngine returns the Gin engine
 func (r *Router) GetEngine() *gin.Engine {
 	return r.engine
@@ -4,18 +4,28 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration for the application
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Database DatabaseConfig `mapstructure:"database"`
-	Ditto    DittoConfig    `mapstructure:"ditto"`
-	Kafka    KafkaConfig    `mapstructure:"kafka"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Log      LogConfig      `mapstructure:"log"`
+	Server        ServerConfig       `mapstructure:"server"`
+	Database      DatabaseConfig     `mapstructure:"database"`
+	Ditto         DittoConfig        `mapstructure:"ditto"`
+	Kafka         KafkaConfig        `mapstructure:"kafka"`
+	JWT           JWTConfig          `mapstructure:"jwt"`
+	Log           LogConfig          `mapstructure:"log"`
+	Cache         CacheConfig        `mapstructure:"cache"`
+	WebSocket     WebSocketConfig    `mapstructure:"websocket"`
+	Notifications NotificationConfig `mapstructure:"notifications"`
+	Alerts        AlertConfig        `mapstructure:"alerts"`
+	Ingest        IngestConfig       `mapstructure:"ingest"`
+	Audit         AuditConfig        `mapstructure:"audit"`
+	History       HistoryConfig      `mapstructure:"history"`
+	Maintenance   MaintenanceConfig  `mapstructure:"maintenance"`
+	TwinStatus    TwinStatusConfig   `mapstructure:"twin_status"`
 }
 
 // ServerConfig holds server-specific configuration
@@ -26,6 +36,22 @@ type ServerConfig struct {
 	WriteTimeout int    `mapstructure:"write_timeout"`
 	IdleTimeout  int    `mapstructure:"idle_timeout"`
 	Environment  string `mapstructure:"environment"`
+	// AllowedOrigins lists origins allowed for CORS and websocket connections.
+	// Entries may contain "*" wildcards, e.g. "https://*.preview.acme.dev".
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// RequestTimeout bounds how long a request may be handled, in seconds; 0 disables it
+	RequestTimeout int `mapstructure:"request_timeout"`
+	// RouteTimeouts overrides RequestTimeout per route pattern, e.g.
+	// "/api/v1/twins/:id/history/aggregated"; 0 disables the timeout for that route
+	RouteTimeouts map[string]int `mapstructure:"route_timeouts"`
+	// MsgPackEnabled lets clients request MessagePack responses from the history endpoints
+	// with "Accept: application/msgpack"; JSON stays the default
+	MsgPackEnabled bool `mapstructure:"msgpack_enabled"`
+	// CacheControl sets how long successful GET responses may be cached, in seconds, per route
+	// prefix, e.g. "/api/v1/twin-types"; the longest matching prefix applies. 0 lets clients
+	// store responses but revalidate them with their ETag, a negative value forbids storing
+	// them, and routes not listed send no caching headers.
+	CacheControl map[string]int `mapstructure:"cache_control"`
 }
 
 // DatabaseConfig holds database-specific configuration
@@ -37,6 +63,18 @@ type DatabaseConfig struct {
 	DBName   string `mapstructure:"dbname"`
 	SSLMode  string `mapstructure:"sslmode"`
 	TimeZone string `mapstructure:"timezone"`
+	// SpacePartitions adds a twin_id space dimension with this many partitions to the time-series
+	// hypertables, so each twin's data stays within one partition; 0 partitions by time only
+	SpacePartitions int `mapstructure:"space_partitions"`
+	// SlowQueryThreshold is how many milliseconds a statement may take before it is logged
+	// and counted as slow; 0 disables the slow-query log
+	SlowQueryThreshold int `mapstructure:"slow_query_threshold"`
+	// HealthCheckInterval is how many seconds apart the database is pinged; a failed ping marks
+	// it unhealthy in /readyz and drops stale pooled connections. 0 disables health checks
+	HealthCheckInterval int `mapstructure:"health_check_interval"`
+	// StaleRetries is how many times a read query failing on a stale connection, e.g. after a
+	// Postgres restart, is retried on another connection; 0 disables retries
+	StaleRetries int `mapstructure:"stale_retries"`
 }
 
 // DittoConfig holds Eclipse Ditto API configuration
@@ -45,6 +83,55 @@ type DittoConfig struct {
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	APIToken string `mapstructure:"api_token"`
+	// APITokenFile is read for the bearer token of each WebSocket connect instead of APIToken,
+	// so a token rotated on disk is picked up when reconnecting
+	APITokenFile string `mapstructure:"api_token_file"`
+	// TokenRefreshMargin is how many seconds before its token expires the WebSocket connection
+	// is re-established with a fresh token; at most half the token's lifetime is used
+	TokenRefreshMargin int `mapstructure:"token_refresh_margin"`
+	// NamespacePrefix is combined with the project ID to form each project's Ditto namespace
+	NamespacePrefix string `mapstructure:"namespace_prefix"`
+	// WritebackEnabled writes ML predictions to the Ditto feature properties configured on their task bindings
+	WritebackEnabled bool `mapstructure:"writeback_enabled"`
+	// WritebackInterval is the minimum number of seconds between two writes of the same Ditto property
+	WritebackInterval int `mapstructure:"writeback_interval"`
+	// BreakerThreshold is the number of consecutive failed requests after which requests fail fast
+	// with ErrDittoUnavailable; 0 disables the circuit breaker
+	BreakerThreshold int `mapstructure:"breaker_threshold"`
+	// BreakerOpenTimeout is how long requests fail fast before a probe request is let through, in seconds
+	BreakerOpenTimeout int `mapstructure:"breaker_open_timeout"`
+	// PolicySyncEnabled creates the Ditto things of new twins under their project's policy and
+	// rewrites that policy from the project's membership whenever it changes
+	PolicySyncEnabled bool `mapstructure:"policy_sync_enabled"`
+	// PolicySubjectIssuer is the Ditto subject issuer of project members, whose subjects are <issuer>:<user ID>
+	PolicySubjectIssuer string `mapstructure:"policy_subject_issuer"`
+	// PolicyServiceSubject is the subject the backend authenticates to Ditto as; it keeps full access to project policies
+	PolicyServiceSubject string `mapstructure:"policy_service_subject"`
+	// EchoSuppressionWindow is how long, in seconds, events Ditto echoes back for the backend's own
+	// writes are recognised and skipped instead of being processed again; 0 disables suppression
+	EchoSuppressionWindow int `mapstructure:"echo_suppression_window"`
+	// ForwardNamespaces restricts the WebSocket events forwarded to Kafka to things in matching
+	// namespaces, e.g. "org.digitalegiz.*"; empty forwards every namespace
+	ForwardNamespaces []string `mapstructure:"forward_namespaces"`
+	// DropNamespaces lists namespace patterns whose events are never forwarded, even if allowed
+	DropNamespaces []string `mapstructure:"drop_namespaces"`
+	// ForwardKnownTwinsOnly drops events of things not registered as twins, except the creation
+	// of things in project namespaces, which registers them
+	ForwardKnownTwinsOnly bool `mapstructure:"forward_known_twins_only"`
+	// EventDebounce is the window in milliseconds within which a thing's burst of events is
+	// coalesced and applied once; 0 applies every event
+	EventDebounce int `mapstructure:"event_debounce"`
+	// DefinitionHosts lists the hosts WoT Thing Models referenced by thing definitions may be
+	// fetched from, e.g. "models.example.com" or "*.example.com"; empty disables resolution
+	DefinitionHosts []string `mapstructure:"definition_hosts"`
+	// DefinitionRepository is the URL template resolving namespace:name:version definitions,
+	// with {namespace}, {name} and {version} replaced; its host must be a definition host
+	DefinitionRepository string `mapstructure:"definition_repository"`
+	// DefinitionCacheTTL is how long, in seconds, resolved Thing Models are cached
+	DefinitionCacheTTL int `mapstructure:"definition_cache_ttl"`
+	// MaxMessageSize is the largest WebSocket message accepted from Ditto, in bytes. A larger
+	// message is dropped and the connection re-established; 0 applies the 4 MiB default.
+	MaxMessageSize int64 `mapstructure:"max_message_size"`
 }
 
 // KafkaConfig holds Kafka configuration
@@ -54,6 +141,44 @@ type KafkaConfig struct {
 	SecurityEnable bool   `mapstructure:"security_enable"`
 	SecurityUser   string `mapstructure:"security_user"`
 	SecurityPass   string `mapstructure:"security_pass"`
+	// StartupMode is "degraded" (serve HTTP and retry Kafka in the background) or "fail_fast"
+	StartupMode       string `mapstructure:"startup_mode"`
+	ReconnectInterval int    `mapstructure:"reconnect_interval"` // seconds
+	// DLQReplayInterval is how often dead-lettered messages are replayed, in minutes; 0 only
+	// replays on admin request
+	DLQReplayInterval int `mapstructure:"dlq_replay_interval"`
+	// DLQMaxAttempts is how many replays of a dead-lettered message may fail before it is parked
+	DLQMaxAttempts int `mapstructure:"dlq_max_attempts"`
+	// ConsumerCheckInterval is how often consumer health is checked, in seconds; 0 disables the checks
+	ConsumerCheckInterval int `mapstructure:"consumer_check_interval"`
+	// ConsumerFailureThreshold is the number of consecutive failures after which a consumer is failing
+	ConsumerFailureThreshold int `mapstructure:"consumer_failure_threshold"`
+	// ConsumerIdleTimeout is how long a running consumer may go without handling a message
+	// before it is idle, in seconds; 0 never reports consumers as idle
+	ConsumerIdleTimeout int `mapstructure:"consumer_idle_timeout"`
+	// DLQAlertThreshold is the number of messages of a topic dead-lettered within the alert
+	// window that raises a system alert; 0 disables DLQ alerts
+	DLQAlertThreshold int `mapstructure:"dlq_alert_threshold"`
+	// DLQAlertWindow is the sliding window DLQ alerts count messages in, in seconds
+	DLQAlertWindow int `mapstructure:"dlq_alert_window"`
+	// DLQAlertProjects lists the projects whose notification channels are paged with DLQ alerts
+	DLQAlertProjects []uint `mapstructure:"dlq_alert_projects"`
+	// Pipelines tunes the processing pipelines by name, e.g. "timeseries-processor"
+	Pipelines map[string]KafkaPipelineConfig `mapstructure:"pipelines"`
+	// ExtraTopics lists topics pipelines may consume besides the application topics
+	ExtraTopics []string `mapstructure:"extra_topics"`
+}
+
+// KafkaPipelineConfig tunes a processing pipeline, a handler consuming one topic
+type KafkaPipelineConfig struct {
+	// Topic overrides the topic the pipeline consumes
+	Topic string `mapstructure:"topic"`
+	// Group is a consumer group of the pipeline's own; empty joins consumer_group
+	Group string `mapstructure:"group"`
+	// Concurrency is the number of consumers the pipeline runs in its group, 1 if unset
+	Concurrency int `mapstructure:"concurrency"`
+	// DLQ sends messages the handler fails on to the dead-letter topic; unset keeps it enabled
+	DLQ *bool `mapstructure:"dlq"`
 }
 
 // JWTConfig holds JWT authentication configuration
@@ -62,6 +187,199 @@ type JWTConfig struct {
 	ExpirationHours        int    `mapstructure:"expiration_hours"`
 	RefreshSecret          string `mapstructure:"refresh_secret"`
 	RefreshExpirationHours int    `mapstructure:"refresh_expiration_hours"`
+	// ReplayProtection rejects access tokens presented by another client than the one they
+	// were first seen from, across instances: "off", "fingerprint" (same user agent) or
+	// "strict" (same user agent and IP address)
+	ReplayProtection string `mapstructure:"replay_protection"`
+	// ReplayPurgeInterval is how often the sightings of expired tokens are deleted, in minutes
+	ReplayPurgeInterval int `mapstructure:"replay_purge_interval"`
+}
+
+// JWT replay protection modes
+const (
+	JWTReplayOff         = "off"
+	JWTReplayFingerprint = "fingerprint"
+	JWTReplayStrict      = "strict"
+)
+
+// ReplayProtected returns true if tokens are bound to the client they were first seen from
+func (c *JWTConfig) ReplayProtected() bool {
+	return c.ReplayProtection == JWTReplayFingerprint || c.ReplayProtection == JWTReplayStrict
+}
+
+// Kafka startup modes
+const (
+	KafkaStartupDegraded = "degraded"
+	KafkaStartupFailFast = "fail_fast"
+)
+
+// CacheConfig holds configuration for the in-memory history query cache
+type CacheConfig struct {
+	Enabled    bool `mapstructure:"enabled"`
+	TTL        int  `mapstructure:"ttl"` // seconds
+	MaxEntries int  `mapstructure:"max_entries"`
+}
+
+// WebSocketConfig holds limits for notification websocket connections.
+// A limit of 0 means unlimited.
+type WebSocketConfig struct {
+	MaxConnections        int `mapstructure:"max_connections"`
+	MaxConnectionsPerUser int `mapstructure:"max_connections_per_user"`
+	// EvictOldest closes a user's oldest connection instead of rejecting a new one over the per-user limit
+	EvictOldest bool `mapstructure:"evict_oldest"`
+}
+
+// NotificationConfig holds configuration for delivering notifications over webhooks and websockets
+type NotificationConfig struct {
+	// MaxAttempts is how often a delivery is attempted before it is marked permanently failed
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryBaseDelay is the delay before the first retry, in seconds; it doubles with every attempt
+	RetryBaseDelay int `mapstructure:"retry_base_delay"`
+	// RetryMaxDelay caps the delay between retries, in seconds
+	RetryMaxDelay int `mapstructure:"retry_max_delay"`
+	// RetryInterval is how often due retries are looked for, in seconds
+	RetryInterval int `mapstructure:"retry_interval"`
+	// HistoryEnabled keeps real-time notifications for GET /notifications
+	HistoryEnabled bool `mapstructure:"history_enabled"`
+	// HistoryTypes lists the notification types kept; twin updates are usually too frequent
+	HistoryTypes []string `mapstructure:"history_types"`
+	// HistoryBatchSize is the number of notifications written in one insert
+	HistoryBatchSize int `mapstructure:"history_batch_size"`
+	// HistoryFlushInterval is the longest a notification waits to be written, in milliseconds
+	HistoryFlushInterval int `mapstructure:"history_flush_interval"`
+	// HistoryQueueSize bounds the notifications waiting to be written; further ones are dropped
+	// rather than delaying real-time delivery
+	HistoryQueueSize int `mapstructure:"history_queue_size"`
+	// KafkaTopic is the topic project events such as alerts and their acknowledgements are
+	// published to as a delivery channel; empty disables Kafka delivery
+	KafkaTopic string `mapstructure:"kafka_topic"`
+	// WebhookAllowPrivateNetworks lets webhooks reach loopback, private and link-local
+	// addresses, for receivers inside the deployment's own network
+	WebhookAllowPrivateNetworks bool `mapstructure:"webhook_allow_private_networks"`
+}
+
+// AlertConfig holds alert handling configuration
+type AlertConfig struct {
+	// AckNoteRequired lists the severities whose acknowledgement must include a note
+	AckNoteRequired []string `mapstructure:"ack_note_required"`
+	// ContextPoints is the number of latest points of the triggering feature captured on an
+	// alert when it is raised; 0 captures none
+	ContextPoints int `mapstructure:"context_points"`
+	// ContextFeatures lists related features whose latest values are captured on an alert
+	// when it is raised; features a twin does not record are left out
+	ContextFeatures []string `mapstructure:"context_features"`
+}
+
+// HistoryConfig holds limits for history queries
+type HistoryConfig struct {
+	// MaxBuckets caps the buckets one aggregated query may produce; 0 means unlimited
+	MaxBuckets int `mapstructure:"max_buckets"`
+	// MaxConcurrentHeavyQueries caps the expensive history reads (aggregated, export, compare)
+	// in flight at once; further ones are rejected with 503. 0 means unlimited.
+	MaxConcurrentHeavyQueries int `mapstructure:"max_concurrent_heavy_queries"`
+	// HeavyQueryRetryAfter is the Retry-After, in seconds, sent with rejected heavy queries
+	HeavyQueryRetryAfter int `mapstructure:"heavy_query_retry_after"`
+	// MaxFeaturePageSize caps the features returned by one page of a twin's feature listing;
+	// 0 means unlimited
+	MaxFeaturePageSize int `mapstructure:"max_feature_page_size"`
+	// RawRetentionDays and AggregatedRetentionDays are how long raw and aggregated time-series
+	// data are kept for twins whose type or twin sets no retention; 0 keeps the data forever
+	RawRetentionDays        int `mapstructure:"raw_retention_days"`
+	AggregatedRetentionDays int `mapstructure:"aggregated_retention_days"`
+	// RetentionInterval is how often data past its retention is deleted, in minutes; 0 disables it
+	RetentionInterval int `mapstructure:"retention_interval"`
+}
+
+// IngestConfig holds limits for feature values pushed over the HTTP ingest API.
+// A limit of 0 means unlimited.
+type IngestConfig struct {
+	// MaxBatchSize caps the values accepted in one batch request
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+	// MaxFeaturesPerTwin caps the distinct feature paths a twin may record
+	MaxFeaturesPerTwin int `mapstructure:"max_features_per_twin"`
+	// RateLimit caps the values accepted per twin per minute
+	RateLimit int `mapstructure:"rate_limit"`
+	// RollupFlushInterval is how often rolled-up points of ended windows are stored, in seconds;
+	// a window is stored one interval after it ends to include late samples
+	RollupFlushInterval int `mapstructure:"rollup_flush_interval"`
+	// MaxFutureSkew is how far ahead of the server clock a point may be timestamped, in seconds
+	MaxFutureSkew int `mapstructure:"max_future_skew"`
+	// MaxLateness is how far in the past a point may be timestamped, in seconds
+	MaxLateness int `mapstructure:"max_lateness"`
+	// TimestampPolicy handles points outside that window: "accept", "reject" or "clamp".
+	// Projects may override it.
+	TimestampPolicy string `mapstructure:"timestamp_policy"`
+	// TimestampAlertThreshold raises an alert for a twin once this many of its points within a
+	// minute are outside the window; 0 disables the alerts
+	TimestampAlertThreshold int `mapstructure:"timestamp_alert_threshold"`
+	// Transforms normalize the payloads of time-series messages consumed from Kafka into
+	// feature values; the first transform matching a message applies, and messages no
+	// transform matches are stored as received
+	Transforms []IngestTransformConfig `mapstructure:"transforms"`
+}
+
+// IngestTransformConfig maps the payload format of a kind of device onto feature values
+type IngestTransformConfig struct {
+	// Name identifies the transform in logs and errors
+	Name string `mapstructure:"name"`
+	// ProjectID restricts the transform to the twins of a project; 0 matches every project
+	ProjectID uint `mapstructure:"project_id"`
+	// Source restricts the transform to the messages of a connection, by the source they are
+	// tagged with, e.g. "mqtt"; empty matches every source
+	Source string `mapstructure:"source"`
+	// Feature restricts the transform to the messages of a feature; empty matches every feature
+	Feature string `mapstructure:"feature"`
+	// TimePath selects the sample time in the payload, as RFC 3339 or Unix milliseconds;
+	// empty keeps the time of the message
+	TimePath string `mapstructure:"time_path"`
+	// Mappings extract the feature values from the payload
+	Mappings []IngestMappingConfig `mapstructure:"mappings"`
+}
+
+// IngestMappingConfig extracts a feature value from a payload
+type IngestMappingConfig struct {
+	// Path selects the value in the payload, e.g. "$.motor.readings[0].rpm"
+	Path string `mapstructure:"path"`
+	// Feature is the feature path the value is stored under
+	Feature string `mapstructure:"feature"`
+	// Scale and Offset convert numeric values to value*scale+offset; a scale of 0 keeps the value
+	Scale  float64 `mapstructure:"scale"`
+	Offset float64 `mapstructure:"offset"`
+	// Optional skips payloads without the value instead of rejecting them
+	Optional bool `mapstructure:"optional"`
+}
+
+// AuditConfig holds configuration for the hash-chained audit log of mutating API requests
+type AuditConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// RetentionDays is how long entries stay in the database; 0 keeps them forever
+	RetentionDays int `mapstructure:"retention_days"`
+	// RetentionInterval is how often entries past the retention period are archived and deleted, in minutes
+	RetentionInterval int `mapstructure:"retention_interval"`
+	// ArchiveDir receives a signed archive of the entries removed by retention, e.g. a mounted
+	// object storage bucket; if empty, expired entries are deleted without being archived
+	ArchiveDir string `mapstructure:"archive_dir"`
+	// SigningKey is the HMAC-SHA256 key exported and archived audit archives are signed with
+	SigningKey string `mapstructure:"signing_key"`
+}
+
+// MaintenanceConfig holds configuration for maintenance mode, in which writes are rejected and ingest is paused
+type MaintenanceConfig struct {
+	// Enabled starts the service in maintenance mode; it can be toggled at runtime via PUT /admin/maintenance
+	Enabled bool `mapstructure:"enabled"`
+	// RetryAfter is the Retry-After of writes rejected during maintenance, in seconds
+	RetryAfter int `mapstructure:"retry_after"`
+	// PauseDittoForwarding also stops forwarding Ditto WebSocket events to Kafka; events received meanwhile are dropped
+	PauseDittoForwarding bool `mapstructure:"pause_ditto_forwarding"`
+}
+
+// TwinStatusConfig holds configuration for batch twin status queries
+type TwinStatusConfig struct {
+	// MaxTwins caps the twins one status request may cover; 0 means unlimited
+	MaxTwins int `mapstructure:"max_twins"`
+	// StaleAfter is how long, in seconds, a twin may go without recording a point before it is
+	// reported stale; with 0 only twins that never recorded a point are stale
+	StaleAfter int `mapstructure:"stale_after"`
 }
 
 // LogConfig holds logging configuration
@@ -128,6 +446,19 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.write_timeout", 15) // seconds
 	v.SetDefault("server.idle_timeout", 60)  // seconds
 	v.SetDefault("server.environment", "development")
+	v.SetDefault("server.allowed_origins", []string{"http://localhost:3000"})
+	v.SetDefault("server.request_timeout", 10) // seconds
+	// Exports stream for as long as their rows take, so they are never timed out
+	v.SetDefault("server.route_timeouts", map[string]int{
+		"/api/v1/twins/:id/history/export": 0,
+	})
+	v.SetDefault("server.msgpack_enabled", true)
+	v.SetDefault("server.cache_control", map[string]int{
+		"/api/v1/twin-types":    60,
+		"/api/v1/model-formats": 3600,
+		"/api/v1/users/me":      -1,
+		"/swagger":              3600,
+	})
 
 	// Database defaults
 	v.SetDefault("database.host", "localhost")
@@ -136,23 +467,119 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("database.dbname", "digital_egiz")
 	v.SetDefault("database.sslmode", "disable")
 	v.SetDefault("database.timezone", "UTC")
+	v.SetDefault("database.space_partitions", 0)
+	v.SetDefault("database.slow_query_threshold", 500)
+	v.SetDefault("database.health_check_interval", 10)
+	v.SetDefault("database.stale_retries", 2)
 
 	// Ditto defaults
 	v.SetDefault("ditto.url", "http://ditto:8080")
+	v.SetDefault("ditto.namespace_prefix", "org.digitalegiz")
+	v.SetDefault("ditto.writeback_enabled", false)
+	v.SetDefault("ditto.writeback_interval", 5)
+	v.SetDefault("ditto.breaker_threshold", 5)
+	v.SetDefault("ditto.breaker_open_timeout", 30) // seconds
+	v.SetDefault("ditto.policy_sync_enabled", true)
+	v.SetDefault("ditto.policy_subject_issuer", "digital-egiz")
+	v.SetDefault("ditto.policy_service_subject", "nginx:ditto")
+	v.SetDefault("ditto.echo_suppression_window", 30) // seconds
+	v.SetDefault("ditto.forward_namespaces", []string{})
+	v.SetDefault("ditto.drop_namespaces", []string{})
+	v.SetDefault("ditto.forward_known_twins_only", false)
+	v.SetDefault("ditto.event_debounce", 500) // milliseconds
+	v.SetDefault("ditto.definition_hosts", []string{})
+	v.SetDefault("ditto.definition_repository", "")
+	v.SetDefault("ditto.definition_cache_ttl", 3600) // seconds
+	v.SetDefault("ditto.max_message_size", 4<<20)    // bytes
+	v.SetDefault("ditto.api_token_file", "")
+	v.SetDefault("ditto.token_refresh_margin", 60) // seconds
 
 	// Kafka defaults
 	v.SetDefault("kafka.brokers", "kafka:9092")
 	v.SetDefault("kafka.consumer_group", "digital-egiz")
 	v.SetDefault("kafka.security_enable", false)
+	v.SetDefault("kafka.startup_mode", KafkaStartupDegraded)
+	v.SetDefault("kafka.reconnect_interval", 10) // seconds
+	v.SetDefault("kafka.dlq_replay_interval", 0) // minutes
+	v.SetDefault("kafka.dlq_max_attempts", 5)
+	v.SetDefault("kafka.consumer_check_interval", 60) // seconds
+	v.SetDefault("kafka.consumer_failure_threshold", 5)
+	v.SetDefault("kafka.consumer_idle_timeout", 0) // seconds
+	v.SetDefault("kafka.dlq_alert_threshold", 10)
+	v.SetDefault("kafka.dlq_alert_window", 300) // seconds
+	v.SetDefault("kafka.dlq_alert_projects", []uint{})
 
 	// JWT defaults
 	v.SetDefault("jwt.expiration_hours", 24)
 	v.SetDefault("jwt.refresh_expiration_hours", 168) // 7 days
+	v.SetDefault("jwt.replay_protection", JWTReplayOff)
+	v.SetDefault("jwt.replay_purge_interval", 60) // minutes
 
 	// Log defaults
 	v.SetDefault("log.level", "info")
 	v.SetDefault("log.format", "json")
 	v.SetDefault("log.output_path", "stdout")
+
+	// Cache defaults
+	v.SetDefault("cache.enabled", true)
+	v.SetDefault("cache.ttl", 60) // seconds
+	v.SetDefault("cache.max_entries", 1000)
+
+	// WebSocket defaults
+	v.SetDefault("websocket.max_connections", 1000)
+	v.SetDefault("websocket.max_connections_per_user", 10)
+	v.SetDefault("websocket.evict_oldest", false)
+
+	// Notification defaults
+	v.SetDefault("notifications.max_attempts", 5)
+	v.SetDefault("notifications.retry_base_delay", 30) // seconds
+	v.SetDefault("notifications.retry_max_delay", 3600)
+	v.SetDefault("notifications.retry_interval", 15)
+	v.SetDefault("notifications.history_enabled", true)
+	v.SetDefault("notifications.history_types", []string{"alert", "ml_prediction", "system_event"})
+	v.SetDefault("notifications.history_batch_size", 100)
+	v.SetDefault("notifications.history_flush_interval", 1000) // milliseconds
+	v.SetDefault("notifications.history_queue_size", 10000)
+	v.SetDefault("notifications.kafka_topic", "")
+	v.SetDefault("notifications.webhook_allow_private_networks", false)
+
+	// Alert defaults
+	v.SetDefault("alerts.ack_note_required", []string{"critical", "error"})
+	v.SetDefault("alerts.context_points", 10)
+	v.SetDefault("alerts.context_features", []string{})
+
+	// History defaults
+	v.SetDefault("history.max_buckets", 10000)
+	v.SetDefault("history.max_concurrent_heavy_queries", 8)
+	v.SetDefault("history.heavy_query_retry_after", 5) // seconds
+	v.SetDefault("history.max_feature_page_size", 500)
+	v.SetDefault("history.raw_retention_days", 0)
+	v.SetDefault("history.aggregated_retention_days", 0)
+	v.SetDefault("history.retention_interval", 60) // minutes
+
+	// Ingest defaults
+	v.SetDefault("ingest.max_batch_size", 1000)
+	v.SetDefault("ingest.max_features_per_twin", 200)
+	v.SetDefault("ingest.rate_limit", 6000)         // values per twin per minute
+	v.SetDefault("ingest.rollup_flush_interval", 5) // seconds
+	v.SetDefault("ingest.max_future_skew", 300)     // seconds
+	v.SetDefault("ingest.max_lateness", 604800)     // seconds (7 days)
+	v.SetDefault("ingest.timestamp_policy", "accept")
+	v.SetDefault("ingest.timestamp_alert_threshold", 0)
+
+	// Maintenance defaults
+	v.SetDefault("maintenance.enabled", false)
+	v.SetDefault("maintenance.retry_after", 300) // seconds
+	v.SetDefault("maintenance.pause_ditto_forwarding", false)
+
+	// Twin status defaults
+	v.SetDefault("twin_status.max_twins", 500)
+	v.SetDefault("twin_status.stale_after", 900) // seconds
+
+	// Audit defaults
+	v.SetDefault("audit.enabled", true)
+	v.SetDefault("audit.retention_days", 365)
+	v.SetDefault("audit.retention_interval", 60) // minutes
 }
 
 // validateConfig validates the configuration
@@ -176,6 +603,35 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	switch config.JWT.ReplayProtection {
+	case JWTReplayOff, JWTReplayFingerprint, JWTReplayStrict:
+	default:
+		return fmt.Errorf("invalid JWT replay protection mode: %s", config.JWT.ReplayProtection)
+	}
+
+	if config.Audit.Enabled && config.Audit.SigningKey == "" {
+		// In development mode, set a default signing key
+		if config.Server.Environment == "development" {
+			config.Audit.SigningKey = "development-audit-signing-key-change-in-production"
+		} else {
+			return fmt.Errorf("audit signing key is required in non-development environments")
+		}
+	}
+
+	// Allowing every origin is only acceptable outside production
+	if config.Server.IsProduction() {
+		for _, origin := range config.Server.AllowedOrigins {
+			if strings.TrimSpace(origin) == "*" {
+				return fmt.Errorf("wildcard-only allowed origin \"*\" is not permitted in production")
+			}
+		}
+	}
+
+	// Validate Kafka startup mode
+	if config.Kafka.StartupMode != KafkaStartupDegraded && config.Kafka.StartupMode != KafkaStartupFailFast {
+		return fmt.Errorf("invalid Kafka startup mode: %s", config.Kafka.StartupMode)
+	}
+
 	// Validate database password is set
 	if config.Database.Password == "" {
 		// Check if it's available in environment variable
@@ -198,11 +654,46 @@ func (c *DatabaseConfig) GetDSN() string {
 		c.Host, c.Port, c.User, c.Password, c.DBName, c.SSLMode, c.TimeZone)
 }
 
+// FailFast returns true if the service should exit when Kafka is unavailable at startup
+func (c *KafkaConfig) FailFast() bool {
+	return c.StartupMode == KafkaStartupFailFast
+}
+
 // IsProduction returns true if the environment is production
 func (c *ServerConfig) IsProduction() bool {
 	return c.Environment == "production"
 }
 
+// RouteTimeout returns the request timeout for a route pattern; zero means no timeout
+func (c *ServerConfig) RouteTimeout(route string) time.Duration {
+	seconds := c.RequestTimeout
+	if override, ok := c.RouteTimeouts[strings.ToLower(route)]; ok {
+		seconds = override
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// RouteCacheControl returns the cache lifetime in seconds configured for a route pattern by
+// its longest matching prefix, and whether one is configured
+func (c *ServerConfig) RouteCacheControl(route string) (int, bool) {
+	route = strings.ToLower(route)
+	matched := ""
+	maxAge, ok := 0, false
+	for prefix, seconds := range c.CacheControl {
+		prefix = strings.TrimSuffix(strings.ToLower(prefix), "/")
+		if route != prefix && !strings.HasPrefix(route, prefix+"/") {
+			continue
+		}
+		if !ok || len(prefix) > len(matched) {
+			matched, maxAge, ok = prefix, seconds, true
+		}
+	}
+	return maxAge, ok
+}
+
 // IsDevelopment returns true if the environment is development
 func (c *ServerConfig) IsDevelopment() bool {
 	return c.Environment == "development"
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -13,11 +14,16 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// maxIdleConns is the number of idle connections kept in the pool
+const maxIdleConns = 10
+
 // Database wraps a GORM DB connection with additional functionality
 type Database struct {
 	*gorm.DB
-	logger *utils.Logger
-	config *config.DatabaseConfig
+	logger      *utils.Logger
+	config      *config.DatabaseConfig
+	slowQueries *SlowQueryLog
+	health      *HealthChecker
 }
 
 // NewDatabase creates a new database connection
@@ -28,7 +34,8 @@ func NewDatabase(cfg *config.DatabaseConfig, log *utils.Logger) (*Database, erro
 	gormLogger := logger.New(
 		&logAdapter{logger: dbLogger},
 		logger.Config{
-			SlowThreshold:             1 * time.Second,
+			// Slow statements are reported by the slow-query log instead
+			SlowThreshold:             0,
 			LogLevel:                  logger.Warn,
 			IgnoreRecordNotFoundError: true,
 			Colorful:                  false,
@@ -62,7 +69,7 @@ func NewDatabase(cfg *config.DatabaseConfig, log *utils.Logger) (*Database, erro
 		return nil, fmt.Errorf("failed to get sql.DB instance: %w", err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxIdleConns(maxIdleConns)
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
@@ -73,6 +80,23 @@ func NewDatabase(cfg *config.DatabaseConfig, log *utils.Logger) (*Database, erro
 		config: cfg,
 	}
 
+	if cfg.SlowQueryThreshold > 0 {
+		database.slowQueries = NewSlowQueryLog(time.Duration(cfg.SlowQueryThreshold)*time.Millisecond, dbLogger)
+		if err := database.slowQueries.Register(db); err != nil {
+			return nil, fmt.Errorf("failed to register slow-query log: %w", err)
+		}
+	}
+
+	if cfg.StaleRetries > 0 {
+		if err := RegisterStaleRetry(db, cfg.StaleRetries, dbLogger); err != nil {
+			return nil, fmt.Errorf("failed to register stale connection retry: %w", err)
+		}
+	}
+
+	if cfg.HealthCheckInterval > 0 {
+		database.health = NewHealthChecker(sqlDB, time.Duration(cfg.HealthCheckInterval)*time.Second, maxIdleConns, dbLogger)
+	}
+
 	// Verify connection
 	if err := database.VerifyConnection(); err != nil {
 		return nil, err
@@ -81,6 +105,30 @@ func NewDatabase(cfg *config.DatabaseConfig, log *utils.Logger) (*Database, erro
 	return database, nil
 }
 
+// SlowQueries returns the slow-query log, or nil if it is disabled
+func (db *Database) SlowQueries() *SlowQueryLog {
+	return db.slowQueries
+}
+
+// StartHealthCheck pings the database in the background until the context is cancelled,
+// unless health checks are disabled
+func (db *Database) StartHealthCheck(ctx context.Context) {
+	if db.health != nil {
+		go db.health.Run(ctx)
+	}
+}
+
+// Health returns the health checker, or nil if health checks are disabled
+func (db *Database) Health() *HealthChecker {
+	return db.health
+}
+
+// Healthy returns whether the last health check reached the database; without health
+// checks the database is assumed healthy
+func (db *Database) Healthy() bool {
+	return db.health == nil || db.health.Healthy()
+}
+
 // VerifyConnection checks if the database connection is working
 func (db *Database) VerifyConnection() error {
 	sqlDB, err := db.DB.DB()
@@ -96,6 +144,16 @@ func (db *Database) VerifyConnection() error {
 	return nil
 }
 
+// Ping checks the database connection without logging, for use by health probes
+func (db *Database) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get sql.DB instance: %w", err)
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
 // AutoMigrate runs auto migration for the given models
 func (db *Database) AutoMigrate() error {
 	db.logger.Info("Running auto migrations")
@@ -113,18 +171,32 @@ func (db *Database) AutoMigrate() error {
 	// Auto migrate models
 	if err := db.DB.AutoMigrate(
 		&models.User{},
+		&models.TokenSighting{},
 		&models.Project{},
 		&models.TwinType{},
 		&models.Twin{},
 		&models.TwinModel3D{},
 		&models.DataBinding3D{},
+		&models.FeatureBinding{},
+		&models.IngestSequence{},
 		&models.TimeseriesData{},
 		&models.AggregatedData{},
+		&models.FeatureCatalogEntry{},
+		&models.QuarantinedPoint{},
 		&models.AlertData{},
 		&models.MLPredictionData{},
 		&models.MLTask{},
 		&models.MLTaskBinding{},
 		&models.MLModelMetadata{},
+		&models.MLBackfillJob{},
+		&models.WebhookSubscription{},
+		&models.AuditEntry{},
+		&models.Notification{},
+		&models.NotificationDelivery{},
+		&models.NotificationRecord{},
+		&models.AlertRoute{},
+		&models.DashboardLayout{},
+		&models.AttributeChange{},
 	); err != nil {
 		return fmt.Errorf("failed to auto migrate models: %w", err)
 	}
@@ -177,6 +249,33 @@ func (db *Database) CreateHypertables() error {
 		}
 	}
 
+	return db.addSpacePartitions()
+}
+
+// spacePartitionedTables are the hypertables whose primary key includes twin_id, so they can
+// be space-partitioned by it; alert_data is keyed by alert ID and stays time-partitioned only
+var spacePartitionedTables = []string{
+	"timeseries_data",
+	"aggregated_data",
+	"ml_prediction_data",
+}
+
+// addSpacePartitions adds the configured twin_id space dimension to the hypertables that lack it.
+// twin_id holds the normalized thing ID that is also the Kafka message key, so a twin's points
+// share a partition in both. Already existing chunks keep their partitioning.
+func (db *Database) addSpacePartitions() error {
+	if db.config == nil || db.config.SpacePartitions <= 0 {
+		return nil
+	}
+
+	for _, table := range spacePartitionedTables {
+		if err := db.DB.Exec("SELECT add_dimension(?::regclass, 'twin_id', number_partitions => ?, if_not_exists => TRUE);",
+			table, db.config.SpacePartitions).Error; err != nil {
+			return fmt.Errorf("failed to add space partitioning to %s: %w", table, err)
+		}
+	}
+	db.logger.Info("Space partitioning hypertables by twin ID", zap.Int("partitions", db.config.SpacePartitions))
+
 	return nil
 }
 
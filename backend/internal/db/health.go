@@ -0,0 +1,206 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ConnectionPool is the part of *sql.DB the health checker pings and resets
+type ConnectionPool interface {
+	PingContext(ctx context.Context) error
+	SetMaxIdleConns(n int)
+}
+
+// HealthStatus describes the database connectivity last seen by the health checker
+type HealthStatus struct {
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+	// UnhealthySince is when the current outage was first seen
+	UnhealthySince *time.Time `json:"unhealthy_since,omitempty"`
+	// Reconnects counts the outages recovered from
+	Reconnects int64 `json:"reconnects"`
+}
+
+// HealthChecker pings the database periodically. When a ping fails the database is marked
+// unhealthy and the pool's idle connections, which may have gone stale when Postgres
+// restarted, are dropped so the next ping and queries dial fresh ones.
+type HealthChecker struct {
+	pool         ConnectionPool
+	interval     time.Duration
+	maxIdleConns int
+	logger       *utils.Logger
+
+	mu     sync.Mutex
+	status HealthStatus
+}
+
+// NewHealthChecker creates a health checker pinging the pool every interval. maxIdleConns is
+// the pool's idle connection limit, restored after idle connections are dropped.
+func NewHealthChecker(pool ConnectionPool, interval time.Duration, maxIdleConns int, logger *utils.Logger) *HealthChecker {
+	return &HealthChecker{
+		pool:         pool,
+		interval:     interval,
+		maxIdleConns: maxIdleConns,
+		logger:       logger.Named("db_health"),
+		status:       HealthStatus{Healthy: true},
+	}
+}
+
+// Run checks the database every interval until the context is cancelled
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.Check(ctx)
+		}
+	}
+}
+
+// Check pings the database, reconnecting if the ping fails, and returns whether it is healthy
+func (h *HealthChecker) Check(ctx context.Context) bool {
+	err := h.ping(ctx)
+	if err != nil {
+		h.markUnhealthy(err)
+
+		// Drop the idle connections and try again on a fresh one
+		h.pool.SetMaxIdleConns(0)
+		h.pool.SetMaxIdleConns(h.maxIdleConns)
+		if err = h.ping(ctx); err != nil {
+			h.logger.Warn("Failed to re-establish database connectivity", zap.Error(err))
+			return false
+		}
+	}
+
+	h.markHealthy()
+	return true
+}
+
+// Healthy returns whether the last check reached the database
+func (h *HealthChecker) Healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.status.Healthy
+}
+
+// Status returns the outcome of the last check
+func (h *HealthChecker) Status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := h.status
+	if status.UnhealthySince != nil {
+		since := *status.UnhealthySince
+		status.UnhealthySince = &since
+	}
+	return status
+}
+
+// ping pings the database, giving up after the check interval
+func (h *HealthChecker) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, h.interval)
+	defer cancel()
+	return h.pool.PingContext(ctx)
+}
+
+// markUnhealthy records a failed ping, logging the start of an outage
+func (h *HealthChecker) markUnhealthy(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.status.LastCheck = now
+	h.status.LastError = err.Error()
+	if h.status.Healthy {
+		h.status.Healthy = false
+		h.status.UnhealthySince = &now
+		h.logger.Warn("Database unreachable, reconnecting", zap.Error(err))
+	}
+}
+
+// markHealthy records a successful ping, logging the end of an outage
+func (h *HealthChecker) markHealthy() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	h.status.LastCheck = now
+	if !h.status.Healthy {
+		h.status.Reconnects++
+		h.logger.Info("Database connectivity re-established",
+			zap.Duration("outage", now.Sub(*h.status.UnhealthySince)))
+	}
+	h.status.Healthy = true
+	h.status.LastError = ""
+	h.status.UnhealthySince = nil
+}
+
+// IsStaleConnection reports whether an error comes from a pooled connection the server has
+// closed, e.g. after a restart, so the statement can be retried on another connection
+func IsStaleConnection(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, stale := range []string{
+		"connection reset by peer",
+		"broken pipe",
+		"conn closed",
+		"unexpected eof",
+		// Postgres terminates sessions with SQLSTATE 57P01 when shut down
+		"sqlstate 57p01",
+		"terminating connection due to administrator command",
+	} {
+		if strings.Contains(message, stale) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterStaleRetry retries read queries failing on a stale connection up to attempts times,
+// each time on another pooled connection. Queries inside a transaction are not retried as
+// their connection is gone with it.
+func RegisterStaleRetry(gdb *gorm.DB, attempts int, logger *utils.Logger) error {
+	query := gdb.Callback().Query()
+	runQuery := query.Get("gorm:query")
+	if runQuery == nil {
+		return errors.New("gorm:query callback not registered")
+	}
+	logger = logger.Named("stale_retry")
+
+	return query.Replace("gorm:query", func(db *gorm.DB) {
+		runQuery(db)
+		if _, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+			return
+		}
+		for attempt := 1; attempt <= attempts && IsStaleConnection(db.Error); attempt++ {
+			logger.Warn("Retrying query after a stale connection",
+				zap.Int("attempt", attempt),
+				zap.String("table", db.Statement.Table),
+				zap.Error(db.Error))
+			db.Error = nil
+			db.RowsAffected = 0
+			runQuery(db)
+		}
+	})
+}
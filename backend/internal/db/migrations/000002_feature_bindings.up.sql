@@ -0,0 +1,13 @@
+-- Per-feature ingestion settings
+CREATE TABLE feature_bindings (
+    id SERIAL PRIMARY KEY,
+    twin_id INTEGER NOT NULL REFERENCES twins(id),
+    feature_path VARCHAR(255) NOT NULL,
+    array_mode VARCHAR(20) NOT NULL DEFAULT 'expand',
+    array_time_field VARCHAR(100) NOT NULL DEFAULT 'time',
+    array_value_field VARCHAR(100) NOT NULL DEFAULT 'value',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_feature_bindings_twin_feature ON feature_bindings(twin_id, feature_path);
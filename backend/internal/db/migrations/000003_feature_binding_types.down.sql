@@ -0,0 +1,5 @@
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS type_violations,
+    DROP COLUMN IF EXISTS violation_alert_threshold,
+    DROP COLUMN IF EXISTS type_violation_mode,
+    DROP COLUMN IF EXISTS expected_type;
@@ -0,0 +1,6 @@
+-- Expected value types and type violation handling for feature bindings
+ALTER TABLE feature_bindings
+    ADD COLUMN expected_type VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN type_violation_mode VARCHAR(20) NOT NULL DEFAULT 'error',
+    ADD COLUMN violation_alert_threshold INTEGER NOT NULL DEFAULT 10,
+    ADD COLUMN type_violations BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,16 @@
+-- Project webhook subscriptions
+CREATE TABLE webhook_subscriptions (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id),
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    event_types TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_webhook_subscriptions_project_id ON webhook_subscriptions(project_id);
+CREATE INDEX idx_webhook_subscriptions_deleted_at ON webhook_subscriptions(deleted_at);
@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS idx_timeseries_twin_feature ON timeseries_data(twin_id, feature_path);
+CREATE INDEX IF NOT EXISTS idx_alert_twin ON alert_data(twin_id);
+CREATE INDEX IF NOT EXISTS idx_ml_prediction_twin ON ml_prediction_data(twin_id);
+
+DROP INDEX IF EXISTS idx_alert_twin_time_severity;
+DROP INDEX IF EXISTS idx_ml_prediction_twin_task_time;
+DROP INDEX IF EXISTS idx_timeseries_twin_feature_time;
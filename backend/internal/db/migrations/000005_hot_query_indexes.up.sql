@@ -0,0 +1,25 @@
+-- Composite indexes for the hot history and state queries.
+-- Each index matches the equality filters followed by the time range / ordering
+-- of the queries below. Do not drop them without checking these endpoints.
+--
+-- idx_timeseries_twin_feature_time (twin_id, feature_path, time DESC)
+--   GET /api/v1/twins/:id/history/timeseries         TimeseriesRepository.GetTimeseriesData
+--   GET /api/v1/twins/:id/history/timeseries/latest  TimeseriesRepository.GetLatestTimeseriesData
+--   GET /api/v1/twins/:id/history/aggregated         on-the-fly aggregation in GetAggregatedTimeseriesData
+--   (also used by DeleteTimeseriesData)
+--
+-- idx_ml_prediction_twin_task_time (twin_id, task_id, time DESC)
+--   GET /api/v1/twins/:id/history/ml-predictions         TimeseriesRepository.GetMLPredictionData
+--   GET /api/v1/twins/:id/history/ml-predictions/latest  TimeseriesRepository.GetLatestMLPrediction
+--
+-- idx_alert_twin_time_severity (twin_id, time DESC, severity)
+--   GET /api/v1/twins/:id/history/alerts  TimeseriesRepository.GetAlertData (optional severity filter)
+
+CREATE INDEX IF NOT EXISTS idx_timeseries_twin_feature_time ON timeseries_data(twin_id, feature_path, time DESC);
+CREATE INDEX IF NOT EXISTS idx_ml_prediction_twin_task_time ON ml_prediction_data(twin_id, task_id, time DESC);
+CREATE INDEX IF NOT EXISTS idx_alert_twin_time_severity ON alert_data(twin_id, time DESC, severity);
+
+-- Superseded by the composite indexes above (they are prefixes of them)
+DROP INDEX IF EXISTS idx_timeseries_twin_feature;
+DROP INDEX IF EXISTS idx_alert_twin;
+DROP INDEX IF EXISTS idx_ml_prediction_twin;
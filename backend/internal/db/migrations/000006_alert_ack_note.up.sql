@@ -0,0 +1,3 @@
+-- Reason recorded when an alert is acknowledged
+ALTER TABLE alert_data
+    ADD COLUMN ack_note TEXT;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_twins_tags;
+
+ALTER TABLE twins
+    DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,6 @@
+-- Free-form twin tags such as "line:A" or "zone:north", stored as a JSON array.
+-- The GIN index serves tag filters on the twin list (tags @> '["line:A"]').
+ALTER TABLE twins
+    ADD COLUMN tags JSONB NOT NULL DEFAULT '[]';
+
+CREATE INDEX idx_twins_tags ON twins USING GIN (tags jsonb_path_ops);
@@ -0,0 +1,3 @@
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS keep_raw_value,
+    DROP COLUMN IF EXISTS precision;
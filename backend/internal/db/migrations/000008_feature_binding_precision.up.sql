@@ -0,0 +1,4 @@
+-- Rounding of numeric feature values before storing, optionally keeping the raw value in value_json
+ALTER TABLE feature_bindings
+    ADD COLUMN precision INTEGER,
+    ADD COLUMN keep_raw_value BOOLEAN NOT NULL DEFAULT FALSE;
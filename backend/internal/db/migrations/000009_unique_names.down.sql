@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_projects_name;
+DROP INDEX IF EXISTS idx_twins_project_name;
@@ -0,0 +1,20 @@
+-- Twin names are unique within a project and project names are unique globally.
+-- Names compare case-insensitively and soft-deleted rows do not count, matching the
+-- checks in TwinService and ProjectService.
+
+-- Rename existing duplicates so the indexes can be built; the oldest row keeps its name
+UPDATE twins t SET name = t.name || ' (' || t.id || ')'
+WHERE t.deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM twins o
+    WHERE o.deleted_at IS NULL AND o.project_id = t.project_id
+      AND LOWER(o.name) = LOWER(t.name) AND o.id < t.id
+);
+
+UPDATE projects p SET name = p.name || ' (' || p.id || ')'
+WHERE p.deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM projects o
+    WHERE o.deleted_at IS NULL AND LOWER(o.name) = LOWER(p.name) AND o.id < p.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_twins_project_name ON twins(project_id, LOWER(name)) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_name ON projects(LOWER(name)) WHERE deleted_at IS NULL;
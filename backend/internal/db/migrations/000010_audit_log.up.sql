@@ -0,0 +1,16 @@
+-- Hash-chained audit log of mutating API requests.
+-- prev_hash is unique so concurrent writers cannot fork the chain.
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    time TIMESTAMP WITH TIME ZONE NOT NULL,
+    user_id INTEGER,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    client_ip VARCHAR(64) NOT NULL DEFAULT '',
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX idx_audit_log_time ON audit_log(time);
+CREATE UNIQUE INDEX idx_audit_log_prev_hash ON audit_log(prev_hash);
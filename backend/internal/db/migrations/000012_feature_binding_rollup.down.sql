@@ -0,0 +1,3 @@
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS rollup_keep_last,
+    DROP COLUMN IF EXISTS rollup_window;
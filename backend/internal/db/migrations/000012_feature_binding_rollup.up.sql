@@ -0,0 +1,4 @@
+-- Ingest-time rollup of numeric feature samples into one point per window
+ALTER TABLE feature_bindings
+    ADD COLUMN rollup_window INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN rollup_keep_last BOOLEAN NOT NULL DEFAULT FALSE;
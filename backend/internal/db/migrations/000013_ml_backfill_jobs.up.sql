@@ -0,0 +1,18 @@
+-- Jobs re-sending historical feature values of a twin to an ML task
+CREATE TABLE ml_backfill_jobs (
+    id SERIAL PRIMARY KEY,
+    twin_id INTEGER NOT NULL REFERENCES twins(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES ml_tasks(id) ON DELETE CASCADE,
+    binding_id INTEGER NOT NULL,
+    start TIMESTAMP WITH TIME ZONE NOT NULL,
+    "end" TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    produced BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_by INTEGER REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_ml_backfill_jobs_twin_id ON ml_backfill_jobs(twin_id);
@@ -0,0 +1,2 @@
+-- Per-project policy for ingested points timestamped too far in the future or the past
+ALTER TABLE projects ADD COLUMN timestamp_policy VARCHAR(20) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- Named dashboard layouts of a project, shared (user_id 0) or personal to one member
+CREATE TABLE dashboard_layouts (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL DEFAULT 0,
+    name VARCHAR(100) NOT NULL,
+    layout JSONB NOT NULL,
+    updated_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_dashboard_layouts_scope_name ON dashboard_layouts(project_id, user_id, name);
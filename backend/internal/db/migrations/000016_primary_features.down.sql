@@ -0,0 +1,5 @@
+ALTER TABLE twins
+    DROP COLUMN IF EXISTS primary_features;
+
+ALTER TABLE twin_types
+    DROP COLUMN IF EXISTS primary_features;
@@ -0,0 +1,7 @@
+-- Features returned by GET /twins/:id/state unless ?all=true is given, stored as JSON arrays.
+-- A twin's own list takes precedence over the list of its type.
+ALTER TABLE twin_types
+    ADD COLUMN primary_features JSONB NOT NULL DEFAULT '[]';
+
+ALTER TABLE twins
+    ADD COLUMN primary_features JSONB NOT NULL DEFAULT '[]';
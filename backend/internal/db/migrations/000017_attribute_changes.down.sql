@@ -0,0 +1 @@
+DROP TABLE IF EXISTS attribute_changes;
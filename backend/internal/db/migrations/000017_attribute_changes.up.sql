@@ -0,0 +1,13 @@
+-- History of Ditto thing attribute changes, one row per changed leaf attribute.
+-- Paths are relative to the thing's attributes, e.g. "firmwareVersion" or "location/lat".
+CREATE TABLE attribute_changes (
+    id SERIAL PRIMARY KEY,
+    twin_id INTEGER NOT NULL REFERENCES twins(id) ON DELETE CASCADE,
+    path VARCHAR(255) NOT NULL,
+    old_value JSONB,
+    new_value JSONB,
+    time TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_attribute_changes_twin_path_time ON attribute_changes (twin_id, path, time);
@@ -0,0 +1,2 @@
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS unit;
@@ -0,0 +1,3 @@
+-- Unit numeric feature values are stored in; time-series queries can convert from it on read
+ALTER TABLE feature_bindings
+    ADD COLUMN unit VARCHAR(20);
@@ -0,0 +1,7 @@
+ALTER TABLE projects
+    DROP COLUMN IF EXISTS ml_paused_until,
+    DROP COLUMN IF EXISTS ml_paused;
+
+ALTER TABLE twins
+    DROP COLUMN IF EXISTS ml_paused_until,
+    DROP COLUMN IF EXISTS ml_paused;
@@ -0,0 +1,9 @@
+-- ML forwarding can be paused per twin or per project, optionally until a given time;
+-- feature values keep being stored while paused
+ALTER TABLE twins
+    ADD COLUMN ml_paused BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN ml_paused_until TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE projects
+    ADD COLUMN ml_paused BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN ml_paused_until TIMESTAMP WITH TIME ZONE;
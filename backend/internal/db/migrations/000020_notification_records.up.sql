@@ -0,0 +1,14 @@
+-- Real-time notifications kept so users can review what they missed, written in batches
+CREATE TABLE notification_records (
+    id BIGSERIAL PRIMARY KEY,
+    project_id INTEGER REFERENCES projects(id) ON DELETE CASCADE,
+    type VARCHAR(32) NOT NULL,
+    topic TEXT NOT NULL DEFAULT '',
+    severity VARCHAR(20) NOT NULL DEFAULT '',
+    payload JSONB,
+    time TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_notification_records_project_id ON notification_records(project_id);
+CREATE INDEX idx_notification_records_type ON notification_records(type);
+CREATE INDEX idx_notification_records_time ON notification_records(time);
@@ -0,0 +1,3 @@
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS calibration_mode,
+    DROP COLUMN IF EXISTS calibrations;
@@ -0,0 +1,4 @@
+-- Calibration periods of numeric features, applied on read or before storing
+ALTER TABLE feature_bindings
+    ADD COLUMN calibrations JSONB NOT NULL DEFAULT '[]',
+    ADD COLUMN calibration_mode VARCHAR(20) DEFAULT 'query';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_alert_active_condition;
+
+ALTER TABLE alert_data
+    DROP COLUMN IF EXISTS occurrence_count,
+    DROP COLUMN IF EXISTS last_seen;
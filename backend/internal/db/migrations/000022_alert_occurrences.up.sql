@@ -0,0 +1,9 @@
+-- Repeated raises of an active alert's condition are counted on the alert
+ALTER TABLE alert_data
+    ADD COLUMN occurrence_count INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN last_seen TIMESTAMP WITH TIME ZONE;
+
+UPDATE alert_data SET last_seen = time;
+
+-- Lookup of the active alert of a condition
+CREATE INDEX idx_alert_active_condition ON alert_data(twin_id, feature_path, severity, source, time DESC) WHERE acknowledged = false;
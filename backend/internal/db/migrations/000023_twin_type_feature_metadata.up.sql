@@ -0,0 +1,3 @@
+-- Display order, grouping and rendering hints of the features of a twin type
+ALTER TABLE twin_types
+    ADD COLUMN feature_metadata JSONB NOT NULL DEFAULT '[]';
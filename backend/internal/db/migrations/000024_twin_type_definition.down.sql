@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_twin_types_definition;
+
+ALTER TABLE twin_types
+    DROP COLUMN IF EXISTS definition;
@@ -0,0 +1,5 @@
+-- Ditto thing definition (Thing Model) a twin type was derived from
+ALTER TABLE twin_types
+    ADD COLUMN definition TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_twin_types_definition ON twin_types (definition);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_ml_prediction_twin_task_type_time;
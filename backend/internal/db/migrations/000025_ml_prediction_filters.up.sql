@@ -0,0 +1,4 @@
+-- Prediction history filtered by type, e.g. the high-score anomalies of a week:
+--   GET /api/v1/twins/:id/history/ml-predictions?prediction_type=anomaly&min_score=0.9
+-- Score and label filters are applied to the rows of the type within the time range.
+CREATE INDEX IF NOT EXISTS idx_ml_prediction_twin_task_type_time ON ml_prediction_data(twin_id, task_id, prediction_type, time DESC);
@@ -0,0 +1,17 @@
+-- Routing of stored alerts to delivery channels, per project or per twin
+CREATE TABLE alert_routes (
+    id SERIAL PRIMARY KEY,
+    project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    twin_id INTEGER REFERENCES twins(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+    severities TEXT NOT NULL DEFAULT '',
+    feature_path VARCHAR(255) NOT NULL DEFAULT '',
+    channel VARCHAR(50) NOT NULL,
+    recipients TEXT NOT NULL DEFAULT '',
+    created_by INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_alert_routes_project_id ON alert_routes(project_id);
+CREATE INDEX idx_alert_routes_twin_id ON alert_routes(twin_id);
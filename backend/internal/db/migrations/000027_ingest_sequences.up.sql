@@ -0,0 +1,8 @@
+-- Last sequence number ingested per twin feature, for devices that resend numbered values
+CREATE TABLE ingest_sequences (
+    twin_id INTEGER NOT NULL REFERENCES twins(id) ON DELETE CASCADE,
+    feature_path VARCHAR(255) NOT NULL,
+    last_sequence BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (twin_id, feature_path)
+);
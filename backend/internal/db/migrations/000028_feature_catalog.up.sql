@@ -0,0 +1,9 @@
+-- Feature paths each twin has time-series data for, with the type and time of the latest point
+CREATE TABLE feature_catalog (
+    twin_id VARCHAR(255) NOT NULL,
+    feature_path VARCHAR(255) NOT NULL,
+    value_type VARCHAR(50) NOT NULL,
+    last_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (twin_id, feature_path)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE twin_types
+    DROP COLUMN IF EXISTS feature_aliases;
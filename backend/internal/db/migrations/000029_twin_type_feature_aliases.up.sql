@@ -0,0 +1,3 @@
+-- Short names the history API accepts in place of the full feature paths of a twin type
+ALTER TABLE twin_types
+    ADD COLUMN feature_aliases JSONB NOT NULL DEFAULT '[]';
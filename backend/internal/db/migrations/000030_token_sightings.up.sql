@@ -0,0 +1,11 @@
+-- Client each access token was first presented by, for JWT replay protection
+CREATE TABLE token_sightings (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    ip VARCHAR(64) NOT NULL,
+    fingerprint VARCHAR(64) NOT NULL,
+    first_seen TIMESTAMP WITH TIME ZONE NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_token_sightings_expires_at ON token_sightings (expires_at);
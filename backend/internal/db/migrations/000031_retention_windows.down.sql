@@ -0,0 +1,7 @@
+ALTER TABLE twins
+    DROP COLUMN IF EXISTS aggregated_retention_days,
+    DROP COLUMN IF EXISTS raw_retention_days;
+
+ALTER TABLE twin_types
+    DROP COLUMN IF EXISTS aggregated_retention_days,
+    DROP COLUMN IF EXISTS raw_retention_days;
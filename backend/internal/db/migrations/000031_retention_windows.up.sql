@@ -0,0 +1,9 @@
+-- Days the raw and aggregated time-series data of a twin type's twins are kept, and per-twin
+-- overrides; NULL inherits the type's or the global retention, 0 keeps the data forever
+ALTER TABLE twin_types
+    ADD COLUMN raw_retention_days INTEGER,
+    ADD COLUMN aggregated_retention_days INTEGER;
+
+ALTER TABLE twins
+    ADD COLUMN raw_retention_days INTEGER,
+    ADD COLUMN aggregated_retention_days INTEGER;
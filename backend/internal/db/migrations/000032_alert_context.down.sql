@@ -0,0 +1,2 @@
+ALTER TABLE alert_data
+    DROP COLUMN IF EXISTS context;
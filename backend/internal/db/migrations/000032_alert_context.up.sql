@@ -0,0 +1,3 @@
+-- Snapshot of the recent data of the twin captured when an alert is raised
+ALTER TABLE alert_data
+    ADD COLUMN context JSONB;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS quarantined_points;
+
+ALTER TABLE feature_bindings
+    DROP COLUMN IF EXISTS plausible_min,
+    DROP COLUMN IF EXISTS plausible_max,
+    DROP COLUMN IF EXISTS quarantined_points;
@@ -0,0 +1,19 @@
+-- Plausible range of a feature's numeric values; values outside it are quarantined
+ALTER TABLE feature_bindings
+    ADD COLUMN plausible_min DOUBLE PRECISION,
+    ADD COLUMN plausible_max DOUBLE PRECISION,
+    ADD COLUMN quarantined_points BIGINT NOT NULL DEFAULT 0;
+
+-- Points held back from timeseries_data for review
+CREATE TABLE quarantined_points (
+    id BIGSERIAL PRIMARY KEY,
+    time TIMESTAMP WITH TIME ZONE NOT NULL,
+    twin_id VARCHAR(255) NOT NULL,
+    feature_path VARCHAR(255) NOT NULL,
+    value_num DOUBLE PRECISION NOT NULL,
+    source VARCHAR(255),
+    reason TEXT,
+    quarantined_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_quarantined_twin_feature_time ON quarantined_points(twin_id, feature_path, time DESC);
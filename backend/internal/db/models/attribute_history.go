@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// AttributeChange records a change of one Ditto thing attribute of a twin. Nested attributes
+// are stored per leaf, with their path relative to the attributes ("location/lat"). OldValue
+// is null for attributes seen for the first time.
+type AttributeChange struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TwinID    uint      `gorm:"not null;index:idx_attribute_changes_twin_path_time,priority:1" json:"twin_id"`
+	Path      string    `gorm:"not null;index:idx_attribute_changes_twin_path_time,priority:2" json:"path"`
+	OldValue  JSON      `json:"old_value"`
+	NewValue  JSON      `json:"new_value"`
+	Time      time.Time `gorm:"not null;index:idx_attribute_changes_twin_path_time,priority:3" json:"time"`
+	CreatedAt time.Time `json:"created_at"`
+}
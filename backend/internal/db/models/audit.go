@@ -0,0 +1,49 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditEntry records a mutating API request. Entries form a hash chain: each entry's hash
+// covers its fields and the hash of the entry before it, so modifying or removing an entry
+// breaks the chain from that point on.
+type AuditEntry struct {
+	ID       uint      `gorm:"primarykey" json:"id"`
+	Time     time.Time `gorm:"not null;index:idx_audit_log_time" json:"time"`
+	UserID   *uint     `json:"user_id,omitempty"`
+	Method   string    `gorm:"not null" json:"method"`
+	Path     string    `gorm:"not null" json:"path"`
+	Status   int       `gorm:"not null" json:"status"`
+	ClientIP string    `json:"client_ip"`
+	PrevHash string    `gorm:"not null;uniqueIndex:idx_audit_log_prev_hash" json:"prev_hash"`
+	Hash     string    `gorm:"not null" json:"hash"`
+}
+
+// TableName overrides the table name for AuditEntry
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// ComputeHash returns the SHA-256 hash of the entry's fields chained to PrevHash
+func (e *AuditEntry) ComputeHash() string {
+	var userID uint
+	if e.UserID != nil {
+		userID = *e.UserID
+	}
+
+	fields := []string{
+		e.PrevHash,
+		e.Time.UTC().Format(time.RFC3339Nano),
+		strconv.FormatUint(uint64(userID), 10),
+		e.Method,
+		e.Path,
+		strconv.Itoa(e.Status),
+		e.ClientIP,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DashboardLayout is a named widget arrangement of a project, saved for the frontend.
+// The layout is opaque to the backend. A layout with a UserID is that user's own;
+// one without is shared with the whole project.
+type DashboardLayout struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	ProjectID uint      `gorm:"not null;uniqueIndex:idx_dashboard_layouts_scope_name,priority:1" json:"project_id"`
+	UserID    uint      `gorm:"not null;default:0;uniqueIndex:idx_dashboard_layouts_scope_name,priority:2" json:"user_id,omitempty"`
+	Name      string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_dashboard_layouts_scope_name,priority:3" json:"name"`
+	Layout    JSON      `gorm:"type:jsonb;not null" json:"layout,omitempty"`
+	UpdatedBy uint      `json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Personal reports whether the layout belongs to a single user rather than the project
+func (d *DashboardLayout) Personal() bool {
+	return d.UserID != 0
+}
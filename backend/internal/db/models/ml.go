@@ -67,4 +67,31 @@ type MLModelMetadata struct {
 	OutputSchema string    `gorm:"type:jsonb" json:"output_schema"` // JSON schema for outputs
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
-} 
\ No newline at end of file
+} 
+
+// ML backfill job statuses
+const (
+	MLBackfillPending   = "pending"
+	MLBackfillRunning   = "running"
+	MLBackfillCompleted = "completed"
+	MLBackfillFailed    = "failed"
+	MLBackfillCanceled  = "canceled"
+)
+
+// MLBackfillJob re-sends the historical feature values of a twin within a window to an ML task
+type MLBackfillJob struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TwinID    uint      `gorm:"not null;index" json:"twin_id"`
+	TaskID    uint      `gorm:"not null" json:"task_id"`
+	BindingID uint      `gorm:"not null" json:"binding_id"`
+	Start     time.Time `gorm:"not null" json:"start"`
+	End       time.Time `gorm:"not null" json:"end"`
+	Status    string    `gorm:"type:varchar(20);not null" json:"status"`
+	// Produced is the number of values sent to the ML-input topic so far
+	Produced    int64      `gorm:"default:0" json:"produced"`
+	Error       string     `json:"error,omitempty"`
+	CreatedBy   uint       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
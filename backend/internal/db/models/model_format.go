@@ -0,0 +1,81 @@
+package models
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ModelFormat describes a 3D model format the frontend viewer can render
+type ModelFormat struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Extensions []string `json:"extensions"`
+	MIMETypes  []string `json:"mime_types"`
+}
+
+// Supported 3D model format IDs
+const (
+	ModelFormatGLTF = "gltf"
+	ModelFormatGLB  = "glb"
+	ModelFormatOBJ  = "obj"
+	ModelFormatFBX  = "fbx"
+	ModelFormatSTL  = "stl"
+	ModelFormatUSDZ = "usdz"
+)
+
+// SupportedModelFormats lists the accepted 3D model formats
+var SupportedModelFormats = []ModelFormat{
+	{ID: ModelFormatGLTF, Name: "glTF", Extensions: []string{".gltf"}, MIMETypes: []string{"model/gltf+json"}},
+	{ID: ModelFormatGLB, Name: "glTF Binary", Extensions: []string{".glb"}, MIMETypes: []string{"model/gltf-binary"}},
+	{ID: ModelFormatOBJ, Name: "Wavefront OBJ", Extensions: []string{".obj"}, MIMETypes: []string{"model/obj", "text/plain"}},
+	{ID: ModelFormatFBX, Name: "Autodesk FBX", Extensions: []string{".fbx"}, MIMETypes: []string{"application/octet-stream"}},
+	{ID: ModelFormatSTL, Name: "STL", Extensions: []string{".stl"}, MIMETypes: []string{"model/stl", "application/sla"}},
+	{ID: ModelFormatUSDZ, Name: "USDZ", Extensions: []string{".usdz"}, MIMETypes: []string{"model/vnd.usdz+zip"}},
+}
+
+// LookupModelFormat returns the supported format with the given ID (case-insensitive)
+func LookupModelFormat(id string) (ModelFormat, bool) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	for _, format := range SupportedModelFormats {
+		if format.ID == id {
+			return format, true
+		}
+	}
+	return ModelFormat{}, false
+}
+
+// ModelFormatForURL returns the supported format matching the file extension of a model URL
+func ModelFormatForURL(modelURL string) (ModelFormat, bool) {
+	ext := ModelURLExtension(modelURL)
+	if ext == "" {
+		return ModelFormat{}, false
+	}
+
+	for _, format := range SupportedModelFormats {
+		for _, candidate := range format.Extensions {
+			if candidate == ext {
+				return format, true
+			}
+		}
+	}
+	return ModelFormat{}, false
+}
+
+// ModelURLExtension returns the lower-case file extension of a model URL's path, ignoring any query
+func ModelURLExtension(modelURL string) string {
+	p := modelURL
+	if parsed, err := url.Parse(modelURL); err == nil {
+		p = parsed.Path
+	}
+	return strings.ToLower(path.Ext(p))
+}
+
+// SupportedModelFormatIDs returns the IDs of all supported formats
+func SupportedModelFormatIDs() []string {
+	ids := make([]string, len(SupportedModelFormats))
+	for i, format := range SupportedModelFormats {
+		ids[i] = format.ID
+	}
+	return ids
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Notification delivery statuses
+const (
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	DeliveryStatusFailed    = "failed"
+)
+
+// Notification is a project event sent out over the registered delivery channels
+type Notification struct {
+	ID        uint   `gorm:"primarykey" json:"id"`
+	ProjectID uint   `gorm:"not null;index" json:"project_id"`
+	EventType string `gorm:"not null" json:"event_type"`
+	// EventID stays the same across retries so receivers can drop duplicate deliveries
+	EventID   string    `gorm:"not null" json:"event_id"`
+	Payload   JSON      `gorm:"type:jsonb" json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationDelivery is the receipt of a notification for one recipient of a channel
+type NotificationDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	NotificationID uint       `gorm:"not null;index" json:"notification_id"`
+	Channel        string     `gorm:"not null" json:"channel"`
+	Recipient      string     `gorm:"not null" json:"recipient"`
+	Status         string     `gorm:"not null;index" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `gorm:"index" json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Notification *Notification `gorm:"foreignKey:NotificationID" json:"-"`
+}
+
+// NotificationRecord is a real-time notification kept so users can review what they missed
+// while offline
+type NotificationRecord struct {
+	ID uint `gorm:"primarykey" json:"id"`
+	// ProjectID is nil for notifications sent to every client
+	ProjectID *uint     `gorm:"index" json:"project_id,omitempty"`
+	Type      string    `gorm:"type:varchar(32);not null;index" json:"type"`
+	Topic     string    `json:"topic"`
+	Severity  string    `gorm:"type:varchar(20)" json:"severity,omitempty"`
+	Payload   JSON      `gorm:"type:jsonb" json:"payload"`
+	Time      time.Time `gorm:"not null;index" json:"time"`
+}
+
+// AlertRoute sends the stored alerts of a project's twins matching its severities and feature
+// to the recipients of one delivery channel. A route with a TwinID only applies to that twin
+// and takes precedence over the project's routes.
+type AlertRoute struct {
+	ID        uint  `gorm:"primarykey" json:"id"`
+	ProjectID uint  `gorm:"not null;index" json:"project_id"`
+	TwinID    *uint `gorm:"index" json:"twin_id,omitempty"`
+	// Position orders the routes of a scope; the first matching route wins
+	Position int `gorm:"not null;default:0" json:"position"`
+	// Severities is comma-separated; empty matches every severity
+	Severities string `json:"severities"`
+	// FeaturePath matches alerts of that feature, or of features starting with it when it
+	// ends with "*"; empty matches every alert
+	FeaturePath string `json:"feature_path,omitempty"`
+	Channel     string `gorm:"not null" json:"channel"`
+	// Recipients is comma-separated; empty sends to every recipient of the channel
+	Recipients string    `json:"recipients"`
+	CreatedBy  uint      `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Matches reports whether an alert of the given severity and feature is sent along the route
+func (r *AlertRoute) Matches(severity, featurePath string) bool {
+	if r.Severities != "" && !containsListItem(r.Severities, severity) {
+		return false
+	}
+	switch {
+	case r.FeaturePath == "":
+		return true
+	case strings.HasSuffix(r.FeaturePath, "*"):
+		return strings.HasPrefix(featurePath, strings.TrimSuffix(r.FeaturePath, "*"))
+	default:
+		return featurePath == r.FeaturePath
+	}
+}
+
+// RecipientList returns the route's recipients
+func (r *AlertRoute) RecipientList() []string {
+	var recipients []string
+	for _, recipient := range strings.Split(r.Recipients, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+	return recipients
+}
+
+// containsListItem reports whether a comma-separated list contains an item
+func containsListItem(list, item string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		if strings.TrimSpace(candidate) == item {
+			return true
+		}
+	}
+	return false
+}
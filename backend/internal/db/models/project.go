@@ -18,12 +18,28 @@ const (
 	ProjectRoleViewer ProjectRole = "viewer"
 )
 
+// Timestamp policies of a project, applied to ingested points timestamped too far in the
+// future or the past
+const (
+	// TimestampPolicyAccept stores such points as received; they are only counted
+	TimestampPolicyAccept = "accept"
+	// TimestampPolicyReject rejects values with such points
+	TimestampPolicyReject = "reject"
+	// TimestampPolicyClamp moves such points to the nearest edge of the accepted window
+	TimestampPolicyClamp = "clamp"
+)
+
 // Project represents a collection of digital twins and resources
 type Project struct {
 	ID          uint      `gorm:"primarykey" json:"id"`
 	Name        string    `gorm:"not null" json:"name"`
 	Description string    `json:"description"`
 	CreatedBy   uint      `json:"created_by"`
+	// TimestampPolicy overrides the server's policy for out-of-window point timestamps; empty uses the server default
+	TimestampPolicy string    `gorm:"type:varchar(20)" json:"timestamp_policy,omitempty"`
+	// MLPaused stops forwarding the values of the project's twins to ML, until MLPausedUntil if set
+	MLPaused      bool       `gorm:"not null;default:false" json:"ml_paused"`
+	MLPausedUntil *time.Time `json:"ml_paused_until,omitempty"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
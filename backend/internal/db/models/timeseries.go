@@ -4,17 +4,18 @@ import (
 	"time"
 )
 
-// TimeseriesData represents a generic time-series data point
+// TimeseriesData represents a generic time-series data point.
+// History and state queries rely on idx_timeseries_twin_feature_time (see migrations/000005).
 type TimeseriesData struct {
-	Time      time.Time `gorm:"type:timestamptz;primaryKey;not null" json:"time"`
-	TwinID    string    `gorm:"type:varchar(255);primaryKey;not null" json:"twin_id"`
-	FeaturePath string  `gorm:"type:varchar(255);primaryKey;not null" json:"feature_path"`
+	Time      time.Time `gorm:"type:timestamptz;primaryKey;not null;index:idx_timeseries_twin_feature_time,priority:3,sort:desc" json:"time"`
+	TwinID    string    `gorm:"type:varchar(255);primaryKey;not null;index:idx_timeseries_twin_feature_time,priority:1" json:"twin_id"`
+	FeaturePath string  `gorm:"type:varchar(255);primaryKey;not null;index:idx_timeseries_twin_feature_time,priority:2" json:"feature_path"`
 	ValueType string    `gorm:"type:varchar(50);not null" json:"value_type"` // "number", "boolean", "string", "object"
 	ValueNum  float64   `json:"value_num,omitempty"`
 	ValueBool *bool     `json:"value_bool,omitempty"`
 	ValueStr  string    `json:"value_str,omitempty"`
 	ValueJSON string    `gorm:"type:jsonb" json:"value_json,omitempty"`
-	Source    string    `gorm:"type:varchar(255)" json:"source"` // Event source (e.g., "ditto", "simulator")
+	Source    string    `gorm:"type:varchar(255)" json:"source"` // Ingest path the point came from (e.g., "ditto-ws", "http-ingest", "simulator")
 }
 
 // TableName overrides the table name for TimeseriesData
@@ -22,6 +23,25 @@ func (TimeseriesData) TableName() string {
 	return "timeseries_data"
 }
 
+// QuarantinedPoint is a numeric point held back from the time series because its value was
+// outside the plausible range of its feature binding. It is kept for review, and either
+// released into the series or discarded.
+type QuarantinedPoint struct {
+	ID            uint      `gorm:"primarykey" json:"id"`
+	Time          time.Time `gorm:"type:timestamptz;not null;index:idx_quarantined_twin_feature_time,priority:3,sort:desc" json:"time"`
+	TwinID        string    `gorm:"type:varchar(255);not null;index:idx_quarantined_twin_feature_time,priority:1" json:"twin_id"`
+	FeaturePath   string    `gorm:"type:varchar(255);not null;index:idx_quarantined_twin_feature_time,priority:2" json:"feature_path"`
+	ValueNum      float64   `gorm:"not null" json:"value_num"`
+	Source        string    `gorm:"type:varchar(255)" json:"source"`
+	Reason        string    `gorm:"type:text" json:"reason"`
+	QuarantinedAt time.Time `gorm:"type:timestamptz;not null" json:"quarantined_at"`
+}
+
+// TableName overrides the table name for QuarantinedPoint
+func (QuarantinedPoint) TableName() string {
+	return "quarantined_points"
+}
+
 // AggregatedData represents aggregated time-series data
 type AggregatedData struct {
 	TimeInterval   time.Time `gorm:"type:timestamptz;primaryKey;not null" json:"time_interval"`
@@ -42,19 +62,41 @@ func (AggregatedData) TableName() string {
 	return "aggregated_data"
 }
 
-// AlertData represents time-series alert data
+// FeatureCatalogEntry is a feature path a twin has time-series data for, with the type and
+// time of its latest point. It is kept up to date on ingest and can be rebuilt from the data.
+type FeatureCatalogEntry struct {
+	TwinID      string    `gorm:"type:varchar(255);primaryKey;not null" json:"twin_id"`
+	FeaturePath string    `gorm:"type:varchar(255);primaryKey;not null" json:"feature_path"`
+	ValueType   string    `gorm:"type:varchar(50);not null" json:"value_type"`
+	LastSeen    time.Time `gorm:"not null" json:"last_seen"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName overrides the table name for FeatureCatalogEntry
+func (FeatureCatalogEntry) TableName() string {
+	return "feature_catalog"
+}
+
+// AlertData represents time-series alert data.
+// Alert history queries rely on idx_alert_twin_time_severity (see migrations/000005).
 type AlertData struct {
-	Time        time.Time `gorm:"type:timestamptz;primaryKey;not null" json:"time"`
+	Time        time.Time `gorm:"type:timestamptz;primaryKey;not null;index:idx_alert_twin_time_severity,priority:2,sort:desc" json:"time"`
 	AlertID     string    `gorm:"type:varchar(255);primaryKey;not null" json:"alert_id"`
-	TwinID      string    `gorm:"type:varchar(255);not null" json:"twin_id"`
+	TwinID      string    `gorm:"type:varchar(255);not null;index:idx_alert_twin_time_severity,priority:1" json:"twin_id"`
 	FeaturePath string    `gorm:"type:varchar(255)" json:"feature_path,omitempty"`
-	Severity    string    `gorm:"type:varchar(20);not null" json:"severity"` // "info", "warning", "error", "critical"
+	Severity    string    `gorm:"type:varchar(20);not null;index:idx_alert_twin_time_severity,priority:3" json:"severity"` // "info", "warning", "error", "critical"
 	Message     string    `json:"message"`
 	ValueJSON   string    `gorm:"type:jsonb" json:"value_json,omitempty"`
 	Source      string    `gorm:"type:varchar(255)" json:"source"` // Alert source (e.g., "ml", "rule", "manual")
 	Acknowledged bool     `gorm:"default:false" json:"acknowledged"`
 	AckBy       string    `json:"ack_by,omitempty"`
 	AckTime     time.Time `gorm:"type:timestamptz" json:"ack_time,omitempty"`
+	AckNote     string    `gorm:"type:text" json:"ack_note,omitempty"` // Reason given when acknowledging
+	// Times the alert's condition was raised while it was active, and when it last was
+	OccurrenceCount int       `gorm:"not null;default:1" json:"occurrence_count"`
+	LastSeen        time.Time `gorm:"type:timestamptz" json:"last_seen,omitempty"`
+	// Context is a snapshot of the twin's recent data captured when the alert was raised
+	Context JSON `gorm:"type:jsonb" json:"context,omitempty"`
 }
 
 // TableName overrides the table name for AlertData
@@ -62,12 +104,14 @@ func (AlertData) TableName() string {
 	return "alert_data"
 }
 
-// MLPredictionData represents time-series ML prediction data
+// MLPredictionData represents time-series ML prediction data.
+// Prediction queries rely on idx_ml_prediction_twin_task_time (see migrations/000005), and
+// on idx_ml_prediction_twin_task_type_time when filtered by prediction type (000025).
 type MLPredictionData struct {
-	Time       time.Time `gorm:"type:timestamptz;primaryKey;not null" json:"time"`
-	TwinID     string    `gorm:"type:varchar(255);primaryKey;not null" json:"twin_id"`
-	TaskID     string    `gorm:"type:varchar(255);primaryKey;not null" json:"task_id"`
-	PredictionType string `gorm:"type:varchar(50);not null" json:"prediction_type"` // "anomaly", "classification", "regression"
+	Time       time.Time `gorm:"type:timestamptz;primaryKey;not null;index:idx_ml_prediction_twin_task_time,priority:3,sort:desc;index:idx_ml_prediction_twin_task_type_time,priority:4,sort:desc" json:"time"`
+	TwinID     string    `gorm:"type:varchar(255);primaryKey;not null;index:idx_ml_prediction_twin_task_time,priority:1;index:idx_ml_prediction_twin_task_type_time,priority:1" json:"twin_id"`
+	TaskID     string    `gorm:"type:varchar(255);primaryKey;not null;index:idx_ml_prediction_twin_task_time,priority:2;index:idx_ml_prediction_twin_task_type_time,priority:2" json:"task_id"`
+	PredictionType string `gorm:"type:varchar(50);not null;index:idx_ml_prediction_twin_task_type_time,priority:3" json:"prediction_type"` // "anomaly", "classification", "regression"
 	ScoreNum   float64   `json:"score_num,omitempty"`
 	LabelStr   string    `json:"label_str,omitempty"`
 	DetailsJSON string   `gorm:"type:jsonb" json:"details_json,omitempty"`
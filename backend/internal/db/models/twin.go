@@ -11,34 +11,180 @@ import (
 
 // TwinType represents a type of digital twin with a specific schema
 type TwinType struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	Name        string         `gorm:"uniqueIndex;not null" json:"name"`
-	Description string         `json:"description"`
-	Version     string         `gorm:"not null" json:"version"`
-	SchemaJSON  JSON           `gorm:"column:schema_json" json:"schema_json"`
-	CreatedBy   uint           `json:"created_by"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint   `gorm:"primarykey" json:"id"`
+	Name        string `gorm:"uniqueIndex;not null" json:"name"`
+	Description string `json:"description"`
+	Version     string `gorm:"not null" json:"version"`
+	SchemaJSON  JSON   `gorm:"column:schema_json" json:"schema_json"`
+	// Features returned by the twin state endpoint by default; twins may override them
+	PrimaryFeatures StringList `gorm:"type:jsonb;not null;default:'[]'" json:"primary_features"`
+	// How dashboards lay out and render the features of the type's twins
+	FeatureMetadata FeatureMetadataList `gorm:"type:jsonb;not null;default:'[]'" json:"feature_metadata"`
+	// Short names the history API accepts in place of full feature paths
+	FeatureAliases FeatureAliasList `gorm:"type:jsonb;not null;default:'[]'" json:"feature_aliases"`
+	// Days the raw and aggregated time-series data of the type's twins are kept, unless a twin
+	// overrides them; nil uses the global retention and 0 keeps the data forever
+	RawRetentionDays        *int `json:"raw_retention_days"`
+	AggregatedRetentionDays *int `json:"aggregated_retention_days"`
+	// Ditto thing definition the type was derived from, for types created from a Thing Model
+	Definition string         `gorm:"index" json:"definition,omitempty"`
+	CreatedBy  uint           `json:"created_by"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	Twins []Twin `gorm:"foreignKey:TypeID" json:"twins,omitempty"`
 }
 
+// FeatureMetadata describes how a feature is displayed: its position, the group it is shown
+// in, and the icon, unit and expected range gauges are rendered with
+type FeatureMetadata struct {
+	FeaturePath string `json:"feature_path"`
+	// Order positions the feature; lower values come first
+	Order int    `json:"order"`
+	Group string `json:"group,omitempty"`
+	Icon  string `json:"icon,omitempty"`
+	Unit  string `json:"unit,omitempty"`
+	// Min and Max bound the expected range of numeric values
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// FeatureMetadataList is the feature metadata of a twin type, ordered for display and stored
+// as a JSON array
+type FeatureMetadataList []FeatureMetadata
+
+// Value returns the JSON array to be stored in the database
+func (l FeatureMetadataList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]FeatureMetadata(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan scans a JSON array from the database
+func (l *FeatureMetadataList) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*l = FeatureMetadataList{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("invalid scan source for FeatureMetadataList")
+	}
+
+	var metadata []FeatureMetadata
+	if err := json.Unmarshal(bytes, &metadata); err != nil {
+		return err
+	}
+	*l = FeatureMetadataList(metadata)
+	return nil
+}
+
+// MarshalJSON encodes no metadata as [] rather than null
+func (l FeatureMetadataList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]FeatureMetadata(l))
+}
+
+// FeatureAlias maps a short name to the full path of a feature
+type FeatureAlias struct {
+	Alias       string `json:"alias"`
+	FeaturePath string `json:"feature_path"`
+}
+
+// FeatureAliasList is the feature aliases of a twin type, ordered by alias and stored as a
+// JSON array
+type FeatureAliasList []FeatureAlias
+
+// Resolve returns the feature path an alias stands for, or the path itself if it is not an alias
+func (l FeatureAliasList) Resolve(path string) string {
+	for _, alias := range l {
+		if alias.Alias == path {
+			return alias.FeaturePath
+		}
+	}
+	return path
+}
+
+// Value returns the JSON array to be stored in the database
+func (l FeatureAliasList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]FeatureAlias(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan scans a JSON array from the database
+func (l *FeatureAliasList) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*l = FeatureAliasList{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("invalid scan source for FeatureAliasList")
+	}
+
+	var aliases []FeatureAlias
+	if err := json.Unmarshal(bytes, &aliases); err != nil {
+		return err
+	}
+	*l = FeatureAliasList(aliases)
+	return nil
+}
+
+// MarshalJSON encodes no aliases as [] rather than null
+func (l FeatureAliasList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]FeatureAlias(l))
+}
+
 // Twin represents a digital twin instance
 type Twin struct {
-	ID          uint           `gorm:"primarykey" json:"id"`
-	Name        string         `gorm:"not null" json:"name"`
-	Description string         `json:"description"`
-	DittoID     string         `gorm:"uniqueIndex;not null" json:"ditto_id"`
-	TypeID      uint           `gorm:"not null" json:"type_id"`
-	ProjectID   uint           `gorm:"not null" json:"project_id"`
-	ModelURL    string         `json:"model_url"`
-	Metadata    JSON           `json:"metadata"`
-	CreatedBy   uint           `json:"created_by"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID          uint       `gorm:"primarykey" json:"id"`
+	Name        string     `gorm:"not null" json:"name"`
+	Description string     `json:"description"`
+	DittoID     string     `gorm:"uniqueIndex;not null" json:"ditto_id"`
+	TypeID      uint       `gorm:"not null" json:"type_id"`
+	ProjectID   uint       `gorm:"not null" json:"project_id"`
+	ModelURL    string     `json:"model_url"`
+	Metadata    JSON       `json:"metadata"`
+	Tags        StringList `gorm:"type:jsonb;not null;default:'[]'" json:"tags"` // e.g. "line:A", "zone:north"
+	// Features returned by the twin state endpoint by default; empty uses those of the twin type
+	PrimaryFeatures StringList `gorm:"type:jsonb;not null;default:'[]'" json:"primary_features"`
+	// MLPaused stops forwarding the twin's values to ML, until MLPausedUntil if set; values are still stored
+	MLPaused      bool       `gorm:"not null;default:false" json:"ml_paused"`
+	MLPausedUntil *time.Time `json:"ml_paused_until,omitempty"`
+	// Days the twin's raw and aggregated time-series data are kept; nil uses the retention of
+	// the twin type and 0 keeps the data forever
+	RawRetentionDays        *int           `json:"raw_retention_days"`
+	AggregatedRetentionDays *int           `json:"aggregated_retention_days"`
+	CreatedBy               uint           `json:"created_by"`
+	CreatedAt               time.Time      `json:"created_at"`
+	UpdatedAt               time.Time      `json:"updated_at"`
+	DeletedAt               gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
 	Type    TwinType `gorm:"foreignKey:TypeID" json:"type,omitempty"`
@@ -61,6 +207,157 @@ type ModelBinding struct {
 	Twin Twin `gorm:"foreignKey:TwinID" json:"twin,omitempty"`
 }
 
+// Array payload modes for feature bindings
+const (
+	// ArrayModeExpand stores each element of a [{time, value}, ...] payload as its own point
+	ArrayModeExpand = "expand"
+	// ArrayModeObject stores array payloads as a single object-typed point
+	ArrayModeObject = "object"
+)
+
+// Type violation handling modes for feature bindings
+const (
+	// TypeViolationReject fails the whole message so it ends up in the dead-letter queue
+	TypeViolationReject = "reject"
+	// TypeViolationDrop silently skips the off-type point
+	TypeViolationDrop = "drop"
+	// TypeViolationNull stores the point without a value
+	TypeViolationNull = "null"
+	// TypeViolationError stores the original value with value type "error"
+	TypeViolationError = "error"
+)
+
+// Calibration modes for feature bindings
+const (
+	// CalibrationQuery stores values as received and corrects them when they are read
+	CalibrationQuery = "query"
+	// CalibrationIngest stores corrected values, keeping the received value in value_json
+	CalibrationIngest = "ingest"
+)
+
+// Calibration corrects a feature's numeric values from the time it takes effect until the next
+// calibration: corrected = value*Multiplier + Offset
+type Calibration struct {
+	EffectiveFrom time.Time `json:"effective_from"`
+	Offset        float64   `json:"offset"`
+	Multiplier    float64   `json:"multiplier"`
+}
+
+// Calibrations is a feature's calibration periods, ordered by effective time and stored as a JSON array
+type Calibrations []Calibration
+
+// Value returns the JSON array to be stored in the database
+func (c Calibrations) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]Calibration(c))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan scans a JSON array from the database
+func (c *Calibrations) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*c = Calibrations{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("invalid scan source for Calibrations")
+	}
+
+	var calibrations []Calibration
+	if err := json.Unmarshal(bytes, &calibrations); err != nil {
+		return err
+	}
+	*c = Calibrations(calibrations)
+	return nil
+}
+
+// MarshalJSON encodes no calibrations as [] rather than null
+func (c Calibrations) MarshalJSON() ([]byte, error) {
+	if c == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Calibration(c))
+}
+
+// At returns the calibration in effect at a time, false before the first one takes effect
+func (c Calibrations) At(t time.Time) (Calibration, bool) {
+	for i := len(c) - 1; i >= 0; i-- {
+		if !t.Before(c[i].EffectiveFrom) {
+			return c[i], true
+		}
+	}
+	return Calibration{}, false
+}
+
+// Apply corrects a value
+func (c Calibration) Apply(value float64) float64 {
+	return value*c.Multiplier + c.Offset
+}
+
+// FeatureBinding holds ingestion settings for a single feature of a twin
+type FeatureBinding struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	TwinID      uint   `gorm:"not null;uniqueIndex:idx_feature_bindings_twin_feature" json:"twin_id"`
+	FeaturePath string `gorm:"not null;uniqueIndex:idx_feature_bindings_twin_feature" json:"feature_path"`
+	// Array payload schema: how backfill arrays are detected and which fields hold time and value
+	ArrayMode       string `gorm:"type:varchar(20);default:'expand'" json:"array_mode"`
+	ArrayTimeField  string `gorm:"default:'time'" json:"array_time_field"`
+	ArrayValueField string `gorm:"default:'value'" json:"array_value_field"`
+	// Expected value type ("number", "boolean", "string", "object"); empty accepts any type
+	ExpectedType            string    `gorm:"type:varchar(20)" json:"expected_type"`
+	TypeViolationMode       string    `gorm:"type:varchar(20);default:'error'" json:"type_violation_mode"`
+	ViolationAlertThreshold int       `gorm:"default:10" json:"violation_alert_threshold"` // violations per minute
+	TypeViolations          int64     `gorm:"default:0" json:"type_violations"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
+
+	// Decimal places numeric values are rounded to before storing; nil stores them as received.
+	// KeepRawValue stores the unrounded value in value_json alongside the rounded value_num.
+	Precision    *int `json:"precision"`
+	KeepRawValue bool `gorm:"default:false" json:"keep_raw_value"`
+
+	// Seconds of numeric samples stored as one rolled-up point holding their min, max, avg and
+	// count; 0 stores every sample. RollupKeepLast adds the window's latest sample to the rollup.
+	RollupWindow   int  `gorm:"default:0" json:"rollup_window"`
+	RollupKeepLast bool `gorm:"default:false" json:"rollup_keep_last"`
+
+	// Unit numeric values are stored in (e.g. "C", "bar", "m"); queries may convert from it
+	Unit string `gorm:"type:varchar(20)" json:"unit"`
+
+	// Calibration periods correcting numeric values from their effective time, and whether the
+	// correction is applied when values are read ("query") or before they are stored ("ingest")
+	Calibrations    Calibrations `gorm:"type:jsonb;not null;default:'[]'" json:"calibrations"`
+	CalibrationMode string       `gorm:"type:varchar(20);default:'query'" json:"calibration_mode"`
+
+	// Plausible range of numeric values; values outside it are quarantined instead of stored.
+	// Either bound may be unset. QuarantinedPoints counts the values quarantined so far.
+	PlausibleMin      *float64 `json:"plausible_min"`
+	PlausibleMax      *float64 `json:"plausible_max"`
+	QuarantinedPoints int64    `gorm:"default:0" json:"quarantined_points"`
+
+	// Relationships
+	Twin Twin `gorm:"foreignKey:TwinID" json:"twin,omitempty"`
+}
+
+// IngestSequence is the last sequence number ingested for a feature of a twin. Devices that
+// number their values let resent values be dropped instead of stored twice.
+type IngestSequence struct {
+	TwinID       uint      `gorm:"primaryKey;autoIncrement:false" json:"twin_id"`
+	FeaturePath  string    `gorm:"primaryKey" json:"feature_path"`
+	LastSequence uint64    `gorm:"not null" json:"last_sequence"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
 // JSON is a wrapper for json.RawMessage with methods to implement the Scanner and Valuer interfaces
 type JSON json.RawMessage
 
@@ -110,6 +407,52 @@ func (j *JSON) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// StringList is a list of strings stored as a JSON array
+type StringList []string
+
+// Value returns the JSON array to be stored in the database
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan scans a JSON array from the database
+func (l *StringList) Scan(value interface{}) error {
+	var bytes []byte
+	switch v := value.(type) {
+	case nil:
+		*l = StringList{}
+		return nil
+	case []byte:
+		bytes = v
+	case string:
+		bytes = []byte(v)
+	default:
+		return errors.New("invalid scan source for StringList")
+	}
+
+	var list []string
+	if err := json.Unmarshal(bytes, &list); err != nil {
+		return err
+	}
+	*l = StringList(list)
+	return nil
+}
+
+// MarshalJSON encodes an empty list as [] rather than null
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(l))
+}
+
 // DataBinding3D represents a binding between Ditto twin data and 3D model elements
 type DataBinding3D struct {
 	ID              uint      `gorm:"primarykey" json:"id"`
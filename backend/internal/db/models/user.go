@@ -1,7 +1,10 @@
 package models
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -75,6 +78,11 @@ func (u *User) GenerateToken(secretKey string, expirationSec int) (string, error
 		return "", errors.New("empty JWT secret key")
 	}
 
+	tokenID, err := generateTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	expirationTime := time.Now().Add(time.Duration(expirationSec) * time.Second)
 	claims := &Claims{
 		UserID: u.ID,
@@ -84,9 +92,35 @@ func (u *User) GenerateToken(secretKey string, expirationSec int) (string, error
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    "digital-egiz",
+			ID:        tokenID,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(secretKey))
-} 
\ No newline at end of file
+}
+
+// generateTokenID returns a random token ID for the jti claim
+func generateTokenID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// TokenSighting records the client an access token was first presented by, so the token can
+// be rejected when replayed from another client. It is kept until the token expires.
+type TokenSighting struct {
+	JTI         string    `gorm:"column:jti;type:varchar(64);primaryKey" json:"jti"`
+	UserID      uint      `gorm:"not null" json:"user_id"`
+	IP          string    `gorm:"type:varchar(64);not null" json:"ip"`
+	Fingerprint string    `gorm:"type:varchar(64);not null" json:"fingerprint"` // SHA-256 of the user agent
+	FirstSeen   time.Time `gorm:"not null" json:"first_seen"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// TableName overrides the table name for TokenSighting
+func (TokenSighting) TableName() string {
+	return "token_sightings"
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook event types
+const (
+	WebhookEventTwinCreated       = "twin.created"
+	WebhookEventTwinUpdated       = "twin.updated"
+	WebhookEventTwinDeleted       = "twin.deleted"
+	WebhookEventFeatureUpdated    = "feature.updated"
+	WebhookEventAlertCreated      = "alert.created"
+	WebhookEventAlertAcknowledged = "alert.acknowledged"
+	WebhookEventDLQAlert          = "system.dlq_alert"
+)
+
+// WebhookSubscription represents an HTTP endpoint that receives signed project events
+type WebhookSubscription struct {
+	ID         uint           `gorm:"primarykey" json:"id"`
+	ProjectID  uint           `gorm:"not null;index" json:"project_id"`
+	URL        string         `gorm:"not null" json:"url"`
+	Secret     string         `gorm:"not null" json:"-"`
+	EventTypes string         `json:"event_types"` // comma-separated; empty subscribes to all events
+	Active     bool           `gorm:"default:true" json:"active"`
+	CreatedBy  uint           `json:"created_by"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Relationships
+	Project Project `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+}
+
+// Subscribes checks if the subscription receives the given event type
+func (w *WebhookSubscription) Subscribes(eventType string) bool {
+	if w.EventTypes == "" {
+		return true
+	}
+
+	for _, t := range strings.Split(w.EventTypes, ",") {
+		if strings.TrimSpace(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// AttributeHistoryRepository defines operations for the history of twin attribute changes
+type AttributeHistoryRepository interface {
+	Repository
+	InsertChanges(changes []models.AttributeChange) error
+	LatestValues(twinID uint, paths []string) (map[string]models.JSON, error)
+	List(twinID uint, path string, start, end time.Time, limit int) ([]models.AttributeChange, error)
+}
+
+// attributeHistoryRepository implements AttributeHistoryRepository
+type attributeHistoryRepository struct {
+	BaseRepository
+}
+
+// NewAttributeHistoryRepository creates a new attribute history repository
+func NewAttributeHistoryRepository(db *gorm.DB) AttributeHistoryRepository {
+	return &attributeHistoryRepository{
+		BaseRepository: NewBaseRepository(db),
+	}
+}
+
+// InsertChanges stores attribute changes in a single statement
+func (r *attributeHistoryRepository) InsertChanges(changes []models.AttributeChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	return r.handleError(r.GetDB().Create(&changes).Error)
+}
+
+// LatestValues returns the most recently recorded value of each of the twin's attribute
+// paths; paths without history are left out
+func (r *attributeHistoryRepository) LatestValues(twinID uint, paths []string) (map[string]models.JSON, error) {
+	values := make(map[string]models.JSON, len(paths))
+	if len(paths) == 0 {
+		return values, nil
+	}
+
+	// Only the latest change of each path is read, walking the (twin_id, path, time) index
+	// rather than the whole history
+	query := r.GetDB().Model(&models.AttributeChange{}).Where("twin_id = ? AND path IN ?", twinID, paths)
+	if r.GetDB().Dialector.Name() == "postgres" {
+		query = query.Select("DISTINCT ON (path) path, new_value").Order("path, time desc, id desc")
+	} else {
+		query = query.Select("path", "new_value").
+			Where("id = (SELECT latest.id FROM attribute_changes AS latest " +
+				"WHERE latest.twin_id = attribute_changes.twin_id AND latest.path = attribute_changes.path " +
+				"ORDER BY latest.time DESC, latest.id DESC LIMIT 1)")
+	}
+
+	var changes []models.AttributeChange
+	if err := query.Find(&changes).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+
+	for _, change := range changes {
+		values[change.Path] = change.NewValue
+	}
+	return values, nil
+}
+
+// List returns the twin's attribute changes within a time range, newest first. A path
+// matches itself and the attributes nested below it; an empty path matches every attribute.
+func (r *attributeHistoryRepository) List(twinID uint, path string, start, end time.Time, limit int) ([]models.AttributeChange, error) {
+	query := r.GetDB().Where("twin_id = ?", twinID)
+	if path != "" {
+		// substr rather than LIKE, so paths need no escaping
+		prefix := path + "/"
+		query = query.Where("path = ? OR substr(path, 1, ?) = ?", path, len(prefix), prefix)
+	}
+	if !start.IsZero() {
+		query = query.Where("time >= ?", start)
+	}
+	if !end.IsZero() {
+		query = query.Where("time <= ?", end)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var changes []models.AttributeChange
+	if err := query.Order("time desc, id desc").Find(&changes).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+	return changes, nil
+}
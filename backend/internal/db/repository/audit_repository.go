@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// AuditRepository defines operations for the hash-chained audit log
+type AuditRepository interface {
+	Repository
+	Append(entry *models.AuditEntry) error
+	ListRange(from, to time.Time) ([]models.AuditEntry, error)
+	ListBefore(before time.Time, limit int) ([]models.AuditEntry, error)
+	DeleteThrough(id uint) error
+}
+
+// auditRepository implements AuditRepository
+type auditRepository struct {
+	BaseRepository
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{
+		BaseRepository: NewBaseRepository(db),
+	}
+}
+
+// Append chains an entry to the last one in the log and stores it. If another entry was
+// appended concurrently, the unique prev_hash index rejects the insert and an error is returned.
+func (r *auditRepository) Append(entry *models.AuditEntry) error {
+	var last models.AuditEntry
+	err := r.GetDB().Order("id desc").First(&last).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.handleError(err)
+	}
+
+	entry.PrevHash = last.Hash
+	entry.Hash = entry.ComputeHash()
+
+	err = r.GetDB().Create(entry).Error
+	return r.handleError(err)
+}
+
+// ListRange retrieves the entries recorded in [from, to), in chain order
+func (r *auditRepository) ListRange(from, to time.Time) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.GetDB().Where("time >= ? AND time < ?", from, to).Order("id asc").Find(&entries).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return entries, nil
+}
+
+// ListBefore retrieves up to limit of the oldest entries recorded before the given time, in chain order
+func (r *auditRepository) ListBefore(before time.Time, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.GetDB().Where("time < ?", before).Order("id asc").Limit(limit).Find(&entries).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return entries, nil
+}
+
+// DeleteThrough removes the entries up to and including the given ID
+func (r *auditRepository) DeleteThrough(id uint) error {
+	result := r.GetDB().Where("id <= ?", id).Delete(&models.AuditEntry{})
+	return r.handleMutation(result)
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// DashboardRepository defines operations for managing dashboard layouts
+type DashboardRepository interface {
+	Repository
+	Save(layout *models.DashboardLayout) error
+	Get(projectID, userID uint, name string) (*models.DashboardLayout, error)
+	ListVisible(projectID, userID uint) ([]models.DashboardLayout, error)
+	Delete(projectID, userID uint, name string) error
+}
+
+// dashboardRepository implements DashboardRepository
+type dashboardRepository struct {
+	BaseRepository
+}
+
+// NewDashboardRepository creates a new dashboard repository
+func NewDashboardRepository(db *gorm.DB) DashboardRepository {
+	return &dashboardRepository{
+		BaseRepository: NewBaseRepository(db),
+	}
+}
+
+// Save creates the layout, or replaces the layout of the same name and scope
+func (r *dashboardRepository) Save(layout *models.DashboardLayout) error {
+	var existing models.DashboardLayout
+	err := r.GetDB().Where("project_id = ? AND user_id = ? AND name = ?", layout.ProjectID, layout.UserID, layout.Name).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.handleError(err)
+	}
+
+	if err == nil {
+		layout.ID = existing.ID
+		layout.CreatedAt = existing.CreatedAt
+	}
+
+	return r.handleError(r.GetDB().Save(layout).Error)
+}
+
+// Get retrieves a layout of a project by scope and name; user ID 0 is the shared scope
+func (r *dashboardRepository) Get(projectID, userID uint, name string) (*models.DashboardLayout, error) {
+	var layout models.DashboardLayout
+	err := r.GetDB().Where("project_id = ? AND user_id = ? AND name = ?", projectID, userID, name).First(&layout).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &layout, nil
+}
+
+// ListVisible lists the shared layouts of a project and the user's own, without their layout blobs
+func (r *dashboardRepository) ListVisible(projectID, userID uint) ([]models.DashboardLayout, error) {
+	var layouts []models.DashboardLayout
+	err := r.GetDB().
+		Select("id", "project_id", "user_id", "name", "updated_by", "created_at", "updated_at").
+		Where("project_id = ? AND user_id IN ?", projectID, []uint{0, userID}).
+		Order("name asc, user_id asc").
+		Find(&layouts).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return layouts, nil
+}
+
+// Delete removes a layout of a project by scope and name
+func (r *dashboardRepository) Delete(projectID, userID uint, name string) error {
+	result := r.GetDB().Where("project_id = ? AND user_id = ? AND name = ?", projectID, userID, name).Delete(&models.DashboardLayout{})
+	return r.handleMutation(result)
+}
@@ -4,13 +4,18 @@ import "gorm.io/gorm"
 
 // RepositoryFactory creates and manages all repositories
 type RepositoryFactory struct {
-	db             *gorm.DB
-	userRepo       UserRepository
-	projectRepo    ProjectRepository
-	twinRepo       TwinRepository
-	twinTypeRepo   TwinTypeRepository
-	mlRepo         MLRepository
-	timeseriesRepo TimeseriesRepository
+	db               *gorm.DB
+	userRepo         UserRepository
+	projectRepo      ProjectRepository
+	twinRepo         TwinRepository
+	twinTypeRepo     TwinTypeRepository
+	mlRepo           MLRepository
+	timeseriesRepo   TimeseriesRepository
+	webhookRepo      WebhookRepository
+	auditRepo        AuditRepository
+	notificationRepo NotificationRepository
+	dashboardRepo    DashboardRepository
+	attributeRepo    AttributeHistoryRepository
 }
 
 // NewRepositoryFactory creates a new repository factory
@@ -67,3 +72,43 @@ func (f *RepositoryFactory) Timeseries() TimeseriesRepository {
 	}
 	return f.timeseriesRepo
 }
+
+// Webhook returns the webhook repository
+func (f *RepositoryFactory) Webhook() WebhookRepository {
+	if f.webhookRepo == nil {
+		f.webhookRepo = NewWebhookRepository(f.db)
+	}
+	return f.webhookRepo
+}
+
+// Audit returns the audit log repository
+func (f *RepositoryFactory) Audit() AuditRepository {
+	if f.auditRepo == nil {
+		f.auditRepo = NewAuditRepository(f.db)
+	}
+	return f.auditRepo
+}
+
+// Notification returns the notification repository
+func (f *RepositoryFactory) Notification() NotificationRepository {
+	if f.notificationRepo == nil {
+		f.notificationRepo = NewNotificationRepository(f.db)
+	}
+	return f.notificationRepo
+}
+
+// Dashboard returns the dashboard layout repository
+func (f *RepositoryFactory) Dashboard() DashboardRepository {
+	if f.dashboardRepo == nil {
+		f.dashboardRepo = NewDashboardRepository(f.db)
+	}
+	return f.dashboardRepo
+}
+
+// AttributeHistory returns the twin attribute history repository
+func (f *RepositoryFactory) AttributeHistory() AttributeHistoryRepository {
+	if f.attributeRepo == nil {
+		f.attributeRepo = NewAttributeHistoryRepository(f.db)
+	}
+	return f.attributeRepo
+}
@@ -12,6 +12,7 @@ type MLRepository interface {
 	CreateMLTask(task *models.MLTask) error
 	GetMLTaskByID(id uint) (*models.MLTask, error)
 	ListMLTasks(offset, limit int) ([]models.MLTask, int64, error)
+	ListMLTasksByModelIDs(modelIDs []string) ([]models.MLTask, error)
 	UpdateMLTask(task *models.MLTask) error
 	DeleteMLTask(id uint) error
 	ActivateMLTask(id uint, active bool) error
@@ -32,6 +33,8 @@ type MLRepository interface {
 	ListMLModelMetadata(offset, limit int) ([]models.MLModelMetadata, int64, error)
 	UpdateMLModelMetadata(metadata *models.MLModelMetadata) error
 	DeleteMLModelMetadata(id uint) error
+	ListAllMLModelMetadata() ([]models.MLModelMetadata, error)
+	ImportMLModelMetadata(metadata []models.MLModelMetadata) error
 }
 
 // mlRepository implements MLRepository
@@ -83,23 +86,16 @@ func (r *mlRepository) ListMLTasks(offset, limit int) ([]models.MLTask, int64, e
 
 // UpdateMLTask updates an ML task's information
 func (r *mlRepository) UpdateMLTask(task *models.MLTask) error {
-	// Check if task exists
-	var existingTask models.MLTask
-	if err := r.GetDB().Where("id = ?", task.ID).First(&existingTask).Error; err != nil {
-		return r.handleError(err)
-	}
-
 	// Update only allowed fields
-	err := r.GetDB().Model(task).Updates(map[string]interface{}{
+	result := r.GetDB().Model(&models.MLTask{}).Where("id = ?", task.ID).Updates(map[string]interface{}{
 		"name":        task.Name,
 		"description": task.Description,
 		"type":        task.Type,
 		"model_id":    task.ModelID,
 		"version":     task.Version,
 		"config_json": task.ConfigJSON,
-	}).Error
-
-	return r.handleError(err)
+	})
+	return r.handleMutation(result)
 }
 
 // DeleteMLTask soft-deletes an ML task
@@ -134,13 +130,7 @@ func (r *mlRepository) DeleteMLTask(id uint) error {
 // ActivateMLTask activates or deactivates an ML task
 func (r *mlRepository) ActivateMLTask(id uint, active bool) error {
 	result := r.GetDB().Model(&models.MLTask{}).Where("id = ?", id).Update("active", active)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // CreateMLTaskBinding adds a new ML task binding to the database
@@ -159,6 +149,18 @@ func (r *mlRepository) GetMLTaskBindingByID(id uint) (*models.MLTaskBinding, err
 	return &binding, nil
 }
 
+// ListMLTasksByModelIDs retrieves the ML tasks using any of the models
+func (r *mlRepository) ListMLTasksByModelIDs(modelIDs []string) ([]models.MLTask, error) {
+	tasks := []models.MLTask{}
+	if len(modelIDs) == 0 {
+		return tasks, nil
+	}
+	if err := r.GetDB().Where("model_id IN ?", modelIDs).Order("id asc").Find(&tasks).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+	return tasks, nil
+}
+
 // ListMLTaskBindingsByTaskID lists all bindings for a specific ML task
 func (r *mlRepository) ListMLTaskBindingsByTaskID(taskID uint) ([]models.MLTaskBinding, error) {
 	var bindings []models.MLTaskBinding
@@ -181,37 +183,25 @@ func (r *mlRepository) ListMLTaskBindingsByTwinID(twinID uint) ([]models.MLTaskB
 
 // UpdateMLTaskBinding updates an ML task binding
 func (r *mlRepository) UpdateMLTaskBinding(binding *models.MLTaskBinding) error {
-	err := r.GetDB().Model(binding).Updates(map[string]interface{}{
+	result := r.GetDB().Model(&models.MLTaskBinding{}).Where("id = ?", binding.ID).Updates(map[string]interface{}{
 		"input_mapping_json": binding.InputMappingJSON,
 		"output_path_json":   binding.OutputPathJSON,
 		"schedule_type":      binding.ScheduleType,
 		"schedule_config":    binding.ScheduleConfig,
-	}).Error
-	return r.handleError(err)
+	})
+	return r.handleMutation(result)
 }
 
 // DeleteMLTaskBinding deletes an ML task binding
 func (r *mlRepository) DeleteMLTaskBinding(id uint) error {
 	result := r.GetDB().Delete(&models.MLTaskBinding{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // ActivateMLTaskBinding activates or deactivates an ML task binding
 func (r *mlRepository) ActivateMLTaskBinding(id uint, active bool) error {
 	result := r.GetDB().Model(&models.MLTaskBinding{}).Where("id = ?", id).Update("active", active)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // CreateMLModelMetadata adds new ML model metadata to the database
@@ -290,7 +280,7 @@ func (r *mlRepository) UpdateMLModelMetadata(metadata *models.MLModelMetadata) e
 	}
 
 	// Update metadata
-	err := r.GetDB().Model(metadata).Updates(map[string]interface{}{
+	result := r.GetDB().Model(&models.MLModelMetadata{}).Where("id = ?", metadata.ID).Updates(map[string]interface{}{
 		"model_id":      metadata.ModelID,
 		"name":          metadata.Name,
 		"description":   metadata.Description,
@@ -298,9 +288,8 @@ func (r *mlRepository) UpdateMLModelMetadata(metadata *models.MLModelMetadata) e
 		"version":       metadata.Version,
 		"input_schema":  metadata.InputSchema,
 		"output_schema": metadata.OutputSchema,
-	}).Error
-
-	return r.handleError(err)
+	})
+	return r.handleMutation(result)
 }
 
 // DeleteMLModelMetadata deletes ML model metadata
@@ -316,11 +305,41 @@ func (r *mlRepository) DeleteMLModelMetadata(id uint) error {
 	}
 
 	result := r.GetDB().Delete(&models.MLModelMetadata{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+	return r.handleMutation(result)
+}
+
+// ListAllMLModelMetadata retrieves the metadata of every ML model, ordered by model ID
+func (r *mlRepository) ListAllMLModelMetadata() ([]models.MLModelMetadata, error) {
+	var metadata []models.MLModelMetadata
+	if err := r.GetDB().Order("model_id asc").Find(&metadata).Error; err != nil {
+		return nil, r.handleError(err)
 	}
-	return nil
+	return metadata, nil
+}
+
+// ImportMLModelMetadata creates the metadata without an ID and updates the others, in one transaction
+func (r *mlRepository) ImportMLModelMetadata(metadata []models.MLModelMetadata) error {
+	err := r.GetDB().Transaction(func(tx *gorm.DB) error {
+		for i := range metadata {
+			if metadata[i].ID == 0 {
+				if err := tx.Create(&metadata[i]).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			err := tx.Model(&models.MLModelMetadata{}).Where("id = ?", metadata[i].ID).Updates(map[string]interface{}{
+				"name":          metadata[i].Name,
+				"description":   metadata[i].Description,
+				"type":          metadata[i].Type,
+				"version":       metadata[i].Version,
+				"input_schema":  metadata[i].InputSchema,
+				"output_schema": metadata[i].OutputSchema,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return r.handleError(err)
 }
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// NotificationRepository defines operations for notifications and their delivery receipts
+type NotificationRepository interface {
+	Repository
+	Create(notification *models.Notification) error
+	GetByID(id uint) (*models.Notification, error)
+	CreateDelivery(delivery *models.NotificationDelivery) error
+	UpdateDelivery(delivery *models.NotificationDelivery) error
+	ListDeliveries(notificationID uint) ([]models.NotificationDelivery, error)
+	ListDueDeliveries(before time.Time, limit int) ([]models.NotificationDelivery, error)
+
+	// Notification history
+	CreateRecords(records []models.NotificationRecord) error
+	ListRecords(filter NotificationRecordFilter, offset, limit int) ([]models.NotificationRecord, int64, error)
+
+	// Alert routing
+	CreateAlertRoute(route *models.AlertRoute) error
+	ListAlertRoutes(projectID uint) ([]models.AlertRoute, error)
+	DeleteAlertRoute(projectID, id uint) error
+}
+
+// NotificationRecordFilter selects notification history records; zero fields match everything
+type NotificationRecordFilter struct {
+	ProjectID uint
+	// UserID restricts the records to those sent to every client or to the user's projects
+	UserID     uint
+	Types      []string
+	Severities []string
+	Start      time.Time
+	End        time.Time
+}
+
+// notificationRepository implements NotificationRepository
+type notificationRepository struct {
+	BaseRepository
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *gorm.DB) NotificationRepository {
+	return &notificationRepository{
+		BaseRepository: NewBaseRepository(db),
+	}
+}
+
+// Create adds a new notification to the database
+func (r *notificationRepository) Create(notification *models.Notification) error {
+	err := r.GetDB().Create(notification).Error
+	return r.handleError(err)
+}
+
+// GetByID retrieves a notification by ID
+func (r *notificationRepository) GetByID(id uint) (*models.Notification, error) {
+	var notification models.Notification
+	err := r.GetDB().First(&notification, id).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &notification, nil
+}
+
+// CreateDelivery adds a delivery receipt to the database
+func (r *notificationRepository) CreateDelivery(delivery *models.NotificationDelivery) error {
+	err := r.GetDB().Create(delivery).Error
+	return r.handleError(err)
+}
+
+// UpdateDelivery stores the outcome of a delivery attempt
+func (r *notificationRepository) UpdateDelivery(delivery *models.NotificationDelivery) error {
+	err := r.GetDB().Omit("Notification").Save(delivery).Error
+	return r.handleError(err)
+}
+
+// ListDeliveries retrieves the delivery receipts of a notification
+func (r *notificationRepository) ListDeliveries(notificationID uint) ([]models.NotificationDelivery, error) {
+	var deliveries []models.NotificationDelivery
+	err := r.GetDB().Where("notification_id = ?", notificationID).Order("id asc").Find(&deliveries).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return deliveries, nil
+}
+
+// ListDueDeliveries retrieves up to limit pending deliveries whose next attempt is due before
+// the given time, oldest first, with their notification
+func (r *notificationRepository) ListDueDeliveries(before time.Time, limit int) ([]models.NotificationDelivery, error) {
+	var deliveries []models.NotificationDelivery
+	err := r.GetDB().
+		Preload("Notification").
+		Where("status = ? AND next_attempt_at <= ?", models.DeliveryStatusPending, before).
+		Order("next_attempt_at asc").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return deliveries, nil
+}
+
+// CreateRecords stores notification history records in a single insert
+func (r *notificationRepository) CreateRecords(records []models.NotificationRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	err := r.GetDB().Create(&records).Error
+	return r.handleError(err)
+}
+
+// ListRecords returns a page of notification history records, newest first, and the total number matching
+func (r *notificationRepository) ListRecords(filter NotificationRecordFilter, offset, limit int) ([]models.NotificationRecord, int64, error) {
+	query := r.GetDB().Model(&models.NotificationRecord{})
+	if filter.ProjectID != 0 {
+		query = query.Where("project_id = ?", filter.ProjectID)
+	}
+	if filter.UserID != 0 {
+		query = query.Where("project_id IS NULL OR project_id IN (?)",
+			r.GetDB().Model(&models.ProjectMember{}).Select("project_id").Where("user_id = ?", filter.UserID))
+	}
+	if len(filter.Types) > 0 {
+		query = query.Where("type IN ?", filter.Types)
+	}
+	if len(filter.Severities) > 0 {
+		query = query.Where("severity IN ?", filter.Severities)
+	}
+	if !filter.Start.IsZero() {
+		query = query.Where("time >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query = query.Where("time < ?", filter.End)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+
+	var records []models.NotificationRecord
+	err := query.Order("time DESC, id DESC").Offset(offset).Limit(limit).Find(&records).Error
+	if err != nil {
+		return nil, 0, r.handleError(err)
+	}
+	return records, total, nil
+}
+
+// CreateAlertRoute adds an alert route to the database
+func (r *notificationRepository) CreateAlertRoute(route *models.AlertRoute) error {
+	err := r.GetDB().Create(route).Error
+	return r.handleError(err)
+}
+
+// ListAlertRoutes retrieves the alert routes of a project and its twins in evaluation order
+func (r *notificationRepository) ListAlertRoutes(projectID uint) ([]models.AlertRoute, error) {
+	var routes []models.AlertRoute
+	err := r.GetDB().Where("project_id = ?", projectID).Order("position asc, id asc").Find(&routes).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return routes, nil
+}
+
+// DeleteAlertRoute removes an alert route of a project
+func (r *notificationRepository) DeleteAlertRoute(projectID, id uint) error {
+	result := r.GetDB().Where("id = ? AND project_id = ?", id, projectID).Delete(&models.AlertRoute{})
+	return r.handleMutation(result)
+}
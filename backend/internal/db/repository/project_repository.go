@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/digital-egiz/backend/internal/db/models"
 	"gorm.io/gorm"
 )
@@ -10,9 +12,11 @@ type ProjectRepository interface {
 	Repository
 	Create(project *models.Project) error
 	GetByID(id uint) (*models.Project, error)
+	GetByName(name string) (*models.Project, error)
 	List(offset, limit int) ([]models.Project, int64, error)
 	ListByUserID(userID uint, offset, limit int) ([]models.Project, int64, error)
 	Update(project *models.Project) error
+	SetMLPause(id uint, paused bool, until *time.Time) error
 	Delete(id uint) error
 
 	// Project members methods
@@ -80,6 +84,16 @@ func (r *projectRepository) GetByID(id uint) (*models.Project, error) {
 	return &project, nil
 }
 
+// GetByName retrieves a project by name, ignoring case
+func (r *projectRepository) GetByName(name string) (*models.Project, error) {
+	var project models.Project
+	err := r.GetDB().Where("LOWER(name) = LOWER(?)", name).First(&project).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &project, nil
+}
+
 // List retrieves a paginated list of projects
 func (r *projectRepository) List(offset, limit int) ([]models.Project, int64, error) {
 	var projects []models.Project
@@ -124,31 +138,28 @@ func (r *projectRepository) ListByUserID(userID uint, offset, limit int) ([]mode
 
 // Update updates a project's information
 func (r *projectRepository) Update(project *models.Project) error {
-	// Check if project exists
-	var existingProject models.Project
-	if err := r.GetDB().Where("id = ?", project.ID).First(&existingProject).Error; err != nil {
-		return r.handleError(err)
-	}
-
 	// Update only allowed fields
-	err := r.GetDB().Model(project).Updates(map[string]interface{}{
-		"name":        project.Name,
-		"description": project.Description,
-	}).Error
+	result := r.GetDB().Model(&models.Project{}).Where("id = ?", project.ID).Updates(map[string]interface{}{
+		"name":             project.Name,
+		"description":      project.Description,
+		"timestamp_policy": project.TimestampPolicy,
+	})
+	return r.handleMutation(result)
+}
 
-	return r.handleError(err)
+// SetMLPause pauses or resumes forwarding the values of a project's twins to ML
+func (r *projectRepository) SetMLPause(id uint, paused bool, until *time.Time) error {
+	result := r.GetDB().Model(&models.Project{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ml_paused":       paused,
+		"ml_paused_until": until,
+	})
+	return r.handleMutation(result)
 }
 
 // Delete soft-deletes a project
 func (r *projectRepository) Delete(id uint) error {
 	result := r.GetDB().Delete(&models.Project{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // AddMember adds a user to a project with the specified role
@@ -186,14 +197,7 @@ func (r *projectRepository) UpdateMemberRole(projectID, userID uint, role models
 	result := r.GetDB().Model(&models.ProjectMember{}).
 		Where("project_id = ? AND user_id = ?", projectID, userID).
 		Update("role", role)
-
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // RemoveMember removes a user from a project
@@ -221,14 +225,7 @@ func (r *projectRepository) RemoveMember(projectID, userID uint) error {
 	// Remove member
 	result := r.GetDB().Where("project_id = ? AND user_id = ?", projectID, userID).
 		Delete(&models.ProjectMember{})
-
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // ListMembers lists all members of a project
@@ -46,5 +46,22 @@ func (r *BaseRepository) handleError(err error) error {
 		return ErrNotFound
 	}
 
+	// Unique violations, such as a concurrent insert winning past a pre-check, are conflicts
+	if translator, ok := r.db.Dialector.(gorm.ErrorTranslator); ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey) {
+		return ErrConflict
+	}
+
 	return ErrDatabase
 }
+
+// handleMutation converts the result of an update or delete to a repository error,
+// returning ErrNotFound when no row matched
+func (r *BaseRepository) handleMutation(result *gorm.DB) error {
+	if result.Error != nil {
+		return r.handleError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
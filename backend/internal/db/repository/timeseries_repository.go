@@ -1,38 +1,162 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/digital-egiz/backend/internal/db/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// TimeseriesPage selects a page of the points in a time range
+type TimeseriesPage struct {
+	Limit  int
+	Offset int
+	// Ascending returns the earliest points first instead of the latest
+	Ascending bool
+	// Source only selects the points recorded from this source, if set
+	Source string
+	// Value only selects the points whose value matches, if set
+	Value *ValuePredicate
+}
+
+// ValuePredicate selects points by their stored value. Bounds only match numeric points;
+// Equal matches points of the type of its value, a float64, bool or string.
+type ValuePredicate struct {
+	GreaterThan *float64
+	LessThan    *float64
+	Equal       interface{}
+}
+
+// apply adds the conditions of the predicate to a query of timeseries_data
+func (p *ValuePredicate) apply(query *gorm.DB) *gorm.DB {
+	if p.GreaterThan != nil || p.LessThan != nil {
+		query = query.Where("value_type = ?", "number")
+	}
+	if p.GreaterThan != nil {
+		query = query.Where("value_num > ?", *p.GreaterThan)
+	}
+	if p.LessThan != nil {
+		query = query.Where("value_num < ?", *p.LessThan)
+	}
+	switch value := p.Equal.(type) {
+	case float64:
+		query = query.Where("value_type = ? AND value_num = ?", "number", value)
+	case bool:
+		query = query.Where("value_type = ? AND value_bool = ?", "boolean", value)
+	case string:
+		query = query.Where("value_type = ? AND value_str = ?", "string", value)
+	}
+	return query
+}
+
+// AlertSeverityCount is the number of unacknowledged alerts of one severity for a twin
+type AlertSeverityCount struct {
+	TwinID   string
+	Severity string
+	Count    int64
+}
+
+// AlertFilter narrows the alerts of a twin that are read
+type AlertFilter struct {
+	// Severity only selects alerts of this severity, if set
+	Severity string
+	// Acknowledged only selects acknowledged or unacknowledged alerts, if set
+	Acknowledged *bool
+}
+
+// MLPredictionFilter narrows the ML predictions of a twin that are read
+type MLPredictionFilter struct {
+	// PredictionType only selects predictions of this type, if set
+	PredictionType string
+	// MinScore only selects predictions scoring at least this, if set
+	MinScore *float64
+	// Label only selects predictions with this label, if set
+	Label string
+}
+
+// QuarantineFilter narrows the quarantined points of a twin that are read
+type QuarantineFilter struct {
+	// FeaturePath only selects points of this feature, if set
+	FeaturePath string
+	// Start and End bound the points' times, if set
+	Start  time.Time
+	End    time.Time
+	Limit  int
+	Offset int
+}
+
+// QuarantineCount is the number of quarantined points of a feature
+type QuarantineCount struct {
+	FeaturePath string `json:"feature_path"`
+	Count       int64  `json:"count"`
+}
+
+// FeatureCatalogFilter selects a page of a twin's catalog entries, ordered by feature path
+type FeatureCatalogFilter struct {
+	// Search only selects paths containing it, ignoring case, if set
+	Search string
+	// Paths are selected as well as those matching Search, e.g. the targets of matching aliases
+	Paths  []string
+	Limit  int
+	Offset int
+}
+
 // TimeseriesRepository defines operations for managing time-series data
 type TimeseriesRepository interface {
 	Repository
 	// Timeseries data operations
 	InsertTimeseriesData(data *models.TimeseriesData) error
 	InsertTimeseriesBatch(data []models.TimeseriesData) error
-	GetTimeseriesData(twinID string, featurePath string, start, end time.Time, limit int) ([]models.TimeseriesData, error)
-	GetLatestTimeseriesData(twinID string, featurePath string) (*models.TimeseriesData, error)
-	GetAggregatedTimeseriesData(twinID string, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error)
+	GetTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, page TimeseriesPage, columns ...string) ([]models.TimeseriesData, error)
+	GetLatestTimeseriesData(ctx context.Context, twinID string, featurePath string, columns ...string) (*models.TimeseriesData, error)
+	StreamTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, source string, fn func(*models.TimeseriesData) error) error
+	GetAggregatedTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error)
 	DeleteTimeseriesData(twinID string, featurePath string, start, end time.Time) error
+	DeleteTimeseriesBefore(ctx context.Context, twinIDs []string, cutoff time.Time) (int64, error)
+	ListFeaturePaths(twinID string) ([]string, error)
+	UpsertFeatureCatalog(entries []models.FeatureCatalogEntry) error
+	RebuildFeatureCatalog(ctx context.Context, twinID string) (int, error)
+	ListFeatureCatalogTwins(ctx context.Context, after string, limit int) ([]string, error)
+	ListFeatureCatalog(ctx context.Context, twinID string, filter FeatureCatalogFilter) ([]models.FeatureCatalogEntry, int64, error)
+	GetLastSeen(ctx context.Context, twinIDs []string) (map[string]time.Time, error)
 
 	// Aggregated data operations
 	InsertAggregatedData(data *models.AggregatedData) error
 	InsertAggregatedBatch(data []models.AggregatedData) error
+	DeleteAggregatedBefore(ctx context.Context, twinIDs []string, cutoff time.Time) (int64, error)
+
+	// Quarantined point operations
+	InsertQuarantinedPoints(points []models.QuarantinedPoint) error
+	ListQuarantinedPoints(ctx context.Context, twinID string, filter QuarantineFilter) ([]models.QuarantinedPoint, int64, error)
+	CountQuarantinedPoints(ctx context.Context, twinID string) ([]QuarantineCount, error)
+	GetQuarantinedPoint(twinID string, id uint) (*models.QuarantinedPoint, error)
+	ReleaseQuarantinedPoint(id uint, point *models.TimeseriesData) error
+	DeleteQuarantinedPoint(twinID string, id uint) error
 
 	// Alert data operations
 	InsertAlertData(alert *models.AlertData) error
-	GetAlertData(twinID string, start, end time.Time, severity string, limit int) ([]models.AlertData, error)
-	AcknowledgeAlert(alertID string, ackBy string) error
+	IncrementAlertOccurrence(ctx context.Context, alert *models.AlertData) (*models.AlertData, error)
+	RaiseAlert(ctx context.Context, alert *models.AlertData, prepare func(*models.AlertData)) (*models.AlertData, bool, error)
+	GetAlertData(ctx context.Context, twinID string, start, end time.Time, severity string, limit int) ([]models.AlertData, error)
+	StreamAlertData(ctx context.Context, twinID string, start, end time.Time, filter AlertFilter, fn func(*models.AlertData) error) error
+	GetAlertByID(alertID string, columns ...string) (*models.AlertData, error)
+	ListActiveAlerts(ctx context.Context, twinID string, limit int) ([]models.AlertData, error)
+	AcknowledgeAlert(alertID string, ackBy string, note string) error
 	DeleteAlertData(alertID string) error
+	CountActiveAlerts(ctx context.Context, twinIDs []string) ([]AlertSeverityCount, error)
 
 	// ML prediction data operations
 	InsertMLPredictionData(prediction *models.MLPredictionData) error
 	InsertMLPredictionBatch(predictions []models.MLPredictionData) error
-	GetMLPredictionData(twinID string, taskID string, start, end time.Time, limit int) ([]models.MLPredictionData, error)
-	GetLatestMLPrediction(twinID string, taskID string) (*models.MLPredictionData, error)
+	GetMLPredictionData(ctx context.Context, twinID string, taskID string, start, end time.Time, filter MLPredictionFilter, limit, offset int) ([]models.MLPredictionData, int64, error)
+	GetLatestMLPrediction(ctx context.Context, twinID string, taskID string) (*models.MLPredictionData, error)
 	DeleteMLPredictionData(twinID string, taskID string, start, end time.Time) error
 }
 
@@ -71,17 +195,40 @@ func (r *timeseriesRepository) InsertTimeseriesBatch(data []models.TimeseriesDat
 	return r.handleError(tx.Commit().Error)
 }
 
-// GetTimeseriesData retrieves time-series data for a specific twin and feature path
-func (r *timeseriesRepository) GetTimeseriesData(twinID string, featurePath string, start, end time.Time, limit int) ([]models.TimeseriesData, error) {
+// GetTimeseriesData retrieves time-series data for a specific twin and feature path.
+// If columns are given, only those columns are selected.
+func (r *timeseriesRepository) GetTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, page TimeseriesPage, columns ...string) ([]models.TimeseriesData, error) {
 	var data []models.TimeseriesData
 
-	query := r.GetDB().Where("twin_id = ? AND feature_path = ? AND time >= ? AND time <= ?", twinID, featurePath, start, end)
+	query := r.GetDB().WithContext(ctx).Where("twin_id = ? AND feature_path = ? AND time >= ? AND time <= ?", twinID, featurePath, start, end)
 
-	if limit > 0 {
-		query = query.Limit(limit)
+	if page.Source != "" {
+		query = query.Where("source = ?", page.Source)
+	}
+
+	if page.Value != nil {
+		query = page.Value.apply(query)
+	}
+
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit)
+	}
+
+	if page.Offset > 0 {
+		query = query.Offset(page.Offset)
 	}
 
-	err := query.Order("time desc").Find(&data).Error
+	// The limit applies in the requested order, so ascending reads return the earliest points
+	order := "time desc"
+	if page.Ascending {
+		order = "time asc"
+	}
+
+	err := query.Order(order).Find(&data).Error
 	if err != nil {
 		return nil, r.handleError(err)
 	}
@@ -89,11 +236,44 @@ func (r *timeseriesRepository) GetTimeseriesData(twinID string, featurePath stri
 	return data, nil
 }
 
-// GetLatestTimeseriesData retrieves the latest time-series data for a twin and feature path
-func (r *timeseriesRepository) GetLatestTimeseriesData(twinID string, featurePath string) (*models.TimeseriesData, error) {
+// StreamTimeseriesData calls fn for each point of a twin and feature path in a time range,
+// oldest first, reading them through a cursor instead of loading the range into memory
+func (r *timeseriesRepository) StreamTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, source string, fn func(*models.TimeseriesData) error) error {
+	query := r.GetDB().WithContext(ctx).Model(&models.TimeseriesData{}).
+		Where("twin_id = ? AND feature_path = ? AND time >= ? AND time <= ?", twinID, featurePath, start, end)
+	if source != "" {
+		query = query.Where("source = ?", source)
+	}
+
+	rows, err := query.Order("time asc").Rows()
+	if err != nil {
+		return r.handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var point models.TimeseriesData
+		if err := r.GetDB().ScanRows(rows, &point); err != nil {
+			return r.handleError(err)
+		}
+		if err := fn(&point); err != nil {
+			return err
+		}
+	}
+	return r.handleError(rows.Err())
+}
+
+// GetLatestTimeseriesData retrieves the latest time-series data for a twin and feature path.
+// If columns are given, only those columns are selected.
+func (r *timeseriesRepository) GetLatestTimeseriesData(ctx context.Context, twinID string, featurePath string, columns ...string) (*models.TimeseriesData, error) {
 	var data models.TimeseriesData
-	err := r.GetDB().Where("twin_id = ? AND feature_path = ?", twinID, featurePath).
-		Order("time desc").
+	query := r.GetDB().WithContext(ctx).Where("twin_id = ? AND feature_path = ?", twinID, featurePath)
+
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+
+	err := query.Order("time desc").
 		Limit(1).
 		First(&data).Error
 
@@ -105,7 +285,7 @@ func (r *timeseriesRepository) GetLatestTimeseriesData(twinID string, featurePat
 }
 
 // GetAggregatedTimeseriesData retrieves aggregated time-series data
-func (r *timeseriesRepository) GetAggregatedTimeseriesData(twinID string, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error) {
+func (r *timeseriesRepository) GetAggregatedTimeseriesData(ctx context.Context, twinID string, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error) {
 	var data []models.AggregatedData
 
 	intervalTypeMap := map[string]string{
@@ -127,7 +307,7 @@ func (r *timeseriesRepository) GetAggregatedTimeseriesData(twinID string, featur
 	}
 
 	// Check if aggregated data exists
-	query := r.GetDB().Where("twin_id = ? AND feature_path = ? AND time_interval >= ? AND time_interval <= ? AND interval_type = ?",
+	query := r.GetDB().WithContext(ctx).Where("twin_id = ? AND feature_path = ? AND time_interval >= ? AND time_interval <= ? AND interval_type = ?",
 		twinID, featurePath, start, end, intervalType)
 
 	err := query.Order("time_interval desc").Find(&data).Error
@@ -140,7 +320,7 @@ func (r *timeseriesRepository) GetAggregatedTimeseriesData(twinID string, featur
 	}
 
 	// If no aggregated data, generate it on-the-fly (using TimescaleDB time_bucket function)
-	query = r.GetDB().Raw(`
+	query = r.GetDB().WithContext(ctx).Raw(`
 		SELECT 
 			time_bucket(?::interval, time) as time_interval,
 			? as twin_id,
@@ -167,13 +347,35 @@ func (r *timeseriesRepository) GetAggregatedTimeseriesData(twinID string, featur
 	return data, nil
 }
 
-// DeleteTimeseriesData deletes time-series data for a twin and feature path within a time range
+// DeleteTimeseriesData deletes time-series data for a twin and feature path within a time range,
+// returning ErrNotFound when the range holds no data
 func (r *timeseriesRepository) DeleteTimeseriesData(twinID string, featurePath string, start, end time.Time) error {
 	result := r.GetDB().Where("twin_id = ? AND feature_path = ? AND time >= ? AND time <= ?",
 		twinID, featurePath, start, end).
 		Delete(&models.TimeseriesData{})
+	return r.handleMutation(result)
+}
+
+// DeleteTimeseriesBefore deletes the time-series data of twins older than a cutoff, returning
+// the number of points deleted
+func (r *timeseriesRepository) DeleteTimeseriesBefore(ctx context.Context, twinIDs []string, cutoff time.Time) (int64, error) {
+	if len(twinIDs) == 0 {
+		return 0, nil
+	}
+	result := r.GetDB().WithContext(ctx).Where("twin_id IN ? AND time < ?", twinIDs, cutoff).
+		Delete(&models.TimeseriesData{})
+	return result.RowsAffected, r.handleError(result.Error)
+}
 
-	return r.handleError(result.Error)
+// DeleteAggregatedBefore deletes the aggregated data of twins whose buckets start before a
+// cutoff, returning the number of buckets deleted
+func (r *timeseriesRepository) DeleteAggregatedBefore(ctx context.Context, twinIDs []string, cutoff time.Time) (int64, error) {
+	if len(twinIDs) == 0 {
+		return 0, nil
+	}
+	result := r.GetDB().WithContext(ctx).Where("twin_id IN ? AND time_interval < ?", twinIDs, cutoff).
+		Delete(&models.AggregatedData{})
+	return result.RowsAffected, r.handleError(result.Error)
 }
 
 // InsertAggregatedData inserts a single aggregated data point
@@ -200,16 +402,385 @@ func (r *timeseriesRepository) InsertAggregatedBatch(data []models.AggregatedDat
 }
 
 // InsertAlertData inserts alert data
+// ListFeaturePaths returns the distinct feature paths that have time-series data for a twin
+func (r *timeseriesRepository) ListFeaturePaths(twinID string) ([]string, error) {
+	featurePaths := []string{}
+	err := r.GetDB().Model(&models.TimeseriesData{}).
+		Where("twin_id = ?", twinID).
+		Distinct("feature_path").
+		Pluck("feature_path", &featurePaths).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+
+	return featurePaths, nil
+}
+
+// UpsertFeatureCatalog records catalog entries, keeping the later last-seen time and its value
+// type of entries already recorded
+func (r *timeseriesRepository) UpsertFeatureCatalog(entries []models.FeatureCatalogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	err := r.GetDB().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "twin_id"}, {Name: "feature_path"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"value_type": gorm.Expr("CASE WHEN excluded.last_seen >= feature_catalog.last_seen THEN excluded.value_type ELSE feature_catalog.value_type END"),
+			"last_seen":  gorm.Expr("CASE WHEN excluded.last_seen > feature_catalog.last_seen THEN excluded.last_seen ELSE feature_catalog.last_seen END"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&entries).Error
+	return r.handleError(err)
+}
+
+// RebuildFeatureCatalog replaces a twin's catalog entries by the feature paths of its
+// time-series data, with the type and time of each path's latest point, in one transaction.
+// It returns the number of entries recorded.
+func (r *timeseriesRepository) RebuildFeatureCatalog(ctx context.Context, twinID string) (int, error) {
+	var entries []models.FeatureCatalogEntry
+	err := r.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rows, err := tx.Raw(`SELECT t.feature_path, t.value_type, l.last_seen
+			FROM timeseries_data t
+			JOIN (SELECT feature_path, MAX(time) AS last_seen FROM timeseries_data WHERE twin_id = ? GROUP BY feature_path) l
+				ON t.feature_path = l.feature_path AND t.time = l.last_seen
+			WHERE t.twin_id = ?`, twinID, twinID).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		now := time.Now()
+		for rows.Next() {
+			entry := models.FeatureCatalogEntry{TwinID: twinID, UpdatedAt: now}
+			var raw interface{}
+			if err := rows.Scan(&entry.FeaturePath, &entry.ValueType, &raw); err != nil {
+				return err
+			}
+			if entry.LastSeen, err = scanTime(raw); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if err := tx.Where("twin_id = ?", twinID).Delete(&models.FeatureCatalogEntry{}).Error; err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(entries, 100).Error
+	})
+	if err != nil {
+		return 0, r.handleError(err)
+	}
+	return len(entries), nil
+}
+
+// ListFeatureCatalogTwins returns up to limit twin IDs after the given one, in order, that
+// have time-series data or catalog entries
+func (r *timeseriesRepository) ListFeatureCatalogTwins(ctx context.Context, after string, limit int) ([]string, error) {
+	twinIDs := []string{}
+	err := r.GetDB().WithContext(ctx).Raw(`SELECT twin_id FROM (
+			SELECT DISTINCT twin_id FROM timeseries_data
+			UNION
+			SELECT twin_id FROM feature_catalog
+		) twins WHERE twin_id > ? ORDER BY twin_id LIMIT ?`, after, limit).
+		Scan(&twinIDs).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return twinIDs, nil
+}
+
+// ListFeatureCatalog returns a page of a twin's catalog entries and the number of entries
+// matching the filter
+func (r *timeseriesRepository) ListFeatureCatalog(ctx context.Context, twinID string, filter FeatureCatalogFilter) ([]models.FeatureCatalogEntry, int64, error) {
+	query := r.GetDB().WithContext(ctx).Model(&models.FeatureCatalogEntry{}).Where("twin_id = ?", twinID)
+	if filter.Search != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(filter.Search)) + "%"
+		if len(filter.Paths) > 0 {
+			query = query.Where(`LOWER(feature_path) LIKE ? ESCAPE '\' OR feature_path IN ?`, pattern, filter.Paths)
+		} else {
+			query = query.Where(`LOWER(feature_path) LIKE ? ESCAPE '\'`, pattern)
+		}
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+
+	entries := []models.FeatureCatalogEntry{}
+	if err := query.Order("feature_path").Limit(filter.Limit).Offset(filter.Offset).Find(&entries).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+	return entries, total, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, with \ as the escape character
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// GetLastSeen returns the time of the latest point recorded for each of the twins.
+// Twins without any points are left out.
+func (r *timeseriesRepository) GetLastSeen(ctx context.Context, twinIDs []string) (map[string]time.Time, error) {
+	lastSeen := make(map[string]time.Time, len(twinIDs))
+	if len(twinIDs) == 0 {
+		return lastSeen, nil
+	}
+
+	rows, err := r.GetDB().WithContext(ctx).Model(&models.TimeseriesData{}).
+		Select("twin_id, MAX(time)").
+		Where("twin_id IN ?", twinIDs).
+		Group("twin_id").
+		Rows()
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var twinID string
+		var raw interface{}
+		if err := rows.Scan(&twinID, &raw); err != nil {
+			return nil, r.handleError(err)
+		}
+		at, err := scanTime(raw)
+		if err != nil {
+			return nil, err
+		}
+		lastSeen[twinID] = at
+	}
+	return lastSeen, r.handleError(rows.Err())
+}
+
+// scanTime converts an aggregated time column, which some drivers return as text, to a time
+func scanTime(raw interface{}) (time.Time, error) {
+	switch v := raw.(type) {
+	case time.Time:
+		return v, nil
+	case []byte:
+		return scanTime(string(v))
+	case string:
+		for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano, "2006-01-02 15:04:05.999999999"} {
+			if at, err := time.Parse(layout, v); err == nil {
+				return at, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognised time %q", v)
+	}
+	return time.Time{}, fmt.Errorf("unsupported time value %T", raw)
+}
+
+// InsertQuarantinedPoints stores points held back from the time series
+func (r *timeseriesRepository) InsertQuarantinedPoints(points []models.QuarantinedPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return r.handleError(r.GetDB().CreateInBatches(points, 100).Error)
+}
+
+// ListQuarantinedPoints retrieves a page of the quarantined points of a twin, newest first,
+// with the number of points matching the filter
+func (r *timeseriesRepository) ListQuarantinedPoints(ctx context.Context, twinID string, filter QuarantineFilter) ([]models.QuarantinedPoint, int64, error) {
+	var points []models.QuarantinedPoint
+
+	query := r.GetDB().WithContext(ctx).Model(&models.QuarantinedPoint{}).Where("twin_id = ?", twinID)
+	if filter.FeaturePath != "" {
+		query = query.Where("feature_path = ?", filter.FeaturePath)
+	}
+	if !filter.Start.IsZero() {
+		query = query.Where("time >= ?", filter.Start)
+	}
+	if !filter.End.IsZero() {
+		query = query.Where("time <= ?", filter.End)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	if err := query.Order("time desc, id desc").Find(&points).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+	return points, total, nil
+}
+
+// CountQuarantinedPoints counts the quarantined points of a twin per feature
+func (r *timeseriesRepository) CountQuarantinedPoints(ctx context.Context, twinID string) ([]QuarantineCount, error) {
+	counts := []QuarantineCount{}
+	err := r.GetDB().WithContext(ctx).Model(&models.QuarantinedPoint{}).
+		Select("feature_path, COUNT(*) AS count").
+		Where("twin_id = ?", twinID).
+		Group("feature_path").
+		Order("feature_path asc").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return counts, nil
+}
+
+// GetQuarantinedPoint retrieves a quarantined point of a twin
+func (r *timeseriesRepository) GetQuarantinedPoint(twinID string, id uint) (*models.QuarantinedPoint, error) {
+	var point models.QuarantinedPoint
+	if err := r.GetDB().Where("id = ? AND twin_id = ?", id, twinID).First(&point).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+	return &point, nil
+}
+
+// ReleaseQuarantinedPoint stores a point in the time series in place of the quarantined point
+// it was made from. Returns ErrNotFound if the quarantined point was released or discarded
+// in the meantime.
+func (r *timeseriesRepository) ReleaseQuarantinedPoint(id uint, point *models.TimeseriesData) error {
+	return r.handleError(r.GetDB().Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&models.QuarantinedPoint{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Create(point).Error
+	}))
+}
+
+// DeleteQuarantinedPoint discards a quarantined point of a twin
+func (r *timeseriesRepository) DeleteQuarantinedPoint(twinID string, id uint) error {
+	result := r.GetDB().Where("id = ? AND twin_id = ?", id, twinID).Delete(&models.QuarantinedPoint{})
+	return r.handleMutation(result)
+}
+
 func (r *timeseriesRepository) InsertAlertData(alert *models.AlertData) error {
+	if alert.OccurrenceCount == 0 {
+		alert.OccurrenceCount = 1
+	}
+	if alert.LastSeen.IsZero() {
+		alert.LastSeen = alert.Time
+	}
 	err := r.GetDB().Create(alert).Error
 	return r.handleError(err)
 }
 
+// IncrementAlertOccurrence counts another occurrence of the active alert raised for the same
+// condition as alert (twin, feature path, severity and source), moving its last_seen forward to
+// the alert's time. The count is incremented in the database, so concurrent occurrences are all
+// counted. Returns the updated alert, or ErrNotFound if no alert of the condition is active.
+func (r *timeseriesRepository) IncrementAlertOccurrence(ctx context.Context, alert *models.AlertData) (*models.AlertData, error) {
+	alertID, err := r.incrementAlertOccurrence(r.GetDB().WithContext(ctx), alert)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetAlertByID(alertID)
+}
+
+// incrementAlertOccurrence counts an occurrence on the active alert of the condition within db,
+// returning the ID of the alert
+func (r *timeseriesRepository) incrementAlertOccurrence(db *gorm.DB, alert *models.AlertData) (string, error) {
+	active := db.Model(&models.AlertData{}).Select("alert_id").
+		Where("twin_id = ? AND feature_path = ? AND severity = ? AND source = ? AND acknowledged = ?",
+			alert.TwinID, alert.FeaturePath, alert.Severity, alert.Source, false).
+		Order("time desc").Limit(1)
+
+	var alertID string
+	if err := active.Scan(&alertID).Error; err != nil {
+		return "", r.handleError(err)
+	}
+	if alertID == "" {
+		return "", ErrNotFound
+	}
+
+	result := db.Model(&models.AlertData{}).
+		Where("alert_id = ? AND acknowledged = ?", alertID, false).
+		Updates(map[string]interface{}{
+			"occurrence_count": gorm.Expr("occurrence_count + 1"),
+			"last_seen":        gorm.Expr("CASE WHEN last_seen IS NULL OR last_seen < ? THEN ? ELSE last_seen END", alert.Time, alert.Time),
+		})
+	if err := r.handleMutation(result); err != nil {
+		// Acknowledged in the meantime, so the occurrence starts a new alert
+		return "", err
+	}
+	return alertID, nil
+}
+
+// alertConditionLocks serialize raising the alerts of a condition within the process, by hash
+// of the condition
+var alertConditionLocks [64]sync.Mutex
+
+// RaiseAlert counts an occurrence of the condition of alert on its active alert, or inserts
+// alert if none is active, returning the stored alert and whether it was inserted. prepare is
+// called on alert before it is inserted, if set. Raising a condition is serialized, by an
+// advisory lock on PostgreSQL, so concurrent first occurrences insert one alert between them.
+func (r *timeseriesRepository) RaiseAlert(ctx context.Context, alert *models.AlertData, prepare func(*models.AlertData)) (*models.AlertData, bool, error) {
+	condition := strings.Join([]string{alert.TwinID, alert.FeaturePath, alert.Severity, alert.Source}, "\x00")
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(condition))
+	lock := &alertConditionLocks[hash.Sum32()%uint32(len(alertConditionLocks))]
+	lock.Lock()
+	defer lock.Unlock()
+
+	inserted := false
+	var alertID string
+	err := r.GetDB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			// Held until the transaction ends, so other instances wait for the alert to be stored
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", condition).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		alertID, err = r.incrementAlertOccurrence(tx, alert)
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if prepare != nil {
+			prepare(alert)
+		}
+		if alert.OccurrenceCount == 0 {
+			alert.OccurrenceCount = 1
+		}
+		if alert.LastSeen.IsZero() {
+			alert.LastSeen = alert.Time
+		}
+		if err := tx.Create(alert).Error; err != nil {
+			return err
+		}
+		inserted = true
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrDatabase) {
+			return nil, false, err
+		}
+		return nil, false, r.handleError(err)
+	}
+
+	if inserted {
+		return alert, true, nil
+	}
+	stored, err := r.GetAlertByID(alertID)
+	return stored, false, err
+}
+
 // GetAlertData retrieves alert data for a specific twin
-func (r *timeseriesRepository) GetAlertData(twinID string, start, end time.Time, severity string, limit int) ([]models.AlertData, error) {
+func (r *timeseriesRepository) GetAlertData(ctx context.Context, twinID string, start, end time.Time, severity string, limit int) ([]models.AlertData, error) {
 	var alerts []models.AlertData
 
-	query := r.GetDB().Where("twin_id = ? AND time >= ? AND time <= ?", twinID, start, end)
+	query := r.GetDB().WithContext(ctx).Where("twin_id = ? AND time >= ? AND time <= ?", twinID, start, end)
 
 	if severity != "" {
 		query = query.Where("severity = ?", severity)
@@ -227,40 +798,104 @@ func (r *timeseriesRepository) GetAlertData(twinID string, start, end time.Time,
 	return alerts, nil
 }
 
-// AcknowledgeAlert acknowledges an alert
-func (r *timeseriesRepository) AcknowledgeAlert(alertID string, ackBy string) error {
+// StreamAlertData calls fn for each alert of a twin in a time range matching the filter,
+// oldest first, reading them through a cursor instead of loading the range into memory
+func (r *timeseriesRepository) StreamAlertData(ctx context.Context, twinID string, start, end time.Time, filter AlertFilter, fn func(*models.AlertData) error) error {
+	query := r.GetDB().WithContext(ctx).Model(&models.AlertData{}).
+		Where("twin_id = ? AND time >= ? AND time <= ?", twinID, start, end)
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.Acknowledged != nil {
+		query = query.Where("acknowledged = ?", *filter.Acknowledged)
+	}
+
+	rows, err := query.Order("time asc").Rows()
+	if err != nil {
+		return r.handleError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var alert models.AlertData
+		if err := r.GetDB().ScanRows(rows, &alert); err != nil {
+			return r.handleError(err)
+		}
+		if err := fn(&alert); err != nil {
+			return err
+		}
+	}
+	return r.handleError(rows.Err())
+}
+
+// ListActiveAlerts returns the unacknowledged alerts of a twin, newest first
+func (r *timeseriesRepository) ListActiveAlerts(ctx context.Context, twinID string, limit int) ([]models.AlertData, error) {
+	var alerts []models.AlertData
+
+	query := r.GetDB().WithContext(ctx).Where("twin_id = ? AND acknowledged = ?", twinID, false)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if err := query.Order("time desc").Find(&alerts).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+
+	return alerts, nil
+}
+
+// GetAlertByID retrieves an alert by its ID, optionally reading only the given columns
+func (r *timeseriesRepository) GetAlertByID(alertID string, columns ...string) (*models.AlertData, error) {
+	var alert models.AlertData
+
+	query := r.GetDB().Where("alert_id = ?", alertID)
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+
+	err := query.Order("time desc").First(&alert).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+
+	return &alert, nil
+}
+
+// AcknowledgeAlert acknowledges an alert, recording who acknowledged it and why
+func (r *timeseriesRepository) AcknowledgeAlert(alertID string, ackBy string, note string) error {
 	result := r.GetDB().Model(&models.AlertData{}).
 		Where("alert_id = ? AND acknowledged = false", alertID).
 		Updates(map[string]interface{}{
 			"acknowledged": true,
 			"ack_by":       ackBy,
 			"ack_time":     time.Now(),
+			"ack_note":     note,
 		})
-
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-
-	return nil
+	return r.handleMutation(result)
 }
 
 // DeleteAlertData deletes an alert
 func (r *timeseriesRepository) DeleteAlertData(alertID string) error {
 	result := r.GetDB().Where("alert_id = ?", alertID).Delete(&models.AlertData{})
+	return r.handleMutation(result)
+}
 
-	if result.Error != nil {
-		return r.handleError(result.Error)
+// CountActiveAlerts counts the unacknowledged alerts of the twins per severity
+func (r *timeseriesRepository) CountActiveAlerts(ctx context.Context, twinIDs []string) ([]AlertSeverityCount, error) {
+	counts := []AlertSeverityCount{}
+	if len(twinIDs) == 0 {
+		return counts, nil
 	}
 
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+	err := r.GetDB().WithContext(ctx).Model(&models.AlertData{}).
+		Select("twin_id, severity, COUNT(*) AS count").
+		Where("twin_id IN ? AND acknowledged = ?", twinIDs, false).
+		Group("twin_id, severity").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, r.handleError(err)
 	}
-
-	return nil
+	return counts, nil
 }
 
 // InsertMLPredictionData inserts ML prediction data
@@ -286,29 +921,47 @@ func (r *timeseriesRepository) InsertMLPredictionBatch(predictions []models.MLPr
 	return r.handleError(tx.Commit().Error)
 }
 
-// GetMLPredictionData retrieves ML prediction data for a specific twin and task
-func (r *timeseriesRepository) GetMLPredictionData(twinID string, taskID string, start, end time.Time, limit int) ([]models.MLPredictionData, error) {
+// GetMLPredictionData retrieves a page of the ML prediction data for a specific twin and task
+// matching the filter, newest first, along with the number of matching predictions
+func (r *timeseriesRepository) GetMLPredictionData(ctx context.Context, twinID string, taskID string, start, end time.Time, filter MLPredictionFilter, limit, offset int) ([]models.MLPredictionData, int64, error) {
 	var predictions []models.MLPredictionData
 
-	query := r.GetDB().Where("twin_id = ? AND task_id = ? AND time >= ? AND time <= ?",
-		twinID, taskID, start, end)
+	query := r.GetDB().WithContext(ctx).Model(&models.MLPredictionData{}).
+		Where("twin_id = ? AND task_id = ? AND time >= ? AND time <= ?", twinID, taskID, start, end)
+	if filter.PredictionType != "" {
+		query = query.Where("prediction_type = ?", filter.PredictionType)
+	}
+	if filter.MinScore != nil {
+		query = query.Where("score_num >= ?", *filter.MinScore)
+	}
+	if filter.Label != "" {
+		query = query.Where("label_str = ?", filter.Label)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
 
 	if limit > 0 {
 		query = query.Limit(limit)
 	}
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
 
 	err := query.Order("time desc").Find(&predictions).Error
 	if err != nil {
-		return nil, r.handleError(err)
+		return nil, 0, r.handleError(err)
 	}
 
-	return predictions, nil
+	return predictions, total, nil
 }
 
 // GetLatestMLPrediction retrieves the latest ML prediction for a twin and task
-func (r *timeseriesRepository) GetLatestMLPrediction(twinID string, taskID string) (*models.MLPredictionData, error) {
+func (r *timeseriesRepository) GetLatestMLPrediction(ctx context.Context, twinID string, taskID string) (*models.MLPredictionData, error) {
 	var prediction models.MLPredictionData
-	err := r.GetDB().Where("twin_id = ? AND task_id = ?", twinID, taskID).
+	err := r.GetDB().WithContext(ctx).Where("twin_id = ? AND task_id = ?", twinID, taskID).
 		Order("time desc").
 		Limit(1).
 		First(&prediction).Error
@@ -320,11 +973,11 @@ func (r *timeseriesRepository) GetLatestMLPrediction(twinID string, taskID strin
 	return &prediction, nil
 }
 
-// DeleteMLPredictionData deletes ML prediction data for a twin and task within a time range
+// DeleteMLPredictionData deletes ML prediction data for a twin and task within a time range,
+// returning ErrNotFound when the range holds no predictions
 func (r *timeseriesRepository) DeleteMLPredictionData(twinID string, taskID string, start, end time.Time) error {
 	result := r.GetDB().Where("twin_id = ? AND task_id = ? AND time >= ? AND time <= ?",
 		twinID, taskID, start, end).
 		Delete(&models.MLPredictionData{})
-
-	return r.handleError(result.Error)
+	return r.handleMutation(result)
 }
@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/digital-egiz/backend/internal/db/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // TwinRepository defines operations for managing twins
@@ -11,8 +16,14 @@ type TwinRepository interface {
 	Create(twin *models.Twin) error
 	GetByID(id uint) (*models.Twin, error)
 	GetByDittoID(dittoID string) (*models.Twin, error)
-	ListByProjectID(projectID uint, offset, limit int) ([]models.Twin, int64, error)
+	GetByName(projectID uint, name string) (*models.Twin, error)
+	ListByProjectID(projectID uint, offset, limit int, tags ...string) ([]models.Twin, int64, error)
+	ListByIDs(ids []uint) ([]models.Twin, error)
+	ListAfterID(afterID uint, limit int) ([]models.Twin, error)
 	Update(twin *models.Twin) error
+	UpdateTags(id uint, tags []string) error
+	SetMLPause(id uint, paused bool, until *time.Time) error
+	ListProjectTags(projectID uint) ([]string, error)
 	Delete(id uint) error
 
 	// Model bindings
@@ -20,6 +31,19 @@ type TwinRepository interface {
 	ListModelBindings(twinID uint) ([]models.ModelBinding, error)
 	UpdateModelBinding(binding *models.ModelBinding) error
 	DeleteModelBinding(id uint) error
+
+	// Feature binding methods
+	GetFeatureBinding(twinID uint, featurePath string) (*models.FeatureBinding, error)
+	ListFeatureBindings(twinID uint) ([]models.FeatureBinding, error)
+	SaveFeatureBinding(binding *models.FeatureBinding) error
+	IncrementTypeViolations(id uint, count int64) error
+	IncrementQuarantinedPoints(id uint, count int64) error
+	DeleteFeatureBinding(id uint) error
+
+	// Ingest sequence numbers
+	GetIngestSequence(twinID uint, featurePath string) (uint64, error)
+	AdvanceIngestSequence(twinID uint, featurePath string, sequence uint64) (bool, error)
+	RevertIngestSequence(twinID uint, featurePath string, sequence, previous uint64) error
 }
 
 // twinRepository implements TwinRepository
@@ -60,19 +84,59 @@ func (r *twinRepository) GetByDittoID(dittoID string) (*models.Twin, error) {
 	return &twin, nil
 }
 
-// ListByProjectID retrieves a paginated list of twins for a project
-func (r *twinRepository) ListByProjectID(projectID uint, offset, limit int) ([]models.Twin, int64, error) {
+// GetByName retrieves a twin of a project by name, ignoring case
+func (r *twinRepository) GetByName(projectID uint, name string) (*models.Twin, error) {
+	var twin models.Twin
+	err := r.GetDB().Where("project_id = ? AND LOWER(name) = LOWER(?)", projectID, name).First(&twin).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &twin, nil
+}
+
+// ListByIDs retrieves the twins with the given IDs; unknown IDs are skipped
+func (r *twinRepository) ListByIDs(ids []uint) ([]models.Twin, error) {
+	twins := []models.Twin{}
+	if len(ids) == 0 {
+		return twins, nil
+	}
+
+	err := r.GetDB().Where("id IN ?", ids).Order("id asc").Find(&twins).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return twins, nil
+}
+
+// ListAfterID retrieves the twins with an ID above afterID in ID order, with their type, so
+// all twins can be walked in batches
+func (r *twinRepository) ListAfterID(afterID uint, limit int) ([]models.Twin, error) {
+	twins := []models.Twin{}
+	err := r.GetDB().Preload("Type").Where("id > ?", afterID).Order("id asc").Limit(limit).Find(&twins).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return twins, nil
+}
+
+// ListByProjectID retrieves a paginated list of twins for a project.
+// If tags are given, only twins carrying all of them are returned.
+func (r *twinRepository) ListByProjectID(projectID uint, offset, limit int, tags ...string) ([]models.Twin, int64, error) {
 	var twins []models.Twin
 	var total int64
 
+	filter, err := r.withTags(r.GetDB().Where("project_id = ?", projectID), tags)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Get total count
-	if err := r.GetDB().Model(&models.Twin{}).Where("project_id = ?", projectID).Count(&total).Error; err != nil {
+	if err := filter.Session(&gorm.Session{}).Model(&models.Twin{}).Count(&total).Error; err != nil {
 		return nil, 0, r.handleError(err)
 	}
 
 	// Get paginated twins
-	err := r.GetDB().Preload("Type").
-		Where("project_id = ?", projectID).
+	err = filter.Session(&gorm.Session{}).Preload("Type").
 		Offset(offset).Limit(limit).
 		Order("id asc").
 		Find(&twins).Error
@@ -86,35 +150,82 @@ func (r *twinRepository) ListByProjectID(projectID uint, offset, limit int) ([]m
 
 // Update updates a twin's information
 func (r *twinRepository) Update(twin *models.Twin) error {
-	// Check if twin exists
-	var existingTwin models.Twin
-	if err := r.GetDB().Where("id = ?", twin.ID).First(&existingTwin).Error; err != nil {
-		return r.handleError(err)
+	// Update the twin
+	result := r.GetDB().Model(&models.Twin{}).Where("id = ?", twin.ID).Updates(map[string]interface{}{
+		"name":                      twin.Name,
+		"description":               twin.Description,
+		"ditto_id":                  twin.DittoID,
+		"type_id":                   twin.TypeID,
+		"model_url":                 twin.ModelURL,
+		"metadata":                  twin.Metadata,
+		"primary_features":          twin.PrimaryFeatures,
+		"raw_retention_days":        twin.RawRetentionDays,
+		"aggregated_retention_days": twin.AggregatedRetentionDays,
+	})
+	return r.handleMutation(result)
+}
+
+// withTags restricts a twin query to twins carrying all the given tags.
+// On PostgreSQL the containment check is served by the GIN index on twins.tags.
+func (r *twinRepository) withTags(query *gorm.DB, tags []string) (*gorm.DB, error) {
+	if len(tags) == 0 {
+		return query, nil
 	}
 
-	// Update the twin
-	err := r.GetDB().Model(twin).Updates(map[string]interface{}{
-		"name":        twin.Name,
-		"description": twin.Description,
-		"ditto_id":    twin.DittoID,
-		"type_id":     twin.TypeID,
-		"model_url":   twin.ModelURL,
-		"metadata":    twin.Metadata,
-	}).Error
+	if r.GetDB().Dialector.Name() == "postgres" {
+		data, err := json.Marshal(tags)
+		if err != nil {
+			return nil, ErrInvalidInput
+		}
+		return query.Where("twins.tags @> ?::jsonb", string(data)), nil
+	}
 
-	return r.handleError(err)
+	for _, tag := range tags {
+		query = query.Where("EXISTS (SELECT 1 FROM json_each(twins.tags) WHERE json_each.value = ?)", tag)
+	}
+	return query, nil
+}
+
+// UpdateTags replaces the tags of a twin
+func (r *twinRepository) UpdateTags(id uint, tags []string) error {
+	result := r.GetDB().Model(&models.Twin{}).Where("id = ?", id).UpdateColumn("tags", models.StringList(tags))
+	return r.handleMutation(result)
+}
+
+// SetMLPause pauses or resumes forwarding a twin's values to ML
+func (r *twinRepository) SetMLPause(id uint, paused bool, until *time.Time) error {
+	result := r.GetDB().Model(&models.Twin{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ml_paused":       paused,
+		"ml_paused_until": until,
+	})
+	return r.handleMutation(result)
+}
+
+// ListProjectTags returns the distinct tags used by twins in a project, sorted
+func (r *twinRepository) ListProjectTags(projectID uint) ([]string, error) {
+	var tags []string
+
+	query := "SELECT DISTINCT json_each.value AS tag FROM twins, json_each(twins.tags) " +
+		"WHERE twins.project_id = ? AND twins.deleted_at IS NULL ORDER BY tag"
+	if r.GetDB().Dialector.Name() == "postgres" {
+		query = "SELECT DISTINCT jsonb_array_elements_text(tags) AS tag FROM twins " +
+			"WHERE project_id = ? AND deleted_at IS NULL ORDER BY tag"
+	}
+
+	if err := r.GetDB().Raw(query, projectID).Scan(&tags).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags, nil
 }
 
 // Delete soft-deletes a twin
 func (r *twinRepository) Delete(id uint) error {
 	result := r.GetDB().Delete(&models.Twin{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // CreateModelBinding adds a new model binding to the database
@@ -135,31 +246,130 @@ func (r *twinRepository) ListModelBindings(twinID uint) ([]models.ModelBinding,
 
 // UpdateModelBinding updates a model binding
 func (r *twinRepository) UpdateModelBinding(binding *models.ModelBinding) error {
-	// Check if binding exists
-	var existingBinding models.ModelBinding
-	if err := r.GetDB().Where("id = ?", binding.ID).First(&existingBinding).Error; err != nil {
-		return r.handleError(err)
-	}
-
 	// Update the binding
-	err := r.GetDB().Model(binding).Updates(map[string]interface{}{
+	result := r.GetDB().Model(&models.ModelBinding{}).Where("id = ?", binding.ID).Updates(map[string]interface{}{
 		"part_id":      binding.PartID,
 		"feature_path": binding.FeaturePath,
 		"binding_type": binding.BindingType,
 		"properties":   binding.Properties,
-	}).Error
-
-	return r.handleError(err)
+	})
+	return r.handleMutation(result)
 }
 
 // DeleteModelBinding deletes a model binding
 func (r *twinRepository) DeleteModelBinding(id uint) error {
 	result := r.GetDB().Delete(&models.ModelBinding{}, id)
+	return r.handleMutation(result)
+}
+
+// GetFeatureBinding retrieves the ingestion settings for a twin feature
+func (r *twinRepository) GetFeatureBinding(twinID uint, featurePath string) (*models.FeatureBinding, error) {
+	var binding models.FeatureBinding
+	err := r.GetDB().Where("twin_id = ? AND feature_path = ?", twinID, featurePath).First(&binding).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &binding, nil
+}
+
+// ListFeatureBindings retrieves all feature bindings for a twin
+func (r *twinRepository) ListFeatureBindings(twinID uint) ([]models.FeatureBinding, error) {
+	var bindings []models.FeatureBinding
+	err := r.GetDB().Where("twin_id = ?", twinID).Order("feature_path asc").Find(&bindings).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return bindings, nil
+}
+
+// SaveFeatureBinding creates or replaces the binding for the twin feature
+func (r *twinRepository) SaveFeatureBinding(binding *models.FeatureBinding) error {
+	var existing models.FeatureBinding
+	err := r.GetDB().Where("twin_id = ? AND feature_path = ?", binding.TwinID, binding.FeaturePath).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.handleError(err)
+	}
+
+	if err == nil {
+		binding.ID = existing.ID
+		binding.CreatedAt = existing.CreatedAt
+		binding.TypeViolations = existing.TypeViolations
+		binding.QuarantinedPoints = existing.QuarantinedPoints
+	}
+
+	return r.handleError(r.GetDB().Save(binding).Error)
+}
+
+// IncrementTypeViolations atomically adds to the type violation counter of a feature binding
+func (r *twinRepository) IncrementTypeViolations(id uint, count int64) error {
+	result := r.GetDB().Model(&models.FeatureBinding{}).
+		Where("id = ?", id).
+		UpdateColumn("type_violations", gorm.Expr("type_violations + ?", count))
+	return r.handleMutation(result)
+}
+
+// IncrementQuarantinedPoints atomically adds to the quarantined point counter of a feature binding
+func (r *twinRepository) IncrementQuarantinedPoints(id uint, count int64) error {
+	result := r.GetDB().Model(&models.FeatureBinding{}).
+		Where("id = ?", id).
+		UpdateColumn("quarantined_points", gorm.Expr("quarantined_points + ?", count))
+	return r.handleMutation(result)
+}
+
+// DeleteFeatureBinding deletes a feature binding
+func (r *twinRepository) DeleteFeatureBinding(id uint) error {
+	result := r.GetDB().Delete(&models.FeatureBinding{}, id)
+	return r.handleMutation(result)
+}
+
+// GetIngestSequence retrieves the last sequence number ingested for a twin feature, 0 if none
+func (r *twinRepository) GetIngestSequence(twinID uint, featurePath string) (uint64, error) {
+	var sequence models.IngestSequence
+	err := r.GetDB().Where("twin_id = ? AND feature_path = ?", twinID, featurePath).Take(&sequence).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, r.handleError(err)
+	}
+	return sequence.LastSequence, nil
+}
+
+// AdvanceIngestSequence atomically raises the last sequence number of a twin feature to the
+// given one, reporting false if it was already at or past it
+func (r *twinRepository) AdvanceIngestSequence(twinID uint, featurePath string, sequence uint64) (bool, error) {
+	now := time.Now()
+	result := r.GetDB().Model(&models.IngestSequence{}).
+		Where("twin_id = ? AND feature_path = ? AND last_sequence < ?", twinID, featurePath, sequence).
+		Updates(map[string]interface{}{"last_sequence": sequence, "updated_at": now})
 	if result.Error != nil {
-		return r.handleError(result.Error)
+		return false, r.handleError(result.Error)
 	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+	if result.RowsAffected > 0 {
+		return true, nil
 	}
-	return nil
+
+	// The first sequence number of a feature creates its row; a concurrent one leaves it unchanged
+	result = r.GetDB().Clauses(clause.OnConflict{DoNothing: true}).Create(&models.IngestSequence{
+		TwinID:       twinID,
+		FeaturePath:  featurePath,
+		LastSequence: sequence,
+		UpdatedAt:    now,
+	})
+	if result.Error != nil {
+		return false, r.handleError(result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RevertIngestSequence resets the last sequence number of a twin feature to the previous one,
+// unless it has moved past the given sequence number since
+func (r *twinRepository) RevertIngestSequence(twinID uint, featurePath string, sequence, previous uint64) error {
+	query := r.GetDB().Where("twin_id = ? AND feature_path = ? AND last_sequence = ?", twinID, featurePath, sequence)
+	if previous == 0 {
+		return r.handleError(query.Delete(&models.IngestSequence{}).Error)
+	}
+	err := query.Model(&models.IngestSequence{}).
+		Updates(map[string]interface{}{"last_sequence": previous, "updated_at": time.Now()}).Error
+	return r.handleError(err)
 }
@@ -5,15 +5,28 @@ import (
 	"gorm.io/gorm"
 )
 
+// TwinTypeUsage counts the twins using a twin type and the ML bindings tied to them
+type TwinTypeUsage struct {
+	Twins    int64
+	Projects int64
+	Bindings int64
+	Tasks    int64
+}
+
 // TwinTypeRepository defines operations for managing twin types
 type TwinTypeRepository interface {
 	Repository
 	Create(twinType *models.TwinType) error
 	GetByID(id uint) (*models.TwinType, error)
 	GetByName(name string) (*models.TwinType, error)
+	GetByDefinition(definition string) (*models.TwinType, error)
 	List(offset, limit int) ([]models.TwinType, int64, error)
 	Update(twinType *models.TwinType) error
 	Delete(id uint) error
+	GetUsage(id uint) (*TwinTypeUsage, error)
+	ListTwins(id uint, offset, limit int) ([]models.Twin, error)
+	SampleTwins(id uint, limit int) ([]models.Twin, int64, error)
+	ListTwinBindings(twinIDs []uint) ([]models.MLTaskBinding, error)
 }
 
 // twinTypeRepository implements TwinTypeRepository
@@ -54,6 +67,16 @@ func (r *twinTypeRepository) GetByName(name string) (*models.TwinType, error) {
 	return &twinType, nil
 }
 
+// GetByDefinition retrieves the oldest twin type derived from a Ditto thing definition
+func (r *twinTypeRepository) GetByDefinition(definition string) (*models.TwinType, error) {
+	var twinType models.TwinType
+	err := r.GetDB().Where("definition = ?", definition).Order("id asc").First(&twinType).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &twinType, nil
+}
+
 // List retrieves a paginated list of twin types
 func (r *twinTypeRepository) List(offset, limit int) ([]models.TwinType, int64, error) {
 	var twinTypes []models.TwinType
@@ -75,31 +98,80 @@ func (r *twinTypeRepository) List(offset, limit int) ([]models.TwinType, int64,
 
 // Update updates a twin type's information
 func (r *twinTypeRepository) Update(twinType *models.TwinType) error {
-	// Check if twin type exists
-	var existingTwinType models.TwinType
-	if err := r.GetDB().Where("id = ?", twinType.ID).First(&existingTwinType).Error; err != nil {
-		return r.handleError(err)
-	}
-
 	// Update the twin type
-	err := r.GetDB().Model(twinType).Updates(map[string]interface{}{
-		"name":        twinType.Name,
-		"description": twinType.Description,
-		"version":     twinType.Version,
-		"schema_json": twinType.SchemaJSON,
-	}).Error
-
-	return r.handleError(err)
+	result := r.GetDB().Model(&models.TwinType{}).Where("id = ?", twinType.ID).Updates(map[string]interface{}{
+		"name":                      twinType.Name,
+		"description":               twinType.Description,
+		"version":                   twinType.Version,
+		"schema_json":               twinType.SchemaJSON,
+		"primary_features":          twinType.PrimaryFeatures,
+		"feature_metadata":          twinType.FeatureMetadata,
+		"feature_aliases":           twinType.FeatureAliases,
+		"raw_retention_days":        twinType.RawRetentionDays,
+		"aggregated_retention_days": twinType.AggregatedRetentionDays,
+	})
+	return r.handleMutation(result)
 }
 
 // Delete soft-deletes a twin type
 func (r *twinTypeRepository) Delete(id uint) error {
 	result := r.GetDB().Delete(&models.TwinType{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
+	return r.handleMutation(result)
+}
+
+// GetUsage counts the twins of a twin type, their projects and the ML bindings and tasks tied to them
+func (r *twinTypeRepository) GetUsage(id uint) (*TwinTypeUsage, error) {
+	var usage TwinTypeUsage
+	err := r.GetDB().Model(&models.Twin{}).
+		Select("COUNT(DISTINCT twins.id) AS twins, COUNT(DISTINCT twins.project_id) AS projects, "+
+			"COUNT(DISTINCT ml_task_bindings.id) AS bindings, COUNT(DISTINCT ml_task_bindings.task_id) AS tasks").
+		Joins("LEFT JOIN ml_task_bindings ON ml_task_bindings.twin_id = twins.id").
+		Where("twins.type_id = ?", id).
+		Scan(&usage).Error
+	if err != nil {
+		return nil, r.handleError(err)
 	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
+	return &usage, nil
+}
+
+// ListTwins retrieves a paginated list of the twins using a twin type
+func (r *twinTypeRepository) ListTwins(id uint, offset, limit int) ([]models.Twin, error) {
+	var twins []models.Twin
+	err := r.GetDB().Where("type_id = ?", id).Offset(offset).Limit(limit).Order("id asc").Find(&twins).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return twins, nil
+}
+
+// SampleTwins retrieves up to limit twins using a twin type, picked at random, with the number of its twins
+func (r *twinTypeRepository) SampleTwins(id uint, limit int) ([]models.Twin, int64, error) {
+	var twins []models.Twin
+	var total int64
+
+	if err := r.GetDB().Model(&models.Twin{}).Where("type_id = ?", id).Count(&total).Error; err != nil {
+		return nil, 0, r.handleError(err)
+	}
+
+	err := r.GetDB().Where("type_id = ?", id).Order("RANDOM()").Limit(limit).Find(&twins).Error
+	if err != nil {
+		return nil, 0, r.handleError(err)
+	}
+	return twins, total, nil
+}
+
+// ListTwinBindings retrieves the ML task bindings of the given twins, joined with their tasks
+func (r *twinTypeRepository) ListTwinBindings(twinIDs []uint) ([]models.MLTaskBinding, error) {
+	var bindings []models.MLTaskBinding
+	if len(twinIDs) == 0 {
+		return bindings, nil
+	}
+	err := r.GetDB().Joins("Task").
+		Where("ml_task_bindings.twin_id IN ?", twinIDs).
+		Order("ml_task_bindings.twin_id asc, ml_task_bindings.id asc").
+		Find(&bindings).Error
+	if err != nil {
+		return nil, r.handleError(err)
 	}
-	return nil
+	return bindings, nil
 }
@@ -2,9 +2,11 @@ package repository
 
 import (
 	"errors"
+	"time"
 
 	"github.com/digital-egiz/backend/internal/db/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // UserRepository defines operations for managing users
@@ -14,10 +16,13 @@ type UserRepository interface {
 	GetByID(id uint) (*models.User, error)
 	GetByEmail(email string) (*models.User, error)
 	List(offset, limit int) ([]models.User, int64, error)
+	ListActiveByRole(role models.Role) ([]models.User, error)
 	Update(user *models.User) error
 	Delete(id uint) error
 	ChangePassword(id uint, newPassword string) error
 	UpdateLastLogin(id uint) error
+	RecordTokenSighting(sighting *models.TokenSighting) (*models.TokenSighting, error)
+	DeleteExpiredTokenSightings(before time.Time) (int64, error)
 }
 
 // userRepository implements UserRepository
@@ -87,6 +92,16 @@ func (r *userRepository) List(offset, limit int) ([]models.User, int64, error) {
 	return users, total, nil
 }
 
+// ListActiveByRole retrieves all active users with a system role
+func (r *userRepository) ListActiveByRole(role models.Role) ([]models.User, error) {
+	var users []models.User
+	err := r.GetDB().Where("role = ? AND active = ?", role, true).Order("id asc").Find(&users).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return users, nil
+}
+
 // Update updates a user's information
 func (r *userRepository) Update(user *models.User) error {
 	// Check if user exists
@@ -108,27 +123,20 @@ func (r *userRepository) Update(user *models.User) error {
 	}
 
 	// Update user but don't modify password field
-	err := r.GetDB().Model(user).Omit("password").Updates(map[string]interface{}{
+	result := r.GetDB().Model(&models.User{}).Where("id = ?", user.ID).Omit("password").Updates(map[string]interface{}{
 		"email":      user.Email,
 		"first_name": user.FirstName,
 		"last_name":  user.LastName,
 		"role":       user.Role,
 		"active":     user.Active,
-	}).Error
-
-	return r.handleError(err)
+	})
+	return r.handleMutation(result)
 }
 
 // Delete soft-deletes a user
 func (r *userRepository) Delete(id uint) error {
 	result := r.GetDB().Delete(&models.User{}, id)
-	if result.Error != nil {
-		return r.handleError(result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return r.handleMutation(result)
 }
 
 // ChangePassword updates a user's password
@@ -142,13 +150,40 @@ func (r *userRepository) ChangePassword(id uint, newPassword string) error {
 		return errors.New("password hashing failed")
 	}
 
-	err := r.GetDB().Model(&user).Update("password", user.Password).Error
-	return r.handleError(err)
+	result := r.GetDB().Model(&user).Update("password", user.Password)
+	return r.handleMutation(result)
 }
 
 // UpdateLastLogin updates the last login timestamp for a user
 func (r *userRepository) UpdateLastLogin(id uint) error {
-	err := r.GetDB().Model(&models.User{}).Where("id = ?", id).
-		UpdateColumn("last_login", gorm.Expr("NOW()")).Error
-	return r.handleError(err)
+	result := r.GetDB().Model(&models.User{}).Where("id = ?", id).
+		UpdateColumn("last_login", gorm.Expr("NOW()"))
+	return r.handleMutation(result)
+}
+
+// RecordTokenSighting stores the sighting of a token unless it was seen before, and returns
+// the token's first sighting. Concurrent first sightings on several instances keep one of them.
+func (r *userRepository) RecordTokenSighting(sighting *models.TokenSighting) (*models.TokenSighting, error) {
+	err := r.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "jti"}},
+		DoNothing: true,
+	}).Create(sighting).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+
+	var first models.TokenSighting
+	if err := r.GetDB().Where("jti = ?", sighting.JTI).First(&first).Error; err != nil {
+		return nil, r.handleError(err)
+	}
+	return &first, nil
+}
+
+// DeleteExpiredTokenSightings deletes the sightings of tokens expired before the given time
+func (r *userRepository) DeleteExpiredTokenSightings(before time.Time) (int64, error) {
+	result := r.GetDB().Where("expires_at < ?", before).Delete(&models.TokenSighting{})
+	if result.Error != nil {
+		return 0, r.handleError(result.Error)
+	}
+	return result.RowsAffected, nil
 }
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"github.com/digital-egiz/backend/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// WebhookRepository defines operations for managing webhook subscriptions
+type WebhookRepository interface {
+	Repository
+	Create(subscription *models.WebhookSubscription) error
+	GetByID(projectID, id uint) (*models.WebhookSubscription, error)
+	ListByProject(projectID uint) ([]models.WebhookSubscription, error)
+	Delete(projectID, id uint) error
+}
+
+// webhookRepository implements WebhookRepository
+type webhookRepository struct {
+	BaseRepository
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *gorm.DB) WebhookRepository {
+	return &webhookRepository{
+		BaseRepository: NewBaseRepository(db),
+	}
+}
+
+// Create adds a new webhook subscription to the database
+func (r *webhookRepository) Create(subscription *models.WebhookSubscription) error {
+	err := r.GetDB().Create(subscription).Error
+	return r.handleError(err)
+}
+
+// GetByID retrieves a webhook subscription of a project by ID
+func (r *webhookRepository) GetByID(projectID, id uint) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := r.GetDB().Where("id = ? AND project_id = ?", id, projectID).First(&subscription).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return &subscription, nil
+}
+
+// ListByProject retrieves all webhook subscriptions of a project
+func (r *webhookRepository) ListByProject(projectID uint) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	err := r.GetDB().Where("project_id = ?", projectID).Order("id asc").Find(&subscriptions).Error
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	return subscriptions, nil
+}
+
+// Delete removes a webhook subscription of a project
+func (r *webhookRepository) Delete(projectID, id uint) error {
+	result := r.GetDB().Where("id = ? AND project_id = ?", id, projectID).Delete(&models.WebhookSubscription{})
+	return r.handleMutation(result)
+}
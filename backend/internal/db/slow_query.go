@@ -0,0 +1,142 @@
+package db
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormutils "gorm.io/gorm/utils"
+)
+
+// slowQueryStartKey holds the time a statement started in its GORM instance settings
+const slowQueryStartKey = "slow_query:start"
+
+// SlowQueryStats counts the statements that exceeded the slow-query threshold
+type SlowQueryStats struct {
+	ThresholdMs int64 `json:"threshold_ms"`
+	Total       int64 `json:"total"`
+	// Operations counts slow statements by kind and table, e.g. "query timeseries_data"
+	Operations []SlowQueryCount `json:"operations"`
+}
+
+// SlowQueryCount is the number of slow statements of one operation
+type SlowQueryCount struct {
+	Operation string `json:"operation"`
+	Count     int64  `json:"count"`
+}
+
+// SlowQueryLog times every statement run through GORM and logs, at warn, those taking at
+// least the threshold, with their SQL, the repository call site and the request ID of their
+// context. Bound values are left out of the logged SQL as they may hold personal data.
+// Statements whose rows are read through a cursor are timed until their first row is ready.
+type SlowQueryLog struct {
+	threshold time.Duration
+	logger    *utils.Logger
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewSlowQueryLog creates a slow-query log for statements taking at least the threshold
+func NewSlowQueryLog(threshold time.Duration, logger *utils.Logger) *SlowQueryLog {
+	return &SlowQueryLog{
+		threshold: threshold,
+		logger:    logger.Named("slow_query"),
+		counts:    make(map[string]int64),
+	}
+}
+
+// Register installs the timing callbacks around every kind of statement of a connection
+func (l *SlowQueryLog) Register(gdb *gorm.DB) error {
+	callbacks := gdb.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Create().After("*").Register("slow_query:end", l.finish("create")),
+		callbacks.Query().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Query().After("*").Register("slow_query:end", l.finish("query")),
+		callbacks.Update().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Update().After("*").Register("slow_query:end", l.finish("update")),
+		callbacks.Delete().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Delete().After("*").Register("slow_query:end", l.finish("delete")),
+		callbacks.Row().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Row().After("*").Register("slow_query:end", l.finish("row")),
+		callbacks.Raw().Before("*").Register("slow_query:start", startSlowQueryTimer),
+		callbacks.Raw().After("*").Register("slow_query:end", l.finish("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns the number of slow statements so far, overall and by operation
+func (l *SlowQueryLog) Stats() SlowQueryStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	stats := SlowQueryStats{
+		ThresholdMs: l.threshold.Milliseconds(),
+		Operations:  make([]SlowQueryCount, 0, len(l.counts)),
+	}
+	for operation, count := range l.counts {
+		stats.Total += count
+		stats.Operations = append(stats.Operations, SlowQueryCount{Operation: operation, Count: count})
+	}
+	sort.Slice(stats.Operations, func(i, j int) bool {
+		if stats.Operations[i].Count != stats.Operations[j].Count {
+			return stats.Operations[i].Count > stats.Operations[j].Count
+		}
+		return stats.Operations[i].Operation < stats.Operations[j].Operation
+	})
+	return stats
+}
+
+// startSlowQueryTimer records when a statement starts
+func startSlowQueryTimer(db *gorm.DB) {
+	db.InstanceSet(slowQueryStartKey, time.Now())
+}
+
+// finish returns the callback logging and counting statements of a kind that were slow
+func (l *SlowQueryLog) finish(kind string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(slowQueryStartKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+		duration := time.Since(start)
+		if duration < l.threshold {
+			return
+		}
+
+		operation := kind
+		if db.Statement.Table != "" {
+			operation += " " + db.Statement.Table
+		}
+		l.mu.Lock()
+		l.counts[operation]++
+		l.mu.Unlock()
+
+		fields := []zap.Field{
+			zap.String("operation", operation),
+			zap.Duration("duration", duration),
+			zap.String("sql", db.Statement.SQL.String()),
+			zap.Int64("rows", db.Statement.RowsAffected),
+			zap.String("caller", gormutils.FileWithLineNum()),
+		}
+		if requestID := utils.RequestIDFrom(db.Statement.Context); requestID != "" {
+			fields = append(fields, zap.String("request_id", requestID))
+		}
+		if db.Error != nil {
+			fields = append(fields, zap.Error(db.Error))
+		}
+		l.logger.Warn("Slow query", fields...)
+	}
+}
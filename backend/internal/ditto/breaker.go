@@ -0,0 +1,200 @@
+package ditto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrDittoUnavailable is returned without contacting Ditto while the circuit breaker is open
+var ErrDittoUnavailable = errors.New("ditto is unavailable")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState string
+
+// Circuit breaker states
+const (
+	// BreakerClosed lets requests through and counts consecutive failures
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen fails requests fast until the open timeout has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single probe request through to test whether Ditto recovered
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// BreakerStats reports the state and counters of a circuit breaker
+type BreakerStats struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	Opened              int64        `json:"opened"`
+	Rejected            int64        `json:"rejected"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+}
+
+// CircuitBreaker stops calling Ditto after a number of consecutive failures. Once the open
+// timeout has passed it half-opens and lets one probe through: a successful probe closes it,
+// a failed one opens it again.
+type CircuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	opened    int64
+	rejected  int64
+	listeners []func(from, to BreakerState)
+}
+
+// NewCircuitBreaker creates a closed circuit breaker; a threshold of 0 disables it
+func NewCircuitBreaker(threshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold:   threshold,
+		openTimeout: openTimeout,
+		now:         time.Now,
+		state:       BreakerClosed,
+	}
+}
+
+// SetClock replaces the breaker's time source, for tests
+func (b *CircuitBreaker) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = now
+}
+
+// OnStateChange registers a function called after each state transition
+func (b *CircuitBreaker) OnStateChange(listener func(from, to BreakerState)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, listener)
+}
+
+// Allow returns ErrDittoUnavailable if a request may not be sent now. Every allowed
+// request must be followed by a call to Record with its outcome.
+func (b *CircuitBreaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	var from BreakerState
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			b.rejected++
+			b.mu.Unlock()
+			return ErrDittoUnavailable
+		}
+		from = b.transition(BreakerHalfOpen)
+		b.probing = true
+	case BreakerHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			b.rejected++
+			b.mu.Unlock()
+			return ErrDittoUnavailable
+		}
+		b.probing = true
+	}
+	listeners := b.listeners
+	b.mu.Unlock()
+
+	if from != "" {
+		notify(listeners, from, BreakerHalfOpen)
+	}
+	return nil
+}
+
+// Record reports the outcome of an allowed request
+func (b *CircuitBreaker) Record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	var from, to BreakerState
+	if !IsUnavailableError(err) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			from, to = b.transition(BreakerClosed), BreakerClosed
+		}
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= b.threshold) {
+			from, to = b.transition(BreakerOpen), BreakerOpen
+			b.openedAt = b.now()
+			b.opened++
+		}
+	}
+	b.probing = false
+	listeners := b.listeners
+	b.mu.Unlock()
+
+	if from != "" {
+		notify(listeners, from, to)
+	}
+}
+
+// State returns the current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Stats returns the breaker's state and counters
+func (b *CircuitBreaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BreakerStats{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Opened:              b.opened,
+		Rejected:            b.rejected,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		stats.OpenedAt = &openedAt
+	}
+	return stats
+}
+
+// transition changes the state and returns the previous one; the caller must hold the lock
+func (b *CircuitBreaker) transition(to BreakerState) BreakerState {
+	from := b.state
+	b.state = to
+	return from
+}
+
+// notify calls the state change listeners outside the breaker's lock
+func notify(listeners []func(from, to BreakerState), from, to BreakerState) {
+	for _, listener := range listeners {
+		listener(from, to)
+	}
+}
+
+// IsUnavailableError reports whether an error means Ditto could not serve the request:
+// transport errors, timeouts and 5xx or 429 responses. Other Ditto errors, such as 404,
+// show Ditto is up, and a caller cancelling its request says nothing about Ditto.
+func IsUnavailableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var dittoErr *DittoError
+	if errors.As(err, &dittoErr) {
+		return dittoErr.Status >= http.StatusInternalServerError || dittoErr.Status == http.StatusTooManyRequests
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status >= http.StatusInternalServerError || statusErr.Status == http.StatusTooManyRequests
+	}
+	return true
+}
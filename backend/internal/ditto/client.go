@@ -5,20 +5,27 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
 )
 
-// Client is a client for the Eclipse Ditto HTTP API
+// Client is a client for the Eclipse Ditto HTTP API.
+// Requests go through a circuit breaker that fails fast with ErrDittoUnavailable while Ditto is down.
 type Client struct {
 	config     *config.DittoConfig
 	logger     *utils.Logger
 	httpClient *http.Client
+	breaker    *CircuitBreaker
+	echoes     *EchoTracker
 }
 
 // Thing represents a Digital Twin in Eclipse Ditto
@@ -88,15 +95,45 @@ func (e *DittoError) Error() string {
 	return fmt.Sprintf("Ditto API error: %d %s - %s", e.Status, e.ErrorCode, e.Message)
 }
 
+// HTTPStatusError is returned for error responses whose body is not a Ditto error
+type HTTPStatusError struct {
+	Status int
+	Body   string
+}
+
+// Error returns the error message
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP error %d: %s", e.Status, e.Body)
+}
+
 // NewClient creates a new Ditto client
 func NewClient(cfg *config.DittoConfig, logger *utils.Logger) *Client {
-	return &Client{
+	client := &Client{
 		config: cfg,
 		logger: logger.Named("ditto"),
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		breaker: NewCircuitBreaker(cfg.BreakerThreshold, time.Duration(cfg.BreakerOpenTimeout)*time.Second),
+		echoes:  NewEchoTracker(time.Duration(cfg.EchoSuppressionWindow) * time.Second),
 	}
+
+	client.breaker.OnStateChange(func(from, to BreakerState) {
+		client.logger.Warn("Ditto circuit breaker changed state",
+			zap.String("from", string(from)),
+			zap.String("to", string(to)))
+	})
+	return client
+}
+
+// Breaker returns the circuit breaker guarding the client's requests
+func (c *Client) Breaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// Echoes returns the tracker of the writes whose events are suppressed when echoed
+func (c *Client) Echoes() *EchoTracker {
+	return c.echoes
 }
 
 // buildURL builds a URL for the Ditto API
@@ -133,6 +170,28 @@ func (c *Client) execute(ctx context.Context, method, path string, body interfac
 		req.Header.Set("Authorization", "Basic "+encoded)
 	}
 
+	if condition := conditionOf(ctx); condition != "" {
+		req.Header.Set(HeaderCondition, condition)
+	}
+
+	// Tag writes whose echo must be suppressed with a correlation ID Ditto returns on the event
+	if method != http.MethodGet && suppressesEcho(ctx) {
+		if id := c.echoes.Track(); id != "" {
+			req.Header.Set(HeaderCorrelationID, id)
+		}
+	}
+
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	responseBody, err := c.do(req)
+	c.breaker.Record(err)
+	return responseBody, err
+}
+
+// do sends a request and returns the response body, or the error Ditto responded with
+func (c *Client) do(req *http.Request) ([]byte, error) {
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute request: %w", err)
@@ -148,7 +207,11 @@ func (c *Client) execute(ctx context.Context, method, path string, body interfac
 	if resp.StatusCode >= 400 {
 		var dittoErr DittoError
 		if err := json.Unmarshal(responseBody, &dittoErr); err != nil {
-			return nil, fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(responseBody))
+			return nil, &HTTPStatusError{Status: resp.StatusCode, Body: string(responseBody)}
+		}
+
+		if dittoErr.Status == 0 {
+			dittoErr.Status = resp.StatusCode
 		}
 
 		// Try to unmarshal the raw error response too
@@ -220,6 +283,14 @@ func (c *Client) UpdateThing(ctx context.Context, thingID string, thing *Thing)
 	return &updatedThing, nil
 }
 
+// UpdateThingPolicyID points an existing thing at another policy
+func (c *Client) UpdateThingPolicyID(ctx context.Context, thingID, policyID string) error {
+	path := fmt.Sprintf("/things/%s/policyId", thingID)
+
+	_, err := c.execute(ctx, http.MethodPut, path, policyID)
+	return err
+}
+
 // DeleteThing deletes a thing
 func (c *Client) DeleteThing(ctx context.Context, thingID string) error {
 	path := fmt.Sprintf("/things/%s", thingID)
@@ -311,6 +382,46 @@ func (c *Client) GetFeature(ctx context.Context, thingID, featureID string) (*Fe
 	return &feature, nil
 }
 
+// GetAllFeatures retrieves all features of a thing in one request.
+// A thing without features yields an empty map.
+func (c *Client) GetAllFeatures(ctx context.Context, thingID string) (map[string]Feature, error) {
+	return c.GetFeaturesProjected(ctx, thingID, nil)
+}
+
+// GetFeaturesProjected retrieves only the given paths of a thing's features using Ditto's
+// fields selector. Paths are relative to the features, e.g. "temperature" for a whole
+// feature or "temperature/properties/value" for a single property; no paths selects all.
+func (c *Client) GetFeaturesProjected(ctx context.Context, thingID string, paths []string) (map[string]Feature, error) {
+	path := fmt.Sprintf("/things/%s/features", thingID)
+	if len(paths) > 0 {
+		fields := make([]string, 0, len(paths))
+		for _, p := range paths {
+			if p = strings.Trim(p, "/ "); p != "" {
+				fields = append(fields, p)
+			}
+		}
+		if len(fields) > 0 {
+			path += "?fields=" + url.QueryEscape(strings.Join(fields, ","))
+		}
+	}
+
+	responseBody, err := c.execute(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		var dittoErr *DittoError
+		if errors.As(err, &dittoErr) && dittoErr.ErrorCode == "things:features.notfound" {
+			return map[string]Feature{}, nil
+		}
+		return nil, err
+	}
+
+	features := make(map[string]Feature)
+	if err := json.Unmarshal(responseBody, &features); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	return features, nil
+}
+
 // UpdateFeature updates a feature of a thing
 func (c *Client) UpdateFeature(ctx context.Context, thingID, featureID string, feature *Feature) (*Feature, error) {
 	return c.CreateFeature(ctx, thingID, featureID, feature)
@@ -341,6 +452,15 @@ func (c *Client) UpdateFeatureProperties(ctx context.Context, thingID, featureID
 	return &updatedProperties, nil
 }
 
+// UpdateFeatureProperty creates or replaces a single feature property, leaving the others intact.
+// The property path may address a nested property, e.g. "anomaly/score".
+func (c *Client) UpdateFeatureProperty(ctx context.Context, thingID, featureID, propertyPath string, value interface{}) error {
+	path := fmt.Sprintf("/things/%s/features/%s/properties/%s", thingID, featureID, strings.Trim(propertyPath, "/"))
+
+	_, err := c.execute(ctx, http.MethodPut, path, value)
+	return err
+}
+
 // GetFeatureProperties retrieves the properties of a feature
 func (c *Client) GetFeatureProperties(ctx context.Context, thingID, featureID string) (*FeatureProperties, error) {
 	path := fmt.Sprintf("/things/%s/features/%s/properties", thingID, featureID)
@@ -392,7 +512,7 @@ func (c *Client) GetPolicy(ctx context.Context, policyID string) (*Policy, error
 	return &policy, nil
 }
 
-// UpdatePolicy updates a policy
+// UpdatePolicy creates or replaces a policy
 func (c *Client) UpdatePolicy(ctx context.Context, policyID string, policy *Policy) (*Policy, error) {
 	path := fmt.Sprintf("/policies/%s", policyID)
 
@@ -401,6 +521,11 @@ func (c *Client) UpdatePolicy(ctx context.Context, policyID string, policy *Poli
 		return nil, err
 	}
 
+	// Ditto answers a replaced policy with 204 No Content
+	if len(responseBody) == 0 {
+		return policy, nil
+	}
+
 	var updatedPolicy Policy
 	if err := json.Unmarshal(responseBody, &updatedPolicy); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
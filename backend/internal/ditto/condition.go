@@ -0,0 +1,70 @@
+package ditto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// HeaderCondition is the Ditto header holding the RQL condition a request only applies under
+const HeaderCondition = "condition"
+
+// conditionKey holds the RQL condition of the requests made with a context
+type conditionKey struct{}
+
+// WithCondition makes requests made with the returned context conditional: Ditto only applies
+// them if the thing matches the RQL condition, and fails them with 412 otherwise
+func WithCondition(ctx context.Context, condition string) context.Context {
+	return context.WithValue(ctx, conditionKey{}, condition)
+}
+
+// conditionOf returns the condition the context was marked with by WithCondition, if any
+func conditionOf(ctx context.Context) string {
+	condition, _ := ctx.Value(conditionKey{}).(string)
+	return condition
+}
+
+// FeaturePropertyCondition returns the RQL condition matching a thing whose feature property
+// equals the value. The property path may address a nested property, e.g. "status/state";
+// the value must be a string, number, boolean or null.
+func FeaturePropertyCondition(featureID, propertyPath string, value interface{}) (string, error) {
+	propertyPath = strings.Trim(propertyPath, "/")
+	if featureID == "" || strings.ContainsAny(featureID, "/\"*(),") {
+		return "", fmt.Errorf("invalid feature ID: %q", featureID)
+	}
+	if propertyPath == "" || strings.ContainsAny(propertyPath, "\"*(),") {
+		return "", fmt.Errorf("invalid property path: %q", propertyPath)
+	}
+
+	var literal string
+	switch v := value.(type) {
+	case string:
+		literal = rqlString(v)
+	case nil:
+		literal = "null"
+	case bool, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		literal = string(data)
+	default:
+		return "", fmt.Errorf("unsupported condition value of type %T", value)
+	}
+
+	return fmt.Sprintf("eq(features/%s/properties/%s,%s)", featureID, propertyPath, literal), nil
+}
+
+// IsConditionFailed reports whether Ditto refused a conditional request because the thing
+// did not match its condition
+func IsConditionFailed(err error) bool {
+	var dittoErr *DittoError
+	if errors.As(err, &dittoErr) {
+		return dittoErr.Status == http.StatusPreconditionFailed
+	}
+	var statusErr *HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.Status == http.StatusPreconditionFailed
+}
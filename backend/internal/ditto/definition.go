@@ -0,0 +1,297 @@
+package ditto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnresolvableDefinition is returned when a thing definition does not lead to a Thing Model
+// that can be fetched and parsed
+var ErrUnresolvableDefinition = errors.New("thing definition cannot be resolved")
+
+// Thing Model resolution limits
+const (
+	definitionTimeout = 10 * time.Second
+	maxThingModelSize = 1 << 20
+	// definitionFailureTTL is how long a failed resolution is remembered before it is retried
+	definitionFailureTTL = time.Minute
+)
+
+// ThingModel is a W3C WoT Thing Model, as far as twin types are derived from it. As in Ditto,
+// the model's properties describe the thing's attributes and its submodels the thing's features.
+type ThingModel struct {
+	// Definition is the URL the model was fetched from
+	Definition  string
+	Title       string
+	Description string
+	Version     string
+	// Properties holds the data schema of each property affordance by name
+	Properties map[string]map[string]interface{}
+	// Submodels holds the models linked as tm:submodel by the feature name they are instantiated as
+	Submodels map[string]*ThingModel
+}
+
+// thingModelDocument is the JSON-LD document of a Thing Model
+type thingModelDocument struct {
+	Type        json.RawMessage                   `json:"@type"`
+	Title       string                            `json:"title"`
+	Description string                            `json:"description"`
+	Version     json.RawMessage                   `json:"version"`
+	Properties  map[string]map[string]interface{} `json:"properties"`
+	Links       []struct {
+		Rel          string `json:"rel"`
+		Href         string `json:"href"`
+		InstanceName string `json:"instanceName"`
+	} `json:"links"`
+}
+
+// cachedThingModel is a resolution remembered until it expires
+type cachedThingModel struct {
+	model   *ThingModel
+	err     error
+	expires time.Time
+}
+
+// DefinitionResolver fetches the WoT Thing Models that thing definitions reference and caches
+// them. Models are only fetched from the allowed hosts, so thing definitions cannot make the
+// backend request arbitrary URLs.
+type DefinitionResolver struct {
+	hosts []string
+	// repository is a URL template resolving namespace:name:version definitions
+	repository string
+	ttl        time.Duration
+	client     *http.Client
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedThingModel
+}
+
+// NewDefinitionResolver creates a resolver fetching Thing Models from the hosts, where "*.example.com"
+// allows the subdomains of example.com, and caching them for the TTL. Definitions of the form
+// namespace:name:version are resolved with the repository URL template, whose {namespace},
+// {name} and {version} are replaced; they are unresolvable without one.
+func NewDefinitionResolver(hosts []string, repository string, ttl time.Duration) *DefinitionResolver {
+	return &DefinitionResolver{
+		hosts:      hosts,
+		repository: repository,
+		ttl:        ttl,
+		client:     &http.Client{Timeout: definitionTimeout},
+		now:        time.Now,
+		cache:      make(map[string]cachedThingModel),
+	}
+}
+
+// SetClock replaces the resolver's time source, for tests
+func (r *DefinitionResolver) SetClock(now func() time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.now = now
+}
+
+// Resolve returns the Thing Model a thing definition references, with its submodels
+func (r *DefinitionResolver) Resolve(ctx context.Context, definition string) (*ThingModel, error) {
+	modelURL, err := r.modelURL(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	model, err := r.resolveURL(ctx, modelURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := *model
+	resolved.Submodels = make(map[string]*ThingModel, len(model.Submodels))
+	for name := range model.Submodels {
+		submodel, err := r.resolveURL(ctx, model.Submodels[name].Definition)
+		if err != nil {
+			return nil, fmt.Errorf("submodel %s: %w", name, err)
+		}
+		resolved.Submodels[name] = submodel
+	}
+	return &resolved, nil
+}
+
+// modelURL returns the URL of the Thing Model a definition references
+func (r *DefinitionResolver) modelURL(definition string) (string, error) {
+	definition = strings.TrimSpace(definition)
+	if strings.HasPrefix(definition, "http://") || strings.HasPrefix(definition, "https://") {
+		return definition, nil
+	}
+
+	parts := strings.Split(definition, ":")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return "", fmt.Errorf("%w: %q is neither a Thing Model URL nor namespace:name:version", ErrUnresolvableDefinition, definition)
+	}
+	if r.repository == "" {
+		return "", fmt.Errorf("%w: no model repository is configured for %q", ErrUnresolvableDefinition, definition)
+	}
+	return strings.NewReplacer(
+		"{namespace}", url.PathEscape(parts[0]),
+		"{name}", url.PathEscape(parts[1]),
+		"{version}", url.PathEscape(parts[2]),
+	).Replace(r.repository), nil
+}
+
+// resolveURL returns the Thing Model at a URL from the cache, or fetches it. Its submodels
+// only hold their URL.
+func (r *DefinitionResolver) resolveURL(ctx context.Context, modelURL string) (*ThingModel, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[modelURL]
+	now := r.now()
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.model, cached.err
+	}
+
+	model, err := r.fetch(ctx, modelURL)
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+
+	ttl := r.ttl
+	if err != nil && (ttl <= 0 || ttl > definitionFailureTTL) {
+		ttl = definitionFailureTTL
+	}
+	r.mu.Lock()
+	r.cache[modelURL] = cachedThingModel{model: model, err: err, expires: now.Add(ttl)}
+	r.mu.Unlock()
+	return model, err
+}
+
+// fetch downloads and parses the Thing Model at a URL
+func (r *DefinitionResolver) fetch(ctx context.Context, modelURL string) (*ThingModel, error) {
+	parsed, err := url.Parse(modelURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("%w: %q is not an http(s) URL", ErrUnresolvableDefinition, modelURL)
+	}
+	if !r.allowed(parsed.Hostname()) {
+		return nil, fmt.Errorf("%w: host %s is not allowed", ErrUnresolvableDefinition, parsed.Hostname())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, modelURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnresolvableDefinition, err)
+	}
+	req.Header.Set("Accept", "application/tm+json, application/ld+json, application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %s is unreachable: %v", ErrUnresolvableDefinition, modelURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %d", ErrUnresolvableDefinition, modelURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxThingModelSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading %s: %v", ErrUnresolvableDefinition, modelURL, err)
+	}
+	if len(body) > maxThingModelSize {
+		return nil, fmt.Errorf("%w: %s exceeds %d bytes", ErrUnresolvableDefinition, modelURL, maxThingModelSize)
+	}
+	return parseThingModel(parsed, body)
+}
+
+// allowed reports whether Thing Models may be fetched from a host
+func (r *DefinitionResolver) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range r.hosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseThingModel parses a Thing Model document, resolving the URLs of its submodels against
+// the document's URL
+func parseThingModel(modelURL *url.URL, body []byte) (*ThingModel, error) {
+	var document thingModelDocument
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("%w: %s is not valid JSON: %v", ErrUnresolvableDefinition, modelURL, err)
+	}
+	if !isThingModelType(document.Type) {
+		return nil, fmt.Errorf("%w: %s is not a Thing Model, its @type lacks tm:ThingModel", ErrUnresolvableDefinition, modelURL)
+	}
+
+	model := &ThingModel{
+		Definition:  modelURL.String(),
+		Title:       document.Title,
+		Description: document.Description,
+		Version:     thingModelVersion(document.Version),
+		Properties:  document.Properties,
+		Submodels:   make(map[string]*ThingModel),
+	}
+	if model.Properties == nil {
+		model.Properties = make(map[string]map[string]interface{})
+	}
+
+	for _, link := range document.Links {
+		if link.Rel != "tm:submodel" {
+			continue
+		}
+		href, err := modelURL.Parse(link.Href)
+		if err != nil || link.Href == "" {
+			return nil, fmt.Errorf("%w: %s links an invalid submodel %q", ErrUnresolvableDefinition, modelURL, link.Href)
+		}
+		// Submodels without an instance name are instantiated under the last segment of their URL
+		name := link.InstanceName
+		if name == "" {
+			name = strings.TrimSuffix(strings.TrimSuffix(href.Path[strings.LastIndex(href.Path, "/")+1:], ".jsonld"), ".tm")
+		}
+		model.Submodels[name] = &ThingModel{Definition: href.String()}
+	}
+	return model, nil
+}
+
+// isThingModelType reports whether a JSON-LD @type, a string or a list of them, is tm:ThingModel
+func isThingModelType(raw json.RawMessage) bool {
+	var types []string
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		types = []string{single}
+	} else if err := json.Unmarshal(raw, &types); err != nil {
+		return false
+	}
+	for _, t := range types {
+		if t == "tm:ThingModel" {
+			return true
+		}
+	}
+	return false
+}
+
+// thingModelVersion returns the model version of a Thing Model, declared as {"model": "1.0.0"}
+// or, informally, as a string
+func thingModelVersion(raw json.RawMessage) string {
+	var version struct {
+		Model    string `json:"model"`
+		Instance string `json:"instance"`
+	}
+	if err := json.Unmarshal(raw, &version); err == nil {
+		if version.Model != "" {
+			return version.Model
+		}
+		return version.Instance
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return ""
+}
@@ -47,14 +47,54 @@ func (m *Manager) Disconnect() error {
 	return m.wsClient.Disconnect()
 }
 
+// SetTokenProvider makes the WebSocket connection authenticate with tokens from the provider
+func (m *Manager) SetTokenProvider(provider TokenProvider) {
+	m.wsClient.SetTokenProvider(provider)
+}
+
+// BreakerStats returns the state and counters of the circuit breaker guarding HTTP API requests
+func (m *Manager) BreakerStats() BreakerStats {
+	return m.httpClient.Breaker().Stats()
+}
+
+// IsEcho reports whether an event was caused by a write of the backend made with a
+// SuppressEcho context, within the echo suppression window
+func (m *Manager) IsEcho(event *DittoEvent) bool {
+	return m.httpClient.Echoes().IsEcho(event)
+}
+
 // IsConnected returns whether the WebSocket is connected
 func (m *Manager) IsConnected() bool {
 	return m.wsClient.IsConnected()
 }
 
-// SubscribeToThings subscribes to thing change events
-func (m *Manager) SubscribeToThings(filter string) error {
-	return m.wsClient.SubscribeToThings(filter)
+// SubscribeToThings subscribes to thing change events in the given namespaces (all if empty)
+func (m *Manager) SubscribeToThings(filter string, namespaces []string) error {
+	return m.wsClient.SubscribeToThings(filter, namespaces)
+}
+
+// SubscribeToProjects subscribes to thing change events in the namespaces of the given projects,
+// replacing the previous subscription. Without projects events are no longer sent at all.
+func (m *Manager) SubscribeToProjects(filter string, projectIDs []uint) error {
+	if len(projectIDs) == 0 {
+		// An empty namespace list would subscribe to every namespace
+		return m.wsClient.Unsubscribe()
+	}
+	namespaces := make([]string, 0, len(projectIDs))
+	for _, projectID := range projectIDs {
+		namespaces = append(namespaces, m.ProjectNamespace(projectID))
+	}
+	return m.wsClient.SubscribeToThings(filter, namespaces)
+}
+
+// ProjectNamespace returns the Ditto namespace for a project
+func (m *Manager) ProjectNamespace(projectID uint) string {
+	return ProjectNamespace(m.config.NamespacePrefix, projectID)
+}
+
+// ProjectIDForThing returns the project a thing belongs to based on its namespace
+func (m *Manager) ProjectIDForThing(thingID string) (uint, bool) {
+	return ProjectIDFromNamespace(m.config.NamespacePrefix, NamespaceOf(thingID))
 }
 
 // SubscribeToThing subscribes to events for a specific thing
@@ -87,6 +127,11 @@ func (m *Manager) UpdateThing(ctx context.Context, thingID string, thing *Thing)
 	return m.httpClient.UpdateThing(ctx, thingID, thing)
 }
 
+// UpdateThingPolicyID points an existing thing at another policy
+func (m *Manager) UpdateThingPolicyID(ctx context.Context, thingID, policyID string) error {
+	return m.httpClient.UpdateThingPolicyID(ctx, thingID, policyID)
+}
+
 // DeleteThing deletes a thing
 func (m *Manager) DeleteThing(ctx context.Context, thingID string) error {
 	return m.httpClient.DeleteThing(ctx, thingID)
@@ -107,6 +152,16 @@ func (m *Manager) GetFeature(ctx context.Context, thingID, featureID string) (*F
 	return m.httpClient.GetFeature(ctx, thingID, featureID)
 }
 
+// GetAllFeatures retrieves all features of a thing in one request
+func (m *Manager) GetAllFeatures(ctx context.Context, thingID string) (map[string]Feature, error) {
+	return m.httpClient.GetAllFeatures(ctx, thingID)
+}
+
+// GetFeaturesProjected retrieves only the given feature and property paths of a thing's features
+func (m *Manager) GetFeaturesProjected(ctx context.Context, thingID string, paths []string) (map[string]Feature, error) {
+	return m.httpClient.GetFeaturesProjected(ctx, thingID, paths)
+}
+
 // UpdateFeature updates a feature of a thing
 func (m *Manager) UpdateFeature(ctx context.Context, thingID, featureID string, feature *Feature) (*Feature, error) {
 	return m.httpClient.UpdateFeature(ctx, thingID, featureID, feature)
@@ -122,6 +177,11 @@ func (m *Manager) UpdateFeatureProperties(ctx context.Context, thingID, featureI
 	return m.httpClient.UpdateFeatureProperties(ctx, thingID, featureID, properties)
 }
 
+// UpdateFeatureProperty creates or replaces a single feature property
+func (m *Manager) UpdateFeatureProperty(ctx context.Context, thingID, featureID, propertyPath string, value interface{}) error {
+	return m.httpClient.UpdateFeatureProperty(ctx, thingID, featureID, propertyPath, value)
+}
+
 // GetFeatureProperties retrieves the properties of a feature
 func (m *Manager) GetFeatureProperties(ctx context.Context, thingID, featureID string) (*FeatureProperties, error) {
 	return m.httpClient.GetFeatureProperties(ctx, thingID, featureID)
@@ -137,7 +197,7 @@ func (m *Manager) GetPolicy(ctx context.Context, policyID string) (*Policy, erro
 	return m.httpClient.GetPolicy(ctx, policyID)
 }
 
-// UpdatePolicy updates a policy
+// UpdatePolicy creates or replaces a policy
 func (m *Manager) UpdatePolicy(ctx context.Context, policyID string, policy *Policy) (*Policy, error) {
 	return m.httpClient.UpdatePolicy(ctx, policyID, policy)
 }
@@ -0,0 +1,101 @@
+package ditto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// HeaderCorrelationID is the Ditto header that commands are tagged with and that the
+// events they cause carry back
+const HeaderCorrelationID = "correlation-id"
+
+// correlationPrefix marks the correlation IDs of the backend's own writes
+const correlationPrefix = "digital-egiz-"
+
+// suppressEchoKey marks a context whose Ditto writes must not be processed again when echoed
+type suppressEchoKey struct{}
+
+// SuppressEcho marks writes made with the returned context as originating from the backend,
+// so the events Ditto echoes back for them within the echo window are reported by IsEcho
+func SuppressEcho(ctx context.Context) context.Context {
+	return context.WithValue(ctx, suppressEchoKey{}, true)
+}
+
+// suppressesEcho reports whether the context was marked with SuppressEcho
+func suppressesEcho(ctx context.Context) bool {
+	suppress, _ := ctx.Value(suppressEchoKey{}).(bool)
+	return suppress
+}
+
+// CorrelationID returns the correlation ID header of an event, if any
+func (e *DittoEvent) CorrelationID() string {
+	id, _ := e.Headers[HeaderCorrelationID].(string)
+	return id
+}
+
+// EchoTracker remembers the correlation IDs of the backend's own writes for a window, so
+// the events Ditto sends back for them are recognised as echoes
+type EchoTracker struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+// NewEchoTracker creates an echo tracker; a window of 0 disables it
+func NewEchoTracker(window time.Duration) *EchoTracker {
+	return &EchoTracker{
+		window:  window,
+		now:     time.Now,
+		expires: make(map[string]time.Time),
+	}
+}
+
+// SetClock replaces the tracker's time source, for tests
+func (t *EchoTracker) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.now = now
+}
+
+// Track returns a new correlation ID for a write and remembers it for the window.
+// It returns an empty ID when the tracker is disabled.
+func (t *EchoTracker) Track() string {
+	if t.window <= 0 {
+		return ""
+	}
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := correlationPrefix + hex.EncodeToString(buf)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for tracked, expires := range t.expires {
+		if now.After(expires) {
+			delete(t.expires, tracked)
+		}
+	}
+	t.expires[id] = now.Add(t.window)
+	return id
+}
+
+// IsEcho reports whether the event was caused by a tracked write within the window
+func (t *EchoTracker) IsEcho(event *DittoEvent) bool {
+	id := event.CorrelationID()
+	if id == "" {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expires, ok := t.expires[id]
+	return ok && !t.now().After(expires)
+}
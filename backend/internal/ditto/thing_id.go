@@ -0,0 +1,99 @@
+package ditto
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// projectNamespaceSegment is appended to the configured prefix, followed by the project ID
+const projectNamespaceSegment = "project"
+
+var (
+	// namespacePattern follows Ditto's namespace rules (dot-separated Java-package-like segments)
+	namespacePattern = regexp.MustCompile(`^[a-zA-Z]\w*(\.[a-zA-Z]\w*)*$`)
+	// thingNamePattern rejects characters Ditto does not allow in the name part of a thing ID
+	thingNamePattern = regexp.MustCompile(`^[^\x00-\x1F\x7F/]+$`)
+)
+
+// ProjectNamespace returns the Ditto namespace used for a project's things,
+// e.g. prefix "org.digitalegiz" and project 42 give "org.digitalegiz.project42"
+func ProjectNamespace(prefix string, projectID uint) string {
+	return fmt.Sprintf("%s.%s%d", prefix, projectNamespaceSegment, projectID)
+}
+
+// ProjectPolicyID returns the ID of the Ditto policy shared by a project's things,
+// e.g. "org.digitalegiz.project42:policy"
+func ProjectPolicyID(prefix string, projectID uint) string {
+	return ProjectNamespace(prefix, projectID) + ":policy"
+}
+
+// ProjectIDFromNamespace extracts the project ID from a namespace built by ProjectNamespace
+func ProjectIDFromNamespace(prefix, namespace string) (uint, bool) {
+	rest, ok := strings.CutPrefix(namespace, prefix+"."+projectNamespaceSegment)
+	if !ok || rest == "" {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(rest, 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// BuildThingID joins a namespace and a local name into a Ditto thing ID ("namespace:name")
+func BuildThingID(namespace, name string) (string, error) {
+	if !namespacePattern.MatchString(namespace) {
+		return "", fmt.Errorf("invalid namespace: %q", namespace)
+	}
+	if !thingNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid thing name: %q", name)
+	}
+
+	return namespace + ":" + name, nil
+}
+
+// ParseThingID splits a Ditto thing ID into its namespace and local name
+func ParseThingID(thingID string) (namespace, name string, err error) {
+	namespace, name, found := strings.Cut(thingID, ":")
+	if !found {
+		return "", "", fmt.Errorf("thing ID %q has no namespace", thingID)
+	}
+	if !namespacePattern.MatchString(namespace) {
+		return "", "", fmt.Errorf("invalid namespace in thing ID %q", thingID)
+	}
+	if !thingNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid thing name in thing ID %q", thingID)
+	}
+
+	return namespace, name, nil
+}
+
+// NormalizeThingID returns the canonical form of a thing ID: surrounding whitespace removed and
+// the namespace lowercased, since namespaces are Java-package-like names. The local name is
+// kept as is because Ditto treats it case-sensitively.
+//
+// The normalized ID is the single identifier of a twin end-to-end: it is the Kafka key of the
+// twin's messages, so they stay ordered on one partition, the twin_id of its stored time series
+// and the space-partitioning column of the hypertables, so its points share a space partition.
+// Every path that produces or stores data for a thing must normalize the ID first.
+func NormalizeThingID(thingID string) string {
+	thingID = strings.TrimSpace(thingID)
+	namespace, name, found := strings.Cut(thingID, ":")
+	if !found {
+		return thingID
+	}
+	return strings.ToLower(strings.TrimSpace(namespace)) + ":" + name
+}
+
+// NamespaceOf returns the namespace part of a thing ID, or an empty string if it has none
+func NamespaceOf(thingID string) string {
+	namespace, _, err := ParseThingID(thingID)
+	if err != nil {
+		return ""
+	}
+	return namespace
+}
@@ -0,0 +1,61 @@
+package ditto
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Token is a bearer token authenticating the WebSocket connection to Ditto
+type Token struct {
+	Value string
+	// ExpiresAt is when Ditto stops accepting the token; zero if it does not expire
+	ExpiresAt time.Time
+}
+
+// TokenProvider supplies the bearer token of each WebSocket (re)connect. forceRefresh is set
+// when the previous token must not be reused: after Ditto rejected it, and when renewing the
+// connection before the token expires.
+type TokenProvider func(ctx context.Context, forceRefresh bool) (Token, error)
+
+// FileTokenProvider returns a provider reading the token from a file on each connect, such
+// as a projected service account token the platform rotates. The expiry is taken from the
+// "exp" claim if the token is a JWT.
+func FileTokenProvider(path string) TokenProvider {
+	return func(ctx context.Context, forceRefresh bool) (Token, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Token{}, fmt.Errorf("failed to read token file: %w", err)
+		}
+		value := strings.TrimSpace(string(data))
+		if value == "" {
+			return Token{}, errors.New("token file is empty")
+		}
+		return Token{Value: value, ExpiresAt: jwtExpiry(value)}, nil
+	}
+}
+
+// jwtExpiry returns the time of a JWT's "exp" claim without verifying the token, or zero
+// if the value is not a JWT with an expiry
+func jwtExpiry(value string) time.Time {
+	parts := strings.Split(value, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +17,12 @@ import (
 	"go.uber.org/zap"
 )
 
+// defaultMaxMessageSize bounds the messages read from Ditto when no limit is configured
+const defaultMaxMessageSize = 4 << 20
+
+// closeUnauthorized is the close code of connections closed for an expired or revoked token
+const closeUnauthorized = 4401
+
 // WebSocketClient provides a WebSocket connection to Eclipse Ditto for real-time events
 type WebSocketClient struct {
 	config      *config.DittoConfig
@@ -27,6 +35,15 @@ type WebSocketClient struct {
 	cancel      context.CancelFunc
 	backoff     time.Duration
 	maxBackoff  time.Duration
+	readLimit   int64
+	// subscription is the payload of the last START-SEND-EVENTS command, sent again on reconnect
+	subscription interface{}
+	// tokenProvider supplies the bearer token of each connect when set
+	tokenProvider TokenProvider
+	// refreshToken makes the next connect request a fresh token from the provider
+	refreshToken  bool
+	refreshMargin time.Duration
+	renewTimer    *time.Timer
 }
 
 // EventHandler is a function that processes Ditto events
@@ -51,15 +68,33 @@ type DittoEvent struct {
 // NewWebSocketClient creates a new WebSocket client for Ditto
 func NewWebSocketClient(cfg *config.DittoConfig, logger *utils.Logger) *WebSocketClient {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &WebSocketClient{
-		config:     cfg,
-		logger:     logger.Named("ditto_ws"),
-		handlers:   make(map[string]EventHandler),
-		ctx:        ctx,
-		cancel:     cancel,
-		backoff:    1 * time.Second,
-		maxBackoff: 60 * time.Second,
+	readLimit := cfg.MaxMessageSize
+	if readLimit <= 0 {
+		readLimit = defaultMaxMessageSize
+	}
+	client := &WebSocketClient{
+		config:        cfg,
+		logger:        logger.Named("ditto_ws"),
+		handlers:      make(map[string]EventHandler),
+		ctx:           ctx,
+		cancel:        cancel,
+		backoff:       1 * time.Second,
+		maxBackoff:    60 * time.Second,
+		readLimit:     readLimit,
+		refreshMargin: time.Duration(cfg.TokenRefreshMargin) * time.Second,
 	}
+	if cfg.APITokenFile != "" {
+		client.tokenProvider = FileTokenProvider(cfg.APITokenFile)
+	}
+	return client
+}
+
+// SetTokenProvider makes each (re)connect authenticate with a bearer token from the provider
+// instead of the configured credentials. Connections are renewed before their token expires.
+func (c *WebSocketClient) SetTokenProvider(provider TokenProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokenProvider = provider
 }
 
 // Connect establishes a WebSocket connection to Ditto
@@ -71,6 +106,33 @@ func (c *WebSocketClient) Connect() error {
 		return nil
 	}
 
+	if err := c.dialLocked(); err != nil {
+		return err
+	}
+
+	// Start the message handler in a goroutine
+	go c.handleMessages()
+
+	return nil
+}
+
+// dialLocked opens the WebSocket connection; the caller must hold the lock
+func (c *WebSocketClient) dialLocked() error {
+	conn, err := c.openLocked()
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	c.isConnected = true
+	c.backoff = 1 * time.Second // Reset backoff timer on successful connection
+
+	return nil
+}
+
+// openLocked dials a new WebSocket connection and schedules its renewal before the token
+// expires; the caller must hold the lock
+func (c *WebSocketClient) openLocked() (*websocket.Conn, error) {
 	// Parse the WebSocket URL (using /ws endpoint)
 	wsURL := c.config.URL
 	// Replace http(s) with ws(s)
@@ -83,7 +145,16 @@ func (c *WebSocketClient) Connect() error {
 
 	// Build request headers with authentication
 	header := http.Header{}
-	if c.config.APIToken != "" {
+	var token Token
+	if c.tokenProvider != nil {
+		var err error
+		token, err = c.tokenProvider(c.ctx, c.refreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get WebSocket token: %w", err)
+		}
+		c.refreshToken = false
+		header.Add("Authorization", "Bearer "+token.Value)
+	} else if c.config.APIToken != "" {
 		header.Add("Authorization", "Bearer "+c.config.APIToken)
 	} else if c.config.Username != "" && c.config.Password != "" {
 		auth := c.config.Username + ":" + c.config.Password
@@ -94,18 +165,98 @@ func (c *WebSocketClient) Connect() error {
 	c.logger.Info("Connecting to Ditto WebSocket", zap.String("url", wsURL))
 
 	// Connect to the WebSocket
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
 	if err != nil {
-		return fmt.Errorf("failed to connect to WebSocket: %w", err)
+		if c.tokenProvider != nil && resp != nil &&
+			(resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			// The token was rejected, so the next attempt must not reuse it
+			c.refreshToken = true
+			return nil, fmt.Errorf("WebSocket token rejected by Ditto: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("failed to connect to WebSocket: %w", err)
+	}
+
+	// Larger messages fail the read instead of being buffered whole
+	conn.SetReadLimit(c.readLimit)
+
+	c.scheduleRenewLocked(token.ExpiresAt)
+
+	return conn, nil
+}
+
+// scheduleRenewLocked renews the connection ahead of the expiry of its token, by the refresh
+// margin but at most half the token's lifetime; the caller must hold the lock
+func (c *WebSocketClient) scheduleRenewLocked(expiresAt time.Time) {
+	if c.renewTimer != nil {
+		c.renewTimer.Stop()
+		c.renewTimer = nil
+	}
+	lifetime := time.Until(expiresAt)
+	if expiresAt.IsZero() || lifetime <= 0 {
+		return
 	}
 
+	margin := c.refreshMargin
+	if margin > lifetime/2 {
+		margin = lifetime / 2
+	}
+	c.renewTimer = time.AfterFunc(lifetime-margin, c.renew)
+}
+
+// renew replaces the connection by one authenticated with a fresh token. The subscription is
+// restored on the new connection before the old one is closed, so no events are missed.
+func (c *WebSocketClient) renew() {
+	c.mu.Lock()
+	if !c.isConnected || c.ctx.Err() != nil {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshToken = true
+	conn, err := c.openLocked()
+	if err != nil {
+		c.mu.Unlock()
+		// The current connection is kept until Ditto closes it, then reconnected as usual
+		c.logger.Warn("Failed to renew Ditto WebSocket connection before its token expires", zap.Error(err))
+		return
+	}
+	old := c.conn
 	c.conn = conn
-	c.isConnected = true
-	c.backoff = 1 * time.Second // Reset backoff timer on successful connection
+	subscription := c.subscription
+	c.mu.Unlock()
 
-	// Start the message handler in a goroutine
-	go c.handleMessages()
+	c.logger.Info("Renewed Ditto WebSocket connection with a fresh token")
+	if subscription != nil {
+		if err := c.sendCommand("START-SEND-EVENTS", subscription); err != nil {
+			c.logger.Error("Failed to restore subscription on renewed connection", zap.Error(err))
+		}
+	}
+	old.Close()
+}
+
+// reconnect re-establishes the connection and restores the event subscription
+func (c *WebSocketClient) reconnect() error {
+	c.mu.Lock()
+	if c.isConnected {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.ctx.Err() != nil {
+		// Disconnected meanwhile
+		c.mu.Unlock()
+		return c.ctx.Err()
+	}
+	err := c.dialLocked()
+	subscription := c.subscription
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
+	if subscription != nil {
+		if err := c.sendCommand("START-SEND-EVENTS", subscription); err != nil {
+			return fmt.Errorf("failed to restore subscription: %w", err)
+		}
+	}
 	return nil
 }
 
@@ -119,6 +270,10 @@ func (c *WebSocketClient) Disconnect() error {
 	}
 
 	c.cancel() // Cancel the context to stop the handling goroutine
+	if c.renewTimer != nil {
+		c.renewTimer.Stop()
+		c.renewTimer = nil
+	}
 
 	// Close the connection
 	err := c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
@@ -140,15 +295,16 @@ func (c *WebSocketClient) IsConnected() bool {
 	return c.isConnected
 }
 
-// SubscribeToThings subscribes to thing change events
-func (c *WebSocketClient) SubscribeToThings(filter string) error {
+// SubscribeToThings subscribes to thing change events.
+// When namespaces is empty, events from all namespaces are received.
+func (c *WebSocketClient) SubscribeToThings(filter string, namespaces []string) error {
 	// Build subscription command
 	subscription := map[string]interface{}{
 		"topic":  "/_/things/twin/events",
 		"filter": filter,
-		"namespaces": []string{
-			"org.eclipse.ditto", // Replace with your namespaces as needed
-		},
+	}
+	if len(namespaces) > 0 {
+		subscription["namespaces"] = namespaces
 	}
 
 	return c.sendCommand("START-SEND-EVENTS", subscription)
@@ -164,16 +320,46 @@ func (c *WebSocketClient) SubscribeToThing(thingID string) error {
 	return c.sendCommand("START-SEND-EVENTS", subscription)
 }
 
-// SubscribeToFeature subscribes to events for a specific feature of a thing
+// SubscribeToFeature subscribes to events for a specific feature of a thing. The restriction
+// is applied by Ditto with an RQL filter, so events of other features are never sent.
 func (c *WebSocketClient) SubscribeToFeature(thingID, featureID string) error {
+	namespace, _, err := ParseThingID(thingID)
+	if err != nil {
+		return err
+	}
+	filter, err := FeatureEventFilter(thingID, featureID)
+	if err != nil {
+		return err
+	}
+
 	// Build subscription command
 	subscription := map[string]interface{}{
-		"topic": fmt.Sprintf("/%s/things/twin/events?extraFields=features/%s", thingID, featureID),
+		"topic":      "/_/things/twin/events",
+		"filter":     filter,
+		"namespaces": []string{namespace},
 	}
 
 	return c.sendCommand("START-SEND-EVENTS", subscription)
 }
 
+// FeatureEventFilter returns the RQL filter matching the twin events of one feature of a thing:
+// changes at or below the feature's path, and changes of the whole thing or of all its features
+// while the thing has the feature
+func FeatureEventFilter(thingID, featureID string) (string, error) {
+	if featureID == "" || strings.ContainsAny(featureID, "/\"*") {
+		return "", fmt.Errorf("invalid feature ID: %q", featureID)
+	}
+
+	featurePath := "/features/" + featureID
+	return fmt.Sprintf(`and(eq(thingId,%s),or(eq(resource:path,%s),like(resource:path,%s),and(in(resource:path,"/","/features"),exists(features/%s))))`,
+		rqlString(thingID), rqlString(featurePath), rqlString(featurePath+"/*"), featureID), nil
+}
+
+// rqlString quotes a value as an RQL string literal
+func rqlString(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
 // Unsubscribe cancels all subscriptions
 func (c *WebSocketClient) Unsubscribe() error {
 	return c.sendCommand("STOP-SEND-EVENTS", nil)
@@ -220,21 +406,51 @@ func (c *WebSocketClient) handleMessages() {
 				c.backoff = c.maxBackoff
 			}
 
-			err := c.Connect()
+			err := c.reconnect()
 			if err != nil {
 				c.logger.Error("Failed to reconnect WebSocket", zap.Error(err))
 				continue
 			}
 		}
 
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn == nil {
+			continue
+		}
+
 		// Read the next message
-		_, message, err := c.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			c.mu.Lock()
-			c.isConnected = false
+			replaced := c.conn != conn
+			if !replaced {
+				c.isConnected = false
+				c.conn = nil
+			}
 			c.mu.Unlock()
+			conn.Close()
 
-			if websocket.IsUnexpectedCloseError(err,
+			if replaced {
+				// Closed after a renewal; continue reading from the new connection
+				continue
+			}
+
+			// The connection is unusable once a message exceeded the limit, so the message is
+			// skipped by reconnecting
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.logger.Warn("Dropped a Ditto WebSocket message exceeding the size limit, reconnecting",
+					zap.Int64("limit_bytes", c.readLimit))
+			} else if websocket.IsCloseError(err, websocket.ClosePolicyViolation, closeUnauthorized) {
+				// Ditto closes connections whose token expired or was revoked; reconnecting with
+				// the same token would fail again
+				c.mu.Lock()
+				c.refreshToken = true
+				c.mu.Unlock()
+				c.logger.Warn("Ditto closed the WebSocket for failed authentication, reconnecting with a fresh token",
+					zap.Error(err))
+			} else if websocket.IsUnexpectedCloseError(err,
 				websocket.CloseGoingAway,
 				websocket.CloseNormalClosure) {
 				c.logger.Error("WebSocket read error", zap.Error(err))
@@ -263,7 +479,7 @@ func (c *WebSocketClient) processMessage(message []byte) {
 	// Topics are in the format: <namespace>/<entityId>/things/twin/events/<action>
 	parts := splitAndStripEmpty(event.Topic, "/")
 	if len(parts) >= 6 {
-		event.ThingID = parts[1]
+		event.ThingID = parts[0] + ":" + parts[1]
 		event.Action = parts[5]
 	}
 
@@ -320,6 +536,8 @@ func (c *WebSocketClient) sendCommand(command string, payload interface{}) error
 	defer c.mu.Unlock()
 
 	if !c.isConnected {
+		// A reconnect restores the latest subscription rather than the one it replaced
+		c.recordSubscriptionLocked(command, payload)
 		return fmt.Errorf("not connected to WebSocket")
 	}
 
@@ -344,9 +562,21 @@ func (c *WebSocketClient) sendCommand(command string, payload interface{}) error
 		return fmt.Errorf("failed to send command: %w", err)
 	}
 
+	c.recordSubscriptionLocked(command, payload)
 	return nil
 }
 
+// recordSubscriptionLocked keeps the subscription a command sets up, to restore it on reconnect;
+// the caller must hold the lock
+func (c *WebSocketClient) recordSubscriptionLocked(command string, payload interface{}) {
+	switch command {
+	case "START-SEND-EVENTS":
+		c.subscription = payload
+	case "STOP-SEND-EVENTS":
+		c.subscription = nil
+	}
+}
+
 // splitAndStripEmpty splits a string and removes empty parts
 func splitAndStripEmpty(s, sep string) []string {
 	parts := []string{}
@@ -0,0 +1,182 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/ditto"
+)
+
+// Transport sends messages to topics and registers consumers for them
+type Transport interface {
+	ProduceMessage(topic string, key string, value interface{}, headers map[string]string) error
+	AddConsumer(name string, topics []string, handlers map[string][]MessageHandler) error
+	AddConsumerWithOptions(name string, topics []string, handlers map[string][]MessageHandler, opts ConsumerOptions) error
+}
+
+// ConsumerOptions tunes a consumer; the zero value joins the configured consumer group and
+// dead-letters failed messages
+type ConsumerOptions struct {
+	// Group is the consumer group to join instead of the configured one
+	Group string
+	// DisableDLQ drops messages a handler fails on instead of sending them to the DLQ topic
+	DisableDLQ bool
+}
+
+// Bus is the messaging the services rely on: the application topics with their message formats.
+// The Manager implements it on Kafka; tests can use an in-memory Transport wrapped in Topics.
+type Bus interface {
+	Transport
+	ProduceDittoEvent(thingID string, action string, payload interface{}) error
+	ProduceTimeSeriesData(thingID string, featureID string, data interface{}, source string) error
+	ProduceMLInput(modelID string, input interface{}) error
+	RegisterDittoEventHandler(name string, handler func(thingID, action string, payload json.RawMessage) error) error
+	RegisterTimeSeriesDataHandler(name string, handler func(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) error) error
+	RegisterMLOutputHandler(name string, handler func(modelID string, timestamp time.Time, output json.RawMessage) error) error
+}
+
+// Topics implements the message formats of the application topics on top of a Transport
+type Topics struct {
+	Transport
+}
+
+// ProduceDittoEvent publishes a Ditto event, keyed by the normalized thing ID
+func (t Topics) ProduceDittoEvent(thingID string, action string, payload interface{}) error {
+	thingID = ditto.NormalizeThingID(thingID)
+	event := map[string]interface{}{
+		"thingId":   thingID,
+		"action":    action,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"payload":   payload,
+	}
+
+	return t.ProduceMessage(TopicDittoEvents, thingID, event, nil)
+}
+
+// ProduceTimeSeriesData publishes time-series data, tagged with the source it came from and keyed
+// by the normalized thing ID so all of a twin's points go to the same partition
+func (t Topics) ProduceTimeSeriesData(thingID string, featureID string, data interface{}, source string) error {
+	thingID = ditto.NormalizeThingID(thingID)
+	tsData := map[string]interface{}{
+		"thingId":   thingID,
+		"featureId": featureID,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"data":      data,
+	}
+	if source != "" {
+		tsData["source"] = source
+	}
+
+	return t.ProduceMessage(TopicTimeSeriesData, thingID, tsData, nil)
+}
+
+// ProduceMLInput publishes ML input data
+func (t Topics) ProduceMLInput(modelID string, input interface{}) error {
+	mlInput := map[string]interface{}{
+		"modelId":   modelID,
+		"timestamp": time.Now().Format(time.RFC3339),
+		"input":     input,
+	}
+
+	return t.ProduceMessage(TopicMLInput, modelID, mlInput, nil)
+}
+
+// DittoEventHandler decodes Ditto event messages for a handler
+func DittoEventHandler(handler func(thingID, action string, payload json.RawMessage) error) MessageHandler {
+	return func(msg *kafka.Message) error {
+		var event struct {
+			ThingID   string          `json:"thingId"`
+			Action    string          `json:"action"`
+			Timestamp string          `json:"timestamp"`
+			Payload   json.RawMessage `json:"payload"`
+		}
+
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return fmt.Errorf("failed to unmarshal Ditto event: %w", err)
+		}
+
+		return handler(ditto.NormalizeThingID(event.ThingID), event.Action, event.Payload)
+	}
+}
+
+// RegisterDittoEventHandler registers a handler for Ditto events
+func (t Topics) RegisterDittoEventHandler(name string, handler func(thingID, action string, payload json.RawMessage) error) error {
+	return t.AddConsumer(
+		fmt.Sprintf("%s-ditto-events", name),
+		[]string{TopicDittoEvents},
+		map[string][]MessageHandler{
+			TopicDittoEvents: {DittoEventHandler(handler)},
+		},
+	)
+}
+
+// TimeSeriesDataHandler decodes time-series data messages for a handler. The source is
+// empty for messages that were not tagged by their producer.
+func TimeSeriesDataHandler(handler func(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) error) MessageHandler {
+	return func(msg *kafka.Message) error {
+		var tsData struct {
+			ThingID   string          `json:"thingId"`
+			FeatureID string          `json:"featureId"`
+			Timestamp string          `json:"timestamp"`
+			Data      json.RawMessage `json:"data"`
+			Source    string          `json:"source"`
+		}
+
+		if err := json.Unmarshal(msg.Value, &tsData); err != nil {
+			return fmt.Errorf("failed to unmarshal time-series data: %w", err)
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, tsData.Timestamp)
+		if err != nil {
+			return fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		return handler(ditto.NormalizeThingID(tsData.ThingID), tsData.FeatureID, timestamp, tsData.Data, tsData.Source)
+	}
+}
+
+// RegisterTimeSeriesDataHandler registers a handler for time-series data
+func (t Topics) RegisterTimeSeriesDataHandler(name string, handler func(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) error) error {
+	return t.AddConsumer(
+		fmt.Sprintf("%s-timeseries-data", name),
+		[]string{TopicTimeSeriesData},
+		map[string][]MessageHandler{
+			TopicTimeSeriesData: {TimeSeriesDataHandler(handler)},
+		},
+	)
+}
+
+// MLOutputHandler decodes ML output messages for a handler
+func MLOutputHandler(handler func(modelID string, timestamp time.Time, output json.RawMessage) error) MessageHandler {
+	return func(msg *kafka.Message) error {
+		var mlOutput struct {
+			ModelID   string          `json:"modelId"`
+			Timestamp string          `json:"timestamp"`
+			Output    json.RawMessage `json:"output"`
+		}
+
+		if err := json.Unmarshal(msg.Value, &mlOutput); err != nil {
+			return fmt.Errorf("failed to unmarshal ML output data: %w", err)
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, mlOutput.Timestamp)
+		if err != nil {
+			return fmt.Errorf("failed to parse timestamp: %w", err)
+		}
+
+		return handler(mlOutput.ModelID, timestamp, mlOutput.Output)
+	}
+}
+
+// RegisterMLOutputHandler registers a handler for ML output data
+func (t Topics) RegisterMLOutputHandler(name string, handler func(modelID string, timestamp time.Time, output json.RawMessage) error) error {
+	return t.AddConsumer(
+		fmt.Sprintf("%s-ml-output", name),
+		[]string{TopicMLOutput},
+		map[string][]MessageHandler{
+			TopicMLOutput: {MLOutputHandler(handler)},
+		},
+	)
+}
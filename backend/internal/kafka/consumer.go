@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -19,15 +22,20 @@ type MessageHandler func(msg *kafka.Message) error
 
 // Consumer provides functionality to consume messages from Kafka topics
 type Consumer struct {
-	consumer       *kafka.Consumer
-	logger         *utils.Logger
-	config         *config.KafkaConfig
-	handlers       map[string][]MessageHandler
-	dlqProducer    *Producer
+	name        string
+	consumer    *kafka.Consumer
+	logger      *utils.Logger
+	config      *config.KafkaConfig
+	handlers    map[string][]MessageHandler
+	dlqProducer *Producer
+	// Called for each message sent to the DLQ
+	deadLettered   func(topic string, err error)
 	signalChannel  chan os.Signal
 	stopChannel    chan struct{}
 	runningChannel chan struct{}
-	isRunning      bool
+	isRunning      atomic.Bool
+	paused         atomic.Bool
+	stats          consumerStats
 }
 
 // NewConsumer creates a new Kafka consumer
@@ -44,26 +52,8 @@ func NewConsumer(cfg *config.KafkaConfig, logger *utils.Logger, dlqProducer *Pro
 	}
 
 	// Add security configuration if enabled
-	if cfg.SecurityEnable {
-		err := kafkaConfig.SetKey("security.protocol", "SASL_SSL")
-		if err != nil {
-			return nil, fmt.Errorf("failed to set security protocol: %w", err)
-		}
-
-		err = kafkaConfig.SetKey("sasl.mechanisms", "PLAIN")
-		if err != nil {
-			return nil, fmt.Errorf("failed to set SASL mechanism: %w", err)
-		}
-
-		err = kafkaConfig.SetKey("sasl.username", cfg.SecurityUser)
-		if err != nil {
-			return nil, fmt.Errorf("failed to set SASL username: %w", err)
-		}
-
-		err = kafkaConfig.SetKey("sasl.password", cfg.SecurityPass)
-		if err != nil {
-			return nil, fmt.Errorf("failed to set SASL password: %w", err)
-		}
+	if err := setSecurity(kafkaConfig, cfg); err != nil {
+		return nil, err
 	}
 
 	// Create Kafka consumer
@@ -81,10 +71,30 @@ func NewConsumer(cfg *config.KafkaConfig, logger *utils.Logger, dlqProducer *Pro
 		signalChannel:  make(chan os.Signal, 1),
 		stopChannel:    make(chan struct{}),
 		runningChannel: make(chan struct{}),
-		isRunning:      false,
 	}, nil
 }
 
+// setSecurity adds the SASL settings to a client configuration if security is enabled
+func setSecurity(kafkaConfig *kafka.ConfigMap, cfg *config.KafkaConfig) error {
+	if !cfg.SecurityEnable {
+		return nil
+	}
+
+	if err := kafkaConfig.SetKey("security.protocol", "SASL_SSL"); err != nil {
+		return fmt.Errorf("failed to set security protocol: %w", err)
+	}
+	if err := kafkaConfig.SetKey("sasl.mechanisms", "PLAIN"); err != nil {
+		return fmt.Errorf("failed to set SASL mechanism: %w", err)
+	}
+	if err := kafkaConfig.SetKey("sasl.username", cfg.SecurityUser); err != nil {
+		return fmt.Errorf("failed to set SASL username: %w", err)
+	}
+	if err := kafkaConfig.SetKey("sasl.password", cfg.SecurityPass); err != nil {
+		return fmt.Errorf("failed to set SASL password: %w", err)
+	}
+	return nil
+}
+
 // RegisterHandler registers a message handler for a specific topic
 func (c *Consumer) RegisterHandler(topic string, handler MessageHandler) {
 	if handlers, ok := c.handlers[topic]; ok {
@@ -96,17 +106,34 @@ func (c *Consumer) RegisterHandler(topic string, handler MessageHandler) {
 	c.logger.Info("Registered handler for topic", zap.String("topic", topic))
 }
 
+// Topics returns the topics the consumer has handlers for, sorted by name
+func (c *Consumer) Topics() []string {
+	topics := make([]string, 0, len(c.handlers))
+	for topic := range c.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Group returns the consumer group the consumer joins
+func (c *Consumer) Group() string {
+	return c.config.ConsumerGroup
+}
+
+// IsRunning returns whether the consumer loop is active
+func (c *Consumer) IsRunning() bool {
+	return c.isRunning.Load()
+}
+
 // Start starts consuming messages from registered topics
 func (c *Consumer) Start(ctx context.Context) error {
-	if c.isRunning {
+	if c.isRunning.Load() {
 		return fmt.Errorf("consumer is already running")
 	}
 
 	// Get topics from handlers
-	topics := make([]string, 0, len(c.handlers))
-	for topic := range c.handlers {
-		topics = append(topics, topic)
-	}
+	topics := c.Topics()
 
 	if len(topics) == 0 {
 		return fmt.Errorf("no topics registered")
@@ -123,14 +150,77 @@ func (c *Consumer) Start(ctx context.Context) error {
 	signal.Notify(c.signalChannel, syscall.SIGINT, syscall.SIGTERM)
 
 	// Mark consumer as running
-	c.isRunning = true
+	c.isRunning.Store(true)
 
-	// Start consumer loop in a goroutine
+	// Start consumer loop in a goroutine and wait until it is polling
 	go c.consumeLoop(ctx)
+	<-c.runningChannel
 
 	return nil
 }
 
+// Pause stops handling messages until Resume. The consumer keeps polling so it stays in its
+// group; fetching is paused for the assigned partitions.
+func (c *Consumer) Pause() error {
+	c.paused.Store(true)
+	if !c.isRunning.Load() {
+		return nil
+	}
+
+	assignment, err := c.consumer.Assignment()
+	if err != nil {
+		return fmt.Errorf("failed to get assignment: %w", err)
+	}
+	if len(assignment) == 0 {
+		return nil
+	}
+	if err := c.consumer.Pause(assignment); err != nil {
+		return fmt.Errorf("failed to pause partitions: %w", err)
+	}
+	return nil
+}
+
+// Resume continues handling messages after Pause
+func (c *Consumer) Resume() error {
+	c.paused.Store(false)
+	if !c.isRunning.Load() {
+		return nil
+	}
+
+	assignment, err := c.consumer.Assignment()
+	if err != nil {
+		return fmt.Errorf("failed to get assignment: %w", err)
+	}
+	if len(assignment) == 0 {
+		return nil
+	}
+	if err := c.consumer.Resume(assignment); err != nil {
+		return fmt.Errorf("failed to resume partitions: %w", err)
+	}
+	return nil
+}
+
+// IsPaused returns whether the consumer is paused
+func (c *Consumer) IsPaused() bool {
+	return c.paused.Load()
+}
+
+// holdBack rewinds the partition of a message read while paused, so it is handled after
+// Resume, and pauses it; partitions assigned after Pause are not paused yet
+func (c *Consumer) holdBack(msg *kafka.Message) {
+	partition := msg.TopicPartition
+	partition.Error = nil
+	if _, err := c.consumer.StoreOffsets([]kafka.TopicPartition{partition}); err != nil {
+		c.logger.Warn("Failed to store offset of held back message", zap.Error(err))
+	}
+	if err := c.consumer.Seek(partition, 0); err != nil {
+		c.logger.Error("Failed to rewind paused partition", zap.Error(err))
+	}
+	if err := c.consumer.Pause([]kafka.TopicPartition{partition}); err != nil {
+		c.logger.Error("Failed to pause partition", zap.Error(err))
+	}
+}
+
 // consumeLoop runs the main consumption loop
 func (c *Consumer) consumeLoop(ctx context.Context) {
 	defer close(c.runningChannel)
@@ -138,25 +228,26 @@ func (c *Consumer) consumeLoop(ctx context.Context) {
 	c.logger.Info("Starting Kafka consumer loop")
 
 	// Notify that consumer is running
+	c.stats.started(time.Now())
 	c.runningChannel <- struct{}{}
 
 	for {
 		select {
 		case <-ctx.Done():
 			c.logger.Info("Context canceled, stopping consumer")
-			c.isRunning = false
+			c.isRunning.Store(false)
 			_ = c.consumer.Close()
 			return
 
 		case <-c.stopChannel:
 			c.logger.Info("Received stop signal, stopping consumer")
-			c.isRunning = false
+			c.isRunning.Store(false)
 			_ = c.consumer.Close()
 			return
 
 		case sig := <-c.signalChannel:
 			c.logger.Info("Received signal, stopping consumer", zap.String("signal", sig.String()))
-			c.isRunning = false
+			c.isRunning.Store(false)
 			_ = c.consumer.Close()
 			return
 
@@ -170,6 +261,12 @@ func (c *Consumer) consumeLoop(ctx context.Context) {
 				}
 
 				c.logger.Error("Error reading message from Kafka", zap.Error(err))
+				c.stats.failedWith(err, false, time.Now())
+				continue
+			}
+
+			if c.paused.Load() {
+				c.holdBack(msg)
 				continue
 			}
 
@@ -200,8 +297,10 @@ func (c *Consumer) processMessage(msg *kafka.Message) {
 	)
 
 	// Process message with all registered handlers
+	var failure error
 	for i, handler := range handlers {
 		if err := handler(msg); err != nil {
+			failure = err
 			c.logger.Error("Handler failed to process message",
 				zap.String("topic", topic),
 				zap.Int("handler_index", i),
@@ -210,33 +309,43 @@ func (c *Consumer) processMessage(msg *kafka.Message) {
 
 			// Send to DLQ if a producer is available
 			if c.dlqProducer != nil {
-				dlqTopic := fmt.Sprintf("%s.dlq", topic)
+				dlqTopic := DLQTopic(topic)
 				headers := make(map[string]string)
-				headers["error"] = err.Error()
-				headers["original_topic"] = topic
+				headers[HeaderError] = err.Error()
+				headers[HeaderOriginalTopic] = topic
+				headers[HeaderConsumer] = c.name
+				headers[HeaderHandlerIndex] = strconv.Itoa(i)
+				headers[HeaderReplayAttempts] = "0"
 
-				// Create DLQ message
+				// Create DLQ message, keeping the original payload so it can be replayed as is
 				dlqMessage := &Message{
 					Key:       string(msg.Key),
-					Value:     msg.Value,
 					Timestamp: time.Now(),
 					Headers:   headers,
 				}
 
-				if err := c.dlqProducer.Produce(dlqTopic, dlqMessage); err != nil {
+				if dlqErr := c.dlqProducer.produceBytes(dlqTopic, dlqMessage, msg.Value); dlqErr != nil {
 					c.logger.Error("Failed to send message to DLQ",
 						zap.String("dlq_topic", dlqTopic),
-						zap.Error(err),
+						zap.Error(dlqErr),
 					)
+				} else if c.deadLettered != nil {
+					c.deadLettered(topic, err)
 				}
 			}
 		}
 	}
+
+	if failure != nil {
+		c.stats.failedWith(failure, true, time.Now())
+	} else {
+		c.stats.succeeded(msg, time.Now())
+	}
 }
 
 // Stop stops the consumer
 func (c *Consumer) Stop() {
-	if c.isRunning {
+	if c.isRunning.Load() {
 		close(c.stopChannel)
 		<-c.runningChannel
 	}
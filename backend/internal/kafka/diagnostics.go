@@ -0,0 +1,244 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrConsumerNotFound is returned when no consumer is registered under a name
+var ErrConsumerNotFound = errors.New("consumer not found")
+
+// Consumer health states
+const (
+	ConsumerStatusOK      = "ok"
+	ConsumerStatusFailing = "failing"
+	ConsumerStatusIdle    = "idle"
+	ConsumerStatusPaused  = "paused"
+	ConsumerStatusStopped = "stopped"
+)
+
+// ConsumerDiagnostics describes the progress and errors of a consumer
+type ConsumerDiagnostics struct {
+	ConsumerInfo
+	Status    string     `json:"status"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// Processed and Failed count the messages handled since the consumer was created
+	Processed int64 `json:"processed"`
+	Failed    int64 `json:"failed"`
+	// The last message handled successfully
+	LastTopic       string     `json:"last_topic,omitempty"`
+	LastPartition   int32      `json:"last_partition"`
+	LastOffset      int64      `json:"last_offset"`
+	LastProcessedAt *time.Time `json:"last_processed_at,omitempty"`
+	// The last read or handler error, and how many failures followed each other since the last success
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time `json:"last_error_at,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// consumerStats collects the diagnostics of a consumer while it runs
+type consumerStats struct {
+	mutex               sync.Mutex
+	startedAt           time.Time
+	processed           int64
+	failed              int64
+	lastTopic           string
+	lastPartition       int32
+	lastOffset          int64
+	lastProcessedAt     time.Time
+	lastError           string
+	lastErrorAt         time.Time
+	consecutiveFailures int
+}
+
+// started records the start of the consumer loop
+func (s *consumerStats) started(at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.startedAt = at
+}
+
+// succeeded records a message all handlers processed
+func (s *consumerStats) succeeded(msg *kafka.Message, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.processed++
+	s.lastTopic = *msg.TopicPartition.Topic
+	s.lastPartition = msg.TopicPartition.Partition
+	s.lastOffset = int64(msg.TopicPartition.Offset)
+	s.lastProcessedAt = at
+	s.consecutiveFailures = 0
+}
+
+// failedWith records a message a handler failed on, or an error reading messages
+func (s *consumerStats) failedWith(err error, handled bool, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if handled {
+		s.failed++
+	}
+	s.lastError = err.Error()
+	s.lastErrorAt = at
+	s.consecutiveFailures++
+}
+
+// snapshot fills the recorded diagnostics in
+func (s *consumerStats) snapshot(diagnostics *ConsumerDiagnostics) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	optionalTime := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	diagnostics.StartedAt = optionalTime(s.startedAt)
+	diagnostics.Processed = s.processed
+	diagnostics.Failed = s.failed
+	diagnostics.LastTopic = s.lastTopic
+	diagnostics.LastPartition = s.lastPartition
+	diagnostics.LastOffset = s.lastOffset
+	diagnostics.LastProcessedAt = optionalTime(s.lastProcessedAt)
+	diagnostics.LastError = s.lastError
+	diagnostics.LastErrorAt = optionalTime(s.lastErrorAt)
+	diagnostics.ConsecutiveFailures = s.consecutiveFailures
+}
+
+// consumerStatus derives the health of a consumer from its diagnostics. A consumer is idle
+// when it has handled nothing within the idle timeout, counted from its start.
+func consumerStatus(diagnostics *ConsumerDiagnostics, cfg *config.KafkaConfig, now time.Time) string {
+	switch {
+	case !diagnostics.Running:
+		return ConsumerStatusStopped
+	case diagnostics.Paused:
+		return ConsumerStatusPaused
+	case cfg.ConsumerFailureThreshold > 0 && diagnostics.ConsecutiveFailures >= cfg.ConsumerFailureThreshold:
+		return ConsumerStatusFailing
+	}
+
+	if cfg.ConsumerIdleTimeout > 0 {
+		lastActivity := diagnostics.LastProcessedAt
+		if lastActivity == nil {
+			lastActivity = diagnostics.StartedAt
+		}
+		if lastActivity != nil && now.Sub(*lastActivity) > time.Duration(cfg.ConsumerIdleTimeout)*time.Second {
+			return ConsumerStatusIdle
+		}
+	}
+	return ConsumerStatusOK
+}
+
+// GetConsumer returns the diagnostics of a registered consumer
+func (m *Manager) GetConsumer(name string) (*ConsumerDiagnostics, error) {
+	m.mu.Lock()
+	consumer, exists := m.consumers[name]
+	m.mu.Unlock()
+	if !exists {
+		return nil, ErrConsumerNotFound
+	}
+	return m.consumerDiagnostics(name, consumer, time.Now()), nil
+}
+
+// consumerDiagnostics collects the diagnostics of a consumer
+func (m *Manager) consumerDiagnostics(name string, consumer *Consumer, now time.Time) *ConsumerDiagnostics {
+	diagnostics := &ConsumerDiagnostics{
+		ConsumerInfo: ConsumerInfo{
+			Name:    name,
+			Topics:  consumer.Topics(),
+			Group:   consumer.Group(),
+			Running: consumer.IsRunning(),
+			Paused:  consumer.IsPaused(),
+		},
+	}
+	consumer.stats.snapshot(diagnostics)
+	diagnostics.Status = consumerStatus(diagnostics, m.config, now)
+	return diagnostics
+}
+
+// ConsumerAlertFunc is called when a consumer starts failing or goes idle
+type ConsumerAlertFunc func(diagnostics ConsumerDiagnostics)
+
+// ConsumerMonitor periodically checks the health of the manager's consumers and alerts once
+// per consumer when it becomes failing or idle; it alerts again after the consumer recovered.
+type ConsumerMonitor struct {
+	manager *Manager
+	logger  *utils.Logger
+	alert   ConsumerAlertFunc
+
+	mutex    sync.Mutex
+	alerting map[string]string // current unhealthy status per consumer name
+
+	// The periodic check, disabled without a check interval
+	*lifecycle.ScheduledWorker
+}
+
+// NewConsumerMonitor creates a monitor for the consumers of the manager
+func NewConsumerMonitor(manager *Manager, cfg *config.KafkaConfig, alert ConsumerAlertFunc, logger *utils.Logger) *ConsumerMonitor {
+	cm := &ConsumerMonitor{
+		manager:  manager,
+		logger:   logger.Named("kafka_consumer_monitor"),
+		alert:    alert,
+		alerting: make(map[string]string),
+	}
+	interval := time.Duration(cfg.ConsumerCheckInterval) * time.Second
+	cm.ScheduledWorker = lifecycle.NewScheduledWorker("kafka-consumer-monitor", interval, func(ctx context.Context) error {
+		if cm.manager.IsRunning() {
+			cm.Check(time.Now())
+		}
+		return nil
+	})
+	return cm
+}
+
+// Check evaluates every consumer and alerts for those that became failing or idle. It returns
+// the diagnostics of the consumers alerted for.
+func (cm *ConsumerMonitor) Check(now time.Time) []ConsumerDiagnostics {
+	cm.manager.mu.Lock()
+	consumers := make(map[string]*Consumer, len(cm.manager.consumers))
+	for name, consumer := range cm.manager.consumers {
+		consumers[name] = consumer
+	}
+	cm.manager.mu.Unlock()
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	var alerted []ConsumerDiagnostics
+	for name, consumer := range consumers {
+		diagnostics := cm.manager.consumerDiagnostics(name, consumer, now)
+		if diagnostics.Status != ConsumerStatusFailing && diagnostics.Status != ConsumerStatusIdle {
+			delete(cm.alerting, name)
+			continue
+		}
+		if cm.alerting[name] == diagnostics.Status {
+			continue
+		}
+		cm.alerting[name] = diagnostics.Status
+
+		cm.logger.Warn("Kafka consumer is unhealthy",
+			zap.String("name", name),
+			zap.String("status", diagnostics.Status),
+			zap.Int("consecutive_failures", diagnostics.ConsecutiveFailures),
+			zap.String("last_error", diagnostics.LastError))
+		if cm.alert != nil {
+			cm.alert(*diagnostics)
+		}
+		alerted = append(alerted, *diagnostics)
+	}
+	// Forget consumers that were removed
+	for name := range cm.alerting {
+		if _, exists := consumers[name]; !exists {
+			delete(cm.alerting, name)
+		}
+	}
+	return alerted
+}
@@ -0,0 +1,496 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Headers of dead-lettered messages
+const (
+	HeaderError          = "error"
+	HeaderOriginalTopic  = "original_topic"
+	HeaderConsumer       = "consumer"
+	HeaderHandlerIndex   = "handler_index"
+	HeaderReplayAttempts = "replay_attempts"
+)
+
+// dlqRequestTimeout bounds the metadata and offset requests made while reading a DLQ
+const dlqRequestTimeout = 5 * time.Second
+
+// dlqReadTimeout bounds reading a DLQ up to the offsets it had when reading started
+const dlqReadTimeout = 30 * time.Second
+
+// ErrKafkaNotRunning is returned by DLQ operations while the Kafka manager is stopped
+var ErrKafkaNotRunning = errors.New("kafka manager is not running")
+
+// DLQTopic returns the dead-letter topic of a topic
+func DLQTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// DLQFailedTopic returns the topic dead-lettered messages of a topic are parked in once
+// replaying them failed the maximum number of times
+func DLQFailedTopic(topic string) string {
+	return topic + ".dlq.failed"
+}
+
+// DLQMessage is a message waiting in a dead-letter topic
+type DLQMessage struct {
+	Partition      int32           `json:"partition"`
+	Offset         int64           `json:"offset"`
+	Key            string          `json:"key,omitempty"`
+	Value          json.RawMessage `json:"value,omitempty"`
+	Error          string          `json:"error"`
+	Consumer       string          `json:"consumer,omitempty"`
+	ReplayAttempts int             `json:"replay_attempts"`
+	Timestamp      time.Time       `json:"timestamp"`
+}
+
+// DLQStats reports the dead-letter topic of a topic and what replaying it has done
+type DLQStats struct {
+	Topic             string     `json:"topic"`
+	DLQTopic          string     `json:"dlq_topic"`
+	Pending           int64      `json:"pending"`
+	Replayed          int64      `json:"replayed"`
+	Requeued          int64      `json:"requeued"`
+	PermanentFailures int64      `json:"permanent_failures"`
+	LastReplay        *time.Time `json:"last_replay,omitempty"`
+}
+
+// DLQReplayResult reports the outcome of one replay of a dead-letter topic
+type DLQReplayResult struct {
+	Topic string `json:"topic"`
+	// Replayed counts messages the original handler processed successfully
+	Replayed int `json:"replayed"`
+	// Requeued counts messages that failed again and were put back for a later replay
+	Requeued int `json:"requeued"`
+	// PermanentFailures counts messages that reached the maximum attempts and were parked
+	PermanentFailures int `json:"permanent_failures"`
+}
+
+// DLQReprocessor replays dead-lettered messages to the handlers that failed on them.
+// Messages are read with their own consumer group and committed once handled, so each is
+// replayed once per run; a message failing again is requeued with its attempt count raised,
+// and parked in the topic's ".dlq.failed" topic once it reaches the maximum attempts.
+type DLQReprocessor struct {
+	manager     *Manager
+	config      *config.KafkaConfig
+	logger      *utils.Logger
+	maxAttempts int
+
+	replayMutex sync.Mutex
+	statsMutex  sync.Mutex
+	stats       map[string]*DLQStats
+
+	// The periodic replay, disabled without a replay interval
+	*lifecycle.ScheduledWorker
+}
+
+// NewDLQReprocessor creates a reprocessor for the dead-letter topics of the manager's consumers
+func NewDLQReprocessor(manager *Manager, cfg *config.KafkaConfig, logger *utils.Logger) *DLQReprocessor {
+	maxAttempts := cfg.DLQMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	r := &DLQReprocessor{
+		manager:     manager,
+		config:      cfg,
+		logger:      logger.Named("dlq_reprocessor"),
+		maxAttempts: maxAttempts,
+		stats:       make(map[string]*DLQStats),
+	}
+	r.ScheduledWorker = lifecycle.NewScheduledWorker("dlq-reprocessor", time.Duration(cfg.DLQReplayInterval)*time.Minute, r.replayAll)
+	return r
+}
+
+// replayAll replays the dead-letter topics of every topic with handlers while the manager runs
+func (r *DLQReprocessor) replayAll(ctx context.Context) error {
+	if !r.manager.IsRunning() {
+		return nil
+	}
+
+	var errs []error
+	for _, topic := range r.manager.HandledTopics() {
+		if _, err := r.Replay(ctx, topic); err != nil && ctx.Err() == nil {
+			r.logger.Error("DLQ replay failed", zap.String("topic", topic), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the dead-letter stats of every topic with handlers
+func (r *DLQReprocessor) Stats() ([]DLQStats, error) {
+	if !r.manager.IsRunning() {
+		return nil, ErrKafkaNotRunning
+	}
+
+	topics := r.manager.HandledTopics()
+	stats := make([]DLQStats, 0, len(topics))
+	for _, topic := range topics {
+		reader, err := r.openDLQ(topic)
+		if err != nil {
+			return nil, err
+		}
+		pending := reader.pending()
+		reader.close()
+
+		topicStats := r.topicStats(topic)
+		topicStats.Pending = pending
+		stats = append(stats, topicStats)
+	}
+	return stats, nil
+}
+
+// Inspect returns up to limit messages waiting in a topic's dead-letter topic, oldest first
+// per partition, along with its stats. Nothing is committed, so the messages stay pending.
+func (r *DLQReprocessor) Inspect(ctx context.Context, topic string, limit int) ([]DLQMessage, *DLQStats, error) {
+	if !r.manager.IsRunning() {
+		return nil, nil, ErrKafkaNotRunning
+	}
+
+	reader, err := r.openDLQ(topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.close()
+
+	var messages []DLQMessage
+	err = reader.read(ctx, func(msg *kafka.Message) error {
+		if limit > 0 && len(messages) >= limit {
+			return errStopReading
+		}
+		messages = append(messages, toDLQMessage(msg))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats := r.topicStats(topic)
+	stats.Pending = reader.pending()
+	return messages, &stats, nil
+}
+
+// Replay re-applies the original handlers to the messages in a topic's dead-letter topic.
+// Only messages present when the replay starts are read; requeued ones wait for the next replay.
+func (r *DLQReprocessor) Replay(ctx context.Context, topic string) (*DLQReplayResult, error) {
+	if !r.manager.IsRunning() {
+		return nil, ErrKafkaNotRunning
+	}
+
+	r.replayMutex.Lock()
+	defer r.replayMutex.Unlock()
+
+	reader, err := r.openDLQ(topic)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.close()
+
+	result := &DLQReplayResult{Topic: topic}
+	err = reader.read(ctx, func(msg *kafka.Message) error {
+		if err := r.replayMessage(topic, msg, result); err != nil {
+			return err
+		}
+		return reader.commit(msg)
+	})
+
+	r.statsMutex.Lock()
+	stats := r.statsFor(topic)
+	stats.Replayed += int64(result.Replayed)
+	stats.Requeued += int64(result.Requeued)
+	stats.PermanentFailures += int64(result.PermanentFailures)
+	now := time.Now()
+	stats.LastReplay = &now
+	r.statsMutex.Unlock()
+
+	if err != nil {
+		return result, err
+	}
+
+	r.logger.Info("Replayed DLQ",
+		zap.String("topic", topic),
+		zap.Int("replayed", result.Replayed),
+		zap.Int("requeued", result.Requeued),
+		zap.Int("permanent_failures", result.PermanentFailures))
+	return result, nil
+}
+
+// replayMessage runs a dead-lettered message through its original handlers, requeuing or
+// parking it if they fail again. An error means the message could not be put back and must
+// not be committed.
+func (r *DLQReprocessor) replayMessage(topic string, msg *kafka.Message, result *DLQReplayResult) error {
+	headers := messageHeaders(msg)
+	original := headers[HeaderOriginalTopic]
+	if original == "" {
+		original = topic
+	}
+	index := -1
+	if value, err := strconv.Atoi(headers[HeaderHandlerIndex]); err == nil {
+		index = value
+	}
+	attempts, _ := strconv.Atoi(headers[HeaderReplayAttempts])
+
+	replayed := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &original, Partition: msg.TopicPartition.Partition},
+		Key:            msg.Key,
+		Value:          msg.Value,
+		Timestamp:      msg.Timestamp,
+	}
+
+	handleErr := errors.New("no handler is registered for the topic")
+	if handlers := r.manager.replayHandlers(headers[HeaderConsumer], index, original); len(handlers) > 0 {
+		handleErr = nil
+		for _, handler := range handlers {
+			if err := handler(replayed); err != nil {
+				handleErr = err
+				break
+			}
+		}
+	}
+	if handleErr == nil {
+		result.Replayed++
+		return nil
+	}
+
+	attempts++
+	headers[HeaderError] = handleErr.Error()
+	headers[HeaderReplayAttempts] = strconv.Itoa(attempts)
+
+	target := DLQTopic(original)
+	if attempts >= r.maxAttempts {
+		target = DLQFailedTopic(original)
+		r.logger.Error("Dead-lettered message failed permanently",
+			zap.String("topic", original),
+			zap.String("key", string(msg.Key)),
+			zap.Int("attempts", attempts),
+			zap.Error(handleErr))
+	}
+
+	message := &Message{Key: string(msg.Key), Timestamp: msg.Timestamp, Headers: headers}
+	if err := r.manager.dlqProducer.produceBytesSync(target, message, msg.Value); err != nil {
+		return fmt.Errorf("failed to requeue dead-lettered message: %w", err)
+	}
+
+	if target == DLQTopic(original) {
+		result.Requeued++
+	} else {
+		result.PermanentFailures++
+	}
+	return nil
+}
+
+// topicStats returns a copy of the replay stats of a topic
+func (r *DLQReprocessor) topicStats(topic string) DLQStats {
+	r.statsMutex.Lock()
+	defer r.statsMutex.Unlock()
+	return *r.statsFor(topic)
+}
+
+// statsFor returns the replay stats of a topic; the caller must hold statsMutex
+func (r *DLQReprocessor) statsFor(topic string) *DLQStats {
+	stats, ok := r.stats[topic]
+	if !ok {
+		stats = &DLQStats{Topic: topic, DLQTopic: DLQTopic(topic)}
+		r.stats[topic] = stats
+	}
+	return stats
+}
+
+// errStopReading ends a dlqReader.read early without an error
+var errStopReading = errors.New("stop reading")
+
+// dlqReader reads a dead-letter topic from the reprocessor group's committed offsets up to
+// the end offsets it had when opened
+type dlqReader struct {
+	consumer *kafka.Consumer
+	topic    string
+	start    map[int32]kafka.Offset
+	end      map[int32]kafka.Offset
+}
+
+// openDLQ opens a reader on the dead-letter topic of a topic; a missing topic reads as empty
+func (r *DLQReprocessor) openDLQ(topic string) (*dlqReader, error) {
+	kafkaConfig := &kafka.ConfigMap{
+		"bootstrap.servers":  r.config.Brokers,
+		"group.id":           r.config.ConsumerGroup + "-dlq",
+		"enable.auto.commit": false,
+		"auto.offset.reset":  "earliest",
+	}
+	if err := setSecurity(kafkaConfig, r.config); err != nil {
+		return nil, err
+	}
+
+	consumer, err := kafka.NewConsumer(kafkaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DLQ consumer: %w", err)
+	}
+
+	reader := &dlqReader{
+		consumer: consumer,
+		topic:    DLQTopic(topic),
+		start:    make(map[int32]kafka.Offset),
+		end:      make(map[int32]kafka.Offset),
+	}
+
+	timeout := int(dlqRequestTimeout.Milliseconds())
+	metadata, err := consumer.GetMetadata(&reader.topic, false, timeout)
+	if err != nil {
+		reader.close()
+		return nil, fmt.Errorf("failed to get DLQ metadata: %w", err)
+	}
+	topicMetadata, ok := metadata.Topics[reader.topic]
+	if !ok || topicMetadata.Error.Code() != kafka.ErrNoError {
+		return reader, nil
+	}
+
+	partitions := make([]kafka.TopicPartition, 0, len(topicMetadata.Partitions))
+	for _, partition := range topicMetadata.Partitions {
+		partitions = append(partitions, kafka.TopicPartition{Topic: &reader.topic, Partition: partition.ID})
+	}
+	committed, err := consumer.Committed(partitions, timeout)
+	if err != nil {
+		reader.close()
+		return nil, fmt.Errorf("failed to get committed DLQ offsets: %w", err)
+	}
+
+	for i := range committed {
+		partition := committed[i].Partition
+		low, high, err := consumer.QueryWatermarkOffsets(reader.topic, partition, timeout)
+		if err != nil {
+			reader.close()
+			return nil, fmt.Errorf("failed to get DLQ offsets: %w", err)
+		}
+
+		start := committed[i].Offset
+		if start < 0 || int64(start) < low {
+			start = kafka.Offset(low)
+		}
+		committed[i].Offset = start
+		reader.start[partition] = start
+		reader.end[partition] = kafka.Offset(high)
+	}
+
+	if err := consumer.Assign(committed); err != nil {
+		reader.close()
+		return nil, fmt.Errorf("failed to assign DLQ partitions: %w", err)
+	}
+	return reader, nil
+}
+
+// pending returns the number of messages between the committed and the end offsets
+func (d *dlqReader) pending() int64 {
+	var pending int64
+	for partition, end := range d.end {
+		if end > d.start[partition] {
+			pending += int64(end - d.start[partition])
+		}
+	}
+	return pending
+}
+
+// read passes each message up to the end offsets to handle, stopping at the first error
+func (d *dlqReader) read(ctx context.Context, handle func(msg *kafka.Message) error) error {
+	remaining := make(map[int32]bool)
+	for partition, end := range d.end {
+		if end > d.start[partition] {
+			remaining[partition] = true
+		}
+	}
+
+	deadline := time.Now().Add(dlqReadTimeout)
+	for len(remaining) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timed out reading the DLQ")
+		}
+
+		msg, err := d.consumer.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			var kafkaErr kafka.Error
+			if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+				continue
+			}
+			return fmt.Errorf("failed to read the DLQ: %w", err)
+		}
+
+		partition := msg.TopicPartition.Partition
+		if !remaining[partition] || msg.TopicPartition.Offset >= d.end[partition] {
+			continue
+		}
+
+		if err := handle(msg); err != nil {
+			if errors.Is(err, errStopReading) {
+				return nil
+			}
+			return err
+		}
+		if msg.TopicPartition.Offset+1 >= d.end[partition] {
+			delete(remaining, partition)
+		}
+	}
+	return nil
+}
+
+// commit marks a message as handled for the reprocessor group
+func (d *dlqReader) commit(msg *kafka.Message) error {
+	offset := msg.TopicPartition
+	offset.Offset++
+	if _, err := d.consumer.CommitOffsets([]kafka.TopicPartition{offset}); err != nil {
+		return fmt.Errorf("failed to commit DLQ offset: %w", err)
+	}
+	d.start[offset.Partition] = offset.Offset
+	return nil
+}
+
+// close closes the reader's consumer
+func (d *dlqReader) close() {
+	_ = d.consumer.Close()
+}
+
+// messageHeaders returns the headers of a message as a map
+func messageHeaders(msg *kafka.Message) map[string]string {
+	headers := make(map[string]string, len(msg.Headers))
+	for _, header := range msg.Headers {
+		headers[header.Key] = string(header.Value)
+	}
+	return headers
+}
+
+// toDLQMessage describes a message read from a dead-letter topic
+func toDLQMessage(msg *kafka.Message) DLQMessage {
+	headers := messageHeaders(msg)
+	attempts, _ := strconv.Atoi(headers[HeaderReplayAttempts])
+
+	message := DLQMessage{
+		Partition:      msg.TopicPartition.Partition,
+		Offset:         int64(msg.TopicPartition.Offset),
+		Key:            string(msg.Key),
+		Error:          headers[HeaderError],
+		Consumer:       headers[HeaderConsumer],
+		ReplayAttempts: attempts,
+		Timestamp:      msg.Timestamp,
+	}
+	if json.Valid(msg.Value) {
+		message.Value = msg.Value
+	} else if len(msg.Value) > 0 {
+		encoded, _ := json.Marshal(string(msg.Value))
+		message.Value = encoded
+	}
+	return message
+}
@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// DLQ alert states
+const (
+	DLQAlertFiring  = "firing"
+	DLQAlertCleared = "cleared"
+)
+
+// dlqWatchInterval is how often the watcher checks whether firing alerts have cleared
+const dlqWatchInterval = 10 * time.Second
+
+// DLQAlert reports a topic whose messages are dead-lettered faster than the threshold, or
+// that it has cleared
+type DLQAlert struct {
+	Topic    string `json:"topic"`
+	DLQTopic string `json:"dlq_topic"`
+	Status   string `json:"status"`
+	// Count is the number of messages dead-lettered within the window
+	Count     int `json:"count"`
+	Threshold int `json:"threshold"`
+	Window    int `json:"window_seconds"`
+	// SampleError is the error of the last message dead-lettered
+	SampleError string    `json:"sample_error,omitempty"`
+	Since       time.Time `json:"since"`
+	At          time.Time `json:"at"`
+}
+
+// DLQAlertFunc is called when a topic's DLQ alert fires or clears
+type DLQAlertFunc func(alert DLQAlert)
+
+// dlqTopicRate holds the dead-lettered messages of a topic within the window
+type dlqTopicRate struct {
+	times       []time.Time
+	sampleError string
+	firingSince time.Time
+}
+
+// DLQWatcher counts the messages dead-lettered per topic within a sliding window. An alert
+// fires once when a topic reaches the threshold, and clears once its count within the
+// window has fallen below the threshold again.
+type DLQWatcher struct {
+	logger    *utils.Logger
+	threshold int
+	window    time.Duration
+	alert     DLQAlertFunc
+
+	mutex  sync.Mutex
+	topics map[string]*dlqTopicRate
+
+	// The periodic clearing of alerts whose rate subsided, disabled without a threshold
+	*lifecycle.ScheduledWorker
+}
+
+// NewDLQWatcher creates a watcher raising alerts with the configured threshold and window
+func NewDLQWatcher(cfg *config.KafkaConfig, alert DLQAlertFunc, logger *utils.Logger) *DLQWatcher {
+	w := &DLQWatcher{
+		logger:    logger.Named("dlq_watcher"),
+		threshold: cfg.DLQAlertThreshold,
+		window:    time.Duration(cfg.DLQAlertWindow) * time.Second,
+		alert:     alert,
+		topics:    make(map[string]*dlqTopicRate),
+	}
+
+	interval := dlqWatchInterval
+	if !w.Enabled() {
+		interval = 0
+	}
+	w.ScheduledWorker = lifecycle.NewScheduledWorker("dlq-watcher", interval, func(ctx context.Context) error {
+		w.Check(time.Now())
+		return nil
+	})
+	return w
+}
+
+// Enabled reports whether a threshold and window are configured
+func (w *DLQWatcher) Enabled() bool {
+	return w.threshold > 0 && w.window > 0
+}
+
+// Record counts a message of a topic dead-lettered with an error, firing the topic's alert
+// if it reaches the threshold
+func (w *DLQWatcher) Record(topic string, err error, at time.Time) {
+	if !w.Enabled() {
+		return
+	}
+
+	w.mutex.Lock()
+	rate, ok := w.topics[topic]
+	if !ok {
+		rate = &dlqTopicRate{}
+		w.topics[topic] = rate
+	}
+	rate.times = append(rate.times, at)
+	if err != nil {
+		rate.sampleError = err.Error()
+	}
+	alert, fired := w.evaluate(topic, rate, at)
+	w.mutex.Unlock()
+
+	if fired {
+		w.raise(alert)
+	}
+}
+
+// Check re-evaluates every topic, clearing the alerts of those whose rate subsided. It returns
+// the alerts raised.
+func (w *DLQWatcher) Check(now time.Time) []DLQAlert {
+	w.mutex.Lock()
+	names := make([]string, 0, len(w.topics))
+	for topic := range w.topics {
+		names = append(names, topic)
+	}
+	sort.Strings(names)
+
+	var alerts []DLQAlert
+	for _, topic := range names {
+		rate := w.topics[topic]
+		if alert, changed := w.evaluate(topic, rate, now); changed {
+			alerts = append(alerts, alert)
+		}
+		// Quiet topics are forgotten
+		if len(rate.times) == 0 && rate.firingSince.IsZero() {
+			delete(w.topics, topic)
+		}
+	}
+	w.mutex.Unlock()
+
+	for _, alert := range alerts {
+		w.raise(alert)
+	}
+	return alerts
+}
+
+// Firing returns the alerts currently firing, by topic
+func (w *DLQWatcher) Firing() []DLQAlert {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var alerts []DLQAlert
+	for topic, rate := range w.topics {
+		if !rate.firingSince.IsZero() {
+			alerts = append(alerts, w.describe(topic, rate, DLQAlertFiring, rate.firingSince, time.Now()))
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Topic < alerts[j].Topic })
+	return alerts
+}
+
+// evaluate drops the messages of a topic that left the window and fires or clears its alert;
+// the caller must hold the mutex
+func (w *DLQWatcher) evaluate(topic string, rate *dlqTopicRate, now time.Time) (DLQAlert, bool) {
+	cutoff := now.Add(-w.window)
+	kept := rate.times[:0]
+	for _, at := range rate.times {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	rate.times = kept
+
+	firing := !rate.firingSince.IsZero()
+	switch {
+	case !firing && len(rate.times) >= w.threshold:
+		rate.firingSince = now
+		return w.describe(topic, rate, DLQAlertFiring, now, now), true
+	case firing && len(rate.times) < w.threshold:
+		since := rate.firingSince
+		rate.firingSince = time.Time{}
+		return w.describe(topic, rate, DLQAlertCleared, since, now), true
+	}
+	return DLQAlert{}, false
+}
+
+// describe builds the alert of a topic; the caller must hold the mutex
+func (w *DLQWatcher) describe(topic string, rate *dlqTopicRate, status string, since, at time.Time) DLQAlert {
+	return DLQAlert{
+		Topic:       topic,
+		DLQTopic:    DLQTopic(topic),
+		Status:      status,
+		Count:       len(rate.times),
+		Threshold:   w.threshold,
+		Window:      int(w.window / time.Second),
+		SampleError: rate.sampleError,
+		Since:       since,
+		At:          at,
+	}
+}
+
+// raise logs an alert and passes it on
+func (w *DLQWatcher) raise(alert DLQAlert) {
+	if alert.Status == DLQAlertFiring {
+		w.logger.Warn("Messages are being dead-lettered",
+			zap.String("topic", alert.Topic),
+			zap.Int("count", alert.Count),
+			zap.Int("window_seconds", alert.Window),
+			zap.String("sample_error", alert.SampleError))
+	} else {
+		w.logger.Info("Dead-lettering subsided", zap.String("topic", alert.Topic), zap.Int("count", alert.Count))
+	}
+	if w.alert != nil {
+		w.alert(alert)
+	}
+}
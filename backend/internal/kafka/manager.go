@@ -2,9 +2,10 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
@@ -30,12 +31,21 @@ type Manager struct {
 	mainProducer     *Producer
 	dlqProducer      *Producer
 	consumers        map[string]*Consumer
+	handlers         map[string]map[string][]MessageHandler // handlers per consumer name and topic
 	consumerCtx      context.Context
 	consumerCancel   context.CancelFunc
 	wg               sync.WaitGroup
 	mu               sync.Mutex
+	closeOnce        sync.Once
 	isRunning        bool
+	paused           bool
 	messageProcessed chan struct{}
+	// Counts dead-lettered messages to alert on their rate. Consumers read it without taking
+	// mu, which Stop holds while they drain.
+	dlqWatcher atomic.Pointer[DLQWatcher]
+
+	// Topics provides the typed topic operations on top of the manager
+	Topics
 }
 
 // NewManager creates a new Kafka manager
@@ -57,17 +67,21 @@ func NewManager(cfg *config.KafkaConfig, logger *utils.Logger) (*Manager, error)
 	// Create context for consumers
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Manager{
+	manager := &Manager{
 		config:           cfg,
 		logger:           kafkaLogger,
 		mainProducer:     mainProducer,
 		dlqProducer:      dlqProducer,
 		consumers:        make(map[string]*Consumer),
+		handlers:         make(map[string]map[string][]MessageHandler),
 		consumerCtx:      ctx,
 		consumerCancel:   cancel,
 		messageProcessed: make(chan struct{}, 100), // Buffer for processing signals
 		isRunning:        false,
-	}, nil
+	}
+	manager.Topics = Topics{Transport: manager}
+
+	return manager, nil
 }
 
 // Start initializes and starts all registered consumers
@@ -101,25 +115,64 @@ func (m *Manager) Start() error {
 	return nil
 }
 
-// AddConsumer creates and registers a consumer with specific handlers
+// ConsumerInfo describes a registered consumer
+type ConsumerInfo struct {
+	Name    string   `json:"name"`
+	Topics  []string `json:"topics"`
+	Group   string   `json:"group"`
+	Running bool     `json:"running"`
+	Paused  bool     `json:"paused"`
+}
+
+// SetDLQWatcher sets the watcher counting the messages consumers dead-letter
+func (m *Manager) SetDLQWatcher(watcher *DLQWatcher) {
+	m.dlqWatcher.Store(watcher)
+}
+
+// recordDeadLetter passes a dead-lettered message on to the DLQ watcher, if any
+func (m *Manager) recordDeadLetter(topic string, err error) {
+	if watcher := m.dlqWatcher.Load(); watcher != nil {
+		watcher.Record(topic, err, time.Now())
+	}
+}
+
+// AddConsumer creates and registers a consumer with specific handlers.
+// If the manager is already running, the consumer is started immediately.
 func (m *Manager) AddConsumer(name string, topics []string, handlers map[string][]MessageHandler) error {
+	return m.AddConsumerWithOptions(name, topics, handlers, ConsumerOptions{})
+}
+
+// AddConsumerWithOptions creates and registers a consumer like AddConsumer, joining the
+// given consumer group and optionally without dead-lettering
+func (m *Manager) AddConsumerWithOptions(name string, topics []string, handlers map[string][]MessageHandler, opts ConsumerOptions) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if m.isRunning {
-		return fmt.Errorf("cannot add consumer while manager is running")
-	}
-
 	// Check if consumer with this name already exists
 	if _, exists := m.consumers[name]; exists {
 		return fmt.Errorf("consumer with name %s already exists", name)
 	}
 
 	// Create consumer
-	consumer, err := NewConsumer(m.config, m.logger, m.dlqProducer)
+	consumerConfig := m.config
+	if opts.Group != "" && opts.Group != m.config.ConsumerGroup {
+		groupConfig := *m.config
+		groupConfig.ConsumerGroup = opts.Group
+		consumerConfig = &groupConfig
+	}
+	dlqProducer := m.dlqProducer
+	if opts.DisableDLQ {
+		dlqProducer = nil
+	}
+	consumer, err := NewConsumer(consumerConfig, m.logger, dlqProducer)
 	if err != nil {
 		return fmt.Errorf("failed to create consumer %s: %w", name, err)
 	}
+	consumer.name = name
+	consumer.deadLettered = m.recordDeadLetter
+	if m.paused {
+		_ = consumer.Pause()
+	}
 
 	// Register handlers
 	for topic, topicHandlers := range handlers {
@@ -128,163 +181,134 @@ func (m *Manager) AddConsumer(name string, topics []string, handlers map[string]
 		}
 	}
 
-	// Store consumer
+	// Start right away when added at runtime
+	if m.isRunning {
+		if err := consumer.Start(m.consumerCtx); err != nil {
+			_ = consumer.Close()
+			return fmt.Errorf("failed to start consumer %s: %w", name, err)
+		}
+	}
+
+	// Store consumer and its handlers, which dead-lettered messages are replayed to
 	m.consumers[name] = consumer
+	m.handlers[name] = handlers
 	m.logger.Info("Added consumer",
 		zap.String("name", name),
-		zap.Strings("topics", topics))
+		zap.Strings("topics", topics),
+		zap.Bool("started", m.isRunning))
 
 	return nil
 }
 
-// wrapHandler wraps a message handler to signal when processing is complete
-func (m *Manager) wrapHandler(handler MessageHandler) MessageHandler {
-	return func(msg *kafka.Message) error {
-		defer func() {
-			select {
-			case m.messageProcessed <- struct{}{}:
-				// Signal sent
-			default:
-				// Channel buffer full, which is fine in high throughput
-			}
-		}()
+// RemoveConsumer stops and unregisters a consumer
+func (m *Manager) RemoveConsumer(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		return handler(msg)
+	consumer, exists := m.consumers[name]
+	if !exists {
+		return fmt.Errorf("consumer with name %s not found", name)
 	}
-}
 
-// ProduceMessage sends a message to the specified topic
-func (m *Manager) ProduceMessage(topic string, key string, value interface{}, headers map[string]string) error {
-	message := &Message{
-		Key:       key,
-		Value:     value,
-		Timestamp: time.Now(),
-		Headers:   headers,
+	// A running consumer closes its Kafka client when its loop exits
+	if consumer.IsRunning() {
+		consumer.Stop()
+	} else if err := consumer.Close(); err != nil {
+		m.logger.Warn("Failed to close consumer", zap.String("name", name), zap.Error(err))
 	}
 
-	return m.mainProducer.Produce(topic, message)
-}
-
-// ProduceDittoEvent publishes a Ditto event to Kafka
-func (m *Manager) ProduceDittoEvent(thingID string, action string, payload interface{}) error {
-	event := map[string]interface{}{
-		"thingId":   thingID,
-		"action":    action,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"payload":   payload,
-	}
+	delete(m.consumers, name)
+	delete(m.handlers, name)
+	m.logger.Info("Removed consumer", zap.String("name", name))
 
-	return m.ProduceMessage(TopicDittoEvents, thingID, event, nil)
+	return nil
 }
 
-// ProduceTimeSeriesData publishes time-series data to Kafka
-func (m *Manager) ProduceTimeSeriesData(thingID string, featureID string, data interface{}) error {
-	tsData := map[string]interface{}{
-		"thingId":   thingID,
-		"featureId": featureID,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"data":      data,
-	}
-
-	return m.ProduceMessage(TopicTimeSeriesData, thingID, tsData, nil)
-}
+// ListConsumers returns the registered consumers sorted by name
+func (m *Manager) ListConsumers() []ConsumerInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-// ProduceMLInput publishes ML input data to Kafka
-func (m *Manager) ProduceMLInput(modelID string, input interface{}) error {
-	mlInput := map[string]interface{}{
-		"modelId":   modelID,
-		"timestamp": time.Now().Format(time.RFC3339),
-		"input":     input,
+	consumers := make([]ConsumerInfo, 0, len(m.consumers))
+	for name, consumer := range m.consumers {
+		consumers = append(consumers, ConsumerInfo{
+			Name:    name,
+			Topics:  consumer.Topics(),
+			Group:   consumer.Group(),
+			Running: consumer.IsRunning(),
+			Paused:  consumer.IsPaused(),
+		})
 	}
 
-	return m.ProduceMessage(TopicMLInput, modelID, mlInput, nil)
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+
+	return consumers
 }
 
-// RegisterDittoEventHandler registers a handler for Ditto events
-func (m *Manager) RegisterDittoEventHandler(name string, handler func(thingID, action string, payload json.RawMessage) error) error {
-	msgHandler := func(msg *kafka.Message) error {
-		var event struct {
-			ThingID   string          `json:"thingId"`
-			Action    string          `json:"action"`
-			Timestamp string          `json:"timestamp"`
-			Payload   json.RawMessage `json:"payload"`
-		}
+// HandledTopics returns the topics consumers have handlers for, sorted by name
+func (m *Manager) HandledTopics() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			return fmt.Errorf("failed to unmarshal Ditto event: %w", err)
+	seen := make(map[string]bool)
+	var topics []string
+	for _, consumerHandlers := range m.handlers {
+		for topic := range consumerHandlers {
+			if !seen[topic] {
+				seen[topic] = true
+				topics = append(topics, topic)
+			}
 		}
-
-		return handler(event.ThingID, event.Action, event.Payload)
 	}
-
-	return m.AddConsumer(
-		fmt.Sprintf("%s-ditto-events", name),
-		[]string{TopicDittoEvents},
-		map[string][]MessageHandler{
-			TopicDittoEvents: {msgHandler},
-		},
-	)
+	sort.Strings(topics)
+	return topics
 }
 
-// RegisterTimeSeriesDataHandler registers a handler for time-series data
-func (m *Manager) RegisterTimeSeriesDataHandler(name string, handler func(thingID, featureID string, timestamp time.Time, data json.RawMessage) error) error {
-	msgHandler := func(msg *kafka.Message) error {
-		var tsData struct {
-			ThingID   string          `json:"thingId"`
-			FeatureID string          `json:"featureId"`
-			Timestamp string          `json:"timestamp"`
-			Data      json.RawMessage `json:"data"`
-		}
-
-		if err := json.Unmarshal(msg.Value, &tsData); err != nil {
-			return fmt.Errorf("failed to unmarshal time-series data: %w", err)
-		}
-
-		timestamp, err := time.Parse(time.RFC3339, tsData.Timestamp)
-		if err != nil {
-			return fmt.Errorf("failed to parse timestamp: %w", err)
-		}
+// replayHandlers returns the handler that failed on a dead-lettered message, identified by its
+// consumer and handler index, or all handlers of the topic if it cannot be identified
+func (m *Manager) replayHandlers(consumer string, index int, topic string) []MessageHandler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		return handler(tsData.ThingID, tsData.FeatureID, timestamp, tsData.Data)
+	if handlers := m.handlers[consumer][topic]; index >= 0 && index < len(handlers) {
+		return handlers[index : index+1]
 	}
 
-	return m.AddConsumer(
-		fmt.Sprintf("%s-timeseries-data", name),
-		[]string{TopicTimeSeriesData},
-		map[string][]MessageHandler{
-			TopicTimeSeriesData: {msgHandler},
-		},
-	)
+	var handlers []MessageHandler
+	for _, consumerHandlers := range m.handlers {
+		handlers = append(handlers, consumerHandlers[topic]...)
+	}
+	return handlers
 }
 
-// RegisterMLOutputHandler registers a handler for ML output data
-func (m *Manager) RegisterMLOutputHandler(name string, handler func(modelID string, timestamp time.Time, output json.RawMessage) error) error {
-	msgHandler := func(msg *kafka.Message) error {
-		var mlOutput struct {
-			ModelID   string          `json:"modelId"`
-			Timestamp string          `json:"timestamp"`
-			Output    json.RawMessage `json:"output"`
-		}
-
-		if err := json.Unmarshal(msg.Value, &mlOutput); err != nil {
-			return fmt.Errorf("failed to unmarshal ML output data: %w", err)
-		}
+// wrapHandler wraps a message handler to signal when processing is complete
+func (m *Manager) wrapHandler(handler MessageHandler) MessageHandler {
+	return func(msg *kafka.Message) error {
+		defer func() {
+			select {
+			case m.messageProcessed <- struct{}{}:
+				// Signal sent
+			default:
+				// Channel buffer full, which is fine in high throughput
+			}
+		}()
 
-		timestamp, err := time.Parse(time.RFC3339, mlOutput.Timestamp)
-		if err != nil {
-			return fmt.Errorf("failed to parse timestamp: %w", err)
-		}
+		return handler(msg)
+	}
+}
 
-		return handler(mlOutput.ModelID, timestamp, mlOutput.Output)
+// ProduceMessage sends a message to the specified topic
+func (m *Manager) ProduceMessage(topic string, key string, value interface{}, headers map[string]string) error {
+	message := &Message{
+		Key:       key,
+		Value:     value,
+		Timestamp: time.Now(),
+		Headers:   headers,
 	}
 
-	return m.AddConsumer(
-		fmt.Sprintf("%s-ml-output", name),
-		[]string{TopicMLOutput},
-		map[string][]MessageHandler{
-			TopicMLOutput: {msgHandler},
-		},
-	)
+	return m.mainProducer.Produce(topic, message)
 }
 
 // monitorProcessing tracks and logs message processing metrics
@@ -324,8 +348,9 @@ func (m *Manager) stopAllConsumers() {
 	}
 }
 
-// Stop stops the Kafka manager and all consumers
-func (m *Manager) Stop() error {
+// StopConsumers stops all consumers and waits for the messages being handled. The producers
+// stay open until Close, so components flushing to Kafka during shutdown can still produce.
+func (m *Manager) StopConsumers() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -342,17 +367,73 @@ func (m *Manager) Stop() error {
 	// Wait for all goroutines to finish
 	m.wg.Wait()
 
-	// Flush and close producers
-	m.mainProducer.Flush(5000)
-	m.mainProducer.Close()
-	m.dlqProducer.Flush(5000)
-	m.dlqProducer.Close()
-
 	m.isRunning = false
+	m.logger.Info("Kafka consumers stopped")
+	return nil
+}
+
+// Close flushes and closes the producers; messages produced afterwards fail
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		m.mainProducer.Close()
+		m.dlqProducer.Close()
+	})
+}
+
+// Stop stops the Kafka manager and all consumers, then closes the producers
+func (m *Manager) Stop() error {
+	if err := m.StopConsumers(); err != nil {
+		return err
+	}
+	m.Close()
+
 	m.logger.Info("Kafka manager stopped")
 	return nil
 }
 
+// Ping checks that the Kafka brokers are reachable
+func (m *Manager) Ping(timeout time.Duration) error {
+	return m.mainProducer.Ping(timeout)
+}
+
+// Pause stops all consumers from handling messages until Resume, including consumers added meanwhile.
+// Messages keep accumulating in Kafka and are handled after Resume.
+func (m *Manager) Pause() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.paused = true
+	for name, consumer := range m.consumers {
+		if err := consumer.Pause(); err != nil {
+			return fmt.Errorf("failed to pause consumer %s: %w", name, err)
+		}
+	}
+	m.logger.Info("Kafka consumers paused")
+	return nil
+}
+
+// Resume lets the consumers handle messages again after Pause
+func (m *Manager) Resume() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.paused = false
+	for name, consumer := range m.consumers {
+		if err := consumer.Resume(); err != nil {
+			return fmt.Errorf("failed to resume consumer %s: %w", name, err)
+		}
+	}
+	m.logger.Info("Kafka consumers resumed")
+	return nil
+}
+
+// IsPaused returns whether the consumers are paused
+func (m *Manager) IsPaused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.paused
+}
+
 // IsRunning returns whether the Kafka manager is running
 func (m *Manager) IsRunning() bool {
 	m.mu.Lock()
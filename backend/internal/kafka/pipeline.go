@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/config"
+)
+
+// ApplicationTopics lists the topics of the application
+var ApplicationTopics = []string{
+	TopicDittoEvents,
+	TopicTimeSeriesData,
+	TopicMLInput,
+	TopicMLOutput,
+	TopicDigitalTwinState,
+	TopicAlerts,
+}
+
+// Pipeline is a processing pipeline: a handler consuming one topic
+type Pipeline struct {
+	// Name identifies the pipeline in the kafka.pipelines config
+	Name string
+	// Topic is the topic consumed unless the config overrides it
+	Topic   string
+	Handler MessageHandler
+}
+
+// PipelineSpec is a pipeline with its configured settings applied
+type PipelineSpec struct {
+	Name  string `json:"name"`
+	Topic string `json:"topic"`
+	// Group is the consumer group of the pipeline's consumers
+	Group       string `json:"group"`
+	Concurrency int    `json:"concurrency"`
+	DLQ         bool   `json:"dlq"`
+	// Consumers names the consumers the pipeline runs
+	Consumers []string `json:"consumers"`
+
+	handler MessageHandler
+}
+
+// PipelineRegistry maps topics to the handlers processing them. Pipelines are declared in
+// code and tuned by the kafka.pipelines config, which is validated before any consumer is added.
+type PipelineRegistry struct {
+	pipelines []Pipeline
+	byName    map[string]bool
+}
+
+// NewPipelineRegistry creates an empty pipeline registry
+func NewPipelineRegistry() *PipelineRegistry {
+	return &PipelineRegistry{byName: make(map[string]bool)}
+}
+
+// Register declares a pipeline
+func (r *PipelineRegistry) Register(pipeline Pipeline) error {
+	switch {
+	case pipeline.Name == "":
+		return fmt.Errorf("pipeline has no name")
+	case pipeline.Topic == "":
+		return fmt.Errorf("pipeline %s has no topic", pipeline.Name)
+	case pipeline.Handler == nil:
+		return fmt.Errorf("pipeline %s has no handler", pipeline.Name)
+	case r.byName[pipeline.Name]:
+		return fmt.Errorf("pipeline %s is already registered", pipeline.Name)
+	}
+
+	r.byName[pipeline.Name] = true
+	r.pipelines = append(r.pipelines, pipeline)
+	return nil
+}
+
+// Resolve applies the configured settings to the registered pipelines and validates them:
+// every configured pipeline must be registered, every topic must be an application topic or
+// listed in extra_topics, and a consumer group of a pipeline's own may not be shared.
+func (r *PipelineRegistry) Resolve(cfg *config.KafkaConfig) ([]PipelineSpec, error) {
+	names := make([]string, 0, len(cfg.Pipelines))
+	for name := range cfg.Pipelines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !r.byName[name] {
+			return nil, fmt.Errorf("unknown pipeline %s in kafka.pipelines", name)
+		}
+	}
+
+	knownTopics := make(map[string]bool)
+	for _, topic := range append(append([]string(nil), ApplicationTopics...), cfg.ExtraTopics...) {
+		knownTopics[strings.TrimSpace(topic)] = true
+	}
+
+	specs := make([]PipelineSpec, 0, len(r.pipelines))
+	groups := make(map[string]string)
+	for _, pipeline := range r.pipelines {
+		settings := cfg.Pipelines[pipeline.Name]
+		spec := PipelineSpec{
+			Name:        pipeline.Name,
+			Topic:       pipeline.Topic,
+			Group:       cfg.ConsumerGroup,
+			Concurrency: 1,
+			DLQ:         true,
+			handler:     pipeline.Handler,
+		}
+		if settings.Topic != "" {
+			spec.Topic = strings.TrimSpace(settings.Topic)
+		}
+		if !knownTopics[spec.Topic] {
+			return nil, fmt.Errorf("pipeline %s consumes unknown topic %s", pipeline.Name, spec.Topic)
+		}
+
+		if settings.Group != "" && settings.Group != cfg.ConsumerGroup {
+			if other, exists := groups[settings.Group]; exists {
+				return nil, fmt.Errorf("pipelines %s and %s share consumer group %s", other, pipeline.Name, settings.Group)
+			}
+			groups[settings.Group] = pipeline.Name
+			spec.Group = settings.Group
+		}
+
+		if settings.Concurrency < 0 {
+			return nil, fmt.Errorf("pipeline %s has negative concurrency %d", pipeline.Name, settings.Concurrency)
+		}
+		if settings.Concurrency > 0 {
+			spec.Concurrency = settings.Concurrency
+		}
+		if settings.DLQ != nil {
+			spec.DLQ = *settings.DLQ
+		}
+
+		// The first consumer keeps the name consumers had before concurrency was configurable,
+		// which dead-lettered messages refer to
+		for i := 1; i <= spec.Concurrency; i++ {
+			consumer := fmt.Sprintf("%s-%s", pipeline.Name, pipeline.Topic)
+			if i > 1 {
+				consumer = fmt.Sprintf("%s-%d", consumer, i)
+			}
+			spec.Consumers = append(spec.Consumers, consumer)
+		}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
+// Wire resolves the pipelines and adds their consumers to the transport. Nothing is added
+// when the config is invalid.
+func (r *PipelineRegistry) Wire(transport Transport, cfg *config.KafkaConfig) ([]PipelineSpec, error) {
+	specs, err := r.Resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range specs {
+		opts := ConsumerOptions{Group: spec.Group, DisableDLQ: !spec.DLQ}
+		for _, consumer := range spec.Consumers {
+			handlers := map[string][]MessageHandler{spec.Topic: {spec.handler}}
+			if err := transport.AddConsumerWithOptions(consumer, []string{spec.Topic}, handlers, opts); err != nil {
+				return nil, fmt.Errorf("failed to add consumer %s of pipeline %s: %w", consumer, spec.Name, err)
+			}
+		}
+	}
+
+	return specs, nil
+}
@@ -102,6 +102,11 @@ func (p *Producer) Produce(topic string, message *Message) error {
 		return fmt.Errorf("failed to marshal message value: %w", err)
 	}
 
+	return p.produceBytes(topic, message, valueBytes)
+}
+
+// produceBytes sends an already encoded message value without waiting for the delivery report
+func (p *Producer) produceBytes(topic string, message *Message, valueBytes []byte) error {
 	// Create Kafka message
 	kafkaMessage := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
@@ -147,6 +152,11 @@ func (p *Producer) ProduceSync(topic string, message *Message) error {
 		return fmt.Errorf("failed to marshal message value: %w", err)
 	}
 
+	return p.produceBytesSync(topic, message, valueBytes)
+}
+
+// produceBytesSync sends an already encoded message value and waits for the delivery report
+func (p *Producer) produceBytesSync(topic string, message *Message, valueBytes []byte) error {
 	// Create Kafka message
 	kafkaMessage := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
@@ -193,6 +203,14 @@ func (p *Producer) ProduceSync(topic string, message *Message) error {
 	return nil
 }
 
+// Ping checks that the brokers are reachable by requesting cluster metadata
+func (p *Producer) Ping(timeout time.Duration) error {
+	if _, err := p.producer.GetMetadata(nil, false, int(timeout.Milliseconds())); err != nil {
+		return fmt.Errorf("failed to reach Kafka brokers: %w", err)
+	}
+	return nil
+}
+
 // Flush flushes the producer's message queue
 func (p *Producer) Flush(timeoutMs int) int {
 	return p.producer.Flush(timeoutMs)
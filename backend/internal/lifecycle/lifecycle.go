@@ -0,0 +1,150 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Component is a background part of the service that is started and stopped with it.
+// Stop must drain the component's pending work, giving up when the context is done.
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Hook adapts start and stop functions to a Component; either function may be nil
+type Hook struct {
+	ComponentName string
+	OnStart       func(ctx context.Context) error
+	OnStop        func(ctx context.Context) error
+}
+
+// Name returns the component name
+func (h *Hook) Name() string {
+	return h.ComponentName
+}
+
+// Start runs the start function
+func (h *Hook) Start(ctx context.Context) error {
+	if h.OnStart == nil {
+		return nil
+	}
+	return h.OnStart(ctx)
+}
+
+// Stop runs the stop function
+func (h *Hook) Stop(ctx context.Context) error {
+	if h.OnStop == nil {
+		return nil
+	}
+	return h.OnStop(ctx)
+}
+
+// Registry starts components in the order they are registered and stops them in reverse,
+// so components should be registered from the ones others depend on (connections, buffers)
+// to the ones feeding them (ingest).
+type Registry struct {
+	logger *utils.Logger
+
+	mu         sync.Mutex
+	components []Component
+	started    []Component
+}
+
+// NewRegistry creates a new component registry
+func NewRegistry(logger *utils.Logger) *Registry {
+	return &Registry{
+		logger: logger.Named("lifecycle"),
+	}
+}
+
+// Register adds components to be started after the ones already registered
+func (r *Registry) Register(components ...Component) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.components = append(r.components, components...)
+}
+
+// Start starts the registered components in order. If one fails to start,
+// the components already started are stopped and the error is returned.
+func (r *Registry) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, component := range r.components[len(r.started):] {
+		r.logger.Info("Starting component", zap.String("component", component.Name()))
+		if err := component.Start(ctx); err != nil {
+			r.stopLocked(ctx)
+			return fmt.Errorf("failed to start %s: %w", component.Name(), err)
+		}
+		r.started = append(r.started, component)
+	}
+
+	return nil
+}
+
+// Stop stops the started components in reverse order. Every component is asked to stop,
+// even after an earlier one failed or the deadline passed; the errors are returned together.
+func (r *Registry) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.stopLocked(ctx)
+}
+
+// stopLocked stops the started components; the caller must hold the lock
+func (r *Registry) stopLocked(ctx context.Context) error {
+	var errs []error
+	for i := len(r.started) - 1; i >= 0; i-- {
+		component := r.started[i]
+		start := time.Now()
+
+		if err := component.Stop(ctx); err != nil {
+			r.logger.Error("Failed to stop component",
+				zap.String("component", component.Name()),
+				zap.Duration("duration", time.Since(start)),
+				zap.Error(err))
+			errs = append(errs, fmt.Errorf("failed to stop %s: %w", component.Name(), err))
+			continue
+		}
+
+		r.logger.Info("Stopped component",
+			zap.String("component", component.Name()),
+			zap.Duration("duration", time.Since(start)))
+	}
+	r.started = nil
+
+	return errors.Join(errs...)
+}
+
+// Workers returns the registered components that run as workers, in registration order
+func (r *Registry) Workers() []Worker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var workers []Worker
+	for _, component := range r.components {
+		if worker, ok := component.(Worker); ok {
+			workers = append(workers, worker)
+		}
+	}
+	return workers
+}
+
+// Worker returns the registered worker of a name
+func (r *Registry) Worker(name string) (Worker, bool) {
+	for _, worker := range r.Workers() {
+		if worker.Name() == name {
+			return worker, true
+		}
+	}
+	return nil, false
+}
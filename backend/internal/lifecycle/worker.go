@@ -0,0 +1,312 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Worker states
+const (
+	WorkerIdle     = "idle"
+	WorkerRunning  = "running"
+	WorkerPaused   = "paused"
+	WorkerStopped  = "stopped"
+	WorkerDisabled = "disabled"
+)
+
+var (
+	// ErrWorkerNotRunning is returned when a worker that is stopped or disabled is triggered
+	ErrWorkerNotRunning = errors.New("worker is not running")
+	// ErrWorkerOnDemand is returned when a worker that only runs on request is triggered
+	ErrWorkerOnDemand = errors.New("worker only runs on request")
+)
+
+// Worker is a component running a job in the background, which administrators can inspect,
+// run on demand, pause and resume
+type Worker interface {
+	Component
+	Status() WorkerStatus
+	// Trigger runs the job as soon as the worker is free, even while it is paused
+	Trigger() error
+	// Pause skips the scheduled runs until the worker is resumed
+	Pause()
+	Resume()
+}
+
+// WorkerStatus reports a worker's state and its last run
+type WorkerStatus struct {
+	Name            string `json:"name"`
+	State           string `json:"state"`
+	Paused          bool   `json:"paused"`
+	IntervalSeconds int64  `json:"interval_seconds"`
+	Runs            int64  `json:"runs"`
+	// LastRun is when the last run started, and LastError why it failed, if it did
+	LastRun        *time.Time `json:"last_run,omitempty"`
+	LastDurationMs int64      `json:"last_duration_ms"`
+	LastError      string     `json:"last_error,omitempty"`
+	// NextRun is when the next scheduled run is due; unset while paused or stopped
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+// ScheduledWorker runs a job every interval and whenever it is triggered, one run at a time.
+// A worker without an interval is disabled and does not start.
+type ScheduledWorker struct {
+	name     string
+	interval time.Duration
+	job      func(ctx context.Context) error
+
+	// RunOnStart runs the job when the worker starts rather than one interval later
+	RunOnStart bool
+
+	mu           sync.Mutex
+	started      bool
+	paused       bool
+	running      bool
+	runs         int64
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+	nextRun      time.Time
+	trigger      chan struct{}
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// NewScheduledWorker creates a worker running a job every interval; an interval of 0 disables it
+func NewScheduledWorker(name string, interval time.Duration, job func(ctx context.Context) error) *ScheduledWorker {
+	return &ScheduledWorker{
+		name:     name,
+		interval: interval,
+		job:      job,
+	}
+}
+
+// Name returns the component name
+func (w *ScheduledWorker) Name() string {
+	return w.name
+}
+
+// Start runs the job periodically unless the worker is disabled
+func (w *ScheduledWorker) Start(ctx context.Context) error {
+	if w.interval <= 0 {
+		return nil
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	w.mu.Lock()
+	w.started = true
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	w.trigger = make(chan struct{}, 1)
+	w.nextRun = time.Now().Add(w.interval)
+	if w.RunOnStart {
+		w.nextRun = time.Now()
+	}
+	done, trigger := w.done, w.trigger
+	w.mu.Unlock()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		if w.RunOnStart {
+			w.runScheduled(runCtx)
+		}
+		for {
+			select {
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				w.runScheduled(runCtx)
+			case <-trigger:
+				w.run(runCtx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops the worker, waiting for a running job to finish
+func (w *ScheduledWorker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	cancel, done := w.cancel, w.done
+	w.started = false
+	w.cancel = nil
+	w.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s not finished: %w", w.name, ctx.Err())
+	}
+}
+
+// runScheduled runs the job unless the worker is paused, and schedules the next run
+func (w *ScheduledWorker) runScheduled(ctx context.Context) {
+	w.mu.Lock()
+	w.nextRun = time.Now().Add(w.interval)
+	paused := w.paused
+	w.mu.Unlock()
+
+	if !paused {
+		w.run(ctx)
+	}
+}
+
+// run runs the job and records its outcome
+func (w *ScheduledWorker) run(ctx context.Context) {
+	start := time.Now()
+	w.mu.Lock()
+	w.running = true
+	w.mu.Unlock()
+
+	err := w.job(ctx)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = false
+	w.runs++
+	w.lastRun = start
+	w.lastDuration = time.Since(start)
+	w.lastError = ""
+	if err != nil {
+		w.lastError = err.Error()
+	}
+}
+
+// Trigger queues a run of the job; a run already queued is not queued again
+func (w *ScheduledWorker) Trigger() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		return ErrWorkerNotRunning
+	}
+
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pause skips the scheduled runs until the worker is resumed; a running job is not interrupted
+func (w *ScheduledWorker) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = true
+}
+
+// Resume runs the job on schedule again
+func (w *ScheduledWorker) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.paused = false
+}
+
+// Status returns the worker's state and its last run
+func (w *ScheduledWorker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := WorkerStatus{
+		Name:            w.name,
+		Paused:          w.paused,
+		IntervalSeconds: int64(w.interval / time.Second),
+		Runs:            w.runs,
+		LastDurationMs:  w.lastDuration.Milliseconds(),
+		LastError:       w.lastError,
+	}
+	switch {
+	case w.interval <= 0:
+		status.State = WorkerDisabled
+	case !w.started:
+		status.State = WorkerStopped
+	case w.running:
+		status.State = WorkerRunning
+	case w.paused:
+		status.State = WorkerPaused
+	default:
+		status.State = WorkerIdle
+	}
+	if !w.lastRun.IsZero() {
+		lastRun := w.lastRun
+		status.LastRun = &lastRun
+	}
+	if w.started && !w.paused {
+		nextRun := w.nextRun
+		status.NextRun = &nextRun
+	}
+	return status
+}
+
+// WorkerRuns records the runs of a worker driven by events rather than a schedule, such as a
+// batch writer or jobs run on request, for the worker to report its status with
+type WorkerRuns struct {
+	mu           sync.Mutex
+	active       int
+	runs         int64
+	lastRun      time.Time
+	lastDuration time.Duration
+	lastError    string
+}
+
+// Begin records the start of a run and returns the function recording its outcome
+func (r *WorkerRuns) Begin() func(err error) {
+	start := time.Now()
+	r.mu.Lock()
+	r.active++
+	r.mu.Unlock()
+
+	return func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.active--
+		r.runs++
+		r.lastRun = start
+		r.lastDuration = time.Since(start)
+		r.lastError = ""
+		if err != nil {
+			r.lastError = err.Error()
+		}
+	}
+}
+
+// Status returns the status of a worker with these runs; it is running while a run is
+func (r *WorkerRuns) Status(name string, interval time.Duration, started, paused bool) WorkerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := WorkerStatus{
+		Name:            name,
+		Paused:          paused,
+		IntervalSeconds: int64(interval / time.Second),
+		Runs:            r.runs,
+		LastDurationMs:  r.lastDuration.Milliseconds(),
+		LastError:       r.lastError,
+	}
+	switch {
+	case !started:
+		status.State = WorkerStopped
+	case r.active > 0:
+		status.State = WorkerRunning
+	case paused:
+		status.State = WorkerPaused
+	default:
+		status.State = WorkerIdle
+	}
+	if !r.lastRun.IsZero() {
+		lastRun := r.lastRun
+		status.LastRun = &lastRun
+	}
+	return status
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// AlertContext is the snapshot of a twin's data stored on an alert when it is raised, so
+// responders see what led to it without querying the history
+type AlertContext struct {
+	// RecentPoints are the latest points of the triggering feature up to the alert, oldest first
+	RecentPoints []AlertContextPoint `json:"recent_points,omitempty"`
+	// RelatedFeatures holds the latest value of each configured related feature
+	RelatedFeatures map[string]AlertContextPoint `json:"related_features,omitempty"`
+}
+
+// AlertContextPoint is a stored value of a feature
+type AlertContextPoint struct {
+	Time  time.Time       `json:"time"`
+	Value json.RawMessage `json:"value"`
+}
+
+// AlertEnricher captures the context of new alerts from the time-series data of their twin
+type AlertEnricher struct {
+	logger         *utils.Logger
+	config         *config.AlertConfig
+	timeseriesRepo repository.TimeseriesRepository
+}
+
+// NewAlertEnricher creates a new alert enricher capturing the configured context
+func NewAlertEnricher(db *db.Database, cfg *config.AlertConfig, logger *utils.Logger) *AlertEnricher {
+	return &AlertEnricher{
+		logger:         logger.Named("alert_enricher"),
+		config:         cfg,
+		timeseriesRepo: repository.NewRepositoryFactory(db.DB).Timeseries(),
+	}
+}
+
+// Enrich stores the context of an alert on it before it is inserted. Only data recorded up to
+// the alert's time is captured, so alerts raised for past values get the context of their time.
+// Failing to read the data leaves the alert without context rather than losing it.
+func (e *AlertEnricher) Enrich(ctx context.Context, alert *models.AlertData) {
+	snapshot, err := e.capture(ctx, alert)
+	if err != nil {
+		e.logger.Warn("Failed to capture alert context",
+			zap.String("alert_id", alert.AlertID),
+			zap.String("twin_id", alert.TwinID),
+			zap.Error(err))
+		return
+	}
+	if snapshot == nil {
+		return
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		e.logger.Warn("Failed to encode alert context", zap.String("alert_id", alert.AlertID), zap.Error(err))
+		return
+	}
+	alert.Context = models.JSON(data)
+}
+
+// capture reads the context of an alert, returning nil if there is none
+func (e *AlertEnricher) capture(ctx context.Context, alert *models.AlertData) (*AlertContext, error) {
+	snapshot := &AlertContext{}
+
+	if alert.FeaturePath != "" && e.config.ContextPoints > 0 {
+		points, err := e.timeseriesRepo.GetTimeseriesData(ctx, alert.TwinID, alert.FeaturePath, time.Time{}, alert.Time,
+			repository.TimeseriesPage{Limit: e.config.ContextPoints})
+		if err != nil {
+			return nil, err
+		}
+		// Read newest first to keep the latest points, reported oldest first
+		for i := len(points) - 1; i >= 0; i-- {
+			snapshot.RecentPoints = append(snapshot.RecentPoints, AlertContextPoint{Time: points[i].Time, Value: pointData(points[i])})
+		}
+	}
+
+	for _, featurePath := range e.config.ContextFeatures {
+		if featurePath == alert.FeaturePath {
+			continue
+		}
+		points, err := e.timeseriesRepo.GetTimeseriesData(ctx, alert.TwinID, featurePath, time.Time{}, alert.Time,
+			repository.TimeseriesPage{Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(points) == 0 {
+			continue
+		}
+		if snapshot.RelatedFeatures == nil {
+			snapshot.RelatedFeatures = make(map[string]AlertContextPoint)
+		}
+		snapshot.RelatedFeatures[featurePath] = AlertContextPoint{Time: points[0].Time, Value: pointData(points[0])}
+	}
+
+	if len(snapshot.RecentPoints) == 0 && len(snapshot.RelatedFeatures) == 0 {
+		return nil, nil
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Alert lifecycle states reported in lifecycle events
+const (
+	AlertStateAcknowledged = "acknowledged"
+)
+
+// AlertLifecycleEvent is the payload of an event reporting that a user changed the state of an alert
+type AlertLifecycleEvent struct {
+	AlertID     string    `json:"alert_id"`
+	DittoID     string    `json:"ditto_id"`
+	FeaturePath string    `json:"feature_path,omitempty"`
+	Severity    string    `json:"severity"`
+	State       string    `json:"state"`
+	Actor       string    `json:"actor"`
+	Note        string    `json:"note,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// AlertRoutingService delivers stored alerts according to the routes of their twin and
+// project. Routes of the twin are evaluated before those of its project, each in position
+// order, and the first matching route selects the channel and recipients. Alerts matching
+// no route are pushed to the project's websocket clients as twin alerts and sent to the
+// project's webhooks.
+type AlertRoutingService struct {
+	logger              *utils.Logger
+	twinRepo            repository.TwinRepository
+	notificationRepo    repository.NotificationRepository
+	deliveryService     *DeliveryService
+	notificationService *NotificationService
+}
+
+// NewAlertRoutingService creates a new alert routing service delivering through the delivery
+// service; alerts matching no route are pushed to websocket clients through the notification
+// service, if any
+func NewAlertRoutingService(db *db.Database, deliveryService *DeliveryService, notificationService *NotificationService, logger *utils.Logger) *AlertRoutingService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &AlertRoutingService{
+		logger:              logger.Named("alert_routing"),
+		twinRepo:            repoFactory.Twin(),
+		notificationRepo:    repoFactory.Notification(),
+		deliveryService:     deliveryService,
+		notificationService: notificationService,
+	}
+}
+
+// CreateRoute adds an alert route to a project after checking its twin, severities and
+// delivery target exist
+func (s *AlertRoutingService) CreateRoute(route *models.AlertRoute) error {
+	if route.ProjectID == 0 {
+		return errors.New("project ID is required")
+	}
+
+	if route.TwinID != nil {
+		twin, err := s.twinRepo.GetByID(*route.TwinID)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Error("Failed to get twin", zap.Uint("twin_id", *route.TwinID), zap.Error(err))
+			return errors.New("database error")
+		}
+		if err != nil || twin.ProjectID != route.ProjectID {
+			return errors.New("twin not found in project")
+		}
+	}
+
+	var severities []string
+	for _, severity := range strings.Split(route.Severities, ",") {
+		if severity = strings.TrimSpace(severity); severity == "" {
+			continue
+		}
+		if !alertSeverities[severity] {
+			return fmt.Errorf("unknown severity: %s", severity)
+		}
+		severities = append(severities, severity)
+	}
+	route.Severities = strings.Join(severities, ",")
+
+	recipients := route.RecipientList()
+	target := DeliveryTarget{Channel: route.Channel, Recipients: recipients}
+	if err := s.deliveryService.ValidateTarget(route.ProjectID, target); err != nil {
+		return err
+	}
+	route.Recipients = strings.Join(recipients, ",")
+
+	if err := s.notificationRepo.CreateAlertRoute(route); err != nil {
+		s.logger.Error("Failed to create alert route", zap.Uint("project_id", route.ProjectID), zap.Error(err))
+		return errors.New("failed to create alert route")
+	}
+	return nil
+}
+
+// ListRoutes lists the alert routes of a project and its twins in evaluation order
+func (s *AlertRoutingService) ListRoutes(projectID uint) ([]models.AlertRoute, error) {
+	routes, err := s.notificationRepo.ListAlertRoutes(projectID)
+	if err != nil {
+		s.logger.Error("Failed to list alert routes", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("failed to retrieve alert routes")
+	}
+	return routes, nil
+}
+
+// DeleteRoute removes an alert route of a project
+func (s *AlertRoutingService) DeleteRoute(projectID, id uint) error {
+	if err := s.notificationRepo.DeleteAlertRoute(projectID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("alert route not found")
+		}
+		s.logger.Error("Failed to delete alert route", zap.Uint("id", id), zap.Error(err))
+		return errors.New("failed to delete alert route")
+	}
+	return nil
+}
+
+// Route delivers a stored alert of a twin over the channel of its first matching route. An
+// alert matching no route reaches the project's websocket clients on the twin's topic, as
+// alerts did before routing, and is sent to the project's webhooks.
+func (s *AlertRoutingService) Route(twin *models.Twin, alert *models.AlertData) (*NotificationReceipt, error) {
+	if targets := s.targets(twin, alert); targets != nil {
+		return s.deliveryService.Deliver(twin.ProjectID, models.WebhookEventAlertCreated, alert, targets)
+	}
+
+	if s.notificationService != nil {
+		s.notificationService.NotifyProject(twin.ProjectID, NotificationTypeAlert, "twins/"+twin.DittoID, alert)
+	}
+	return s.deliveryService.Deliver(twin.ProjectID, models.WebhookEventAlertCreated, alert,
+		[]DeliveryTarget{{Channel: DeliveryChannelWebhook}})
+}
+
+// RouteStored delivers a stored alert of the twin with the given Ditto ID, logging failures
+func (s *AlertRoutingService) RouteStored(alert *models.AlertData) {
+	twin, err := s.twinRepo.GetByDittoID(alert.TwinID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Error("Failed to get twin of alert", zap.String("twin_id", alert.TwinID), zap.Error(err))
+		}
+		return
+	}
+	if _, err := s.Route(twin, alert); err != nil {
+		s.logger.Error("Failed to deliver alert", zap.String("alert_id", alert.AlertID), zap.Error(err))
+	}
+}
+
+// PublishLifecycle delivers an alert lifecycle event over the route the alert itself was
+// delivered on, or over every channel when none matches. Like alerts, the event is stored
+// before delivery and failed deliveries are retried.
+func (s *AlertRoutingService) PublishLifecycle(eventType string, alert *models.AlertData, event *AlertLifecycleEvent) (*NotificationReceipt, error) {
+	twin, err := s.twinRepo.GetByDittoID(alert.TwinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin of alert not found")
+		}
+		return nil, fmt.Errorf("failed to get twin of alert: %w", err)
+	}
+
+	return s.deliveryService.Deliver(twin.ProjectID, eventType, event, s.targets(twin, alert))
+}
+
+// targets returns the delivery target of the first route matching an alert of the twin, or
+// none if no route matches
+func (s *AlertRoutingService) targets(twin *models.Twin, alert *models.AlertData) []DeliveryTarget {
+	routes, err := s.notificationRepo.ListAlertRoutes(twin.ProjectID)
+	if err != nil {
+		s.logger.Error("Failed to list alert routes, delivering the alert as unrouted",
+			zap.Uint("project_id", twin.ProjectID),
+			zap.String("alert_id", alert.AlertID),
+			zap.Error(err))
+		return nil
+	}
+
+	if route := matchAlertRoute(routes, twin.ID, alert); route != nil {
+		return []DeliveryTarget{{Channel: route.Channel, Recipients: route.RecipientList()}}
+	}
+	return nil
+}
+
+// matchAlertRoute returns the first route of the twin matching the alert, or else the first
+// matching route of its project
+func matchAlertRoute(routes []models.AlertRoute, twinID uint, alert *models.AlertData) *models.AlertRoute {
+	var projectRoute *models.AlertRoute
+	for i := range routes {
+		route := &routes[i]
+		if !route.Matches(alert.Severity, alert.FeaturePath) {
+			continue
+		}
+		if route.TwinID == nil {
+			if projectRoute == nil {
+				projectRoute = route
+			}
+			continue
+		}
+		if *route.TwinID == twinID {
+			return route
+		}
+	}
+	return projectRoute
+}
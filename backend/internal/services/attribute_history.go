@@ -0,0 +1,137 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"go.uber.org/zap"
+)
+
+// Attribute history page sizes
+const (
+	defaultAttributeHistoryLimit = 100
+	maxAttributeHistoryLimit     = 1000
+)
+
+// dittoEventPayload returns the payload forwarded to Kafka for a Ditto event. Attribute
+// events only carry the value at their path, so it is nested under that path to read like
+// a partial thing ({"attributes": {"location": {"lat": 1}}}).
+func dittoEventPayload(event *ditto.DittoEvent) interface{} {
+	path := strings.Trim(event.Path, "/")
+	if path != "attributes" && !strings.HasPrefix(path, "attributes/") {
+		return event.Value
+	}
+
+	keys := strings.Split(path, "/")
+	payload := event.Value
+	for i := len(keys) - 1; i >= 0; i-- {
+		payload = map[string]interface{}{keys[i]: payload}
+	}
+	return payload
+}
+
+// flattenAttributes collects the leaf values of nested attributes by their slash-separated
+// path. Arrays and empty objects are leaves.
+func flattenAttributes(prefix string, attributes map[string]interface{}, leaves map[string]interface{}) {
+	for key, value := range attributes {
+		path := key
+		if prefix != "" {
+			path = prefix + "/" + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenAttributes(path, nested, leaves)
+			continue
+		}
+		leaves[path] = value
+	}
+}
+
+// recordAttributeChanges stores the attributes of a Ditto event whose value differs from the
+// last recorded one, along with that previous value
+func (h *KafkaHandler) recordAttributeChanges(twin *models.Twin, attributes map[string]interface{}, at time.Time) error {
+	leaves := make(map[string]interface{})
+	flattenAttributes("", attributes, leaves)
+	if len(leaves) == 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(leaves))
+	for path := range leaves {
+		paths = append(paths, path)
+	}
+	previous, err := h.attributeRepo.LatestValues(twin.ID, paths)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]models.AttributeChange, 0, len(leaves))
+	for _, path := range paths {
+		value, err := json.Marshal(leaves[path])
+		if err != nil {
+			return err
+		}
+		old, seen := previous[path]
+		if seen && jsonEqual(old, value) {
+			continue
+		}
+		changes = append(changes, models.AttributeChange{
+			TwinID:   twin.ID,
+			Path:     path,
+			OldValue: old,
+			NewValue: models.JSON(value),
+			Time:     at,
+		})
+	}
+
+	if err := h.attributeRepo.InsertChanges(changes); err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		h.logger.Debug("Recorded attribute changes", zap.String("thingId", twin.DittoID), zap.Int("changes", len(changes)))
+	}
+	return nil
+}
+
+// jsonEqual reports whether two JSON documents hold the same value, regardless of formatting.
+// PostgreSQL normalizes the whitespace of stored jsonb values.
+func jsonEqual(a, b []byte) bool {
+	var left, right interface{}
+	if json.Unmarshal(a, &left) != nil || json.Unmarshal(b, &right) != nil {
+		return false
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// GetAttributeHistory returns the twin's attribute changes within a time range, newest first.
+// A path such as "location" also matches the attributes nested below it.
+func (s *HistoryService) GetAttributeHistory(twinID uint, path string, start, end time.Time, limit int) ([]models.AttributeChange, error) {
+	if limit <= 0 {
+		limit = defaultAttributeHistoryLimit
+	}
+	if limit > maxAttributeHistoryLimit {
+		limit = maxAttributeHistoryLimit
+	}
+	// Accept Ditto's JSON pointer form ("/attributes/location") as well
+	path = strings.TrimPrefix(strings.Trim(path, "/"), "attributes/")
+
+	if _, err := s.twinRepo.GetByID(twinID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	changes, err := s.attributeRepo.List(twinID, path, start, end, limit)
+	if err != nil {
+		s.logger.Error("Failed to list attribute history", zap.Uint("twin_id", twinID), zap.String("path", path), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	return changes, nil
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// auditAppendAttempts bounds the retries when another instance appends to the chain at the same time
+	auditAppendAttempts = 3
+	// auditArchiveBatchSize is the number of expired entries written to one retention archive
+	auditArchiveBatchSize = 5000
+)
+
+// ErrAuditTampered is returned when an audit archive or chain does not verify
+var ErrAuditTampered = errors.New("audit log has been tampered with")
+
+// AuditArchive is a signed export of the audit entries recorded in [From, To).
+// The entries carry their hash chain; the signature covers the range and the chain's first and last hash.
+type AuditArchive struct {
+	From        time.Time           `json:"from"`
+	To          time.Time           `json:"to"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	Entries     []models.AuditEntry `json:"entries"`
+	Signature   string              `json:"signature"`
+}
+
+// AuditArchiver stores retention archives outside the database
+type AuditArchiver interface {
+	Store(ctx context.Context, name string, data []byte) error
+}
+
+// DirectoryArchiver stores archives as files in a directory
+type DirectoryArchiver struct {
+	dir string
+}
+
+// NewDirectoryArchiver creates an archiver writing to dir
+func NewDirectoryArchiver(dir string) *DirectoryArchiver {
+	return &DirectoryArchiver{dir: dir}
+}
+
+// Store writes an archive file, replacing it atomically if it exists
+func (a *DirectoryArchiver) Store(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(a.dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	tmp := filepath.Join(a.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return os.Rename(tmp, filepath.Join(a.dir, name))
+}
+
+// AuditService records the audit log, exports it and enforces its retention
+type AuditService struct {
+	logger    *utils.Logger
+	config    config.AuditConfig
+	auditRepo repository.AuditRepository
+	archiver  AuditArchiver
+
+	mu sync.Mutex
+
+	// The retention job, disabled when entries are kept forever
+	*lifecycle.ScheduledWorker
+}
+
+// NewAuditService creates a new audit service; archiver may be nil to delete expired entries without archiving
+func NewAuditService(db *db.Database, cfg *config.AuditConfig, archiver AuditArchiver, logger *utils.Logger) *AuditService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	s := &AuditService{
+		logger:    logger.Named("audit_service"),
+		config:    *cfg,
+		auditRepo: repoFactory.Audit(),
+		archiver:  archiver,
+	}
+
+	interval := time.Duration(cfg.RetentionInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if cfg.RetentionDays <= 0 {
+		interval = 0
+	}
+	s.ScheduledWorker = lifecycle.NewScheduledWorker("audit-retention", interval, func(ctx context.Context) error {
+		err := s.ApplyRetention(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("Audit retention failed", zap.Error(err))
+		}
+		return err
+	})
+	s.RunOnStart = true
+	return s
+}
+
+// Enabled returns whether requests should be recorded
+func (s *AuditService) Enabled() bool {
+	return s.config.Enabled
+}
+
+// Record appends an entry to the audit log
+func (s *AuditService) Record(entry *models.AuditEntry) error {
+	// Postgres keeps microseconds; hashing more precision would break the chain on read
+	entry.Time = entry.Time.UTC().Truncate(time.Microsecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		entry.ID = 0
+		if err = s.auditRepo.Append(entry); err == nil {
+			return nil
+		}
+	}
+	s.logger.Error("Failed to record audit entry", zap.String("path", entry.Path), zap.Error(err))
+	return errors.New("failed to record audit entry")
+}
+
+// Export returns a signed archive of the entries recorded in [from, to)
+func (s *AuditService) Export(from, to time.Time) (*AuditArchive, error) {
+	if !to.After(from) {
+		return nil, errors.New("end time must be after start time")
+	}
+
+	entries, err := s.auditRepo.ListRange(from, to)
+	if err != nil {
+		s.logger.Error("Failed to list audit entries", zap.Time("from", from), zap.Time("to", to), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	return s.newArchive(from, to, entries), nil
+}
+
+// VerifyArchive checks an archive's signature and the hash chain of its entries
+func (s *AuditService) VerifyArchive(archive *AuditArchive) error {
+	if !hmac.Equal([]byte(archive.Signature), []byte(s.sign(archive))) {
+		return fmt.Errorf("%w: invalid archive signature", ErrAuditTampered)
+	}
+	return VerifyAuditChain(archive.Entries)
+}
+
+// VerifyAuditChain checks that each entry's hash matches its fields and that each entry
+// follows the one before it. The first entry's PrevHash is trusted as the chain's anchor.
+func VerifyAuditChain(entries []models.AuditEntry) error {
+	for i := range entries {
+		if i > 0 && entries[i].PrevHash != entries[i-1].Hash {
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditTampered, entries[i].ID, entries[i-1].ID)
+		}
+		if entries[i].Hash != entries[i].ComputeHash() {
+			return fmt.Errorf("%w: entry %d has been modified", ErrAuditTampered, entries[i].ID)
+		}
+	}
+	return nil
+}
+
+// newArchive builds and signs an archive
+func (s *AuditService) newArchive(from, to time.Time, entries []models.AuditEntry) *AuditArchive {
+	if entries == nil {
+		entries = []models.AuditEntry{}
+	}
+	archive := &AuditArchive{
+		From:        from.UTC(),
+		To:          to.UTC(),
+		GeneratedAt: time.Now().UTC(),
+		Entries:     entries,
+	}
+	archive.Signature = s.sign(archive)
+	return archive
+}
+
+// sign computes the HMAC-SHA256 signature of an archive over its range, entry count and
+// the first and last hash of its chain, which in turn cover every entry
+func (s *AuditService) sign(archive *AuditArchive) string {
+	var anchor, head string
+	if len(archive.Entries) > 0 {
+		anchor = archive.Entries[0].PrevHash
+		head = archive.Entries[len(archive.Entries)-1].Hash
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.config.SigningKey))
+	for _, field := range []string{
+		archive.From.UTC().Format(time.RFC3339Nano),
+		archive.To.UTC().Format(time.RFC3339Nano),
+		archive.GeneratedAt.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(len(archive.Entries)),
+		anchor,
+		head,
+	} {
+		mac.Write([]byte(field))
+		mac.Write([]byte("\n"))
+	}
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ApplyRetention archives and deletes the entries older than the retention period.
+// Entries are only deleted once their archive has been stored.
+func (s *AuditService) ApplyRetention(ctx context.Context) error {
+	if s.config.RetentionDays <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+
+	for ctx.Err() == nil {
+		entries, err := s.auditRepo.ListBefore(cutoff, auditArchiveBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to list expired audit entries: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		first, last := entries[0], entries[len(entries)-1]
+		if s.archiver != nil {
+			archive := s.newArchive(first.Time, last.Time.Add(time.Microsecond), entries)
+			data, err := json.Marshal(archive)
+			if err != nil {
+				return fmt.Errorf("failed to encode audit archive: %w", err)
+			}
+
+			name := fmt.Sprintf("audit-%s-%d.json", first.Time.UTC().Format("20060102T150405Z"), first.ID)
+			if err := s.archiver.Store(ctx, name, data); err != nil {
+				return fmt.Errorf("failed to store audit archive %s: %w", name, err)
+			}
+		}
+
+		if err := s.auditRepo.DeleteThrough(last.ID); err != nil {
+			return fmt.Errorf("failed to delete expired audit entries: %w", err)
+		}
+		s.logger.Info("Removed expired audit entries",
+			zap.Int("entries", len(entries)),
+			zap.Uint("through_id", last.ID),
+			zap.Bool("archived", s.archiver != nil))
+
+		if len(entries) < auditArchiveBatchSize {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// normalizeCalibrations orders a binding's calibration periods by effective time and checks
+// that they can be applied to its values
+func normalizeCalibrations(binding *models.FeatureBinding) error {
+	if binding.CalibrationMode == "" {
+		binding.CalibrationMode = models.CalibrationQuery
+	}
+	if binding.CalibrationMode != models.CalibrationQuery && binding.CalibrationMode != models.CalibrationIngest {
+		return errors.New("invalid calibration mode")
+	}
+	if len(binding.Calibrations) == 0 {
+		return nil
+	}
+
+	if binding.ExpectedType != "" && binding.ExpectedType != "number" {
+		return errors.New("calibration requires a number feature")
+	}
+	if binding.CalibrationMode == models.CalibrationIngest {
+		// Ingest calibration keeps the received value in value_json, which both use as well
+		if binding.KeepRawValue {
+			return errors.New("ingest calibration is not supported with keep_raw_value")
+		}
+		if binding.RollupWindow > 0 {
+			return errors.New("ingest calibration is not supported for rolled-up features")
+		}
+	}
+
+	sort.SliceStable(binding.Calibrations, func(i, j int) bool {
+		return binding.Calibrations[i].EffectiveFrom.Before(binding.Calibrations[j].EffectiveFrom)
+	})
+	for i, calibration := range binding.Calibrations {
+		if calibration.EffectiveFrom.IsZero() {
+			return errors.New("calibration effective_from is required")
+		}
+		if calibration.Multiplier == 0 {
+			return errors.New("calibration multiplier must not be 0")
+		}
+		if i > 0 && calibration.EffectiveFrom.Equal(binding.Calibrations[i-1].EffectiveFrom) {
+			return fmt.Errorf("two calibrations take effect at %s", calibration.EffectiveFrom.Format("2006-01-02T15:04:05Z07:00"))
+		}
+	}
+	return nil
+}
+
+// ApplyCalibration corrects a numeric point with the binding's calibration in effect at its
+// time, if the binding calibrates at ingest. The received value is kept in value_json.
+func ApplyCalibration(point *models.TimeseriesData, binding *models.FeatureBinding) {
+	if binding == nil || binding.CalibrationMode != models.CalibrationIngest || point.ValueType != "number" {
+		return
+	}
+	calibration, ok := binding.Calibrations.At(point.Time)
+	if !ok {
+		return
+	}
+
+	point.ValueJSON = strconv.FormatFloat(point.ValueNum, 'g', -1, 64)
+	point.ValueNum = roundSignificant(calibration.Apply(point.ValueNum))
+}
+
+// queryCalibrations returns the calibrations applied when a feature's values are read; none
+// if the feature has no binding or calibrates at ingest
+func (s *HistoryService) queryCalibrations(twinID uint, featurePath string) (models.Calibrations, error) {
+	binding, err := s.twinRepo.GetFeatureBinding(twinID, featurePath)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		s.logger.Error("Failed to get feature binding",
+			zap.Uint("twin_id", twinID),
+			zap.String("feature_path", featurePath),
+			zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	if binding.CalibrationMode == models.CalibrationIngest {
+		return nil, nil
+	}
+	return binding.Calibrations, nil
+}
+
+// calibratePoint corrects a numeric point with the calibration in effect at its time. Raw
+// values and rollup summaries kept in value_json are corrected as well.
+func calibratePoint(point *models.TimeseriesData, calibrations models.Calibrations) {
+	if point.ValueType != "number" {
+		return
+	}
+	calibration, ok := calibrations.At(point.Time)
+	if !ok {
+		return
+	}
+
+	point.ValueNum = roundSignificant(calibration.Apply(point.ValueNum))
+	if point.ValueJSON == "" {
+		return
+	}
+	if raw, err := strconv.ParseFloat(point.ValueJSON, 64); err == nil {
+		point.ValueJSON = strconv.FormatFloat(roundSignificant(calibration.Apply(raw)), 'g', -1, 64)
+		return
+	}
+	var summary RollupSummary
+	if err := json.Unmarshal([]byte(point.ValueJSON), &summary); err != nil || summary.Count == 0 {
+		return
+	}
+	summary.Min = roundSignificant(calibration.Apply(summary.Min))
+	summary.Max = roundSignificant(calibration.Apply(summary.Max))
+	summary.Avg = roundSignificant(calibration.Apply(summary.Avg))
+	if summary.Min > summary.Max {
+		summary.Min, summary.Max = summary.Max, summary.Min
+	}
+	if summary.Last != nil {
+		last := roundSignificant(calibration.Apply(*summary.Last))
+		summary.Last = &last
+	}
+	if data, err := json.Marshal(summary); err == nil {
+		point.ValueJSON = string(data)
+	}
+}
+
+// calibrateTimeseries returns corrected copies of the points
+func calibrateTimeseries(data []models.TimeseriesData, calibrations models.Calibrations) []models.TimeseriesData {
+	if len(calibrations) == 0 {
+		return data
+	}
+	calibrated := make([]models.TimeseriesData, len(data))
+	for i, point := range data {
+		calibratePoint(&point, calibrations)
+		calibrated[i] = point
+	}
+	return calibrated
+}
+
+// calibrateAggregated returns corrected copies of aggregated buckets. A bucket is corrected with
+// the calibration in effect at its first point, so a bucket spanning a calibration boundary is
+// only approximately corrected.
+func calibrateAggregated(data []models.AggregatedData, calibrations models.Calibrations) []models.AggregatedData {
+	if len(calibrations) == 0 {
+		return data
+	}
+	calibrated := make([]models.AggregatedData, len(data))
+	for i, bucket := range data {
+		at := bucket.FirstTime
+		if at.IsZero() {
+			at = bucket.TimeInterval
+		}
+		if calibration, ok := calibrations.At(at); ok {
+			bucket.Min = roundSignificant(calibration.Apply(bucket.Min))
+			bucket.Max = roundSignificant(calibration.Apply(bucket.Max))
+			bucket.Avg = roundSignificant(calibration.Apply(bucket.Avg))
+			bucket.Sum = roundSignificant(bucket.Sum*calibration.Multiplier + calibration.Offset*float64(bucket.Count))
+			// A negative multiplier turns the smallest value into the largest
+			if bucket.Min > bucket.Max {
+				bucket.Min, bucket.Max = bucket.Max, bucket.Min
+			}
+		}
+		calibrated[i] = bucket
+	}
+	return calibrated
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// MaxDashboardLayoutSize caps the size of a saved dashboard layout, in bytes
+const MaxDashboardLayoutSize = 256 << 10
+
+// maxDashboardNameLength caps the length of a dashboard name
+const maxDashboardNameLength = 100
+
+// ErrDashboardTooLarge is returned for layouts larger than MaxDashboardLayoutSize
+var ErrDashboardTooLarge = fmt.Errorf("dashboard layout exceeds %d bytes", MaxDashboardLayoutSize)
+
+// DashboardService stores the dashboard layouts of projects. Each project has named
+// layouts shared by its members, and members may keep personal layouts of their own.
+type DashboardService struct {
+	logger        *utils.Logger
+	dashboardRepo repository.DashboardRepository
+}
+
+// NewDashboardService creates a new dashboard service
+func NewDashboardService(db *db.Database, logger *utils.Logger) *DashboardService {
+	return &DashboardService{
+		logger:        logger.Named("dashboard_service"),
+		dashboardRepo: repository.NewRepositoryFactory(db.DB).Dashboard(),
+	}
+}
+
+// List returns the shared dashboards of a project and the user's personal ones, without their layouts
+func (s *DashboardService) List(projectID, userID uint) ([]models.DashboardLayout, error) {
+	layouts, err := s.dashboardRepo.ListVisible(projectID, userID)
+	if err != nil {
+		s.logger.Error("Failed to list dashboards", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	return layouts, nil
+}
+
+// Get returns a dashboard of a project by name. The user's personal dashboard of that
+// name takes precedence over the shared one.
+func (s *DashboardService) Get(projectID, userID uint, name string) (*models.DashboardLayout, error) {
+	for _, scope := range []uint{userID, 0} {
+		layout, err := s.dashboardRepo.Get(projectID, scope, name)
+		if err == nil {
+			return layout, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Error("Failed to get dashboard", zap.Uint("project_id", projectID), zap.String("name", name), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+	}
+	return nil, errors.New("dashboard not found")
+}
+
+// Save creates or replaces a dashboard. The layout must be valid JSON within the size limit.
+func (s *DashboardService) Save(layout *models.DashboardLayout) error {
+	layout.Name = strings.TrimSpace(layout.Name)
+	if layout.Name == "" {
+		return errors.New("dashboard name is required")
+	}
+	if len(layout.Name) > maxDashboardNameLength {
+		return fmt.Errorf("dashboard name may be at most %d characters", maxDashboardNameLength)
+	}
+	if len(layout.Layout) > MaxDashboardLayoutSize {
+		return ErrDashboardTooLarge
+	}
+	if len(layout.Layout) == 0 || !json.Valid(layout.Layout) {
+		return errors.New("dashboard layout must be valid JSON")
+	}
+
+	if err := s.dashboardRepo.Save(layout); err != nil {
+		s.logger.Error("Failed to save dashboard", zap.Uint("project_id", layout.ProjectID), zap.String("name", layout.Name), zap.Error(err))
+		return errors.New("database error")
+	}
+	return nil
+}
+
+// Delete removes a dashboard of a project; user ID 0 removes the shared one
+func (s *DashboardService) Delete(projectID, userID uint, name string) error {
+	if err := s.dashboardRepo.Delete(projectID, userID, name); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("dashboard not found")
+		}
+		s.logger.Error("Failed to delete dashboard", zap.Uint("project_id", projectID), zap.String("name", name), zap.Error(err))
+		return errors.New("database error")
+	}
+	return nil
+}
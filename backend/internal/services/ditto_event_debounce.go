@@ -0,0 +1,134 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// dittoEventDebouncer coalesces the burst of events Ditto emits per thing, e.g. created followed
+// by several modified events during bulk provisioning, into one event carrying the latest state.
+// A burst lasts for the window after its first event; later events start a new burst. Deletions
+// are never coalesced, so a thing deleted and recreated is still applied in order.
+type dittoEventDebouncer struct {
+	window  time.Duration
+	pending map[string]*pendingDittoEvent
+}
+
+// pendingDittoEvent is the coalesced event of a thing's burst and when it is applied
+type pendingDittoEvent struct {
+	event *DittoEventData
+	due   time.Time
+}
+
+// newDittoEventDebouncer creates a debouncer coalescing bursts within the window
+func newDittoEventDebouncer(window time.Duration) *dittoEventDebouncer {
+	return &dittoEventDebouncer{
+		window:  window,
+		pending: make(map[string]*pendingDittoEvent),
+	}
+}
+
+// add coalesces an event into its thing's burst, returning the events to apply right away
+func (d *dittoEventDebouncer) add(event *DittoEventData, now time.Time) []*DittoEventData {
+	pending, ok := d.pending[event.ThingID]
+
+	// A deletion ends the burst before it and is applied on its own
+	if event.Action == "deleted" {
+		delete(d.pending, event.ThingID)
+		if ok {
+			return []*DittoEventData{pending.event, event}
+		}
+		return []*DittoEventData{event}
+	}
+
+	if !ok {
+		d.pending[event.ThingID] = &pendingDittoEvent{event: event, due: now.Add(d.window)}
+		return nil
+	}
+
+	pending.event = coalesceDittoEvents(pending.event, event)
+	return nil
+}
+
+// flushDue returns the coalesced events whose window has passed, in the order they are due
+func (d *dittoEventDebouncer) flushDue(now time.Time) []*DittoEventData {
+	var due []*pendingDittoEvent
+	for thingID, pending := range d.pending {
+		if !pending.due.After(now) {
+			due = append(due, pending)
+			delete(d.pending, thingID)
+		}
+	}
+	return sortPendingDittoEvents(due)
+}
+
+// flushAll returns every coalesced event, in the order they are due
+func (d *dittoEventDebouncer) flushAll() []*DittoEventData {
+	all := make([]*pendingDittoEvent, 0, len(d.pending))
+	for thingID, pending := range d.pending {
+		all = append(all, pending)
+		delete(d.pending, thingID)
+	}
+	return sortPendingDittoEvents(all)
+}
+
+// next returns when the earliest burst is due, false if none is pending
+func (d *dittoEventDebouncer) next() (time.Time, bool) {
+	var next time.Time
+	for _, pending := range d.pending {
+		if next.IsZero() || pending.due.Before(next) {
+			next = pending.due
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// sortPendingDittoEvents orders coalesced events by when they are due
+func sortPendingDittoEvents(pending []*pendingDittoEvent) []*DittoEventData {
+	sort.Slice(pending, func(i, j int) bool { return pending[i].due.Before(pending[j].due) })
+	events := make([]*DittoEventData, len(pending))
+	for i, p := range pending {
+		events[i] = p.event
+	}
+	return events
+}
+
+// coalesceDittoEvents merges a later event of a thing into an earlier one. The payloads are
+// merged so that partial updates, like a single changed attribute, add to the state rather
+// than replace it. A burst that created the thing stays a creation.
+func coalesceDittoEvents(earlier, later *DittoEventData) *DittoEventData {
+	action := later.Action
+	if earlier.Action == "created" {
+		action = "created"
+	}
+
+	payload := later.Payload
+	var base, update map[string]interface{}
+	if json.Unmarshal(earlier.Payload, &base) == nil && json.Unmarshal(later.Payload, &update) == nil && base != nil {
+		if merged, err := json.Marshal(mergeJSONObjects(base, update)); err == nil {
+			payload = merged
+		}
+	}
+
+	return &DittoEventData{
+		ThingID:   later.ThingID,
+		Action:    action,
+		Timestamp: later.Timestamp,
+		Payload:   payload,
+	}
+}
+
+// mergeJSONObjects merges update into base, recursing into objects present in both
+func mergeJSONObjects(base, update map[string]interface{}) map[string]interface{} {
+	for key, value := range update {
+		nested, isObject := value.(map[string]interface{})
+		existing, hasObject := base[key].(map[string]interface{})
+		if isObject && hasObject {
+			base[key] = mergeJSONObjects(existing, nested)
+			continue
+		}
+		base[key] = value
+	}
+	return base
+}
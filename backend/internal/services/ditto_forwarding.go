@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+)
+
+// DittoForwardStats counts the Ditto WebSocket events forwarded to Kafka or dropped by the
+// forwarding filter since startup
+type DittoForwardStats struct {
+	Forwarded int64 `json:"forwarded"`
+	// Denied is the number of events dropped because their namespace is in drop_namespaces
+	Denied int64 `json:"denied"`
+	// Unlisted is the number of events dropped because their namespace is not in forward_namespaces
+	Unlisted int64 `json:"unlisted"`
+	// Unmanaged is the number of events dropped because their thing is not registered as a twin
+	Unmanaged int64 `json:"unmanaged"`
+}
+
+// DittoForwardFilter decides which Ditto WebSocket events are forwarded to Kafka by the
+// namespace of their thing and, optionally, whether the thing is registered as a twin
+type DittoForwardFilter struct {
+	allow           []string
+	deny            []string
+	knownTwinsOnly  bool
+	namespacePrefix string
+	twinRepo        repository.TwinRepository
+
+	forwarded atomic.Int64
+	denied    atomic.Int64
+	unlisted  atomic.Int64
+	unmanaged atomic.Int64
+}
+
+// NewDittoForwardFilter creates the forwarding filter configured for Ditto
+func NewDittoForwardFilter(cfg *config.DittoConfig, twinRepo repository.TwinRepository) (*DittoForwardFilter, error) {
+	filter := &DittoForwardFilter{
+		knownTwinsOnly:  cfg.ForwardKnownTwinsOnly,
+		namespacePrefix: cfg.NamespacePrefix,
+		twinRepo:        twinRepo,
+	}
+	var err error
+	if filter.allow, err = parseNamespacePatterns(cfg.ForwardNamespaces); err != nil {
+		return nil, fmt.Errorf("invalid forward_namespaces: %w", err)
+	}
+	if filter.deny, err = parseNamespacePatterns(cfg.DropNamespaces); err != nil {
+		return nil, fmt.Errorf("invalid drop_namespaces: %w", err)
+	}
+	return filter, nil
+}
+
+// parseNamespacePatterns lower-cases namespace patterns, as thing IDs are normalized, and
+// checks their syntax
+func parseNamespacePatterns(patterns []string) ([]string, error) {
+	parsed := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: %w", pattern, err)
+		}
+		parsed = append(parsed, pattern)
+	}
+	return parsed, nil
+}
+
+// matchesNamespace reports whether a namespace matches one of the patterns
+func matchesNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow reports whether an event is forwarded, counting it either way
+func (f *DittoForwardFilter) Allow(event *ditto.DittoEvent) bool {
+	thingID := ditto.NormalizeThingID(event.ThingID)
+	namespace := ditto.NamespaceOf(thingID)
+
+	switch {
+	case matchesNamespace(f.deny, namespace):
+		f.denied.Add(1)
+		return false
+	case len(f.allow) > 0 && !matchesNamespace(f.allow, namespace):
+		f.unlisted.Add(1)
+		return false
+	case f.knownTwinsOnly && !f.isManaged(thingID, event):
+		f.unmanaged.Add(1)
+		return false
+	}
+
+	f.forwarded.Add(1)
+	return true
+}
+
+// isManaged reports whether the thing is registered as a twin, or is being created in a
+// project namespace and will be registered from the event. Lookup failures forward the event.
+func (f *DittoForwardFilter) isManaged(thingID string, event *ditto.DittoEvent) bool {
+	if event.Action == "created" && strings.Trim(event.Path, "/") == "" {
+		if _, ok := ditto.ProjectIDFromNamespace(f.namespacePrefix, ditto.NamespaceOf(thingID)); ok {
+			return true
+		}
+	}
+
+	_, err := f.twinRepo.GetByDittoID(thingID)
+	return err == nil || !errors.Is(err, repository.ErrNotFound)
+}
+
+// Stats returns the counts of forwarded and dropped events
+func (f *DittoForwardFilter) Stats() DittoForwardStats {
+	return DittoForwardStats{
+		Forwarded: f.forwarded.Load(),
+		Denied:    f.denied.Load(),
+		Unlisted:  f.unlisted.Load(),
+		Unmanaged: f.unmanaged.Load(),
+	}
+}
+
+// SetDittoForwardFilter replaces the filter deciding which Ditto WebSocket events are
+// forwarded to Kafka; by default every event is forwarded
+func (h *KafkaHandler) SetDittoForwardFilter(filter *DittoForwardFilter) {
+	h.forwardFilter = filter
+}
+
+// DittoForwardStats returns the counts of Ditto WebSocket events forwarded and dropped
+func (h *KafkaHandler) DittoForwardStats() DittoForwardStats {
+	return h.forwardFilter.Stats()
+}
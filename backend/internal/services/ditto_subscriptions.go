@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// DittoSubscriptions keeps the Ditto event subscription covering the namespaces of all projects.
+// It is refreshed when a project is created or deleted.
+type DittoSubscriptions struct {
+	dittoManager *ditto.Manager
+	projectRepo  repository.ProjectRepository
+	logger       *utils.Logger
+	// mu orders refreshes, so the last subscription sent reflects the latest projects
+	mu sync.Mutex
+}
+
+// NewDittoSubscriptions creates a new Ditto subscription service
+func NewDittoSubscriptions(db *db.Database, dittoManager *ditto.Manager, logger *utils.Logger) *DittoSubscriptions {
+	return &DittoSubscriptions{
+		dittoManager: dittoManager,
+		projectRepo:  repository.NewRepositoryFactory(db.DB).Project(),
+		logger:       logger.Named("ditto_subscriptions"),
+	}
+}
+
+// Refresh subscribes to events in the namespaces of the current projects, replacing the
+// previous subscription; without projects no events are subscribed to
+func (s *DittoSubscriptions) Refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	projects, _, err := s.projectRepo.List(0, -1)
+	if err != nil {
+		return fmt.Errorf("failed to list projects for Ditto subscription: %w", err)
+	}
+	projectIDs := make([]uint, 0, len(projects))
+	for _, project := range projects {
+		projectIDs = append(projectIDs, project.ID)
+	}
+	if err := s.dittoManager.SubscribeToProjects("", projectIDs); err != nil {
+		return fmt.Errorf("failed to subscribe to Ditto events: %w", err)
+	}
+
+	s.logger.Info("Subscribed to Ditto events", zap.Int("projects", len(projectIDs)))
+	return nil
+}
+
+// RefreshAfterProjectChange refreshes the subscription, logging instead of failing: the
+// project change is already stored, and while Ditto is disconnected the refreshed subscription
+// is sent once it reconnects
+func (s *DittoSubscriptions) RefreshAfterProjectChange() {
+	if err := s.Refresh(); err != nil {
+		s.logger.Error("Failed to refresh Ditto subscription after project change", zap.Error(err))
+	}
+}
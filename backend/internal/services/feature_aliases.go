@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// Feature alias limits
+const (
+	maxFeatureAliases     = 200
+	maxFeatureAliasLength = 64
+)
+
+// featureAliasPattern is the form of a feature alias; it has no "/" so it never reads as a path
+var featureAliasPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// normalizeFeatureAliases checks that a twin type's feature aliases are unique, map to features
+// its schema declares and do not shadow any of them, and orders them by alias
+func normalizeFeatureAliases(schema models.JSON, aliases models.FeatureAliasList) (models.FeatureAliasList, error) {
+	if len(aliases) > maxFeatureAliases {
+		return nil, fmt.Errorf("invalid feature alias: at most %d aliases are allowed", maxFeatureAliases)
+	}
+	if len(aliases) == 0 {
+		return models.FeatureAliasList{}, nil
+	}
+
+	features := schemaFeatures(schema)
+	seenAliases := make(map[string]bool, len(aliases))
+	seenPaths := make(map[string]string, len(aliases))
+	normalized := make(models.FeatureAliasList, 0, len(aliases))
+	for _, alias := range aliases {
+		alias.Alias = strings.TrimSpace(alias.Alias)
+		alias.FeaturePath = strings.TrimSpace(alias.FeaturePath)
+
+		name, path := alias.Alias, alias.FeaturePath
+		if len(name) > maxFeatureAliasLength {
+			return nil, fmt.Errorf("invalid feature alias: %q exceeds %d characters", name, maxFeatureAliasLength)
+		}
+		if !featureAliasPattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid feature alias: %q must start with a letter and contain only letters, digits, '_', '.' and '-'", name)
+		}
+		if seenAliases[name] {
+			return nil, fmt.Errorf("invalid feature alias: %q is defined twice", name)
+		}
+		if schemaHasFeature(features, name) {
+			return nil, fmt.Errorf("invalid feature alias: %q is already a feature of the schema", name)
+		}
+		if problem := featurePathProblem(path); problem != "" {
+			return nil, fmt.Errorf("invalid feature alias: %s", problem)
+		}
+		if !schemaHasFeature(features, path) {
+			return nil, fmt.Errorf("invalid feature alias: %q is not a feature of the schema", path)
+		}
+		if other, ok := seenPaths[path]; ok {
+			return nil, fmt.Errorf("invalid feature alias: %q already has the alias %q", path, other)
+		}
+
+		seenAliases[name] = true
+		seenPaths[path] = name
+		normalized = append(normalized, alias)
+	}
+
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].Alias < normalized[j].Alias })
+	return normalized, nil
+}
+
+// ResolveFeaturePath returns the full feature path a name given to the history API stands
+// for: the path of the alias of that name on the twin's type, or the name itself
+func (s *HistoryService) ResolveFeaturePath(twinID uint, name string) (string, error) {
+	twin, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", errors.New("twin not found")
+		}
+		s.logger.Error("Failed to get twin", zap.Uint("twin_id", twinID), zap.Error(err))
+		return "", errors.New("database error")
+	}
+	return twin.Type.FeatureAliases.Resolve(name), nil
+}
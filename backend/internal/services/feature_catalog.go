@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// featureCatalogRebuildBatch is how many twins are listed at a time when rebuilding the
+// catalog of all twins; each twin is rebuilt in its own transaction
+const featureCatalogRebuildBatch = 100
+
+// FeatureCatalogRebuild reports a feature catalog rebuild
+type FeatureCatalogRebuild struct {
+	Twins    int `json:"twins"`
+	Features int `json:"features"`
+}
+
+// FeatureCatalogService maintains the feature catalog recorded on ingest
+type FeatureCatalogService struct {
+	logger         *utils.Logger
+	timeseriesRepo repository.TimeseriesRepository
+	twinRepo       repository.TwinRepository
+}
+
+// NewFeatureCatalogService creates a new feature catalog service
+func NewFeatureCatalogService(db *db.Database, logger *utils.Logger) *FeatureCatalogService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &FeatureCatalogService{
+		logger:         logger.Named("feature_catalog"),
+		timeseriesRepo: repoFactory.Timeseries(),
+		twinRepo:       repoFactory.Twin(),
+	}
+}
+
+// Rebuild repopulates the feature catalog from the time-series data of a twin, or of every
+// twin when twinID is 0. Twins are rebuilt one at a time so no long lock is held; entries of
+// twins without data any more are removed.
+func (s *FeatureCatalogService) Rebuild(ctx context.Context, twinID uint) (*FeatureCatalogRebuild, error) {
+	result := &FeatureCatalogRebuild{}
+
+	if twinID != 0 {
+		twin, err := s.twinRepo.GetByID(twinID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, errors.New("twin not found")
+			}
+			s.logger.Error("Failed to get twin", zap.Uint("twin_id", twinID), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		if err := s.rebuildTwin(ctx, twin.DittoID, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	after := ""
+	for {
+		twinIDs, err := s.timeseriesRepo.ListFeatureCatalogTwins(ctx, after, featureCatalogRebuildBatch)
+		if err != nil {
+			s.logger.Error("Failed to list twins of the feature catalog", zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		for _, thingID := range twinIDs {
+			if err := s.rebuildTwin(ctx, thingID, result); err != nil {
+				return nil, err
+			}
+		}
+		if len(twinIDs) < featureCatalogRebuildBatch {
+			break
+		}
+		after = twinIDs[len(twinIDs)-1]
+	}
+
+	s.logger.Info("Rebuilt feature catalog", zap.Int("twins", result.Twins), zap.Int("features", result.Features))
+	return result, nil
+}
+
+// rebuildTwin rebuilds the catalog entries of one twin and adds them to the result
+func (s *FeatureCatalogService) rebuildTwin(ctx context.Context, thingID string, result *FeatureCatalogRebuild) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	features, err := s.timeseriesRepo.RebuildFeatureCatalog(ctx, thingID)
+	if err != nil {
+		s.logger.Error("Failed to rebuild feature catalog", zap.String("thingId", thingID), zap.Error(err))
+		return errors.New("failed to rebuild feature catalog")
+	}
+	result.Twins++
+	result.Features += features
+	return nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+)
+
+// Feature metadata limits
+const (
+	maxFeatureMetadata       = 200
+	maxFeatureMetadataLength = 64
+)
+
+// normalizeFeatureMetadata checks that a twin type's feature metadata describes features its
+// schema declares, and orders it for display: by order, then by feature path
+func normalizeFeatureMetadata(schema models.JSON, metadata models.FeatureMetadataList) (models.FeatureMetadataList, error) {
+	if len(metadata) > maxFeatureMetadata {
+		return nil, fmt.Errorf("invalid feature metadata: at most %d features can be described", maxFeatureMetadata)
+	}
+	if len(metadata) == 0 {
+		return models.FeatureMetadataList{}, nil
+	}
+
+	features := schemaFeatures(schema)
+	seen := make(map[string]bool, len(metadata))
+	normalized := make(models.FeatureMetadataList, 0, len(metadata))
+	for _, feature := range metadata {
+		feature.FeaturePath = strings.TrimSpace(feature.FeaturePath)
+		feature.Group = strings.TrimSpace(feature.Group)
+		feature.Icon = strings.TrimSpace(feature.Icon)
+		feature.Unit = strings.TrimSpace(feature.Unit)
+
+		path := feature.FeaturePath
+		if problem := featurePathProblem(path); problem != "" {
+			return nil, fmt.Errorf("invalid feature metadata: %s", problem)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("invalid feature metadata: %q is described twice", path)
+		}
+		if !schemaHasFeature(features, path) {
+			return nil, fmt.Errorf("invalid feature metadata: %q is not a feature of the schema", path)
+		}
+		if len(feature.Group) > maxFeatureMetadataLength || len(feature.Icon) > maxFeatureMetadataLength || len(feature.Unit) > maxFeatureMetadataLength {
+			return nil, fmt.Errorf("invalid feature metadata: group, icon and unit of %q must not exceed %d characters", path, maxFeatureMetadataLength)
+		}
+		if feature.Min != nil && feature.Max != nil && *feature.Min > *feature.Max {
+			return nil, fmt.Errorf("invalid feature metadata: min of %q exceeds its max", path)
+		}
+		// Registered units are stored by symbol; others are only displayed and kept as given
+		if unit, err := NormalizeUnit(feature.Unit); err == nil {
+			feature.Unit = unit
+		}
+
+		seen[path] = true
+		normalized = append(normalized, feature)
+	}
+
+	sort.SliceStable(normalized, func(i, j int) bool {
+		if normalized[i].Order != normalized[j].Order {
+			return normalized[i].Order < normalized[j].Order
+		}
+		return normalized[i].FeaturePath < normalized[j].FeaturePath
+	})
+	return normalized, nil
+}
+
+// schemaFeatures returns the properties a twin type schema declares for features: those of its
+// "features" property, as in a Ditto thing, or its own properties otherwise
+func schemaFeatures(schema models.JSON) map[string]interface{} {
+	var root map[string]interface{}
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return nil
+	}
+	properties, _ := root["properties"].(map[string]interface{})
+	if features, ok := properties["features"].(map[string]interface{}); ok {
+		if featureProperties, ok := features["properties"].(map[string]interface{}); ok {
+			return featureProperties
+		}
+	}
+	return properties
+}
+
+// schemaHasFeature reports whether each segment of a feature path names a property declared
+// by the schema of the one before. Ditto features keep their values under "properties", which
+// may be left out of the path.
+func schemaHasFeature(properties map[string]interface{}, path string) bool {
+	return schemaFeature(properties, path) != nil
+}
+
+// schemaFeature returns the schema of the property a feature path names, or nil if the schema
+// does not declare it
+func schemaFeature(properties map[string]interface{}, path string) map[string]interface{} {
+	var property map[string]interface{}
+	for _, segment := range strings.Split(path, "/") {
+		var ok bool
+		property, ok = properties[segment].(map[string]interface{})
+		if !ok {
+			dittoProperties, isObject := properties["properties"].(map[string]interface{})
+			if !isObject {
+				return nil
+			}
+			nested, _ := dittoProperties["properties"].(map[string]interface{})
+			if property, ok = nested[segment].(map[string]interface{}); !ok {
+				return nil
+			}
+		}
+		properties, _ = property["properties"].(map[string]interface{})
+	}
+	return property
+}
+
+// ListFeatureMetadata returns the feature metadata of a twin's type in display order. Features
+// without a unit take the unit their values are stored in, as set on the twin's bindings.
+func (s *TwinService) ListFeatureMetadata(twin *models.Twin) (models.FeatureMetadataList, error) {
+	if len(twin.Type.FeatureMetadata) == 0 {
+		return models.FeatureMetadataList{}, nil
+	}
+
+	bindings, err := s.ListFeatureBindings(twin.ID)
+	if err != nil {
+		return nil, err
+	}
+	return resolveFeatureMetadata(twin.Type.FeatureMetadata, bindings), nil
+}
+
+// resolveFeatureMetadata fills in the unit of features whose metadata has none from the
+// twin's bindings
+func resolveFeatureMetadata(features models.FeatureMetadataList, bindings []models.FeatureBinding) models.FeatureMetadataList {
+	units := make(map[string]string, len(bindings))
+	for _, binding := range bindings {
+		units[binding.FeaturePath] = binding.Unit
+	}
+
+	metadata := make(models.FeatureMetadataList, len(features))
+	for i, feature := range features {
+		if feature.Unit == "" {
+			feature.Unit = units[feature.FeaturePath]
+		}
+		metadata[i] = feature
+	}
+	return metadata
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+)
+
+// maxChartRawPoints caps the raw points of a chart's focused range
+const maxChartRawPoints = 1000
+
+// ErrInvalidChartRange is returned when a chart's focused range is not within its full range
+var ErrInvalidChartRange = errors.New("invalid chart range")
+
+// ChartQuery selects a chart: aggregated buckets over the full range, and raw points over a
+// focused range within it
+type ChartQuery struct {
+	TwinID      uint
+	FeaturePath string
+	Start       time.Time
+	End         time.Time
+	Interval    string
+	FocusStart  time.Time
+	FocusEnd    time.Time
+	// RawLimit caps the raw points, oldest first; 0 or more than maxChartRawPoints uses the maximum
+	RawLimit int
+}
+
+// ChartData holds the aggregated trend and the raw detail of a chart
+type ChartData struct {
+	Aggregated []models.AggregatedData
+	Raw        []models.TimeseriesData
+	RawLimit   int
+}
+
+// validate checks that the full range is ordered and contains the focused range
+func (q *ChartQuery) validate() error {
+	switch {
+	case !q.End.After(q.Start):
+		return fmt.Errorf("%w: end must be after start", ErrInvalidChartRange)
+	case !q.FocusEnd.After(q.FocusStart):
+		return fmt.Errorf("%w: focus_end must be after focus_start", ErrInvalidChartRange)
+	case q.FocusStart.Before(q.Start) || q.FocusEnd.After(q.End):
+		return fmt.Errorf("%w: the focused range %s to %s is not within %s to %s", ErrInvalidChartRange,
+			q.FocusStart.Format(time.RFC3339), q.FocusEnd.Format(time.RFC3339),
+			q.Start.Format(time.RFC3339), q.End.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// GetChartData returns the aggregated buckets of the full range and the raw points of the
+// focused range, so a chart can draw its trend and hover detail from one request
+func (s *HistoryService) GetChartData(ctx context.Context, query ChartQuery) (*ChartData, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	if query.RawLimit <= 0 || query.RawLimit > maxChartRawPoints {
+		query.RawLimit = maxChartRawPoints
+	}
+
+	aggregated, err := s.GetAggregatedData(ctx, query.TwinID, query.FeaturePath, query.Start, query.End, query.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	page := TimeseriesPage{Limit: query.RawLimit, Ascending: true}
+	raw, err := s.GetTimeseriesData(ctx, query.TwinID, query.FeaturePath, query.FocusStart, query.FocusEnd, page)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ChartData{Aggregated: aggregated, Raw: raw, RawLimit: query.RawLimit}, nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+)
+
+// ErrInvalidCompareRange is returned when a range of a comparison is empty or reversed
+var ErrInvalidCompareRange = errors.New("invalid comparison range")
+
+// TimeRange is a time range from Start to End
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// CompareQuery selects two time ranges of a feature whose aggregated series are compared,
+// e.g. before and after maintenance
+type CompareQuery struct {
+	TwinID      uint
+	FeaturePath string
+	Interval    string
+	Baseline    TimeRange
+	Comparison  TimeRange
+}
+
+// RangeSummary summarizes the aggregated buckets of a range. Mean is weighted by the samples of
+// each bucket; the statistics are zero if the range holds no samples.
+type RangeSummary struct {
+	TimeRange
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// CompareBucket holds the buckets of both ranges at the same offset from the start of their
+// range; a range without samples in that bucket has none
+type CompareBucket struct {
+	// Offset is the seconds from the start of the range to the start of the bucket
+	Offset     int64                  `json:"offset_seconds"`
+	Baseline   *models.AggregatedData `json:"baseline"`
+	Comparison *models.AggregatedData `json:"comparison"`
+}
+
+// CompareDelta is the change from the baseline to the comparison range. Changes are null if
+// either range holds no samples, and percentages also if the baseline statistic is 0.
+type CompareDelta struct {
+	MeanChange        *float64 `json:"mean_change"`
+	MeanChangePercent *float64 `json:"mean_change_percent"`
+	MinChange         *float64 `json:"min_change"`
+	MinChangePercent  *float64 `json:"min_change_percent"`
+	MaxChange         *float64 `json:"max_change"`
+	MaxChangePercent  *float64 `json:"max_change_percent"`
+}
+
+// RangeComparison holds the aligned aggregated series of two ranges and how they differ
+type RangeComparison struct {
+	Baseline   RangeSummary    `json:"baseline"`
+	Comparison RangeSummary    `json:"comparison"`
+	Delta      CompareDelta    `json:"delta"`
+	Series     []CompareBucket `json:"series"`
+}
+
+// validate checks that both ranges are ordered
+func (q *CompareQuery) validate() error {
+	switch {
+	case !q.Baseline.End.After(q.Baseline.Start):
+		return fmt.Errorf("%w: baseline_end must be after baseline_start", ErrInvalidCompareRange)
+	case !q.Comparison.End.After(q.Comparison.Start):
+		return fmt.Errorf("%w: compare_end must be after compare_start", ErrInvalidCompareRange)
+	}
+	return nil
+}
+
+// CompareRanges returns the aggregated series of two ranges of a feature aligned by their
+// offset from the start of each range, with the change of the mean, minimum and maximum
+func (s *HistoryService) CompareRanges(ctx context.Context, query CompareQuery) (*RangeComparison, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+
+	baseline, err := s.GetAggregatedData(ctx, query.TwinID, query.FeaturePath, query.Baseline.Start, query.Baseline.End, query.Interval)
+	if err != nil {
+		return nil, err
+	}
+	comparison, err := s.GetAggregatedData(ctx, query.TwinID, query.FeaturePath, query.Comparison.Start, query.Comparison.End, query.Interval)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RangeComparison{
+		Baseline:   summarizeRange(query.Baseline, baseline),
+		Comparison: summarizeRange(query.Comparison, comparison),
+	}
+	result.Delta = compareSummaries(result.Baseline, result.Comparison)
+	// The interval was checked by GetAggregatedData
+	width, _ := intervalWidth(query.Interval)
+	result.Series = alignBuckets(query, width, baseline, comparison)
+	return result, nil
+}
+
+// summarizeRange computes the sample-weighted mean and the extremes of a range's buckets
+func summarizeRange(timeRange TimeRange, buckets []models.AggregatedData) RangeSummary {
+	summary := RangeSummary{TimeRange: timeRange}
+	var total float64
+	for _, bucket := range buckets {
+		if bucket.Count <= 0 {
+			continue
+		}
+		if summary.Count == 0 || bucket.Min < summary.Min {
+			summary.Min = bucket.Min
+		}
+		if summary.Count == 0 || bucket.Max > summary.Max {
+			summary.Max = bucket.Max
+		}
+		total += bucket.Avg * float64(bucket.Count)
+		summary.Count += bucket.Count
+	}
+	if summary.Count > 0 {
+		summary.Mean = total / float64(summary.Count)
+	}
+	return summary
+}
+
+// compareSummaries computes the change of each statistic from the baseline to the comparison
+func compareSummaries(baseline, comparison RangeSummary) CompareDelta {
+	var delta CompareDelta
+	if baseline.Count == 0 || comparison.Count == 0 {
+		return delta
+	}
+	delta.MeanChange, delta.MeanChangePercent = statisticChange(baseline.Mean, comparison.Mean)
+	delta.MinChange, delta.MinChangePercent = statisticChange(baseline.Min, comparison.Min)
+	delta.MaxChange, delta.MaxChangePercent = statisticChange(baseline.Max, comparison.Max)
+	return delta
+}
+
+// statisticChange returns the difference between two values and its percentage of the
+// magnitude of the first, which is null if the first is 0
+func statisticChange(from, to float64) (*float64, *float64) {
+	difference := to - from
+	if from == 0 {
+		return &difference, nil
+	}
+	percent := difference / math.Abs(from) * 100
+	return &difference, &percent
+}
+
+// alignBuckets pairs the buckets of both ranges by their index from the start of their range,
+// oldest first. The bucket containing the start of a range is its first; months are counted
+// as 30 days.
+func alignBuckets(query CompareQuery, width time.Duration, baseline, comparison []models.AggregatedData) []CompareBucket {
+	index := func(start, bucket time.Time) int64 {
+		i := int64((bucket.Sub(start) + width - 1) / width)
+		if i < 0 {
+			return 0
+		}
+		return i
+	}
+
+	byIndex := make(map[int64]*CompareBucket)
+	var last int64 = -1
+	slot := func(i int64) *CompareBucket {
+		if byIndex[i] == nil {
+			byIndex[i] = &CompareBucket{Offset: i * int64(width/time.Second)}
+		}
+		if i > last {
+			last = i
+		}
+		return byIndex[i]
+	}
+	for i := range baseline {
+		slot(index(query.Baseline.Start, baseline[i].TimeInterval)).Baseline = &baseline[i]
+	}
+	for i := range comparison {
+		slot(index(query.Comparison.Start, comparison[i].TimeInterval)).Comparison = &comparison[i]
+	}
+
+	series := make([]CompareBucket, 0, len(byIndex))
+	for i := int64(0); i <= last; i++ {
+		if bucket, ok := byIndex[i]; ok {
+			series = append(series, *bucket)
+		}
+	}
+	return series
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// Export types of the history export
+const (
+	ExportRaw        = "raw"
+	ExportAggregated = "aggregated"
+	ExportAlerts     = "alerts"
+)
+
+// Export formats of the history export
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// exportFlushRows is how many CSV rows are buffered before they are written out
+const exportFlushRows = 500
+
+var (
+	// ErrInvalidExport is returned when an export query is incomplete or has unknown options
+	ErrInvalidExport = errors.New("invalid export")
+	// ErrExportAccessDenied is returned when the user may not view the exported twin
+	ErrExportAccessDenied = errors.New("no access to the twin's project")
+)
+
+// exportColumns lists the CSV columns of each export type, named like the JSON fields of its rows
+var exportColumns = map[string][]string{
+	ExportRaw:        {"time", "twin_id", "feature_path", "value_type", "value_num", "value_bool", "value_str", "value_json", "source"},
+	ExportAggregated: {"time_interval", "twin_id", "feature_path", "interval_type", "min", "max", "avg", "sum", "count", "first_time", "last_time"},
+	ExportAlerts:     {"time", "alert_id", "twin_id", "feature_path", "severity", "message", "value_json", "source", "acknowledged", "ack_by", "ack_time", "ack_note", "occurrence_count", "last_seen"},
+}
+
+// ExportColumns returns the CSV header of an export type
+func ExportColumns(exportType string) []string {
+	return append([]string(nil), exportColumns[exportType]...)
+}
+
+// ExportQuery selects the rows of a history export
+type ExportQuery struct {
+	TwinID uint
+	// Type is raw, aggregated or alerts
+	Type string
+	// Format is csv or ndjson
+	Format string
+	Start  time.Time
+	End    time.Time
+	// FeaturePath selects the series of raw and aggregated exports
+	FeaturePath string
+	// Interval is the bucket width of aggregated exports
+	Interval string
+	// Source only exports raw points from this source, if set
+	Source string
+	// Severity and Acknowledged narrow alert exports, if set
+	Severity     string
+	Acknowledged *bool
+	// UserID is who asks for the export; admins may export every twin
+	UserID  uint
+	IsAdmin bool
+}
+
+// validate checks the options the export type needs
+func (q *ExportQuery) validate() error {
+	if _, ok := exportColumns[q.Type]; !ok {
+		return fmt.Errorf("%w: unknown type %q, expected raw, aggregated or alerts", ErrInvalidExport, q.Type)
+	}
+	if q.Format != ExportCSV && q.Format != ExportNDJSON {
+		return fmt.Errorf("%w: unknown format %q, expected csv or ndjson", ErrInvalidExport, q.Format)
+	}
+	if !q.End.After(q.Start) {
+		return fmt.Errorf("%w: end must be after start", ErrInvalidExport)
+	}
+
+	switch q.Type {
+	case ExportRaw:
+		if q.FeaturePath == "" {
+			return fmt.Errorf("%w: feature_path is required", ErrInvalidExport)
+		}
+		if q.Source != "" && !IsValidSource(q.Source) {
+			return fmt.Errorf("%w: unknown source %s", ErrInvalidExport, q.Source)
+		}
+	case ExportAggregated:
+		if q.FeaturePath == "" || q.Interval == "" {
+			return fmt.Errorf("%w: feature_path and interval are required", ErrInvalidExport)
+		}
+	case ExportAlerts:
+		if q.Severity != "" && !alertSeverities[q.Severity] {
+			return fmt.Errorf("%w: unknown severity %s, expected info, warning, error or critical", ErrInvalidExport, q.Severity)
+		}
+	}
+	return nil
+}
+
+// HistoryExport is a validated export of a twin's history, ready to be written
+type HistoryExport struct {
+	query   ExportQuery
+	dittoID string
+	service *HistoryService
+}
+
+// PrepareExport validates an export, looks up its twin and checks the user may view it, so
+// that errors can be answered before any row is written
+func (s *HistoryService) PrepareExport(query ExportQuery) (*HistoryExport, error) {
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	if query.Type == ExportAggregated {
+		if err := s.checkBuckets(query.Start, query.End, query.Interval); err != nil {
+			if errors.Is(err, ErrTooManyBuckets) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", ErrInvalidExport, err)
+		}
+	}
+
+	twin, err := s.twinRepo.GetByID(query.TwinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", query.TwinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	if !query.IsAdmin {
+		allowed, err := s.projectService.CheckAccess(twin.ProjectID, query.UserID, models.ProjectRoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrExportAccessDenied
+		}
+	}
+
+	return &HistoryExport{query: query, dittoID: twin.DittoID, service: s}, nil
+}
+
+// ContentType returns the media type of the export's format
+func (e *HistoryExport) ContentType() string {
+	if e.query.Format == ExportNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Filename returns the name the export is downloaded as
+func (e *HistoryExport) Filename() string {
+	return fmt.Sprintf("twin-%d-%s-%s-%s.%s", e.query.TwinID, e.query.Type,
+		e.query.Start.UTC().Format("20060102T150405Z"), e.query.End.UTC().Format("20060102T150405Z"), e.query.Format)
+}
+
+// WriteTo writes the export's rows to w, oldest first. Raw points and alerts are streamed
+// from a cursor; aggregated buckets are bounded by the bucket limit and read at once.
+func (e *HistoryExport) WriteTo(ctx context.Context, w io.Writer) error {
+	encoder, err := newExportEncoder(e.query.Format, w, exportColumns[e.query.Type])
+	if err != nil {
+		return err
+	}
+
+	q := e.query
+	repo := e.service.timeseriesRepo
+	switch q.Type {
+	case ExportRaw:
+		var calibrations models.Calibrations
+		if calibrations, err = e.service.queryCalibrations(q.TwinID, q.FeaturePath); err != nil {
+			return err
+		}
+		err = repo.StreamTimeseriesData(ctx, e.dittoID, q.FeaturePath, q.Start, q.End, q.Source, func(point *models.TimeseriesData) error {
+			calibratePoint(point, calibrations)
+			return encoder.write(point, timeseriesRecord(point))
+		})
+	case ExportAggregated:
+		var buckets []models.AggregatedData
+		buckets, err = e.service.GetAggregatedData(ctx, q.TwinID, q.FeaturePath, q.Start, q.End, q.Interval)
+		// Aggregated reads are newest first
+		for i := len(buckets) - 1; i >= 0 && err == nil; i-- {
+			err = encoder.write(&buckets[i], aggregatedRecord(&buckets[i]))
+		}
+	case ExportAlerts:
+		filter := repository.AlertFilter{Severity: q.Severity, Acknowledged: q.Acknowledged}
+		err = repo.StreamAlertData(ctx, e.dittoID, q.Start, q.End, filter, func(alert *models.AlertData) error {
+			return encoder.write(alert, alertRecord(alert))
+		})
+	}
+	if err != nil {
+		e.service.logger.Error("Failed to export history",
+			zap.Uint("twin_id", q.TwinID),
+			zap.String("type", q.Type),
+			zap.Error(err))
+		return err
+	}
+
+	return encoder.flush()
+}
+
+// exportEncoder writes rows as CSV records under a header, or as one JSON object per line
+type exportEncoder struct {
+	csv  *csv.Writer
+	json *json.Encoder
+	rows int
+}
+
+// newExportEncoder creates an encoder for the format, writing the CSV header right away
+func newExportEncoder(format string, w io.Writer, columns []string) (*exportEncoder, error) {
+	if format == ExportNDJSON {
+		return &exportEncoder{json: json.NewEncoder(w)}, nil
+	}
+
+	encoder := &exportEncoder{csv: csv.NewWriter(w)}
+	if err := encoder.csv.Write(columns); err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// write encodes a row, as its CSV record or as JSON
+func (e *exportEncoder) write(row interface{}, record []string) error {
+	if e.json != nil {
+		return e.json.Encode(row)
+	}
+
+	if err := e.csv.Write(record); err != nil {
+		return err
+	}
+	e.rows++
+	if e.rows%exportFlushRows == 0 {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush writes out the buffered CSV records
+func (e *exportEncoder) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// timeseriesRecord returns the CSV record of a point, in the order of the raw columns
+func timeseriesRecord(point *models.TimeseriesData) []string {
+	valueBool := ""
+	if point.ValueBool != nil {
+		valueBool = strconv.FormatBool(*point.ValueBool)
+	}
+	valueNum := ""
+	if point.ValueType == "number" {
+		valueNum = formatExportFloat(point.ValueNum)
+	}
+	return []string{
+		formatExportTime(point.Time), point.TwinID, point.FeaturePath, point.ValueType,
+		valueNum, valueBool, point.ValueStr, point.ValueJSON, point.Source,
+	}
+}
+
+// aggregatedRecord returns the CSV record of a bucket, in the order of the aggregated columns
+func aggregatedRecord(bucket *models.AggregatedData) []string {
+	return []string{
+		formatExportTime(bucket.TimeInterval), bucket.TwinID, bucket.FeaturePath, bucket.IntervalType,
+		formatExportFloat(bucket.Min), formatExportFloat(bucket.Max), formatExportFloat(bucket.Avg), formatExportFloat(bucket.Sum),
+		strconv.Itoa(bucket.Count), formatExportTime(bucket.FirstTime), formatExportTime(bucket.LastTime),
+	}
+}
+
+// alertRecord returns the CSV record of an alert, in the order of the alert columns
+func alertRecord(alert *models.AlertData) []string {
+	return []string{
+		formatExportTime(alert.Time), alert.AlertID, alert.TwinID, alert.FeaturePath, alert.Severity,
+		alert.Message, alert.ValueJSON, alert.Source, strconv.FormatBool(alert.Acknowledged),
+		alert.AckBy, formatExportTime(alert.AckTime), alert.AckNote,
+		strconv.Itoa(alert.OccurrenceCount), formatExportTime(alert.LastSeen),
+	}
+}
+
+// formatExportTime formats a time as RFC 3339 in UTC, leaving unset times empty
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// formatExportFloat formats a number without exponent or trailing zeros
+func formatExportFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
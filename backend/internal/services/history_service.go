@@ -1,10 +1,13 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db"
 	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/db/repository"
@@ -18,21 +21,154 @@ type HistoryService struct {
 	logger         *utils.Logger
 	timeseriesRepo repository.TimeseriesRepository
 	twinRepo       repository.TwinRepository
+	attributeRepo  repository.AttributeHistoryRepository
+	projectService *ProjectService
+	cache          *QueryCache
+	// ackNoteRequired holds the severities whose acknowledgement needs a note
+	ackNoteRequired map[string]bool
+	// maxBuckets caps the buckets of an aggregated query; 0 means unlimited
+	maxBuckets int
+	// heavyQueries bounds the expensive reads in flight
+	heavyQueries    *QueryLimiter
+	heavyRetryAfter int
+	// maxFeatures caps the features of one feature listing page; 0 means unlimited
+	maxFeatures int
+	// alertRouting publishes acknowledgements, if set
+	alertRouting *AlertRoutingService
+}
+
+// alertSeverities lists the severities alerts are recorded with
+var alertSeverities = map[string]bool{
+	"info": true, "warning": true, "error": true, "critical": true,
+}
+
+// ErrTooManyBuckets is returned when an aggregated query would produce more buckets than allowed
+var ErrTooManyBuckets = errors.New("too many aggregation buckets")
+
+// aggregationInterval is a supported aggregation interval and its approximate bucket width
+type aggregationInterval struct {
+	name  string
+	width time.Duration
+}
+
+// aggregationIntervals lists the supported intervals from finest to coarsest
+var aggregationIntervals = []aggregationInterval{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+	{"12h", 12 * time.Hour},
+	{"1d", 24 * time.Hour},
+	{"1w", 7 * 24 * time.Hour},
+	{"1mon", 30 * 24 * time.Hour},
+}
+
+// BucketCount returns the number of buckets of the given width needed to cover a time range
+func BucketCount(start, end time.Time, width time.Duration) int64 {
+	if !end.After(start) || width <= 0 {
+		return 0
+	}
+	span := end.Sub(start)
+	return int64((span + width - 1) / width)
+}
+
+// timeseriesColumns lists the time-series fields that can be requested, by JSON name
+var timeseriesColumns = map[string]string{
+	"time":         "time",
+	"twin_id":      "twin_id",
+	"feature_path": "feature_path",
+	"value_type":   "value_type",
+	"value_num":    "value_num",
+	"value_bool":   "value_bool",
+	"value_str":    "value_str",
+	"value_json":   "value_json",
+	"source":       "source",
+}
+
+// TimeseriesColumns maps requested time-series fields to database columns
+func TimeseriesColumns(fields []string) ([]string, error) {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column, ok := timeseriesColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("invalid field: %s", field)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
 }
 
 // NewHistoryService creates a new history service
-func NewHistoryService(db *db.Database, logger *utils.Logger) *HistoryService {
+func NewHistoryService(db *db.Database, cacheConfig *config.CacheConfig, alertConfig *config.AlertConfig, historyConfig *config.HistoryConfig, logger *utils.Logger) *HistoryService {
 	repoFactory := repository.NewRepositoryFactory(db.DB)
+
+	ackNoteRequired := make(map[string]bool)
+	if alertConfig != nil {
+		for _, severity := range alertConfig.AckNoteRequired {
+			ackNoteRequired[strings.ToLower(severity)] = true
+		}
+	}
+
+	maxBuckets, maxHeavyQueries, heavyRetryAfter, maxFeatures := 0, 0, 0, 0
+	if historyConfig != nil {
+		maxBuckets = historyConfig.MaxBuckets
+		maxHeavyQueries = historyConfig.MaxConcurrentHeavyQueries
+		heavyRetryAfter = historyConfig.HeavyQueryRetryAfter
+		maxFeatures = historyConfig.MaxFeaturePageSize
+	}
+
 	return &HistoryService{
-		db:             db,
-		logger:         logger.Named("history_service"),
-		timeseriesRepo: repoFactory.Timeseries(),
-		twinRepo:       repoFactory.Twin(),
+		db:              db,
+		logger:          logger.Named("history_service"),
+		timeseriesRepo:  repoFactory.Timeseries(),
+		twinRepo:        repoFactory.Twin(),
+		attributeRepo:   repoFactory.AttributeHistory(),
+		projectService:  NewProjectService(db, logger),
+		cache:           NewQueryCache(cacheConfig),
+		ackNoteRequired: ackNoteRequired,
+		maxBuckets:      maxBuckets,
+		heavyQueries:    NewQueryLimiter(maxHeavyQueries),
+		heavyRetryAfter: heavyRetryAfter,
+		maxFeatures:     maxFeatures,
 	}
 }
 
-// GetTimeseriesData retrieves time-series data for a specific twin and feature path
-func (s *HistoryService) GetTimeseriesData(twinID uint, featurePath string, start, end time.Time, limit int) ([]models.TimeseriesData, error) {
+// SetAlertRouting publishes alert acknowledgements as alert lifecycle events according to the alert routes
+func (s *HistoryService) SetAlertRouting(alertRouting *AlertRoutingService) {
+	s.alertRouting = alertRouting
+}
+
+// HeavyQueries returns the limiter of the expensive history reads
+func (s *HistoryService) HeavyQueries() *QueryLimiter {
+	return s.heavyQueries
+}
+
+// HeavyQueryRetryAfter returns how many seconds a rejected heavy query should wait before retrying
+func (s *HistoryService) HeavyQueryRetryAfter() int {
+	return s.heavyRetryAfter
+}
+
+// CacheStats returns hit/miss metrics of the history query cache
+func (s *HistoryService) CacheStats() QueryCacheStats {
+	return s.cache.Stats()
+}
+
+// TimeseriesPage selects the limit, offset and time order of a time-series read
+type TimeseriesPage = repository.TimeseriesPage
+
+// MLPredictionFilter selects the ML predictions read by type, minimum score and label
+type MLPredictionFilter = repository.MLPredictionFilter
+
+// GetTimeseriesData retrieves a page of time-series data for a specific twin and feature path.
+// If fields are given, only those columns are read.
+func (s *HistoryService) GetTimeseriesData(ctx context.Context, twinID uint, featurePath string, start, end time.Time, page TimeseriesPage, fields ...string) ([]models.TimeseriesData, error) {
+	columns, err := TimeseriesColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -42,8 +178,26 @@ func (s *HistoryService) GetTimeseriesData(twinID uint, featurePath string, star
 		return nil, errors.New("database error")
 	}
 
+	// Stored values are corrected on read, which needs the time and type of each point
+	calibrations, err := s.queryCalibrations(twinID, featurePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(calibrations) > 0 && len(columns) > 0 {
+		columns = withColumns(columns, "time", "value_type")
+	}
+
+	// Closed windows no longer change, so their results can be served from the cache
+	cacheable := s.cache.Cacheable(end)
+	cacheKey := QueryCacheKey("timeseries", twin.DittoID, featurePath, start, end, append([]string{fmt.Sprint(page.Limit), fmt.Sprint(page.Offset), fmt.Sprint(page.Ascending), page.Source, valuePredicateKey(page.Value)}, columns...)...)
+	if cacheable {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			return calibrateTimeseries(cached.([]models.TimeseriesData), calibrations), nil
+		}
+	}
+
 	// Use the Ditto ID for time-series data lookups
-	data, err := s.timeseriesRepo.GetTimeseriesData(twin.DittoID, featurePath, start, end, limit)
+	data, err := s.timeseriesRepo.GetTimeseriesData(ctx, twin.DittoID, featurePath, start, end, page, columns...)
 	if err != nil {
 		s.logger.Error("Failed to get time-series data",
 			zap.Uint("twin_id", twinID),
@@ -53,11 +207,39 @@ func (s *HistoryService) GetTimeseriesData(twinID uint, featurePath string, star
 		return nil, errors.New("failed to retrieve time-series data")
 	}
 
-	return data, nil
+	if cacheable {
+		s.cache.Set(cacheKey, data)
+	}
+
+	return calibrateTimeseries(data, calibrations), nil
+}
+
+// withColumns adds the columns that are not selected yet
+func withColumns(columns []string, required ...string) []string {
+	selected := append([]string(nil), columns...)
+	for _, column := range required {
+		found := false
+		for _, existing := range columns {
+			if existing == column {
+				found = true
+				break
+			}
+		}
+		if !found {
+			selected = append(selected, column)
+		}
+	}
+	return selected
 }
 
-// GetLatestTimeseriesData retrieves the latest time-series data for a twin and feature path
-func (s *HistoryService) GetLatestTimeseriesData(twinID uint, featurePath string) (*models.TimeseriesData, error) {
+// GetLatestTimeseriesData retrieves the latest time-series data for a twin and feature path.
+// If fields are given, only those columns are read.
+func (s *HistoryService) GetLatestTimeseriesData(ctx context.Context, twinID uint, featurePath string, fields ...string) (*models.TimeseriesData, error) {
+	columns, err := TimeseriesColumns(fields)
+	if err != nil {
+		return nil, err
+	}
+
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -67,7 +249,15 @@ func (s *HistoryService) GetLatestTimeseriesData(twinID uint, featurePath string
 		return nil, errors.New("database error")
 	}
 
-	data, err := s.timeseriesRepo.GetLatestTimeseriesData(twin.DittoID, featurePath)
+	calibrations, err := s.queryCalibrations(twinID, featurePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(calibrations) > 0 && len(columns) > 0 {
+		columns = withColumns(columns, "time", "value_type")
+	}
+
+	data, err := s.timeseriesRepo.GetLatestTimeseriesData(ctx, twin.DittoID, featurePath, columns...)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, errors.New("no data found for the given twin and feature path")
@@ -80,11 +270,44 @@ func (s *HistoryService) GetLatestTimeseriesData(twinID uint, featurePath string
 		return nil, errors.New("database error")
 	}
 
+	calibratePoint(data, calibrations)
 	return data, nil
 }
 
+// checkBuckets validates the interval and rejects ranges that would produce more than
+// maxBuckets buckets, suggesting the finest interval that stays within the limit
+func (s *HistoryService) checkBuckets(start, end time.Time, interval string) error {
+	index := -1
+	for i, candidate := range aggregationIntervals {
+		if candidate.name == interval {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	if s.maxBuckets <= 0 {
+		return nil
+	}
+	count := BucketCount(start, end, aggregationIntervals[index].width)
+	if count <= int64(s.maxBuckets) {
+		return nil
+	}
+
+	for _, coarser := range aggregationIntervals[index+1:] {
+		if BucketCount(start, end, coarser.width) <= int64(s.maxBuckets) {
+			return fmt.Errorf("%w: %d buckets requested, the maximum is %d; use an interval of %s or coarser",
+				ErrTooManyBuckets, count, s.maxBuckets, coarser.name)
+		}
+	}
+	return fmt.Errorf("%w: %d buckets requested, the maximum is %d; narrow the time range",
+		ErrTooManyBuckets, count, s.maxBuckets)
+}
+
 // GetAggregatedData retrieves aggregated time-series data
-func (s *HistoryService) GetAggregatedData(twinID uint, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error) {
+func (s *HistoryService) GetAggregatedData(ctx context.Context, twinID uint, featurePath string, start, end time.Time, interval string) ([]models.AggregatedData, error) {
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -94,18 +317,24 @@ func (s *HistoryService) GetAggregatedData(twinID uint, featurePath string, star
 		return nil, errors.New("database error")
 	}
 
-	// Validate interval
-	validIntervals := map[string]bool{
-		"1m": true, "5m": true, "15m": true, "30m": true,
-		"1h": true, "6h": true, "12h": true,
-		"1d": true, "1w": true, "1mon": true,
+	if err := s.checkBuckets(start, end, interval); err != nil {
+		return nil, err
+	}
+
+	calibrations, err := s.queryCalibrations(twinID, featurePath)
+	if err != nil {
+		return nil, err
 	}
 
-	if !validIntervals[interval] {
-		return nil, fmt.Errorf("invalid interval: %s", interval)
+	cacheable := s.cache.Cacheable(end)
+	cacheKey := QueryCacheKey("aggregated", twin.DittoID, featurePath, start, end, interval)
+	if cacheable {
+		if cached, ok := s.cache.Get(cacheKey); ok {
+			return calibrateAggregated(cached.([]models.AggregatedData), calibrations), nil
+		}
 	}
 
-	data, err := s.timeseriesRepo.GetAggregatedTimeseriesData(twin.DittoID, featurePath, start, end, interval)
+	data, err := s.timeseriesRepo.GetAggregatedTimeseriesData(ctx, twin.DittoID, featurePath, start, end, interval)
 	if err != nil {
 		s.logger.Error("Failed to get aggregated time-series data",
 			zap.Uint("twin_id", twinID),
@@ -116,11 +345,15 @@ func (s *HistoryService) GetAggregatedData(twinID uint, featurePath string, star
 		return nil, errors.New("failed to retrieve aggregated data")
 	}
 
-	return data, nil
+	if cacheable {
+		s.cache.Set(cacheKey, data)
+	}
+
+	return calibrateAggregated(data, calibrations), nil
 }
 
 // GetAlertData retrieves alert data for a specific twin
-func (s *HistoryService) GetAlertData(twinID uint, start, end time.Time, severity string, limit int) ([]models.AlertData, error) {
+func (s *HistoryService) GetAlertData(ctx context.Context, twinID uint, start, end time.Time, severity string, limit int) ([]models.AlertData, error) {
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -132,16 +365,12 @@ func (s *HistoryService) GetAlertData(twinID uint, start, end time.Time, severit
 
 	// Validate severity if provided
 	if severity != "" {
-		validSeverities := map[string]bool{
-			"info": true, "warning": true, "error": true, "critical": true,
-		}
-
-		if !validSeverities[severity] {
+		if !alertSeverities[severity] {
 			return nil, fmt.Errorf("invalid severity: %s", severity)
 		}
 	}
 
-	alerts, err := s.timeseriesRepo.GetAlertData(twin.DittoID, start, end, severity, limit)
+	alerts, err := s.timeseriesRepo.GetAlertData(ctx, twin.DittoID, start, end, severity, limit)
 	if err != nil {
 		s.logger.Error("Failed to get alert data",
 			zap.Uint("twin_id", twinID),
@@ -154,8 +383,51 @@ func (s *HistoryService) GetAlertData(twinID uint, start, end time.Time, severit
 	return alerts, nil
 }
 
-// AcknowledgeAlert acknowledges an alert
-func (s *HistoryService) AcknowledgeAlert(alertID string, userID uint) error {
+// GetActiveAlerts retrieves the unacknowledged alerts of a twin, newest first
+func (s *HistoryService) GetActiveAlerts(ctx context.Context, twinID uint, limit int) ([]models.AlertData, error) {
+	twin, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	alerts, err := s.timeseriesRepo.ListActiveAlerts(ctx, twin.DittoID, limit)
+	if err != nil {
+		s.logger.Error("Failed to get active alerts",
+			zap.Uint("twin_id", twinID),
+			zap.String("ditto_id", twin.DittoID),
+			zap.Error(err))
+		return nil, errors.New("failed to retrieve alert data")
+	}
+
+	return alerts, nil
+}
+
+// AcknowledgeAlert acknowledges an alert. The note is stored with the acknowledgement and
+// is required for severities configured in the alert ack policy.
+func (s *HistoryService) AcknowledgeAlert(alertID string, userID uint, note string) error {
+	// Only the fields the ack policy and the lifecycle event need are read
+	alert, err := s.timeseriesRepo.GetAlertByID(alertID, "alert_id", "twin_id", "feature_path", "severity", "acknowledged")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("alert not found or already acknowledged")
+		}
+		s.logger.Error("Failed to get alert", zap.String("alert_id", alertID), zap.Error(err))
+		return errors.New("failed to acknowledge alert")
+	}
+
+	if alert.Acknowledged {
+		return errors.New("alert not found or already acknowledged")
+	}
+
+	note = strings.TrimSpace(note)
+	if note == "" && s.ackNoteRequired[strings.ToLower(alert.Severity)] {
+		return fmt.Errorf("ack note required for %s alerts", alert.Severity)
+	}
+
 	// Get user email or name for ack attribution
 	var ackBy string
 	var user models.User
@@ -172,7 +444,7 @@ func (s *HistoryService) AcknowledgeAlert(alertID string, userID uint) error {
 		}
 	}
 
-	err := s.timeseriesRepo.AcknowledgeAlert(alertID, ackBy)
+	err = s.timeseriesRepo.AcknowledgeAlert(alertID, ackBy, note)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return errors.New("alert not found or already acknowledged")
@@ -184,35 +456,55 @@ func (s *HistoryService) AcknowledgeAlert(alertID string, userID uint) error {
 		return errors.New("failed to acknowledge alert")
 	}
 
+	// The acknowledgement stands even if its event cannot be stored
+	if s.alertRouting != nil {
+		event := &AlertLifecycleEvent{
+			AlertID:     alert.AlertID,
+			DittoID:     alert.TwinID,
+			FeaturePath: alert.FeaturePath,
+			Severity:    alert.Severity,
+			State:       AlertStateAcknowledged,
+			Actor:       ackBy,
+			Note:        note,
+			Time:        time.Now().UTC(),
+		}
+		if _, err := s.alertRouting.PublishLifecycle(models.WebhookEventAlertAcknowledged, alert, event); err != nil {
+			s.logger.Error("Failed to publish alert acknowledgement",
+				zap.String("alert_id", alertID),
+				zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
-// GetMLPredictionData retrieves ML prediction data for a specific twin and task
-func (s *HistoryService) GetMLPredictionData(twinID uint, taskID string, start, end time.Time, limit int) ([]models.MLPredictionData, error) {
+// GetMLPredictionData retrieves a page of the ML prediction data for a specific twin and task
+// matching the filter, along with the number of matching predictions
+func (s *HistoryService) GetMLPredictionData(ctx context.Context, twinID uint, taskID string, start, end time.Time, filter MLPredictionFilter, limit, offset int) ([]models.MLPredictionData, int64, error) {
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
-			return nil, errors.New("twin not found")
+			return nil, 0, errors.New("twin not found")
 		}
 		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
-		return nil, errors.New("database error")
+		return nil, 0, errors.New("database error")
 	}
 
-	predictions, err := s.timeseriesRepo.GetMLPredictionData(twin.DittoID, taskID, start, end, limit)
+	predictions, total, err := s.timeseriesRepo.GetMLPredictionData(ctx, twin.DittoID, taskID, start, end, filter, limit, offset)
 	if err != nil {
 		s.logger.Error("Failed to get ML prediction data",
 			zap.Uint("twin_id", twinID),
 			zap.String("ditto_id", twin.DittoID),
 			zap.String("task_id", taskID),
 			zap.Error(err))
-		return nil, errors.New("failed to retrieve ML prediction data")
+		return nil, 0, errors.New("failed to retrieve ML prediction data")
 	}
 
-	return predictions, nil
+	return predictions, total, nil
 }
 
 // GetLatestMLPrediction retrieves the latest ML prediction for a twin and task
-func (s *HistoryService) GetLatestMLPrediction(twinID uint, taskID string) (*models.MLPredictionData, error) {
+func (s *HistoryService) GetLatestMLPrediction(ctx context.Context, twinID uint, taskID string) (*models.MLPredictionData, error) {
 	twin, err := s.twinRepo.GetByID(twinID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
@@ -222,7 +514,7 @@ func (s *HistoryService) GetLatestMLPrediction(twinID uint, taskID string) (*mod
 		return nil, errors.New("database error")
 	}
 
-	prediction, err := s.timeseriesRepo.GetLatestMLPrediction(twin.DittoID, taskID)
+	prediction, err := s.timeseriesRepo.GetLatestMLPrediction(ctx, twin.DittoID, taskID)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, errors.New("no ML prediction found for the given twin and task")
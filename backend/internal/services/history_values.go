@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidValuePredicate is returned when a value predicate does not suit the values of a feature
+var ErrInvalidValuePredicate = errors.New("invalid value predicate")
+
+// ValuePredicate selects time-series points by their stored value
+type ValuePredicate = repository.ValuePredicate
+
+// ValueFilter is a value predicate as given in a query, before it is checked against the
+// values of the feature
+type ValueFilter struct {
+	GreaterThan string
+	LessThan    string
+	Equal       string
+}
+
+// IsZero reports whether the filter selects every point
+func (f ValueFilter) IsZero() bool {
+	return f == ValueFilter{}
+}
+
+// ParseValuePredicate checks a value filter against the type of the feature's latest value.
+// Bounds need a numeric feature, and equality is parsed as a number, boolean or string
+// accordingly. Numbers are compared with the stored values, so they cannot be filtered on
+// features calibrated on read.
+func (s *HistoryService) ParseValuePredicate(ctx context.Context, twinID uint, featurePath string, filter ValueFilter) (*ValuePredicate, error) {
+	if filter.IsZero() {
+		return nil, nil
+	}
+
+	twin, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	latest, err := s.timeseriesRepo.GetLatestTimeseriesData(ctx, twin.DittoID, featurePath, "value_type")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: feature %s has no stored values", ErrInvalidValuePredicate, featurePath)
+		}
+		s.logger.Error("Failed to get value type of feature",
+			zap.Uint("twin_id", twinID),
+			zap.String("feature_path", featurePath),
+			zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	valueType := latest.ValueType
+
+	predicate := &ValuePredicate{}
+	if filter.GreaterThan != "" || filter.LessThan != "" {
+		if valueType != "number" {
+			return nil, fmt.Errorf("%w: value_gt and value_lt need a numeric feature, %s holds %s values",
+				ErrInvalidValuePredicate, featurePath, valueType)
+		}
+		if predicate.GreaterThan, err = parseBound("value_gt", filter.GreaterThan); err != nil {
+			return nil, err
+		}
+		if predicate.LessThan, err = parseBound("value_lt", filter.LessThan); err != nil {
+			return nil, err
+		}
+	}
+
+	if filter.Equal != "" {
+		switch valueType {
+		case "number":
+			value, err := strconv.ParseFloat(filter.Equal, 64)
+			if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+				return nil, fmt.Errorf("%w: value_eq must be a number", ErrInvalidValuePredicate)
+			}
+			predicate.Equal = value
+		case "boolean":
+			value, err := strconv.ParseBool(filter.Equal)
+			if err != nil {
+				return nil, fmt.Errorf("%w: value_eq must be true or false", ErrInvalidValuePredicate)
+			}
+			predicate.Equal = value
+		case "string":
+			predicate.Equal = filter.Equal
+		default:
+			return nil, fmt.Errorf("%w: value_eq is not supported for %s values", ErrInvalidValuePredicate, valueType)
+		}
+	}
+
+	if valueType == "number" {
+		calibrations, err := s.queryCalibrations(twinID, featurePath)
+		if err != nil {
+			return nil, err
+		}
+		if len(calibrations) > 0 {
+			return nil, fmt.Errorf("%w: feature %s is calibrated on read", ErrInvalidValuePredicate, featurePath)
+		}
+	}
+
+	return predicate, nil
+}
+
+// parseBound parses an optional numeric bound of a value filter
+func parseBound(name, raw string) (*float64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidValuePredicate, name)
+	}
+	return &value, nil
+}
+
+// valuePredicateKey identifies a value predicate in query cache keys
+func valuePredicateKey(predicate *ValuePredicate) string {
+	if predicate == nil {
+		return ""
+	}
+	key := ""
+	if predicate.GreaterThan != nil {
+		key += fmt.Sprintf("gt=%v;", *predicate.GreaterThan)
+	}
+	if predicate.LessThan != nil {
+		key += fmt.Sprintf("lt=%v;", *predicate.LessThan)
+	}
+	if predicate.Equal != nil {
+		key += fmt.Sprintf("eq=%T:%v", predicate.Equal, predicate.Equal)
+	}
+	return key
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"go.uber.org/zap"
+)
+
+// catalogTouchInterval is how often the last-seen time of a feature receiving values of an
+// unchanged type is written to the feature catalog
+const catalogTouchInterval = time.Minute
+
+// catalogKey identifies a feature catalog entry
+type catalogKey struct {
+	thingID     string
+	featurePath string
+}
+
+// catalogState is the feature catalog entry as last recorded by the service
+type catalogState struct {
+	valueType string
+	lastSeen  time.Time
+	written   time.Time
+}
+
+// recordCatalog updates the feature catalog entry of the stored points' feature. Writes are
+// skipped while the feature keeps its value type and was recorded within the touch interval;
+// failures are logged, as the catalog can be rebuilt from the data.
+func (s *IngestService) recordCatalog(thingID, featureID string, points []models.TimeseriesData, now time.Time) {
+	latest := &points[0]
+	for i := range points {
+		if points[i].Time.After(latest.Time) {
+			latest = &points[i]
+		}
+	}
+
+	key := catalogKey{thingID: thingID, featurePath: featureID}
+	s.mutex.Lock()
+	state, ok := s.catalog[key]
+	s.mutex.Unlock()
+	if ok && (state.valueType == latest.ValueType || !latest.Time.After(state.lastSeen)) &&
+		now.Sub(state.written) < catalogTouchInterval {
+		return
+	}
+
+	entry := models.FeatureCatalogEntry{
+		TwinID:      thingID,
+		FeaturePath: featureID,
+		ValueType:   latest.ValueType,
+		LastSeen:    latest.Time,
+		UpdatedAt:   now,
+	}
+	if err := s.timeseriesRepo.UpsertFeatureCatalog([]models.FeatureCatalogEntry{entry}); err != nil {
+		s.logger.Warn("Failed to update feature catalog",
+			zap.String("thingId", thingID),
+			zap.String("featureId", featureID),
+			zap.Error(err))
+		return
+	}
+
+	if ok && state.lastSeen.After(latest.Time) {
+		entry.LastSeen, entry.ValueType = state.lastSeen, state.valueType
+	}
+	s.mutex.Lock()
+	s.catalog[key] = catalogState{valueType: entry.ValueType, lastSeen: entry.LastSeen, written: now}
+	s.mutex.Unlock()
+}
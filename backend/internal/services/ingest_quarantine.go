@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrQuarantinedPointNotFound is returned when a quarantined point does not exist or belongs to another twin
+var ErrQuarantinedPointNotFound = errors.New("quarantined point not found")
+
+// PlausibleRangeViolation returns why a numeric point is outside the plausible range of its
+// feature binding, or "" if it is within it. Points of other types are not checked.
+func PlausibleRangeViolation(point *models.TimeseriesData, binding *models.FeatureBinding) string {
+	if binding == nil || point.ValueType != "number" {
+		return ""
+	}
+	format := func(value float64) string { return strconv.FormatFloat(value, 'g', -1, 64) }
+	if binding.PlausibleMin != nil && point.ValueNum < *binding.PlausibleMin {
+		return fmt.Sprintf("value %s is below the plausible minimum %s", format(point.ValueNum), format(*binding.PlausibleMin))
+	}
+	if binding.PlausibleMax != nil && point.ValueNum > *binding.PlausibleMax {
+		return fmt.Sprintf("value %s is above the plausible maximum %s", format(point.ValueNum), format(*binding.PlausibleMax))
+	}
+	return ""
+}
+
+// quarantineImplausible moves the points outside the binding's plausible range to quarantine,
+// returning the points to store. Quarantined points are kept out of the series, so they reach
+// neither charts, aggregates nor ML alerts.
+func (s *IngestService) quarantineImplausible(binding *models.FeatureBinding, points []models.TimeseriesData) ([]models.TimeseriesData, error) {
+	if binding == nil || (binding.PlausibleMin == nil && binding.PlausibleMax == nil) {
+		return points, nil
+	}
+
+	now := time.Now()
+	kept := points[:0]
+	var quarantined []models.QuarantinedPoint
+	for _, point := range points {
+		reason := PlausibleRangeViolation(&point, binding)
+		if reason == "" {
+			kept = append(kept, point)
+			continue
+		}
+		quarantined = append(quarantined, models.QuarantinedPoint{
+			Time:          point.Time,
+			TwinID:        point.TwinID,
+			FeaturePath:   point.FeaturePath,
+			ValueNum:      point.ValueNum,
+			Source:        point.Source,
+			Reason:        reason,
+			QuarantinedAt: now,
+		})
+	}
+	if len(quarantined) == 0 {
+		return kept, nil
+	}
+
+	if err := s.timeseriesRepo.InsertQuarantinedPoints(quarantined); err != nil {
+		return nil, fmt.Errorf("failed to quarantine implausible values: %w", err)
+	}
+	if err := s.twinRepo.IncrementQuarantinedPoints(binding.ID, int64(len(quarantined))); err != nil {
+		s.logger.Warn("Failed to count quarantined values",
+			zap.String("thingId", quarantined[0].TwinID),
+			zap.String("featureId", binding.FeaturePath),
+			zap.Error(err))
+	}
+	s.logger.Debug("Quarantined implausible values",
+		zap.String("thingId", quarantined[0].TwinID),
+		zap.String("featureId", binding.FeaturePath),
+		zap.Int("count", len(quarantined)))
+
+	return kept, nil
+}
+
+// samplesPayload rebuilds a backfill array from the points kept of it, in the array schema of
+// the feature binding
+func samplesPayload(binding *models.FeatureBinding, points []models.TimeseriesData) json.RawMessage {
+	timeField, valueField := defaultArrayTimeField, defaultArrayValueField
+	if binding.ArrayTimeField != "" {
+		timeField = binding.ArrayTimeField
+	}
+	if binding.ArrayValueField != "" {
+		valueField = binding.ArrayValueField
+	}
+
+	samples := make([]map[string]interface{}, 0, len(points))
+	for _, point := range points {
+		samples = append(samples, map[string]interface{}{
+			timeField:  point.Time.UTC().Format(time.RFC3339Nano),
+			valueField: pointData(point),
+		})
+	}
+	data, _ := json.Marshal(samples)
+	return data
+}
+
+// QuarantineReview is a page of the quarantined points of a twin, with the number of points
+// quarantined per feature
+type QuarantineReview struct {
+	Points []models.QuarantinedPoint    `json:"data"`
+	Total  int64                        `json:"total"`
+	Counts []repository.QuarantineCount `json:"counts"`
+}
+
+// QuarantineService lets users review the values quarantined during ingestion, releasing
+// those that were plausible after all into the time series and discarding the others
+type QuarantineService struct {
+	logger         *utils.Logger
+	twinRepo       repository.TwinRepository
+	timeseriesRepo repository.TimeseriesRepository
+}
+
+// NewQuarantineService creates a new quarantine service
+func NewQuarantineService(db *db.Database, logger *utils.Logger) *QuarantineService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &QuarantineService{
+		logger:         logger.Named("quarantine_service"),
+		twinRepo:       repoFactory.Twin(),
+		timeseriesRepo: repoFactory.Timeseries(),
+	}
+}
+
+// List returns a page of the quarantined points of a twin, newest first
+func (s *QuarantineService) List(ctx context.Context, twin *models.Twin, filter repository.QuarantineFilter) (*QuarantineReview, error) {
+	points, total, err := s.timeseriesRepo.ListQuarantinedPoints(ctx, twin.DittoID, filter)
+	if err != nil {
+		s.logger.Error("Failed to list quarantined points", zap.Uint("twin_id", twin.ID), zap.Error(err))
+		return nil, errors.New("failed to retrieve quarantined points")
+	}
+	counts, err := s.timeseriesRepo.CountQuarantinedPoints(ctx, twin.DittoID)
+	if err != nil {
+		s.logger.Error("Failed to count quarantined points", zap.Uint("twin_id", twin.ID), zap.Error(err))
+		return nil, errors.New("failed to retrieve quarantined points")
+	}
+	return &QuarantineReview{Points: points, Total: total, Counts: counts}, nil
+}
+
+// Release stores a quarantined point of a twin in its time series, rounded to the precision
+// of the feature's binding, and returns the stored point
+func (s *QuarantineService) Release(twin *models.Twin, id uint) (*models.TimeseriesData, error) {
+	quarantined, err := s.timeseriesRepo.GetQuarantinedPoint(twin.DittoID, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrQuarantinedPointNotFound
+		}
+		s.logger.Error("Failed to get quarantined point", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	point := &models.TimeseriesData{
+		Time:        quarantined.Time,
+		TwinID:      quarantined.TwinID,
+		FeaturePath: quarantined.FeaturePath,
+		ValueType:   "number",
+		ValueNum:    quarantined.ValueNum,
+		Source:      quarantined.Source,
+	}
+	binding, err := s.twinRepo.GetFeatureBinding(twin.ID, quarantined.FeaturePath)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.Error("Failed to get feature binding", zap.Uint("twin_id", twin.ID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	if err == nil {
+		ApplyPrecision(point, binding)
+	}
+
+	if err := s.timeseriesRepo.ReleaseQuarantinedPoint(id, point); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrQuarantinedPointNotFound
+		}
+		s.logger.Error("Failed to release quarantined point", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("failed to release quarantined point")
+	}
+
+	s.logger.Info("Released quarantined point",
+		zap.Uint("twin_id", twin.ID),
+		zap.String("feature_path", point.FeaturePath),
+		zap.Time("time", point.Time))
+	return point, nil
+}
+
+// Discard deletes a quarantined point of a twin
+func (s *QuarantineService) Discard(twin *models.Twin, id uint) error {
+	if err := s.timeseriesRepo.DeleteQuarantinedPoint(twin.DittoID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrQuarantinedPointNotFound
+		}
+		s.logger.Error("Failed to discard quarantined point", zap.Uint("id", id), zap.Error(err))
+		return errors.New("failed to discard quarantined point")
+	}
+	return nil
+}
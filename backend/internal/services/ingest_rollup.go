@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"go.uber.org/zap"
+)
+
+// maxRollupWindow is the longest rollup window a feature binding may set, in seconds
+const maxRollupWindow = 3600
+
+// defaultRollupFlushInterval is how often ended rollup windows are stored when none is configured
+const defaultRollupFlushInterval = 5 * time.Second
+
+// RollupSummary is the value_json of a rolled-up point. The extremes are kept with the time
+// they were sampled at, so peaks survive the rollup.
+type RollupSummary struct {
+	Min     float64   `json:"min"`
+	MinTime time.Time `json:"min_time"`
+	Max     float64   `json:"max"`
+	MaxTime time.Time `json:"max_time"`
+	Avg     float64   `json:"avg"`
+	Count   int       `json:"count"`
+	// Last is the latest sample of the window, if the binding keeps it
+	Last *float64 `json:"last,omitempty"`
+}
+
+// RollupAccumulator collects the numeric samples of a feature within one window
+type RollupAccumulator struct {
+	start    time.Time
+	window   time.Duration
+	keepLast bool
+	point    models.TimeseriesData
+
+	sum      float64
+	summary  RollupSummary
+	last     float64
+	lastTime time.Time
+}
+
+// NewRollupAccumulator starts the window containing the sample, aligned to multiples of the window length
+func NewRollupAccumulator(sample models.TimeseriesData, window time.Duration, keepLast bool) *RollupAccumulator {
+	start := sample.Time.Truncate(window)
+	a := &RollupAccumulator{
+		start:    start,
+		window:   window,
+		keepLast: keepLast,
+		point: models.TimeseriesData{
+			Time:        start,
+			TwinID:      sample.TwinID,
+			FeaturePath: sample.FeaturePath,
+			ValueType:   "number",
+			Source:      sample.Source,
+		},
+	}
+	a.Add(sample)
+	return a
+}
+
+// Covers reports whether a time falls within the window
+func (a *RollupAccumulator) Covers(t time.Time) bool {
+	return !t.Before(a.start) && t.Before(a.End())
+}
+
+// End returns the end of the window
+func (a *RollupAccumulator) End() time.Time {
+	return a.start.Add(a.window)
+}
+
+// Add includes a numeric sample within the window
+func (a *RollupAccumulator) Add(sample models.TimeseriesData) {
+	value := sample.ValueNum
+	if a.summary.Count == 0 || value < a.summary.Min {
+		a.summary.Min = value
+		a.summary.MinTime = sample.Time
+	}
+	if a.summary.Count == 0 || value > a.summary.Max {
+		a.summary.Max = value
+		a.summary.MaxTime = sample.Time
+	}
+	if a.summary.Count == 0 || !sample.Time.Before(a.lastTime) {
+		a.last = value
+		a.lastTime = sample.Time
+	}
+	a.sum += value
+	a.summary.Count++
+}
+
+// Summary returns the rollup of the samples added so far
+func (a *RollupAccumulator) Summary() RollupSummary {
+	summary := a.summary
+	summary.Avg = a.sum / float64(summary.Count)
+	if a.keepLast {
+		last := a.last
+		summary.Last = &last
+	}
+	return summary
+}
+
+// Point returns the rolled-up point of the window: its value is the average, and its
+// value_json holds the full summary
+func (a *RollupAccumulator) Point() models.TimeseriesData {
+	summary := a.Summary()
+	point := a.point
+	point.ValueNum = summary.Avg
+	if data, err := json.Marshal(summary); err == nil {
+		point.ValueJSON = string(data)
+	}
+	return point
+}
+
+// rollupKey identifies the open rollup window of a twin feature
+type rollupKey struct {
+	twinID      string
+	featurePath string
+}
+
+// rollup adds the numeric points of a rolled-up feature to its open window. It returns the
+// points to store now: the rollups of windows the points moved past, and the points that
+// cannot be rolled up, which are stored as received. Non-numeric values and samples from
+// before the open window, whose rollup may already be stored, are kept raw.
+func (s *IngestService) rollup(binding *models.FeatureBinding, points []models.TimeseriesData) []models.TimeseriesData {
+	window := time.Duration(binding.RollupWindow) * time.Second
+	var store []models.TimeseriesData
+
+	s.rollupMutex.Lock()
+	defer s.rollupMutex.Unlock()
+
+	for _, point := range points {
+		if point.ValueType != "number" {
+			store = append(store, point)
+			continue
+		}
+
+		key := rollupKey{twinID: point.TwinID, featurePath: point.FeaturePath}
+		open, ok := s.rollups[key]
+		switch {
+		case !ok:
+			s.rollups[key] = NewRollupAccumulator(point, window, binding.RollupKeepLast)
+		case open.Covers(point.Time):
+			open.Add(point)
+		case point.Time.Before(open.start):
+			store = append(store, point)
+		default:
+			store = append(store, open.Point())
+			s.rollups[key] = NewRollupAccumulator(point, window, binding.RollupKeepLast)
+		}
+	}
+
+	return store
+}
+
+// FlushRollups stores the rolled-up points of the windows that ended before the given time
+// and returns how many were stored
+func (s *IngestService) FlushRollups(before time.Time) int {
+	s.rollupMutex.Lock()
+	var points []models.TimeseriesData
+	for key, open := range s.rollups {
+		if !open.End().After(before) {
+			points = append(points, open.Point())
+			delete(s.rollups, key)
+		}
+	}
+	s.rollupMutex.Unlock()
+
+	if len(points) == 0 {
+		return 0
+	}
+	if err := s.timeseriesRepo.InsertTimeseriesBatch(points); err != nil {
+		s.logger.Error("Failed to store rolled-up points", zap.Int("points", len(points)), zap.Error(err))
+		return 0
+	}
+	return len(points)
+}
+
+// newRollupFlusher creates the worker storing rolled-up points periodically once their window
+// has ended. A window is stored one flush interval after its end, leaving time for samples
+// delivered late.
+func newRollupFlusher(s *IngestService) *lifecycle.ScheduledWorker {
+	interval := time.Duration(s.limits.RollupFlushInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultRollupFlushInterval
+	}
+	return lifecycle.NewScheduledWorker("ingest-rollup", interval, func(ctx context.Context) error {
+		s.FlushRollups(time.Now().Add(-interval))
+		return nil
+	})
+}
+
+// Stop stops the periodic flush and stores the open rollup windows
+func (s *IngestService) Stop(ctx context.Context) error {
+	if err := s.ScheduledWorker.Stop(ctx); err != nil {
+		return err
+	}
+
+	s.rollupMutex.Lock()
+	var last time.Time
+	for _, open := range s.rollups {
+		if open.End().After(last) {
+			last = open.End()
+		}
+	}
+	s.rollupMutex.Unlock()
+
+	s.FlushRollups(last)
+	return nil
+}
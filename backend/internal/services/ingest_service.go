@@ -0,0 +1,697 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Time-series sources recorded with ingested values
+const (
+	// SourceDittoWS marks Ditto WebSocket events forwarded by the backend
+	SourceDittoWS = "ditto-ws"
+	// SourceDittoKafka marks values published to the time-series topic by Ditto's Kafka connection
+	SourceDittoKafka = "ditto-kafka"
+	// SourceHTTP marks values pushed to the HTTP ingest endpoint
+	SourceHTTP = "http-ingest"
+	// SourceMQTT marks values published by the MQTT bridge
+	SourceMQTT = "mqtt"
+	// SourceSimulator marks values published by the device simulator
+	SourceSimulator = "simulator"
+	// SourceMLDerived marks values derived from ML outputs
+	SourceMLDerived = "ml-derived"
+)
+
+// validSources holds the sources a time-series point can be recorded from
+var validSources = map[string]bool{
+	SourceDittoWS:    true,
+	SourceDittoKafka: true,
+	SourceHTTP:       true,
+	SourceMQTT:       true,
+	SourceSimulator:  true,
+	SourceMLDerived:  true,
+}
+
+// IsValidSource reports whether source is a known time-series source
+func IsValidSource(source string) bool {
+	return validSources[source]
+}
+
+// ingestRateWindow is the window the ingest rate limit applies to
+const ingestRateWindow = time.Minute
+
+// mlBindingsTTL is how long the ML task bindings of a twin are cached for the ML forward decision
+const mlBindingsTTL = 30 * time.Second
+
+// Ingest limit errors returned by Ingest
+var (
+	ErrIngestRateLimited  = errors.New("ingest rate limit exceeded")
+	ErrIngestFeatureLimit = errors.New("feature limit reached")
+)
+
+// FeatureValue is a value of a twin feature pushed for ingestion
+type FeatureValue struct {
+	FeatureID string
+	Timestamp time.Time
+	Data      json.RawMessage
+	// Sequence is the device's monotonic number of the value within the feature, 0 if unnumbered.
+	// Numbered values at or below the feature's last ingested sequence number are dropped.
+	Sequence uint64
+}
+
+// IngestResult reports the outcome of ingesting feature values
+type IngestResult struct {
+	Stored int `json:"stored"`
+	// Duplicates counts the numbered values dropped as already ingested
+	Duplicates int `json:"duplicates,omitempty"`
+	// Rejected holds the errors of the values that were not stored, by index in the request
+	Rejected []IngestRejection `json:"rejected,omitempty"`
+}
+
+// IngestRejection describes a feature value that was not stored
+type IngestRejection struct {
+	Index     int    `json:"index"`
+	FeatureID string `json:"feature_id"`
+	Error     string `json:"error"`
+	Err       error  `json:"-"`
+}
+
+// IngestService processes feature values of twins, whether they arrive from Kafka
+// or over HTTP: values are stored as time-series data, type policies are applied,
+// ML analysis is requested and the twin's project is notified.
+type IngestService struct {
+	logger              *utils.Logger
+	limits              config.IngestConfig
+	timeseriesRepo      repository.TimeseriesRepository
+	twinRepo            repository.TwinRepository
+	mlRepo              repository.MLRepository
+	projectRepo         repository.ProjectRepository
+	typeViolations      *TypeViolationTracker
+	timestampViolations *TypeViolationTracker // out-of-window timestamps per twin ID
+	timestampCounts     timestampCounters
+	mlTriggers          *MLTriggerGate
+	mlPauses            *MLPauseCache
+	notificationService *NotificationService
+	liveAggregates      *LiveAggregates
+	alertRouting        *AlertRoutingService
+	alertEnricher       *AlertEnricher
+	kafkaManager        kafka.Bus
+
+	mutex    sync.Mutex
+	features map[string]map[string]bool // known feature paths per twin
+	rates    map[string]*ingestRateCounter
+	catalog  map[catalogKey]catalogState // feature catalog entries last recorded
+
+	mlBindingsMutex sync.Mutex
+	mlBindings      map[uint]cachedMLBindings // ML task bindings per twin ID
+
+	rollupMutex sync.Mutex
+	rollups     map[rollupKey]*RollupAccumulator // open rollup window per twin feature
+
+	// The periodic flush of ended rollup windows
+	*lifecycle.ScheduledWorker
+}
+
+// cachedMLBindings holds the ML task bindings of a twin as loaded at a point in time
+type cachedMLBindings struct {
+	loaded   time.Time
+	bindings []models.MLTaskBinding
+}
+
+// ingestRateCounter counts the values accepted for a twin within the current window
+type ingestRateCounter struct {
+	start time.Time
+	count int
+}
+
+// NewIngestService creates a new ingest service; a nil config means no HTTP ingest limits
+func NewIngestService(
+	db *db.Database,
+	cfg *config.IngestConfig,
+	notificationService *NotificationService,
+	logger *utils.Logger,
+) *IngestService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	service := &IngestService{
+		logger:              logger.Named("ingest_service"),
+		timeseriesRepo:      repoFactory.Timeseries(),
+		twinRepo:            repoFactory.Twin(),
+		mlRepo:              repoFactory.ML(),
+		projectRepo:         repoFactory.Project(),
+		typeViolations:      NewTypeViolationTracker(),
+		timestampViolations: NewTypeViolationTracker(),
+		mlTriggers:          NewMLTriggerGate(),
+		mlPauses:            NewMLPauseCache(db, logger),
+		notificationService: notificationService,
+		features:            make(map[string]map[string]bool),
+		rates:               make(map[string]*ingestRateCounter),
+		catalog:             make(map[catalogKey]catalogState),
+		mlBindings:          make(map[uint]cachedMLBindings),
+		rollups:             make(map[rollupKey]*RollupAccumulator),
+	}
+
+	if cfg != nil {
+		service.limits = *cfg
+	}
+	service.ScheduledWorker = newRollupFlusher(service)
+
+	return service
+}
+
+// SetKafkaManager sets the message bus used to forward values for ML analysis
+func (s *IngestService) SetKafkaManager(kafkaManager kafka.Bus) {
+	s.kafkaManager = kafkaManager
+}
+
+// SetMLPauseCache shares the cache of ML pauses, so pauses set through the services it is
+// given to take effect at once
+func (s *IngestService) SetMLPauseCache(cache *MLPauseCache) {
+	s.mlPauses = cache
+}
+
+// SetLiveAggregates updates the live aggregates subscribed to with the values ingested
+func (s *IngestService) SetLiveAggregates(liveAggregates *LiveAggregates) {
+	s.liveAggregates = liveAggregates
+}
+
+// SetAlertRouting delivers the alerts raised during ingestion according to the alert routes,
+// instead of only pushing them to the project's websocket clients
+func (s *IngestService) SetAlertRouting(alertRouting *AlertRoutingService) {
+	s.alertRouting = alertRouting
+}
+
+// SetAlertEnricher stores a snapshot of the twin's recent data on the alerts raised during ingestion
+func (s *IngestService) SetAlertEnricher(alertEnricher *AlertEnricher) {
+	s.alertEnricher = alertEnricher
+}
+
+// Ingest stores feature values pushed for a twin over HTTP. The batch size, feature
+// cardinality and rate limits apply to the request as a whole; values failing the
+// feature's type policy are reported in the result without failing the others.
+func (s *IngestService) Ingest(twin *models.Twin, values []FeatureValue) (*IngestResult, error) {
+	if len(values) == 0 {
+		return nil, errors.New("no values to ingest")
+	}
+
+	if s.limits.MaxBatchSize > 0 && len(values) > s.limits.MaxBatchSize {
+		return nil, fmt.Errorf("batch of %d values exceeds the limit of %d", len(values), s.limits.MaxBatchSize)
+	}
+
+	for i, value := range values {
+		if value.FeatureID == "" {
+			return nil, fmt.Errorf("feature is required for value %d", i)
+		}
+		if len(value.Data) == 0 {
+			return nil, fmt.Errorf("value is required for value %d", i)
+		}
+	}
+
+	if err := s.admitFeatures(twin.DittoID, values); err != nil {
+		return nil, err
+	}
+
+	if !s.admitRate(twin.DittoID, len(values), time.Now()) {
+		return nil, ErrIngestRateLimited
+	}
+
+	result := &IngestResult{}
+	for i, value := range values {
+		stored, duplicate, err := s.ingestValue(twin, value)
+		if err != nil {
+			result.Rejected = append(result.Rejected, IngestRejection{
+				Index:     i,
+				FeatureID: value.FeatureID,
+				Error:     err.Error(),
+				Err:       err,
+			})
+			continue
+		}
+		if duplicate {
+			result.Duplicates++
+		}
+		result.Stored += stored
+	}
+
+	return result, nil
+}
+
+// ingestValue processes a value pushed for a twin, reporting whether it was dropped as a
+// duplicate of a numbered value already ingested
+func (s *IngestService) ingestValue(twin *models.Twin, value FeatureValue) (int, bool, error) {
+	timestamp := value.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	if value.Sequence == 0 {
+		stored, err := s.process(twin, twin.DittoID, value.FeatureID, timestamp, value.Data, SourceHTTP)
+		return stored, false, err
+	}
+
+	previous, fresh, err := s.claimSequence(twin, value)
+	if err != nil {
+		return 0, false, err
+	}
+	if !fresh {
+		return 0, true, nil
+	}
+	stored, err := s.process(twin, twin.DittoID, value.FeatureID, timestamp, value.Data, SourceHTTP)
+	if err != nil {
+		s.releaseSequence(twin, value, previous)
+	}
+	return stored, false, err
+}
+
+// claimSequence advances the feature's last ingested sequence number to the value's, returning
+// the previous one and whether the value is new
+func (s *IngestService) claimSequence(twin *models.Twin, value FeatureValue) (uint64, bool, error) {
+	previous, err := s.twinRepo.GetIngestSequence(twin.ID, value.FeatureID)
+	if err != nil {
+		s.logger.Error("Failed to get ingest sequence", zap.Uint("twin_id", twin.ID), zap.String("featureId", value.FeatureID), zap.Error(err))
+		return 0, false, errors.New("database error")
+	}
+	if value.Sequence <= previous {
+		return previous, false, nil
+	}
+
+	fresh, err := s.twinRepo.AdvanceIngestSequence(twin.ID, value.FeatureID, value.Sequence)
+	if err != nil {
+		s.logger.Error("Failed to advance ingest sequence", zap.Uint("twin_id", twin.ID), zap.String("featureId", value.FeatureID), zap.Error(err))
+		return 0, false, errors.New("database error")
+	}
+	return previous, fresh, nil
+}
+
+// releaseSequence reverts a claimed sequence number of a value that was not stored, so the
+// device may resend it
+func (s *IngestService) releaseSequence(twin *models.Twin, value FeatureValue, previous uint64) {
+	if err := s.twinRepo.RevertIngestSequence(twin.ID, value.FeatureID, value.Sequence, previous); err != nil {
+		s.logger.Error("Failed to revert ingest sequence", zap.Uint("twin_id", twin.ID), zap.String("featureId", value.FeatureID), zap.Error(err))
+	}
+}
+
+// ProcessFeatureValue stores a feature value received for a Ditto thing and returns
+// the number of stored points
+func (s *IngestService) ProcessFeatureValue(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) (int, error) {
+	twin, err := s.twinRepo.GetByDittoID(thingID)
+	if err != nil {
+		twin = nil
+	}
+	return s.process(twin, thingID, featureID, timestamp, data, source)
+}
+
+// ProcessFeatureValues stores the feature values a message was transformed into and returns
+// the number of stored points. All values are checked before any is stored, so a message
+// rejected for one of its values stores none and can be retried without duplicating the others.
+func (s *IngestService) ProcessFeatureValues(thingID string, values []FeatureValue, source string) (int, error) {
+	twin, err := s.twinRepo.GetByDittoID(thingID)
+	if err != nil {
+		twin = nil
+	}
+	if err := s.checkFeatureValues(twin, thingID, values, time.Now()); err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	for _, value := range values {
+		n, err := s.process(twin, thingID, value.FeatureID, value.Timestamp, value.Data, source)
+		stored += n
+		if err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
+
+// checkFeatureValues returns the error the timestamp or type policy would reject one of the
+// values with, without recording violations
+func (s *IngestService) checkFeatureValues(twin *models.Twin, thingID string, values []FeatureValue, now time.Time) error {
+	for _, value := range values {
+		binding := s.getFeatureBinding(twin, value.FeatureID)
+		points := ParseTimeseriesPayload(thingID, value.FeatureID, value.Timestamp, value.Data, binding)
+		if err := s.rejectsTimestamps(twin, points, now); err != nil {
+			return err
+		}
+		if binding == nil || binding.ExpectedType == "" {
+			continue
+		}
+		for _, point := range points {
+			if _, _, err := ApplyTypePolicy(&point, binding); err != nil {
+				return typeRejection(binding, err)
+			}
+		}
+	}
+	return nil
+}
+
+// process runs a feature value through the ingestion pipeline. The twin is nil
+// when the thing is not known to the backend yet.
+func (s *IngestService) process(twin *models.Twin, thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) (int, error) {
+	// Expand backfill arrays according to the feature binding, if any
+	binding := s.getFeatureBinding(twin, featureID)
+	points := ParseTimeseriesPayload(thingID, featureID, timestamp, data, binding)
+	for i := range points {
+		points[i].Source = source
+	}
+
+	// Apply the project's policy to points timestamped too far in the future or the past
+	if err := s.checkTimestamps(twin, points, time.Now()); err != nil {
+		return 0, err
+	}
+
+	// Enforce the expected feature type before storing
+	points, err := s.enforceFeatureType(twin, binding, points)
+	if err != nil {
+		return 0, err
+	}
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	// Correct numeric values with the binding's calibration, if it is applied before storing
+	for i := range points {
+		ApplyCalibration(&points[i], binding)
+	}
+
+	// Hold back values outside the binding's plausible range for review
+	parsed := len(points)
+	points, err = s.quarantineImplausible(binding, points)
+	if err != nil {
+		return 0, err
+	}
+	if len(points) == 0 {
+		return 0, nil
+	}
+
+	// Round the values to the binding's precision
+	for i := range points {
+		ApplyPrecision(&points[i], binding)
+	}
+
+	// ML is only sent the samples that were kept, never the quarantined ones
+	if len(points) < parsed {
+		data = samplesPayload(binding, points)
+	}
+
+	// Rolled-up features store one point per window instead of every sample
+	store := points
+	if binding != nil && binding.RollupWindow > 0 {
+		store = s.rollup(binding, points)
+	}
+
+	// Store time-series data in TimescaleDB
+	if len(store) == 1 {
+		if err := s.timeseriesRepo.InsertTimeseriesData(&store[0]); err != nil {
+			return 0, fmt.Errorf("failed to store time-series data: %w", err)
+		}
+	} else if len(store) > 1 {
+		if err := s.timeseriesRepo.InsertTimeseriesBatch(store); err != nil {
+			return 0, fmt.Errorf("failed to store time-series batch: %w", err)
+		}
+	}
+	s.rememberFeature(thingID, featureID)
+	s.recordCatalog(thingID, featureID, points, time.Now())
+
+	// Live aggregates follow every sample, even of rolled-up features
+	if s.liveAggregates != nil {
+		s.liveAggregates.Add(points)
+	}
+
+	// Forward to the ML tasks bound to the feature whose trigger admits the value, unless paused
+	if s.kafkaManager != nil && twin != nil && !s.mlPaused(twin, time.Now()) {
+		s.forwardToML(twin, thingID, featureID, timestamp, data, &points[len(points)-1])
+	}
+
+	if twin != nil && s.notificationService != nil {
+		s.notificationService.NotifyProject(twin.ProjectID, NotificationTypeTwinUpdate, "twins/"+thingID, map[string]interface{}{
+			"thingId":   thingID,
+			"featureId": featureID,
+			"values":    points,
+		})
+	}
+
+	return len(points), nil
+}
+
+// enforceFeatureType applies the binding's type policy to each point, returning the points to store.
+// Violations are counted on the binding and raise an alert when they spike.
+func (s *IngestService) enforceFeatureType(twin *models.Twin, binding *models.FeatureBinding, points []models.TimeseriesData) ([]models.TimeseriesData, error) {
+	if binding == nil || binding.ExpectedType == "" {
+		return points, nil
+	}
+
+	kept := points[:0]
+	violations := 0
+	var rejectErr error
+	for i := range points {
+		store, violation, err := ApplyTypePolicy(&points[i], binding)
+		if violation {
+			violations++
+		}
+		if err != nil {
+			rejectErr = err
+			break
+		}
+		if store {
+			kept = append(kept, points[i])
+		}
+	}
+
+	if violations > 0 {
+		s.recordTypeViolations(twin, binding, points[0].TwinID, violations)
+	}
+
+	if rejectErr != nil {
+		return nil, typeRejection(binding, rejectErr)
+	}
+
+	return kept, nil
+}
+
+// typeRejection returns the error of a value the binding's type policy rejected
+func typeRejection(binding *models.FeatureBinding, err error) error {
+	return fmt.Errorf("feature %s expects %s values: %w", binding.FeaturePath, binding.ExpectedType, err)
+}
+
+// recordTypeViolations persists the violation count and alerts when the per-minute threshold is reached
+func (s *IngestService) recordTypeViolations(twin *models.Twin, binding *models.FeatureBinding, thingID string, violations int) {
+	if err := s.twinRepo.IncrementTypeViolations(binding.ID, int64(violations)); err != nil {
+		s.logger.Warn("Failed to record type violations",
+			zap.String("thingId", thingID),
+			zap.String("featureId", binding.FeaturePath),
+			zap.Error(err))
+	}
+
+	now := time.Now()
+	count := s.typeViolations.Record(binding.ID, violations, binding.ViolationAlertThreshold, now)
+	if count == 0 {
+		return
+	}
+
+	alertData := &models.AlertData{
+		Time:        now,
+		AlertID:     fmt.Sprintf("%s-type-%d", thingID, now.UnixNano()),
+		TwinID:      thingID,
+		FeaturePath: binding.FeaturePath,
+		Severity:    "warning",
+		Message: fmt.Sprintf("%d values within %s did not match expected type %s",
+			count, typeViolationWindow, binding.ExpectedType),
+		Source: "ingest",
+	}
+
+	s.enrichAlert(alertData)
+	if err := s.timeseriesRepo.InsertAlertData(alertData); err != nil {
+		s.logger.Error("Failed to store type violation alert",
+			zap.String("thingId", thingID),
+			zap.String("featureId", binding.FeaturePath),
+			zap.Error(err))
+		return
+	}
+
+	s.notifyAlert(twin, thingID, alertData)
+}
+
+// enrichAlert captures the context of an alert raised during ingestion, if enrichment is configured
+func (s *IngestService) enrichAlert(alertData *models.AlertData) {
+	if s.alertEnricher != nil {
+		s.alertEnricher.Enrich(context.Background(), alertData)
+	}
+}
+
+// notifyAlert delivers a stored alert of a twin along its alert route, or pushes it to the
+// project's websocket clients without alert routing
+func (s *IngestService) notifyAlert(twin *models.Twin, thingID string, alertData *models.AlertData) {
+	if twin == nil {
+		return
+	}
+	if s.alertRouting != nil {
+		if _, err := s.alertRouting.Route(twin, alertData); err != nil {
+			s.logger.Error("Failed to deliver alert", zap.String("thingId", thingID), zap.Error(err))
+		}
+		return
+	}
+	if s.notificationService != nil {
+		s.notificationService.NotifyProject(twin.ProjectID, NotificationTypeAlert, "twins/"+thingID, alertData)
+	}
+}
+
+// getFeatureBinding returns the ingestion settings for a twin feature, or nil if none are configured
+func (s *IngestService) getFeatureBinding(twin *models.Twin, featureID string) *models.FeatureBinding {
+	if twin == nil {
+		return nil
+	}
+
+	binding, err := s.twinRepo.GetFeatureBinding(twin.ID, featureID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			s.logger.Warn("Failed to load feature binding",
+				zap.String("thingId", twin.DittoID),
+				zap.String("featureId", featureID),
+				zap.Error(err))
+		}
+		return nil
+	}
+
+	return binding
+}
+
+// admitFeatures rejects values that would take a twin past the feature cardinality limit
+func (s *IngestService) admitFeatures(thingID string, values []FeatureValue) error {
+	if s.limits.MaxFeaturesPerTwin <= 0 {
+		return nil
+	}
+
+	known, err := s.knownFeatures(thingID)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	added := make(map[string]bool)
+	for _, value := range values {
+		if !known[value.FeatureID] {
+			added[value.FeatureID] = true
+		}
+	}
+
+	if len(known)+len(added) > s.limits.MaxFeaturesPerTwin {
+		return fmt.Errorf("%w: twin %s may record at most %d features", ErrIngestFeatureLimit, thingID, s.limits.MaxFeaturesPerTwin)
+	}
+	return nil
+}
+
+// knownFeatures returns the feature paths recorded for a twin, loading them on first use
+func (s *IngestService) knownFeatures(thingID string) (map[string]bool, error) {
+	s.mutex.Lock()
+	known, ok := s.features[thingID]
+	s.mutex.Unlock()
+	if ok {
+		return known, nil
+	}
+
+	featurePaths, err := s.timeseriesRepo.ListFeaturePaths(thingID)
+	if err != nil {
+		s.logger.Error("Failed to list twin features", zap.String("thingId", thingID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if known, ok := s.features[thingID]; ok {
+		return known, nil
+	}
+	known = make(map[string]bool, len(featurePaths))
+	for _, featurePath := range featurePaths {
+		known[featurePath] = true
+	}
+	s.features[thingID] = known
+	return known, nil
+}
+
+// rememberFeature records that a twin has data for a feature path
+func (s *IngestService) rememberFeature(thingID, featureID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if known, ok := s.features[thingID]; ok {
+		known[featureID] = true
+	}
+}
+
+// admitRate counts values against the twin's rate limit and reports whether they are accepted
+func (s *IngestService) admitRate(thingID string, values int, now time.Time) bool {
+	if s.limits.RateLimit <= 0 {
+		return true
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counter, ok := s.rates[thingID]
+	if !ok || now.Sub(counter.start) >= ingestRateWindow {
+		counter = &ingestRateCounter{start: now}
+		s.rates[thingID] = counter
+	}
+
+	if counter.count+values > s.limits.RateLimit {
+		return false
+	}
+	counter.count += values
+	return true
+}
+
+// forwardToML sends a feature value to each ML task bound to the feature on the twin,
+// skipping tasks whose trigger config does not admit the value
+func (s *IngestService) forwardToML(twin *models.Twin, thingID, featureID string, timestamp time.Time, data json.RawMessage, latest *models.TimeseriesData) {
+	now := time.Now()
+	for _, binding := range s.getMLBindings(twin.ID, now) {
+		if !BindingCoversFeature(&binding, featureID) || !s.mlTriggers.Admit(&binding, thingID, featureID, latest, now) {
+			continue
+		}
+
+		mlInput := map[string]interface{}{
+			"thingId":   thingID,
+			"featureId": featureID,
+			"timestamp": timestamp,
+			"data":      data,
+		}
+		if err := s.kafkaManager.ProduceMLInput(binding.Task.ModelID, mlInput); err != nil {
+			s.logger.Error("Failed to send data to ML service",
+				zap.String("thingId", thingID),
+				zap.String("featureId", featureID),
+				zap.String("modelId", binding.Task.ModelID),
+				zap.Error(err))
+		}
+	}
+}
+
+// getMLBindings returns the ML task bindings of a twin, reloading them once the cached copy expires
+func (s *IngestService) getMLBindings(twinID uint, now time.Time) []models.MLTaskBinding {
+	s.mlBindingsMutex.Lock()
+	defer s.mlBindingsMutex.Unlock()
+
+	if cached, ok := s.mlBindings[twinID]; ok && now.Sub(cached.loaded) < mlBindingsTTL {
+		return cached.bindings
+	}
+
+	bindings, err := s.mlRepo.ListMLTaskBindingsByTwinID(twinID)
+	if err != nil {
+		s.logger.Error("Failed to list ML task bindings", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil
+	}
+	s.mlBindings[twinID] = cachedMLBindings{loaded: now, bindings: bindings}
+	return bindings
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"go.uber.org/zap"
+)
+
+// ErrTimestampOutOfRange is returned for values rejected because a point is timestamped
+// too far in the future or the past
+var ErrTimestampOutOfRange = errors.New("timestamp outside the accepted window")
+
+// validTimestampPolicies holds the policies a project may set for out-of-window timestamps
+var validTimestampPolicies = map[string]bool{
+	models.TimestampPolicyAccept: true,
+	models.TimestampPolicyReject: true,
+	models.TimestampPolicyClamp:  true,
+}
+
+// IsValidTimestampPolicy reports whether policy is a known timestamp policy
+func IsValidTimestampPolicy(policy string) bool {
+	return validTimestampPolicies[policy]
+}
+
+// TimestampStats counts the ingested points timestamped outside the accepted window
+type TimestampStats struct {
+	// Future is the number of points timestamped beyond the maximum future skew
+	Future int64 `json:"future"`
+	// Late is the number of points timestamped before the maximum lateness
+	Late int64 `json:"late"`
+	// Rejected is the number of those points whose value was rejected
+	Rejected int64 `json:"rejected"`
+	// Clamped is the number of those points moved into the window
+	Clamped int64 `json:"clamped"`
+}
+
+// timestampCounters holds the counts reported by TimestampStats
+type timestampCounters struct {
+	future   atomic.Int64
+	late     atomic.Int64
+	rejected atomic.Int64
+	clamped  atomic.Int64
+}
+
+// TimestampStats returns the counts of out-of-window points ingested since startup
+func (s *IngestService) TimestampStats() TimestampStats {
+	return TimestampStats{
+		Future:   s.timestampCounts.future.Load(),
+		Late:     s.timestampCounts.late.Load(),
+		Rejected: s.timestampCounts.rejected.Load(),
+		Clamped:  s.timestampCounts.clamped.Load(),
+	}
+}
+
+// checkTimestamps applies the timestamp policy to points timestamped beyond the maximum
+// future skew or before the maximum lateness. Clamped points are moved in place; if the
+// policy rejects them, an error wrapping ErrTimestampOutOfRange is returned.
+func (s *IngestService) checkTimestamps(twin *models.Twin, points []models.TimeseriesData, now time.Time) error {
+	latest, earliest := s.timestampWindow(now)
+	future, late := countOutOfWindow(points, latest, earliest)
+	if future == 0 && late == 0 {
+		return nil
+	}
+
+	s.timestampCounts.future.Add(int64(future))
+	s.timestampCounts.late.Add(int64(late))
+	s.recordTimestampViolations(twin, points[0].TwinID, future+late, now)
+
+	switch s.timestampPolicy(twin) {
+	case models.TimestampPolicyReject:
+		s.timestampCounts.rejected.Add(int64(future + late))
+		return s.timestampRejection(future)
+	case models.TimestampPolicyClamp:
+		s.timestampCounts.clamped.Add(int64(future + late))
+		for i := range points {
+			switch {
+			case !latest.IsZero() && points[i].Time.After(latest):
+				points[i].Time = latest
+			case !earliest.IsZero() && points[i].Time.Before(earliest):
+				points[i].Time = earliest
+			}
+		}
+	}
+	return nil
+}
+
+// rejectsTimestamps reports the error checkTimestamps would return for points, without
+// counting or recording them
+func (s *IngestService) rejectsTimestamps(twin *models.Twin, points []models.TimeseriesData, now time.Time) error {
+	latest, earliest := s.timestampWindow(now)
+	future, late := countOutOfWindow(points, latest, earliest)
+	if future+late == 0 || s.timestampPolicy(twin) != models.TimestampPolicyReject {
+		return nil
+	}
+	return s.timestampRejection(future)
+}
+
+// timestampWindow returns the latest and earliest accepted timestamps; either is zero when
+// its limit is not configured
+func (s *IngestService) timestampWindow(now time.Time) (latest, earliest time.Time) {
+	if s.limits.MaxFutureSkew > 0 {
+		latest = now.Add(time.Duration(s.limits.MaxFutureSkew) * time.Second)
+	}
+	if s.limits.MaxLateness > 0 {
+		earliest = now.Add(-time.Duration(s.limits.MaxLateness) * time.Second)
+	}
+	return latest, earliest
+}
+
+// countOutOfWindow counts the points timestamped after latest and before earliest
+func countOutOfWindow(points []models.TimeseriesData, latest, earliest time.Time) (future, late int) {
+	for i := range points {
+		switch {
+		case !latest.IsZero() && points[i].Time.After(latest):
+			future++
+		case !earliest.IsZero() && points[i].Time.Before(earliest):
+			late++
+		}
+	}
+	return future, late
+}
+
+// timestampRejection returns the error of rejected points, naming the future skew if any
+// point was too far ahead
+func (s *IngestService) timestampRejection(future int) error {
+	if future > 0 {
+		return fmt.Errorf("%w: points may be timestamped at most %ds ahead", ErrTimestampOutOfRange, s.limits.MaxFutureSkew)
+	}
+	return fmt.Errorf("%w: points may be timestamped at most %ds in the past", ErrTimestampOutOfRange, s.limits.MaxLateness)
+}
+
+// timestampPolicy returns the policy of the twin's project, or the server default.
+// It is only looked up for out-of-window points, which should be rare.
+func (s *IngestService) timestampPolicy(twin *models.Twin) string {
+	if twin != nil {
+		project, err := s.projectRepo.GetByID(twin.ProjectID)
+		if err != nil {
+			s.logger.Warn("Failed to load project timestamp policy", zap.Uint("project_id", twin.ProjectID), zap.Error(err))
+		} else if project.TimestampPolicy != "" {
+			return project.TimestampPolicy
+		}
+	}
+	if s.limits.TimestampPolicy != "" {
+		return s.limits.TimestampPolicy
+	}
+	return models.TimestampPolicyAccept
+}
+
+// recordTimestampViolations alerts when the per-minute threshold of out-of-window points of a twin is reached
+func (s *IngestService) recordTimestampViolations(twin *models.Twin, thingID string, violations int, now time.Time) {
+	if s.limits.TimestampAlertThreshold <= 0 || twin == nil {
+		return
+	}
+
+	count := s.timestampViolations.Record(twin.ID, violations, s.limits.TimestampAlertThreshold, now)
+	if count == 0 {
+		return
+	}
+
+	alertData := &models.AlertData{
+		Time:     now,
+		AlertID:  fmt.Sprintf("%s-timestamp-%d", thingID, now.UnixNano()),
+		TwinID:   thingID,
+		Severity: "warning",
+		Message: fmt.Sprintf("%d points within %s were timestamped outside the accepted window; check the device clock",
+			count, typeViolationWindow),
+		Source: "ingest",
+	}
+
+	s.enrichAlert(alertData)
+	if err := s.timeseriesRepo.InsertAlertData(alertData); err != nil {
+		s.logger.Error("Failed to store timestamp alert", zap.String("thingId", thingID), zap.Error(err))
+		return
+	}
+
+	s.notifyAlert(twin, thingID, alertData)
+}
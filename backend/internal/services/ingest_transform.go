@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/repository"
+)
+
+// twinProjectTTL is how long the project of a thing is cached for matching transforms; things
+// without a twin are cached too, so a new twin matches its project's transforms within this time
+const twinProjectTTL = 30 * time.Second
+
+// PayloadTransformer normalizes the payloads of time-series messages into feature values by
+// the configured transforms. Devices that nest, scale or name their readings differently from
+// Ditto's features are mapped by a transform matching their project, connection and feature.
+type PayloadTransformer struct {
+	transforms []payloadTransform
+	twinRepo   repository.TwinRepository
+	// byProject is set if a transform is restricted to a project, which requires the twin
+	byProject bool
+
+	mu       sync.Mutex
+	projects map[string]cachedTwinProject // by Ditto ID
+}
+
+// cachedTwinProject holds the project of a thing's twin as loaded at a point in time; the
+// project ID is zero for things without a twin
+type cachedTwinProject struct {
+	loaded    time.Time
+	projectID uint
+}
+
+// payloadTransform is a transform with its paths parsed
+type payloadTransform struct {
+	name      string
+	projectID uint
+	source    string
+	feature   string
+	timePath  jsonPath
+	mappings  []payloadMapping
+}
+
+// payloadMapping is a mapping with its path parsed
+type payloadMapping struct {
+	path     jsonPath
+	feature  string
+	scale    float64
+	offset   float64
+	optional bool
+}
+
+// NewPayloadTransformer creates a transformer of the configured transforms, checking their
+// paths and mappings
+func NewPayloadTransformer(transforms []config.IngestTransformConfig, twinRepo repository.TwinRepository) (*PayloadTransformer, error) {
+	transformer := &PayloadTransformer{twinRepo: twinRepo, projects: make(map[string]cachedTwinProject)}
+	names := make(map[string]bool)
+	for i, cfg := range transforms {
+		name := strings.TrimSpace(cfg.Name)
+		if name == "" {
+			return nil, fmt.Errorf("transform %d: name is required", i)
+		}
+		if names[name] {
+			return nil, fmt.Errorf("transform %s: name is used by another transform", name)
+		}
+		names[name] = true
+
+		transform, err := parsePayloadTransform(name, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %w", name, err)
+		}
+		transformer.transforms = append(transformer.transforms, transform)
+		transformer.byProject = transformer.byProject || transform.projectID != 0
+	}
+	return transformer, nil
+}
+
+// parsePayloadTransform checks a transform's matching and parses its paths
+func parsePayloadTransform(name string, cfg config.IngestTransformConfig) (payloadTransform, error) {
+	transform := payloadTransform{
+		name:      name,
+		projectID: cfg.ProjectID,
+		source:    strings.TrimSpace(cfg.Source),
+		feature:   strings.TrimSpace(cfg.Feature),
+	}
+	if transform.source != "" && !IsValidSource(transform.source) {
+		return transform, fmt.Errorf("unknown source %q", transform.source)
+	}
+
+	var err error
+	if strings.TrimSpace(cfg.TimePath) != "" {
+		if transform.timePath, err = parseJSONPath(cfg.TimePath); err != nil {
+			return transform, fmt.Errorf("invalid time_path: %w", err)
+		}
+	}
+
+	if len(cfg.Mappings) == 0 {
+		return transform, errors.New("at least one mapping is required")
+	}
+	features := make(map[string]bool)
+	for i, mappingCfg := range cfg.Mappings {
+		mapping := payloadMapping{
+			feature:  strings.Trim(strings.TrimSpace(mappingCfg.Feature), "/"),
+			scale:    mappingCfg.Scale,
+			offset:   mappingCfg.Offset,
+			optional: mappingCfg.Optional,
+		}
+		if mapping.feature == "" {
+			return transform, fmt.Errorf("mapping %d: feature is required", i)
+		}
+		if features[mapping.feature] {
+			return transform, fmt.Errorf("mapping %d: feature %s is mapped twice", i, mapping.feature)
+		}
+		features[mapping.feature] = true
+		if mapping.path, err = parseJSONPath(mappingCfg.Path); err != nil {
+			return transform, fmt.Errorf("mapping %d: invalid path: %w", i, err)
+		}
+		transform.mappings = append(transform.mappings, mapping)
+	}
+	return transform, nil
+}
+
+// Transform returns the feature values a time-series message is normalized into, and whether a
+// transform matched it; unmatched messages are stored as received. A payload missing a required
+// value, or holding a value a mapping cannot convert, is rejected.
+func (t *PayloadTransformer) Transform(thingID, featureID, source string, timestamp time.Time, data json.RawMessage) ([]FeatureValue, bool, error) {
+	if t == nil || len(t.transforms) == 0 {
+		return nil, false, nil
+	}
+
+	// The twin's project is only looked up when a transform depends on it; unknown things
+	// match no project
+	var projectID uint
+	if t.byProject {
+		var err error
+		if projectID, err = t.twinProject(thingID, time.Now()); err != nil {
+			return nil, false, err
+		}
+	}
+
+	for _, transform := range t.transforms {
+		if !transform.matches(projectID, source, featureID) {
+			continue
+		}
+		values, err := transform.apply(timestamp, data)
+		if err != nil {
+			return nil, true, fmt.Errorf("transform %s: %w", transform.name, err)
+		}
+		return values, true, nil
+	}
+	return nil, false, nil
+}
+
+// twinProject returns the project of a thing's twin, or zero for unknown things, reloading it
+// once the cached copy expires
+func (t *PayloadTransformer) twinProject(thingID string, now time.Time) (uint, error) {
+	t.mu.Lock()
+	cached, ok := t.projects[thingID]
+	t.mu.Unlock()
+	if ok && now.Sub(cached.loaded) < twinProjectTTL {
+		return cached.projectID, nil
+	}
+
+	cached = cachedTwinProject{loaded: now}
+	if twin, err := t.twinRepo.GetByDittoID(thingID); err == nil {
+		cached.projectID = twin.ProjectID
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return 0, fmt.Errorf("failed to get twin: %w", err)
+	}
+
+	t.mu.Lock()
+	t.projects[thingID] = cached
+	t.mu.Unlock()
+	return cached.projectID, nil
+}
+
+// matches reports whether the transform applies to a message
+func (t *payloadTransform) matches(projectID uint, source, featureID string) bool {
+	return (t.projectID == 0 || t.projectID == projectID) &&
+		(t.source == "" || t.source == source) &&
+		(t.feature == "" || t.feature == featureID)
+}
+
+// apply extracts the feature values of the transform's mappings from a payload
+func (t *payloadTransform) apply(timestamp time.Time, data json.RawMessage) ([]FeatureValue, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	if t.timePath != nil {
+		raw, ok := t.timePath.lookup(payload)
+		if !ok {
+			return nil, fmt.Errorf("payload has no time at %s", t.timePath)
+		}
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time at %s: %w", t.timePath, err)
+		}
+		if timestamp, ok = parseSampleTime(encoded); !ok {
+			return nil, fmt.Errorf("invalid time at %s: %s", t.timePath, encoded)
+		}
+	}
+
+	values := make([]FeatureValue, 0, len(t.mappings))
+	for _, mapping := range t.mappings {
+		raw, ok := mapping.path.lookup(payload)
+		if !ok {
+			if mapping.optional {
+				continue
+			}
+			return nil, fmt.Errorf("payload has no value at %s", mapping.path)
+		}
+		value, err := mapping.convert(raw)
+		if err != nil {
+			return nil, fmt.Errorf("feature %s: %w", mapping.feature, err)
+		}
+		values = append(values, FeatureValue{FeatureID: mapping.feature, Timestamp: timestamp, Data: value})
+	}
+	return values, nil
+}
+
+// convert encodes a value extracted from a payload, scaling numbers
+func (m *payloadMapping) convert(raw interface{}) (json.RawMessage, error) {
+	if m.scale == 0 && m.offset == 0 {
+		return json.Marshal(raw)
+	}
+
+	number, ok := raw.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("cannot scale the non-numeric value at %s", m.path)
+	}
+	value, err := number.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("invalid number at %s: %w", m.path, err)
+	}
+	if m.scale != 0 {
+		value *= m.scale
+	}
+	value += m.offset
+	return json.RawMessage(strconv.FormatFloat(value, 'f', -1, 64)), nil
+}
+
+// jsonPath selects a value in a JSON document by object keys and array indices
+type jsonPath []jsonPathSegment
+
+// jsonPathSegment is an object key, or an array index if isIndex is set
+type jsonPathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses a path of dotted keys and bracketed indices or quoted keys, e.g.
+// "$.motor.readings[0].rpm" or "$['motor.v2'].rpm"; the leading "$" is optional
+func parseJSONPath(expr string) (jsonPath, error) {
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "$")
+	if rest == "" {
+		return nil, errors.New("path is empty")
+	}
+	if rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("empty key in %q", expr)
+			}
+			path = append(path, jsonPathSegment{key: key})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in %q", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				path = append(path, jsonPathSegment{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index %q in %q", inner, expr)
+			}
+			path = append(path, jsonPathSegment{index: index, isIndex: true})
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", rest[0], expr)
+		}
+	}
+	return path, nil
+}
+
+// lookup returns the value the path selects in a decoded document, and whether it exists
+func (p jsonPath) lookup(document interface{}) (interface{}, bool) {
+	current := document
+	for _, segment := range p {
+		if segment.isIndex {
+			array, ok := current.([]interface{})
+			if !ok || segment.index >= len(array) {
+				return nil, false
+			}
+			current = array[segment.index]
+			continue
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[segment.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// String returns the path in its canonical form
+func (p jsonPath) String() string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, segment := range p {
+		switch {
+		case segment.isIndex:
+			fmt.Fprintf(&b, "[%d]", segment.index)
+		case strings.ContainsAny(segment.key, ".[]'"):
+			fmt.Fprintf(&b, "[%q]", segment.key)
+		default:
+			b.WriteString("." + segment.key)
+		}
+	}
+	return b.String()
+}
@@ -3,9 +3,12 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db"
 	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/db/repository"
@@ -18,15 +21,53 @@ import (
 // KafkaHandler implements message handlers for Kafka topics
 type KafkaHandler struct {
 	logger           *utils.Logger
-	kafkaManager     *kafka.Manager
+	kafkaManager     kafka.Bus
 	dittoManager     *ditto.Manager
 	timeseriesRepo   repository.TimeseriesRepository
 	twinRepo         repository.TwinRepository
 	projectRepo      repository.ProjectRepository
+	attributeRepo    repository.AttributeHistoryRepository
 	dittoEventBuffer chan *DittoEventData
 	database         *db.Database
+	ingestService    *IngestService
+	writebackService *WritebackService
+	mlPauses         *MLPauseCache
+
+	// Closed to drain the event buffer, and once it is drained
+	stopBuffer chan struct{}
+	bufferDone chan struct{}
+
+	// Set while Ditto WebSocket events are dropped instead of forwarded to Kafka
+	forwardingPaused atomic.Bool
+	// Drops the Ditto WebSocket events of unmanaged things
+	forwardFilter *DittoForwardFilter
+
+	// Tunes the processing pipelines; the defaults apply without it
+	pipelineConfig *config.KafkaConfig
+	pipelines      []kafka.PipelineSpec
+
+	// Coalesces each thing's burst of Ditto events within the window; 0 applies every event
+	eventDebounce time.Duration
+
+	// Types twins created in Ditto by their thing definition; twins stay untyped without it
+	definitionService *ThingDefinitionService
+
+	// Delivers new ML alerts along their alert routes; alerts are only stored without it
+	alertRouting *AlertRoutingService
+	// Stores a snapshot of the twin's recent data on new ML alerts; alerts carry no context without it
+	alertEnricher *AlertEnricher
+
+	// Normalizes device payloads of time-series messages; payloads are stored as received without it
+	transformer *PayloadTransformer
 }
 
+// Processing pipelines of the Kafka handler, as named in the kafka.pipelines config
+const (
+	PipelineDittoEvents    = "ditto-event-processor"
+	PipelineTimeSeriesData = "timeseries-processor"
+	PipelineMLOutput       = "ml-output-processor"
+)
+
 // DittoEventData represents processed Ditto event data
 type DittoEventData struct {
 	ThingID   string          `json:"thingId"`
@@ -38,10 +79,12 @@ type DittoEventData struct {
 // NewKafkaHandler creates a new Kafka message handler service
 func NewKafkaHandler(
 	logger *utils.Logger,
-	kafkaManager *kafka.Manager,
+	kafkaManager kafka.Bus,
 	dittoManager *ditto.Manager,
 	database *db.Database,
 	repoFactory *repository.RepositoryFactory,
+	ingestService *IngestService,
+	writebackService *WritebackService,
 ) *KafkaHandler {
 	return &KafkaHandler{
 		logger:           logger.Named("kafka_handler"),
@@ -50,37 +93,127 @@ func NewKafkaHandler(
 		timeseriesRepo:   repoFactory.Timeseries(),
 		twinRepo:         repoFactory.Twin(),
 		projectRepo:      repoFactory.Project(),
+		attributeRepo:    repoFactory.AttributeHistory(),
 		dittoEventBuffer: make(chan *DittoEventData, 100), // Buffer for processing Ditto events
 		database:         database,
+		ingestService:    ingestService,
+		writebackService: writebackService,
+		mlPauses:         NewMLPauseCache(database, logger),
+		stopBuffer:       make(chan struct{}),
+		bufferDone:       make(chan struct{}),
+		forwardFilter:    &DittoForwardFilter{},
+		pipelineConfig:   &config.KafkaConfig{},
 	}
 }
 
-// Initialize sets up Kafka consumers and starts event processing
+// SetPipelineConfig sets the Kafka config tuning the processing pipelines, before Initialize
+func (h *KafkaHandler) SetPipelineConfig(cfg *config.KafkaConfig) {
+	h.pipelineConfig = cfg
+}
+
+// SetMLPauseCache shares the cache of ML pauses, so pauses set through the services it is
+// given to take effect at once
+func (h *KafkaHandler) SetMLPauseCache(cache *MLPauseCache) {
+	h.mlPauses = cache
+}
+
+// SetEventDebounce sets the window within which a thing's Ditto events are coalesced into
+// one, before Start; 0 applies every event as it arrives
+func (h *KafkaHandler) SetEventDebounce(window time.Duration) {
+	h.eventDebounce = window
+}
+
+// SetDefinitionService sets the service typing the twins of things created in Ditto by their
+// thing definition
+func (h *KafkaHandler) SetDefinitionService(definitionService *ThingDefinitionService) {
+	h.definitionService = definitionService
+}
+
+// SetPayloadTransformer sets the transforms normalizing the payloads of time-series messages
+func (h *KafkaHandler) SetPayloadTransformer(transformer *PayloadTransformer) {
+	h.transformer = transformer
+}
+
+// Pipelines returns the processing pipelines wired by Initialize
+func (h *KafkaHandler) Pipelines() []kafka.PipelineSpec {
+	return h.pipelines
+}
+
+// Initialize registers the handlers for Ditto and Kafka messages
 func (h *KafkaHandler) Initialize(ctx context.Context) error {
 	// Register handler for Ditto events from WebSocket
 	h.dittoManager.SetEventHandler(h.handleDittoWebSocketEvent)
 
-	// Register handler for Ditto events from Kafka
-	if err := h.kafkaManager.RegisterDittoEventHandler("ditto-event-processor", h.handleDittoKafkaEvent); err != nil {
-		return fmt.Errorf("failed to register Ditto event handler: %w", err)
+	// Register the pipelines for Kafka messages; their topics and consumers are configurable
+	registry := kafka.NewPipelineRegistry()
+	for _, pipeline := range []kafka.Pipeline{
+		{Name: PipelineDittoEvents, Topic: kafka.TopicDittoEvents, Handler: kafka.DittoEventHandler(h.handleDittoKafkaEvent)},
+		{Name: PipelineTimeSeriesData, Topic: kafka.TopicTimeSeriesData, Handler: kafka.TimeSeriesDataHandler(h.handleTimeSeriesData)},
+		{Name: PipelineMLOutput, Topic: kafka.TopicMLOutput, Handler: kafka.MLOutputHandler(h.handleMLOutput)},
+	} {
+		if err := registry.Register(pipeline); err != nil {
+			return err
+		}
 	}
 
-	// Register handler for time-series data
-	if err := h.kafkaManager.RegisterTimeSeriesDataHandler("timeseries-processor", h.handleTimeSeriesData); err != nil {
-		return fmt.Errorf("failed to register time-series data handler: %w", err)
+	pipelines, err := registry.Wire(h.kafkaManager, h.pipelineConfig)
+	if err != nil {
+		return fmt.Errorf("invalid Kafka pipelines: %w", err)
 	}
-
-	// Register handler for ML output
-	if err := h.kafkaManager.RegisterMLOutputHandler("ml-output-processor", h.handleMLOutput); err != nil {
-		return fmt.Errorf("failed to register ML output handler: %w", err)
+	h.pipelines = pipelines
+
+	for _, pipeline := range pipelines {
+		h.logger.Info("Registered Kafka pipeline",
+			zap.String("name", pipeline.Name),
+			zap.String("topic", pipeline.Topic),
+			zap.String("group", pipeline.Group),
+			zap.Int("concurrency", pipeline.Concurrency),
+			zap.Bool("dlq", pipeline.DLQ))
 	}
 
-	// Start event buffer processor
-	go h.processDittoEventBuffer(ctx)
+	return nil
+}
+
+// Name returns the component name of the handler
+func (h *KafkaHandler) Name() string {
+	return "ditto-event-buffer"
+}
 
+// Start starts processing buffered Ditto events
+func (h *KafkaHandler) Start(ctx context.Context) error {
+	go h.processDittoEventBuffer(ctx)
 	return nil
 }
 
+// Stop processes the Ditto events still buffered and stops the processor.
+// The Kafka consumers filling the buffer must be stopped first.
+func (h *KafkaHandler) Stop(ctx context.Context) error {
+	close(h.stopBuffer)
+
+	select {
+	case <-h.bufferDone:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ditto event buffer not drained: %w", ctx.Err())
+	}
+}
+
+// SetAlertRouting delivers the new alerts raised by ML analysis according to the alert routes
+func (h *KafkaHandler) SetAlertRouting(alertRouting *AlertRoutingService) {
+	h.alertRouting = alertRouting
+}
+
+// SetAlertEnricher stores a snapshot of the twin's recent data on the new alerts raised by ML analysis
+func (h *KafkaHandler) SetAlertEnricher(alertEnricher *AlertEnricher) {
+	h.alertEnricher = alertEnricher
+}
+
+// SetDittoForwardingPaused stops or resumes forwarding Ditto WebSocket events to Kafka.
+// Events received while paused are dropped; Ditto keeps the current state of the things.
+func (h *KafkaHandler) SetDittoForwardingPaused(paused bool) {
+	h.forwardingPaused.Store(paused)
+}
+
 // handleDittoWebSocketEvent handles events from the Ditto WebSocket
 func (h *KafkaHandler) handleDittoWebSocketEvent(event *ditto.DittoEvent) {
 	h.logger.Debug("Received Ditto WebSocket event",
@@ -89,8 +222,27 @@ func (h *KafkaHandler) handleDittoWebSocketEvent(event *ditto.DittoEvent) {
 		zap.String("thingId", event.ThingID),
 		zap.String("action", event.Action))
 
+	if h.forwardingPaused.Load() {
+		h.logger.Debug("Dropping Ditto event while forwarding is paused", zap.String("thingId", event.ThingID))
+		return
+	}
+
+	if !h.forwardFilter.Allow(event) {
+		h.logger.Debug("Dropping Ditto event of unmanaged thing", zap.String("thingId", event.ThingID))
+		return
+	}
+
+	// Changes the backend made itself were already stored when they were written
+	if h.dittoManager.IsEcho(event) {
+		h.logger.Debug("Skipping echo of own Ditto write",
+			zap.String("thingId", event.ThingID),
+			zap.String("path", event.Path),
+			zap.String("correlationId", event.CorrelationID()))
+		return
+	}
+
 	// Forward event to Kafka for persistence and further processing
-	err := h.kafkaManager.ProduceDittoEvent(event.ThingID, event.Action, event.Value)
+	err := h.kafkaManager.ProduceDittoEvent(event.ThingID, event.Action, dittoEventPayload(event))
 	if err != nil {
 		h.logger.Error("Failed to produce Ditto event to Kafka",
 			zap.String("thingId", event.ThingID),
@@ -103,7 +255,7 @@ func (h *KafkaHandler) handleDittoWebSocketEvent(event *ditto.DittoEvent) {
 		// Path for feature properties: /features/featureId/properties
 		if event.Action == "modified" || event.Action == "created" {
 			// Forward feature data to time-series topic
-			err := h.kafkaManager.ProduceTimeSeriesData(event.ThingID, event.FeatureID, event.Value)
+			err := h.kafkaManager.ProduceTimeSeriesData(event.ThingID, event.FeatureID, event.Value, SourceDittoWS)
 			if err != nil {
 				h.logger.Error("Failed to produce time-series data to Kafka",
 					zap.String("thingId", event.ThingID),
@@ -134,21 +286,79 @@ func (h *KafkaHandler) handleDittoKafkaEvent(thingID, action string, payload jso
 // processDittoEventBuffer processes the buffered Ditto events
 func (h *KafkaHandler) processDittoEventBuffer(ctx context.Context) {
 	h.logger.Info("Starting Ditto event buffer processor")
+	defer close(h.bufferDone)
+
+	// Without a debounce window every event is applied as it arrives
+	var debouncer *dittoEventDebouncer
+	if h.eventDebounce > 0 {
+		debouncer = newDittoEventDebouncer(h.eventDebounce)
+	}
+	apply := func(event *DittoEventData) {
+		if debouncer == nil {
+			h.processBufferedEvent(ctx, event)
+			return
+		}
+		for _, ready := range debouncer.add(event, time.Now()) {
+			h.processBufferedEvent(ctx, ready)
+		}
+	}
 
 	for {
+		// Wakes up when the earliest pending burst is due
+		var timer *time.Timer
+		var due <-chan time.Time
+		if debouncer != nil {
+			if next, ok := debouncer.next(); ok {
+				timer = time.NewTimer(time.Until(next))
+				due = timer.C
+			}
+		}
+
 		select {
 		case <-ctx.Done():
 			h.logger.Info("Stopping Ditto event buffer processor")
 			return
 
+		case <-h.stopBuffer:
+			// Drain the events buffered before the consumers stopped, applying the bursts
+			// still waiting for their window
+			for {
+				select {
+				case event := <-h.dittoEventBuffer:
+					apply(event)
+				default:
+					if debouncer != nil {
+						for _, event := range debouncer.flushAll() {
+							h.processBufferedEvent(ctx, event)
+						}
+					}
+					h.logger.Info("Stopping Ditto event buffer processor")
+					return
+				}
+			}
+
 		case event := <-h.dittoEventBuffer:
-			if err := h.processEvent(ctx, event); err != nil {
-				h.logger.Error("Failed to process Ditto event",
-					zap.String("thingId", event.ThingID),
-					zap.String("action", event.Action),
-					zap.Error(err))
+			apply(event)
+
+		case <-due:
+			for _, event := range debouncer.flushDue(time.Now()) {
+				h.processBufferedEvent(ctx, event)
 			}
 		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// processBufferedEvent processes a buffered Ditto event, logging failures
+func (h *KafkaHandler) processBufferedEvent(ctx context.Context, event *DittoEventData) {
+	if err := h.processEvent(ctx, event); err != nil {
+		h.logger.Error("Failed to process Ditto event",
+			zap.String("thingId", event.ThingID),
+			zap.String("action", event.Action),
+			zap.Error(err))
 	}
 }
 
@@ -165,11 +375,10 @@ func (h *KafkaHandler) processEvent(ctx context.Context, event *DittoEventData)
 		return fmt.Errorf("twin not found: %w", err)
 	}
 
-	// Process the event based on the action
+	// Process the event based on the action; things and attributes created on a registered
+	// twin only change it
 	switch event.Action {
-	case "created":
-		return h.handleTwinCreated(ctx, event)
-	case "modified":
+	case "created", "modified":
 		return h.handleTwinModified(ctx, twin, event)
 	case "deleted":
 		return h.handleTwinDeleted(ctx, twin, event)
@@ -182,6 +391,7 @@ func (h *KafkaHandler) processEvent(ctx context.Context, event *DittoEventData)
 func (h *KafkaHandler) handleTwinCreated(ctx context.Context, event *DittoEventData) error {
 	// Parse thing data
 	var thingData struct {
+		Definition string                 `json:"definition"`
 		Attributes map[string]interface{} `json:"attributes"`
 	}
 
@@ -197,6 +407,13 @@ func (h *KafkaHandler) handleTwinCreated(ctx context.Context, event *DittoEventD
 		}
 	}
 
+	// Fall back to the project encoded in the thing's namespace
+	if projectID == 0 {
+		if namespaceProjectID, ok := h.dittoManager.ProjectIDForThing(event.ThingID); ok {
+			projectID = namespaceProjectID
+		}
+	}
+
 	// If project ID is not found, assign to default project
 	if projectID == 0 {
 		// Use List with filter to find default project
@@ -217,14 +434,60 @@ func (h *KafkaHandler) handleTwinCreated(ctx context.Context, event *DittoEventD
 		UpdatedAt:   event.Timestamp,
 	}
 
-	if err := h.twinRepo.Create(twin); err != nil {
+	// Type the twin by its thing definition; a definition that cannot be resolved leaves it
+	// untyped rather than losing the twin
+	if thingData.Definition != "" && h.definitionService != nil {
+		twinType, err := h.definitionService.TypeForDefinition(ctx, thingData.Definition)
+		if err != nil {
+			h.logger.Warn("Failed to resolve thing definition, registering twin without a type",
+				zap.String("thingId", event.ThingID),
+				zap.String("definition", thingData.Definition),
+				zap.Error(err))
+		} else {
+			twin.TypeID = twinType.ID
+		}
+	}
+
+	// Twin names are unique per project; fall back to the thing ID when the name is taken
+	if _, err := h.twinRepo.GetByName(projectID, twin.Name); err == nil {
+		h.logger.Warn("Twin name already used in project, naming twin after its thing ID",
+			zap.String("thingId", event.ThingID),
+			zap.String("name", twin.Name),
+			zap.Uint("projectId", projectID))
+		twin.Name = event.ThingID
+	}
+
+	err := h.twinRepo.Create(twin)
+	if errors.Is(err, repository.ErrConflict) {
+		// A twin registered concurrently may have taken the thing or the name since they were
+		// checked; the event then applies to that twin, or the new twin is named after its thing
+		if existing, getErr := h.twinRepo.GetByDittoID(event.ThingID); getErr == nil {
+			return h.handleTwinModified(ctx, existing, event)
+		}
+		if twin.Name != event.ThingID {
+			h.logger.Warn("Twin name taken concurrently in project, naming twin after its thing ID",
+				zap.String("thingId", event.ThingID),
+				zap.String("name", twin.Name),
+				zap.Uint("projectId", projectID))
+			twin.ID = 0
+			twin.Name = event.ThingID
+			err = h.twinRepo.Create(twin)
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("failed to create twin: %w", err)
 	}
 
 	h.logger.Info("Created new twin in database",
 		zap.String("thingId", event.ThingID),
 		zap.String("name", twin.Name),
-		zap.Uint("projectId", projectID))
+		zap.Uint("projectId", projectID),
+		zap.Uint("typeId", twin.TypeID))
+
+	// The initial attributes are the baseline later changes are compared to
+	if err := h.recordAttributeChanges(twin, thingData.Attributes, event.Timestamp); err != nil {
+		return fmt.Errorf("failed to record attribute history: %w", err)
+	}
 
 	return nil
 }
@@ -265,6 +528,10 @@ func (h *KafkaHandler) handleTwinModified(ctx context.Context, twin *models.Twin
 			zap.String("name", twin.Name))
 	}
 
+	if err := h.recordAttributeChanges(twin, thingData.Attributes, event.Timestamp); err != nil {
+		return fmt.Errorf("failed to record attribute history: %w", err)
+	}
+
 	return nil
 }
 
@@ -282,78 +549,31 @@ func (h *KafkaHandler) handleTwinDeleted(ctx context.Context, twin *models.Twin,
 	return nil
 }
 
-// handleTimeSeriesData handles time-series data from Kafka
-func (h *KafkaHandler) handleTimeSeriesData(thingID, featureID string, timestamp time.Time, data json.RawMessage) error {
+// handleTimeSeriesData handles time-series data from Kafka. Messages that are untagged
+// or carry an unknown source are recorded as coming from Ditto's Kafka connection.
+func (h *KafkaHandler) handleTimeSeriesData(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) error {
 	h.logger.Debug("Processing time-series data",
 		zap.String("thingId", thingID),
 		zap.String("featureId", featureID),
+		zap.String("source", source),
 		zap.Time("timestamp", timestamp))
 
-	// Determine value type and extract values
-	var valueType string
-	var valueNum float64
-	var valueBool *bool
-	var valueStr string
-	var valueJSON string
-
-	var jsonValue interface{}
-	if err := json.Unmarshal(data, &jsonValue); err == nil {
-		switch v := jsonValue.(type) {
-		case float64:
-			valueType = "number"
-			valueNum = v
-		case bool:
-			valueType = "boolean"
-			valueBool = &v
-		case string:
-			valueType = "string"
-			valueStr = v
-		default:
-			valueType = "object"
-			valueJSON = string(data)
-		}
-	} else {
-		valueType = "object"
-		valueJSON = string(data)
-	}
-
-	// Store time-series data in TimescaleDB
-	timeSeriesData := &models.TimeseriesData{
-		Time:        timestamp,
-		TwinID:      thingID,
-		FeaturePath: featureID,
-		ValueType:   valueType,
-		ValueNum:    valueNum,
-		ValueBool:   valueBool,
-		ValueStr:    valueStr,
-		ValueJSON:   valueJSON,
-		Source:      "ditto",
-	}
-
-	if err := h.timeseriesRepo.InsertTimeseriesData(timeSeriesData); err != nil {
-		return fmt.Errorf("failed to store time-series data: %w", err)
-	}
-
-	// Check if ML analysis is needed
-	if isMLEnabledForFeature(featureID) {
-		mlInput := map[string]interface{}{
-			"thingId":   thingID,
-			"featureId": featureID,
-			"timestamp": timestamp,
-			"data":      data,
-		}
+	if !IsValidSource(source) {
+		source = SourceDittoKafka
+	}
 
-		// Forward to ML service
-		err := h.kafkaManager.ProduceMLInput(featureID, mlInput)
-		if err != nil {
-			h.logger.Error("Failed to send data to ML service",
-				zap.String("thingId", thingID),
-				zap.String("featureId", featureID),
-				zap.Error(err))
-		}
+	// Payloads of devices with their own format are normalized into feature values first
+	values, transformed, err := h.transformer.Transform(thingID, featureID, source, timestamp, data)
+	if err != nil {
+		return err
+	}
+	if transformed {
+		_, err := h.ingestService.ProcessFeatureValues(thingID, values, source)
+		return err
 	}
 
-	return nil
+	_, err = h.ingestService.ProcessFeatureValue(thingID, featureID, timestamp, data, source)
+	return err
 }
 
 // handleMLOutput handles ML output data from Kafka
@@ -368,11 +588,21 @@ func (h *KafkaHandler) handleMLOutput(modelID string, timestamp time.Time, outpu
 		FeatureID string          `json:"featureId"`
 		Result    json.RawMessage `json:"result"`
 		Alert     *MLAlert        `json:"alert,omitempty"`
+		// Backfill is echoed from the input when the prediction is for a backfilled value
+		Backfill *MLBackfillTag `json:"backfill,omitempty"`
 	}
 
 	if err := json.Unmarshal(output, &mlOutput); err != nil {
 		return fmt.Errorf("failed to unmarshal ML output: %w", err)
 	}
+	mlOutput.ThingID = ditto.NormalizeThingID(mlOutput.ThingID)
+
+	if h.mlOutputPaused(mlOutput.ThingID) {
+		h.logger.Debug("Dropping ML output while ML is paused",
+			zap.String("thingId", mlOutput.ThingID),
+			zap.String("modelId", modelID))
+		return nil
+	}
 
 	// Extract prediction type and values
 	var predictionType string = "anomaly" // Default
@@ -380,6 +610,13 @@ func (h *KafkaHandler) handleMLOutput(modelID string, timestamp time.Time, outpu
 	var labelStr string
 	var detailsJSON string = string(mlOutput.Result)
 
+	// Predictions for backfilled values keep the job they were made for
+	if mlOutput.Backfill != nil {
+		if details, err := json.Marshal(map[string]interface{}{"result": mlOutput.Result, "backfill": mlOutput.Backfill}); err == nil {
+			detailsJSON = string(details)
+		}
+	}
+
 	// Store ML prediction
 	prediction := &models.MLPredictionData{
 		Time:           timestamp,
@@ -396,8 +633,18 @@ func (h *KafkaHandler) handleMLOutput(modelID string, timestamp time.Time, outpu
 		return fmt.Errorf("failed to store ML prediction: %w", err)
 	}
 
+	// Write the stored prediction to the Ditto properties configured on the twin's bindings.
+	// Predictions for backfilled values describe the past, so they are not written back.
+	if h.writebackService != nil && mlOutput.Backfill == nil {
+		h.writebackService.Submit(prediction)
+	}
+
 	// Handle alerts if present
 	if mlOutput.Alert != nil {
+		source := "ml"
+		if mlOutput.Backfill != nil {
+			source = "ml-backfill"
+		}
 		alertData := &models.AlertData{
 			Time:        timestamp,
 			AlertID:     fmt.Sprintf("%s-%d", mlOutput.ThingID, timestamp.UnixNano()),
@@ -406,14 +653,23 @@ func (h *KafkaHandler) handleMLOutput(modelID string, timestamp time.Time, outpu
 			Severity:    mlOutput.Alert.Severity,
 			Message:     mlOutput.Alert.Description,
 			ValueJSON:   string(output),
-			Source:      "ml",
+			Source:      source,
 		}
 
-		if err := h.timeseriesRepo.InsertAlertData(alertData); err != nil {
+		// A condition raised again while its alert is active is counted on that alert
+		var enrich func(*models.AlertData)
+		if h.alertEnricher != nil {
+			enrich = func(alert *models.AlertData) { h.alertEnricher.Enrich(context.Background(), alert) }
+		}
+		_, inserted, err := h.timeseriesRepo.RaiseAlert(context.Background(), alertData, enrich)
+		if err != nil {
 			return fmt.Errorf("failed to store alert: %w", err)
 		}
 
-		// TODO: Implement notification for alerts
+		// Only new alerts are delivered; backfilled ones describe the past
+		if inserted && h.alertRouting != nil && mlOutput.Backfill == nil {
+			h.alertRouting.RouteStored(alertData)
+		}
 	}
 
 	return nil
@@ -435,10 +691,3 @@ func getStringAttribute(attributes map[string]interface{}, key, fallback string)
 	}
 	return fallback
 }
-
-// isMLEnabledForFeature checks if ML analysis is enabled for a feature
-func isMLEnabledForFeature(featureID string) bool {
-	// TODO: Implement actual check based on configured ML task bindings
-	// For now, just return true for testing purposes
-	return true
-}
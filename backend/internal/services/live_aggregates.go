@@ -0,0 +1,253 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// NotificationTypeLiveAggregate for updates of a subscribed live aggregate
+const NotificationTypeLiveAggregate NotificationType = "live_aggregate"
+
+// liveAggregateKey identifies the stream of a twin feature aggregated over an interval
+type liveAggregateKey struct {
+	thingID     string
+	featurePath string
+	interval    string
+}
+
+// liveAggregateStream holds the running aggregate of a subscribed twin feature
+type liveAggregateStream struct {
+	topic       string
+	width       time.Duration
+	subscribers int
+	bucket      *models.AggregatedData
+}
+
+// LiveAggregates keeps the aggregate of the current bucket of every twin feature a websocket
+// client subscribed to, updated incrementally as points are ingested and pushed to the
+// subscribers. Buckets are aligned to multiples of the interval; the running aggregate is
+// reset when a point falls into a later bucket, and points of earlier buckets are ignored.
+type LiveAggregates struct {
+	logger        *utils.Logger
+	twinRepo      repository.TwinRepository
+	projectRepo   repository.ProjectRepository
+	userRepo      repository.UserRepository
+	notifications *NotificationService
+
+	mutex   sync.Mutex
+	streams map[liveAggregateKey]*liveAggregateStream
+	topics  map[string]liveAggregateKey
+}
+
+// NewLiveAggregates creates the live aggregates pushed through the notification service
+func NewLiveAggregates(db *db.Database, notifications *NotificationService, logger *utils.Logger) *LiveAggregates {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &LiveAggregates{
+		logger:        logger.Named("live_aggregates"),
+		twinRepo:      repoFactory.Twin(),
+		projectRepo:   repoFactory.Project(),
+		userRepo:      repoFactory.User(),
+		notifications: notifications,
+		streams:       make(map[liveAggregateKey]*liveAggregateStream),
+		topics:        make(map[string]liveAggregateKey),
+	}
+}
+
+// LiveAggregateTopic returns the notification topic of a twin feature aggregated over an interval
+func LiveAggregateTopic(twinID uint, featurePath, interval string) string {
+	return fmt.Sprintf("twins/%d/aggregates/%s/%s", twinID, interval, featurePath)
+}
+
+// IsLiveAggregateTopic reports whether a topic carries live aggregates, which clients may
+// only subscribe to through Subscribe
+func IsLiveAggregateTopic(topic string) bool {
+	parts := strings.SplitN(topic, "/", 4)
+	return len(parts) == 4 && parts[0] == "twins" && parts[2] == "aggregates"
+}
+
+// Subscribe starts aggregating a twin feature over an interval for a user allowed to view
+// the twin, returning the topic its updates are sent to
+func (l *LiveAggregates) Subscribe(userID, twinID uint, featurePath, interval string) (string, error) {
+	if featurePath == "" {
+		return "", errors.New("feature path is required")
+	}
+	width, ok := intervalWidth(interval)
+	if !ok {
+		return "", fmt.Errorf("invalid interval: %s", interval)
+	}
+
+	twin, err := l.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", errors.New("twin not found")
+		}
+		l.logger.Error("Failed to get twin", zap.Uint("twin_id", twinID), zap.Error(err))
+		return "", errors.New("database error")
+	}
+	if err := l.authorize(userID, twin); err != nil {
+		return "", err
+	}
+
+	key := liveAggregateKey{thingID: twin.DittoID, featurePath: featurePath, interval: interval}
+	topic := LiveAggregateTopic(twin.ID, featurePath, interval)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stream, ok := l.streams[key]
+	if !ok {
+		stream = &liveAggregateStream{topic: topic, width: width}
+		l.streams[key] = stream
+		l.topics[topic] = key
+	}
+	stream.subscribers++
+	return topic, nil
+}
+
+// Unsubscribe releases a subscription to a topic, dropping its aggregate once no subscriber is left
+func (l *LiveAggregates) Unsubscribe(topic string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key, ok := l.topics[topic]
+	if !ok {
+		return
+	}
+	stream := l.streams[key]
+	stream.subscribers--
+	if stream.subscribers <= 0 {
+		delete(l.streams, key)
+		delete(l.topics, topic)
+	}
+}
+
+// Subscriptions returns the number of twin features being aggregated
+func (l *LiveAggregates) Subscriptions() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.streams)
+}
+
+// Add includes ingested points in the aggregates subscribed to and pushes the updated
+// aggregates to their subscribers, returning them. Only numeric points are aggregated; the
+// interval_type of an update is the interval subscribed to, e.g. "1m".
+func (l *LiveAggregates) Add(points []models.TimeseriesData) []models.AggregatedData {
+	var updates []models.AggregatedData
+	var topics []string
+
+	l.mutex.Lock()
+	if len(l.streams) == 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	for _, point := range points {
+		if point.ValueType != "number" {
+			continue
+		}
+		for _, interval := range aggregationIntervals {
+			stream, ok := l.streams[liveAggregateKey{thingID: point.TwinID, featurePath: point.FeaturePath, interval: interval.name}]
+			if !ok || !stream.add(point, interval.name) {
+				continue
+			}
+			updates = append(updates, *stream.bucket)
+			topics = append(topics, stream.topic)
+		}
+	}
+	l.mutex.Unlock()
+
+	// Notified outside the lock, as the notification service calls back into Unsubscribe
+	if l.notifications != nil {
+		for i, update := range updates {
+			l.notifications.NotifyTopic(topics[i], NotificationTypeLiveAggregate, update)
+		}
+	}
+	return updates
+}
+
+// add includes a point in the stream's bucket, starting a new bucket when the point is past
+// the current one; it reports whether the aggregate changed
+func (s *liveAggregateStream) add(point models.TimeseriesData, interval string) bool {
+	start := point.Time.Truncate(s.width)
+	if s.bucket != nil && start.Before(s.bucket.TimeInterval) {
+		return false
+	}
+
+	value := point.ValueNum
+	if s.bucket == nil || start.After(s.bucket.TimeInterval) {
+		s.bucket = &models.AggregatedData{
+			TimeInterval: start,
+			TwinID:       point.TwinID,
+			FeaturePath:  point.FeaturePath,
+			IntervalType: interval,
+			Min:          value,
+			Max:          value,
+			FirstTime:    point.Time,
+			LastTime:     point.Time,
+		}
+	}
+
+	bucket := s.bucket
+	if value < bucket.Min {
+		bucket.Min = value
+	}
+	if value > bucket.Max {
+		bucket.Max = value
+	}
+	if point.Time.Before(bucket.FirstTime) {
+		bucket.FirstTime = point.Time
+	}
+	if point.Time.After(bucket.LastTime) {
+		bucket.LastTime = point.Time
+	}
+	bucket.Sum += value
+	bucket.Count++
+	bucket.Avg = bucket.Sum / float64(bucket.Count)
+	return true
+}
+
+// authorize checks that a user may view a twin: admins view every twin, others the twins
+// of the projects they are members of
+func (l *LiveAggregates) authorize(userID uint, twin *models.Twin) error {
+	user, err := l.userRepo.GetByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("access denied")
+		}
+		l.logger.Error("Failed to get user", zap.Uint("user_id", userID), zap.Error(err))
+		return errors.New("database error")
+	}
+	if user.Role == models.RoleAdmin {
+		return nil
+	}
+
+	hasAccess, err := l.projectRepo.CheckUserAccess(twin.ProjectID, userID, models.ProjectRoleViewer)
+	if err != nil {
+		l.logger.Error("Failed to check project access",
+			zap.Uint("project_id", twin.ProjectID),
+			zap.Uint("user_id", userID),
+			zap.Error(err))
+		return errors.New("database error")
+	}
+	if !hasAccess {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+// intervalWidth returns the bucket width of a named aggregation interval
+func intervalWidth(interval string) (time.Duration, bool) {
+	for _, candidate := range aggregationIntervals {
+		if candidate.name == interval {
+			return candidate.width, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxBackfillRange is the longest window a single backfill may cover
+const maxBackfillRange = 31 * 24 * time.Hour
+
+// backfillPageSize is the number of stored values read at a time while backfilling
+const backfillPageSize = 500
+
+var (
+	// ErrBackfillRunning is returned when a backfill of the same task and twin has not finished
+	ErrBackfillRunning = errors.New("a backfill of this task is already running for the twin")
+	// ErrBackfillUnavailable is returned when there is no message bus to send ML input to
+	ErrBackfillUnavailable = errors.New("ML backfill is not available")
+	// ErrInvalidBackfillRange is returned for empty, reversed or too long backfill windows
+	ErrInvalidBackfillRange = errors.New("backfill range must end after it starts and cover at most 31 days")
+)
+
+// MLBackfillTag marks ML input sent by a backfill, so the outputs of the task can be
+// attributed to it
+type MLBackfillTag struct {
+	JobID uint `json:"job_id"`
+}
+
+// MLBackfillService re-sends historical feature values of a twin to an ML task. Values are
+// read in time order per feature, following the input mapping of the task's binding, and
+// sent to the ML-input topic tagged with the backfill job. While the service is paused,
+// running jobs wait before their next page and new jobs stay pending.
+type MLBackfillService struct {
+	mlRepo         repository.MLRepository
+	timeseriesRepo repository.TimeseriesRepository
+	jobs           *gorm.DB
+	kafkaManager   kafka.Bus
+	logger         *utils.Logger
+
+	mutex   sync.Mutex
+	running map[uint]context.CancelFunc
+	wg      sync.WaitGroup
+	runs    lifecycle.WorkerRuns
+	started bool
+	// resumed is closed when the paused service is resumed; nil while not paused
+	resumed chan struct{}
+}
+
+// NewMLBackfillService creates a new ML backfill service
+func NewMLBackfillService(database *db.Database, logger *utils.Logger) *MLBackfillService {
+	return &MLBackfillService{
+		mlRepo:         repository.NewMLRepository(database.DB),
+		timeseriesRepo: repository.NewTimeseriesRepository(database.DB),
+		jobs:           database.DB,
+		logger:         logger.Named("ml_backfill"),
+		running:        make(map[uint]context.CancelFunc),
+	}
+}
+
+// SetKafkaManager sets the message bus backfilled values are sent to
+func (s *MLBackfillService) SetKafkaManager(kafkaManager kafka.Bus) {
+	s.kafkaManager = kafkaManager
+}
+
+// Backfill creates a backfill job for the values of the twin between start and end, and runs
+// it in the background. The task must be bound to the twin.
+func (s *MLBackfillService) Backfill(twin *models.Twin, taskID uint, start, end time.Time, userID uint) (*models.MLBackfillJob, error) {
+	if s.kafkaManager == nil {
+		return nil, ErrBackfillUnavailable
+	}
+	if !end.After(start) || end.Sub(start) > maxBackfillRange {
+		return nil, ErrInvalidBackfillRange
+	}
+
+	binding, err := s.findBinding(twin.ID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var active int64
+	if err := s.jobs.Model(&models.MLBackfillJob{}).
+		Where("twin_id = ? AND task_id = ? AND status IN ?", twin.ID, taskID, []string{models.MLBackfillPending, models.MLBackfillRunning}).
+		Count(&active).Error; err != nil {
+		return nil, errors.New("database error")
+	}
+	if active > 0 {
+		return nil, ErrBackfillRunning
+	}
+
+	job := &models.MLBackfillJob{
+		TwinID:    twin.ID,
+		TaskID:    taskID,
+		BindingID: binding.ID,
+		Start:     start.UTC(),
+		End:       end.UTC(),
+		Status:    models.MLBackfillPending,
+		CreatedBy: userID,
+	}
+	if err := s.jobs.Create(job).Error; err != nil {
+		return nil, errors.New("database error")
+	}
+
+	// The job runs on its own copy so the returned job is not written to concurrently
+	ctx, cancel := context.WithCancel(context.Background())
+	s.running[job.ID] = cancel
+	running := *job
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		// Jobs created while the service is paused stay pending until it is resumed
+		s.waitResumed(ctx)
+		done := s.runs.Begin()
+		done(s.run(ctx, &running, twin.DittoID, binding))
+	}()
+
+	return job, nil
+}
+
+// GetJob returns a backfill job of a twin
+func (s *MLBackfillService) GetJob(twinID, jobID uint) (*models.MLBackfillJob, error) {
+	var job models.MLBackfillJob
+	if err := s.jobs.Where("id = ? AND twin_id = ?", jobID, twinID).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("backfill job not found")
+		}
+		return nil, errors.New("database error")
+	}
+	return &job, nil
+}
+
+// Wait blocks until the running backfill jobs have finished
+func (s *MLBackfillService) Wait() {
+	s.wg.Wait()
+}
+
+// findBinding returns the binding of the task to the twin
+func (s *MLBackfillService) findBinding(twinID, taskID uint) (*models.MLTaskBinding, error) {
+	bindings, err := s.mlRepo.ListMLTaskBindingsByTwinID(twinID)
+	if err != nil {
+		return nil, errors.New("database error")
+	}
+	for i := range bindings {
+		if bindings[i].TaskID == taskID {
+			return &bindings[i], nil
+		}
+	}
+	return nil, errors.New("ML task is not bound to the twin")
+}
+
+// run sends the stored values of each mapped feature within the job's window, oldest first,
+// and returns why the job failed, if it did
+func (s *MLBackfillService) run(ctx context.Context, job *models.MLBackfillJob, thingID string, binding *models.MLTaskBinding) error {
+	defer func() {
+		s.mutex.Lock()
+		delete(s.running, job.ID)
+		s.mutex.Unlock()
+	}()
+
+	s.update(job, map[string]interface{}{"status": models.MLBackfillRunning})
+
+	features, err := s.backfillFeatures(thingID, binding)
+	if err != nil {
+		return s.finish(job, models.MLBackfillFailed, err)
+	}
+
+	tag := MLBackfillTag{JobID: job.ID}
+	for _, feature := range features {
+		for offset := 0; ; offset += backfillPageSize {
+			s.waitResumed(ctx)
+			if ctx.Err() != nil {
+				return s.finish(job, models.MLBackfillCanceled, nil)
+			}
+
+			points, err := s.timeseriesRepo.GetTimeseriesData(ctx, thingID, feature, job.Start, job.End, repository.TimeseriesPage{
+				Limit:     backfillPageSize,
+				Offset:    offset,
+				Ascending: true,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					return s.finish(job, models.MLBackfillCanceled, nil)
+				}
+				return s.finish(job, models.MLBackfillFailed, err)
+			}
+
+			for _, point := range points {
+				mlInput := map[string]interface{}{
+					"thingId":   thingID,
+					"featureId": feature,
+					"timestamp": point.Time,
+					"data":      pointData(point),
+					"backfill":  tag,
+				}
+				if err := s.kafkaManager.ProduceMLInput(binding.Task.ModelID, mlInput); err != nil {
+					return s.finish(job, models.MLBackfillFailed, err)
+				}
+				job.Produced++
+			}
+			s.update(job, map[string]interface{}{"produced": job.Produced})
+
+			if len(points) < backfillPageSize {
+				break
+			}
+		}
+	}
+
+	return s.finish(job, models.MLBackfillCompleted, nil)
+}
+
+// backfillFeatures returns the features the binding takes as input: those of its input
+// mapping, or every stored feature of the twin if the mapping lists none
+func (s *MLBackfillService) backfillFeatures(thingID string, binding *models.MLTaskBinding) ([]string, error) {
+	var mapping MLInputMapping
+	if strings.TrimSpace(binding.InputMappingJSON) != "" {
+		if err := json.Unmarshal([]byte(binding.InputMappingJSON), &mapping); err != nil {
+			return nil, errors.New("invalid input mapping of the ML task binding")
+		}
+	}
+	if len(mapping.Features) > 0 {
+		return mapping.Features, nil
+	}
+	return s.timeseriesRepo.ListFeaturePaths(thingID)
+}
+
+// update stores changed columns of a job
+func (s *MLBackfillService) update(job *models.MLBackfillJob, columns map[string]interface{}) {
+	if err := s.jobs.Model(job).Updates(columns).Error; err != nil {
+		s.logger.Error("Failed to update ML backfill job", zap.Uint("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// finish records the outcome of a job, returning the cause it failed with
+func (s *MLBackfillService) finish(job *models.MLBackfillJob, status string, cause error) error {
+	now := time.Now()
+	columns := map[string]interface{}{
+		"status":       status,
+		"produced":     job.Produced,
+		"completed_at": &now,
+	}
+	if cause != nil {
+		columns["error"] = cause.Error()
+		s.logger.Error("ML backfill failed", zap.Uint("job_id", job.ID), zap.Error(cause))
+	}
+	s.update(job, columns)
+	return cause
+}
+
+// Name returns the component name
+func (s *MLBackfillService) Name() string {
+	return "ml-backfill"
+}
+
+// Start marks the jobs left unfinished by a previous run as canceled; they are not resumed
+func (s *MLBackfillService) Start(ctx context.Context) error {
+	now := time.Now()
+	if err := s.jobs.Model(&models.MLBackfillJob{}).
+		Where("status IN ?", []string{models.MLBackfillPending, models.MLBackfillRunning}).
+		Updates(map[string]interface{}{"status": models.MLBackfillCanceled, "completed_at": &now}).Error; err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.started = true
+	return nil
+}
+
+// Stop cancels the running jobs and waits for them to record their status
+func (s *MLBackfillService) Stop(ctx context.Context) error {
+	s.mutex.Lock()
+	s.started = false
+	for _, cancel := range s.running {
+		cancel()
+	}
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Trigger returns ErrWorkerOnDemand; backfills only run when users request them
+func (s *MLBackfillService) Trigger() error {
+	return lifecycle.ErrWorkerOnDemand
+}
+
+// Pause holds the running jobs before their next page and new jobs before they start
+func (s *MLBackfillService) Pause() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resumed == nil {
+		s.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets the held jobs continue
+func (s *MLBackfillService) Resume() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resumed != nil {
+		close(s.resumed)
+		s.resumed = nil
+	}
+}
+
+// Status returns the state of the service and its last job
+func (s *MLBackfillService) Status() lifecycle.WorkerStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.runs.Status(s.Name(), 0, s.started, s.resumed != nil)
+}
+
+// waitResumed blocks while the service is paused, or until the context is canceled
+func (s *MLBackfillService) waitResumed(ctx context.Context) {
+	s.mutex.Lock()
+	resumed := s.resumed
+	s.mutex.Unlock()
+	if resumed == nil {
+		return
+	}
+
+	select {
+	case <-resumed:
+	case <-ctx.Done():
+	}
+}
+
+// pointData returns the JSON value of a stored point
+func pointData(point models.TimeseriesData) json.RawMessage {
+	switch point.ValueType {
+	case "number":
+		return json.RawMessage(strconv.FormatFloat(point.ValueNum, 'f', -1, 64))
+	case "boolean":
+		if point.ValueBool != nil {
+			return json.RawMessage(strconv.FormatBool(*point.ValueBool))
+		}
+	case "string":
+		if data, err := json.Marshal(point.ValueStr); err == nil {
+			return data
+		}
+	default:
+		if point.ValueJSON != "" {
+			return json.RawMessage(point.ValueJSON)
+		}
+	}
+	return json.RawMessage("null")
+}
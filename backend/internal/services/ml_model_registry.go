@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// MLModelBundleFormat identifies the format of ML model metadata bundles
+const MLModelBundleFormat = "digital-egiz/ml-models/v1"
+
+// mlModelTypes are the task types a model may be registered for
+var mlModelTypes = map[models.MLTaskType]bool{
+	models.MLTaskTypeAnomaly:        true,
+	models.MLTaskTypePrediction:     true,
+	models.MLTaskTypeClassification: true,
+}
+
+// MLModelBundle is a portable copy of the ML model registry, for keeping it in version
+// control and promoting it between environments
+type MLModelBundle struct {
+	Format     string              `json:"format"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Models     []MLModelDefinition `json:"models"`
+}
+
+// MLModelDefinition is the metadata of one model in a bundle, identified by its model ID
+type MLModelDefinition struct {
+	ModelID      string            `json:"model_id"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description,omitempty"`
+	Type         models.MLTaskType `json:"type"`
+	Version      string            `json:"version"`
+	InputSchema  json.RawMessage   `json:"input_schema,omitempty"`
+	OutputSchema json.RawMessage   `json:"output_schema,omitempty"`
+}
+
+// MLModelImportProblem is why a model of a bundle cannot be imported
+type MLModelImportProblem struct {
+	// Index is the position of the model in the bundle
+	Index   int    `json:"index"`
+	ModelID string `json:"model_id"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+	// SchemaErrors are the problems of an invalid input or output schema
+	SchemaErrors []utils.SchemaError `json:"schema_errors,omitempty"`
+}
+
+// MLModelImportResult reports the outcome of importing a bundle. Bundles are imported all
+// or nothing: if any model has errors or conflicts, none is applied.
+type MLModelImportResult struct {
+	Applied   bool                   `json:"applied"`
+	Created   []string               `json:"created"`
+	Updated   []string               `json:"updated"`
+	Unchanged []string               `json:"unchanged"`
+	Errors    []MLModelImportProblem `json:"errors,omitempty"`
+	Conflicts []MLModelImportProblem `json:"conflicts,omitempty"`
+}
+
+// MLModelService manages the registry of ML model metadata
+type MLModelService struct {
+	logger *utils.Logger
+	mlRepo repository.MLRepository
+}
+
+// NewMLModelService creates a new ML model service
+func NewMLModelService(db *db.Database, logger *utils.Logger) *MLModelService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &MLModelService{
+		logger: logger.Named("ml_model_service"),
+		mlRepo: repoFactory.ML(),
+	}
+}
+
+// Export returns the metadata of every registered model as a bundle
+func (s *MLModelService) Export() (*MLModelBundle, error) {
+	metadata, err := s.mlRepo.ListAllMLModelMetadata()
+	if err != nil {
+		s.logger.Error("Failed to list ML model metadata", zap.Error(err))
+		return nil, errors.New("failed to retrieve ML models")
+	}
+
+	bundle := &MLModelBundle{
+		Format:     MLModelBundleFormat,
+		ExportedAt: time.Now().UTC(),
+		Models:     make([]MLModelDefinition, 0, len(metadata)),
+	}
+	for _, model := range metadata {
+		bundle.Models = append(bundle.Models, MLModelDefinition{
+			ModelID:      model.ModelID,
+			Name:         model.Name,
+			Description:  model.Description,
+			Type:         model.Type,
+			Version:      model.Version,
+			InputSchema:  exportSchema(model.InputSchema),
+			OutputSchema: exportSchema(model.OutputSchema),
+		})
+	}
+	return bundle, nil
+}
+
+// Import upserts the models of a bundle by model ID. Models must have a name, version and
+// known type, and their schemas must be valid JSON Schemas. A model conflicts if it appears
+// twice in the bundle, or if ML tasks use it and the bundle changes its type.
+func (s *MLModelService) Import(bundle *MLModelBundle) (*MLModelImportResult, error) {
+	if bundle.Format != MLModelBundleFormat {
+		return nil, fmt.Errorf("unsupported bundle format: %q", bundle.Format)
+	}
+
+	result := &MLModelImportResult{Created: []string{}, Updated: []string{}, Unchanged: []string{}}
+	imported := make([]models.MLModelMetadata, len(bundle.Models))
+	seen := make(map[string]int)
+	modelIDs := make([]string, 0, len(bundle.Models))
+	for i, definition := range bundle.Models {
+		problem := func(field, message string) {
+			result.Errors = append(result.Errors, MLModelImportProblem{
+				Index: i, ModelID: definition.ModelID, Field: field, Message: message,
+			})
+		}
+
+		if definition.ModelID == "" {
+			problem("model_id", "model ID is required")
+		} else if first, ok := seen[definition.ModelID]; ok {
+			result.Conflicts = append(result.Conflicts, MLModelImportProblem{
+				Index: i, ModelID: definition.ModelID,
+				Message: fmt.Sprintf("model ID is also used by model %d of the bundle", first),
+			})
+		} else {
+			seen[definition.ModelID] = i
+			modelIDs = append(modelIDs, definition.ModelID)
+		}
+		if definition.Name == "" {
+			problem("name", "name is required")
+		}
+		if definition.Version == "" {
+			problem("version", "version is required")
+		}
+		if !mlModelTypes[definition.Type] {
+			problem("type", fmt.Sprintf("unknown model type: %q", definition.Type))
+		}
+
+		inputSchema, inputErrors := importSchema(definition.InputSchema)
+		if inputErrors != nil {
+			result.Errors = append(result.Errors, MLModelImportProblem{
+				Index: i, ModelID: definition.ModelID, Field: "input_schema",
+				Message: "input schema is not a valid JSON Schema", SchemaErrors: inputErrors,
+			})
+		}
+		outputSchema, outputErrors := importSchema(definition.OutputSchema)
+		if outputErrors != nil {
+			result.Errors = append(result.Errors, MLModelImportProblem{
+				Index: i, ModelID: definition.ModelID, Field: "output_schema",
+				Message: "output schema is not a valid JSON Schema", SchemaErrors: outputErrors,
+			})
+		}
+
+		imported[i] = models.MLModelMetadata{
+			ModelID:      definition.ModelID,
+			Name:         definition.Name,
+			Description:  definition.Description,
+			Type:         definition.Type,
+			Version:      definition.Version,
+			InputSchema:  inputSchema,
+			OutputSchema: outputSchema,
+		}
+	}
+
+	existing, err := s.mlRepo.ListAllMLModelMetadata()
+	if err != nil {
+		s.logger.Error("Failed to list ML model metadata", zap.Error(err))
+		return nil, errors.New("failed to retrieve ML models")
+	}
+	current := make(map[string]models.MLModelMetadata, len(existing))
+	for _, model := range existing {
+		current[model.ModelID] = model
+	}
+
+	// Retyping a model would feed its tasks to a model of another kind
+	tasks, err := s.mlRepo.ListMLTasksByModelIDs(modelIDs)
+	if err != nil {
+		s.logger.Error("Failed to list ML tasks of models", zap.Error(err))
+		return nil, errors.New("failed to retrieve ML tasks")
+	}
+	for _, task := range tasks {
+		i := seen[task.ModelID]
+		model, ok := current[task.ModelID]
+		if !ok || model.Type == imported[i].Type || task.Type == imported[i].Type {
+			continue
+		}
+		result.Conflicts = append(result.Conflicts, MLModelImportProblem{
+			Index: i, ModelID: task.ModelID, Field: "type",
+			Message: fmt.Sprintf("ML task %q uses the model for %s", task.Name, task.Type),
+		})
+	}
+
+	if len(result.Errors) > 0 || len(result.Conflicts) > 0 {
+		return result, nil
+	}
+
+	var changes []models.MLModelMetadata
+	for _, model := range imported {
+		previous, ok := current[model.ModelID]
+		switch {
+		case !ok:
+			result.Created = append(result.Created, model.ModelID)
+		case sameMLModel(previous, model):
+			result.Unchanged = append(result.Unchanged, model.ModelID)
+			continue
+		default:
+			model.ID = previous.ID
+			result.Updated = append(result.Updated, model.ModelID)
+		}
+		changes = append(changes, model)
+	}
+
+	if err := s.mlRepo.ImportMLModelMetadata(changes); err != nil {
+		s.logger.Error("Failed to import ML model metadata", zap.Error(err))
+		return nil, errors.New("failed to import ML models")
+	}
+	result.Applied = true
+
+	s.logger.Info("Imported ML model metadata",
+		zap.Int("created", len(result.Created)),
+		zap.Int("updated", len(result.Updated)),
+		zap.Int("unchanged", len(result.Unchanged)))
+	return result, nil
+}
+
+// sameMLModel reports whether importing a model would leave its stored metadata as is
+func sameMLModel(stored, imported models.MLModelMetadata) bool {
+	return stored.Name == imported.Name &&
+		stored.Description == imported.Description &&
+		stored.Type == imported.Type &&
+		stored.Version == imported.Version &&
+		compactSchema(stored.InputSchema) == imported.InputSchema &&
+		compactSchema(stored.OutputSchema) == imported.OutputSchema
+}
+
+// exportSchema returns a stored schema as JSON, quoting it if it is not valid JSON so the
+// bundle stays well-formed
+func exportSchema(schema string) json.RawMessage {
+	if schema == "" {
+		return nil
+	}
+	if json.Valid([]byte(schema)) {
+		return json.RawMessage(schema)
+	}
+	quoted, _ := json.Marshal(schema)
+	return quoted
+}
+
+// importSchema checks a schema of a bundle, returning it compacted for storage or the
+// reasons it is invalid. An absent or null schema is stored as empty.
+func importSchema(schema json.RawMessage) (string, []utils.SchemaError) {
+	trimmed := bytes.TrimSpace(schema)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return "", nil
+	}
+	if check := utils.CheckJSONSchema(trimmed, nil); !check.Valid {
+		return "", check.Errors
+	}
+	return compactSchema(string(trimmed)), nil
+}
+
+// compactSchema removes insignificant whitespace from a schema so equal schemas compare equal
+func compactSchema(schema string) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(schema)); err != nil {
+		return schema
+	}
+	return buf.String()
+}
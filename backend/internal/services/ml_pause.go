@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ML pause scopes
+const (
+	MLPauseScopeTwin    = "twin"
+	MLPauseScopeProject = "project"
+)
+
+// mlPauseTTL is how long the ML pause state of a twin or project is cached. Pauses changed
+// through this instance take effect at once; changes made elsewhere within this time.
+const mlPauseTTL = 5 * time.Second
+
+// ErrInvalidMLPause is returned for a pause that would already have expired
+var ErrInvalidMLPause = errors.New("ml pause must end in the future")
+
+// MLPause describes a pause of ML forwarding in effect for a twin
+type MLPause struct {
+	// Scope is where the pause was set, the twin itself or its project
+	Scope string `json:"scope"`
+	// Until is when the pause ends; nil pauses until it is lifted
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// mlPauseActive reports whether a pause flag is in effect at the given time
+func mlPauseActive(paused bool, until *time.Time, now time.Time) bool {
+	return paused && (until == nil || now.Before(*until))
+}
+
+// EffectiveMLPause returns the pause of ML forwarding in effect for a twin, its own before its
+// project's, or nil when its values are forwarded. The project may be nil.
+func EffectiveMLPause(twin *models.Twin, project *models.Project, now time.Time) *MLPause {
+	if mlPauseActive(twin.MLPaused, twin.MLPausedUntil, now) {
+		return &MLPause{Scope: MLPauseScopeTwin, Until: twin.MLPausedUntil}
+	}
+	if project != nil && mlPauseActive(project.MLPaused, project.MLPausedUntil, now) {
+		return &MLPause{Scope: MLPauseScopeProject, Until: project.MLPausedUntil}
+	}
+	return nil
+}
+
+// cachedMLPause holds the pause flag of a twin or project as loaded at a point in time
+type cachedMLPause struct {
+	loaded    time.Time
+	paused    bool
+	until     *time.Time
+	projectID uint // of a twin
+}
+
+// MLPauseCache caches the ML pause state of twins and projects, so the pause checks of ML
+// forwarding and ML output do not query the database for every message
+type MLPauseCache struct {
+	twinRepo    repository.TwinRepository
+	projectRepo repository.ProjectRepository
+	logger      *utils.Logger
+
+	mu       sync.Mutex
+	twins    map[string]cachedMLPause // by Ditto ID
+	projects map[uint]cachedMLPause
+}
+
+// NewMLPauseCache creates a new ML pause cache
+func NewMLPauseCache(db *db.Database, logger *utils.Logger) *MLPauseCache {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &MLPauseCache{
+		twinRepo:    repoFactory.Twin(),
+		projectRepo: repoFactory.Project(),
+		logger:      logger.Named("ml_pause"),
+		twins:       make(map[string]cachedMLPause),
+		projects:    make(map[uint]cachedMLPause),
+	}
+}
+
+// Paused reports whether forwarding a thing's values to ML is paused, by its twin or the
+// twin's project. Things without a twin are not paused.
+func (c *MLPauseCache) Paused(thingID string, now time.Time) bool {
+	c.mu.Lock()
+	cached, ok := c.twins[thingID]
+	c.mu.Unlock()
+
+	if !ok || now.Sub(cached.loaded) >= mlPauseTTL {
+		twin, err := c.twinRepo.GetByDittoID(thingID)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				c.logger.Warn("Failed to get twin for ML pause", zap.String("thingId", thingID), zap.Error(err))
+			}
+			return false
+		}
+		cached = cachedMLPause{loaded: now, paused: twin.MLPaused, until: twin.MLPausedUntil, projectID: twin.ProjectID}
+		c.mu.Lock()
+		c.twins[thingID] = cached
+		c.mu.Unlock()
+	}
+
+	return mlPauseActive(cached.paused, cached.until, now) || c.ProjectPaused(cached.projectID, now)
+}
+
+// ProjectPaused reports whether forwarding the values of a project's twins to ML is paused
+func (c *MLPauseCache) ProjectPaused(projectID uint, now time.Time) bool {
+	c.mu.Lock()
+	cached, ok := c.projects[projectID]
+	c.mu.Unlock()
+
+	if !ok || now.Sub(cached.loaded) >= mlPauseTTL {
+		project, err := c.projectRepo.GetByID(projectID)
+		if err != nil {
+			if !errors.Is(err, repository.ErrNotFound) {
+				c.logger.Warn("Failed to get project for ML pause", zap.Uint("project_id", projectID), zap.Error(err))
+			}
+			return false
+		}
+		cached = cachedMLPause{loaded: now, paused: project.MLPaused, until: project.MLPausedUntil}
+		c.mu.Lock()
+		c.projects[projectID] = cached
+		c.mu.Unlock()
+	}
+
+	return mlPauseActive(cached.paused, cached.until, now)
+}
+
+// InvalidateTwin drops the cached pause state of a twin after its pause changed
+func (c *MLPauseCache) InvalidateTwin(thingID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.twins, thingID)
+}
+
+// InvalidateProject drops the cached pause state of a project after its pause changed
+func (c *MLPauseCache) InvalidateProject(projectID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.projects, projectID)
+}
+
+// validateMLPause checks the end of a pause; resuming clears it
+func validateMLPause(paused bool, until *time.Time) (*time.Time, error) {
+	if !paused {
+		return nil, nil
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil, ErrInvalidMLPause
+	}
+	return until, nil
+}
+
+// SetMLPause pauses or resumes forwarding a twin's values to ML, optionally until a given time.
+// Values keep being stored while paused.
+func (s *TwinService) SetMLPause(id uint, paused bool, until *time.Time) (*models.Twin, error) {
+	until, err := validateMLPause(paused, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twinRepo.SetMLPause(id, paused, until); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to set ML pause", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("failed to set ML pause")
+	}
+
+	s.logger.Info("Set twin ML pause", zap.Uint("id", id), zap.Bool("paused", paused), zap.Timep("until", until))
+	twin, err := s.GetByID(id)
+	if err == nil && s.mlPauses != nil {
+		s.mlPauses.InvalidateTwin(twin.DittoID)
+	}
+	return twin, err
+}
+
+// GetMLPause returns the pause of ML forwarding in effect for a twin, or nil
+func (s *TwinService) GetMLPause(twin *models.Twin) (*MLPause, error) {
+	project, err := s.projectRepo.GetByID(twin.ProjectID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.Error("Failed to get project", zap.Uint("id", twin.ProjectID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	return EffectiveMLPause(twin, project, time.Now()), nil
+}
+
+// SetMLPause pauses or resumes forwarding the values of all twins in a project to ML,
+// optionally until a given time
+func (s *ProjectService) SetMLPause(id uint, paused bool, until *time.Time) (*models.Project, error) {
+	until, err := validateMLPause(paused, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.projectRepo.SetMLPause(id, paused, until); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("project not found")
+		}
+		s.logger.Error("Failed to set ML pause", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("failed to set ML pause")
+	}
+
+	s.logger.Info("Set project ML pause", zap.Uint("id", id), zap.Bool("paused", paused), zap.Timep("until", until))
+	if s.mlPauses != nil {
+		s.mlPauses.InvalidateProject(id)
+	}
+	return s.GetByID(id)
+}
+
+// mlPaused reports whether forwarding the twin's values to ML is paused. The twin is loaded
+// for every value, so only its project's pause is taken from the cache.
+func (s *IngestService) mlPaused(twin *models.Twin, now time.Time) bool {
+	return mlPauseActive(twin.MLPaused, twin.MLPausedUntil, now) || s.mlPauses.ProjectPaused(twin.ProjectID, now)
+}
+
+// mlOutputPaused reports whether ML output for a thing is dropped because its ML forwarding
+// is paused. Predictions still in flight when the pause was set are not stored.
+func (h *KafkaHandler) mlOutputPaused(thingID string) bool {
+	return h.mlPauses.Paused(thingID, time.Now())
+}
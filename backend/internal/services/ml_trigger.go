@@ -0,0 +1,152 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+)
+
+// Schedule types of an ML task binding
+const (
+	// MLScheduleEvent forwards feature values to ML as they arrive
+	MLScheduleEvent = "event"
+	// MLScheduleInterval forwards at most one feature value per interval
+	MLScheduleInterval = "interval"
+	// MLScheduleCron runs the task on a schedule; arriving values are not forwarded
+	MLScheduleCron = "cron"
+)
+
+// MLInputMapping is the input mapping of an ML task binding
+type MLInputMapping struct {
+	// Features lists the feature IDs sent to the task; empty means all features of the twin
+	Features []string `json:"features"`
+}
+
+// MLTriggerConfig is the schedule config of an ML task binding, deciding which arriving
+// values are forwarded to ML
+type MLTriggerConfig struct {
+	// MinDelta skips numeric values that differ from the last forwarded one by no more than this
+	MinDelta float64 `json:"min_delta"`
+	// MinInterval is the minimum number of seconds between two forwarded values
+	MinInterval int `json:"min_interval"`
+	// Interval is the number of seconds between forwarded values of "interval" bindings
+	Interval int `json:"interval"`
+}
+
+// mlTriggerKey identifies the values of one feature of a twin forwarded for one binding
+type mlTriggerKey struct {
+	bindingID uint
+	thingID   string
+	featureID string
+}
+
+// mlForwarded is the last value forwarded for a binding and feature
+type mlForwarded struct {
+	at    time.Time
+	point models.TimeseriesData
+}
+
+// MLTriggerGate decides per ML task binding whether an arriving feature value is forwarded
+// to ML, remembering the last forwarded value and time of each twin feature
+type MLTriggerGate struct {
+	mu   sync.Mutex
+	last map[mlTriggerKey]mlForwarded
+}
+
+// NewMLTriggerGate creates a gate that has not forwarded any values yet
+func NewMLTriggerGate() *MLTriggerGate {
+	return &MLTriggerGate{last: make(map[mlTriggerKey]mlForwarded)}
+}
+
+// BindingCoversFeature reports whether an active binding of an active task takes the feature as input
+func BindingCoversFeature(binding *models.MLTaskBinding, featureID string) bool {
+	if !binding.Active || (binding.Task.ID != 0 && !binding.Task.Active) {
+		return false
+	}
+	if binding.ScheduleType == MLScheduleCron {
+		return false
+	}
+
+	var mapping MLInputMapping
+	if strings.TrimSpace(binding.InputMappingJSON) != "" {
+		if err := json.Unmarshal([]byte(binding.InputMappingJSON), &mapping); err != nil {
+			return false
+		}
+	}
+	if len(mapping.Features) == 0 {
+		return true
+	}
+	for _, feature := range mapping.Features {
+		if feature == featureID {
+			return true
+		}
+	}
+	return false
+}
+
+// Admit reports whether a value observed at the given time is forwarded for the binding,
+// and if so records it as the binding's last forwarded value of the feature.
+// The first value of a feature is always forwarded.
+func (g *MLTriggerGate) Admit(binding *models.MLTaskBinding, thingID, featureID string, point *models.TimeseriesData, now time.Time) bool {
+	cfg := parseMLTriggerConfig(binding)
+	minInterval := time.Duration(cfg.MinInterval) * time.Second
+	if binding.ScheduleType == MLScheduleInterval && time.Duration(cfg.Interval)*time.Second > minInterval {
+		minInterval = time.Duration(cfg.Interval) * time.Second
+	}
+
+	key := mlTriggerKey{bindingID: binding.ID, thingID: thingID, featureID: featureID}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if last, ok := g.last[key]; ok {
+		if minInterval > 0 && now.Sub(last.at) < minInterval {
+			return false
+		}
+		if !significantChange(&last.point, point, cfg.MinDelta) {
+			return false
+		}
+	}
+
+	g.last[key] = mlForwarded{at: now, point: *point}
+	return true
+}
+
+// parseMLTriggerConfig parses a binding's schedule config; invalid configs apply no gating
+func parseMLTriggerConfig(binding *models.MLTaskBinding) MLTriggerConfig {
+	var cfg MLTriggerConfig
+	if strings.TrimSpace(binding.ScheduleConfig) != "" {
+		if err := json.Unmarshal([]byte(binding.ScheduleConfig), &cfg); err != nil {
+			return MLTriggerConfig{}
+		}
+	}
+	return cfg
+}
+
+// significantChange reports whether a value differs enough from the last forwarded one.
+// Without a minimum delta every value counts; otherwise numbers must change by more than
+// the delta and other values must change at all.
+func significantChange(last, next *models.TimeseriesData, minDelta float64) bool {
+	if minDelta <= 0 {
+		return true
+	}
+	if last.ValueType == "number" && next.ValueType == "number" {
+		return math.Abs(next.ValueNum-last.ValueNum) > minDelta
+	}
+	return last.ValueType != next.ValueType ||
+		!sameBool(last.ValueBool, next.ValueBool) ||
+		last.ValueStr != next.ValueStr ||
+		last.ValueJSON != next.ValueJSON
+}
+
+// sameBool compares two optional booleans
+func sameBool(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
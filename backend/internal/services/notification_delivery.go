@@ -0,0 +1,507 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Delivery channel names
+const (
+	DeliveryChannelWebhook   = "webhook"
+	DeliveryChannelWebSocket = "websocket"
+	DeliveryChannelKafka     = "kafka"
+)
+
+// deliveryRetryBatchSize is the number of due deliveries retried in one pass
+const deliveryRetryBatchSize = 100
+
+// DeliveryChannel sends notifications to the recipients of one outbound channel
+type DeliveryChannel interface {
+	// Name identifies the channel in delivery receipts
+	Name() string
+	// Recipients lists the recipients of a notification on this channel
+	Recipients(notification *models.Notification) ([]string, error)
+	// Send delivers a notification to one recipient
+	Send(recipient string, notification *models.Notification) error
+}
+
+// RecipientValidator is implemented by channels that can check a recipient exists before
+// notifications are routed to it
+type RecipientValidator interface {
+	// ValidateRecipient checks that a recipient of the project exists on the channel
+	ValidateRecipient(projectID uint, recipient string) error
+}
+
+// DeliveryTarget selects the recipients of a channel a notification is sent to; without
+// recipients it is sent to every recipient of the channel
+type DeliveryTarget struct {
+	Channel    string
+	Recipients []string
+}
+
+// NotificationReceipt is a stored notification and the outcome of its deliveries
+type NotificationReceipt struct {
+	Notification *models.Notification          `json:"notification"`
+	Deliveries   []models.NotificationDelivery `json:"deliveries"`
+}
+
+// DeliveryService sends notifications over the registered channels and records a receipt
+// per recipient. Failed deliveries are retried with exponential backoff until they succeed
+// or run out of attempts.
+type DeliveryService struct {
+	logger           *utils.Logger
+	config           config.NotificationConfig
+	notificationRepo repository.NotificationRepository
+
+	mu       sync.RWMutex
+	channels []DeliveryChannel
+	now      func() time.Time
+
+	// The retries of due deliveries
+	*lifecycle.ScheduledWorker
+}
+
+// NewDeliveryService creates a new delivery service without channels
+func NewDeliveryService(db *db.Database, cfg *config.NotificationConfig, logger *utils.Logger) *DeliveryService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	s := &DeliveryService{
+		logger:           logger.Named("delivery_service"),
+		config:           *cfg,
+		notificationRepo: repoFactory.Notification(),
+		now:              time.Now,
+	}
+
+	interval := time.Duration(cfg.RetryInterval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	s.ScheduledWorker = lifecycle.NewScheduledWorker("notification-delivery", interval, func(ctx context.Context) error {
+		_, err := s.RetryDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("Notification delivery retry failed", zap.Error(err))
+		}
+		return err
+	})
+	return s
+}
+
+// RegisterChannel adds a channel that notifications are delivered over
+func (s *DeliveryService) RegisterChannel(channel DeliveryChannel) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.channels = append(s.channels, channel)
+}
+
+// SetClock replaces the service's time source, for tests
+func (s *DeliveryService) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// Broadcast stores a project notification and delivers it to every recipient of every channel.
+// A failed delivery does not stop the others; the receipt reports the outcome of each one, and
+// failed deliveries are retried later. An error is only returned if the notification cannot be stored.
+func (s *DeliveryService) Broadcast(projectID uint, eventType string, payload interface{}) (*NotificationReceipt, error) {
+	return s.Deliver(projectID, eventType, payload, nil)
+}
+
+// Deliver stores a project notification and delivers it to the given targets, or like
+// Broadcast to every channel without targets. A target on a channel that is not registered
+// gets a failed delivery per recipient.
+func (s *DeliveryService) Deliver(projectID uint, eventType string, payload interface{}, targets []DeliveryTarget) (*NotificationReceipt, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification payload: %w", err)
+	}
+	eventID, err := generateDeliveryID()
+	if err != nil {
+		return nil, errors.New("failed to create notification")
+	}
+
+	notification := &models.Notification{
+		ProjectID: projectID,
+		EventType: eventType,
+		EventID:   eventID,
+		Payload:   models.JSON(body),
+	}
+	if err := s.notificationRepo.Create(notification); err != nil {
+		s.logger.Error("Failed to store notification", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("failed to create notification")
+	}
+
+	if targets == nil {
+		for _, channel := range s.registeredChannels() {
+			targets = append(targets, DeliveryTarget{Channel: channel.Name()})
+		}
+	}
+
+	receipt := &NotificationReceipt{Notification: notification, Deliveries: []models.NotificationDelivery{}}
+	for _, target := range targets {
+		channel := s.channel(target.Channel)
+		recipients := target.Recipients
+		if len(recipients) == 0 && channel != nil {
+			recipients, err = channel.Recipients(notification)
+			if err != nil {
+				s.logger.Error("Failed to list notification recipients",
+					zap.String("channel", target.Channel),
+					zap.Uint("notification_id", notification.ID),
+					zap.Error(err))
+				continue
+			}
+		}
+
+		for _, recipient := range recipients {
+			delivery := &models.NotificationDelivery{
+				NotificationID: notification.ID,
+				Channel:        target.Channel,
+				Recipient:      recipient,
+				Status:         models.DeliveryStatusPending,
+			}
+			if err := s.notificationRepo.CreateDelivery(delivery); err != nil {
+				s.logger.Error("Failed to store notification delivery",
+					zap.String("channel", target.Channel),
+					zap.String("recipient", recipient),
+					zap.Error(err))
+				continue
+			}
+
+			s.attempt(channel, delivery, notification)
+			receipt.Deliveries = append(receipt.Deliveries, *delivery)
+		}
+	}
+
+	return receipt, nil
+}
+
+// ValidateTarget checks that a target's channel is registered and its recipients exist for the project
+func (s *DeliveryService) ValidateTarget(projectID uint, target DeliveryTarget) error {
+	channel := s.channel(target.Channel)
+	if channel == nil {
+		return fmt.Errorf("unknown delivery channel: %s", target.Channel)
+	}
+
+	validator, ok := channel.(RecipientValidator)
+	if !ok {
+		return nil
+	}
+	for _, recipient := range target.Recipients {
+		if err := validator.ValidateRecipient(projectID, recipient); err != nil {
+			return fmt.Errorf("invalid %s recipient %q: %w", target.Channel, recipient, err)
+		}
+	}
+	return nil
+}
+
+// Deliveries returns a notification and the receipts of its deliveries
+func (s *DeliveryService) Deliveries(notificationID uint) (*NotificationReceipt, error) {
+	notification, err := s.notificationRepo.GetByID(notificationID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("notification not found")
+		}
+		s.logger.Error("Failed to get notification", zap.Uint("id", notificationID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	deliveries, err := s.notificationRepo.ListDeliveries(notificationID)
+	if err != nil {
+		s.logger.Error("Failed to list notification deliveries", zap.Uint("id", notificationID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	return &NotificationReceipt{Notification: notification, Deliveries: deliveries}, nil
+}
+
+// RetryDue attempts the pending deliveries whose retry is due and returns how many were attempted
+func (s *DeliveryService) RetryDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for ctx.Err() == nil {
+		deliveries, err := s.notificationRepo.ListDueDeliveries(s.clock(), deliveryRetryBatchSize)
+		if err != nil {
+			return attempted, fmt.Errorf("failed to list due deliveries: %w", err)
+		}
+		if len(deliveries) == 0 {
+			return attempted, nil
+		}
+
+		for i := range deliveries {
+			if ctx.Err() != nil {
+				break
+			}
+			delivery := &deliveries[i]
+			s.attempt(s.channel(delivery.Channel), delivery, delivery.Notification)
+			attempted++
+		}
+
+		if len(deliveries) < deliveryRetryBatchSize {
+			return attempted, nil
+		}
+	}
+	return attempted, ctx.Err()
+}
+
+// attempt sends a delivery and stores its outcome. Failed deliveries stay pending with their
+// next attempt scheduled until the attempts are used up, after which they are marked failed.
+func (s *DeliveryService) attempt(channel DeliveryChannel, delivery *models.NotificationDelivery, notification *models.Notification) {
+	var err error
+	switch {
+	case channel == nil:
+		err = fmt.Errorf("delivery channel %q is not available", delivery.Channel)
+	case notification == nil:
+		err = errors.New("notification no longer exists")
+	default:
+		err = channel.Send(delivery.Recipient, notification)
+	}
+
+	now := s.clock()
+	delivery.Attempts++
+	delivery.NextAttemptAt = nil
+	if err == nil {
+		delivery.Status = models.DeliveryStatusDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= s.config.MaxAttempts {
+			delivery.Status = models.DeliveryStatusFailed
+		} else {
+			next := now.Add(s.retryDelay(delivery.Attempts))
+			delivery.Status = models.DeliveryStatusPending
+			delivery.NextAttemptAt = &next
+		}
+		s.logger.Warn("Notification delivery failed",
+			zap.String("channel", delivery.Channel),
+			zap.String("recipient", delivery.Recipient),
+			zap.Int("attempts", delivery.Attempts),
+			zap.String("status", delivery.Status),
+			zap.Error(err))
+	}
+
+	if err := s.notificationRepo.UpdateDelivery(delivery); err != nil {
+		s.logger.Error("Failed to store notification delivery outcome", zap.Uint("delivery_id", delivery.ID), zap.Error(err))
+	}
+}
+
+// retryDelay returns the delay after the given number of failed attempts, doubling from the base delay
+func (s *DeliveryService) retryDelay(attempts int) time.Duration {
+	delay := time.Duration(s.config.RetryBaseDelay) * time.Second
+	maxDelay := time.Duration(s.config.RetryMaxDelay) * time.Second
+	for i := 1; i < attempts && (maxDelay <= 0 || delay < maxDelay); i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// registeredChannels returns a snapshot of the registered channels
+func (s *DeliveryService) registeredChannels() []DeliveryChannel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]DeliveryChannel(nil), s.channels...)
+}
+
+// channel returns the registered channel with the given name, or nil
+func (s *DeliveryService) channel(name string) DeliveryChannel {
+	for _, channel := range s.registeredChannels() {
+		if channel.Name() == name {
+			return channel
+		}
+	}
+	return nil
+}
+
+// clock returns the current time of the service's time source
+func (s *DeliveryService) clock() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.now()
+}
+
+// webhookChannel delivers notifications to the active webhook subscriptions of the project
+// that subscribe to the event type. Recipients are subscription IDs.
+type webhookChannel struct {
+	webhookService *WebhookService
+}
+
+// NewWebhookChannel creates a delivery channel posting signed events to webhook subscriptions
+func NewWebhookChannel(webhookService *WebhookService) DeliveryChannel {
+	return &webhookChannel{webhookService: webhookService}
+}
+
+// Name returns the channel name
+func (c *webhookChannel) Name() string {
+	return DeliveryChannelWebhook
+}
+
+// Recipients lists the subscriptions receiving the notification's event type
+func (c *webhookChannel) Recipients(notification *models.Notification) ([]string, error) {
+	subscriptions, err := c.webhookService.webhookRepo.ListByProject(notification.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]string, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if subscription.Active && subscription.Subscribes(notification.EventType) {
+			recipients = append(recipients, strconv.FormatUint(uint64(subscription.ID), 10))
+		}
+	}
+	return recipients, nil
+}
+
+// ValidateRecipient checks that the recipient is a webhook subscription of the project
+func (c *webhookChannel) ValidateRecipient(projectID uint, recipient string) error {
+	id, err := strconv.ParseUint(recipient, 10, 32)
+	if err != nil {
+		return errors.New("not a webhook subscription ID")
+	}
+	if _, err := c.webhookService.webhookRepo.GetByID(projectID, uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("webhook subscription not found")
+		}
+		return fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return nil
+}
+
+// Send posts the notification to a subscription; responses other than 2xx are failures
+func (c *webhookChannel) Send(recipient string, notification *models.Notification) error {
+	id, err := strconv.ParseUint(recipient, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid webhook subscription ID %q", recipient)
+	}
+
+	subscription, err := c.webhookService.webhookRepo.GetByID(notification.ProjectID, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("webhook subscription no longer exists")
+		}
+		return fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	if !subscription.Active {
+		return errors.New("webhook subscription is inactive")
+	}
+
+	result, err := c.webhookService.Deliver(subscription, &WebhookEvent{
+		ID:        notification.EventID,
+		Type:      notification.EventType,
+		ProjectID: notification.ProjectID,
+		Timestamp: notification.CreatedAt.UTC(),
+		Payload:   json.RawMessage(notification.Payload),
+	})
+	if err != nil {
+		return err
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	if result.StatusCode < 200 || result.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with status %d", result.StatusCode)
+	}
+	return nil
+}
+
+// webSocketChannel pushes notifications to the project's websocket clients. The project is the
+// only recipient; a delivery succeeds once the message is queued for the connected clients.
+type webSocketChannel struct {
+	notificationService *NotificationService
+}
+
+// NewWebSocketChannel creates a delivery channel pushing notifications to project websocket clients
+func NewWebSocketChannel(notificationService *NotificationService) DeliveryChannel {
+	return &webSocketChannel{notificationService: notificationService}
+}
+
+// Name returns the channel name
+func (c *webSocketChannel) Name() string {
+	return DeliveryChannelWebSocket
+}
+
+// Recipients returns the notification's project
+func (c *webSocketChannel) Recipients(notification *models.Notification) ([]string, error) {
+	return []string{fmt.Sprintf("project:%d", notification.ProjectID)}, nil
+}
+
+// ValidateRecipient checks that the recipient is the project
+func (c *webSocketChannel) ValidateRecipient(projectID uint, recipient string) error {
+	if recipient != fmt.Sprintf("project:%d", projectID) {
+		return fmt.Errorf("websocket notifications can only be sent to project:%d", projectID)
+	}
+	return nil
+}
+
+// Send queues the notification for the project's clients
+func (c *webSocketChannel) Send(recipient string, notification *models.Notification) error {
+	select {
+	case <-c.notificationService.done:
+		return errors.New("notification service is closed")
+	default:
+	}
+
+	c.notificationService.NotifyProject(notification.ProjectID, NotificationTypeSystemEvent, notification.EventType, map[string]interface{}{
+		"event_id": notification.EventID,
+		"payload":  json.RawMessage(notification.Payload),
+	})
+	return nil
+}
+
+// kafkaChannel publishes notifications to a Kafka topic, the channel's only recipient. The
+// message is the body webhook receivers get, keyed by project so a project's events stay in
+// order; a delivery succeeds once the producer accepts the message.
+type kafkaChannel struct {
+	transport kafka.Transport
+	topic     string
+}
+
+// NewKafkaChannel creates a delivery channel publishing notifications to a Kafka topic
+func NewKafkaChannel(transport kafka.Transport, topic string) DeliveryChannel {
+	return &kafkaChannel{transport: transport, topic: topic}
+}
+
+// Name returns the channel name
+func (c *kafkaChannel) Name() string {
+	return DeliveryChannelKafka
+}
+
+// Recipients returns the topic
+func (c *kafkaChannel) Recipients(notification *models.Notification) ([]string, error) {
+	return []string{c.topic}, nil
+}
+
+// ValidateRecipient checks that the recipient is the topic
+func (c *kafkaChannel) ValidateRecipient(projectID uint, recipient string) error {
+	if recipient != c.topic {
+		return fmt.Errorf("kafka notifications can only be sent to %s", c.topic)
+	}
+	return nil
+}
+
+// Send produces the notification to the topic
+func (c *kafkaChannel) Send(recipient string, notification *models.Notification) error {
+	event := &WebhookEvent{
+		ID:        notification.EventID,
+		Type:      notification.EventType,
+		ProjectID: notification.ProjectID,
+		Timestamp: notification.CreatedAt.UTC(),
+		Payload:   json.RawMessage(notification.Payload),
+	}
+	key := strconv.FormatUint(uint64(notification.ProjectID), 10)
+	return c.transport.ProduceMessage(recipient, key, event, map[string]string{"event_type": notification.EventType})
+}
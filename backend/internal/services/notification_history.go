@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Notification history defaults used when the config leaves them unset
+const (
+	defaultHistoryBatchSize     = 100
+	defaultHistoryFlushInterval = time.Second
+	defaultHistoryQueueSize     = 10000
+	maxHistoryPageSize          = 200
+)
+
+// NotificationHistory keeps real-time notifications so users can review what they missed.
+// Notifications are queued and written in batches, once a batch is full or the flush
+// interval has passed; a full queue drops notifications instead of delaying delivery.
+// While the writer is paused, notifications wait in the queue.
+type NotificationHistory struct {
+	logger           *utils.Logger
+	notificationRepo repository.NotificationRepository
+	types            map[NotificationType]bool
+	batchSize        int
+	flushInterval    time.Duration
+
+	queue   chan models.NotificationRecord
+	dropped atomic.Int64
+	flushes lifecycle.WorkerRuns
+
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	done      chan struct{}
+	trigger   chan struct{}
+	paused    bool
+	nextFlush time.Time
+}
+
+// NotificationHistoryQuery selects a page of the notification history
+type NotificationHistoryQuery struct {
+	repository.NotificationRecordFilter
+	Page     int
+	PageSize int
+}
+
+// NotificationHistoryPage is a page of the notification history
+type NotificationHistoryPage struct {
+	Notifications []models.NotificationRecord `json:"notifications"`
+	Total         int64                       `json:"total"`
+	Page          int                         `json:"page"`
+	Size          int                         `json:"size"`
+}
+
+// NewNotificationHistory creates a notification history recording the configured types
+func NewNotificationHistory(db *db.Database, cfg *config.NotificationConfig, logger *utils.Logger) *NotificationHistory {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	history := &NotificationHistory{
+		logger:           logger.Named("notification_history"),
+		notificationRepo: repoFactory.Notification(),
+		types:            make(map[NotificationType]bool, len(cfg.HistoryTypes)),
+		batchSize:        cfg.HistoryBatchSize,
+		flushInterval:    time.Duration(cfg.HistoryFlushInterval) * time.Millisecond,
+	}
+	for _, notificationType := range cfg.HistoryTypes {
+		history.types[NotificationType(notificationType)] = true
+	}
+	if history.batchSize <= 0 {
+		history.batchSize = defaultHistoryBatchSize
+	}
+	if history.flushInterval <= 0 {
+		history.flushInterval = defaultHistoryFlushInterval
+	}
+	queueSize := cfg.HistoryQueueSize
+	if queueSize <= 0 {
+		queueSize = defaultHistoryQueueSize
+	}
+	history.queue = make(chan models.NotificationRecord, queueSize)
+	return history
+}
+
+// Record queues a notification sent to a project, or to every client if projectID is 0.
+// It never blocks: notifications of other types are ignored and a full queue drops them.
+func (h *NotificationHistory) Record(projectID uint, message *NotificationMessage) {
+	if !h.types[message.Type] {
+		return
+	}
+
+	payload, err := json.Marshal(message.Payload)
+	if err != nil {
+		h.logger.Warn("Failed to marshal notification for history", zap.String("topic", message.Topic), zap.Error(err))
+		return
+	}
+	// Alerts and similar payloads carry their severity
+	var severity struct {
+		Severity string `json:"severity"`
+	}
+	_ = json.Unmarshal(payload, &severity)
+
+	record := models.NotificationRecord{
+		Type:     string(message.Type),
+		Topic:    message.Topic,
+		Severity: severity.Severity,
+		Payload:  models.JSON(payload),
+		Time:     message.Timestamp.UTC(),
+	}
+	if projectID != 0 {
+		record.ProjectID = &projectID
+	}
+
+	select {
+	case h.queue <- record:
+	default:
+		if h.dropped.Add(1)%1000 == 1 {
+			h.logger.Warn("Notification history queue full, dropping notifications", zap.Int64("dropped", h.dropped.Load()))
+		}
+	}
+}
+
+// Dropped returns the number of notifications dropped because the queue was full
+func (h *NotificationHistory) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// List returns a page of the notification history, newest first
+func (h *NotificationHistory) List(query NotificationHistoryQuery) (*NotificationHistoryPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 || query.PageSize > maxHistoryPageSize {
+		query.PageSize = 50
+	}
+	if !query.Start.IsZero() && !query.End.IsZero() && !query.End.After(query.Start) {
+		return nil, errors.New("end time must be after start time")
+	}
+
+	records, total, err := h.notificationRepo.ListRecords(query.NotificationRecordFilter, (query.Page-1)*query.PageSize, query.PageSize)
+	if err != nil {
+		h.logger.Error("Failed to list notification history", zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	if records == nil {
+		records = []models.NotificationRecord{}
+	}
+	return &NotificationHistoryPage{Notifications: records, Total: total, Page: query.Page, Size: query.PageSize}, nil
+}
+
+// Name returns the component name
+func (h *NotificationHistory) Name() string {
+	return "notification-history"
+}
+
+// Start writes queued notifications in batches
+func (h *NotificationHistory) Start(ctx context.Context) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		return nil
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.done = make(chan struct{})
+	h.trigger = make(chan struct{}, 1)
+	h.nextFlush = time.Now().Add(h.flushInterval)
+
+	go h.run(runCtx, h.done, h.trigger)
+	return nil
+}
+
+// Stop stops the writer once the queued notifications are written, even while it is paused
+func (h *NotificationHistory) Stop(ctx context.Context) error {
+	h.mu.Lock()
+	cancel, done := h.cancel, h.done
+	h.cancel = nil
+	h.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notification history not flushed: %w", ctx.Err())
+	}
+}
+
+// Trigger writes the queued notifications without waiting for the flush interval, even
+// while the writer is paused
+func (h *NotificationHistory) Trigger() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel == nil {
+		return lifecycle.ErrWorkerNotRunning
+	}
+
+	select {
+	case h.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pause holds the notifications in the queue until the writer is resumed
+func (h *NotificationHistory) Pause() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paused = true
+}
+
+// Resume writes the notifications held while paused, and in batches again from then on
+func (h *NotificationHistory) Resume() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paused = false
+	if h.cancel == nil {
+		return
+	}
+
+	select {
+	case h.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Status returns the state of the writer and its last batch
+func (h *NotificationHistory) Status() lifecycle.WorkerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := h.flushes.Status(h.Name(), h.flushInterval, h.cancel != nil, h.paused)
+	if h.cancel != nil && !h.paused {
+		nextFlush := h.nextFlush
+		status.NextRun = &nextFlush
+	}
+	return status
+}
+
+// isPaused reports whether the writer is paused
+func (h *NotificationHistory) isPaused() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.paused
+}
+
+// run collects queued notifications into batches until the context is canceled, then
+// writes what is left in the queue
+func (h *NotificationHistory) run(ctx context.Context, done, trigger chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(h.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.NotificationRecord, 0, h.batchSize)
+	for {
+		// While paused, notifications wait in the queue rather than in the batch
+		queue := h.queue
+		if h.isPaused() {
+			queue = nil
+		}
+
+		select {
+		case record := <-queue:
+			batch = append(batch, record)
+			if len(batch) >= h.batchSize && !h.isPaused() {
+				batch = h.flush(batch)
+			}
+		case <-ticker.C:
+			h.mu.Lock()
+			h.nextFlush = time.Now().Add(h.flushInterval)
+			h.mu.Unlock()
+			if !h.isPaused() {
+				batch = h.flush(batch)
+			}
+		case <-trigger:
+			batch = h.drain(batch)
+		case <-ctx.Done():
+			h.drain(batch)
+			return
+		}
+	}
+}
+
+// drain writes a batch and every notification queued, returning the batch emptied for reuse
+func (h *NotificationHistory) drain(batch []models.NotificationRecord) []models.NotificationRecord {
+	for {
+		select {
+		case record := <-h.queue:
+			batch = append(batch, record)
+			if len(batch) >= h.batchSize {
+				batch = h.flush(batch)
+			}
+		default:
+			return h.flush(batch)
+		}
+	}
+}
+
+// flush writes a batch and returns it emptied for reuse. A failed batch is logged and dropped.
+func (h *NotificationHistory) flush(batch []models.NotificationRecord) []models.NotificationRecord {
+	if len(batch) == 0 {
+		return batch
+	}
+	finish := h.flushes.Begin()
+	err := h.notificationRepo.CreateRecords(batch)
+	finish(err)
+	if err != nil {
+		h.logger.Error("Failed to write notification history", zap.Int("notifications", len(batch)), zap.Error(err))
+	}
+	return batch[:0]
+}
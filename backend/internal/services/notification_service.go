@@ -2,9 +2,11 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
 	"sync"
 	"time"
 
+	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/utils"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
@@ -17,8 +19,29 @@ type Client struct {
 	projectID uint
 	send      chan []byte
 	topics    map[string]bool
+	// aggregates holds the live aggregate topics the client subscribed to
+	aggregates map[string]bool
+	// isAdmin lets the client receive the admin notifications
+	isAdmin bool
+
+	// closeCode and closeReason are sent in the close frame when the service drops the client
+	closeCode   int
+	closeReason string
 }
 
+// Connection limit errors returned by RegisterClient
+var (
+	ErrConnectionLimitReached     = errors.New("websocket connection limit reached")
+	ErrUserConnectionLimitReached = errors.New("websocket connection limit reached for user")
+)
+
+// Close frame reasons sent when a connection limit applies
+const (
+	closeReasonServerFull = "server connection limit reached"
+	closeReasonUserLimit  = "user connection limit reached"
+	closeReasonEvicted    = "closed in favour of a newer connection"
+)
+
 // NotificationType defines types of notification messages
 type NotificationType string
 
@@ -31,6 +54,10 @@ const (
 	NotificationTypeMLPrediction NotificationType = "ml_prediction"
 	// NotificationTypeSystemEvent for system-wide events
 	NotificationTypeSystemEvent NotificationType = "system_event"
+	// NotificationTypeSubscribed confirms a subscription to the client that requested it
+	NotificationTypeSubscribed NotificationType = "subscribed"
+	// NotificationTypeSubscriptionError reports a refused subscription to the client that requested it
+	NotificationTypeSubscriptionError NotificationType = "subscription_error"
 )
 
 // NotificationMessage represents a message sent to clients
@@ -44,49 +71,136 @@ type NotificationMessage struct {
 // NotificationService manages websocket connections and notifications
 type NotificationService struct {
 	logger       *utils.Logger
+	limits       config.WebSocketConfig
 	clients      map[*Client]bool
-	register     chan *Client
+	userClients  map[uint][]*Client // per user, oldest first
 	unregister   chan *Client
 	broadcast    chan *NotificationMessage
 	projectCasts map[uint]chan *NotificationMessage
 	topics       map[string]chan *NotificationMessage
 	mutex        sync.RWMutex
+	done         chan struct{}
+	closeOnce    sync.Once
+
+	// Keeps broadcast and project notifications for the history, if set
+	history *NotificationHistory
+	// Aggregates twin features for clients subscribing to live aggregates, if set
+	liveAggregates *LiveAggregates
 }
 
-// NewNotificationService creates a new notification service
-func NewNotificationService(logger *utils.Logger) *NotificationService {
+// NewNotificationService creates a new notification service; a nil config means no connection limits
+func NewNotificationService(cfg *config.WebSocketConfig, logger *utils.Logger) *NotificationService {
 	service := &NotificationService{
 		logger:       logger.Named("notification_service"),
 		clients:      make(map[*Client]bool),
-		register:     make(chan *Client),
+		userClients:  make(map[uint][]*Client),
 		unregister:   make(chan *Client),
 		broadcast:    make(chan *NotificationMessage),
 		projectCasts: make(map[uint]chan *NotificationMessage),
 		topics:       make(map[string]chan *NotificationMessage),
 		mutex:        sync.RWMutex{},
+		done:         make(chan struct{}),
+	}
+
+	if cfg != nil {
+		service.limits = *cfg
 	}
 
 	go service.run()
 	return service
 }
 
-// RegisterClient adds a new websocket client
-func (s *NotificationService) RegisterClient(conn *websocket.Conn, userID, projectID uint) *Client {
+// SetHistory records broadcast and project notifications in a history. Topic notifications
+// only reach their subscribers and are not recorded.
+func (s *NotificationService) SetHistory(history *NotificationHistory) {
+	s.history = history
+}
+
+// SetLiveAggregates lets clients subscribe to live aggregates of the twins they may view
+func (s *NotificationService) SetLiveAggregates(liveAggregates *LiveAggregates) {
+	s.liveAggregates = liveAggregates
+}
+
+// RegisterClient adds a new websocket client; admins also receive the admin notifications.
+// If a connection limit is exceeded the connection is closed with a close frame explaining why
+// and ErrConnectionLimitReached or ErrUserConnectionLimitReached is returned.
+func (s *NotificationService) RegisterClient(conn *websocket.Conn, userID, projectID uint, isAdmin bool) (*Client, error) {
 	client := &Client{
-		conn:      conn,
-		userID:    userID,
-		projectID: projectID,
-		send:      make(chan []byte, 256),
-		topics:    make(map[string]bool),
+		conn:       conn,
+		userID:     userID,
+		projectID:  projectID,
+		isAdmin:    isAdmin,
+		send:       make(chan []byte, 256),
+		topics:     make(map[string]bool),
+		aggregates: make(map[string]bool),
 	}
 
-	s.register <- client
+	if err := s.admit(client); err != nil {
+		code, reason := websocket.CloseTryAgainLater, closeReasonServerFull
+		if errors.Is(err, ErrUserConnectionLimitReached) {
+			code, reason = websocket.ClosePolicyViolation, closeReasonUserLimit
+		}
+
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		conn.Close()
+
+		s.logger.Warn("Websocket connection rejected",
+			zap.Uint("user_id", userID),
+			zap.String("reason", reason))
+		return nil, err
+	}
+
+	s.logger.Debug("Client registered",
+		zap.Uint("user_id", client.userID),
+		zap.Uint("project_id", client.projectID))
 
 	// Start goroutines for reading and writing
 	go s.readPump(client)
 	go s.writePump(client)
 
-	return client
+	return client, nil
+}
+
+// admit registers a client if the connection limits allow it, evicting the user's
+// oldest connection first when configured to do so
+func (s *NotificationService) admit(client *Client) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	select {
+	case <-s.done:
+		// Service is shutting down; the pumps close the connection
+		close(client.send)
+		return nil
+	default:
+	}
+
+	// Connections to close so the user stays within their limit
+	var evict []*Client
+	userClients := s.userClients[client.userID]
+	if limit := s.limits.MaxConnectionsPerUser; limit > 0 && len(userClients) >= limit {
+		if !s.limits.EvictOldest {
+			return ErrUserConnectionLimitReached
+		}
+		evict = userClients[:len(userClients)-limit+1]
+	}
+
+	if limit := s.limits.MaxConnections; limit > 0 && len(s.clients)-len(evict) >= limit {
+		return ErrConnectionLimitReached
+	}
+
+	for _, oldest := range append([]*Client(nil), evict...) {
+		oldest.closeCode = websocket.ClosePolicyViolation
+		oldest.closeReason = closeReasonEvicted
+		s.removeClientLocked(oldest)
+		s.logger.Info("Evicted oldest websocket connection",
+			zap.Uint("user_id", oldest.userID),
+			zap.Uint("project_id", oldest.projectID))
+	}
+
+	s.clients[client] = true
+	s.userClients[client.userID] = append(s.userClients[client.userID], client)
+	return nil
 }
 
 // SubscribeToTopic subscribes a client to a specific topic
@@ -99,7 +213,7 @@ func (s *NotificationService) SubscribeToTopic(client *Client, topic string) {
 	// Create topic channel if it doesn't exist
 	if _, exists := s.topics[topic]; !exists {
 		s.topics[topic] = make(chan *NotificationMessage, 256)
-		go s.handleTopicMessages(topic)
+		go s.handleTopicMessages(s.topics[topic], topic)
 	}
 
 	s.logger.Debug("Client subscribed to topic",
@@ -107,12 +221,47 @@ func (s *NotificationService) SubscribeToTopic(client *Client, topic string) {
 		zap.String("topic", topic))
 }
 
+// SubscribeToAggregate subscribes a client to the live aggregate of a twin feature over an
+// interval, if its user may view the twin, and confirms the subscription or reports why it
+// was refused to the client
+func (s *NotificationService) SubscribeToAggregate(client *Client, twinID uint, featurePath, interval string) error {
+	if s.liveAggregates == nil {
+		err := errors.New("live aggregates are not available")
+		s.reply(client, NotificationTypeSubscriptionError, "", map[string]string{"error": err.Error()})
+		return err
+	}
+
+	topic, err := s.liveAggregates.Subscribe(client.userID, twinID, featurePath, interval)
+	if err != nil {
+		s.reply(client, NotificationTypeSubscriptionError, LiveAggregateTopic(twinID, featurePath, interval), map[string]string{"error": err.Error()})
+		return err
+	}
+
+	s.mutex.Lock()
+	if _, ok := s.clients[client]; !ok || client.aggregates[topic] {
+		// The client left meanwhile, or was already subscribed
+		s.mutex.Unlock()
+		s.liveAggregates.Unsubscribe(topic)
+	} else {
+		client.aggregates[topic] = true
+		s.mutex.Unlock()
+		s.SubscribeToTopic(client, topic)
+	}
+
+	s.reply(client, NotificationTypeSubscribed, topic, nil)
+	return nil
+}
+
 // UnsubscribeFromTopic unsubscribes a client from a specific topic
 func (s *NotificationService) UnsubscribeFromTopic(client *Client, topic string) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
 	delete(client.topics, topic)
+	if client.aggregates[topic] {
+		delete(client.aggregates, topic)
+		s.liveAggregates.Unsubscribe(topic)
+	}
 
 	s.logger.Debug("Client unsubscribed from topic",
 		zap.Uint("user_id", client.userID),
@@ -127,8 +276,33 @@ func (s *NotificationService) Notify(notificationType NotificationType, topic st
 		Topic:     topic,
 		Payload:   payload,
 	}
+	if s.history != nil {
+		s.history.Record(0, message)
+	}
+
+	select {
+	case s.broadcast <- message:
+	case <-s.done:
+	}
+}
+
+// NotifyAdmins sends a notification to the clients of admins only. Admin notifications may
+// carry internal details, so they are not recorded in the history users can read.
+func (s *NotificationService) NotifyAdmins(notificationType NotificationType, topic string, payload interface{}) {
+	select {
+	case <-s.done:
+		return
+	default:
+	}
 
-	s.broadcast <- message
+	s.deliver(&NotificationMessage{
+		Type:      notificationType,
+		Timestamp: time.Now(),
+		Topic:     topic,
+		Payload:   payload,
+	}, func(client *Client) bool {
+		return client.isAdmin
+	})
 }
 
 // NotifyProject sends a notification to all clients in a specific project
@@ -139,20 +313,22 @@ func (s *NotificationService) NotifyProject(projectID uint, notificationType Not
 		Topic:     topic,
 		Payload:   payload,
 	}
+	if s.history != nil {
+		s.history.Record(projectID, message)
+	}
 
-	s.mutex.RLock()
+	s.mutex.Lock()
 	projectChan, exists := s.projectCasts[projectID]
-	s.mutex.RUnlock()
-
-	if exists {
-		projectChan <- message
-	} else {
-		s.mutex.Lock()
-		s.projectCasts[projectID] = make(chan *NotificationMessage, 256)
-		s.mutex.Unlock()
+	if !exists {
+		projectChan = make(chan *NotificationMessage, 256)
+		s.projectCasts[projectID] = projectChan
+		go s.handleProjectMessages(projectChan, projectID)
+	}
+	s.mutex.Unlock()
 
-		go s.handleProjectMessages(projectID)
-		s.projectCasts[projectID] <- message
+	select {
+	case projectChan <- message:
+	case <-s.done:
 	}
 }
 
@@ -165,101 +341,111 @@ func (s *NotificationService) NotifyTopic(topic string, notificationType Notific
 		Payload:   payload,
 	}
 
-	s.mutex.RLock()
+	s.mutex.Lock()
 	topicChan, exists := s.topics[topic]
-	s.mutex.RUnlock()
+	if !exists {
+		topicChan = make(chan *NotificationMessage, 256)
+		s.topics[topic] = topicChan
+		go s.handleTopicMessages(topicChan, topic)
+	}
+	s.mutex.Unlock()
 
-	if exists {
-		topicChan <- message
-	} else {
-		s.mutex.Lock()
-		s.topics[topic] = make(chan *NotificationMessage, 256)
-		s.mutex.Unlock()
+	select {
+	case topicChan <- message:
+	case <-s.done:
+	}
+}
 
-		go s.handleTopicMessages(topic)
-		s.topics[topic] <- message
+// ClientCount returns the number of connected clients
+func (s *NotificationService) ClientCount() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.clients)
+}
+
+// UserClientCount returns the number of connections a user currently has open
+func (s *NotificationService) UserClientCount(userID uint) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.userClients[userID])
+}
+
+// ConnectionCounts returns the number of open connections per user
+func (s *NotificationService) ConnectionCounts() map[uint]int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	counts := make(map[uint]int, len(s.userClients))
+	for userID, clients := range s.userClients {
+		counts[userID] = len(clients)
 	}
+	return counts
+}
+
+// Close disconnects all clients and stops the broadcast loop
+func (s *NotificationService) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+
+		s.mutex.Lock()
+		for client := range s.clients {
+			s.removeClientLocked(client)
+		}
+		s.mutex.Unlock()
+	})
 }
 
 // run processes messages in the main loop
 func (s *NotificationService) run() {
 	for {
 		select {
-		case client := <-s.register:
-			s.mutex.Lock()
-			s.clients[client] = true
-			s.mutex.Unlock()
-			s.logger.Debug("Client registered",
-				zap.Uint("user_id", client.userID),
-				zap.Uint("project_id", client.projectID))
+		case <-s.done:
+			return
 
 		case client := <-s.unregister:
-			s.mutex.Lock()
-			if _, ok := s.clients[client]; ok {
-				delete(s.clients, client)
-				close(client.send)
-			}
-			s.mutex.Unlock()
+			s.removeClients([]*Client{client})
 			s.logger.Debug("Client unregistered",
 				zap.Uint("user_id", client.userID),
 				zap.Uint("project_id", client.projectID))
 
 		case message := <-s.broadcast:
-			s.mutex.RLock()
-			for client := range s.clients {
-				s.sendToClient(client, message)
-			}
-			s.mutex.RUnlock()
+			s.deliver(message, func(*Client) bool { return true })
 		}
 	}
 }
 
 // handleProjectMessages handles messages for a specific project
-func (s *NotificationService) handleProjectMessages(projectID uint) {
-	s.mutex.RLock()
-	projectChan := s.projectCasts[projectID]
-	s.mutex.RUnlock()
-
+func (s *NotificationService) handleProjectMessages(projectChan <-chan *NotificationMessage, projectID uint) {
 	for {
-		message, ok := <-projectChan
-		if !ok {
-			return // Channel closed
-		}
-
-		s.mutex.RLock()
-		for client := range s.clients {
-			if client.projectID == projectID {
-				s.sendToClient(client, message)
-			}
+		select {
+		case <-s.done:
+			return
+		case message := <-projectChan:
+			s.deliver(message, func(client *Client) bool {
+				return client.projectID == projectID
+			})
 		}
-		s.mutex.RUnlock()
 	}
 }
 
 // handleTopicMessages handles messages for a specific topic
-func (s *NotificationService) handleTopicMessages(topic string) {
-	s.mutex.RLock()
-	topicChan := s.topics[topic]
-	s.mutex.RUnlock()
-
+func (s *NotificationService) handleTopicMessages(topicChan <-chan *NotificationMessage, topic string) {
 	for {
-		message, ok := <-topicChan
-		if !ok {
-			return // Channel closed
-		}
-
-		s.mutex.RLock()
-		for client := range s.clients {
-			if client.topics[topic] {
-				s.sendToClient(client, message)
-			}
+		select {
+		case <-s.done:
+			return
+		case message := <-topicChan:
+			s.deliver(message, func(client *Client) bool {
+				return client.topics[topic]
+			})
 		}
-		s.mutex.RUnlock()
 	}
 }
 
-// sendToClient sends a message to a specific client
-func (s *NotificationService) sendToClient(client *Client, message *NotificationMessage) {
+// deliver sends a message to every matching client without blocking.
+// Clients whose buffers are full are collected during the iteration and removed
+// afterwards, so the write lock is never taken while the read lock is held.
+func (s *NotificationService) deliver(message *NotificationMessage, match func(*Client) bool) {
 	jsonMessage, err := json.Marshal(message)
 	if err != nil {
 		s.logger.Error("Failed to marshal notification message",
@@ -269,25 +455,101 @@ func (s *NotificationService) sendToClient(client *Client, message *Notification
 		return
 	}
 
+	var stalled []*Client
+
+	s.mutex.RLock()
+	for client := range s.clients {
+		if match(client) && !s.sendToClient(client, jsonMessage) {
+			stalled = append(stalled, client)
+		}
+	}
+	s.mutex.RUnlock()
+
+	if len(stalled) > 0 {
+		s.removeClients(stalled)
+		for _, client := range stalled {
+			s.logger.Warn("Client buffer full, connection closed",
+				zap.Uint("user_id", client.userID),
+				zap.Uint("project_id", client.projectID))
+		}
+	}
+}
+
+// reply sends a message to a single client, unless it has left
+func (s *NotificationService) reply(client *Client, notificationType NotificationType, topic string, payload interface{}) {
+	jsonMessage, err := json.Marshal(&NotificationMessage{
+		Type:      notificationType,
+		Timestamp: time.Now(),
+		Topic:     topic,
+		Payload:   payload,
+	})
+	if err != nil {
+		s.logger.Error("Failed to marshal notification message", zap.Error(err), zap.String("type", string(notificationType)))
+		return
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if _, ok := s.clients[client]; ok {
+		s.sendToClient(client, jsonMessage)
+	}
+}
+
+// sendToClient queues a message for a client, returning false if its send buffer is full
+func (s *NotificationService) sendToClient(client *Client, jsonMessage []byte) bool {
 	select {
 	case client.send <- jsonMessage:
-		// Message sent
+		return true
 	default:
-		// Client's send buffer is full
-		s.mutex.Lock()
-		delete(s.clients, client)
-		close(client.send)
-		s.mutex.Unlock()
-		s.logger.Warn("Client buffer full, connection closed",
-			zap.Uint("user_id", client.userID),
-			zap.Uint("project_id", client.projectID))
+		return false
+	}
+}
+
+// removeClients unregisters clients and closes their send channels.
+// Clients that were already removed are skipped.
+func (s *NotificationService) removeClients(clients []*Client) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, client := range clients {
+		s.removeClientLocked(client)
+	}
+}
+
+// removeClientLocked unregisters a single client; the caller must hold the write lock
+func (s *NotificationService) removeClientLocked(client *Client) {
+	if _, ok := s.clients[client]; !ok {
+		return
+	}
+
+	delete(s.clients, client)
+	close(client.send)
+
+	for topic := range client.aggregates {
+		s.liveAggregates.Unsubscribe(topic)
+	}
+
+	userClients := s.userClients[client.userID]
+	for i, c := range userClients {
+		if c == client {
+			userClients = append(userClients[:i], userClients[i+1:]...)
+			break
+		}
+	}
+	if len(userClients) == 0 {
+		delete(s.userClients, client.userID)
+	} else {
+		s.userClients[client.userID] = userClients
 	}
 }
 
 // readPump reads messages from the client
 func (s *NotificationService) readPump(client *Client) {
 	defer func() {
-		s.unregister <- client
+		select {
+		case s.unregister <- client:
+		case <-s.done:
+		}
 		client.conn.Close()
 	}()
 
@@ -319,6 +581,10 @@ func (s *NotificationService) readPump(client *Client) {
 		var clientMsg struct {
 			Action string `json:"action"`
 			Topic  string `json:"topic"`
+			// Live aggregate subscriptions name the twin feature and interval instead of the topic
+			TwinID      uint   `json:"twin_id"`
+			FeaturePath string `json:"feature_path"`
+			Interval    string `json:"interval"`
 		}
 
 		if err := json.Unmarshal(message, &clientMsg); err != nil {
@@ -330,9 +596,17 @@ func (s *NotificationService) readPump(client *Client) {
 
 		switch clientMsg.Action {
 		case "subscribe":
-			if clientMsg.Topic != "" {
+			// Live aggregates are authorized per twin, so their topics cannot be subscribed to directly
+			if clientMsg.Topic != "" && !IsLiveAggregateTopic(clientMsg.Topic) {
 				s.SubscribeToTopic(client, clientMsg.Topic)
 			}
+		case "subscribe_aggregate":
+			if err := s.SubscribeToAggregate(client, clientMsg.TwinID, clientMsg.FeaturePath, clientMsg.Interval); err != nil {
+				s.logger.Debug("Live aggregate subscription refused",
+					zap.Uint("user_id", client.userID),
+					zap.Uint("twin_id", clientMsg.TwinID),
+					zap.Error(err))
+			}
 		case "unsubscribe":
 			if clientMsg.Topic != "" {
 				s.UnsubscribeFromTopic(client, clientMsg.Topic)
@@ -354,8 +628,12 @@ func (s *NotificationService) writePump(client *Client) {
 		case message, ok := <-client.send:
 			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
-				// Channel closed
-				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// Channel closed; tell the client why if the service dropped it
+				closeMessage := []byte{}
+				if client.closeCode != 0 {
+					closeMessage = websocket.FormatCloseMessage(client.closeCode, client.closeReason)
+				}
+				client.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
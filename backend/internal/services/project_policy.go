@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// projectPolicyTimeout bounds the Ditto requests of one policy sync
+const projectPolicyTimeout = 10 * time.Second
+
+// Policy entry labels of a project policy
+const (
+	PolicyEntryBackend = "backend"
+	PolicyEntryOwner   = "owner"
+	PolicyEntryEditor  = "editor"
+	PolicyEntryViewer  = "viewer"
+)
+
+var (
+	readWrite = []string{"READ", "WRITE"}
+	readOnly  = []string{"READ"}
+)
+
+// ProjectPolicyService keeps each project's Ditto policy in line with the project's membership.
+// All things of a project share the policy, so a membership change is a single policy update.
+type ProjectPolicyService struct {
+	dittoConfig  *config.DittoConfig
+	dittoManager *ditto.Manager
+	projectRepo  repository.ProjectRepository
+	logger       *utils.Logger
+}
+
+// NewProjectPolicyService creates a new project policy service
+func NewProjectPolicyService(db *db.Database, dittoConfig *config.DittoConfig, dittoManager *ditto.Manager, logger *utils.Logger) *ProjectPolicyService {
+	return &ProjectPolicyService{
+		dittoConfig:  dittoConfig,
+		dittoManager: dittoManager,
+		projectRepo:  repository.NewRepositoryFactory(db.DB).Project(),
+		logger:       logger.Named("project_policy"),
+	}
+}
+
+// PolicyID returns the ID of a project's Ditto policy
+func (s *ProjectPolicyService) PolicyID(projectID uint) string {
+	return ditto.ProjectPolicyID(s.dittoConfig.NamespacePrefix, projectID)
+}
+
+// Sync writes the project's policy to Ditto from its current members, creating it if needed
+func (s *ProjectPolicyService) Sync(ctx context.Context, projectID uint) error {
+	members, err := s.projectRepo.ListMembers(projectID)
+	if err != nil {
+		return fmt.Errorf("failed to list project members: %w", err)
+	}
+
+	policyID := s.PolicyID(projectID)
+	policy := BuildProjectPolicy(policyID, s.dittoConfig, members)
+
+	ctx, cancel := context.WithTimeout(ctx, projectPolicyTimeout)
+	defer cancel()
+	if _, err := s.dittoManager.UpdatePolicy(ctx, policyID, policy); err != nil {
+		return fmt.Errorf("failed to update Ditto policy %s: %w", policyID, err)
+	}
+
+	s.logger.Debug("Synced project policy", zap.Uint("project_id", projectID), zap.Int("members", len(members)))
+	return nil
+}
+
+// SyncAfterMembershipChange syncs the project's policy, logging instead of failing: the
+// membership change is already stored and the next sync brings Ditto in line again
+func (s *ProjectPolicyService) SyncAfterMembershipChange(projectID uint) {
+	if err := s.Sync(context.Background(), projectID); err != nil {
+		s.logger.Error("Failed to sync project policy after membership change",
+			zap.Uint("project_id", projectID),
+			zap.Error(err))
+	}
+}
+
+// AttachThing syncs the project's policy and makes the twin's thing use it: the thing is
+// created if it does not exist in Ditto yet, otherwise its policy ID is replaced
+func (s *ProjectPolicyService) AttachThing(ctx context.Context, twin *models.Twin) error {
+	if err := s.Sync(ctx, twin.ProjectID); err != nil {
+		return err
+	}
+	policyID := s.PolicyID(twin.ProjectID)
+
+	ctx, cancel := context.WithTimeout(ctx, projectPolicyTimeout)
+	defer cancel()
+
+	thing, err := s.dittoManager.GetThing(ctx, twin.DittoID)
+	var dittoErr *ditto.DittoError
+	switch {
+	case errors.As(err, &dittoErr) && dittoErr.Status == http.StatusNotFound:
+		_, err = s.dittoManager.CreateThing(ctx, &ditto.Thing{
+			ThingID:  twin.DittoID,
+			PolicyID: policyID,
+			Attributes: map[string]interface{}{
+				"name":      twin.Name,
+				"projectId": twin.ProjectID,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create Ditto thing: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get Ditto thing: %w", err)
+	case thing.PolicyID != policyID:
+		if err := s.dittoManager.UpdateThingPolicyID(ctx, twin.DittoID, policyID); err != nil {
+			return fmt.Errorf("failed to update Ditto thing policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// MemberSubject returns the Ditto subject of a user
+func MemberSubject(issuer string, userID uint) string {
+	return fmt.Sprintf("%s:%d", issuer, userID)
+}
+
+// BuildProjectPolicy builds a project's Ditto policy from its members. The backend's own subject
+// keeps full access; owners and editors may read and write the things and send messages, owners
+// may also read the policy, and viewers may only read. Roles without members get no entry.
+func BuildProjectPolicy(policyID string, cfg *config.DittoConfig, members []models.ProjectMember) *ditto.Policy {
+	policy := &ditto.Policy{
+		PolicyID: policyID,
+		Entries: map[string]ditto.PolicyEntry{
+			PolicyEntryBackend: {
+				Subjects: map[string]ditto.Subject{
+					cfg.PolicyServiceSubject: {Type: "digital-egiz backend"},
+				},
+				Resources: map[string]ditto.Resource{
+					"policy:/":  {Grant: readWrite},
+					"thing:/":   {Grant: readWrite},
+					"message:/": {Grant: readWrite},
+				},
+			},
+		},
+	}
+
+	resources := map[string]map[string]ditto.Resource{
+		PolicyEntryOwner: {
+			"policy:/":  {Grant: readOnly},
+			"thing:/":   {Grant: readWrite},
+			"message:/": {Grant: readWrite},
+		},
+		PolicyEntryEditor: {
+			"thing:/":   {Grant: readWrite},
+			"message:/": {Grant: readWrite},
+		},
+		PolicyEntryViewer: {
+			"thing:/":   {Grant: readOnly},
+			"message:/": {Grant: readOnly},
+		},
+	}
+
+	for _, member := range members {
+		label := policyEntryForRole(member.Role)
+		if label == "" {
+			continue
+		}
+		entry, ok := policy.Entries[label]
+		if !ok {
+			entry = ditto.PolicyEntry{Subjects: map[string]ditto.Subject{}, Resources: resources[label]}
+		}
+		entry.Subjects[MemberSubject(cfg.PolicySubjectIssuer, member.UserID)] = ditto.Subject{Type: "project " + string(member.Role)}
+		policy.Entries[label] = entry
+	}
+
+	return policy
+}
+
+// policyEntryForRole returns the policy entry a project role's members belong to
+func policyEntryForRole(role models.ProjectRole) string {
+	switch role {
+	case models.ProjectRoleOwner:
+		return PolicyEntryOwner
+	case models.ProjectRoleEditor:
+		return PolicyEntryEditor
+	case models.ProjectRoleViewer:
+		return PolicyEntryViewer
+	default:
+		return ""
+	}
+}
@@ -16,6 +16,11 @@ type ProjectService struct {
 	logger      *utils.Logger
 	projectRepo repository.ProjectRepository
 	userRepo    repository.UserRepository
+	policies    *ProjectPolicyService
+	// subscriptions is refreshed when projects are created or deleted, if set
+	subscriptions *DittoSubscriptions
+	// mlPauses is invalidated when a project's ML pause changes, if set
+	mlPauses *MLPauseCache
 }
 
 // NewProjectService creates a new project service
@@ -29,6 +34,35 @@ func NewProjectService(db *db.Database, logger *utils.Logger) *ProjectService {
 	}
 }
 
+// SetPolicyService makes membership changes update the project's Ditto policy
+func (s *ProjectService) SetPolicyService(policies *ProjectPolicyService) {
+	s.policies = policies
+}
+
+// SetDittoSubscriptions makes creating and deleting projects refresh the Ditto event subscription
+func (s *ProjectService) SetDittoSubscriptions(subscriptions *DittoSubscriptions) {
+	s.subscriptions = subscriptions
+}
+
+// SetMLPauseCache makes changing a project's ML pause take effect at once in the cache
+func (s *ProjectService) SetMLPauseCache(cache *MLPauseCache) {
+	s.mlPauses = cache
+}
+
+// refreshSubscriptions refreshes the Ditto event subscription, if it is kept in line with the projects
+func (s *ProjectService) refreshSubscriptions() {
+	if s.subscriptions != nil {
+		s.subscriptions.RefreshAfterProjectChange()
+	}
+}
+
+// syncPolicy updates the project's Ditto policy after a membership change, if policies are synced
+func (s *ProjectService) syncPolicy(projectID uint) {
+	if s.policies != nil {
+		s.policies.SyncAfterMembershipChange(projectID)
+	}
+}
+
 // Create adds a new project and adds the creator as an owner
 func (s *ProjectService) Create(project *models.Project) error {
 	// Validate project data
@@ -40,6 +74,10 @@ func (s *ProjectService) Create(project *models.Project) error {
 		return errors.New("project creator is required")
 	}
 
+	if project.TimestampPolicy != "" && !IsValidTimestampPolicy(project.TimestampPolicy) {
+		return errors.New("invalid timestamp policy")
+	}
+
 	// Verify user exists
 	_, err := s.userRepo.GetByID(project.CreatedBy)
 	if err != nil {
@@ -47,13 +85,35 @@ func (s *ProjectService) Create(project *models.Project) error {
 		return errors.New("invalid creator user")
 	}
 
+	if err := s.checkNameAvailable(project.Name, 0); err != nil {
+		return err
+	}
+
 	// Create project
 	err = s.projectRepo.Create(project)
 	if err != nil {
+		// A project created concurrently may have taken the name since it was checked
+		if errors.Is(err, repository.ErrConflict) {
+			return errors.New("project with this name already exists")
+		}
 		s.logger.Error("Failed to create project", zap.Error(err))
 		return errors.New("failed to create project")
 	}
 
+	s.refreshSubscriptions()
+	return nil
+}
+
+// checkNameAvailable returns an error if a project other than excludeID already has the name.
+// Names are compared case-insensitively.
+func (s *ProjectService) checkNameAvailable(name string, excludeID uint) error {
+	existing, err := s.projectRepo.GetByName(name)
+	if err == nil && existing.ID != excludeID {
+		return errors.New("project with this name already exists")
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.Error("Error checking project name", zap.String("name", name), zap.Error(err))
+		return errors.New("database error")
+	}
 	return nil
 }
 
@@ -106,11 +166,22 @@ func (s *ProjectService) Update(project *models.Project) error {
 		return errors.New("project name is required")
 	}
 
+	if project.TimestampPolicy != "" && !IsValidTimestampPolicy(project.TimestampPolicy) {
+		return errors.New("invalid timestamp policy")
+	}
+
+	if err := s.checkNameAvailable(project.Name, project.ID); err != nil {
+		return err
+	}
+
 	err := s.projectRepo.Update(project)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return errors.New("project not found")
 		}
+		if errors.Is(err, repository.ErrConflict) {
+			return errors.New("project with this name already exists")
+		}
 		s.logger.Error("Failed to update project", zap.Uint("id", project.ID), zap.Error(err))
 		return errors.New("failed to update project")
 	}
@@ -129,6 +200,7 @@ func (s *ProjectService) Delete(id uint) error {
 		return errors.New("failed to delete project")
 	}
 
+	s.refreshSubscriptions()
 	return nil
 }
 
@@ -201,6 +273,7 @@ func (s *ProjectService) AddMember(projectID, userID uint, role models.ProjectRo
 		return nil, errors.New("member added but failed to retrieve details")
 	}
 
+	s.syncPolicy(projectID)
 	return member, nil
 }
 
@@ -232,6 +305,7 @@ func (s *ProjectService) UpdateMemberRole(projectID, userID uint, role models.Pr
 		return nil, errors.New("role updated but failed to retrieve member details")
 	}
 
+	s.syncPolicy(projectID)
 	return member, nil
 }
 
@@ -252,6 +326,7 @@ func (s *ProjectService) RemoveMember(projectID, userID uint) error {
 		return errors.New("failed to remove member from project")
 	}
 
+	s.syncPolicy(projectID)
 	return nil
 }
 
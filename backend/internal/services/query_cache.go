@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+)
+
+// Default query cache settings used when the configuration leaves them unset
+const (
+	defaultQueryCacheTTL        = time.Minute
+	defaultQueryCacheMaxEntries = 1000
+
+	// openWindowGrace is how long after its end a window is still treated as open,
+	// covering requests that default the end to "now" and points that arrive late
+	openWindowGrace = time.Minute
+)
+
+// QueryCacheStats holds query cache metrics
+type QueryCacheStats struct {
+	Enabled bool  `json:"enabled"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// QueryCache caches history query results in memory for a short time.
+// Only closed time windows are cached, since ranges that include "now" keep changing.
+type QueryCache struct {
+	enabled    bool
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]queryCacheEntry
+	mutex      sync.RWMutex
+	hits       atomic.Int64
+	misses     atomic.Int64
+}
+
+// queryCacheEntry holds a cached result and its expiry
+type queryCacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewQueryCache creates a new query cache; a nil or disabled config yields a cache that never stores
+func NewQueryCache(cfg *config.CacheConfig) *QueryCache {
+	cache := &QueryCache{
+		ttl:        defaultQueryCacheTTL,
+		maxEntries: defaultQueryCacheMaxEntries,
+		entries:    make(map[string]queryCacheEntry),
+	}
+
+	if cfg == nil {
+		return cache
+	}
+
+	cache.enabled = cfg.Enabled
+	if cfg.TTL > 0 {
+		cache.ttl = time.Duration(cfg.TTL) * time.Second
+	}
+	if cfg.MaxEntries > 0 {
+		cache.maxEntries = cfg.MaxEntries
+	}
+
+	return cache
+}
+
+// QueryCacheKey builds a cache key from a query kind and its parameters
+func QueryCacheKey(kind, twinID, featurePath string, start, end time.Time, extra ...string) string {
+	return fmt.Sprintf("%s|%s|%s|%d|%d|%s",
+		kind, twinID, featurePath, start.UnixNano(), end.UnixNano(), strings.Join(extra, ","))
+}
+
+// Cacheable returns true if results for a window ending at end may be cached
+func (c *QueryCache) Cacheable(end time.Time) bool {
+	return c.enabled && end.Before(time.Now().Add(-openWindowGrace))
+}
+
+// Get returns a cached value, counting the lookup as a hit or miss
+func (c *QueryCache) Get(key string) (interface{}, bool) {
+	c.mutex.RLock()
+	entry, ok := c.entries[key]
+	c.mutex.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return entry.value, true
+}
+
+// Set stores a value, evicting expired entries when the cache is full
+func (c *QueryCache) Set(key string, value interface{}) {
+	if !c.enabled {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.maxEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	// Still full: drop an arbitrary entry to stay within bounds
+	if len(c.entries) >= c.maxEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+
+	c.entries[key] = queryCacheEntry{value: value, expiresAt: now.Add(c.ttl)}
+}
+
+// Stats returns the current cache metrics
+func (c *QueryCache) Stats() QueryCacheStats {
+	c.mutex.RLock()
+	entries := len(c.entries)
+	c.mutex.RUnlock()
+
+	return QueryCacheStats{
+		Enabled: c.enabled,
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: entries,
+	}
+}
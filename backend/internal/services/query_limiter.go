@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrTooManyQueries is returned when the maximum number of heavy queries is already in flight
+var ErrTooManyQueries = errors.New("too many concurrent queries")
+
+// QueryLimiterStats holds query limiter metrics
+type QueryLimiterStats struct {
+	InFlight    int64 `json:"in_flight"`
+	MaxInFlight int   `json:"max_in_flight"`
+	Rejected    int64 `json:"rejected"`
+}
+
+// QueryLimiter bounds how many expensive queries run at once, so analytics reads cannot
+// take every database connection from the ingest path. Queries over the limit are
+// rejected right away instead of waiting for a slot.
+type QueryLimiter struct {
+	slots    chan struct{}
+	max      int
+	inFlight atomic.Int64
+	rejected atomic.Int64
+}
+
+// NewQueryLimiter creates a limiter admitting max concurrent queries; 0 means unlimited
+func NewQueryLimiter(max int) *QueryLimiter {
+	limiter := &QueryLimiter{max: max}
+	if max > 0 {
+		limiter.slots = make(chan struct{}, max)
+	}
+	return limiter
+}
+
+// Acquire takes a slot for a query, returning ErrTooManyQueries if none is free.
+// The returned function releases the slot and must be called once the query is done.
+func (l *QueryLimiter) Acquire() (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			l.rejected.Add(1)
+			return nil, ErrTooManyQueries
+		}
+	}
+
+	l.inFlight.Add(1)
+	var released atomic.Bool
+	return func() {
+		if !released.CompareAndSwap(false, true) {
+			return
+		}
+		l.inFlight.Add(-1)
+		if l.slots != nil {
+			<-l.slots
+		}
+	}, nil
+}
+
+// Stats returns the current limiter metrics
+func (l *QueryLimiter) Stats() QueryLimiterStats {
+	return QueryLimiterStats{
+		InFlight:    l.inFlight.Load(),
+		MaxInFlight: l.max,
+		Rejected:    l.rejected.Load(),
+	}
+}
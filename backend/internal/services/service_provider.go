@@ -3,26 +3,52 @@ package services
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/db/repository"
 	"github.com/digital-egiz/backend/internal/ditto"
 	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/lifecycle"
 	"github.com/digital-egiz/backend/internal/utils"
 	"go.uber.org/zap"
 )
 
+// kafkaPingTimeout bounds each Kafka reachability check
+const kafkaPingTimeout = 5 * time.Second
+
 // ServiceProvider manages all services for the application
 type ServiceProvider struct {
 	logger              *utils.Logger
 	config              *config.Config
 	database            *db.Database
 	kafkaManager        *kafka.Manager
+	dlqReprocessor      *kafka.DLQReprocessor
+	consumerMonitor     *kafka.ConsumerMonitor
+	dlqWatcher          *kafka.DLQWatcher
 	dittoManager        *ditto.Manager
+	projectPolicies     *ProjectPolicyService
+	dittoSubscriptions  *DittoSubscriptions
+	mlPauses            *MLPauseCache
 	kafkaHandler        *KafkaHandler
 	historyService      *HistoryService
 	notificationService *NotificationService
+	deliveryService     *DeliveryService
+	alertRouting        *AlertRoutingService
+	alertEnricher       *AlertEnricher
+	featureCatalog      *FeatureCatalogService
+	notificationHistory *NotificationHistory
+	ingestService       *IngestService
+	writebackService    *WritebackService
+	mlBackfillService   *MLBackfillService
+	auditService        *AuditService
+	retentionService    *TimeseriesRetentionService
+	maintenance         *MaintenanceService
+	tokenReplayGuard    *TokenReplayGuard
+	lifecycle           *lifecycle.Registry
+	cancelReconnect     context.CancelFunc
 }
 
 // NewServiceProvider creates a new service provider
@@ -31,42 +57,89 @@ func NewServiceProvider(
 	config *config.Config,
 	database *db.Database,
 ) *ServiceProvider {
-	return &ServiceProvider{
+	sp := &ServiceProvider{
 		logger:   logger.Named("services"),
 		config:   config,
 		database: database,
 	}
+
+	// History reads, notifications and HTTP ingestion only need the database,
+	// so they are available before Initialize
+	sp.historyService = NewHistoryService(database, &config.Cache, &config.Alerts, &config.History, sp.logger)
+	sp.notificationService = NewNotificationService(&config.WebSocket, sp.logger)
+	sp.notificationHistory = NewNotificationHistory(database, &config.Notifications, sp.logger)
+	if config.Notifications.HistoryEnabled {
+		sp.notificationService.SetHistory(sp.notificationHistory)
+	}
+	sp.ingestService = NewIngestService(database, &config.Ingest, sp.notificationService, sp.logger)
+	sp.mlPauses = NewMLPauseCache(database, sp.logger)
+	sp.ingestService.SetMLPauseCache(sp.mlPauses)
+	liveAggregates := NewLiveAggregates(database, sp.notificationService, sp.logger)
+	sp.notificationService.SetLiveAggregates(liveAggregates)
+	sp.ingestService.SetLiveAggregates(liveAggregates)
+	sp.mlBackfillService = NewMLBackfillService(database, sp.logger)
+	sp.deliveryService = NewDeliveryService(database, &config.Notifications, sp.logger)
+	webhookService := NewWebhookService(database, sp.logger)
+	webhookService.SetAllowPrivateNetworks(config.Notifications.WebhookAllowPrivateNetworks)
+	sp.deliveryService.RegisterChannel(NewWebhookChannel(webhookService))
+	sp.deliveryService.RegisterChannel(NewWebSocketChannel(sp.notificationService))
+	sp.alertRouting = NewAlertRoutingService(database, sp.deliveryService, sp.notificationService, sp.logger)
+	sp.ingestService.SetAlertRouting(sp.alertRouting)
+	sp.alertEnricher = NewAlertEnricher(database, &config.Alerts, sp.logger)
+	sp.ingestService.SetAlertEnricher(sp.alertEnricher)
+	sp.historyService.SetAlertRouting(sp.alertRouting)
+	sp.featureCatalog = NewFeatureCatalogService(database, sp.logger)
+
+	var archiver AuditArchiver
+	if config.Audit.ArchiveDir != "" {
+		archiver = NewDirectoryArchiver(config.Audit.ArchiveDir)
+	}
+	sp.auditService = NewAuditService(database, &config.Audit, archiver, sp.logger)
+	sp.retentionService = NewTimeseriesRetentionService(database, &config.History, sp.logger)
+	sp.maintenance = NewMaintenanceService(&config.Maintenance, sp.logger)
+	sp.tokenReplayGuard = NewTokenReplayGuard(database, &config.JWT, sp.logger)
+
+	return sp
 }
 
-// Initialize initializes all services
+// Initialize initializes all services and starts the background components
 func (sp *ServiceProvider) Initialize(ctx context.Context) error {
 	var err error
 
 	// Initialize Ditto manager
 	sp.dittoManager = ditto.NewManager(&sp.config.Ditto, sp.logger)
-
-	// Connect to Ditto WebSocket
-	if err = sp.dittoManager.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to Ditto WebSocket: %w", err)
+	sp.dittoSubscriptions = NewDittoSubscriptions(sp.database, sp.dittoManager, sp.logger)
+	if sp.config.Ditto.PolicySyncEnabled {
+		sp.projectPolicies = NewProjectPolicyService(sp.database, &sp.config.Ditto, sp.dittoManager, sp.logger)
 	}
-	sp.logger.Info("Connected to Ditto WebSocket")
 
 	// Initialize Kafka manager
 	sp.kafkaManager, err = kafka.NewManager(&sp.config.Kafka, sp.logger)
 	if err != nil {
 		return fmt.Errorf("failed to create Kafka manager: %w", err)
 	}
+	// Publish project events to Kafka as well, if a topic is configured
+	if sp.config.Notifications.KafkaTopic != "" {
+		sp.deliveryService.RegisterChannel(NewKafkaChannel(sp.kafkaManager, sp.config.Notifications.KafkaTopic))
+	}
+	sp.dlqReprocessor = kafka.NewDLQReprocessor(sp.kafkaManager, &sp.config.Kafka, sp.logger)
+	sp.consumerMonitor = kafka.NewConsumerMonitor(sp.kafkaManager, &sp.config.Kafka, sp.alertConsumerHealth, sp.logger)
+	sp.dlqWatcher = kafka.NewDLQWatcher(&sp.config.Kafka, sp.alertDeadLetters, sp.logger)
+	if sp.dlqWatcher.Enabled() {
+		sp.kafkaManager.SetDLQWatcher(sp.dlqWatcher)
+	}
 
 	// Create repository factory
 	repoFactory := repository.NewRepositoryFactory(sp.database.DB)
 
-	// Initialize HistoryService
-	sp.historyService = NewHistoryService(sp.database, sp.logger)
-	sp.logger.Info("History service initialized")
+	// Forward ingested values for ML analysis
+	sp.ingestService.SetKafkaManager(sp.kafkaManager)
+	sp.mlBackfillService.SetKafkaManager(sp.kafkaManager)
 
-	// Initialize NotificationService
-	sp.notificationService = NewNotificationService(sp.logger)
-	sp.logger.Info("Notification service initialized")
+	// Write ML predictions back to Ditto if enabled
+	if sp.config.Ditto.WritebackEnabled {
+		sp.writebackService = NewWritebackService(sp.database, &sp.config.Ditto, sp.dittoManager, sp.logger)
+	}
 
 	// Initialize Kafka handler
 	sp.kafkaHandler = NewKafkaHandler(
@@ -75,53 +148,253 @@ func (sp *ServiceProvider) Initialize(ctx context.Context) error {
 		sp.dittoManager,
 		sp.database,
 		repoFactory,
+		sp.ingestService,
+		sp.writebackService,
 	)
+	sp.kafkaHandler.SetMLPauseCache(sp.mlPauses)
+
+	forwardFilter, err := NewDittoForwardFilter(&sp.config.Ditto, repoFactory.Twin())
+	if err != nil {
+		return fmt.Errorf("failed to configure Ditto forwarding: %w", err)
+	}
+	sp.kafkaHandler.SetDittoForwardFilter(forwardFilter)
+
+	transformer, err := NewPayloadTransformer(sp.config.Ingest.Transforms, repoFactory.Twin())
+	if err != nil {
+		return fmt.Errorf("invalid ingest transforms: %w", err)
+	}
+	sp.kafkaHandler.SetPayloadTransformer(transformer)
+	sp.kafkaHandler.SetPipelineConfig(&sp.config.Kafka)
+	sp.kafkaHandler.SetEventDebounce(time.Duration(sp.config.Ditto.EventDebounce) * time.Millisecond)
+	sp.kafkaHandler.SetAlertRouting(sp.alertRouting)
+	sp.kafkaHandler.SetAlertEnricher(sp.alertEnricher)
+
+	// Type twins created in Ditto by the Thing Models of their definitions, if any host is allowed
+	if len(sp.config.Ditto.DefinitionHosts) > 0 {
+		resolver := ditto.NewDefinitionResolver(
+			sp.config.Ditto.DefinitionHosts,
+			sp.config.Ditto.DefinitionRepository,
+			time.Duration(sp.config.Ditto.DefinitionCacheTTL)*time.Second,
+		)
+		sp.kafkaHandler.SetDefinitionService(NewThingDefinitionService(sp.database, resolver, sp.logger))
+	}
 
 	// Initialize Kafka handler
 	if err = sp.kafkaHandler.Initialize(ctx); err != nil {
 		return fmt.Errorf("failed to initialize Kafka handler: %w", err)
 	}
 
-	// Start Kafka manager
-	if err = sp.kafkaManager.Start(); err != nil {
-		return fmt.Errorf("failed to start Kafka manager: %w", err)
+	// Ingest from Kafka, and optionally from Ditto, pauses during maintenance
+	if err = sp.maintenance.Register("kafka", sp.kafkaManager.Pause, sp.kafkaManager.Resume); err != nil {
+		return fmt.Errorf("failed to pause Kafka for maintenance: %w", err)
 	}
-	sp.logger.Info("Kafka manager started")
+	if sp.config.Maintenance.PauseDittoForwarding {
+		_ = sp.maintenance.Register("ditto-forwarding",
+			func() error { sp.kafkaHandler.SetDittoForwardingPaused(true); return nil },
+			func() error { sp.kafkaHandler.SetDittoForwardingPaused(false); return nil },
+		)
+	}
+
+	// Components stop in reverse order: ingest from Ditto and Kafka stops first,
+	// then buffered events and predictions are flushed, then the Kafka producers are closed
+	// and clients are disconnected
+	sp.lifecycle = lifecycle.NewRegistry(sp.logger)
+	sp.lifecycle.Register(sp.auditService)
+	sp.lifecycle.Register(sp.retentionService)
+	sp.lifecycle.Register(sp.tokenReplayGuard)
+	sp.lifecycle.Register(&lifecycle.Hook{
+		ComponentName: "notifications",
+		OnStop: func(ctx context.Context) error {
+			sp.notificationService.Close()
+			return nil
+		},
+	})
+	sp.lifecycle.Register(sp.notificationHistory)
+	// Every component after this one may produce to Kafka while it stops
+	sp.lifecycle.Register(&lifecycle.Hook{
+		ComponentName: "kafka-producers",
+		OnStop: func(ctx context.Context) error {
+			sp.kafkaManager.Close()
+			return nil
+		},
+	})
+	sp.lifecycle.Register(sp.deliveryService)
+	if sp.writebackService != nil {
+		sp.lifecycle.Register(sp.writebackService)
+	}
+	sp.lifecycle.Register(sp.ingestService)
+	sp.lifecycle.Register(
+		sp.kafkaHandler,
+		&lifecycle.Hook{ComponentName: "kafka", OnStart: sp.startKafka, OnStop: sp.stopKafka},
+		sp.dlqReprocessor,
+		sp.consumerMonitor,
+		sp.dlqWatcher,
+		&lifecycle.Hook{
+			ComponentName: "ditto",
+			OnStart: func(ctx context.Context) error {
+				return sp.startDitto()
+			},
+			OnStop: sp.stopDitto,
+		},
+	)
+	// Backfills produce to Kafka, so they are canceled before it stops
+	sp.lifecycle.Register(sp.mlBackfillService)
 
-	// Subscribe to all Ditto events
-	if err = sp.dittoManager.SubscribeToThings(""); err != nil {
-		return fmt.Errorf("failed to subscribe to Ditto events: %w", err)
+	if err = sp.lifecycle.Start(ctx); err != nil {
+		return err
 	}
-	sp.logger.Info("Subscribed to Ditto events")
 
 	sp.logger.Info("All services initialized successfully")
 	return nil
 }
 
-// Shutdown performs a graceful shutdown of all services
-func (sp *ServiceProvider) Shutdown() error {
-	sp.logger.Info("Shutting down services")
+// startKafka starts the Kafka manager, or keeps serving HTTP and retries in the background
+func (sp *ServiceProvider) startKafka(ctx context.Context) error {
+	if err := sp.kafkaManager.Ping(kafkaPingTimeout); err != nil {
+		if sp.config.Kafka.FailFast() {
+			return fmt.Errorf("kafka is unavailable: %w", err)
+		}
+		sp.logger.Warn("Kafka is unavailable, starting in degraded mode", zap.Error(err))
+
+		reconnectCtx, cancel := context.WithCancel(ctx)
+		sp.cancelReconnect = cancel
+		go sp.reconnectKafka(reconnectCtx)
+		return nil
+	}
+
+	if err := sp.kafkaManager.Start(); err != nil {
+		return fmt.Errorf("failed to start Kafka manager: %w", err)
+	}
+	sp.logger.Info("Kafka manager started")
+	return nil
+}
 
-	// Stop Kafka manager if initialized
-	if sp.kafkaManager != nil && sp.kafkaManager.IsRunning() {
-		sp.logger.Info("Stopping Kafka manager")
-		if err := sp.kafkaManager.Stop(); err != nil {
-			sp.logger.Error("Failed to stop Kafka manager", zap.Error(err))
+// stopKafka stops reconnecting and the Kafka consumers. The producers are closed once the
+// components producing to them have stopped.
+func (sp *ServiceProvider) stopKafka(ctx context.Context) error {
+	if sp.cancelReconnect != nil {
+		sp.cancelReconnect()
+	}
+
+	if !sp.kafkaManager.IsRunning() {
+		return nil
+	}
+	return sp.kafkaManager.StopConsumers()
+}
+
+// startDitto connects to the Ditto WebSocket and subscribes to events in the namespaces of all
+// projects; the subscription is refreshed as projects are created and deleted
+func (sp *ServiceProvider) startDitto() error {
+	if err := sp.dittoManager.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to Ditto WebSocket: %w", err)
+	}
+	sp.logger.Info("Connected to Ditto WebSocket")
+
+	return sp.dittoSubscriptions.Refresh()
+}
+
+// stopDitto disconnects from the Ditto WebSocket
+func (sp *ServiceProvider) stopDitto(ctx context.Context) error {
+	if !sp.dittoManager.IsConnected() {
+		return nil
+	}
+	return sp.dittoManager.Disconnect()
+}
+
+// reconnectKafka retries Kafka until the brokers are reachable and then starts the manager
+func (sp *ServiceProvider) reconnectKafka(ctx context.Context) {
+	interval := time.Duration(sp.config.Kafka.ReconnectInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := sp.kafkaManager.Ping(kafkaPingTimeout); err != nil {
+				sp.logger.Debug("Kafka still unavailable", zap.Error(err))
+				continue
+			}
+
+			if err := sp.kafkaManager.Start(); err != nil {
+				sp.logger.Error("Failed to start Kafka manager after reconnect", zap.Error(err))
+				continue
+			}
+
+			sp.logger.Info("Kafka connection established, leaving degraded mode")
+			return
 		}
 	}
+}
+
+// alertConsumerHealth notifies connected admins that a Kafka consumer is failing or idle
+func (sp *ServiceProvider) alertConsumerHealth(diagnostics kafka.ConsumerDiagnostics) {
+	sp.notificationService.NotifyAdmins(NotificationTypeSystemEvent, "kafka/consumers/"+diagnostics.Name, diagnostics)
+}
 
-	// Disconnect from Ditto WebSocket if connected
-	if sp.dittoManager != nil && sp.dittoManager.IsConnected() {
-		sp.logger.Info("Disconnecting from Ditto WebSocket")
-		if err := sp.dittoManager.Disconnect(); err != nil {
-			sp.logger.Error("Failed to disconnect from Ditto WebSocket", zap.Error(err))
+// alertDeadLetters raises a system event to admins for a topic whose messages are dead-lettered
+// faster than the threshold, or stopped being, and pages the configured projects' channels
+func (sp *ServiceProvider) alertDeadLetters(alert kafka.DLQAlert) {
+	sp.notificationService.NotifyAdmins(NotificationTypeSystemEvent, "kafka/dlq/"+alert.Topic, alert)
+	for _, projectID := range sp.config.Kafka.DLQAlertProjects {
+		if _, err := sp.deliveryService.Broadcast(projectID, models.WebhookEventDLQAlert, alert); err != nil {
+			sp.logger.Error("Failed to page DLQ alert",
+				zap.Uint("project_id", projectID),
+				zap.String("topic", alert.Topic),
+				zap.Error(err))
 		}
 	}
+}
+
+// IsKafkaReady returns whether Kafka is connected and consuming
+func (sp *ServiceProvider) IsKafkaReady() bool {
+	return sp.kafkaManager != nil && sp.kafkaManager.IsRunning()
+}
+
+// Shutdown stops the background components in order, draining their pending work
+// until the context is done
+func (sp *ServiceProvider) Shutdown(ctx context.Context) error {
+	sp.logger.Info("Shutting down services")
+
+	// Without Initialize only the websocket clients need disconnecting
+	if sp.lifecycle == nil {
+		sp.notificationService.Close()
+		return nil
+	}
+
+	if err := sp.lifecycle.Stop(ctx); err != nil {
+		return err
+	}
 
 	sp.logger.Info("Services shut down successfully")
 	return nil
 }
 
+// GetMaintenanceService returns the maintenance mode service
+func (sp *ServiceProvider) GetMaintenanceService() *MaintenanceService {
+	return sp.maintenance
+}
+
+// GetProjectPolicyService returns the project policy service, or nil if policy sync is disabled
+func (sp *ServiceProvider) GetProjectPolicyService() *ProjectPolicyService {
+	return sp.projectPolicies
+}
+
+// GetMLPauseCache returns the cache of ML pauses shared by ingestion and the Kafka handler
+func (sp *ServiceProvider) GetMLPauseCache() *MLPauseCache {
+	return sp.mlPauses
+}
+
+// GetDittoSubscriptions returns the service keeping the Ditto subscription in line with the projects
+func (sp *ServiceProvider) GetDittoSubscriptions() *DittoSubscriptions {
+	return sp.dittoSubscriptions
+}
+
 // GetDittoManager returns the Ditto manager
 func (sp *ServiceProvider) GetDittoManager() *ditto.Manager {
 	return sp.dittoManager
@@ -132,6 +405,11 @@ func (sp *ServiceProvider) GetKafkaManager() *kafka.Manager {
 	return sp.kafkaManager
 }
 
+// GetDLQReprocessor returns the dead-letter reprocessor
+func (sp *ServiceProvider) GetDLQReprocessor() *kafka.DLQReprocessor {
+	return sp.dlqReprocessor
+}
+
 // GetKafkaHandler returns the Kafka handler
 func (sp *ServiceProvider) GetKafkaHandler() *KafkaHandler {
 	return sp.kafkaHandler
@@ -142,7 +420,52 @@ func (sp *ServiceProvider) GetHistoryService() *HistoryService {
 	return sp.historyService
 }
 
+// GetIngestService returns the ingest service
+func (sp *ServiceProvider) GetIngestService() *IngestService {
+	return sp.ingestService
+}
+
+// GetAuditService returns the audit service
+func (sp *ServiceProvider) GetAuditService() *AuditService {
+	return sp.auditService
+}
+
 // GetNotificationService returns the notification service
 func (sp *ServiceProvider) GetNotificationService() *NotificationService {
 	return sp.notificationService
 }
+
+// GetMLBackfillService returns the ML backfill service
+func (sp *ServiceProvider) GetMLBackfillService() *MLBackfillService {
+	return sp.mlBackfillService
+}
+
+// GetNotificationHistory returns the notification history
+func (sp *ServiceProvider) GetNotificationHistory() *NotificationHistory {
+	return sp.notificationHistory
+}
+
+// GetDeliveryService returns the notification delivery service
+func (sp *ServiceProvider) GetDeliveryService() *DeliveryService {
+	return sp.deliveryService
+}
+
+// GetAlertRoutingService returns the alert routing service
+func (sp *ServiceProvider) GetAlertRoutingService() *AlertRoutingService {
+	return sp.alertRouting
+}
+
+// GetTokenReplayGuard returns the JWT replay guard
+func (sp *ServiceProvider) GetTokenReplayGuard() *TokenReplayGuard {
+	return sp.tokenReplayGuard
+}
+
+// GetFeatureCatalogService returns the feature catalog service
+func (sp *ServiceProvider) GetFeatureCatalogService() *FeatureCatalogService {
+	return sp.featureCatalog
+}
+
+// GetLifecycle returns the registry of the background components, or nil before Initialize
+func (sp *ServiceProvider) GetLifecycle() *lifecycle.Registry {
+	return sp.lifecycle
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// thingModelInteractionKeys are the Thing Model keys of property affordances that describe how
+// a property is accessed rather than its data, and are left out of derived schemas
+var thingModelInteractionKeys = []string{"@type", "forms", "observable", "tm:ref", "uriVariables"}
+
+// ThingDefinitionService derives twin types from the WoT Thing Models that Ditto thing
+// definitions reference, so twins imported from Ditto are typed by their definition
+type ThingDefinitionService struct {
+	resolver     *ditto.DefinitionResolver
+	twinTypeRepo repository.TwinTypeRepository
+	logger       *utils.Logger
+
+	// Serialises type creation, so concurrent imports of one definition share a type
+	mu sync.Mutex
+}
+
+// NewThingDefinitionService creates a service deriving twin types with the resolver
+func NewThingDefinitionService(db *db.Database, resolver *ditto.DefinitionResolver, logger *utils.Logger) *ThingDefinitionService {
+	return &ThingDefinitionService{
+		resolver:     resolver,
+		twinTypeRepo: repository.NewRepositoryFactory(db.DB).TwinType(),
+		logger:       logger.Named("thing_definition_service"),
+	}
+}
+
+// TypeForDefinition returns the twin type of a thing definition, creating it from the
+// definition's Thing Model the first time. Errors wrap ditto.ErrUnresolvableDefinition when
+// the Thing Model cannot be fetched or parsed.
+func (s *ThingDefinitionService) TypeForDefinition(ctx context.Context, definition string) (*models.TwinType, error) {
+	definition = strings.TrimSpace(definition)
+	if definition == "" {
+		return nil, fmt.Errorf("%w: the definition is empty", ditto.ErrUnresolvableDefinition)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	twinType, err := s.twinTypeRepo.GetByDefinition(definition)
+	if err == nil {
+		return twinType, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("failed to look up twin type: %w", err)
+	}
+
+	model, err := s.resolver.Resolve(ctx, definition)
+	if err != nil {
+		return nil, err
+	}
+
+	twinType, err = s.twinTypeFromModel(definition, model)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.twinTypeRepo.Create(twinType); err != nil {
+		return nil, fmt.Errorf("failed to create twin type: %w", err)
+	}
+
+	s.logger.Info("Created twin type from thing definition",
+		zap.String("definition", definition),
+		zap.Uint("twinTypeId", twinType.ID),
+		zap.String("name", twinType.Name),
+		zap.Int("features", len(model.Submodels)))
+	return twinType, nil
+}
+
+// twinTypeFromModel builds the twin type of a Thing Model: a schema of the Ditto thing it
+// describes, and feature metadata for the numeric properties of its submodels
+func (s *ThingDefinitionService) twinTypeFromModel(definition string, model *ditto.ThingModel) (*models.TwinType, error) {
+	schema, err := json.Marshal(thingModelSchema(model))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode schema: %w", err)
+	}
+
+	name := strings.TrimSpace(model.Title)
+	if name == "" {
+		name = definition[strings.LastIndexAny(definition, "/:")+1:]
+	}
+	// Type names are unique; a title another type already uses is qualified with the definition
+	if _, err := s.twinTypeRepo.GetByName(name); err == nil {
+		name = fmt.Sprintf("%s (%s)", name, definition)
+	}
+
+	version := model.Version
+	if version == "" {
+		version = "1.0"
+	}
+
+	twinType := &models.TwinType{
+		Name:            name,
+		Description:     model.Description,
+		Version:         version,
+		SchemaJSON:      models.JSON(schema),
+		PrimaryFeatures: models.StringList{},
+		Definition:      definition,
+	}
+
+	// Metadata is only a display aid; a type is still created without it
+	metadata, err := normalizeFeatureMetadata(twinType.SchemaJSON, thingModelFeatureMetadata(model))
+	if err != nil {
+		s.logger.Warn("Dropping feature metadata derived from thing definition",
+			zap.String("definition", definition),
+			zap.Error(err))
+		metadata = models.FeatureMetadataList{}
+	}
+	twinType.FeatureMetadata = metadata
+	return twinType, nil
+}
+
+// thingModelSchema returns the JSON schema of the Ditto thing a Thing Model describes: its
+// properties become the thing's attributes, and the properties of each submodel those of the
+// feature it is instantiated as
+func thingModelSchema(model *ditto.ThingModel) map[string]interface{} {
+	features := make(map[string]interface{}, len(model.Submodels))
+	for name, submodel := range model.Submodels {
+		features[name] = map[string]interface{}{
+			"type":        "object",
+			"title":       submodel.Title,
+			"description": submodel.Description,
+			"properties": map[string]interface{}{
+				"properties": thingModelObject(submodel.Properties),
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type":    "object",
+		"title":   model.Title,
+		"properties": map[string]interface{}{
+			"attributes": thingModelObject(model.Properties),
+			"features": map[string]interface{}{
+				"type":       "object",
+				"properties": features,
+			},
+		},
+	}
+}
+
+// thingModelObject returns the schema of an object holding the property affordances, without
+// their interaction keys
+func thingModelObject(affordances map[string]map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{}, len(affordances))
+	for name, affordance := range affordances {
+		property := make(map[string]interface{}, len(affordance))
+		for key, value := range affordance {
+			property[key] = value
+		}
+		for _, key := range thingModelInteractionKeys {
+			delete(property, key)
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// thingModelFeatureMetadata describes the numeric properties of a Thing Model's submodels,
+// grouped by submodel and ordered by feature and property name
+func thingModelFeatureMetadata(model *ditto.ThingModel) models.FeatureMetadataList {
+	names := make([]string, 0, len(model.Submodels))
+	for name := range model.Submodels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metadata := models.FeatureMetadataList{}
+	for _, name := range names {
+		submodel := model.Submodels[name]
+		group := submodel.Title
+		if group == "" {
+			group = name
+		}
+		if len(group) > maxFeatureMetadataLength {
+			group = group[:maxFeatureMetadataLength]
+		}
+
+		properties := make([]string, 0, len(submodel.Properties))
+		for property, affordance := range submodel.Properties {
+			if kind, _ := affordance["type"].(string); kind == "number" || kind == "integer" {
+				properties = append(properties, property)
+			}
+		}
+		sort.Strings(properties)
+
+		for _, property := range properties {
+			affordance := submodel.Properties[property]
+			feature := models.FeatureMetadata{
+				FeaturePath: name + "/" + property,
+				Order:       len(metadata) + 1,
+				Group:       group,
+				Min:         thingModelNumber(affordance["minimum"]),
+				Max:         thingModelNumber(affordance["maximum"]),
+			}
+			if unit, ok := affordance["unit"].(string); ok && len(unit) <= maxFeatureMetadataLength {
+				feature.Unit = unit
+			}
+			metadata = append(metadata, feature)
+		}
+	}
+	return metadata
+}
+
+// thingModelNumber returns a numeric Thing Model value, or nil if it is not a number
+func thingModelNumber(value interface{}) *float64 {
+	number, ok := value.(float64)
+	if !ok {
+		return nil
+	}
+	return &number
+}
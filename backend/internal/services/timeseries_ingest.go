@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+)
+
+// Default array payload schema used when a feature has no binding
+const (
+	defaultArrayTimeField  = "time"
+	defaultArrayValueField = "value"
+)
+
+// maxFeaturePrecision is the largest rounding precision a feature binding may set;
+// float64 values carry no more significant decimal places
+const maxFeaturePrecision = 15
+
+// Type violation defaults
+const (
+	defaultViolationAlertThreshold = 10
+	typeViolationWindow            = time.Minute
+)
+
+// ErrTypeViolation is returned when a value does not match the expected feature type
+// and the binding rejects off-type values
+var ErrTypeViolation = errors.New("value does not match expected feature type")
+
+// ParseTimeseriesPayload converts a feature update into timeseries points.
+// Array payloads of the form [{time, value}, ...] are expanded into one point per
+// sample with its own timestamp, unless the feature binding disables it. Any other
+// payload becomes a single point at the given timestamp.
+func ParseTimeseriesPayload(
+	thingID, featureID string,
+	timestamp time.Time,
+	data json.RawMessage,
+	binding *models.FeatureBinding,
+) []models.TimeseriesData {
+	arrayMode := models.ArrayModeExpand
+	timeField := defaultArrayTimeField
+	valueField := defaultArrayValueField
+	if binding != nil {
+		if binding.ArrayMode != "" {
+			arrayMode = binding.ArrayMode
+		}
+		if binding.ArrayTimeField != "" {
+			timeField = binding.ArrayTimeField
+		}
+		if binding.ArrayValueField != "" {
+			valueField = binding.ArrayValueField
+		}
+	}
+
+	if arrayMode == models.ArrayModeExpand {
+		if points, ok := expandArrayPayload(thingID, featureID, data, timeField, valueField); ok {
+			return points
+		}
+	}
+
+	return []models.TimeseriesData{newTimeseriesPoint(thingID, featureID, timestamp, data)}
+}
+
+// expandArrayPayload returns one point per sample if every element matches the array schema
+func expandArrayPayload(thingID, featureID string, data json.RawMessage, timeField, valueField string) ([]models.TimeseriesData, bool) {
+	var samples []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &samples); err != nil || len(samples) == 0 {
+		return nil, false
+	}
+
+	points := make([]models.TimeseriesData, 0, len(samples))
+	for _, sample := range samples {
+		rawTime, ok := sample[timeField]
+		if !ok {
+			return nil, false
+		}
+		sampleTime, ok := parseSampleTime(rawTime)
+		if !ok {
+			return nil, false
+		}
+		rawValue, ok := sample[valueField]
+		if !ok {
+			return nil, false
+		}
+
+		points = append(points, newTimeseriesPoint(thingID, featureID, sampleTime, rawValue))
+	}
+
+	return points, true
+}
+
+// parseSampleTime accepts RFC 3339 strings or Unix timestamps in milliseconds
+func parseSampleTime(raw json.RawMessage) (time.Time, bool) {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		t, err := time.Parse(time.RFC3339Nano, str)
+		return t, err == nil
+	}
+
+	var millis int64
+	if err := json.Unmarshal(raw, &millis); err == nil {
+		return time.UnixMilli(millis).UTC(), true
+	}
+
+	return time.Time{}, false
+}
+
+// newTimeseriesPoint builds a point of the normalized thing ID, inferring the value type from the JSON value
+func newTimeseriesPoint(thingID, featureID string, timestamp time.Time, data json.RawMessage) models.TimeseriesData {
+	point := models.TimeseriesData{
+		Time:        timestamp,
+		TwinID:      ditto.NormalizeThingID(thingID),
+		FeaturePath: featureID,
+	}
+
+	var jsonValue interface{}
+	if err := json.Unmarshal(data, &jsonValue); err == nil {
+		switch v := jsonValue.(type) {
+		case float64:
+			point.ValueType = "number"
+			point.ValueNum = v
+		case bool:
+			point.ValueType = "boolean"
+			point.ValueBool = &v
+		case string:
+			point.ValueType = "string"
+			point.ValueStr = v
+		default:
+			point.ValueType = "object"
+			point.ValueJSON = string(data)
+		}
+	} else {
+		point.ValueType = "object"
+		point.ValueJSON = string(data)
+	}
+
+	return point
+}
+
+// ApplyTypePolicy enforces the expected type of a feature binding on a point.
+// Values that can be converted losslessly (e.g. "21.5" for a number feature) are
+// coerced in place. Other off-type values are handled according to the binding's
+// violation mode. It reports whether the point should be stored and whether it
+// was a type violation.
+func ApplyTypePolicy(point *models.TimeseriesData, binding *models.FeatureBinding) (store bool, violation bool, err error) {
+	if binding == nil || binding.ExpectedType == "" || point.ValueType == binding.ExpectedType {
+		return true, false, nil
+	}
+
+	if coerceValue(point, binding.ExpectedType) {
+		return true, false, nil
+	}
+
+	switch binding.TypeViolationMode {
+	case models.TypeViolationReject:
+		return false, true, ErrTypeViolation
+	case models.TypeViolationDrop:
+		return false, true, nil
+	case models.TypeViolationNull:
+		point.ValueType = "null"
+		point.ValueNum = 0
+		point.ValueBool = nil
+		point.ValueStr = ""
+		point.ValueJSON = ""
+		return true, true, nil
+	default:
+		// Keep the original value but mark it so typed queries skip it
+		point.ValueType = "error"
+		return true, true, nil
+	}
+}
+
+// ApplyPrecision rounds a numeric point to the decimal places of the feature binding.
+// If the binding keeps raw values, the unrounded value is stored in value_json.
+func ApplyPrecision(point *models.TimeseriesData, binding *models.FeatureBinding) {
+	if binding == nil || binding.Precision == nil || point.ValueType != "number" {
+		return
+	}
+
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(point.ValueNum, 'f', *binding.Precision, 64), 64)
+	if err != nil {
+		return
+	}
+
+	if binding.KeepRawValue {
+		point.ValueJSON = strconv.FormatFloat(point.ValueNum, 'g', -1, 64)
+	}
+	point.ValueNum = rounded
+}
+
+// coerceValue converts a point to the expected type if its value has an unambiguous representation
+func coerceValue(point *models.TimeseriesData, expectedType string) bool {
+	switch expectedType {
+	case "number":
+		switch point.ValueType {
+		case "string":
+			num, err := strconv.ParseFloat(strings.TrimSpace(point.ValueStr), 64)
+			if err != nil {
+				return false
+			}
+			point.ValueNum = num
+			point.ValueStr = ""
+		case "boolean":
+			point.ValueNum = 0
+			if *point.ValueBool {
+				point.ValueNum = 1
+			}
+			point.ValueBool = nil
+		default:
+			return false
+		}
+	case "boolean":
+		var value bool
+		switch point.ValueType {
+		case "string":
+			parsed, err := strconv.ParseBool(strings.TrimSpace(point.ValueStr))
+			if err != nil {
+				return false
+			}
+			value = parsed
+			point.ValueStr = ""
+		case "number":
+			if point.ValueNum != 0 && point.ValueNum != 1 {
+				return false
+			}
+			value = point.ValueNum == 1
+			point.ValueNum = 0
+		default:
+			return false
+		}
+		point.ValueBool = &value
+	case "string":
+		switch point.ValueType {
+		case "number":
+			point.ValueStr = strconv.FormatFloat(point.ValueNum, 'f', -1, 64)
+			point.ValueNum = 0
+		case "boolean":
+			point.ValueStr = strconv.FormatBool(*point.ValueBool)
+			point.ValueBool = nil
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+
+	point.ValueType = expectedType
+	return true
+}
+
+// TypeViolationTracker counts type violations per feature binding and detects spikes
+type TypeViolationTracker struct {
+	mutex   sync.Mutex
+	windows map[uint]*violationWindow
+}
+
+// violationWindow holds the violation count of a binding within the current window
+type violationWindow struct {
+	start   time.Time
+	count   int
+	alerted bool
+}
+
+// NewTypeViolationTracker creates a new type violation tracker
+func NewTypeViolationTracker() *TypeViolationTracker {
+	return &TypeViolationTracker{
+		windows: make(map[uint]*violationWindow),
+	}
+}
+
+// Record adds violations for a binding and returns the window count when it first
+// reaches the alert threshold within the window, or zero otherwise
+func (t *TypeViolationTracker) Record(bindingID uint, violations int, threshold int, now time.Time) int {
+	if threshold <= 0 {
+		threshold = defaultViolationAlertThreshold
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	window, ok := t.windows[bindingID]
+	if !ok || now.Sub(window.start) >= typeViolationWindow {
+		window = &violationWindow{start: now}
+		t.windows[bindingID] = window
+	}
+
+	window.count += violations
+	if window.alerted || window.count < threshold {
+		return 0
+	}
+
+	window.alerted = true
+	return window.count
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxRetentionDays bounds the retention windows twin types and twins may set
+	maxRetentionDays = 36500
+	// retentionBatchSize is the number of twins whose data one retention step deletes
+	retentionBatchSize = 500
+)
+
+// RetentionWindows are the days a twin's raw and aggregated time-series data are kept;
+// 0 keeps them forever
+type RetentionWindows struct {
+	RawDays        int `json:"raw_days"`
+	AggregatedDays int `json:"aggregated_days"`
+}
+
+// RetentionRun counts what a retention pass deleted
+type RetentionRun struct {
+	Twins             int   `json:"twins"`
+	RawDeleted        int64 `json:"raw_deleted"`
+	AggregatedDeleted int64 `json:"aggregated_deleted"`
+}
+
+// validateRetention checks the retention windows of a twin type or twin. Aggregates summarize
+// the raw data, so they may not be deleted before it.
+func validateRetention(rawDays, aggregatedDays *int) error {
+	for _, window := range []struct {
+		name string
+		days *int
+	}{{"raw_retention_days", rawDays}, {"aggregated_retention_days", aggregatedDays}} {
+		if window.days != nil && (*window.days < 0 || *window.days > maxRetentionDays) {
+			return fmt.Errorf("invalid retention: %s must be between 0 and %d", window.name, maxRetentionDays)
+		}
+	}
+	if rawDays != nil && aggregatedDays != nil && *rawDays > 0 && *aggregatedDays > 0 && *aggregatedDays < *rawDays {
+		return errors.New("invalid retention: aggregated_retention_days must not be shorter than raw_retention_days")
+	}
+	return nil
+}
+
+// EffectiveRetention returns the retention windows of a twin: its own, else those of its type,
+// else the global ones. The twin's type must be loaded.
+func EffectiveRetention(cfg *config.HistoryConfig, twin *models.Twin) RetentionWindows {
+	resolve := func(twinDays, typeDays *int, globalDays int) int {
+		switch {
+		case twinDays != nil:
+			return *twinDays
+		case typeDays != nil:
+			return *typeDays
+		}
+		return globalDays
+	}
+	return RetentionWindows{
+		RawDays:        resolve(twin.RawRetentionDays, twin.Type.RawRetentionDays, cfg.RawRetentionDays),
+		AggregatedDays: resolve(twin.AggregatedRetentionDays, twin.Type.AggregatedRetentionDays, cfg.AggregatedRetentionDays),
+	}
+}
+
+// TimeseriesRetentionService deletes the time-series data of twins past their retention
+// windows. Data of things not registered as twins is left alone.
+type TimeseriesRetentionService struct {
+	logger         *utils.Logger
+	config         *config.HistoryConfig
+	twinRepo       repository.TwinRepository
+	timeseriesRepo repository.TimeseriesRepository
+
+	// The retention job, disabled without an interval
+	*lifecycle.ScheduledWorker
+}
+
+// NewTimeseriesRetentionService creates a new time-series retention service
+func NewTimeseriesRetentionService(db *db.Database, cfg *config.HistoryConfig, logger *utils.Logger) *TimeseriesRetentionService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	s := &TimeseriesRetentionService{
+		logger:         logger.Named("timeseries_retention"),
+		config:         cfg,
+		twinRepo:       repoFactory.Twin(),
+		timeseriesRepo: repoFactory.Timeseries(),
+	}
+
+	interval := time.Duration(cfg.RetentionInterval) * time.Minute
+	s.ScheduledWorker = lifecycle.NewScheduledWorker("timeseries-retention", interval, func(ctx context.Context) error {
+		_, err := s.ApplyRetention(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("Time-series retention failed", zap.Error(err))
+		}
+		return err
+	})
+	s.RunOnStart = true
+	return s
+}
+
+// ApplyRetention deletes the raw and aggregated data older than the retention windows of each
+// twin. Twins sharing a window are deleted from together.
+func (s *TimeseriesRetentionService) ApplyRetention(ctx context.Context) (*RetentionRun, error) {
+	now := time.Now().UTC()
+	run := &RetentionRun{}
+
+	var after uint
+	for ctx.Err() == nil {
+		twins, err := s.twinRepo.ListAfterID(after, retentionBatchSize)
+		if err != nil {
+			return run, fmt.Errorf("failed to list twins: %w", err)
+		}
+		if len(twins) == 0 {
+			break
+		}
+		after = twins[len(twins)-1].ID
+
+		raw := make(map[int][]string)
+		aggregated := make(map[int][]string)
+		for i := range twins {
+			windows := EffectiveRetention(s.config, &twins[i])
+			if windows.RawDays > 0 {
+				raw[windows.RawDays] = append(raw[windows.RawDays], twins[i].DittoID)
+			}
+			if windows.AggregatedDays > 0 {
+				aggregated[windows.AggregatedDays] = append(aggregated[windows.AggregatedDays], twins[i].DittoID)
+			}
+		}
+		run.Twins += len(twins)
+
+		for _, days := range sortedWindows(raw) {
+			deleted, err := s.timeseriesRepo.DeleteTimeseriesBefore(ctx, raw[days], now.AddDate(0, 0, -days))
+			if err != nil {
+				return run, fmt.Errorf("failed to delete time-series data older than %d days: %w", days, err)
+			}
+			run.RawDeleted += deleted
+		}
+		for _, days := range sortedWindows(aggregated) {
+			deleted, err := s.timeseriesRepo.DeleteAggregatedBefore(ctx, aggregated[days], now.AddDate(0, 0, -days))
+			if err != nil {
+				return run, fmt.Errorf("failed to delete aggregated data older than %d days: %w", days, err)
+			}
+			run.AggregatedDeleted += deleted
+		}
+
+		if len(twins) < retentionBatchSize {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return run, err
+	}
+
+	if run.RawDeleted > 0 || run.AggregatedDeleted > 0 {
+		s.logger.Info("Removed expired time-series data",
+			zap.Int("twins", run.Twins),
+			zap.Int64("raw_deleted", run.RawDeleted),
+			zap.Int64("aggregated_deleted", run.AggregatedDeleted))
+	}
+	return run, nil
+}
+
+// sortedWindows returns the windows of a grouping, shortest first
+func sortedWindows(groups map[int][]string) []int {
+	windows := make([]int, 0, len(groups))
+	for days := range groups {
+		windows = append(windows, days)
+	}
+	sort.Ints(windows)
+	return windows
+}
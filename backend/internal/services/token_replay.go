@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrTokenReplayed is returned when a token is presented by another client than the one it was first seen from
+	ErrTokenReplayed = errors.New("token presented by another client")
+	// ErrTokenUnidentified is returned for tokens without an ID, which cannot be bound to a client
+	ErrTokenUnidentified = errors.New("token has no ID")
+)
+
+// TokenReplayGuard binds access tokens to the client they are first presented by. The first
+// sighting of each token ID is kept in the database, shared by all instances, until the
+// token expires; a token presented later by a client with another user agent, or in strict
+// mode from another IP address, is rejected as replayed.
+type TokenReplayGuard struct {
+	logger   *utils.Logger
+	mode     string
+	userRepo repository.UserRepository
+
+	mu  sync.RWMutex
+	now func() time.Time
+
+	// The purge of expired sightings, disabled without replay protection
+	*lifecycle.ScheduledWorker
+}
+
+// NewTokenReplayGuard creates a token replay guard in the configured mode
+func NewTokenReplayGuard(db *db.Database, cfg *config.JWTConfig, logger *utils.Logger) *TokenReplayGuard {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	g := &TokenReplayGuard{
+		logger:   logger.Named("token_replay"),
+		mode:     cfg.ReplayProtection,
+		userRepo: repoFactory.User(),
+		now:      time.Now,
+	}
+
+	interval := time.Duration(cfg.ReplayPurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	if !g.Enabled() {
+		interval = 0
+	}
+	g.ScheduledWorker = lifecycle.NewScheduledWorker("token-replay-purge", interval, func(ctx context.Context) error {
+		deleted, err := g.PurgeExpired()
+		if err != nil {
+			g.logger.Error("Token sighting purge failed", zap.Error(err))
+		} else if deleted > 0 {
+			g.logger.Debug("Deleted expired token sightings", zap.Int64("sightings", deleted))
+		}
+		return err
+	})
+	return g
+}
+
+// Enabled returns whether tokens are bound to their first client
+func (g *TokenReplayGuard) Enabled() bool {
+	return g.mode == config.JWTReplayFingerprint || g.mode == config.JWTReplayStrict
+}
+
+// SetClock replaces the guard's time source, for tests
+func (g *TokenReplayGuard) SetClock(now func() time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.now = now
+}
+
+// Check records the client presenting a token and returns ErrTokenReplayed if the token was
+// first seen from another client
+func (g *TokenReplayGuard) Check(claims *models.Claims, ip, userAgent string) error {
+	if !g.Enabled() {
+		return nil
+	}
+	if claims.ID == "" {
+		return ErrTokenUnidentified
+	}
+
+	now := g.clock()
+	fingerprint := clientFingerprint(userAgent)
+	expiresAt := now
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	first, err := g.userRepo.RecordTokenSighting(&models.TokenSighting{
+		JTI:         claims.ID,
+		UserID:      claims.UserID,
+		IP:          ip,
+		Fingerprint: fingerprint,
+		FirstSeen:   now,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record token sighting: %w", err)
+	}
+
+	if first.Fingerprint == fingerprint && (g.mode != config.JWTReplayStrict || first.IP == ip) {
+		return nil
+	}
+	g.logger.Warn("Rejected replayed token",
+		zap.Uint("user_id", claims.UserID),
+		zap.String("jti", claims.ID),
+		zap.String("first_ip", first.IP),
+		zap.String("ip", ip),
+		zap.Bool("same_user_agent", first.Fingerprint == fingerprint))
+	return ErrTokenReplayed
+}
+
+// PurgeExpired deletes the sightings of expired tokens
+func (g *TokenReplayGuard) PurgeExpired() (int64, error) {
+	deleted, err := g.userRepo.DeleteExpiredTokenSightings(g.clock())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired token sightings: %w", err)
+	}
+	return deleted, nil
+}
+
+// clientFingerprint identifies a client by its user agent
+func clientFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// clock returns the current time of the guard's time source
+func (g *TokenReplayGuard) clock() time.Time {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.now()
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// ErrConditionFailed is returned when a conditional twin update is refused because the twin
+// is not in the required state
+var ErrConditionFailed = errors.New("twin is not in the required state")
+
+// FeatureCondition requires a feature property of a twin to currently hold a value, e.g. the
+// "state" property of the "machine" feature to be "idle"
+type FeatureCondition struct {
+	Feature  string          `json:"feature"`
+	Property string          `json:"property"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// TwinCommandService writes feature state of twins to Ditto
+type TwinCommandService struct {
+	dittoManager *ditto.Manager
+	logger       *utils.Logger
+}
+
+// NewTwinCommandService creates a new twin command service writing through the Ditto manager
+func NewTwinCommandService(dittoManager *ditto.Manager, logger *utils.Logger) *TwinCommandService {
+	return &TwinCommandService{
+		dittoManager: dittoManager,
+		logger:       logger.Named("twin_command"),
+	}
+}
+
+// SetFeatureProperty sets a feature property of the twin's thing. With a condition the change is
+// only applied if the condition holds when Ditto applies it; otherwise ErrConditionFailed is
+// returned and the thing is left unchanged.
+func (s *TwinCommandService) SetFeatureProperty(ctx context.Context, twin *models.Twin, featureID, propertyPath string, value json.RawMessage, condition *FeatureCondition) error {
+	if condition != nil {
+		var expected interface{}
+		if err := json.Unmarshal(condition.Value, &expected); err != nil {
+			return errors.New("invalid condition: value must be JSON")
+		}
+		rql, err := ditto.FeaturePropertyCondition(condition.Feature, condition.Property, expected)
+		if err != nil {
+			return fmt.Errorf("invalid condition: %w", err)
+		}
+		ctx = ditto.WithCondition(ctx, rql)
+	}
+
+	err := s.dittoManager.UpdateFeatureProperty(ctx, twin.DittoID, featureID, propertyPath, value)
+	if err == nil {
+		return nil
+	}
+	if ditto.IsConditionFailed(err) {
+		return ErrConditionFailed
+	}
+	s.logger.Error("Failed to update feature property",
+		zap.String("thingId", twin.DittoID),
+		zap.String("featureId", featureID),
+		zap.String("property", propertyPath),
+		zap.Error(err))
+	return err
+}
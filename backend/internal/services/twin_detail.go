@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Twin detail sections a client can include
+const (
+	TwinDetailType     = "type"
+	TwinDetailBindings = "bindings"
+	TwinDetailModel    = "model"
+	TwinDetailState    = "state"
+	TwinDetailAlerts   = "alerts"
+	TwinDetailFeatures = "features"
+)
+
+// maxDetailAlerts is the number of active alerts included in a twin detail
+const maxDetailAlerts = 50
+
+var (
+	// ErrUnknownTwinDetailSection is returned when an unknown section is requested
+	ErrUnknownTwinDetailSection = errors.New("unknown twin detail section")
+	// ErrTwinDetailAccessDenied is returned when the user may not view the twin
+	ErrTwinDetailAccessDenied = errors.New("no access to the twin's project")
+)
+
+// TwinBindings holds the 3D model and feature ingestion bindings of a twin
+type TwinBindings struct {
+	Model    []models.ModelBinding   `json:"model"`
+	Features []models.FeatureBinding `json:"features"`
+}
+
+// TwinModel describes the 3D model of a twin
+type TwinModel struct {
+	URL    string              `json:"url"`
+	Format *models.ModelFormat `json:"format,omitempty"`
+}
+
+// twinDetailSection is a part of the twin detail, fetched independently of the others. Each
+// section holds data a project viewer may read, so the viewer check on the twin covers them all.
+type twinDetailSection struct {
+	fetch func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error)
+}
+
+// twinDetailSections lists the sections by name
+var twinDetailSections = map[string]twinDetailSection{
+	TwinDetailType: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			if twin.Type.ID == 0 {
+				return nil, nil
+			}
+			return &twin.Type, nil
+		},
+	},
+	TwinDetailBindings: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			modelBindings, err := s.twinService.ListModelBindings(twin.ID)
+			if err != nil {
+				return nil, err
+			}
+			featureBindings, err := s.twinService.ListFeatureBindings(twin.ID)
+			if err != nil {
+				return nil, err
+			}
+			return &TwinBindings{Model: modelBindings, Features: featureBindings}, nil
+		},
+	},
+	TwinDetailModel: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			if twin.ModelURL == "" {
+				return nil, nil
+			}
+			model := &TwinModel{URL: twin.ModelURL}
+			if format, ok := models.ModelFormatForURL(twin.ModelURL); ok {
+				model.Format = &format
+			}
+			return model, nil
+		},
+	},
+	TwinDetailState: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			return s.historyService.GetTwinState(ctx, twin.ID, false)
+		},
+	},
+	TwinDetailAlerts: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			return s.historyService.GetActiveAlerts(ctx, twin.ID, maxDetailAlerts)
+		},
+	},
+	TwinDetailFeatures: {
+		fetch: func(s *TwinDetailService, ctx context.Context, twin *models.Twin) (interface{}, error) {
+			return s.twinService.ListFeatureMetadata(twin)
+		},
+	},
+}
+
+// TwinDetailQuery selects the twin and sections of a twin detail, and who asks for it
+type TwinDetailQuery struct {
+	TwinID  uint
+	Include []string
+	UserID  uint
+	IsAdmin bool
+}
+
+// TwinDetail is a twin with the requested sections. A section that could not be fetched is
+// reported in Errors instead of failing the whole detail.
+type TwinDetail struct {
+	Twin *models.Twin
+	// MLPause is the pause of ML forwarding in effect for the twin, or nil
+	MLPause  *MLPause
+	Sections map[string]interface{}
+	Errors   map[string]string
+}
+
+// TwinDetailService composes a twin with the related data a twin page shows
+type TwinDetailService struct {
+	twinService    *TwinService
+	historyService *HistoryService
+	projectService *ProjectService
+	logger         *utils.Logger
+}
+
+// NewTwinDetailService creates a new twin detail service
+func NewTwinDetailService(twinService *TwinService, historyService *HistoryService, projectService *ProjectService, logger *utils.Logger) *TwinDetailService {
+	return &TwinDetailService{
+		twinService:    twinService,
+		historyService: historyService,
+		projectService: projectService,
+		logger:         logger.Named("twin_detail_service"),
+	}
+}
+
+// ParseTwinDetailInclude splits a comma-separated include parameter into known section names
+func ParseTwinDetailInclude(include string) ([]string, error) {
+	var sections []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(include, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := twinDetailSections[name]; !ok {
+			known := make([]string, 0, len(twinDetailSections))
+			for section := range twinDetailSections {
+				known = append(known, section)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("%w %q; known sections: %s", ErrUnknownTwinDetailSection, name, strings.Join(known, ", "))
+		}
+		seen[name] = true
+		sections = append(sections, name)
+	}
+	return sections, nil
+}
+
+// Get returns the twin with the requested sections, fetched in parallel. The user needs
+// viewer access to the twin's project, which grants every section.
+func (s *TwinDetailService) Get(ctx context.Context, query TwinDetailQuery) (*TwinDetail, error) {
+	for _, name := range query.Include {
+		if _, ok := twinDetailSections[name]; !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownTwinDetailSection, name)
+		}
+	}
+
+	twin, err := s.twinService.GetByID(query.TwinID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !query.IsAdmin {
+		allowed, err := s.projectService.CheckAccess(twin.ProjectID, query.UserID, models.ProjectRoleViewer)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, ErrTwinDetailAccessDenied
+		}
+	}
+
+	pause, err := s.twinService.GetMLPause(twin)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &TwinDetail{
+		Twin:     twin,
+		MLPause:  pause,
+		Sections: make(map[string]interface{}, len(query.Include)),
+		Errors:   make(map[string]string),
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range query.Include {
+		wg.Add(1)
+		go func(name string, section twinDetailSection) {
+			defer wg.Done()
+			value, err := s.fetchSection(ctx, twin, name, section)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				detail.Errors[name] = err.Error()
+				return
+			}
+			detail.Sections[name] = value
+		}(name, twinDetailSections[name])
+	}
+	wg.Wait()
+
+	return detail, nil
+}
+
+// fetchSection fetches a section of the twin detail
+func (s *TwinDetailService) fetchSection(ctx context.Context, twin *models.Twin, name string, section twinDetailSection) (interface{}, error) {
+	value, err := section.fetch(s, ctx, twin)
+	if err != nil {
+		s.logger.Warn("Failed to fetch twin detail section",
+			zap.Uint("twin_id", twin.ID),
+			zap.String("section", name),
+			zap.Error(err))
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// defaultFeaturePageSize is the number of features listed when no limit is given
+const defaultFeaturePageSize = 100
+
+// FeatureListQuery selects a page of a twin's features
+type FeatureListQuery struct {
+	// Search only lists features whose path or alias contains it, ignoring case
+	Search string
+	Limit  int
+	Offset int
+}
+
+// TwinFeature is a feature a twin has recorded values for, with the display metadata its
+// twin type declares for it, as in the features section of the twin detail
+type TwinFeature struct {
+	models.FeatureMetadata
+	Alias     string    `json:"alias,omitempty"`
+	ValueType string    `json:"value_type"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// FeatureList is a page of a twin's features and the number of features matching the query
+type FeatureList struct {
+	Features []TwinFeature `json:"features"`
+	Total    int64         `json:"total"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+}
+
+// ListFeatures returns a page of the features recorded for a twin, ordered by path, from the
+// feature catalog, with their display metadata. Limits outside 1 and the maximum page size are replaced by the default or
+// the maximum.
+func (s *HistoryService) ListFeatures(ctx context.Context, twinID uint, query FeatureListQuery) (*FeatureList, error) {
+	twin, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	if query.Limit <= 0 {
+		query.Limit = defaultFeaturePageSize
+	}
+	if s.maxFeatures > 0 && query.Limit > s.maxFeatures {
+		query.Limit = s.maxFeatures
+	}
+	if query.Offset < 0 {
+		query.Offset = 0
+	}
+
+	filter := repository.FeatureCatalogFilter{Search: strings.TrimSpace(query.Search), Limit: query.Limit, Offset: query.Offset}
+	aliases := make(map[string]string, len(twin.Type.FeatureAliases))
+	search := strings.ToLower(filter.Search)
+	for _, alias := range twin.Type.FeatureAliases {
+		aliases[alias.FeaturePath] = alias.Alias
+		if search != "" && strings.Contains(strings.ToLower(alias.Alias), search) {
+			filter.Paths = append(filter.Paths, alias.FeaturePath)
+		}
+	}
+
+	entries, total, err := s.timeseriesRepo.ListFeatureCatalog(ctx, twin.DittoID, filter)
+	if err != nil {
+		s.logger.Error("Failed to list feature catalog", zap.String("ditto_id", twin.DittoID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	metadata := make(map[string]models.FeatureMetadata, len(twin.Type.FeatureMetadata))
+	if len(twin.Type.FeatureMetadata) > 0 {
+		bindings, err := s.twinRepo.ListFeatureBindings(twin.ID)
+		if err != nil {
+			s.logger.Error("Failed to list feature bindings", zap.Uint("twin_id", twinID), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		for _, feature := range resolveFeatureMetadata(twin.Type.FeatureMetadata, bindings) {
+			metadata[feature.FeaturePath] = feature
+		}
+	}
+
+	list := &FeatureList{
+		Features: make([]TwinFeature, len(entries)),
+		Total:    total,
+		Limit:    query.Limit,
+		Offset:   query.Offset,
+	}
+	for i, entry := range entries {
+		feature := TwinFeature{
+			FeatureMetadata: metadata[entry.FeaturePath],
+			Alias:           aliases[entry.FeaturePath],
+			ValueType:       entry.ValueType,
+			LastSeen:        entry.LastSeen,
+		}
+		feature.FeaturePath = entry.FeaturePath
+		list.Features[i] = feature
+	}
+	return list, nil
+}
@@ -1,38 +1,73 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/digital-egiz/backend/internal/config"
 	"github.com/digital-egiz/backend/internal/db"
 	"github.com/digital-egiz/backend/internal/db/models"
 	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
 	"github.com/digital-egiz/backend/internal/utils"
 	"go.uber.org/zap"
 )
 
+// Tag limits
+const (
+	maxTwinTags  = 50
+	maxTagLength = 100
+)
+
 // TwinService handles twin-related business logic
 type TwinService struct {
 	db           *db.Database
+	dittoConfig  *config.DittoConfig
 	logger       *utils.Logger
 	twinRepo     repository.TwinRepository
 	twinTypeRepo repository.TwinTypeRepository
 	projectRepo  repository.ProjectRepository
 	userRepo     repository.UserRepository
+	seriesRepo   repository.TimeseriesRepository
+	policies     *ProjectPolicyService
+	statusConfig config.TwinStatusConfig
+	// mlPauses is invalidated when a twin's ML pause changes, if set
+	mlPauses *MLPauseCache
 }
 
 // NewTwinService creates a new twin service
-func NewTwinService(db *db.Database, logger *utils.Logger) *TwinService {
+func NewTwinService(db *db.Database, dittoConfig *config.DittoConfig, logger *utils.Logger) *TwinService {
 	repoFactory := repository.NewRepositoryFactory(db.DB)
 	return &TwinService{
 		db:           db,
+		dittoConfig:  dittoConfig,
 		logger:       logger.Named("twin_service"),
 		twinRepo:     repoFactory.Twin(),
 		twinTypeRepo: repoFactory.TwinType(),
 		projectRepo:  repoFactory.Project(),
 		userRepo:     repoFactory.User(),
+		seriesRepo:   repoFactory.Timeseries(),
+		statusConfig: config.TwinStatusConfig{MaxTwins: defaultMaxStatusTwins, StaleAfter: defaultStaleAfter},
 	}
 }
 
+// SetStatusConfig sets the limits of batch status queries
+func (s *TwinService) SetStatusConfig(cfg *config.TwinStatusConfig) {
+	s.statusConfig = *cfg
+}
+
+// SetPolicyService makes twin creation also create the twin's Ditto thing under its project's policy
+func (s *TwinService) SetPolicyService(policies *ProjectPolicyService) {
+	s.policies = policies
+}
+
+// SetMLPauseCache makes changing a twin's ML pause take effect at once in the cache
+func (s *TwinService) SetMLPauseCache(cache *MLPauseCache) {
+	s.mlPauses = cache
+}
+
 // Create adds a new twin
 func (s *TwinService) Create(twin *models.Twin) error {
 	// Validate twin data
@@ -40,6 +75,7 @@ func (s *TwinService) Create(twin *models.Twin) error {
 		return errors.New("twin name is required")
 	}
 
+	twin.DittoID = ditto.NormalizeThingID(twin.DittoID)
 	if twin.DittoID == "" {
 		return errors.New("ditto ID is required")
 	}
@@ -56,8 +92,22 @@ func (s *TwinService) Create(twin *models.Twin) error {
 		return errors.New("creator is required")
 	}
 
+	if err := validateModelURL(twin.ModelURL); err != nil {
+		return err
+	}
+
+	primaryFeatures, err := normalizePrimaryFeatures(twin.PrimaryFeatures)
+	if err != nil {
+		return err
+	}
+	twin.PrimaryFeatures = primaryFeatures
+
+	if err := validateRetention(twin.RawRetentionDays, twin.AggregatedRetentionDays); err != nil {
+		return err
+	}
+
 	// Verify user exists
-	_, err := s.userRepo.GetByID(twin.CreatedBy)
+	_, err = s.userRepo.GetByID(twin.CreatedBy)
 	if err != nil {
 		s.logger.Error("Failed to verify user exists", zap.Uint("user_id", twin.CreatedBy), zap.Error(err))
 		return errors.New("invalid creator user")
@@ -77,6 +127,15 @@ func (s *TwinService) Create(twin *models.Twin) error {
 		return errors.New("invalid project")
 	}
 
+	// Things must live in their project's Ditto namespace
+	namespace, _, err := ditto.ParseThingID(twin.DittoID)
+	if err != nil {
+		return errors.New("invalid ditto ID")
+	}
+	if namespace != ditto.ProjectNamespace(s.dittoConfig.NamespacePrefix, twin.ProjectID) {
+		return errors.New("ditto ID namespace does not match project")
+	}
+
 	// Check if twin with same Ditto ID already exists
 	_, err = s.twinRepo.GetByDittoID(twin.DittoID)
 	if err == nil {
@@ -86,16 +145,82 @@ func (s *TwinService) Create(twin *models.Twin) error {
 		return errors.New("database error")
 	}
 
+	if err := s.checkNameAvailable(twin.ProjectID, twin.Name, 0); err != nil {
+		return err
+	}
+
 	// Create twin
 	err = s.twinRepo.Create(twin)
 	if err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return s.conflictError(twin)
+		}
 		s.logger.Error("Failed to create twin", zap.Error(err))
 		return errors.New("failed to create twin")
 	}
 
+	// The record exists before the thing, so the Ditto created event finds the twin registered
+	if s.policies != nil {
+		if err := s.policies.AttachThing(context.Background(), twin); err != nil {
+			s.logger.Error("Failed to set up Ditto thing for twin", zap.String("ditto_id", twin.DittoID), zap.Error(err))
+			if err := s.db.DB.Unscoped().Delete(twin).Error; err != nil {
+				s.logger.Error("Failed to remove twin after Ditto failure", zap.Uint("id", twin.ID), zap.Error(err))
+			}
+			return errors.New("failed to create ditto thing")
+		}
+	}
+
 	return nil
 }
 
+// checkNameAvailable returns an error if another twin of the project, other than excludeID,
+// already has the name. Names are compared case-insensitively.
+func (s *TwinService) checkNameAvailable(projectID uint, name string, excludeID uint) error {
+	existing, err := s.twinRepo.GetByName(projectID, name)
+	if err == nil && existing.ID != excludeID {
+		return errors.New("twin with this name already exists in the project")
+	} else if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.Error("Error checking twin name", zap.Uint("project_id", projectID), zap.String("name", name), zap.Error(err))
+		return errors.New("database error")
+	}
+	return nil
+}
+
+// conflictError describes why writing a twin violated a unique index. A twin written
+// concurrently may have taken the Ditto ID or the name since they were checked.
+func (s *TwinService) conflictError(twin *models.Twin) error {
+	if existing, err := s.twinRepo.GetByDittoID(twin.DittoID); err == nil && existing.ID != twin.ID {
+		return errors.New("twin with this Ditto ID already exists")
+	}
+	return errors.New("twin with this name already exists in the project")
+}
+
+// validateModelURL rejects model URLs whose file extension is not a supported model format.
+// An empty URL means the twin has no 3D model.
+func validateModelURL(modelURL string) error {
+	if modelURL == "" {
+		return nil
+	}
+
+	if _, ok := models.ModelFormatForURL(modelURL); !ok {
+		ext := models.ModelURLExtension(modelURL)
+		if ext == "" {
+			ext = "none"
+		}
+		return fmt.Errorf("unsupported model format: %s (supported: %s)", ext, strings.Join(models.SupportedModelFormatIDs(), ", "))
+	}
+	return nil
+}
+
+// BuildDittoID builds a Ditto thing ID in the project's namespace from a local name
+func (s *TwinService) BuildDittoID(projectID uint, localName string) (string, error) {
+	dittoID, err := ditto.BuildThingID(ditto.ProjectNamespace(s.dittoConfig.NamespacePrefix, projectID), localName)
+	if err != nil {
+		return "", errors.New("invalid local name")
+	}
+	return dittoID, nil
+}
+
 // GetByID retrieves a twin by ID
 func (s *TwinService) GetByID(id uint) (*models.Twin, error) {
 	twin, err := s.twinRepo.GetByID(id)
@@ -112,7 +237,7 @@ func (s *TwinService) GetByID(id uint) (*models.Twin, error) {
 
 // GetByDittoID retrieves a twin by Ditto ID
 func (s *TwinService) GetByDittoID(dittoID string) (*models.Twin, error) {
-	twin, err := s.twinRepo.GetByDittoID(dittoID)
+	twin, err := s.twinRepo.GetByDittoID(ditto.NormalizeThingID(dittoID))
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			return nil, errors.New("twin not found")
@@ -124,8 +249,8 @@ func (s *TwinService) GetByDittoID(dittoID string) (*models.Twin, error) {
 	return twin, nil
 }
 
-// ListByProject returns a paginated list of twins in a project
-func (s *TwinService) ListByProject(projectID uint, page, pageSize int) ([]models.Twin, int64, error) {
+// ListByProject returns a paginated list of twins in a project, optionally only those carrying all given tags
+func (s *TwinService) ListByProject(projectID uint, page, pageSize int, tags ...string) ([]models.Twin, int64, error) {
 	// Verify project exists
 	_, err := s.projectRepo.GetByID(projectID)
 	if err != nil {
@@ -137,7 +262,7 @@ func (s *TwinService) ListByProject(projectID uint, page, pageSize int) ([]model
 	}
 
 	offset := (page - 1) * pageSize
-	twins, total, err := s.twinRepo.ListByProjectID(projectID, offset, pageSize)
+	twins, total, err := s.twinRepo.ListByProjectID(projectID, offset, pageSize, tags...)
 	if err != nil {
 		s.logger.Error("Failed to list twins", zap.Uint("project_id", projectID), zap.Error(err))
 		return nil, 0, errors.New("database error")
@@ -157,10 +282,25 @@ func (s *TwinService) Update(twin *models.Twin) error {
 		return errors.New("twin name is required")
 	}
 
+	twin.DittoID = ditto.NormalizeThingID(twin.DittoID)
 	if twin.DittoID == "" {
 		return errors.New("ditto ID is required")
 	}
 
+	if err := validateModelURL(twin.ModelURL); err != nil {
+		return err
+	}
+
+	primaryFeatures, err := normalizePrimaryFeatures(twin.PrimaryFeatures)
+	if err != nil {
+		return err
+	}
+	twin.PrimaryFeatures = primaryFeatures
+
+	if err := validateRetention(twin.RawRetentionDays, twin.AggregatedRetentionDays); err != nil {
+		return err
+	}
+
 	// Check if twin exists
 	existingTwin, err := s.twinRepo.GetByID(twin.ID)
 	if err != nil {
@@ -182,6 +322,13 @@ func (s *TwinService) Update(twin *models.Twin) error {
 		}
 	}
 
+	// Names only need checking when they change, ignoring case
+	if !strings.EqualFold(twin.Name, existingTwin.Name) {
+		if err := s.checkNameAvailable(existingTwin.ProjectID, twin.Name, twin.ID); err != nil {
+			return err
+		}
+	}
+
 	// Maintain original values for fields that shouldn't be updated
 	twin.CreatedBy = existingTwin.CreatedBy
 	twin.CreatedAt = existingTwin.CreatedAt
@@ -189,6 +336,13 @@ func (s *TwinService) Update(twin *models.Twin) error {
 	// Update twin
 	err = s.twinRepo.Update(twin)
 	if err != nil {
+		// The twin may have been deleted since it was read
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("twin not found")
+		}
+		if errors.Is(err, repository.ErrConflict) {
+			return s.conflictError(twin)
+		}
 		s.logger.Error("Failed to update twin", zap.Uint("id", twin.ID), zap.Error(err))
 		return errors.New("failed to update twin")
 	}
@@ -213,6 +367,9 @@ func (s *TwinService) Delete(id uint) error {
 	// Delete twin
 	err = s.twinRepo.Delete(id)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("twin not found")
+		}
 		s.logger.Error("Failed to delete twin", zap.Uint("id", id), zap.Error(err))
 		return errors.New("failed to delete twin")
 	}
@@ -324,3 +481,334 @@ func (s *TwinService) DeleteModelBinding(id uint) error {
 
 	return nil
 }
+
+// ListFeatureBindings lists feature ingestion bindings for a twin
+func (s *TwinService) ListFeatureBindings(twinID uint) ([]models.FeatureBinding, error) {
+	// Verify twin exists
+	_, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	bindings, err := s.twinRepo.ListFeatureBindings(twinID)
+	if err != nil {
+		s.logger.Error("Failed to list feature bindings", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("failed to retrieve feature bindings")
+	}
+
+	return bindings, nil
+}
+
+// SaveFeatureBinding creates or replaces the ingestion binding for a twin feature
+func (s *TwinService) SaveFeatureBinding(binding *models.FeatureBinding) error {
+	if binding.TwinID == 0 {
+		return errors.New("twin ID is required")
+	}
+
+	if binding.FeaturePath == "" {
+		return errors.New("feature path is required")
+	}
+
+	// Apply defaults for the array payload schema
+	if binding.ArrayMode == "" {
+		binding.ArrayMode = models.ArrayModeExpand
+	}
+	if binding.ArrayTimeField == "" {
+		binding.ArrayTimeField = defaultArrayTimeField
+	}
+	if binding.ArrayValueField == "" {
+		binding.ArrayValueField = defaultArrayValueField
+	}
+
+	if binding.ArrayMode != models.ArrayModeExpand && binding.ArrayMode != models.ArrayModeObject {
+		return errors.New("invalid array mode")
+	}
+
+	// Apply defaults for type enforcement
+	if binding.TypeViolationMode == "" {
+		binding.TypeViolationMode = models.TypeViolationError
+	}
+	if binding.ViolationAlertThreshold <= 0 {
+		binding.ViolationAlertThreshold = defaultViolationAlertThreshold
+	}
+
+	switch binding.ExpectedType {
+	case "", "number", "boolean", "string", "object":
+	default:
+		return errors.New("invalid expected type")
+	}
+
+	switch binding.TypeViolationMode {
+	case models.TypeViolationReject, models.TypeViolationDrop, models.TypeViolationNull, models.TypeViolationError:
+	default:
+		return errors.New("invalid type violation mode")
+	}
+
+	if binding.Precision != nil && (*binding.Precision < 0 || *binding.Precision > maxFeaturePrecision) {
+		return fmt.Errorf("precision must be between 0 and %d", maxFeaturePrecision)
+	}
+	if binding.KeepRawValue && binding.Precision == nil {
+		return errors.New("keeping raw values requires a precision")
+	}
+
+	if binding.RollupWindow < 0 || binding.RollupWindow > maxRollupWindow {
+		return fmt.Errorf("rollup window must be between 0 and %d seconds", maxRollupWindow)
+	}
+	if binding.RollupWindow > 0 {
+		// Both store their data in value_json
+		if binding.KeepRawValue {
+			return errors.New("keeping raw values is not supported for rolled-up features")
+		}
+		if binding.ExpectedType != "" && binding.ExpectedType != "number" {
+			return errors.New("rollup requires a number feature")
+		}
+	} else if binding.RollupKeepLast {
+		return errors.New("keeping the last value requires a rollup window")
+	}
+
+	if binding.Unit != "" {
+		if binding.ExpectedType != "" && binding.ExpectedType != "number" {
+			return errors.New("units require a number feature")
+		}
+		unit, err := NormalizeUnit(binding.Unit)
+		if err != nil {
+			return err
+		}
+		binding.Unit = unit
+	}
+
+	if err := normalizeCalibrations(binding); err != nil {
+		return err
+	}
+
+	if binding.PlausibleMin != nil || binding.PlausibleMax != nil {
+		if binding.ExpectedType != "" && binding.ExpectedType != "number" {
+			return errors.New("plausible ranges require a number feature")
+		}
+		if binding.PlausibleMin != nil && binding.PlausibleMax != nil && *binding.PlausibleMin > *binding.PlausibleMax {
+			return errors.New("plausible minimum must not exceed the plausible maximum")
+		}
+	}
+
+	// Verify twin exists
+	_, err := s.twinRepo.GetByID(binding.TwinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", binding.TwinID), zap.Error(err))
+		return errors.New("database error")
+	}
+
+	if err := s.twinRepo.SaveFeatureBinding(binding); err != nil {
+		s.logger.Error("Failed to save feature binding", zap.Uint("twin_id", binding.TwinID), zap.Error(err))
+		return errors.New("failed to save feature binding")
+	}
+
+	return nil
+}
+
+// normalizeTags trims tags and drops duplicates, rejecting empty or oversized tags
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			return nil, errors.New("invalid tag: tags must not be empty")
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("invalid tag: %q exceeds %d characters", tag, maxTagLength)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// AddTags adds tags to a twin and returns its resulting tags; existing tags are kept
+func (s *TwinService) AddTags(id uint, tags []string) ([]string, error) {
+	added, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	twin, err := s.twinRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to get twin", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	merged, _ := normalizeTags(append(append([]string{}, twin.Tags...), added...))
+	if len(merged) > maxTwinTags {
+		return nil, fmt.Errorf("invalid tag: a twin can have at most %d tags", maxTwinTags)
+	}
+
+	if err := s.twinRepo.UpdateTags(id, merged); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to update twin tags", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("failed to update tags")
+	}
+
+	return merged, nil
+}
+
+// RemoveTags removes tags from a twin and returns its remaining tags
+func (s *TwinService) RemoveTags(id uint, tags []string) ([]string, error) {
+	twin, err := s.twinRepo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to get twin", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	removed := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		removed[strings.TrimSpace(tag)] = true
+	}
+
+	remaining := make([]string, 0, len(twin.Tags))
+	for _, tag := range twin.Tags {
+		if !removed[tag] {
+			remaining = append(remaining, tag)
+		}
+	}
+
+	if err := s.twinRepo.UpdateTags(id, remaining); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to update twin tags", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("failed to update tags")
+	}
+
+	return remaining, nil
+}
+
+// ListProjectTags returns the distinct tags used by twins in a project
+func (s *TwinService) ListProjectTags(projectID uint) ([]string, error) {
+	_, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("project not found")
+		}
+		s.logger.Error("Failed to verify project exists", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	tags, err := s.twinRepo.ListProjectTags(projectID)
+	if err != nil {
+		s.logger.Error("Failed to list project tags", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	return tags, nil
+}
+
+// DeleteFeatureBinding deletes a feature binding
+func (s *TwinService) DeleteFeatureBinding(id uint) error {
+	err := s.twinRepo.DeleteFeatureBinding(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("binding not found")
+		}
+		s.logger.Error("Failed to delete feature binding", zap.Uint("id", id), zap.Error(err))
+		return errors.New("failed to delete feature binding")
+	}
+
+	return nil
+}
+
+// Ways a user can get access to a twin
+const (
+	AccessViaProject = "project_member"
+	AccessViaAdmin   = "system_admin"
+)
+
+// TwinAccess is a user who can access a twin and the role they act with
+type TwinAccess struct {
+	UserID    uint   `json:"user_id"`
+	Email     string `json:"email"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	// Role is the effective project role, or "admin" for system admins outside the project
+	Role string `json:"role"`
+	// Via tells where the access comes from
+	Via string `json:"via"`
+}
+
+// ListAccess returns the users who can access a twin: the members of its project with their
+// project role, followed by the active system admins who are not members
+func (s *TwinService) ListAccess(twinID uint) ([]TwinAccess, error) {
+	twin, err := s.GetByID(twinID)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.projectRepo.ListMembers(twin.ProjectID)
+	if err != nil {
+		s.logger.Error("Failed to list project members", zap.Uint("project_id", twin.ProjectID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	admins, err := s.userRepo.ListActiveByRole(models.RoleAdmin)
+	if err != nil {
+		s.logger.Error("Failed to list admins", zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	access := make([]TwinAccess, 0, len(members)+len(admins))
+	isMember := make(map[uint]bool, len(members))
+	for _, member := range members {
+		isMember[member.UserID] = true
+		access = append(access, TwinAccess{
+			UserID:    member.UserID,
+			Email:     member.User.Email,
+			FirstName: member.User.FirstName,
+			LastName:  member.User.LastName,
+			Role:      string(member.Role),
+			Via:       AccessViaProject,
+		})
+	}
+	for _, admin := range admins {
+		if isMember[admin.ID] {
+			continue
+		}
+		access = append(access, TwinAccess{
+			UserID:    admin.ID,
+			Email:     admin.Email,
+			FirstName: admin.FirstName,
+			LastName:  admin.LastName,
+			Role:      string(models.RoleAdmin),
+			Via:       AccessViaAdmin,
+		})
+	}
+
+	return access, nil
+}
+
+// CanManageAccess reports whether a user may see who can access a twin: system admins and the
+// owners of the twin's project
+func (s *TwinService) CanManageAccess(twin *models.Twin, userID uint, isAdmin bool) (bool, error) {
+	if isAdmin {
+		return true, nil
+	}
+	allowed, err := s.projectRepo.CheckUserAccess(twin.ProjectID, userID, models.ProjectRoleOwner)
+	if err != nil {
+		s.logger.Error("Failed to check project access", zap.Uint("project_id", twin.ProjectID), zap.Error(err))
+		return false, errors.New("database error")
+	}
+	return allowed, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// Primary feature limits
+const (
+	maxPrimaryFeatures   = 50
+	maxFeaturePathLength = 255
+)
+
+// normalizePrimaryFeatures trims feature paths and rejects empty, malformed, oversized or
+// duplicate ones
+func normalizePrimaryFeatures(paths []string) ([]string, error) {
+	if len(paths) > maxPrimaryFeatures {
+		return nil, fmt.Errorf("invalid primary feature: at most %d primary features are allowed", maxPrimaryFeatures)
+	}
+
+	seen := make(map[string]bool, len(paths))
+	normalized := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if problem := featurePathProblem(path); problem != "" {
+			return nil, fmt.Errorf("invalid primary feature: %s", problem)
+		}
+		if seen[path] {
+			return nil, fmt.Errorf("invalid primary feature: %q is listed twice", path)
+		}
+		seen[path] = true
+		normalized = append(normalized, path)
+	}
+	return normalized, nil
+}
+
+// featurePathProblem describes why a trimmed feature path is empty, malformed or oversized,
+// or returns "" if it is valid
+func featurePathProblem(path string) string {
+	switch {
+	case path == "":
+		return "feature paths must not be empty"
+	case len(path) > maxFeaturePathLength:
+		return fmt.Sprintf("%q exceeds %d characters", path, maxFeaturePathLength)
+	case strings.ContainsAny(path, " \t\r\n"):
+		return fmt.Sprintf("%q must not contain whitespace", path)
+	case strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") || strings.Contains(path, "//"):
+		return fmt.Sprintf("%q has an empty path segment", path)
+	}
+	return ""
+}
+
+// FeatureState is the latest stored value of a feature
+type FeatureState struct {
+	Time      time.Time       `json:"time"`
+	ValueType string          `json:"value_type"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// TwinState holds the latest values of a twin's features. Primary features without stored
+// values are reported as null.
+type TwinState struct {
+	TwinID   uint                     `json:"twin_id"`
+	DittoID  string                   `json:"ditto_id"`
+	All      bool                     `json:"all"`
+	Features map[string]*FeatureState `json:"features"`
+	// Aliases maps the listed features that have an alias on the twin's type to it
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// GetTwinState returns the latest values of the twin's primary features: its own list, or
+// that of its type. With all set, or when neither declares primary features, every stored
+// feature is returned.
+func (s *HistoryService) GetTwinState(ctx context.Context, twinID uint, all bool) (*TwinState, error) {
+	twin, err := s.twinRepo.GetByID(twinID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("twin not found")
+		}
+		s.logger.Error("Failed to verify twin exists", zap.Uint("twin_id", twinID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	features := []string(twin.PrimaryFeatures)
+	if len(features) == 0 {
+		features = twin.Type.PrimaryFeatures
+	}
+	if all || len(features) == 0 {
+		all = true
+		features, err = s.timeseriesRepo.ListFeaturePaths(twin.DittoID)
+		if err != nil {
+			s.logger.Error("Failed to list feature paths", zap.String("ditto_id", twin.DittoID), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		sort.Strings(features)
+	}
+
+	state := &TwinState{
+		TwinID:   twin.ID,
+		DittoID:  twin.DittoID,
+		All:      all,
+		Features: make(map[string]*FeatureState, len(features)),
+	}
+	for _, feature := range features {
+		point, err := s.timeseriesRepo.GetLatestTimeseriesData(ctx, twin.DittoID, feature)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				state.Features[feature] = nil
+				continue
+			}
+			s.logger.Error("Failed to get latest time-series data",
+				zap.String("ditto_id", twin.DittoID),
+				zap.String("feature_path", feature),
+				zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		calibrations, err := s.queryCalibrations(twin.ID, feature)
+		if err != nil {
+			return nil, err
+		}
+		calibratePoint(point, calibrations)
+		state.Features[feature] = &FeatureState{Time: point.Time, ValueType: point.ValueType, Value: pointData(*point)}
+	}
+	for _, alias := range twin.Type.FeatureAliases {
+		if _, listed := state.Features[alias.FeaturePath]; listed {
+			if state.Aliases == nil {
+				state.Aliases = make(map[string]string)
+			}
+			state.Aliases[alias.FeaturePath] = alias.Alias
+		}
+	}
+
+	return state, nil
+}
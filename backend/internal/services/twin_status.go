@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// Twin status defaults, used until SetStatusConfig is called
+const (
+	defaultMaxStatusTwins = 500
+	defaultStaleAfter     = 900 // seconds
+)
+
+// Status query errors
+var (
+	ErrTooManyStatusTwins = errors.New("too many twins requested")
+	ErrStatusAccessDenied = errors.New("insufficient permissions for this project")
+)
+
+// severityRank orders alert severities from least to most severe
+var severityRank = map[string]int{"info": 1, "warning": 2, "error": 3, "critical": 4}
+
+// TwinStatus is the reporting and alert state of a twin
+type TwinStatus struct {
+	TwinID           uint       `json:"twin_id"`
+	DittoID          string     `json:"ditto_id"`
+	ProjectID        uint       `json:"project_id"`
+	LastSeen         *time.Time `json:"last_seen"`
+	ActiveAlertCount int64      `json:"active_alert_count"`
+	HighestSeverity  string     `json:"highest_severity,omitempty"`
+	Stale            bool       `json:"stale"`
+}
+
+// TwinStatusQuery selects the twins of a status request: either the given twins or all twins of a project
+type TwinStatusQuery struct {
+	TwinIDs   []uint
+	ProjectID uint
+	UserID    uint
+	// IsAdmin lets the query cover twins of every project
+	IsAdmin bool
+}
+
+// TwinStatusReport holds the status of the requested twins
+type TwinStatusReport struct {
+	Statuses []TwinStatus
+	// Missing lists the requested twin IDs that don't exist or the user cannot access
+	Missing []uint
+}
+
+// Status reports when each of the selected twins last recorded a point and its unacknowledged alerts.
+// Twins in projects the user is not a member of are reported as missing.
+func (s *TwinService) Status(ctx context.Context, query TwinStatusQuery) (*TwinStatusReport, error) {
+	maxTwins := s.statusConfig.MaxTwins
+
+	var twins []models.Twin
+	requested := uniqueIDs(query.TwinIDs)
+	if query.ProjectID != 0 {
+		if _, err := s.projectRepo.GetByID(query.ProjectID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, errors.New("project not found")
+			}
+			s.logger.Error("Failed to verify project exists", zap.Uint("project_id", query.ProjectID), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		if !query.IsAdmin {
+			allowed, err := s.projectRepo.CheckUserAccess(query.ProjectID, query.UserID, models.ProjectRoleViewer)
+			if err != nil {
+				s.logger.Error("Failed to check project access", zap.Uint("project_id", query.ProjectID), zap.Error(err))
+				return nil, errors.New("database error")
+			}
+			if !allowed {
+				return nil, ErrStatusAccessDenied
+			}
+		}
+
+		limit := -1
+		if maxTwins > 0 {
+			limit = maxTwins + 1
+		}
+		listed, _, err := s.twinRepo.ListByProjectID(query.ProjectID, 0, limit)
+		if err != nil {
+			s.logger.Error("Failed to list twins", zap.Uint("project_id", query.ProjectID), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		twins = listed
+	} else {
+		if maxTwins > 0 && len(requested) > maxTwins {
+			return nil, ErrTooManyStatusTwins
+		}
+		listed, err := s.twinRepo.ListByIDs(requested)
+		if err != nil {
+			s.logger.Error("Failed to list twins", zap.Int("count", len(requested)), zap.Error(err))
+			return nil, errors.New("database error")
+		}
+		twins = listed
+	}
+	if maxTwins > 0 && len(twins) > maxTwins {
+		return nil, ErrTooManyStatusTwins
+	}
+
+	twins, err := s.accessibleTwins(query, twins)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TwinStatusReport{Statuses: make([]TwinStatus, 0, len(twins)), Missing: []uint{}}
+	found := make(map[uint]bool, len(twins))
+	dittoIDs := make([]string, 0, len(twins))
+	for _, twin := range twins {
+		found[twin.ID] = true
+		dittoIDs = append(dittoIDs, twin.DittoID)
+	}
+	if query.ProjectID == 0 {
+		for _, id := range requested {
+			if !found[id] {
+				report.Missing = append(report.Missing, id)
+			}
+		}
+	}
+
+	lastSeen, err := s.seriesRepo.GetLastSeen(ctx, dittoIDs)
+	if err != nil {
+		s.logger.Error("Failed to get twin last seen times", zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	alertCounts, err := s.seriesRepo.CountActiveAlerts(ctx, dittoIDs)
+	if err != nil {
+		s.logger.Error("Failed to count active alerts", zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	alerts := make(map[string]*TwinStatus, len(alertCounts))
+	for _, count := range alertCounts {
+		status, ok := alerts[count.TwinID]
+		if !ok {
+			status = &TwinStatus{}
+			alerts[count.TwinID] = status
+		}
+		status.ActiveAlertCount += count.Count
+		if severityRank[count.Severity] > severityRank[status.HighestSeverity] {
+			status.HighestSeverity = count.Severity
+		}
+	}
+
+	staleBefore := time.Now().Add(-time.Duration(s.statusConfig.StaleAfter) * time.Second)
+	for _, twin := range twins {
+		status := TwinStatus{TwinID: twin.ID, DittoID: twin.DittoID, ProjectID: twin.ProjectID, Stale: true}
+		if at, ok := lastSeen[twin.DittoID]; ok {
+			status.LastSeen = &at
+			status.Stale = s.statusConfig.StaleAfter > 0 && at.Before(staleBefore)
+		}
+		if active, ok := alerts[twin.DittoID]; ok {
+			status.ActiveAlertCount = active.ActiveAlertCount
+			status.HighestSeverity = active.HighestSeverity
+		}
+		report.Statuses = append(report.Statuses, status)
+	}
+
+	return report, nil
+}
+
+// accessibleTwins filters out the twins of projects the user may not view
+func (s *TwinService) accessibleTwins(query TwinStatusQuery, twins []models.Twin) ([]models.Twin, error) {
+	if query.IsAdmin {
+		return twins, nil
+	}
+
+	access := make(map[uint]bool)
+	accessible := make([]models.Twin, 0, len(twins))
+	for _, twin := range twins {
+		allowed, checked := access[twin.ProjectID]
+		if !checked {
+			var err error
+			allowed, err = s.projectRepo.CheckUserAccess(twin.ProjectID, query.UserID, models.ProjectRoleViewer)
+			if err != nil {
+				s.logger.Error("Failed to check project access", zap.Uint("project_id", twin.ProjectID), zap.Error(err))
+				return nil, errors.New("database error")
+			}
+			access[twin.ProjectID] = allowed
+		}
+		if allowed {
+			accessible = append(accessible, twin)
+		}
+	}
+	return accessible, nil
+}
+
+// uniqueIDs returns the IDs without duplicates, in their original order
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Compatibility check sample sizes
+const (
+	defaultCompatSampleSize = 50
+	maxCompatSampleSize     = 500
+)
+
+// FieldCompatProblem is a feature of a twin whose latest value the new schema rejects
+type FieldCompatProblem struct {
+	FeaturePath string              `json:"feature_path"`
+	Value       json.RawMessage     `json:"value"`
+	Errors      []utils.SchemaError `json:"errors"`
+}
+
+// TwinCompatResult lists the features of a twin that break under the new schema
+type TwinCompatResult struct {
+	TwinID  uint                 `json:"twin_id"`
+	DittoID string               `json:"ditto_id"`
+	Name    string               `json:"name"`
+	Fields  []FieldCompatProblem `json:"fields"`
+}
+
+// SchemaCompatReport is the outcome of checking a sample of a twin type's twins against the
+// schema of a new version
+type SchemaCompatReport struct {
+	TwinTypeID     uint   `json:"twin_type_id"`
+	CurrentVersion string `json:"current_version"`
+	Version        string `json:"version"`
+	// TotalTwins is the number of twins of the type, of which SampledTwins were checked
+	TotalTwins   int64 `json:"total_twins"`
+	SampledTwins int   `json:"sampled_twins"`
+	// Compatible is true if no sampled twin breaks
+	Compatible bool               `json:"compatible"`
+	Breaking   []TwinCompatResult `json:"breaking"`
+}
+
+// CheckCompatibility validates the current state of a random sample of the twins of a type
+// against the schema of a new version, before it is published. A feature breaks if its latest
+// value is valid under the current schema but not under the new one, or if the new schema no
+// longer declares it; values the current schema already rejects are not reported.
+func (s *TwinTypeService) CheckCompatibility(ctx context.Context, id uint, version string, schema models.JSON, sampleSize int) (*SchemaCompatReport, error) {
+	switch {
+	case sampleSize == 0:
+		sampleSize = defaultCompatSampleSize
+	case sampleSize < 0 || sampleSize > maxCompatSampleSize:
+		return nil, fmt.Errorf("invalid sample size: must be between 1 and %d", maxCompatSampleSize)
+	}
+
+	twinType, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	version = strings.TrimSpace(version)
+	if version == twinType.Version {
+		return nil, fmt.Errorf("invalid version: %s is the current version of the twin type", version)
+	}
+	if check := utils.CheckJSONSchema(schema, nil); !check.Valid {
+		return nil, fmt.Errorf("invalid schema: %s", check.Errors[0].Message)
+	}
+
+	twins, total, err := s.twinTypeRepo.SampleTwins(id, sampleSize)
+	if err != nil {
+		s.logger.Error("Failed to sample twins of twin type", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	checker := &schemaCompatChecker{
+		current:  newFeatureSchemas(twinType.SchemaJSON),
+		proposed: newFeatureSchemas(schema),
+	}
+	report := &SchemaCompatReport{
+		TwinTypeID:     twinType.ID,
+		CurrentVersion: twinType.Version,
+		Version:        version,
+		TotalTwins:     total,
+		SampledTwins:   len(twins),
+		Breaking:       []TwinCompatResult{},
+	}
+	sort.Slice(twins, func(i, j int) bool { return twins[i].ID < twins[j].ID })
+	for _, twin := range twins {
+		fields, err := s.checkTwinCompatibility(ctx, checker, &twin)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 {
+			report.Breaking = append(report.Breaking, TwinCompatResult{
+				TwinID:  twin.ID,
+				DittoID: twin.DittoID,
+				Name:    twin.Name,
+				Fields:  fields,
+			})
+		}
+	}
+	report.Compatible = len(report.Breaking) == 0
+	return report, nil
+}
+
+// checkTwinCompatibility returns the features of a twin whose latest value breaks under the new schema
+func (s *TwinTypeService) checkTwinCompatibility(ctx context.Context, checker *schemaCompatChecker, twin *models.Twin) ([]FieldCompatProblem, error) {
+	paths, err := s.timeseriesRepo.ListFeaturePaths(twin.DittoID)
+	if err != nil {
+		s.logger.Error("Failed to list feature paths", zap.String("ditto_id", twin.DittoID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	sort.Strings(paths)
+
+	var problems []FieldCompatProblem
+	for _, path := range paths {
+		point, err := s.timeseriesRepo.GetLatestTimeseriesData(ctx, twin.DittoID, path)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			s.logger.Error("Failed to get latest time-series data",
+				zap.String("ditto_id", twin.DittoID),
+				zap.String("feature_path", path),
+				zap.Error(err))
+			return nil, errors.New("database error")
+		}
+
+		value := pointData(*point)
+		if errs := checker.breaks(path, value); len(errs) > 0 {
+			problems = append(problems, FieldCompatProblem{FeaturePath: path, Value: value, Errors: errs})
+		}
+	}
+	return problems, nil
+}
+
+// schemaCompatChecker compares feature values against the current and the proposed schema
+type schemaCompatChecker struct {
+	current  *featureSchemas
+	proposed *featureSchemas
+}
+
+// breaks returns why a feature value that the current schema accepts is rejected by the proposed one
+func (c *schemaCompatChecker) breaks(path string, value json.RawMessage) []utils.SchemaError {
+	current, proposed := c.current.property(path), c.proposed.property(path)
+	switch {
+	case proposed == nil && current != nil:
+		return []utils.SchemaError{{Message: "feature is no longer declared by the schema"}}
+	case proposed == nil, current != nil && reflect.DeepEqual(current, proposed):
+		return nil
+	}
+
+	errs := c.proposed.validate(path, value)
+	if len(errs) == 0 || (current != nil && len(c.current.validate(path, value)) > 0) {
+		return nil
+	}
+	return errs
+}
+
+// featureSchemas compiles the schemas of the features of a twin type schema on demand
+type featureSchemas struct {
+	root       map[string]interface{}
+	properties map[string]interface{}
+	compiled   map[string]compiledFeatureSchema
+}
+
+// compiledFeatureSchema is a compiled feature schema, or why it does not compile
+type compiledFeatureSchema struct {
+	schema *utils.CompiledSchema
+	err    error
+}
+
+// newFeatureSchemas prepares the feature schemas of a twin type schema
+func newFeatureSchemas(schema models.JSON) *featureSchemas {
+	var root map[string]interface{}
+	_ = json.Unmarshal(schema, &root)
+	return &featureSchemas{
+		root:       root,
+		properties: schemaFeatures(schema),
+		compiled:   make(map[string]compiledFeatureSchema),
+	}
+}
+
+// property returns the schema of a feature, or nil if it is not declared
+func (f *featureSchemas) property(path string) map[string]interface{} {
+	return schemaFeature(f.properties, path)
+}
+
+// validate returns the ways a feature value does not match the schema of a declared feature
+func (f *featureSchemas) validate(path string, value json.RawMessage) []utils.SchemaError {
+	compiled, ok := f.compiled[path]
+	if !ok {
+		compiled = f.compile(f.property(path))
+		f.compiled[path] = compiled
+	}
+	if compiled.err != nil {
+		return []utils.SchemaError{{Message: "feature schema does not compile: " + compiled.err.Error()}}
+	}
+
+	errs, err := compiled.schema.Validate(value)
+	if err != nil {
+		return []utils.SchemaError{{Message: err.Error()}}
+	}
+	return errs
+}
+
+// compile compiles the schema of a feature, keeping the root's definitions so its references resolve
+func (f *featureSchemas) compile(property map[string]interface{}) compiledFeatureSchema {
+	document := make(map[string]interface{}, len(property)+2)
+	for key, keyword := range property {
+		document[key] = keyword
+	}
+	for _, key := range []string{"definitions", "$defs"} {
+		if _, shadowed := document[key]; !shadowed && f.root[key] != nil {
+			document[key] = f.root[key]
+		}
+	}
+
+	schema, err := utils.CompileSchema(document)
+	return compiledFeatureSchema{schema: schema, err: err}
+}
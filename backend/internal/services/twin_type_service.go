@@ -1,7 +1,11 @@
 package services
 
 import (
+	"encoding/json"
 	"errors"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/digital-egiz/backend/internal/db"
 	"github.com/digital-egiz/backend/internal/db/models"
@@ -10,22 +14,39 @@ import (
 	"go.uber.org/zap"
 )
 
+// TwinTypeUsageReport lists what depends on a twin type: a page of its twins and the ML
+// task bindings tied to them, with totals over all of its twins
+type TwinTypeUsageReport struct {
+	Usage    repository.TwinTypeUsage
+	Twins    []models.Twin
+	Bindings map[uint][]models.MLTaskBinding // by twin ID
+}
+
+// Outcomes of a twin type upsert
+const (
+	TwinTypeCreated   = "created"
+	TwinTypeUpdated   = "updated"
+	TwinTypeUnchanged = "unchanged"
+)
+
 // TwinTypeService handles twin type-related business logic
 type TwinTypeService struct {
-	db           *db.Database
-	logger       *utils.Logger
-	twinTypeRepo repository.TwinTypeRepository
-	userRepo     repository.UserRepository
+	db             *db.Database
+	logger         *utils.Logger
+	twinTypeRepo   repository.TwinTypeRepository
+	userRepo       repository.UserRepository
+	timeseriesRepo repository.TimeseriesRepository
 }
 
 // NewTwinTypeService creates a new twin type service
 func NewTwinTypeService(db *db.Database, logger *utils.Logger) *TwinTypeService {
 	repoFactory := repository.NewRepositoryFactory(db.DB)
 	return &TwinTypeService{
-		db:           db,
-		logger:       logger.Named("twin_type_service"),
-		twinTypeRepo: repoFactory.TwinType(),
-		userRepo:     repoFactory.User(),
+		db:             db,
+		logger:         logger.Named("twin_type_service"),
+		twinTypeRepo:   repoFactory.TwinType(),
+		userRepo:       repoFactory.User(),
+		timeseriesRepo: repoFactory.Timeseries(),
 	}
 }
 
@@ -44,8 +65,30 @@ func (s *TwinTypeService) Create(twinType *models.TwinType) error {
 		return errors.New("twin type creator is required")
 	}
 
+	primaryFeatures, err := normalizePrimaryFeatures(twinType.PrimaryFeatures)
+	if err != nil {
+		return err
+	}
+	twinType.PrimaryFeatures = primaryFeatures
+
+	featureMetadata, err := normalizeFeatureMetadata(twinType.SchemaJSON, twinType.FeatureMetadata)
+	if err != nil {
+		return err
+	}
+	twinType.FeatureMetadata = featureMetadata
+
+	featureAliases, err := normalizeFeatureAliases(twinType.SchemaJSON, twinType.FeatureAliases)
+	if err != nil {
+		return err
+	}
+	twinType.FeatureAliases = featureAliases
+
+	if err := validateRetention(twinType.RawRetentionDays, twinType.AggregatedRetentionDays); err != nil {
+		return err
+	}
+
 	// Verify user exists
-	_, err := s.userRepo.GetByID(twinType.CreatedBy)
+	_, err = s.userRepo.GetByID(twinType.CreatedBy)
 	if err != nil {
 		s.logger.Error("Failed to verify user exists", zap.Uint("user_id", twinType.CreatedBy), zap.Error(err))
 		return errors.New("invalid creator user")
@@ -70,6 +113,130 @@ func (s *TwinTypeService) Create(twinType *models.TwinType) error {
 	return nil
 }
 
+// Upsert creates a twin type, or brings the twin type of the same name up to date, so the
+// same definitions can be applied repeatedly. A version's schema is immutable: re-applying a
+// known version only updates its description, primary features, feature metadata, feature
+// aliases and retention, and fails if its schema differs. Another version replaces the stored
+// one only if it is newer, so an outdated definition cannot roll the type back. It returns
+// whether the type was created, updated or unchanged.
+func (s *TwinTypeService) Upsert(twinType *models.TwinType) (string, error) {
+	if twinType.Name == "" {
+		return "", errors.New("twin type name is required")
+	}
+
+	if twinType.Version == "" {
+		return "", errors.New("twin type version is required")
+	}
+
+	existing, err := s.twinTypeRepo.GetByName(twinType.Name)
+	if errors.Is(err, repository.ErrNotFound) {
+		if err := s.Create(twinType); err != nil {
+			return "", err
+		}
+		return TwinTypeCreated, nil
+	} else if err != nil {
+		s.logger.Error("Error checking twin type existence", zap.String("name", twinType.Name), zap.Error(err))
+		return "", errors.New("database error")
+	}
+
+	primaryFeatures, err := normalizePrimaryFeatures(twinType.PrimaryFeatures)
+	if err != nil {
+		return "", err
+	}
+	featureMetadata, err := normalizeFeatureMetadata(twinType.SchemaJSON, twinType.FeatureMetadata)
+	if err != nil {
+		return "", err
+	}
+	featureAliases, err := normalizeFeatureAliases(twinType.SchemaJSON, twinType.FeatureAliases)
+	if err != nil {
+		return "", err
+	}
+	if err := validateRetention(twinType.RawRetentionDays, twinType.AggregatedRetentionDays); err != nil {
+		return "", err
+	}
+
+	if existing.Version == twinType.Version && !equalJSON(existing.SchemaJSON, twinType.SchemaJSON) {
+		return "", errors.New("twin type version conflict: the schema of version " + existing.Version + " differs, publish it as a new version")
+	}
+	if existing.Version != twinType.Version && compareVersions(twinType.Version, existing.Version) <= 0 {
+		return "", errors.New("twin type version conflict: version " + twinType.Version + " is not newer than the stored version " + existing.Version)
+	}
+
+	if existing.Version == twinType.Version &&
+		existing.Description == twinType.Description &&
+		equalJSON(existing.PrimaryFeatures, primaryFeatures) &&
+		equalJSON(existing.FeatureMetadata, featureMetadata) &&
+		equalJSON(existing.FeatureAliases, featureAliases) &&
+		equalJSON(existing.RawRetentionDays, twinType.RawRetentionDays) &&
+		equalJSON(existing.AggregatedRetentionDays, twinType.AggregatedRetentionDays) {
+		*twinType = *existing
+		return TwinTypeUnchanged, nil
+	}
+
+	existing.Description = twinType.Description
+	existing.Version = twinType.Version
+	existing.SchemaJSON = twinType.SchemaJSON
+	existing.PrimaryFeatures = primaryFeatures
+	existing.FeatureMetadata = featureMetadata
+	existing.FeatureAliases = featureAliases
+	existing.RawRetentionDays = twinType.RawRetentionDays
+	existing.AggregatedRetentionDays = twinType.AggregatedRetentionDays
+	if err := s.twinTypeRepo.Update(existing); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return "", errors.New("twin type not found")
+		}
+		s.logger.Error("Failed to update twin type", zap.Uint("id", existing.ID), zap.Error(err))
+		return "", errors.New("failed to update twin type")
+	}
+
+	*twinType = *existing
+	return TwinTypeUpdated, nil
+}
+
+// equalJSON reports whether two values have the same JSON representation, regardless of
+// formatting and key order
+func equalJSON(a, b interface{}) bool {
+	var decodedA, decodedB interface{}
+	dataA, err := json.Marshal(a)
+	if err != nil || json.Unmarshal(dataA, &decodedA) != nil {
+		return false
+	}
+	dataB, err := json.Marshal(b)
+	if err != nil || json.Unmarshal(dataB, &decodedB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(decodedA, decodedB)
+}
+
+// compareVersions orders two versions such as "1.2" and "v1.10.0" by their dot-separated
+// components, numerically where both are numbers; missing components count as 0. It returns
+// a negative number, zero or a positive number as a is older than, equal to or newer than b.
+func compareVersions(a, b string) int {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		partA, partB := "0", "0"
+		if i < len(partsA) {
+			partA = partsA[i]
+		}
+		if i < len(partsB) {
+			partB = partsB[i]
+		}
+
+		numA, errA := strconv.Atoi(partA)
+		numB, errB := strconv.Atoi(partB)
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				return numA - numB
+			}
+		case partA != partB:
+			return strings.Compare(partA, partB)
+		}
+	}
+	return 0
+}
+
 // GetByID retrieves a twin type by ID
 func (s *TwinTypeService) GetByID(id uint) (*models.TwinType, error) {
 	twinType, err := s.twinTypeRepo.GetByID(id)
@@ -110,6 +277,45 @@ func (s *TwinTypeService) List(page, pageSize int) ([]models.TwinType, int64, er
 	return twinTypes, total, nil
 }
 
+// Usage returns the twins using a twin type, paginated, and the ML task bindings tied to them
+func (s *TwinTypeService) Usage(id uint, page, pageSize int) (*TwinTypeUsageReport, error) {
+	if _, err := s.GetByID(id); err != nil {
+		return nil, err
+	}
+
+	usage, err := s.twinTypeRepo.GetUsage(id)
+	if err != nil {
+		s.logger.Error("Failed to count twin type usage", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	twins, err := s.twinTypeRepo.ListTwins(id, (page-1)*pageSize, pageSize)
+	if err != nil {
+		s.logger.Error("Failed to list twins of twin type", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	twinIDs := make([]uint, len(twins))
+	for i, twin := range twins {
+		twinIDs[i] = twin.ID
+	}
+	bindings, err := s.twinTypeRepo.ListTwinBindings(twinIDs)
+	if err != nil {
+		s.logger.Error("Failed to list ML bindings of twin type", zap.Uint("id", id), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	report := &TwinTypeUsageReport{
+		Usage:    *usage,
+		Twins:    twins,
+		Bindings: make(map[uint][]models.MLTaskBinding, len(twins)),
+	}
+	for _, binding := range bindings {
+		report.Bindings[binding.TwinID] = append(report.Bindings[binding.TwinID], binding)
+	}
+	return report, nil
+}
+
 // Update updates a twin type's information
 func (s *TwinTypeService) Update(twinType *models.TwinType) error {
 	// Validate twin type data
@@ -125,6 +331,28 @@ func (s *TwinTypeService) Update(twinType *models.TwinType) error {
 		return errors.New("twin type version is required")
 	}
 
+	primaryFeatures, err := normalizePrimaryFeatures(twinType.PrimaryFeatures)
+	if err != nil {
+		return err
+	}
+	twinType.PrimaryFeatures = primaryFeatures
+
+	featureMetadata, err := normalizeFeatureMetadata(twinType.SchemaJSON, twinType.FeatureMetadata)
+	if err != nil {
+		return err
+	}
+	twinType.FeatureMetadata = featureMetadata
+
+	featureAliases, err := normalizeFeatureAliases(twinType.SchemaJSON, twinType.FeatureAliases)
+	if err != nil {
+		return err
+	}
+	twinType.FeatureAliases = featureAliases
+
+	if err := validateRetention(twinType.RawRetentionDays, twinType.AggregatedRetentionDays); err != nil {
+		return err
+	}
+
 	// Check if twin type exists
 	existingTwinType, err := s.twinTypeRepo.GetByID(twinType.ID)
 	if err != nil {
@@ -149,6 +377,10 @@ func (s *TwinTypeService) Update(twinType *models.TwinType) error {
 	// Update twin type
 	err = s.twinTypeRepo.Update(twinType)
 	if err != nil {
+		// The twin type may have been deleted since it was read
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("twin type not found")
+		}
 		s.logger.Error("Failed to update twin type", zap.Uint("id", twinType.ID), zap.Error(err))
 		return errors.New("failed to update twin type")
 	}
@@ -174,6 +406,9 @@ func (s *TwinTypeService) Delete(id uint) error {
 	// Delete twin type
 	err = s.twinTypeRepo.Delete(id)
 	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("twin type not found")
+		}
 		s.logger.Error("Failed to delete twin type", zap.Uint("id", id), zap.Error(err))
 		return errors.New("failed to delete twin type")
 	}
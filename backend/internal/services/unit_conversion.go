@@ -0,0 +1,196 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"go.uber.org/zap"
+)
+
+// ErrUnitConversion is returned when values cannot be converted to the requested unit
+var ErrUnitConversion = errors.New("unit conversion not possible")
+
+// Unit dimensions
+const (
+	DimensionTemperature = "temperature"
+	DimensionPressure    = "pressure"
+	DimensionLength      = "length"
+)
+
+// unitDefinition converts a unit to the base unit of its dimension: base = value*scale + offset
+type unitDefinition struct {
+	symbol    string
+	dimension string
+	scale     float64
+	offset    float64
+}
+
+// unitRegistry lists the supported units by lower-case name. The base units are kelvin,
+// pascal and metre.
+var unitRegistry = map[string]unitDefinition{}
+
+func init() {
+	for _, unit := range []struct {
+		unitDefinition
+		aliases []string
+	}{
+		{unitDefinition{"K", DimensionTemperature, 1, 0}, []string{"kelvin"}},
+		{unitDefinition{"C", DimensionTemperature, 1, 273.15}, []string{"°c", "celsius"}},
+		{unitDefinition{"F", DimensionTemperature, 5.0 / 9.0, 273.15 - 32*5.0/9.0}, []string{"°f", "fahrenheit"}},
+		{unitDefinition{"Pa", DimensionPressure, 1, 0}, []string{"pascal"}},
+		{unitDefinition{"hPa", DimensionPressure, 100, 0}, nil},
+		{unitDefinition{"kPa", DimensionPressure, 1000, 0}, nil},
+		{unitDefinition{"bar", DimensionPressure, 100000, 0}, nil},
+		{unitDefinition{"psi", DimensionPressure, 6894.757293168, 0}, nil},
+		{unitDefinition{"atm", DimensionPressure, 101325, 0}, nil},
+		{unitDefinition{"mm", DimensionLength, 0.001, 0}, nil},
+		{unitDefinition{"cm", DimensionLength, 0.01, 0}, nil},
+		{unitDefinition{"m", DimensionLength, 1, 0}, []string{"metre", "meter"}},
+		{unitDefinition{"km", DimensionLength, 1000, 0}, nil},
+		{unitDefinition{"in", DimensionLength, 0.0254, 0}, []string{"inch"}},
+		{unitDefinition{"ft", DimensionLength, 0.3048, 0}, []string{"foot"}},
+		{unitDefinition{"mi", DimensionLength, 1609.344, 0}, []string{"mile"}},
+	} {
+		for _, name := range append([]string{unit.symbol}, unit.aliases...) {
+			unitRegistry[strings.ToLower(name)] = unit.unitDefinition
+		}
+	}
+}
+
+// lookupUnit returns the definition of a unit by symbol or alias, ignoring case
+func lookupUnit(name string) (unitDefinition, bool) {
+	unit, ok := unitRegistry[strings.ToLower(strings.TrimSpace(name))]
+	return unit, ok
+}
+
+// NormalizeUnit returns the symbol of a registered unit, e.g. "C" for "celsius"
+func NormalizeUnit(name string) (string, error) {
+	unit, ok := lookupUnit(name)
+	if !ok {
+		return "", fmt.Errorf("unknown unit %q", name)
+	}
+	return unit.symbol, nil
+}
+
+// UnitConversion converts values between two units of the same dimension: to = from*factor + offset
+type UnitConversion struct {
+	From   string
+	To     string
+	factor float64
+	offset float64
+}
+
+// NewUnitConversion returns the conversion between two registered units
+func NewUnitConversion(from, to string) (*UnitConversion, error) {
+	source, ok := lookupUnit(from)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown unit %q", ErrUnitConversion, from)
+	}
+	target, ok := lookupUnit(to)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown unit %q", ErrUnitConversion, to)
+	}
+	if source.dimension != target.dimension {
+		return nil, fmt.Errorf("%w: cannot convert %s (%s) to %s (%s)",
+			ErrUnitConversion, source.symbol, source.dimension, target.symbol, target.dimension)
+	}
+	return &UnitConversion{
+		From:   source.symbol,
+		To:     target.symbol,
+		factor: source.scale / target.scale,
+		offset: (source.offset - target.offset) / target.scale,
+	}, nil
+}
+
+// conversionDigits is the number of significant digits converted values are rounded to,
+// which drops the floating point noise of the conversion factors
+const conversionDigits = 12
+
+// Convert converts a value
+func (c *UnitConversion) Convert(value float64) float64 {
+	return roundSignificant(value*c.factor + c.offset)
+}
+
+// roundSignificant rounds a value to conversionDigits significant digits
+func roundSignificant(value float64) float64 {
+	rounded, err := strconv.ParseFloat(strconv.FormatFloat(value, 'g', conversionDigits, 64), 64)
+	if err != nil {
+		return value
+	}
+	return rounded
+}
+
+// Timeseries returns converted copies of the numeric points; other points are returned as stored.
+// Raw values and rollup summaries kept in value_json are converted as well.
+func (c *UnitConversion) Timeseries(data []models.TimeseriesData) []models.TimeseriesData {
+	converted := make([]models.TimeseriesData, len(data))
+	for i, point := range data {
+		if point.ValueType == "number" {
+			point.ValueNum = c.Convert(point.ValueNum)
+			point.ValueJSON = c.convertValueJSON(point.ValueJSON)
+		}
+		converted[i] = point
+	}
+	return converted
+}
+
+// convertValueJSON converts the raw number or rollup summary held in a numeric point's value_json
+func (c *UnitConversion) convertValueJSON(value string) string {
+	if value == "" {
+		return value
+	}
+	if raw, err := strconv.ParseFloat(value, 64); err == nil {
+		return strconv.FormatFloat(c.Convert(raw), 'g', -1, 64)
+	}
+	var summary RollupSummary
+	if err := json.Unmarshal([]byte(value), &summary); err != nil || summary.Count == 0 {
+		return value
+	}
+	summary.Min = c.Convert(summary.Min)
+	summary.Max = c.Convert(summary.Max)
+	summary.Avg = c.Convert(summary.Avg)
+	if summary.Last != nil {
+		last := c.Convert(*summary.Last)
+		summary.Last = &last
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return value
+	}
+	return string(data)
+}
+
+// Aggregated returns converted copies of aggregated buckets. The sum takes the offset once per value.
+func (c *UnitConversion) Aggregated(data []models.AggregatedData) []models.AggregatedData {
+	converted := make([]models.AggregatedData, len(data))
+	for i, bucket := range data {
+		bucket.Min = c.Convert(bucket.Min)
+		bucket.Max = c.Convert(bucket.Max)
+		bucket.Avg = c.Convert(bucket.Avg)
+		bucket.Sum = roundSignificant(bucket.Sum*c.factor + c.offset*float64(bucket.Count))
+		converted[i] = bucket
+	}
+	return converted
+}
+
+// FeatureUnitConversion returns the conversion from the unit stored for a twin feature, as set
+// on its feature binding, to the requested unit
+func (s *HistoryService) FeatureUnitConversion(twinID uint, featurePath, to string) (*UnitConversion, error) {
+	binding, err := s.twinRepo.GetFeatureBinding(twinID, featurePath)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		s.logger.Error("Failed to get feature binding",
+			zap.Uint("twin_id", twinID),
+			zap.String("feature_path", featurePath),
+			zap.Error(err))
+		return nil, errors.New("database error")
+	}
+	if binding == nil || binding.Unit == "" {
+		return nil, fmt.Errorf("%w: feature %s has no unit", ErrUnitConversion, featurePath)
+	}
+	return NewUnitConversion(binding.Unit, to)
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Webhook delivery headers
+const (
+	WebhookHeaderEvent     = "X-Egiz-Event"
+	WebhookHeaderDelivery  = "X-Egiz-Delivery"
+	WebhookHeaderTimestamp = "X-Egiz-Timestamp"
+	WebhookHeaderSignature = "X-Egiz-Signature"
+	WebhookHeaderTest      = "X-Egiz-Test"
+)
+
+const (
+	webhookDeliveryTimeout = 10 * time.Second
+	webhookMaxResponseBody = 1024
+)
+
+// ErrWebhookAddressNotAllowed is returned when a webhook targets an internal address
+var ErrWebhookAddressNotAllowed = errors.New("webhook address not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range, where some clouds serve instance metadata
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// WebhookEvent is the body delivered to webhook receivers
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	ProjectID uint        `json:"project_id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Test      bool        `json:"test,omitempty"`
+	Payload   interface{} `json:"payload"`
+}
+
+// WebhookDeliveryResult describes the outcome of a delivery; the receiver's response body is never included
+type WebhookDeliveryResult struct {
+	DeliveryID string `json:"delivery_id"`
+	EventType  string `json:"event_type"`
+	StatusCode int    `json:"status_code"`
+	LatencyMs  int64  `json:"latency_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookService manages webhook subscriptions and signed event delivery
+type WebhookService struct {
+	db          *db.Database
+	logger      *utils.Logger
+	webhookRepo repository.WebhookRepository
+	httpClient  *http.Client
+	// allowPrivate lets webhooks reach loopback, private and link-local addresses
+	allowPrivate bool
+}
+
+// NewWebhookService creates a new webhook service. Webhooks may only reach public addresses
+// unless private networks are allowed.
+func NewWebhookService(db *db.Database, logger *utils.Logger) *WebhookService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+	return &WebhookService{
+		db:          db,
+		logger:      logger.Named("webhook_service"),
+		webhookRepo: repoFactory.Webhook(),
+		httpClient:  newWebhookClient(false),
+	}
+}
+
+// SetAllowPrivateNetworks lets webhooks reach loopback, private and link-local addresses, for
+// receivers inside the deployment's own network
+func (s *WebhookService) SetAllowPrivateNetworks(allow bool) {
+	s.allowPrivate = allow
+	s.httpClient = newWebhookClient(allow)
+}
+
+// newWebhookClient creates the client delivering webhooks. Without private networks its dialer
+// refuses internal addresses, checking the resolved address of every connection, so neither
+// redirects nor DNS names resolving to them can reach internal services.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookDeliveryTimeout}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isInternalAddress(ip) {
+				return fmt.Errorf("%w: %s", ErrWebhookAddressNotAllowed, host)
+			}
+			return nil
+		}
+		// A proxy would connect to the receiver on the service's behalf, past the check
+		transport.Proxy = nil
+	}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: webhookDeliveryTimeout, Transport: transport}
+}
+
+// isInternalAddress reports whether an address belongs to the host or its internal networks
+func isInternalAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip)
+}
+
+// SignWebhookPayload computes the signature sent in the X-Egiz-Signature header.
+// Receivers verify it by computing HMAC-SHA256 over "<timestamp>.<body>" with the subscription secret.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateSubscription adds a webhook subscription, generating a secret if none is given
+func (s *WebhookService) CreateSubscription(subscription *models.WebhookSubscription) error {
+	if subscription.ProjectID == 0 {
+		return errors.New("project ID is required")
+	}
+
+	parsed, err := url.Parse(subscription.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("invalid webhook URL")
+	}
+	// Names are checked once resolved, on every delivery
+	if ip := net.ParseIP(parsed.Hostname()); !s.allowPrivate && ip != nil && isInternalAddress(ip) {
+		return fmt.Errorf("invalid webhook URL: %w", ErrWebhookAddressNotAllowed)
+	}
+
+	for _, eventType := range strings.Split(subscription.EventTypes, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			if _, ok := sampleWebhookPayloads[eventType]; !ok {
+				return fmt.Errorf("unknown event type: %s", eventType)
+			}
+		}
+	}
+
+	if subscription.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			s.logger.Error("Failed to generate webhook secret", zap.Error(err))
+			return errors.New("failed to create webhook subscription")
+		}
+		subscription.Secret = secret
+	}
+
+	subscription.Active = true
+	if err := s.webhookRepo.Create(subscription); err != nil {
+		s.logger.Error("Failed to create webhook subscription", zap.Uint("project_id", subscription.ProjectID), zap.Error(err))
+		return errors.New("failed to create webhook subscription")
+	}
+
+	return nil
+}
+
+// ListSubscriptions lists the webhook subscriptions of a project
+func (s *WebhookService) ListSubscriptions(projectID uint) ([]models.WebhookSubscription, error) {
+	subscriptions, err := s.webhookRepo.ListByProject(projectID)
+	if err != nil {
+		s.logger.Error("Failed to list webhook subscriptions", zap.Uint("project_id", projectID), zap.Error(err))
+		return nil, errors.New("failed to retrieve webhook subscriptions")
+	}
+
+	return subscriptions, nil
+}
+
+// DeleteSubscription removes a webhook subscription of a project
+func (s *WebhookService) DeleteSubscription(projectID, id uint) error {
+	if err := s.webhookRepo.Delete(projectID, id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errors.New("webhook subscription not found")
+		}
+		s.logger.Error("Failed to delete webhook subscription", zap.Uint("id", id), zap.Error(err))
+		return errors.New("failed to delete webhook subscription")
+	}
+
+	return nil
+}
+
+// SendTestEvent delivers a sample event of the given type to a subscription.
+// The event is marked as a test and is not stored anywhere.
+func (s *WebhookService) SendTestEvent(projectID, subscriptionID uint, eventType string) (*WebhookDeliveryResult, error) {
+	payload, ok := sampleWebhookPayloads[eventType]
+	if !ok {
+		return nil, fmt.Errorf("unknown event type: %s", eventType)
+	}
+
+	subscription, err := s.webhookRepo.GetByID(projectID, subscriptionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, errors.New("webhook subscription not found")
+		}
+		s.logger.Error("Failed to get webhook subscription", zap.Uint("id", subscriptionID), zap.Error(err))
+		return nil, errors.New("database error")
+	}
+
+	deliveryID, err := generateDeliveryID()
+	if err != nil {
+		return nil, errors.New("failed to create test event")
+	}
+
+	event := &WebhookEvent{
+		ID:        deliveryID,
+		Type:      eventType,
+		ProjectID: projectID,
+		Timestamp: time.Now().UTC(),
+		Test:      true,
+		Payload:   payload,
+	}
+
+	return s.Deliver(subscription, event)
+}
+
+// Deliver signs and posts an event to a subscription, returning the receiver's status code;
+// the response body is discarded. Delivery failures are reported in the result rather than
+// as an error.
+func (s *WebhookService) Deliver(subscription *models.WebhookSubscription, event *WebhookEvent) (*WebhookDeliveryResult, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookHeaderEvent, event.Type)
+	req.Header.Set(WebhookHeaderDelivery, event.ID)
+	req.Header.Set(WebhookHeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookHeaderSignature, SignWebhookPayload(subscription.Secret, timestamp, body))
+	if event.Test {
+		req.Header.Set(WebhookHeaderTest, "true")
+	}
+
+	result := &WebhookDeliveryResult{
+		DeliveryID: event.ID,
+		EventType:  event.Type,
+	}
+
+	start := time.Now()
+	resp, err := s.httpClient.Do(req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		s.logger.Warn("Webhook delivery failed",
+			zap.Uint("subscription_id", subscription.ID),
+			zap.String("event_type", event.Type),
+			zap.Error(err))
+		result.Error = err.Error()
+		return result, nil
+	}
+	defer resp.Body.Close()
+
+	// Drained so the connection can be reused; the body is never reported back
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, webhookMaxResponseBody))
+	result.StatusCode = resp.StatusCode
+
+	return result, nil
+}
+
+// sampleWebhookPayloads holds representative payloads for test deliveries
+var sampleWebhookPayloads = map[string]interface{}{
+	models.WebhookEventTwinCreated: map[string]interface{}{
+		"twin_id":  1,
+		"name":     "Sample Pump",
+		"ditto_id": "org.digitalegiz.project1:sample-pump",
+		"type_id":  1,
+	},
+	models.WebhookEventTwinUpdated: map[string]interface{}{
+		"twin_id":  1,
+		"ditto_id": "org.digitalegiz.project1:sample-pump",
+		"changes":  map[string]interface{}{"description": "Updated description"},
+	},
+	models.WebhookEventTwinDeleted: map[string]interface{}{
+		"twin_id":  1,
+		"ditto_id": "org.digitalegiz.project1:sample-pump",
+	},
+	models.WebhookEventFeatureUpdated: map[string]interface{}{
+		"ditto_id":     "org.digitalegiz.project1:sample-pump",
+		"feature_path": "temperature",
+		"value":        21.5,
+	},
+	models.WebhookEventAlertCreated: map[string]interface{}{
+		"alert_id":     "sample-alert",
+		"ditto_id":     "org.digitalegiz.project1:sample-pump",
+		"feature_path": "temperature",
+		"severity":     "warning",
+		"message":      "Temperature above threshold",
+	},
+	models.WebhookEventAlertAcknowledged: map[string]interface{}{
+		"alert_id":     "sample-alert",
+		"ditto_id":     "org.digitalegiz.project1:sample-pump",
+		"feature_path": "temperature",
+		"severity":     "warning",
+		"state":        "acknowledged",
+		"actor":        "Jane Doe",
+		"note":         "Cooling restored",
+		"time":         "2024-01-01T12:00:00Z",
+	},
+	models.WebhookEventDLQAlert: map[string]interface{}{
+		"topic":          "timeseries-data",
+		"dlq_topic":      "timeseries-data.dlq",
+		"status":         "firing",
+		"count":          12,
+		"threshold":      10,
+		"window_seconds": 300,
+		"sample_error":   "failed to unmarshal timeseries data",
+	},
+}
+
+// generateWebhookSecret returns a random secret for signing deliveries
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// generateDeliveryID returns a random identifier for a delivery
+func generateDeliveryID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/utils"
+	"go.uber.org/zap"
+)
+
+// writebackTimeout bounds each write of a prediction to Ditto
+const writebackTimeout = 10 * time.Second
+
+// MLOutputPath is the Ditto feature property an ML task binding writes its predictions to,
+// parsed from the binding's output_path_json, e.g. {"feature":"health","property":"anomaly"}
+type MLOutputPath struct {
+	Feature  string `json:"feature"`
+	Property string `json:"property"`
+}
+
+// WritebackValue is the value written to the Ditto property of a prediction
+type WritebackValue struct {
+	Type         string          `json:"type"`
+	Score        float64         `json:"score"`
+	Label        string          `json:"label,omitempty"`
+	Details      json.RawMessage `json:"details,omitempty"`
+	ModelVersion string          `json:"model_version,omitempty"`
+	Time         time.Time       `json:"time"`
+}
+
+// writebackTarget tracks the writes to one Ditto property
+type writebackTarget struct {
+	thingID  string
+	feature  string
+	property string
+
+	// writtenTime is the time of the last prediction Ditto accepted
+	writtenTime time.Time
+	lastWrite   time.Time
+
+	// pending is the latest prediction waiting for the rate limit
+	pending  *WritebackValue
+	timer    *time.Timer
+	inFlight bool
+}
+
+// WritebackService writes ML predictions back to the Ditto feature properties configured
+// on the twin's ML task bindings. Writes of the same property are rate limited to one per
+// interval, keeping the latest prediction; predictions not newer than the last written one,
+// such as redelivered Kafka messages, are skipped.
+// Predictions are stored locally before they are written back, so Ditto failures are only logged.
+// While Ditto's circuit breaker is open, writes are deferred and retried instead.
+type WritebackService struct {
+	logger       *utils.Logger
+	dittoManager *ditto.Manager
+	twinRepo     repository.TwinRepository
+	mlRepo       repository.MLRepository
+	interval     time.Duration
+
+	mu      sync.Mutex
+	targets map[string]*writebackTarget
+	closed  bool
+	paused  bool
+	writes  sync.WaitGroup
+	runs    lifecycle.WorkerRuns
+}
+
+// NewWritebackService creates a new ML prediction write-back service
+func NewWritebackService(db *db.Database, cfg *config.DittoConfig, dittoManager *ditto.Manager, logger *utils.Logger) *WritebackService {
+	repoFactory := repository.NewRepositoryFactory(db.DB)
+
+	return &WritebackService{
+		logger:       logger.Named("writeback_service"),
+		dittoManager: dittoManager,
+		twinRepo:     repoFactory.Twin(),
+		mlRepo:       repoFactory.ML(),
+		interval:     time.Duration(cfg.WritebackInterval) * time.Second,
+		targets:      make(map[string]*writebackTarget),
+	}
+}
+
+// Submit schedules writing a stored prediction to the Ditto properties of the twin's
+// active bindings of the prediction's task. It does not wait for Ditto.
+func (s *WritebackService) Submit(prediction *models.MLPredictionData) {
+	twin, err := s.twinRepo.GetByDittoID(prediction.TwinID)
+	if err != nil {
+		s.logger.Debug("Skipping write-back for unknown twin", zap.String("thing_id", prediction.TwinID))
+		return
+	}
+
+	bindings, err := s.mlRepo.ListMLTaskBindingsByTwinID(twin.ID)
+	if err != nil {
+		s.logger.Error("Failed to list ML task bindings", zap.Uint("twin_id", twin.ID), zap.Error(err))
+		return
+	}
+
+	value := &WritebackValue{
+		Type:         prediction.PredictionType,
+		Score:        prediction.ScoreNum,
+		Label:        prediction.LabelStr,
+		ModelVersion: prediction.ModelVersion,
+		Time:         prediction.Time,
+	}
+	if json.Valid([]byte(prediction.DetailsJSON)) {
+		value.Details = json.RawMessage(prediction.DetailsJSON)
+	}
+
+	for _, binding := range bindings {
+		if !binding.Active || !bindingMatchesTask(&binding, prediction.TaskID) {
+			continue
+		}
+
+		path, ok := parseMLOutputPath(&binding)
+		if !ok {
+			continue
+		}
+
+		s.schedule(prediction.TwinID, path, value)
+	}
+}
+
+// Name returns the component name of the service
+func (s *WritebackService) Name() string {
+	return "ml-writeback"
+}
+
+// Start has nothing to start; predictions are written as they are submitted
+func (s *WritebackService) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops accepting predictions and writes the ones held back by the rate limit,
+// waiting for in-flight writes first
+func (s *WritebackService) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for _, target := range s.targets {
+		if target.timer != nil {
+			target.timer.Stop()
+			target.timer = nil
+		}
+	}
+	s.mu.Unlock()
+
+	inFlight := make(chan struct{})
+	go func() {
+		s.writes.Wait()
+		close(inFlight)
+	}()
+	select {
+	case <-inFlight:
+	case <-ctx.Done():
+		return fmt.Errorf("in-flight writes not finished: %w", ctx.Err())
+	}
+
+	s.mu.Lock()
+	var targets []*writebackTarget
+	var values []*WritebackValue
+	for _, target := range s.targets {
+		if target.pending != nil {
+			targets = append(targets, target)
+			values = append(values, s.take(target))
+		}
+	}
+	s.mu.Unlock()
+
+	failed := 0
+	for i, target := range targets {
+		if err := s.write(ctx, target, values[i]); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to write %d pending predictions back to Ditto", failed)
+	}
+	return nil
+}
+
+// Trigger writes the pending predictions now without waiting for the rate limit, even while
+// the service is paused. Properties with a write in flight are written once it finishes.
+func (s *WritebackService) Trigger() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return lifecycle.ErrWorkerNotRunning
+	}
+
+	for _, target := range s.targets {
+		if target.pending == nil || target.inFlight {
+			continue
+		}
+		if target.timer != nil {
+			target.timer.Stop()
+			target.timer = nil
+		}
+		value := s.take(target)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), writebackTimeout)
+			defer cancel()
+			_ = s.write(ctx, target, value)
+		}()
+	}
+	return nil
+}
+
+// Pause holds the predictions back until the service is resumed, keeping the latest one of
+// each property; a write in flight is not interrupted
+func (s *WritebackService) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume writes the predictions held back while paused, as the rate limit allows
+func (s *WritebackService) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+	if s.closed {
+		return
+	}
+	for _, target := range s.targets {
+		if target.pending != nil && target.timer == nil {
+			s.arm(target)
+		}
+	}
+}
+
+// Status returns the state of the service and its last write
+func (s *WritebackService) Status() lifecycle.WorkerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runs.Status(s.Name(), s.interval, !s.closed, s.paused)
+}
+
+// schedule writes a value to a property now, or once the property's rate limit allows
+func (s *WritebackService) schedule(thingID string, path MLOutputPath, value *WritebackValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	key := thingID + "/" + path.Feature + "/" + path.Property
+	target, ok := s.targets[key]
+	if !ok {
+		target = &writebackTarget{thingID: thingID, feature: path.Feature, property: path.Property}
+		s.targets[key] = target
+	}
+
+	// Predictions may be redelivered or arrive out of order; only newer ones are written
+	if !value.Time.After(target.writtenTime) || (target.pending != nil && !value.Time.After(target.pending.Time)) {
+		return
+	}
+	target.pending = value
+
+	if target.timer != nil {
+		return
+	}
+
+	s.arm(target)
+}
+
+// arm writes a target's pending value once the property's rate limit allows; the caller
+// must hold the lock
+func (s *WritebackService) arm(target *writebackTarget) {
+	wait := time.Until(target.lastWrite.Add(s.interval))
+	if target.inFlight && wait < s.interval {
+		wait = s.interval
+	}
+	if wait <= 0 {
+		go s.flush(target)
+		return
+	}
+	target.timer = time.AfterFunc(wait, func() { s.flush(target) })
+}
+
+// flush writes a target's pending value to Ditto; while paused the value is kept pending
+func (s *WritebackService) flush(target *writebackTarget) {
+	s.mu.Lock()
+	target.timer = nil
+	if target.pending == nil || s.closed || s.paused {
+		s.mu.Unlock()
+		return
+	}
+	if target.inFlight {
+		target.timer = time.AfterFunc(s.interval, func() { s.flush(target) })
+		s.mu.Unlock()
+		return
+	}
+	value := s.take(target)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), writebackTimeout)
+	defer cancel()
+	_ = s.write(ctx, target, value)
+}
+
+// take marks a target's pending value as being written; the caller must hold the lock
+func (s *WritebackService) take(target *writebackTarget) *WritebackValue {
+	value := target.pending
+	target.pending = nil
+	target.inFlight = true
+	target.lastWrite = time.Now()
+	s.writes.Add(1)
+	return value
+}
+
+// write writes a value taken from a target to Ditto
+func (s *WritebackService) write(ctx context.Context, target *writebackTarget, value *WritebackValue) error {
+	defer s.writes.Done()
+
+	// The prediction is already stored locally, so the event Ditto echoes back is skipped
+	finish := s.runs.Begin()
+	err := s.dittoManager.UpdateFeatureProperty(ditto.SuppressEcho(ctx), target.thingID, target.feature, target.property, value)
+	finish(err)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	target.inFlight = false
+	if errors.Is(err, ditto.ErrDittoUnavailable) && !s.closed {
+		// Ditto is down; keep the prediction unless a newer one arrived and retry later
+		if target.pending == nil {
+			target.pending = value
+		}
+		if target.timer == nil {
+			target.timer = time.AfterFunc(s.retryInterval(), func() { s.flush(target) })
+		}
+		s.logger.Debug("Ditto unavailable, deferring prediction write-back",
+			zap.String("thing_id", target.thingID),
+			zap.String("feature", target.feature),
+			zap.String("property", target.property))
+		return err
+	}
+	if err != nil {
+		s.logger.Error("Failed to write prediction back to Ditto",
+			zap.String("thing_id", target.thingID),
+			zap.String("feature", target.feature),
+			zap.String("property", target.property),
+			zap.Error(err))
+		return err
+	}
+
+	if value.Time.After(target.writtenTime) {
+		target.writtenTime = value.Time
+	}
+	return nil
+}
+
+// retryInterval is how long a write deferred because Ditto is unavailable waits before retrying
+func (s *WritebackService) retryInterval() time.Duration {
+	if s.interval < time.Second {
+		return time.Second
+	}
+	return s.interval
+}
+
+// bindingMatchesTask reports whether a binding's task produced predictions with the given task ID,
+// which ML services report as the task's model ID or its numeric ID
+func bindingMatchesTask(binding *models.MLTaskBinding, taskID string) bool {
+	if binding.Task.ModelID != "" && binding.Task.ModelID == taskID {
+		return true
+	}
+	return strconv.FormatUint(uint64(binding.TaskID), 10) == taskID
+}
+
+// parseMLOutputPath parses the Ditto property a binding writes to; the property defaults to
+// the task's model ID. Bindings without an output feature are not written back.
+func parseMLOutputPath(binding *models.MLTaskBinding) (MLOutputPath, bool) {
+	var path MLOutputPath
+	if strings.TrimSpace(binding.OutputPathJSON) == "" || json.Unmarshal([]byte(binding.OutputPathJSON), &path) != nil {
+		return path, false
+	}
+
+	path.Feature = strings.Trim(path.Feature, "/ ")
+	path.Property = strings.Trim(path.Property, "/ ")
+	if path.Property == "" {
+		path.Property = binding.Task.ModelID
+	}
+	return path, path.Feature != "" && path.Property != ""
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ParseFields splits a comma-separated "fields" query parameter into field names.
+// It returns nil when no fields are requested.
+func ParseFields(raw string) []string {
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// ProjectFields shapes a response value so that only the requested JSON fields remain.
+// Nested fields are addressed with dots (e.g. "type.name"). Objects are projected directly
+// and arrays element by element. Without fields the value is returned unchanged.
+func ProjectFields(value interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return value, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	tree := buildFieldTree(fields)
+	switch v := decoded.(type) {
+	case []interface{}:
+		for i, item := range v {
+			v[i] = projectValue(item, tree)
+		}
+		return v, nil
+	default:
+		return projectValue(v, tree), nil
+	}
+}
+
+// fieldTree holds requested fields by path segment; an empty subtree selects the whole value
+type fieldTree map[string]fieldTree
+
+// buildFieldTree converts dotted field names into a tree of path segments
+func buildFieldTree(fields []string) fieldTree {
+	tree := fieldTree{}
+	for _, field := range fields {
+		node := tree
+		for _, segment := range strings.Split(field, ".") {
+			child, ok := node[segment]
+			if !ok {
+				child = fieldTree{}
+				node[segment] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+// projectValue keeps only the selected keys of an object, recursing into nested selections
+func projectValue(value interface{}, tree fieldTree) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		projected := make(map[string]interface{}, len(tree))
+		for key, subtree := range tree {
+			child, ok := v[key]
+			if !ok {
+				continue
+			}
+			if len(subtree) == 0 {
+				projected[key] = child
+			} else {
+				projected[key] = projectValue(child, subtree)
+			}
+		}
+		return projected
+	case []interface{}:
+		for i, item := range v {
+			v[i] = projectValue(item, tree)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -69,6 +72,147 @@ func (v *JSONSchemaValidator) ValidateAgainstSchema(name string, data interface{
 	return nil
 }
 
+// defaultSchemaDraft is the metaschema schemas without a known $schema are checked against
+const defaultSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// schemaDrafts lists the metaschemas schemas can declare in $schema
+var schemaDrafts = map[string]string{
+	"http://json-schema.org/draft-04/schema": "http://json-schema.org/draft-04/schema#",
+	"http://json-schema.org/draft-06/schema": "http://json-schema.org/draft-06/schema#",
+	"http://json-schema.org/draft-07/schema": "http://json-schema.org/draft-07/schema#",
+}
+
+// SchemaError is a problem found in a JSON schema or in an instance checked against it
+type SchemaError struct {
+	// Location is the JSON pointer of the offending value, empty for the document itself
+	Location string `json:"location"`
+	// Line and Column locate a syntax error in malformed JSON, 1-based
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// SchemaCheck is the outcome of checking a JSON schema and, optionally, a sample instance
+type SchemaCheck struct {
+	Valid bool `json:"valid"`
+	// Errors are the problems of the schema itself
+	Errors []SchemaError `json:"errors"`
+	// InstanceErrors are the ways the sample instance does not match the schema
+	InstanceErrors []SchemaError `json:"instance_errors,omitempty"`
+}
+
+// CheckJSONSchema checks that a schema is well-formed JSON and a valid JSON Schema of the
+// draft it declares (draft-07 by default), then validates the instance against it if given
+func CheckJSONSchema(schema []byte, instance []byte) SchemaCheck {
+	check := SchemaCheck{Errors: []SchemaError{}}
+
+	document, syntaxErr := decodeJSON(schema)
+	if syntaxErr != nil {
+		check.Errors = append(check.Errors, *syntaxErr)
+		return check
+	}
+
+	draft := defaultSchemaDraft
+	if object, ok := document.(map[string]interface{}); ok {
+		if declared, ok := object["$schema"].(string); ok {
+			if known, ok := schemaDrafts[strings.TrimSuffix(declared, "#")]; ok {
+				draft = known
+			}
+		}
+	}
+
+	metaSchema, err := gojsonschema.NewSchema(gojsonschema.NewReferenceLoader(draft))
+	if err != nil {
+		check.Errors = append(check.Errors, SchemaError{Message: fmt.Sprintf("failed to load metaschema %s: %v", draft, err)})
+		return check
+	}
+	result, err := metaSchema.Validate(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		check.Errors = append(check.Errors, SchemaError{Message: err.Error()})
+		return check
+	}
+	check.Errors = append(check.Errors, schemaResultErrors(result)...)
+	if len(check.Errors) > 0 {
+		return check
+	}
+
+	// Some problems, like unresolvable references, only show when the schema is compiled
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+	if err != nil {
+		check.Errors = append(check.Errors, SchemaError{Message: err.Error()})
+		return check
+	}
+
+	if len(instance) > 0 {
+		if _, syntaxErr := decodeJSON(instance); syntaxErr != nil {
+			check.InstanceErrors = append(check.InstanceErrors, *syntaxErr)
+			return check
+		}
+		result, err := compiled.Validate(gojsonschema.NewBytesLoader(instance))
+		if err != nil {
+			check.InstanceErrors = append(check.InstanceErrors, SchemaError{Message: err.Error()})
+			return check
+		}
+		check.InstanceErrors = schemaResultErrors(result)
+		if len(check.InstanceErrors) > 0 {
+			return check
+		}
+	}
+
+	check.Valid = true
+	return check
+}
+
+// CompiledSchema is a JSON schema compiled to validate instances
+type CompiledSchema struct {
+	schema *gojsonschema.Schema
+}
+
+// CompileSchema compiles a JSON schema given as a decoded document
+func CompileSchema(document interface{}) (*CompiledSchema, error) {
+	compiled, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledSchema{schema: compiled}, nil
+}
+
+// Validate returns the ways an instance does not match the schema, located by JSON pointer
+func (s *CompiledSchema) Validate(instance []byte) ([]SchemaError, error) {
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(instance))
+	if err != nil {
+		return nil, err
+	}
+	return schemaResultErrors(result), nil
+}
+
+// decodeJSON decodes JSON, reporting where it breaks if it is malformed
+func decodeJSON(data []byte) (interface{}, *SchemaError) {
+	var value interface{}
+	err := json.Unmarshal(data, &value)
+	if err == nil {
+		return value, nil
+	}
+
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return nil, &SchemaError{Message: "malformed JSON: " + err.Error()}
+	}
+	line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+	column := int(syntaxErr.Offset) - bytes.LastIndexByte(data[:syntaxErr.Offset], '\n') - 1
+	return nil, &SchemaError{Line: line, Column: column, Message: "malformed JSON: " + syntaxErr.Error()}
+}
+
+// schemaResultErrors converts validation errors to schema errors located by JSON pointer
+func schemaResultErrors(result *gojsonschema.Result) []SchemaError {
+	errs := make([]SchemaError, 0, len(result.Errors()))
+	for _, resultErr := range result.Errors() {
+		location := strings.TrimPrefix(resultErr.Context().String("/"), "(root)")
+		errs = append(errs, SchemaError{Location: location, Message: resultErr.Description()})
+	}
+	return errs
+}
+
 // JSONSchemaBuilder helps build JSON schemas programmatically
 type JSONSchemaBuilder struct {
 	schema map[string]interface{}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ugorji/go/codec"
+)
+
+// Response formats a client can negotiate with the Accept header
+const (
+	FormatJSON    = "json"
+	FormatMsgPack = "msgpack"
+)
+
+// responseFormatKey is the context key holding the negotiated response format
+const responseFormatKey = "response_format"
+
+// formatMediaTypes maps the media types clients send to the response formats
+var formatMediaTypes = map[string]string{
+	"application/json":      FormatJSON,
+	"application/*":         FormatJSON,
+	"*/*":                   FormatJSON,
+	"application/msgpack":   FormatMsgPack,
+	"application/x-msgpack": FormatMsgPack,
+}
+
+// msgpackHandle encodes responses with the field names of their JSON tags
+// and times as MessagePack timestamps, so both formats carry the same fields.
+var msgpackHandle = newMsgpackHandle()
+
+func newMsgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	handle.TypeInfos = codec.NewTypeInfos([]string{"json"})
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return handle
+}
+
+// NegotiateFormat returns the allowed response format the Accept header prefers,
+// falling back to JSON when the header is empty or names no allowed format
+func NegotiateFormat(accept string, allowed []string) string {
+	best, bestQuality := FormatJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		format, ok := formatMediaTypes[mediaType]
+		if !ok || !containsFormat(allowed, format) {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// SetResponseFormat records the response format Render uses for the request
+func SetResponseFormat(c *gin.Context, format string) {
+	c.Set(responseFormatKey, format)
+}
+
+// Render writes a response in the format negotiated for the request, JSON by default
+func Render(c *gin.Context, status int, obj interface{}) {
+	if c.GetString(responseFormatKey) == FormatMsgPack {
+		c.Render(status, msgpackRender{data: obj})
+		return
+	}
+	c.JSON(status, obj)
+}
+
+// msgpackRender renders a value as MessagePack with msgpackHandle
+type msgpackRender struct {
+	data interface{}
+}
+
+// Render encodes the value to the response
+func (r msgpackRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return codec.NewEncoder(w, msgpackHandle).Encode(r.data)
+}
+
+// WriteContentType writes the MessagePack content type
+func (r msgpackRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/msgpack")
+}
+
+func containsFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
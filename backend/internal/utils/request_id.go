@@ -0,0 +1,21 @@
+package utils
+
+import "context"
+
+// requestIDKey holds the ID of the HTTP request a context belongs to
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request it serves, so work done
+// for the request can be correlated with it in logs
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID the context was given by WithRequestID, if any
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -11,26 +12,29 @@ import (
 // ValidationError represents a structured validation error
 type ValidationError struct {
 	Field   string `json:"field"`
+	Rule    string `json:"rule"`
 	Message string `json:"message"`
 }
 
 // ValidationErrorResponse is the standard response for validation errors
 type ValidationErrorResponse struct {
+	Error  string            `json:"error"`
 	Errors []ValidationError `json:"errors"`
 }
 
-// HandleValidationErrors processes validation errors and returns a standardized response
+// HandleValidationErrors processes request binding errors and returns a standardized response.
+// Validator errors produce a 422 with field-level details; anything else (e.g. malformed JSON) is a 400.
 func HandleValidationErrors(ctx *gin.Context, err error) {
 	// Check if the error is a validator error
-	validationErrors, ok := err.(validator.ValidationErrors)
-	if !ok {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
 		// If not a validation error, return a generic error
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
 	// Create a slice to hold the validation errors
-	var errors []ValidationError
+	fieldErrors := make([]ValidationError, 0, len(validationErrors))
 
 	// Process each validation error
 	for _, fieldError := range validationErrors {
@@ -41,15 +45,17 @@ func HandleValidationErrors(ctx *gin.Context, err error) {
 		fieldName := toSnakeCase(fieldError.Field())
 
 		// Add the error to the slice
-		errors = append(errors, ValidationError{
+		fieldErrors = append(fieldErrors, ValidationError{
 			Field:   fieldName,
+			Rule:    fieldError.Tag(),
 			Message: message,
 		})
 	}
 
 	// Return the validation errors
-	ctx.JSON(http.StatusBadRequest, ValidationErrorResponse{
-		Errors: errors,
+	ctx.JSON(http.StatusUnprocessableEntity, ValidationErrorResponse{
+		Error:  "Validation failed",
+		Errors: fieldErrors,
 	})
 }
 
@@ -104,19 +110,29 @@ func getValidationErrorMessage(fieldError validator.FieldError) string {
 	}
 }
 
-// toSnakeCase converts a string from camelCase to snake_case
+// toSnakeCase converts a string from camelCase to snake_case, keeping acronyms
+// together (DittoID becomes ditto_id and TwinIDs twin_ids)
 func toSnakeCase(s string) string {
 	// If the string is already snake_case, return it as is
 	if strings.Contains(s, "_") {
 		return s
 	}
 
+	isUpper := func(b byte) bool { return 'A' <= b && b <= 'Z' }
+	isLower := func(b byte) bool { return 'a' <= b && b <= 'z' || '0' <= b && b <= '9' }
+
 	var result strings.Builder
-	for i, r := range s {
-		if i > 0 && 'A' <= r && r <= 'Z' {
-			result.WriteRune('_')
+	for i := 0; i < len(s); i++ {
+		if i > 0 && isUpper(s[i]) {
+			// A word starts after a lowercase letter, or at the last capital of an acronym
+			// followed by a word other than a plural s
+			prevLower := isLower(s[i-1])
+			endsAcronym := isUpper(s[i-1]) && i+1 < len(s) && isLower(s[i+1]) && s[i+1:] != "s"
+			if prevLower || endsAcronym {
+				result.WriteByte('_')
+			}
 		}
-		result.WriteRune(r)
+		result.WriteByte(s[i])
 	}
 	return strings.ToLower(result.String())
 }
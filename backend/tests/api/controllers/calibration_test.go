@@ -0,0 +1,158 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryCalibration(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Calibration Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	// Points every 30 minutes over three hours, all reading 10: the first hour precedes any
+	// calibration, the second doubles values and the third subtracts 1
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-3 * time.Hour)
+	for point := start; point.Before(end); point = point.Add(30 * time.Minute) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: point, TwinID: twin.DittoID, FeaturePath: "pressure", ValueType: "number", ValueNum: 10, Source: services.SourceHTTP,
+		}))
+	}
+	for bucket := start; bucket.Before(end); bucket = bucket.Add(time.Hour) {
+		require.NoError(t, repoFactory.Timeseries().InsertAggregatedData(&models.AggregatedData{
+			TimeInterval: bucket, TwinID: twin.DittoID, FeaturePath: "pressure", IntervalType: "hour",
+			Min: 10, Max: 10, Avg: 10, Sum: 20, Count: 2, FirstTime: bucket, LastTime: bucket.Add(30 * time.Minute),
+		}))
+	}
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins"))
+
+	get := func(path string, params url.Values) (int, map[string]interface{}) {
+		params.Set("feature_path", "pressure")
+		params.Set("start", start.Format(time.RFC3339))
+		params.Set("end", end.Format(time.RFC3339))
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/%s?%s", twin.ID, path, params.Encode()), nil, nil)
+		var body map[string]interface{}
+		ts.ParseResponse(resp, &body)
+		return resp.Code, body
+	}
+	values := func(t *testing.T, body map[string]interface{}, field string) []float64 {
+		data, ok := body["data"].([]interface{})
+		require.True(t, ok, body)
+		result := make([]float64, len(data))
+		for i, row := range data {
+			result[i] = row.(map[string]interface{})[field].(float64)
+		}
+		return result
+	}
+
+	t.Run("Should store calibration periods ordered by effective time", func(t *testing.T) {
+		resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twins/%d/feature-bindings", twin.ID), map[string]interface{}{
+			"feature_path": "pressure",
+			"calibrations": []map[string]interface{}{
+				{"effective_from": start.Add(2 * time.Hour), "offset": -1},
+				{"effective_from": start.Add(time.Hour), "multiplier": 2},
+			},
+		}, nil)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		binding, err := repoFactory.Twin().GetFeatureBinding(twin.ID, "pressure")
+		require.NoError(t, err)
+		assert.Equal(t, models.CalibrationQuery, binding.CalibrationMode)
+		require.Len(t, binding.Calibrations, 2)
+		assert.True(t, binding.Calibrations[0].EffectiveFrom.Equal(start.Add(time.Hour)))
+		assert.Equal(t, float64(2), binding.Calibrations[0].Multiplier)
+		assert.Equal(t, float64(1), binding.Calibrations[1].Multiplier)
+	})
+
+	t.Run("Should correct raw points with the calibration in effect at their time", func(t *testing.T) {
+		code, body := get("timeseries", url.Values{"order": {"asc"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{10, 10, 20, 20, 9, 9}, values(t, body, "value_num"))
+
+		// Projected reads still need each point's time to pick its calibration
+		code, body = get("timeseries", url.Values{"order": {"asc"}, "fields": {"value_num"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{10, 10, 20, 20, 9, 9}, values(t, body, "value_num"))
+
+		// Cached windows hold stored values and are corrected on every read
+		code, body = get("timeseries", url.Values{"order": {"asc"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{10, 10, 20, 20, 9, 9}, values(t, body, "value_num"))
+	})
+
+	t.Run("Should correct the latest point and aggregated buckets", func(t *testing.T) {
+		code, body := get("timeseries/latest", url.Values{})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(9), body["data"].(map[string]interface{})["value_num"])
+
+		code, body = get("aggregated", url.Values{"interval": {"1h"}})
+		require.Equal(t, http.StatusOK, code)
+		// Aggregated reads are newest first
+		assert.Equal(t, []float64{9, 20, 10}, values(t, body, "avg"))
+		assert.Equal(t, []float64{18, 40, 20}, values(t, body, "sum"))
+	})
+
+	t.Run("Should reject invalid calibrations", func(t *testing.T) {
+		for name, calibrations := range map[string][]map[string]interface{}{
+			"zero multiplier":   {{"effective_from": start, "multiplier": 0}},
+			"missing effective": {{"offset": 1}},
+			"duplicate period":  {{"effective_from": start, "offset": 1}, {"effective_from": start, "offset": 2}},
+		} {
+			resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twins/%d/feature-bindings", twin.ID), map[string]interface{}{
+				"feature_path": "flow",
+				"calibrations": calibrations,
+			}, nil)
+			assert.NotEqual(t, http.StatusOK, resp.Code, name)
+		}
+
+		err := twinService.SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "flow", ExpectedType: "string",
+			Calibrations: models.Calibrations{{EffectiveFrom: start, Multiplier: 1}},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Should correct values before storing with ingest calibration", func(t *testing.T) {
+		binding := &models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "flow", CalibrationMode: models.CalibrationIngest,
+			Calibrations: models.Calibrations{{EffectiveFrom: start, Offset: 0.5, Multiplier: 2}},
+		}
+		require.NoError(t, twinService.SaveFeatureBinding(binding))
+
+		point := models.TimeseriesData{Time: start.Add(time.Minute), ValueType: "number", ValueNum: 3}
+		services.ApplyCalibration(&point, binding)
+		assert.Equal(t, 6.5, point.ValueNum)
+		assert.Equal(t, "3", point.ValueJSON)
+
+		early := models.TimeseriesData{Time: start.Add(-time.Minute), ValueType: "number", ValueNum: 3}
+		services.ApplyCalibration(&early, binding)
+		assert.Equal(t, float64(3), early.ValueNum)
+		assert.Empty(t, early.ValueJSON)
+	})
+}
@@ -0,0 +1,88 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+func TestHistoryContentNegotiation(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Charts"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time:        time.Now().Add(-time.Duration(i) * time.Second),
+			TwinID:      twin.DittoID,
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    20 + float64(i)/8,
+			Source:      "ditto",
+		}))
+	}
+
+	ts.Router.Use(middleware.ResponseFormatMiddleware(&config.ServerConfig{MsgPackEnabled: true}))
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	path := fmt.Sprintf("/api/v1/twins/%d/history/timeseries?feature_path=temperature&fields=value_num,value_type,source", twin.ID)
+
+	type history struct {
+		Data []map[string]interface{} `json:"data"`
+		Meta map[string]interface{}   `json:"meta"`
+	}
+
+	t.Run("Should return the same data as JSON and MessagePack", func(t *testing.T) {
+		jsonResp := ts.ExecuteRequest("GET", path, nil, map[string]string{"Accept": "application/json"})
+		require.Equal(t, http.StatusOK, jsonResp.Code)
+		assert.Contains(t, jsonResp.Header().Get("Content-Type"), "application/json")
+
+		msgpackResp := ts.ExecuteRequest("GET", path, nil, map[string]string{"Accept": "application/msgpack"})
+		require.Equal(t, http.StatusOK, msgpackResp.Code)
+		assert.Equal(t, "application/msgpack", msgpackResp.Header().Get("Content-Type"))
+		assert.Less(t, msgpackResp.Body.Len(), jsonResp.Body.Len())
+
+		var fromJSON, fromMsgPack history
+		require.NoError(t, json.Unmarshal(jsonResp.Body.Bytes(), &fromJSON))
+
+		handle := &codec.MsgpackHandle{}
+		handle.RawToString = true
+		require.NoError(t, codec.NewDecoderBytes(msgpackResp.Body.Bytes(), handle).Decode(&fromMsgPack))
+
+		require.Len(t, fromMsgPack.Data, 50)
+		for i := range fromJSON.Data {
+			assert.Equal(t, fromJSON.Data[i]["value_num"], fromMsgPack.Data[i]["value_num"])
+			assert.Equal(t, fromJSON.Data[i]["value_type"], fromMsgPack.Data[i]["value_type"])
+			assert.Equal(t, fromJSON.Data[i]["source"], fromMsgPack.Data[i]["source"])
+		}
+		assert.EqualValues(t, fromJSON.Meta["count"], fromMsgPack.Meta["count"])
+		assert.Equal(t, fromJSON.Meta["feature_path"], fromMsgPack.Meta["feature_path"])
+	})
+
+	t.Run("Should answer errors as JSON", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/twins/abc/history/timeseries?feature_path=temperature", nil, map[string]string{"Accept": "application/msgpack"})
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+		assert.Contains(t, resp.Header().Get("Content-Type"), "application/json")
+	})
+}
@@ -0,0 +1,122 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboards(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.DashboardLayout{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	viewerID := ts.SeedTestUser("viewer@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	require.NoError(t, repoFactory.Project().AddMember(project.ID, viewerID, models.ProjectRoleViewer))
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewDashboardController(
+		services.NewDashboardService(ts.DB, ts.Logger),
+		services.NewProjectService(ts.DB, ts.Logger),
+		ts.Logger,
+	).RegisterRoutes(group)
+
+	request := func(method string, userID uint, path string, body interface{}) int {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest(method, fmt.Sprintf("/api/v1/projects/%d/dashboards%s", project.ID, path), body, map[string]string{"Authorization": "Bearer " + token})
+		return resp.Code
+	}
+	load := func(userID uint, name string) (int, models.DashboardLayout) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/projects/%d/dashboards/%s", project.ID, name), nil, map[string]string{"Authorization": "Bearer " + token})
+		var layout models.DashboardLayout
+		ts.ParseResponse(resp, &layout)
+		return resp.Code, layout
+	}
+	overview := map[string]interface{}{"widgets": []interface{}{map[string]interface{}{"type": "chart", "x": 0, "y": 0}}}
+
+	t.Run("Should save and load shared dashboards", func(t *testing.T) {
+		code := request("PUT", ownerID, "/overview", map[string]interface{}{"layout": overview})
+		require.Equal(t, http.StatusOK, code)
+
+		code, layout := load(viewerID, "overview")
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, layout.Personal())
+		assert.JSONEq(t, `{"widgets":[{"type":"chart","x":0,"y":0}]}`, string(layout.Layout))
+
+		// Saving again replaces the layout
+		code = request("PUT", ownerID, "/overview", map[string]interface{}{"layout": []int{1, 2}})
+		require.Equal(t, http.StatusOK, code)
+		_, layout = load(viewerID, "overview")
+		assert.JSONEq(t, `[1,2]`, string(layout.Layout))
+	})
+
+	t.Run("Should keep personal dashboards per user", func(t *testing.T) {
+		code := request("PUT", viewerID, "/overview", map[string]interface{}{"layout": map[string]interface{}{"mine": true}, "personal": true})
+		require.Equal(t, http.StatusOK, code)
+		code = request("PUT", ownerID, "/alarms", map[string]interface{}{"layout": overview})
+		require.Equal(t, http.StatusOK, code)
+
+		// The personal dashboard takes precedence for its user only
+		_, layout := load(viewerID, "overview")
+		assert.Equal(t, viewerID, layout.UserID)
+		assert.JSONEq(t, `{"mine":true}`, string(layout.Layout))
+		_, layout = load(ownerID, "overview")
+		assert.JSONEq(t, `[1,2]`, string(layout.Layout))
+
+		token := ts.CreateTestAuthToken(viewerID, "viewer@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/projects/%d/dashboards", project.ID), nil, map[string]string{"Authorization": "Bearer " + token})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var listed []models.DashboardLayout
+		ts.ParseResponse(resp, &listed)
+		require.Len(t, listed, 3)
+		for _, dashboard := range listed {
+			assert.Empty(t, dashboard.Layout)
+		}
+
+		code = request("DELETE", viewerID, "/overview?personal=true", nil)
+		assert.Equal(t, http.StatusNoContent, code)
+		_, layout = load(viewerID, "overview")
+		assert.False(t, layout.Personal())
+
+		code, _ = load(viewerID, "missing")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Should restrict shared dashboards to editors and every dashboard to members", func(t *testing.T) {
+		code := request("PUT", viewerID, "/overview", map[string]interface{}{"layout": overview})
+		assert.Equal(t, http.StatusForbidden, code)
+		code = request("DELETE", viewerID, "/overview", nil)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, _ = load(outsiderID, "overview")
+		assert.Equal(t, http.StatusForbidden, code)
+		code = request("PUT", outsiderID, "/overview", map[string]interface{}{"layout": overview, "personal": true})
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Should reject oversized and invalid layouts", func(t *testing.T) {
+		huge := map[string]interface{}{"layout": map[string]string{"blob": strings.Repeat("x", services.MaxDashboardLayoutSize)}}
+		code := request("PUT", ownerID, "/huge", huge)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, code)
+
+		code = request("PUT", ownerID, "/broken", map[string]interface{}{})
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
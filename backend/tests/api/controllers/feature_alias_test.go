@@ -0,0 +1,131 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureAliases(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	userID := ts.SeedTestUser("aliases@example.com", "password123", false)
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(project))
+
+	schema := models.JSON(`{"type": "object", "properties": {"features": {"type": "object", "properties": {
+		"temperature": {"type": "object"},
+		"pump": {"type": "object", "properties": {"properties": {"type": "object", "properties": {"speed": {"type": "number"}}}}}
+	}}}}`)
+	twinTypeService := services.NewTwinTypeService(ts.DB, ts.Logger)
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: schema, CreatedBy: userID,
+		FeatureAliases: models.FeatureAliasList{{Alias: " speed ", FeaturePath: "pump/speed"}, {Alias: "temp", FeaturePath: "temperature"}}}
+	require.NoError(t, twinTypeService.Create(twinType))
+	assert.Equal(t, models.FeatureAliasList{{Alias: "speed", FeaturePath: "pump/speed"}, {Alias: "temp", FeaturePath: "temperature"}}, twinType.FeatureAliases)
+
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.plant:pump-1", TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for age := 4; age >= 0; age-- {
+		for _, feature := range []string{"pump/speed", "temperature"} {
+			require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+				Time:        now.Add(-time.Duration(age) * time.Minute),
+				TwinID:      twin.DittoID,
+				FeaturePath: feature,
+				ValueType:   "number",
+				ValueNum:    float64(len(feature)*10 + age),
+				Source:      services.SourceHTTP,
+			}))
+		}
+	}
+
+	historyService := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+	historyController := controllers.NewHistoryController(historyService, ts.Logger)
+	historyController.RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+	historyController.RegisterTwinRoutes(ts.Router.Group("/api/v1/twins"))
+
+	get := func(path string) (int, json.RawMessage) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d%s", twin.ID, path), nil, nil)
+		return resp.Code, resp.Body.Bytes()
+	}
+
+	t.Run("Should return the same history for an alias as for its full path", func(t *testing.T) {
+		for alias, path := range map[string]string{"speed": "pump/speed", "temp": "temperature"} {
+			window := "?start=" + now.Add(-time.Hour).Format(time.RFC3339) + "&end=" + now.Add(time.Minute).Format(time.RFC3339)
+			code, byPath := get("/history/timeseries" + window + "&feature_path=" + path)
+			require.Equal(t, http.StatusOK, code, string(byPath))
+			code, byAlias := get("/history/timeseries" + window + "&feature_path=" + alias)
+			require.Equal(t, http.StatusOK, code, string(byAlias))
+			assert.JSONEq(t, string(byPath), string(byAlias), alias)
+
+			var response struct {
+				Data []map[string]interface{} `json:"data"`
+				Meta struct {
+					FeaturePath string `json:"feature_path"`
+				} `json:"meta"`
+			}
+			require.NoError(t, json.Unmarshal(byAlias, &response))
+			assert.Equal(t, path, response.Meta.FeaturePath, "responses name the full path")
+			assert.Len(t, response.Data, 5)
+
+			code, latestByPath := get("/history/timeseries/latest?feature_path=" + path)
+			require.Equal(t, http.StatusOK, code, string(latestByPath))
+			code, latestByAlias := get("/history/timeseries/latest?feature_path=" + alias)
+			require.Equal(t, http.StatusOK, code, string(latestByAlias))
+			assert.JSONEq(t, string(latestByPath), string(latestByAlias), alias)
+		}
+	})
+
+	t.Run("Should treat names that are not aliases as feature paths", func(t *testing.T) {
+		code, body := get("/history/timeseries/latest?feature_path=pressure")
+		assert.Equal(t, http.StatusNotFound, code, string(body))
+	})
+
+	t.Run("Should list the aliases of the features in the state", func(t *testing.T) {
+		code, body := get("/state")
+		require.Equal(t, http.StatusOK, code, string(body))
+		var state services.TwinState
+		require.NoError(t, json.Unmarshal(body, &state))
+		assert.Len(t, state.Features, 2)
+		assert.Equal(t, map[string]string{"pump/speed": "speed", "temperature": "temp"}, state.Aliases)
+	})
+
+	t.Run("Should reject aliases that are ambiguous or name unknown features", func(t *testing.T) {
+		for name, aliases := range map[string]models.FeatureAliasList{
+			"duplicate alias":        {{Alias: "temp", FeaturePath: "temperature"}, {Alias: "temp", FeaturePath: "pump/speed"}},
+			"unknown path":           {{Alias: "hum", FeaturePath: "humidity"}},
+			"unknown property":       {{Alias: "torque", FeaturePath: "pump/torque"}},
+			"shadows a feature":      {{Alias: "temperature", FeaturePath: "pump/speed"}},
+			"path aliased twice":     {{Alias: "temp", FeaturePath: "temperature"}, {Alias: "t", FeaturePath: "temperature"}},
+			"alias with a slash":     {{Alias: "pump/rpm", FeaturePath: "pump/speed"}},
+			"empty alias":            {{Alias: " ", FeaturePath: "temperature"}},
+			"alias starting a digit": {{Alias: "1temp", FeaturePath: "temperature"}},
+		} {
+			invalid := *twinType
+			invalid.FeatureAliases = aliases
+			err := twinTypeService.Update(&invalid)
+			require.Error(t, err, name)
+			assert.Contains(t, err.Error(), "invalid feature alias", name)
+		}
+
+		stored, err := twinTypeService.GetByID(twinType.ID)
+		require.NoError(t, err)
+		assert.Len(t, stored.FeatureAliases, 2, "rejected aliases are not stored")
+	})
+}
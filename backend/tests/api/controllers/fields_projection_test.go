@@ -0,0 +1,121 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldsProjection(t *testing.T) {
+	// Setup test environment
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+
+	// Seed a twin with time-series data
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Projection Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{
+		Name:        "Pump 1",
+		Description: "A long description mobile clients don't need",
+		DittoID:     "org.digitalegiz.project1:pump-1",
+		TypeID:      twinType.ID,
+		ProjectID:   project.ID,
+	}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time:        time.Now().Add(-time.Duration(i) * time.Minute),
+			TwinID:      twin.DittoID,
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    20 + float64(i),
+			Source:      "ditto",
+		}))
+	}
+
+	// Register controllers
+	twinService := services.NewTwinService(ts.DB, &config.DittoConfig{}, ts.Logger)
+	twinsRoutes := ts.Router.Group("/api/v1/twins")
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(twinsRoutes)
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(twinsRoutes.Group("/:id/history"))
+
+	t.Run("Should return only requested twin fields", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d?fields=id,name,type.name", twin.ID), nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		ts.ParseResponse(resp, &response)
+
+		assert.Equal(t, map[string]interface{}{
+			"id":   float64(twin.ID),
+			"name": "Pump 1",
+			"type": map[string]interface{}{"name": "Pump"},
+		}, response)
+	})
+
+	t.Run("Should return full twin without fields", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d", twin.ID), nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		ts.ParseResponse(resp, &response)
+
+		assert.Contains(t, response, "description")
+		assert.Contains(t, response, "ditto_id")
+	})
+
+	t.Run("Should return only requested timeseries columns", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET",
+			fmt.Sprintf("/api/v1/twins/%d/history/timeseries?feature_path=temperature&fields=value_num,source", twin.ID), nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		ts.ParseResponse(resp, &response)
+
+		require.Len(t, response.Data, 3)
+		for _, point := range response.Data {
+			assert.Len(t, point, 2)
+			assert.Equal(t, "ditto", point["source"])
+			assert.Contains(t, point, "value_num")
+		}
+	})
+
+	t.Run("Should project latest timeseries value", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET",
+			fmt.Sprintf("/api/v1/twins/%d/history/timeseries/latest?feature_path=temperature&fields=value_num", twin.ID), nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		ts.ParseResponse(resp, &response)
+
+		assert.Equal(t, map[string]interface{}{"value_num": float64(20)}, response.Data)
+	})
+
+	t.Run("Should reject unknown timeseries fields", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET",
+			fmt.Sprintf("/api/v1/twins/%d/history/timeseries?feature_path=temperature&fields=value_num,password", twin.ID), nil, nil)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
@@ -0,0 +1,87 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryHeavyQueryLimit(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.TimeseriesData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Limit Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	historyConfig := &config.HistoryConfig{MaxConcurrentHeavyQueries: 2, HeavyQueryRetryAfter: 7}
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, historyConfig, ts.Logger)
+	historyController := controllers.NewHistoryController(historyService, ts.Logger)
+	historyController.RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+	historyController.RegisterAdminRoutes(ts.Router.Group("/api/v1/admin"))
+
+	end := time.Now().UTC().Truncate(time.Hour)
+	aggregatedPath := fmt.Sprintf("/api/v1/twins/%d/history/aggregated?feature_path=temperature&interval=1h&start=%s&end=%s",
+		twin.ID, url.QueryEscape(end.Add(-24*time.Hour).Format(time.RFC3339)), url.QueryEscape(end.Format(time.RFC3339)))
+
+	t.Run("Should reject the query over the limit while N are in flight", func(t *testing.T) {
+		// Two heavy queries are running
+		var releases []func()
+		for i := 0; i < 2; i++ {
+			release, err := historyService.HeavyQueries().Acquire()
+			require.NoError(t, err)
+			releases = append(releases, release)
+		}
+
+		resp := ts.ExecuteRequest("GET", aggregatedPath, nil, nil)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, "7", resp.Header().Get("Retry-After"))
+
+		// Cheap reads are not throttled
+		resp = ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/timeseries/latest?feature_path=temperature", twin.ID), nil, nil)
+		assert.NotEqual(t, http.StatusServiceUnavailable, resp.Code)
+
+		resp = ts.ExecuteRequest("GET", "/api/v1/admin/history/queries", nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var stats services.QueryLimiterStats
+		ts.ParseResponse(resp, &stats)
+		assert.Equal(t, services.QueryLimiterStats{InFlight: 2, MaxInFlight: 2, Rejected: 1}, stats)
+
+		// Once a query finishes the next one is admitted and its slot freed afterwards
+		releases[0]()
+		releases[0]()
+		resp = ts.ExecuteRequest("GET", aggregatedPath, nil, nil)
+		assert.NotEqual(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, int64(1), historyService.HeavyQueries().Stats().InFlight)
+
+		releases[1]()
+		assert.Zero(t, historyService.HeavyQueries().Stats().InFlight)
+	})
+
+	t.Run("Should not limit queries when the maximum is 0", func(t *testing.T) {
+		limiter := services.NewQueryLimiter(0)
+		for i := 0; i < 100; i++ {
+			_, err := limiter.Acquire()
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int64(100), limiter.Stats().InFlight)
+		assert.Zero(t, limiter.Stats().Rejected)
+	})
+}
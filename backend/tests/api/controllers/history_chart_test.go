@@ -0,0 +1,124 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryChart(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Chart Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	// Six hourly buckets, and a raw point every ten minutes
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-6 * time.Hour)
+	for bucket := start; bucket.Before(end); bucket = bucket.Add(time.Hour) {
+		require.NoError(t, repoFactory.Timeseries().InsertAggregatedData(&models.AggregatedData{
+			TimeInterval: bucket, TwinID: twin.DittoID, FeaturePath: "pressure", IntervalType: "hour",
+			Min: 1, Max: 3, Avg: 2, Sum: 12, Count: 6, FirstTime: bucket, LastTime: bucket.Add(50 * time.Minute),
+		}))
+	}
+	for point := start; point.Before(end); point = point.Add(10 * time.Minute) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: point, TwinID: twin.DittoID, FeaturePath: "pressure", ValueType: "number",
+			ValueNum: float64(point.Sub(start) / time.Minute), Source: services.SourceHTTP,
+		}))
+	}
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	type chartResponse struct {
+		Aggregated []models.AggregatedData `json:"aggregated"`
+		Raw        []models.TimeseriesData `json:"raw"`
+		Meta       map[string]interface{}  `json:"meta"`
+	}
+	chart := func(twinID uint, rangeStart, rangeEnd, focusStart, focusEnd time.Time, extra string) (int, chartResponse) {
+		params := url.Values{}
+		params.Set("feature_path", "pressure")
+		params.Set("interval", "1h")
+		for name, value := range map[string]time.Time{"start": rangeStart, "end": rangeEnd, "focus_start": focusStart, "focus_end": focusEnd} {
+			if !value.IsZero() {
+				params.Set(name, value.Format(time.RFC3339))
+			}
+		}
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/chart?%s%s", twinID, params.Encode(), extra), nil, nil)
+		var body chartResponse
+		ts.ParseResponse(resp, &body)
+		return resp.Code, body
+	}
+
+	t.Run("Should return aggregated buckets for the range and raw points for the focus", func(t *testing.T) {
+		focusStart, focusEnd := start.Add(2*time.Hour), start.Add(3*time.Hour)
+		code, body := chart(twin.ID, start, end, focusStart, focusEnd, "")
+		require.Equal(t, http.StatusOK, code)
+
+		assert.Len(t, body.Aggregated, 6)
+		require.Len(t, body.Raw, 7, "points at both ends of the focus are included")
+		assert.True(t, focusStart.Equal(body.Raw[0].Time), "raw points are returned oldest first")
+		assert.True(t, focusEnd.Equal(body.Raw[6].Time))
+		assert.Equal(t, float64(6), body.Meta["aggregated_count"])
+		assert.Equal(t, float64(7), body.Meta["raw_count"])
+		assert.Equal(t, false, body.Meta["raw_truncated"])
+	})
+
+	t.Run("Should cap the raw points", func(t *testing.T) {
+		code, body := chart(twin.ID, start, end, start, end, "&limit=5")
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, body.Raw, 5)
+		assert.Equal(t, true, body.Meta["raw_truncated"])
+	})
+
+	t.Run("Should accept a focus equal to the full range", func(t *testing.T) {
+		code, _ := chart(twin.ID, start, end, start, end, "")
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Should reject a focus outside the full range", func(t *testing.T) {
+		for name, focus := range map[string][2]time.Time{
+			"starting before the range": {start.Add(-time.Minute), start.Add(time.Hour)},
+			"ending after the range":    {end.Add(-time.Hour), end.Add(time.Minute)},
+			"entirely outside":          {end.Add(time.Hour), end.Add(2 * time.Hour)},
+			"reversed":                  {start.Add(2 * time.Hour), start.Add(time.Hour)},
+			"empty":                     {start.Add(time.Hour), start.Add(time.Hour)},
+		} {
+			code, _ := chart(twin.ID, start, end, focus[0], focus[1], "")
+			assert.Equal(t, http.StatusBadRequest, code, name)
+		}
+	})
+
+	t.Run("Should reject a reversed full range and a missing focus", func(t *testing.T) {
+		code, _ := chart(twin.ID, end, start, start, end, "")
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = chart(twin.ID, start, end, start, time.Time{}, "")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Should return 404 for unknown twins", func(t *testing.T) {
+		code, _ := chart(9999, start, end, start, end, "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
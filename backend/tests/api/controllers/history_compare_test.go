@@ -0,0 +1,145 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryCompare(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Compare Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:compare-pump", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	bucket := func(featurePath string, at time.Time, avg, min, max float64, count int) {
+		require.NoError(t, repoFactory.Timeseries().InsertAggregatedData(&models.AggregatedData{
+			TimeInterval: at, TwinID: twin.DittoID, FeaturePath: featurePath, IntervalType: "hour",
+			Min: min, Max: max, Avg: avg, Sum: avg * float64(count), Count: count, FirstTime: at, LastTime: at.Add(50 * time.Minute),
+		}))
+	}
+
+	// Four hours before maintenance, and four hours a day later, missing the third bucket
+	maintenance := time.Now().UTC().Truncate(time.Hour).Add(-48 * time.Hour)
+	before := services.TimeRange{Start: maintenance.Add(-4 * time.Hour), End: maintenance.Add(-time.Second)}
+	after := services.TimeRange{Start: maintenance.Add(20 * time.Hour), End: maintenance.Add(24*time.Hour - time.Second)}
+	bucket("vibration", before.Start, 10, 8, 12, 2)
+	bucket("vibration", before.Start.Add(time.Hour), 12, 9, 15, 6)
+	bucket("vibration", before.Start.Add(2*time.Hour), 14, 11, 20, 8)
+	bucket("vibration", before.Start.Add(3*time.Hour), 13, 10, 16, 4)
+	bucket("vibration", after.Start, 11, 9, 13, 12)
+	bucket("vibration", after.Start.Add(time.Hour), 11, 10, 15, 12)
+	bucket("vibration", after.Start.Add(3*time.Hour), 11, 7, 14, 12)
+
+	// A pump that was idle before maintenance
+	bucket("flow", before.Start, 0, 0, 0, 3)
+	bucket("flow", after.Start, 2, 1, 3, 3)
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	type compareResponse struct {
+		services.RangeComparison
+		Meta map[string]interface{} `json:"meta"`
+	}
+	compare := func(twinID uint, featurePath string, baseline, comparison services.TimeRange, interval string) (int, compareResponse) {
+		params := url.Values{}
+		params.Set("feature_path", featurePath)
+		params.Set("interval", interval)
+		params.Set("baseline_start", baseline.Start.Format(time.RFC3339))
+		params.Set("baseline_end", baseline.End.Format(time.RFC3339))
+		params.Set("compare_start", comparison.Start.Format(time.RFC3339))
+		params.Set("compare_end", comparison.End.Format(time.RFC3339))
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/compare?%s", twinID, params.Encode()), nil, nil)
+		var body compareResponse
+		if resp.Code == http.StatusOK {
+			ts.ParseResponse(resp, &body)
+		}
+		return resp.Code, body
+	}
+
+	t.Run("Should summarize both ranges and compute their change", func(t *testing.T) {
+		code, body := compare(twin.ID, "vibration", before, after, "1h")
+		require.Equal(t, http.StatusOK, code)
+
+		// (10*2 + 12*6 + 14*8 + 13*4) / 20 samples, weighted rather than the plain 12.25
+		assert.Equal(t, 20, body.Baseline.Count)
+		assert.InDelta(t, 12.8, body.Baseline.Mean, 1e-9)
+		assert.Equal(t, 8.0, body.Baseline.Min)
+		assert.Equal(t, 20.0, body.Baseline.Max)
+		assert.True(t, before.Start.Equal(body.Baseline.Start))
+
+		assert.Equal(t, 36, body.Comparison.Count)
+		assert.InDelta(t, 11, body.Comparison.Mean, 1e-9)
+		assert.Equal(t, 7.0, body.Comparison.Min)
+		assert.Equal(t, 15.0, body.Comparison.Max)
+
+		require.NotNil(t, body.Delta.MeanChange)
+		assert.InDelta(t, -1.8, *body.Delta.MeanChange, 1e-9)
+		assert.InDelta(t, -14.0625, *body.Delta.MeanChangePercent, 1e-9)
+		assert.InDelta(t, -1, *body.Delta.MinChange, 1e-9)
+		assert.InDelta(t, -12.5, *body.Delta.MinChangePercent, 1e-9)
+		assert.InDelta(t, -5, *body.Delta.MaxChange, 1e-9)
+		assert.InDelta(t, -25, *body.Delta.MaxChangePercent, 1e-9)
+	})
+
+	t.Run("Should align the buckets of both ranges by their offset", func(t *testing.T) {
+		code, body := compare(twin.ID, "vibration", before, after, "1h")
+		require.Equal(t, http.StatusOK, code)
+
+		require.Len(t, body.Series, 4)
+		for i, aligned := range body.Series {
+			assert.Equal(t, int64(i*3600), aligned.Offset)
+			require.NotNil(t, aligned.Baseline, i)
+			assert.True(t, before.Start.Add(time.Duration(i)*time.Hour).Equal(aligned.Baseline.TimeInterval), i)
+		}
+		assert.Equal(t, 14.0, body.Series[2].Baseline.Avg)
+		assert.Nil(t, body.Series[2].Comparison, "the missing bucket is left empty")
+		require.NotNil(t, body.Series[3].Comparison)
+		assert.True(t, after.Start.Add(3*time.Hour).Equal(body.Series[3].Comparison.TimeInterval))
+		assert.Equal(t, float64(4), body.Meta["bucket_count"])
+	})
+
+	t.Run("Should leave the percentages of a zero baseline null", func(t *testing.T) {
+		code, body := compare(twin.ID, "flow", before, after, "1h")
+		require.Equal(t, http.StatusOK, code)
+		require.NotNil(t, body.Delta.MeanChange)
+		assert.InDelta(t, 2, *body.Delta.MeanChange, 1e-9)
+		assert.Nil(t, body.Delta.MeanChangePercent)
+		assert.Nil(t, body.Delta.MaxChangePercent)
+	})
+
+	t.Run("Should reject invalid comparisons", func(t *testing.T) {
+		reversed := services.TimeRange{Start: after.End, End: after.Start}
+		code, _ := compare(twin.ID, "vibration", before, reversed, "1h")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = compare(twin.ID, "vibration", reversed, after, "1h")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = compare(twin.ID, "vibration", before, after, "2h")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = compare(9999, "vibration", before, after, "1h")
+		assert.Equal(t, http.StatusNotFound, code)
+
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/compare?feature_path=vibration&interval=1h", twin.ID), nil, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
@@ -0,0 +1,201 @@
+package controllers_test
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryExport(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	memberID := ts.SeedTestUser("member@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Export Project", CreatedBy: memberID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	end := time.Now().UTC().Truncate(time.Hour)
+	start := end.Add(-3 * time.Hour)
+	for bucket := start; bucket.Before(end); bucket = bucket.Add(time.Hour) {
+		require.NoError(t, repoFactory.Timeseries().InsertAggregatedData(&models.AggregatedData{
+			TimeInterval: bucket, TwinID: twin.DittoID, FeaturePath: "pressure", IntervalType: "hour",
+			Min: 1, Max: 3, Avg: 2.5, Sum: 15, Count: 6, FirstTime: bucket, LastTime: bucket.Add(50 * time.Minute),
+		}))
+	}
+	for i, point := 0, start; point.Before(end); i, point = i+1, point.Add(30*time.Minute) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: point, TwinID: twin.DittoID, FeaturePath: "pressure", ValueType: "number",
+			ValueNum: float64(i) + 0.5, Source: services.SourceHTTP,
+		}))
+	}
+	require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+		Time: start.Add(time.Hour), AlertID: "alert-1", TwinID: twin.DittoID, FeaturePath: "pressure",
+		Severity: "critical", Message: "Pressure high, check valve", Source: "rule",
+	}))
+	require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+		Time: start.Add(2 * time.Hour), AlertID: "alert-2", TwinID: twin.DittoID,
+		Severity: "warning", Message: "Pressure rising", Source: "ml",
+		Acknowledged: true, AckBy: "1", AckTime: start.Add(150 * time.Minute), AckNote: "expected",
+	}))
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(group.Group("/twins/:id/history"))
+
+	exportAs := func(userID uint, twinID uint, params url.Values) (int, string, http.Header) {
+		params.Set("start", start.Format(time.RFC3339))
+		params.Set("end", end.Format(time.RFC3339))
+		token := ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/export?%s", twinID, params.Encode()), nil,
+			map[string]string{"Authorization": "Bearer " + token})
+		return resp.Code, resp.Body.String(), resp.Header()
+	}
+	export := func(twinID uint, params url.Values) (int, string, http.Header) {
+		return exportAs(memberID, twinID, params)
+	}
+	readCSV := func(t *testing.T, body string) []map[string]string {
+		records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		require.NoError(t, err)
+		require.NotEmpty(t, records)
+		rows := make([]map[string]string, 0, len(records)-1)
+		for _, record := range records[1:] {
+			require.Len(t, record, len(records[0]))
+			row := make(map[string]string, len(record))
+			for i, column := range records[0] {
+				row[column] = record[i]
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	t.Run("Should export raw points as CSV by default", func(t *testing.T) {
+		code, body, header := export(twin.ID, url.Values{"feature_path": {"pressure"}})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, "text/csv; charset=utf-8", header.Get("Content-Type"))
+		assert.Contains(t, header.Get("Content-Disposition"), "attachment")
+		assert.Contains(t, header.Get("Content-Disposition"), ".csv")
+
+		assert.True(t, strings.HasPrefix(body, strings.Join(services.ExportColumns(services.ExportRaw), ",")+"\n"))
+		rows := readCSV(t, body)
+		require.Len(t, rows, 6)
+		assert.Equal(t, start.Format(time.RFC3339Nano), rows[0]["time"])
+		assert.Equal(t, twin.DittoID, rows[0]["twin_id"])
+		assert.Equal(t, "0.5", rows[0]["value_num"])
+		assert.Equal(t, "5.5", rows[5]["value_num"])
+		assert.Equal(t, services.SourceHTTP, rows[5]["source"])
+	})
+
+	t.Run("Should export aggregated buckets oldest first", func(t *testing.T) {
+		code, body, _ := export(twin.ID, url.Values{"type": {"aggregated"}, "feature_path": {"pressure"}, "interval": {"1h"}})
+		require.Equal(t, http.StatusOK, code, body)
+
+		assert.True(t, strings.HasPrefix(body, strings.Join(services.ExportColumns(services.ExportAggregated), ",")+"\n"))
+		rows := readCSV(t, body)
+		require.Len(t, rows, 3)
+		assert.Equal(t, start.Format(time.RFC3339Nano), rows[0]["time_interval"])
+		assert.Equal(t, "hour", rows[0]["interval_type"])
+		assert.Equal(t, "2.5", rows[0]["avg"])
+		assert.Equal(t, "6", rows[0]["count"])
+		assert.Equal(t, start.Add(50*time.Minute).Format(time.RFC3339Nano), rows[0]["last_time"])
+	})
+
+	t.Run("Should export alerts with their filters", func(t *testing.T) {
+		code, body, _ := export(twin.ID, url.Values{"type": {"alerts"}})
+		require.Equal(t, http.StatusOK, code, body)
+
+		assert.True(t, strings.HasPrefix(body, strings.Join(services.ExportColumns(services.ExportAlerts), ",")+"\n"))
+		rows := readCSV(t, body)
+		require.Len(t, rows, 2)
+		assert.Equal(t, "alert-1", rows[0]["alert_id"])
+		assert.Equal(t, "Pressure high, check valve", rows[0]["message"])
+		assert.Equal(t, "false", rows[0]["acknowledged"])
+		assert.Empty(t, rows[0]["ack_time"])
+		assert.Equal(t, "1", rows[0]["occurrence_count"])
+		assert.Equal(t, start.Add(time.Hour).Format(time.RFC3339Nano), rows[0]["last_seen"])
+		assert.Equal(t, "true", rows[1]["acknowledged"])
+		assert.Equal(t, start.Add(150*time.Minute).Format(time.RFC3339Nano), rows[1]["ack_time"])
+
+		_, body, _ = export(twin.ID, url.Values{"type": {"alerts"}, "severity": {"warning"}})
+		rows = readCSV(t, body)
+		require.Len(t, rows, 1)
+		assert.Equal(t, "alert-2", rows[0]["alert_id"])
+
+		_, body, _ = export(twin.ID, url.Values{"type": {"alerts"}, "acknowledged": {"false"}})
+		rows = readCSV(t, body)
+		require.Len(t, rows, 1)
+		assert.Equal(t, "alert-1", rows[0]["alert_id"])
+	})
+
+	t.Run("Should export NDJSON with one object per row", func(t *testing.T) {
+		code, body, header := export(twin.ID, url.Values{"type": {"alerts"}, "format": {"ndjson"}})
+		require.Equal(t, http.StatusOK, code, body)
+		assert.Equal(t, "application/x-ndjson", header.Get("Content-Type"))
+
+		var alerts []models.AlertData
+		scanner := bufio.NewScanner(strings.NewReader(body))
+		for scanner.Scan() {
+			var alert models.AlertData
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &alert))
+			alerts = append(alerts, alert)
+		}
+		require.Len(t, alerts, 2)
+		assert.Equal(t, "alert-1", alerts[0].AlertID)
+		assert.Equal(t, "expected", alerts[1].AckNote)
+	})
+
+	t.Run("Should reject invalid exports before streaming", func(t *testing.T) {
+		for name, params := range map[string]url.Values{
+			"unknown type":           {"type": {"predictions"}},
+			"unknown format":         {"feature_path": {"pressure"}, "format": {"xlsx"}},
+			"raw without feature":    {},
+			"aggregated no interval": {"type": {"aggregated"}, "feature_path": {"pressure"}},
+			"unknown interval":       {"type": {"aggregated"}, "feature_path": {"pressure"}, "interval": {"2m"}},
+			"unknown severity":       {"type": {"alerts"}, "severity": {"fatal"}},
+		} {
+			code, _, header := export(twin.ID, params)
+			assert.Equal(t, http.StatusBadRequest, code, name)
+			assert.Contains(t, header.Get("Content-Type"), "application/json", name)
+		}
+
+		code, _, _ := export(9999, url.Values{"type": {"alerts"}})
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Should only export twins of the user's projects", func(t *testing.T) {
+		for _, params := range []url.Values{
+			{"feature_path": {"pressure"}},
+			{"type": {"aggregated"}, "feature_path": {"pressure"}, "interval": {"1h"}},
+			{"type": {"alerts"}},
+		} {
+			code, body, _ := exportAs(outsiderID, twin.ID, params)
+			assert.Equal(t, http.StatusForbidden, code)
+			assert.NotContains(t, body, "alert-1")
+		}
+	})
+}
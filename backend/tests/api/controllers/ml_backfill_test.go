@@ -0,0 +1,191 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMLBackfill(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.MLTask{},
+		&models.MLTaskBinding{},
+		&models.MLBackfillJob{},
+	)
+	ts.CreateTimeseriesTables()
+
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	editorID := ts.SeedTestUser("editor@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	require.NoError(t, repoFactory.Project().AddMember(project.ID, editorID, models.ProjectRoleEditor))
+
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	task := &models.MLTask{Name: "Anomalies", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0", Active: true, CreatedBy: ownerID}
+	require.NoError(t, ts.DB.DB.Create(task).Error)
+	require.NoError(t, ts.DB.DB.Create(&models.MLTaskBinding{
+		TaskID:           task.ID,
+		TwinID:           twin.ID,
+		InputMappingJSON: `{"features":["pressure"]}`,
+		Active:           true,
+	}).Error)
+	unbound := &models.MLTask{Name: "Forecast", Type: models.MLTaskTypeAnomaly, ModelID: "pump-forecast", Version: "1.0", Active: true, CreatedBy: ownerID}
+	require.NoError(t, ts.DB.DB.Create(unbound).Error)
+
+	// An hour of pressure and temperature values, one per minute
+	start := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 60; i++ {
+		for _, feature := range []string{"pressure", "temperature"} {
+			require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+				Time:        start.Add(time.Duration(i) * time.Minute),
+				TwinID:      twin.DittoID,
+				FeaturePath: feature,
+				ValueType:   "number",
+				ValueNum:    float64(i),
+				Source:      services.SourceHTTP,
+			}))
+		}
+	}
+
+	bus := testutils.NewFakeKafka()
+	backfillService := services.NewMLBackfillService(ts.DB, ts.Logger)
+	backfillService.SetKafkaManager(bus)
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewMLBackfillController(
+		backfillService,
+		services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger),
+		services.NewProjectService(ts.DB, ts.Logger),
+		ts.Logger,
+	).RegisterRoutes(group.Group("/twins"))
+
+	backfill := func(userID, taskID uint, from, to time.Time) (int, models.MLBackfillJob) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest("POST", fmt.Sprintf("/api/v1/twins/%d/ml/backfill", twin.ID), map[string]interface{}{
+			"task_id": taskID,
+			"start":   from,
+			"end":     to,
+		}, map[string]string{"Authorization": "Bearer " + token})
+		var job models.MLBackfillJob
+		ts.ParseResponse(resp, &job)
+		return resp.Code, job
+	}
+
+	// mlInput is the input of an ML-input message
+	type mlInput struct {
+		ThingID   string                 `json:"thingId"`
+		FeatureID string                 `json:"featureId"`
+		Timestamp time.Time              `json:"timestamp"`
+		Data      float64                `json:"data"`
+		Backfill  services.MLBackfillTag `json:"backfill"`
+	}
+
+	t.Run("Should send the mapped feature values of the range to the ML input", func(t *testing.T) {
+		from, to := start.Add(10*time.Minute), start.Add(29*time.Minute)
+		code, job := backfill(ownerID, task.ID, from, to)
+		require.Equal(t, http.StatusAccepted, code)
+		assert.Equal(t, task.ID, job.TaskID)
+		backfillService.Wait()
+
+		messages := bus.Messages(kafka.TopicMLInput)
+		require.Len(t, messages, 20)
+		for i, message := range messages {
+			assert.Equal(t, task.ModelID, string(message.Key))
+
+			var envelope struct {
+				ModelID string  `json:"modelId"`
+				Input   mlInput `json:"input"`
+			}
+			require.NoError(t, json.Unmarshal(message.Value, &envelope))
+			assert.Equal(t, task.ModelID, envelope.ModelID)
+			assert.Equal(t, twin.DittoID, envelope.Input.ThingID)
+			assert.Equal(t, "pressure", envelope.Input.FeatureID)
+			assert.True(t, from.Add(time.Duration(i)*time.Minute).Equal(envelope.Input.Timestamp))
+			assert.Equal(t, float64(10+i), envelope.Input.Data)
+			assert.Equal(t, job.ID, envelope.Input.Backfill.JobID)
+		}
+
+		token := ts.CreateTestAuthToken(ownerID, "owner@example.com", models.RoleUser)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/ml/backfill/%d", twin.ID, job.ID), nil, map[string]string{"Authorization": "Bearer " + token})
+		require.Equal(t, http.StatusOK, resp.Code)
+		var status models.MLBackfillJob
+		ts.ParseResponse(resp, &status)
+		assert.Equal(t, models.MLBackfillCompleted, status.Status)
+		assert.Equal(t, int64(20), status.Produced)
+		assert.NotNil(t, status.CompletedAt)
+	})
+
+	t.Run("Should only let project owners backfill", func(t *testing.T) {
+		code, _ := backfill(editorID, task.ID, start, start.Add(time.Hour))
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Should reject unbound tasks and invalid ranges", func(t *testing.T) {
+		code, _ := backfill(ownerID, unbound.ID, start, start.Add(time.Hour))
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _ = backfill(ownerID, task.ID, start, start)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = backfill(ownerID, task.ID, start, start.Add(40*24*time.Hour))
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Should hold backfills while the service is paused", func(t *testing.T) {
+		sent := len(bus.Messages(kafka.TopicMLInput))
+		backfillService.Pause()
+		code, job := backfill(ownerID, task.ID, start.Add(40*time.Minute), start.Add(44*time.Minute))
+		require.Equal(t, http.StatusAccepted, code)
+
+		time.Sleep(100 * time.Millisecond)
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), sent)
+		held, err := backfillService.GetJob(twin.ID, job.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.MLBackfillPending, held.Status)
+		assert.True(t, backfillService.Status().Paused)
+
+		backfillService.Resume()
+		backfillService.Wait()
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), sent+5)
+		assert.Equal(t, int64(2), backfillService.Status().Runs)
+	})
+
+	t.Run("Should reject a backfill while one is running for the task", func(t *testing.T) {
+		require.NoError(t, ts.DB.DB.Create(&models.MLBackfillJob{
+			TwinID: twin.ID,
+			TaskID: task.ID,
+			Start:  start,
+			End:    start.Add(time.Hour),
+			Status: models.MLBackfillRunning,
+		}).Error)
+
+		code, _ := backfill(ownerID, task.ID, start, start.Add(time.Hour))
+		assert.Equal(t, http.StatusConflict, code)
+	})
+}
@@ -0,0 +1,150 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryMLPredictionFilters(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	ts.CreateTimeseriesTables()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Prediction Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	// Hourly predictions of the last day, newest first: anomalies scoring 0.1 to 0.6 and
+	// classifications labelled by wear
+	now := time.Now().UTC().Truncate(time.Minute)
+	predictions := []models.MLPredictionData{
+		{PredictionType: "anomaly", ScoreNum: 0.6, LabelStr: "anomaly"},
+		{PredictionType: "classification", ScoreNum: 0.8, LabelStr: "worn"},
+		{PredictionType: "anomaly", ScoreNum: 0.95, LabelStr: "anomaly"},
+		{PredictionType: "anomaly", ScoreNum: 0.1, LabelStr: "normal"},
+		{PredictionType: "classification", ScoreNum: 0.7, LabelStr: "ok"},
+		{PredictionType: "anomaly", ScoreNum: 0.9, LabelStr: "anomaly"},
+	}
+	for i := range predictions {
+		predictions[i].Time = now.Add(-time.Duration(i+1) * time.Hour)
+		predictions[i].TwinID = twin.DittoID
+		predictions[i].TaskID = "pump-health"
+		predictions[i].ModelVersion = "1"
+	}
+	require.NoError(t, repoFactory.Timeseries().InsertMLPredictionBatch(predictions))
+	// Predictions of another task are never listed
+	require.NoError(t, repoFactory.Timeseries().InsertMLPredictionData(&models.MLPredictionData{
+		Time: now.Add(-time.Hour), TwinID: twin.DittoID, TaskID: "pump-forecast", PredictionType: "anomaly", ScoreNum: 0.99,
+	}))
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	type page struct {
+		Data []models.MLPredictionData `json:"data"`
+		Meta struct {
+			Count  int   `json:"count"`
+			Total  int64 `json:"total"`
+			Limit  int   `json:"limit"`
+			Offset int   `json:"offset"`
+		} `json:"meta"`
+	}
+	query := func(params url.Values) (int, page) {
+		params.Set("task_id", "pump-health")
+		params.Set("start", now.Add(-24*time.Hour).Format(time.RFC3339))
+		params.Set("end", now.Format(time.RFC3339))
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/ml-predictions?%s", twin.ID, params.Encode()), nil, nil)
+		var body page
+		if resp.Code == http.StatusOK {
+			ts.ParseResponse(resp, &body)
+		}
+		return resp.Code, body
+	}
+	scores := func(body page) []float64 {
+		result := make([]float64, len(body.Data))
+		for i, prediction := range body.Data {
+			result[i] = prediction.ScoreNum
+		}
+		return result
+	}
+
+	t.Run("Should list every prediction of the task with the total", func(t *testing.T) {
+		code, body := query(url.Values{})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{0.6, 0.8, 0.95, 0.1, 0.7, 0.9}, scores(body))
+		assert.Equal(t, int64(6), body.Meta.Total)
+		assert.Equal(t, 6, body.Meta.Count)
+	})
+
+	t.Run("Should filter by prediction type", func(t *testing.T) {
+		code, body := query(url.Values{"prediction_type": {"classification"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{0.8, 0.7}, scores(body))
+		assert.Equal(t, int64(2), body.Meta.Total)
+	})
+
+	t.Run("Should filter by minimum score", func(t *testing.T) {
+		code, body := query(url.Values{"min_score": {"0.8"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{0.8, 0.95, 0.9}, scores(body))
+		assert.Equal(t, int64(3), body.Meta.Total)
+	})
+
+	t.Run("Should filter by label", func(t *testing.T) {
+		code, body := query(url.Values{"label": {"worn"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Data, 1)
+		assert.Equal(t, "worn", body.Data[0].LabelStr)
+		assert.Equal(t, int64(1), body.Meta.Total)
+	})
+
+	t.Run("Should combine filters and page through the matches", func(t *testing.T) {
+		filters := url.Values{"prediction_type": {"anomaly"}, "min_score": {"0.5"}}
+		code, body := query(filters)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{0.6, 0.95, 0.9}, scores(body))
+
+		filters.Set("limit", "2")
+		filters.Set("offset", "1")
+		code, body = query(filters)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []float64{0.95, 0.9}, scores(body))
+		assert.Equal(t, 2, body.Meta.Count)
+		assert.Equal(t, int64(3), body.Meta.Total, "the total counts every match, not just the page")
+		assert.Equal(t, 1, body.Meta.Offset)
+
+		filters.Set("offset", "3")
+		code, body = query(filters)
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, body.Data)
+		assert.Equal(t, int64(3), body.Meta.Total)
+	})
+
+	t.Run("Should reject invalid filters", func(t *testing.T) {
+		for name, params := range map[string]url.Values{
+			"unknown type":    {"prediction_type": {"forecast"}},
+			"invalid score":   {"min_score": {"high"}},
+			"negative offset": {"offset": {"-1"}},
+		} {
+			code, _ := query(params)
+			assert.Equal(t, http.StatusBadRequest, code, name)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationDeliveries(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.WebhookSubscription{},
+		&models.Notification{},
+		&models.NotificationDelivery{},
+	)
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repository.NewRepositoryFactory(ts.DB.DB).Project().Create(project))
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer receiver.Close()
+
+	webhookService := services.NewWebhookService(ts.DB, ts.Logger)
+	webhookService.SetAllowPrivateNetworks(true)
+	require.NoError(t, webhookService.CreateSubscription(&models.WebhookSubscription{ProjectID: project.ID, URL: receiver.URL}))
+
+	notificationService := services.NewNotificationService(nil, ts.Logger)
+	defer notificationService.Close()
+	deliveryService := services.NewDeliveryService(ts.DB, &config.NotificationConfig{MaxAttempts: 3, RetryBaseDelay: 30}, ts.Logger)
+	deliveryService.RegisterChannel(services.NewWebhookChannel(webhookService))
+	deliveryService.RegisterChannel(services.NewWebSocketChannel(notificationService))
+
+	sent, err := deliveryService.Broadcast(project.ID, models.WebhookEventTwinCreated, map[string]interface{}{"twin_id": 1})
+	require.NoError(t, err)
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewNotificationDeliveryController(deliveryService, services.NewProjectService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+
+	query := func(userID uint, role models.Role, notificationID uint) (int, services.NotificationReceipt) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", role)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/notifications/%d/deliveries", notificationID), nil, map[string]string{"Authorization": "Bearer " + token})
+		var receipt services.NotificationReceipt
+		ts.ParseResponse(resp, &receipt)
+		return resp.Code, receipt
+	}
+
+	t.Run("Should list the receipt of every channel", func(t *testing.T) {
+		code, receipt := query(ownerID, models.RoleUser, sent.Notification.ID)
+		require.Equal(t, http.StatusOK, code)
+		require.NotNil(t, receipt.Notification)
+		assert.Equal(t, project.ID, receipt.Notification.ProjectID)
+
+		statuses := make(map[string]string)
+		for _, delivery := range receipt.Deliveries {
+			statuses[delivery.Channel] = delivery.Status
+			if delivery.Channel == services.DeliveryChannelWebhook {
+				assert.Contains(t, delivery.LastError, "502")
+				assert.NotNil(t, delivery.NextAttemptAt)
+			}
+		}
+		assert.Equal(t, map[string]string{
+			services.DeliveryChannelWebhook:   models.DeliveryStatusPending,
+			services.DeliveryChannelWebSocket: models.DeliveryStatusDelivered,
+		}, statuses)
+	})
+
+	t.Run("Should restrict receipts to project members and admins", func(t *testing.T) {
+		code, _ := query(adminID, models.RoleAdmin, sent.Notification.ID)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = query(outsiderID, models.RoleUser, sent.Notification.ID)
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, _ = query(ownerID, models.RoleUser, 9999)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
@@ -0,0 +1,92 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationHistory(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.NotificationRecord{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repoFactory.Notification().CreateRecords([]models.NotificationRecord{
+		{ProjectID: &project.ID, Type: "alert", Severity: "critical", Topic: "twins/pump-1", Payload: models.JSON(`{"severity":"critical"}`), Time: now.Add(-time.Hour)},
+		{Type: "system_event", Topic: "kafka/consumers/ingest", Payload: models.JSON(`{"status":"failing"}`), Time: now},
+	}))
+
+	history := services.NewNotificationHistory(ts.DB, &config.NotificationConfig{}, ts.Logger)
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewNotificationHistoryController(history, services.NewProjectService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+
+	list := func(userID uint, role models.Role, query string) (int, services.NotificationHistoryPage) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", role)
+		resp := ts.ExecuteRequest("GET", "/api/v1/notifications"+query, nil, map[string]string{"Authorization": "Bearer " + token})
+		var body services.NotificationHistoryPage
+		ts.ParseResponse(resp, &body)
+		return resp.Code, body
+	}
+
+	t.Run("Should return the notifications of the user's projects and broadcasts", func(t *testing.T) {
+		code, body := list(ownerID, models.RoleUser, "")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(2), body.Total)
+		require.Len(t, body.Notifications, 2)
+		assert.Equal(t, "kafka/consumers/ingest", body.Notifications[0].Topic)
+
+		code, body = list(outsiderID, models.RoleUser, "")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Notifications, 1)
+		assert.Equal(t, "system_event", body.Notifications[0].Type)
+	})
+
+	t.Run("Should filter by project, type, severity and time", func(t *testing.T) {
+		query := fmt.Sprintf("?project_id=%d&type=alert&severity=critical,error&start=%s", project.ID, now.Add(-2*time.Hour).Format(time.RFC3339))
+		code, body := list(ownerID, models.RoleUser, query)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Notifications, 1)
+		assert.JSONEq(t, `{"severity":"critical"}`, string(body.Notifications[0].Payload))
+
+		code, body = list(ownerID, models.RoleUser, "?type=alert&end="+now.Add(-2*time.Hour).Format(time.RFC3339))
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, body.Notifications)
+	})
+
+	t.Run("Should require access to a requested project", func(t *testing.T) {
+		code, _ := list(outsiderID, models.RoleUser, fmt.Sprintf("?project_id=%d", project.ID))
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, body := list(adminID, models.RoleAdmin, fmt.Sprintf("?project_id=%d", project.ID))
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, body.Notifications, 1)
+	})
+
+	t.Run("Should reject invalid time ranges", func(t *testing.T) {
+		code, _ := list(ownerID, models.RoleUser, "?start=yesterday")
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = list(ownerID, models.RoleUser, "?start="+now.Format(time.RFC3339)+"&end="+now.Add(-time.Hour).Format(time.RFC3339))
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
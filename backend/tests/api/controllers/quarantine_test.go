@@ -0,0 +1,198 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueQuarantine(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.FeatureBinding{},
+		&models.IngestSequence{},
+		&models.FeatureCatalogEntry{},
+	)
+	ts.CreateTimeseriesTables()
+
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	viewerID := ts.SeedTestUser("viewer@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	require.NoError(t, repoFactory.Project().AddMember(project.ID, viewerID, models.ProjectRoleViewer))
+
+	twinType := &models.TwinType{Name: "Boiler", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Boiler 1", DittoID: "org.digitalegiz.project1:boiler-1", TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+	other := &models.Twin{Name: "Boiler 2", DittoID: "org.digitalegiz.project1:boiler-2", TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Twin().Create(other))
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	bound := func(value float64) *float64 { return &value }
+	precision := 1
+	require.NoError(t, twinService.SaveFeatureBinding(&models.FeatureBinding{
+		TwinID:       twin.ID,
+		FeaturePath:  "temperature",
+		ExpectedType: "number",
+		Precision:    &precision,
+		PlausibleMin: bound(-50),
+		PlausibleMax: bound(150),
+	}))
+	// Only a minimum is declared for the pressure
+	require.NoError(t, twinService.SaveFeatureBinding(&models.FeatureBinding{
+		TwinID:       twin.ID,
+		FeaturePath:  "pressure",
+		PlausibleMin: bound(0),
+	}))
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewQuarantineController(
+		services.NewQuarantineService(ts.DB, ts.Logger),
+		twinService,
+		services.NewProjectService(ts.DB, ts.Logger),
+		ts.Logger,
+	).RegisterRoutes(group.Group("/twins"))
+
+	request := func(method, path string, userID uint) *httptest.ResponseRecorder {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)
+		return ts.ExecuteRequest(method, "/api/v1/twins"+path, nil, map[string]string{"Authorization": "Bearer " + token})
+	}
+	stored := func(featurePath string) []float64 {
+		var values []float64
+		require.NoError(t, ts.DB.DB.Table("timeseries_data").Where("twin_id = ? AND feature_path = ?", twin.DittoID, featurePath).
+			Order("time asc").Pluck("value_num", &values).Error)
+		return values
+	}
+	review := func(query string) services.QuarantineReview {
+		resp := request("GET", fmt.Sprintf("/%d/quarantine%s", twin.ID, query), viewerID)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var body services.QuarantineReview
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		return body
+	}
+
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	ingestService := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+	values := []services.FeatureValue{
+		{FeatureID: "temperature", Timestamp: start, Data: json.RawMessage(`21.53`)},
+		{FeatureID: "temperature", Timestamp: start.Add(time.Minute), Data: json.RawMessage(`9999`)},
+		{FeatureID: "temperature", Timestamp: start.Add(2 * time.Minute), Data: json.RawMessage(`150`)},
+		{FeatureID: "temperature", Timestamp: start.Add(3 * time.Minute), Data: json.RawMessage(`-273.15`)},
+		{FeatureID: "pressure", Timestamp: start, Data: json.RawMessage(`-1`)},
+		{FeatureID: "pressure", Timestamp: start.Add(time.Minute), Data: json.RawMessage(`1e6`)},
+		{FeatureID: "humidity", Timestamp: start, Data: json.RawMessage(`-5`)},
+	}
+	result, err := ingestService.Ingest(twin, values)
+	require.NoError(t, err)
+
+	t.Run("Should store in-range values normally", func(t *testing.T) {
+		assert.Equal(t, 4, result.Stored)
+		assert.Empty(t, result.Rejected)
+		// Bounds are inclusive, and features without a range accept any value
+		assert.Equal(t, []float64{21.5, 150}, stored("temperature"))
+		assert.Equal(t, []float64{1e6}, stored("pressure"))
+		assert.Equal(t, []float64{-5}, stored("humidity"))
+	})
+
+	t.Run("Should quarantine out-of-range values", func(t *testing.T) {
+		body := review("")
+		assert.Equal(t, int64(3), body.Total)
+		require.Len(t, body.Points, 3)
+		// Newest first, unrounded
+		assert.Equal(t, -273.15, body.Points[0].ValueNum)
+		assert.Equal(t, "value -273.15 is below the plausible minimum -50", body.Points[0].Reason)
+		assert.True(t, body.Points[0].Time.Equal(start.Add(3*time.Minute)))
+		assert.Equal(t, services.SourceHTTP, body.Points[0].Source)
+		assert.Equal(t, "value 9999 is above the plausible maximum 150", body.Points[1].Reason)
+		assert.Equal(t, []repository.QuarantineCount{{FeaturePath: "pressure", Count: 1}, {FeaturePath: "temperature", Count: 2}}, body.Counts)
+
+		filtered := review("?feature_path=temperature&limit=1")
+		assert.Equal(t, int64(2), filtered.Total)
+		require.Len(t, filtered.Points, 1)
+		assert.Equal(t, -273.15, filtered.Points[0].ValueNum)
+
+		bindings, err := repoFactory.Twin().ListFeatureBindings(twin.ID)
+		require.NoError(t, err)
+		quarantined := map[string]int64{}
+		for _, binding := range bindings {
+			quarantined[binding.FeaturePath] = binding.QuarantinedPoints
+		}
+		assert.Equal(t, map[string]int64{"pressure": 1, "temperature": 2}, quarantined)
+	})
+
+	t.Run("Should keep the quarantine count when a binding is replaced", func(t *testing.T) {
+		require.NoError(t, twinService.SaveFeatureBinding(&models.FeatureBinding{
+			TwinID:       twin.ID,
+			FeaturePath:  "pressure",
+			PlausibleMin: bound(-2),
+		}))
+		binding, err := repoFactory.Twin().GetFeatureBinding(twin.ID, "pressure")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), binding.QuarantinedPoints)
+	})
+
+	t.Run("Should only let project editors review values", func(t *testing.T) {
+		point := review("?feature_path=pressure").Points[0]
+		assert.Equal(t, http.StatusForbidden, request("POST", fmt.Sprintf("/%d/quarantine/%d/release", twin.ID, point.ID), viewerID).Code)
+		assert.Equal(t, http.StatusForbidden, request("DELETE", fmt.Sprintf("/%d/quarantine/%d", twin.ID, point.ID), viewerID).Code)
+		// Values are reviewed through their own twin
+		assert.Equal(t, http.StatusNotFound, request("POST", fmt.Sprintf("/%d/quarantine/%d/release", other.ID, point.ID), ownerID).Code)
+	})
+
+	t.Run("Should release a value into the series", func(t *testing.T) {
+		point := review("?feature_path=temperature").Points[1]
+		resp := request("POST", fmt.Sprintf("/%d/quarantine/%d/release", twin.ID, point.ID), ownerID)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var released models.TimeseriesData
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &released))
+		assert.Equal(t, 9999.0, released.ValueNum)
+
+		assert.Equal(t, []float64{21.5, 9999, 150}, stored("temperature"))
+		assert.Equal(t, int64(1), review("?feature_path=temperature").Total)
+		assert.Equal(t, http.StatusNotFound, request("POST", fmt.Sprintf("/%d/quarantine/%d/release", twin.ID, point.ID), ownerID).Code)
+	})
+
+	t.Run("Should discard a value", func(t *testing.T) {
+		point := review("?feature_path=pressure").Points[0]
+		assert.Equal(t, http.StatusNoContent, request("DELETE", fmt.Sprintf("/%d/quarantine/%d", twin.ID, point.ID), ownerID).Code)
+		assert.Equal(t, []float64{1e6}, stored("pressure"))
+		assert.Equal(t, int64(1), review("").Total)
+		assert.Equal(t, http.StatusNotFound, request("DELETE", fmt.Sprintf("/%d/quarantine/%d", twin.ID, point.ID), ownerID).Code)
+	})
+
+	t.Run("Should validate plausible ranges", func(t *testing.T) {
+		err := twinService.SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "level", PlausibleMin: bound(10), PlausibleMax: bound(5),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "plausible minimum")
+
+		err = twinService.SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "state", ExpectedType: "string", PlausibleMax: bound(5),
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "number feature")
+	})
+}
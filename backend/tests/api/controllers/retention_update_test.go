@@ -0,0 +1,117 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionUpdate(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	userID := ts.SeedTestUser("retention@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+
+	twinService := services.NewTwinService(ts.DB, &config.DittoConfig{NamespacePrefix: "org.digitalegiz"}, ts.Logger)
+	dittoID, err := twinService.BuildDittoID(project.ID, "pump-1")
+	require.NoError(t, err)
+	twin := &models.Twin{Name: "Pump 1", DittoID: dittoID, TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	auth := middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth()
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins", auth))
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1", auth))
+	headers := map[string]string{"Authorization": "Bearer " + ts.CreateTestAuthToken(userID, "retention@example.com", models.RoleUser)}
+
+	// stored reads the retention windows of a row back from the database
+	stored := func(model interface{}, id uint) (raw, aggregated *int) {
+		var row struct {
+			RawRetentionDays        *int
+			AggregatedRetentionDays *int
+		}
+		require.NoError(t, ts.DB.DB.Model(model).Where("id = ?", id).Take(&row).Error)
+		return row.RawRetentionDays, row.AggregatedRetentionDays
+	}
+	days := func(n int) *int { return &n }
+
+	updateTwin := func(fields map[string]interface{}) {
+		body := map[string]interface{}{"name": twin.Name, "ditto_id": twin.DittoID}
+		for key, value := range fields {
+			body[key] = value
+		}
+		resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twins/%d", twin.ID), body, headers)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	}
+	updateType := func(fields map[string]interface{}) {
+		body := map[string]interface{}{"name": twinType.Name, "version": twinType.Version, "schema_json": map[string]interface{}{}}
+		for key, value := range fields {
+			body[key] = value
+		}
+		resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twin-types/%d", twinType.ID), body, headers)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	}
+
+	t.Run("Should save the retention of a twin", func(t *testing.T) {
+		updateTwin(map[string]interface{}{"raw_retention_days": 30, "aggregated_retention_days": 365})
+		raw, aggregated := stored(&models.Twin{}, twin.ID)
+		assert.Equal(t, days(30), raw)
+		assert.Equal(t, days(365), aggregated)
+	})
+
+	t.Run("Should keep the retention of a twin an update leaves out", func(t *testing.T) {
+		updateTwin(map[string]interface{}{"description": "Feed pump", "raw_retention_days": 60})
+		raw, aggregated := stored(&models.Twin{}, twin.ID)
+		assert.Equal(t, days(60), raw)
+		assert.Equal(t, days(365), aggregated)
+	})
+
+	t.Run("Should clear the retention of a twin on request", func(t *testing.T) {
+		updateTwin(map[string]interface{}{"clear_retention": true, "aggregated_retention_days": 90})
+		raw, aggregated := stored(&models.Twin{}, twin.ID)
+		assert.Nil(t, raw)
+		assert.Equal(t, days(90), aggregated)
+
+		updateTwin(map[string]interface{}{"clear_retention": true})
+		raw, aggregated = stored(&models.Twin{}, twin.ID)
+		assert.Nil(t, raw)
+		assert.Nil(t, aggregated)
+	})
+
+	t.Run("Should save the retention of a twin type", func(t *testing.T) {
+		updateType(map[string]interface{}{"raw_retention_days": 7, "aggregated_retention_days": 0})
+		raw, aggregated := stored(&models.TwinType{}, twinType.ID)
+		assert.Equal(t, days(7), raw)
+		assert.Equal(t, days(0), aggregated)
+	})
+
+	t.Run("Should keep the retention of a twin type an update leaves out", func(t *testing.T) {
+		updateType(map[string]interface{}{"description": "Centrifugal pump"})
+		raw, aggregated := stored(&models.TwinType{}, twinType.ID)
+		assert.Equal(t, days(7), raw)
+		assert.Equal(t, days(0), aggregated)
+	})
+
+	t.Run("Should clear the retention of a twin type on request", func(t *testing.T) {
+		updateType(map[string]interface{}{"clear_retention": true})
+		raw, aggregated := stored(&models.TwinType{}, twinType.ID)
+		assert.Nil(t, raw)
+		assert.Nil(t, aggregated)
+	})
+}
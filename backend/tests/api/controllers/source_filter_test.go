@@ -0,0 +1,86 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistorySourceFilter(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Source Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	// The same feature is written by several ingest paths
+	sources := []string{services.SourceDittoWS, services.SourceHTTP, services.SourceDittoWS, services.SourceSimulator}
+	for i, source := range sources {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time:        time.Now().Add(-time.Duration(i) * time.Minute),
+			TwinID:      twin.DittoID,
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    float64(i),
+			Source:      source,
+		}))
+	}
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	// The time column is left out since sqlite does not scan timestamptz values
+	query := func(params string) (int, []map[string]interface{}) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/timeseries?feature_path=temperature&fields=value_num,source%s", twin.ID, params), nil, nil)
+		var response struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		ts.ParseResponse(resp, &response)
+		return resp.Code, response.Data
+	}
+
+	t.Run("Should return points from every source without a filter", func(t *testing.T) {
+		code, data := query("")
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, data, 4)
+	})
+
+	t.Run("Should only return points from the requested source", func(t *testing.T) {
+		code, data := query("&source=" + services.SourceDittoWS)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, data, 2)
+		for _, point := range data {
+			assert.Equal(t, services.SourceDittoWS, point["source"])
+		}
+
+		code, data = query("&source=" + services.SourceHTTP)
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, data, 1)
+		assert.Equal(t, float64(1), data[0]["value_num"])
+
+		code, data = query("&source=" + services.SourceMQTT)
+		require.Equal(t, http.StatusOK, code)
+		assert.Empty(t, data)
+	})
+
+	t.Run("Should reject an unknown source", func(t *testing.T) {
+		code, _ := query("&source=carrier-pigeon")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,110 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinAccess(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	editorID := ts.SeedTestUser("editor@example.com", "password123", false)
+	viewerID := ts.SeedTestUser("viewer@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+	memberAdminID := ts.SeedTestUser("member-admin@example.com", "password123", true)
+
+	// Inactive admins cannot log in and have no access
+	inactiveAdminID := ts.SeedTestUser("inactive-admin@example.com", "password123", true)
+	require.NoError(t, ts.DB.DB.Model(&models.User{}).Where("id = ?", inactiveAdminID).Update("active", false).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	for userID, role := range map[uint]models.ProjectRole{
+		editorID:      models.ProjectRoleEditor,
+		viewerID:      models.ProjectRoleViewer,
+		memberAdminID: models.ProjectRoleViewer,
+	} {
+		require.NoError(t, ts.DB.DB.Create(&models.ProjectMember{ProjectID: project.ID, UserID: userID, Role: role}).Error)
+	}
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	group := ts.Router.Group("/api/v1/twins", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(group)
+
+	type accessResponse struct {
+		TwinID    uint                  `json:"twin_id"`
+		ProjectID uint                  `json:"project_id"`
+		Users     []services.TwinAccess `json:"users"`
+	}
+	query := func(userID uint, role models.Role, twinID uint) (int, accessResponse) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", role)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/access", twinID), nil, map[string]string{"Authorization": "Bearer " + token})
+		var response accessResponse
+		ts.ParseResponse(resp, &response)
+		return resp.Code, response
+	}
+
+	t.Run("Should list project members with their roles and system admins", func(t *testing.T) {
+		code, response := query(ownerID, models.RoleUser, twin.ID)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, twin.ID, response.TwinID)
+		assert.Equal(t, project.ID, response.ProjectID)
+
+		roles := make(map[uint]string)
+		via := make(map[uint]string)
+		for _, user := range response.Users {
+			roles[user.UserID] = user.Role
+			via[user.UserID] = user.Via
+		}
+		assert.Equal(t, map[uint]string{
+			ownerID:       string(models.ProjectRoleOwner),
+			editorID:      string(models.ProjectRoleEditor),
+			viewerID:      string(models.ProjectRoleViewer),
+			memberAdminID: string(models.ProjectRoleViewer),
+			adminID:       string(models.RoleAdmin),
+		}, roles)
+		assert.Equal(t, services.AccessViaProject, via[memberAdminID])
+		assert.Equal(t, services.AccessViaAdmin, via[adminID])
+
+		// The list matches the project's membership plus the non-member admins
+		members, err := repoFactory.Project().ListMembers(project.ID)
+		require.NoError(t, err)
+		for _, member := range members {
+			assert.Equal(t, string(member.Role), roles[member.UserID])
+			assert.Equal(t, services.AccessViaProject, via[member.UserID])
+		}
+		assert.Len(t, response.Users, len(members)+1)
+	})
+
+	t.Run("Should restrict the list to project owners and admins", func(t *testing.T) {
+		code, _ := query(adminID, models.RoleAdmin, twin.ID)
+		assert.Equal(t, http.StatusOK, code)
+
+		for _, userID := range []uint{editorID, viewerID, outsiderID} {
+			code, _ := query(userID, models.RoleUser, twin.ID)
+			assert.Equal(t, http.StatusForbidden, code)
+		}
+
+		code, _ = query(ownerID, models.RoleUser, 9999)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
@@ -0,0 +1,175 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinDetail(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.ModelBinding{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	viewerID := ts.SeedTestUser("viewer@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	require.NoError(t, repoFactory.Project().AddMember(project.ID, viewerID, models.ProjectRoleViewer))
+
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{"type":"object"}`),
+		PrimaryFeatures: models.StringList{"pressure"}}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID,
+		ModelURL: "https://models.example.com/pump.glb", CreatedBy: ownerID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	require.NoError(t, repoFactory.Twin().CreateModelBinding(&models.ModelBinding{TwinID: twin.ID, PartID: "impeller", FeaturePath: "pressure", BindingType: "color"}))
+	require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{TwinID: twin.ID, FeaturePath: "pressure", ExpectedType: "number"}))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+		Time: now, TwinID: twin.DittoID, FeaturePath: "pressure", ValueType: "number", ValueNum: 4.2, Source: services.SourceHTTP,
+	}))
+	require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+		Time: now, AlertID: "active", TwinID: twin.DittoID, Severity: "warning", Message: "Pressure high", Source: "rule",
+	}))
+	require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+		Time: now.Add(-time.Hour), AlertID: "handled", TwinID: twin.DittoID, Severity: "error", Message: "Pump stopped", Source: "rule", Acknowledged: true,
+	}))
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinDetailController(
+		services.NewTwinDetailService(
+			twinService,
+			services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger),
+			services.NewProjectService(ts.DB, ts.Logger),
+			ts.Logger,
+		),
+		ts.Logger,
+	).RegisterRoutes(group.Group("/twins"))
+
+	// detailResponse is the twin detail with every section
+	type detailResponse struct {
+		Twin     controllers.TwinResponse      `json:"twin"`
+		Type     *controllers.TwinTypeResponse `json:"type"`
+		Bindings *services.TwinBindings        `json:"bindings"`
+		Model    *services.TwinModel           `json:"model"`
+		State    *services.TwinState           `json:"state"`
+		Alerts   []models.AlertData            `json:"alerts"`
+		Errors   map[string]string             `json:"errors"`
+		MLPause  *services.MLPause             `json:"ml_pause"`
+	}
+	detail := func(userID uint, role models.Role, query string) (int, map[string]interface{}, detailResponse) {
+		token := ts.CreateTestAuthToken(userID, "user@example.com", role)
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/detail%s", twin.ID, query), nil, map[string]string{"Authorization": "Bearer " + token})
+		var raw map[string]interface{}
+		var body detailResponse
+		ts.ParseResponse(resp, &raw)
+		ts.ParseResponse(resp, &body)
+		return resp.Code, raw, body
+	}
+	keys := func(raw map[string]interface{}) []string {
+		var names []string
+		for name := range raw {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	t.Run("Should return only the twin without includes", func(t *testing.T) {
+		code, raw, body := detail(viewerID, models.RoleUser, "")
+		require.Equal(t, http.StatusOK, code)
+		assert.ElementsMatch(t, []string{"twin", "ml_pause"}, keys(raw))
+		assert.Nil(t, body.MLPause)
+		assert.Equal(t, twin.ID, body.Twin.ID)
+	})
+
+	t.Run("Should return the requested sections", func(t *testing.T) {
+		code, raw, body := detail(viewerID, models.RoleUser, "?include=type,model")
+		require.Equal(t, http.StatusOK, code)
+		assert.ElementsMatch(t, []string{"twin", "ml_pause", "type", "model"}, keys(raw))
+		require.NotNil(t, body.Type)
+		assert.Equal(t, "Pump", body.Type.Name)
+		assert.JSONEq(t, `{"type":"object"}`, string(body.Type.SchemaJSON))
+		require.NotNil(t, body.Model)
+		assert.Equal(t, twin.ModelURL, body.Model.URL)
+		require.NotNil(t, body.Model.Format)
+		assert.Equal(t, models.ModelFormatGLB, body.Model.Format.ID)
+	})
+
+	t.Run("Should return bindings, state and active alerts", func(t *testing.T) {
+		code, raw, body := detail(viewerID, models.RoleUser, "?include=bindings,state,alerts")
+		require.Equal(t, http.StatusOK, code)
+		assert.ElementsMatch(t, []string{"twin", "ml_pause", "bindings", "state", "alerts"}, keys(raw))
+
+		require.NotNil(t, body.Bindings)
+		require.Len(t, body.Bindings.Model, 1)
+		assert.Equal(t, "impeller", body.Bindings.Model[0].PartID)
+		require.Len(t, body.Bindings.Features, 1)
+		assert.Equal(t, "number", body.Bindings.Features[0].ExpectedType)
+
+		require.NotNil(t, body.State)
+		require.Contains(t, body.State.Features, "pressure")
+		assert.JSONEq(t, `4.2`, string(body.State.Features["pressure"].Value))
+
+		require.Len(t, body.Alerts, 1)
+		assert.Equal(t, "active", body.Alerts[0].AlertID)
+	})
+
+	t.Run("Should show the ML pause of the twin's project", func(t *testing.T) {
+		until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		_, err := services.NewProjectService(ts.DB, ts.Logger).SetMLPause(project.ID, true, &until)
+		require.NoError(t, err)
+		defer repoFactory.Project().SetMLPause(project.ID, false, nil)
+
+		code, _, body := detail(viewerID, models.RoleUser, "")
+		require.Equal(t, http.StatusOK, code)
+		require.NotNil(t, body.MLPause)
+		assert.Equal(t, services.MLPauseScopeProject, body.MLPause.Scope)
+		require.NotNil(t, body.MLPause.Until)
+		assert.True(t, until.Equal(*body.MLPause.Until))
+	})
+
+	t.Run("Should reject unknown sections", func(t *testing.T) {
+		code, _, _ := detail(viewerID, models.RoleUser, "?include=type,secrets")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Should require access to the twin's project", func(t *testing.T) {
+		code, _, _ := detail(outsiderID, models.RoleUser, "?include=type")
+		assert.Equal(t, http.StatusForbidden, code)
+
+		code, _, body := detail(adminID, models.RoleAdmin, "?include=type")
+		require.Equal(t, http.StatusOK, code)
+		assert.NotNil(t, body.Type)
+	})
+
+	t.Run("Should return the other sections when one fails", func(t *testing.T) {
+		require.NoError(t, ts.DB.DB.Migrator().DropTable(&models.ModelBinding{}))
+
+		code, raw, body := detail(ownerID, models.RoleUser, "?include=bindings,model")
+		require.Equal(t, http.StatusOK, code)
+		assert.ElementsMatch(t, []string{"twin", "ml_pause", "model", "errors"}, keys(raw))
+		assert.Contains(t, body.Errors, "bindings")
+		assert.NotNil(t, body.Model)
+	})
+}
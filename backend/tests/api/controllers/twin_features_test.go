@@ -0,0 +1,189 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinFeatureListing(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.FeatureCatalogEntry{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	maxSpeed := 3000.0
+	twinType := &models.TwinType{Name: "Line", Version: "1.0", SchemaJSON: models.JSON(`{}`),
+		FeatureAliases: models.FeatureAliasList{{Alias: "main_pump", FeaturePath: "pump07/speed"}},
+		FeatureMetadata: models.FeatureMetadataList{
+			{FeaturePath: "pump07/speed", Order: 1, Group: "Pumps", Icon: "pump", Unit: "rpm", Max: &maxSpeed},
+			{FeaturePath: "sensor_000/temperature", Order: 2, Group: "Sensors"},
+		}}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Line 1", DittoID: "org.digitalegiz.project1:line-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+	require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+		TwinID: twin.ID, FeaturePath: "sensor_000/temperature", Unit: "celsius",
+	}))
+
+	// 200 sensors and 50 pumps, as recorded in the feature catalog on ingest
+	now := time.Now().UTC().Truncate(time.Second)
+	var entries []models.FeatureCatalogEntry
+	for i := 0; i < 200; i++ {
+		entries = append(entries, models.FeatureCatalogEntry{TwinID: twin.DittoID, FeaturePath: fmt.Sprintf("sensor_%03d/temperature", i),
+			ValueType: "number", LastSeen: now, UpdatedAt: now})
+	}
+	for i := 0; i < 50; i++ {
+		entries = append(entries, models.FeatureCatalogEntry{TwinID: twin.DittoID, FeaturePath: fmt.Sprintf("pump%02d/speed", i),
+			ValueType: "number", LastSeen: now, UpdatedAt: now})
+	}
+	require.NoError(t, repoFactory.Timeseries().UpsertFeatureCatalog(entries))
+
+	historyService := services.NewHistoryService(ts.DB, nil, nil, &config.HistoryConfig{MaxFeaturePageSize: 120}, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterTwinRoutes(ts.Router.Group("/api/v1/twins"))
+
+	list := func(twinID uint, query url.Values) (int, services.FeatureList) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/features?%s", twinID, query.Encode()), nil, nil)
+		var body services.FeatureList
+		if resp.Code == http.StatusOK {
+			ts.ParseResponse(resp, &body)
+		}
+		return resp.Code, body
+	}
+	paths := func(features []services.TwinFeature) []string {
+		result := []string{}
+		for _, feature := range features {
+			result = append(result, feature.FeaturePath)
+		}
+		return result
+	}
+
+	t.Run("Should return the first page by default with the total", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(250), body.Total)
+		assert.Equal(t, 100, body.Limit)
+		assert.Equal(t, 0, body.Offset)
+		require.Len(t, body.Features, 100)
+		assert.Equal(t, "pump00/speed", body.Features[0].FeaturePath)
+		assert.Equal(t, "number", body.Features[0].ValueType)
+		assert.True(t, now.Equal(body.Features[0].LastSeen))
+	})
+
+	t.Run("Should page through every feature in path order", func(t *testing.T) {
+		var seen []string
+		for offset := 0; ; offset += 60 {
+			code, body := list(twin.ID, url.Values{"limit": {"60"}, "offset": {fmt.Sprint(offset)}})
+			require.Equal(t, http.StatusOK, code)
+			assert.Equal(t, int64(250), body.Total)
+			if len(body.Features) == 0 {
+				break
+			}
+			seen = append(seen, paths(body.Features)...)
+		}
+		require.Len(t, seen, 250)
+		assert.IsIncreasing(t, seen)
+	})
+
+	t.Run("Should cap the page size", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{"limit": {"1000"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 120, body.Limit)
+		assert.Len(t, body.Features, 120)
+	})
+
+	t.Run("Should filter by a case-insensitive substring", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{"q": {"SENSOR_01"}, "limit": {"5"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(10), body.Total)
+		assert.Equal(t, []string{
+			"sensor_010/temperature", "sensor_011/temperature", "sensor_012/temperature",
+			"sensor_013/temperature", "sensor_014/temperature",
+		}, paths(body.Features))
+
+		code, body = list(twin.ID, url.Values{"q": {"speed"}, "offset": {"45"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(50), body.Total)
+		assert.Equal(t, []string{"pump45/speed", "pump46/speed", "pump47/speed", "pump48/speed", "pump49/speed"}, paths(body.Features))
+	})
+
+	t.Run("Should match wildcard characters literally", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{"q": {"p_"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Zero(t, body.Total)
+		assert.Empty(t, body.Features)
+
+		code, body = list(twin.ID, url.Values{"q": {"%"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Zero(t, body.Total)
+	})
+
+	t.Run("Should match and return feature aliases", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{"q": {"main"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Features, 1)
+		assert.Equal(t, "pump07/speed", body.Features[0].FeaturePath)
+		assert.Equal(t, "main_pump", body.Features[0].Alias)
+
+		code, body = list(twin.ID, url.Values{"q": {"pump0"}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(10), body.Total)
+		for _, feature := range body.Features {
+			assert.Equal(t, feature.FeaturePath == "pump07/speed", feature.Alias != "", feature.FeaturePath)
+		}
+	})
+
+	t.Run("Should return the feature metadata of the twin detail", func(t *testing.T) {
+		code, body := list(twin.ID, url.Values{"q": {"pump07"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Features, 1)
+		assert.Equal(t, twinType.FeatureMetadata[0], body.Features[0].FeatureMetadata)
+
+		code, body = list(twin.ID, url.Values{"q": {"sensor_00"}})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Features, 10)
+		detailed, err := repoFactory.Twin().GetByID(twin.ID)
+		require.NoError(t, err)
+		metadata, err := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger).ListFeatureMetadata(detailed)
+		require.NoError(t, err)
+		require.Len(t, metadata, 2)
+		assert.Equal(t, metadata[1], body.Features[0].FeatureMetadata)
+		assert.Equal(t, "celsius", body.Features[0].Unit)
+
+		// Features without metadata carry only their path
+		assert.Equal(t, models.FeatureMetadata{FeaturePath: "sensor_001/temperature"}, body.Features[1].FeatureMetadata)
+	})
+
+	t.Run("Should reject invalid paging and unknown twins", func(t *testing.T) {
+		code, _ := list(twin.ID, url.Values{"offset": {"-1"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = list(twin.ID, url.Values{"limit": {"many"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = list(9999, url.Values{})
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Should list nothing for twins without recorded features", func(t *testing.T) {
+		idle := &models.Twin{Name: "Line 2", DittoID: "org.digitalegiz.project1:line-2", TypeID: twinType.ID, ProjectID: project.ID}
+		require.NoError(t, repoFactory.Twin().Create(idle))
+
+		code, body := list(idle.ID, url.Values{})
+		require.Equal(t, http.StatusOK, code)
+		assert.Zero(t, body.Total)
+		assert.NotNil(t, body.Features)
+	})
+}
@@ -0,0 +1,130 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// twinSnapshot is the locked wire format of a twin with a loaded type; timestamps are
+// replaced by placeholders and IDs are filled in by the test
+const twinSnapshot = `{
+	"id": %[1]d,
+	"name": "Pump 1",
+	"description": "Main feed pump",
+	"ditto_id": %[5]q,
+	"type_id": %[2]d,
+	"project_id": %[3]d,
+	"model_url": "https://models.example.com/pump.glb",
+	"tags": [],
+	"primary_features": [],
+	"created_by": %[4]d,
+	"created_at": "<time>",
+	"updated_at": "<time>",
+	"type": {"id": %[2]d, "name": "Pump", "version": "1.0"}
+}`
+
+func TestTwinResponseShape(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	userID := ts.SeedTestUser("shape@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Shape Project", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+
+	twinService := services.NewTwinService(ts.DB, &config.DittoConfig{NamespacePrefix: "org.digitalegiz"}, ts.Logger)
+	group := ts.Router.Group("/api/v1/twins", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(group)
+	headers := map[string]string{"Authorization": "Bearer " + ts.CreateTestAuthToken(userID, "shape@example.com", models.RoleUser)}
+
+	// normalize decodes a twin and replaces its timestamps, which vary between runs
+	normalize := func(t *testing.T, raw json.RawMessage) string {
+		var twin map[string]interface{}
+		require.NoError(t, json.Unmarshal(raw, &twin))
+		for _, field := range []string{"created_at", "updated_at"} {
+			require.Contains(t, twin, field)
+			twin[field] = "<time>"
+		}
+		normalized, err := json.Marshal(twin)
+		require.NoError(t, err)
+		return string(normalized)
+	}
+
+	var twinID uint
+	var dittoID string
+	t.Run("Should accept snake_case fields and omit empty ones on create", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/twins", map[string]interface{}{
+			"name":       "Pump 1",
+			"type_id":    twinType.ID,
+			"project_id": project.ID,
+			"local_name": "pump-1",
+		}, headers)
+		require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+
+		var twin map[string]interface{}
+		ts.ParseResponse(resp, &twin)
+		twinID = uint(twin["id"].(float64))
+		dittoID, _ = twin["ditto_id"].(string)
+		assert.Contains(t, dittoID, ":pump-1")
+		assert.NotContains(t, twin, "description")
+		assert.NotContains(t, twin, "model_url")
+		assert.NotContains(t, twin, "metadata")
+		assert.NotContains(t, twin, "deleted_at")
+		assert.NotContains(t, twin, "project")
+	})
+
+	t.Run("Should match the twin snapshot", func(t *testing.T) {
+		resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twins/%d", twinID), map[string]interface{}{
+			"name":        "Pump 1",
+			"ditto_id":    dittoID,
+			"description": "Main feed pump",
+			"model_url":   "https://models.example.com/pump.glb",
+		}, headers)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+
+		expected := fmt.Sprintf(twinSnapshot, twinID, twinType.ID, project.ID, userID, dittoID)
+		assert.JSONEq(t, expected, normalize(t, resp.Body.Bytes()))
+
+		resp = ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d", twinID), nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, expected, normalize(t, resp.Body.Bytes()))
+
+		resp = ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins?project_id=%d", project.ID), nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var list struct {
+			Twins []json.RawMessage `json:"twins"`
+			Total int64             `json:"total"`
+		}
+		ts.ParseResponse(resp, &list)
+		require.Len(t, list.Twins, 1)
+		assert.Equal(t, int64(1), list.Total)
+		assert.JSONEq(t, expected, normalize(t, list.Twins[0]))
+	})
+
+	t.Run("Should name invalid fields as sent on the wire", func(t *testing.T) {
+		resp := ts.ExecuteRequest("PUT", fmt.Sprintf("/api/v1/twins/%d", twinID), map[string]interface{}{"name": "Pump 1"}, headers)
+		require.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+		var response utils.ValidationErrorResponse
+		ts.ParseResponse(resp, &response)
+		require.Len(t, response.Errors, 1)
+		assert.Equal(t, "ditto_id", response.Errors[0].Field)
+	})
+}
@@ -0,0 +1,141 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinState(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+	ts.Config.Ditto.NamespacePrefix = "org.digitalegiz"
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	userID := ts.SeedTestUser("state@example.com", "password123", false)
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(project))
+
+	twinTypeService := services.NewTwinTypeService(ts.DB, ts.Logger)
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID,
+		PrimaryFeatures: models.StringList{"pressure", " temperature "}}
+	require.NoError(t, twinTypeService.Create(twinType))
+	assert.Equal(t, models.StringList{"pressure", "temperature"}, twinType.PrimaryFeatures)
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	dittoID := func(name string) string {
+		id, err := twinService.BuildDittoID(project.ID, name)
+		require.NoError(t, err)
+		return id
+	}
+	newTwin := func(name string, primary ...string) *models.Twin {
+		twin := &models.Twin{Name: name, DittoID: dittoID(name), TypeID: twinType.ID, ProjectID: project.ID,
+			CreatedBy: userID, PrimaryFeatures: primary}
+		require.NoError(t, twinService.Create(twin))
+		return twin
+	}
+	typed := newTwin("typed")
+	overriding := newTwin("overriding", "status/running")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, twin := range []*models.Twin{typed, overriding} {
+		for i, feature := range []string{"pressure", "status/running", "vibration"} {
+			for age := 2; age >= 0; age-- {
+				require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+					Time:        now.Add(-time.Duration(age) * time.Minute),
+					TwinID:      twin.DittoID,
+					FeaturePath: feature,
+					ValueType:   "number",
+					ValueNum:    float64(10*i - age),
+					Source:      services.SourceHTTP,
+				}))
+			}
+		}
+	}
+
+	historyService := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterTwinRoutes(ts.Router.Group("/api/v1/twins"))
+
+	state := func(twin *models.Twin, query string) (int, services.TwinState) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/state%s", twin.ID, query), nil, nil)
+		var body services.TwinState
+		ts.ParseResponse(resp, &body)
+		return resp.Code, body
+	}
+	paths := func(body services.TwinState) []string {
+		features := make([]string, 0, len(body.Features))
+		for feature := range body.Features {
+			features = append(features, feature)
+		}
+		sort.Strings(features)
+		return features
+	}
+
+	t.Run("Should return the primary features of the twin type by default", func(t *testing.T) {
+		code, body := state(typed, "")
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, body.All)
+		assert.Equal(t, []string{"pressure", "temperature"}, paths(body))
+
+		require.NotNil(t, body.Features["pressure"])
+		assert.JSONEq(t, `0`, string(body.Features["pressure"].Value))
+		assert.True(t, now.Equal(body.Features["pressure"].Time))
+		assert.Nil(t, body.Features["temperature"], "primary features without values are reported as null")
+	})
+
+	t.Run("Should prefer the primary features of the twin", func(t *testing.T) {
+		code, body := state(overriding, "")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []string{"status/running"}, paths(body))
+		assert.JSONEq(t, `10`, string(body.Features["status/running"].Value))
+	})
+
+	t.Run("Should return every stored feature with all=true", func(t *testing.T) {
+		code, body := state(typed, "?all=true")
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, body.All)
+		assert.Equal(t, []string{"pressure", "status/running", "vibration"}, paths(body))
+		assert.JSONEq(t, `20`, string(body.Features["vibration"].Value))
+	})
+
+	t.Run("Should return 404 for unknown twins", func(t *testing.T) {
+		code, _ := state(&models.Twin{ID: 9999}, "")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("Should reject invalid primary feature paths", func(t *testing.T) {
+		for _, primary := range [][]string{
+			{""},
+			{"pressure", "pressure"},
+			{"/pressure"},
+			{"status//running"},
+			{"flow rate"},
+			{strings.Repeat("x", 256)},
+		} {
+			twin := &models.Twin{Name: "invalid", DittoID: dittoID("invalid"), TypeID: twinType.ID, ProjectID: project.ID,
+				CreatedBy: userID, PrimaryFeatures: primary}
+			err := twinService.Create(twin)
+			require.Error(t, err, "%q", primary)
+			assert.True(t, strings.HasPrefix(err.Error(), "invalid primary feature"), err.Error())
+		}
+
+		twinType.PrimaryFeatures = models.StringList{"pressure", ""}
+		err := twinTypeService.Update(twinType)
+		require.Error(t, err)
+		assert.True(t, strings.HasPrefix(err.Error(), "invalid primary feature"), err.Error())
+	})
+}
@@ -0,0 +1,174 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinStatus(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.TimeseriesData{},
+		&models.AlertData{},
+	)
+	memberID := ts.SeedTestUser("member@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	plant := &models.Project{Name: "Plant", CreatedBy: memberID}
+	require.NoError(t, repoFactory.Project().Create(plant))
+	other := &models.Project{Name: "Other", CreatedBy: adminID}
+	require.NoError(t, repoFactory.Project().Create(other))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+
+	newTwin := func(project *models.Project, name string) *models.Twin {
+		twin := &models.Twin{Name: name, DittoID: "org.digitalegiz.project1:" + name, TypeID: twinType.ID, ProjectID: project.ID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		return twin
+	}
+	reporting := newTwin(plant, "pump-1")
+	silent := newTwin(plant, "pump-2")
+	neverSeen := newTwin(plant, "pump-3")
+	foreign := newTwin(other, "pump-4")
+
+	now := time.Now().Truncate(time.Second)
+	record := func(twin *models.Twin, feature string, at time.Time) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: at, TwinID: twin.DittoID, FeaturePath: feature, ValueType: "number", ValueNum: 1,
+		}))
+	}
+	record(reporting, "temperature", now.Add(-10*time.Minute))
+	record(reporting, "temperature", now.Add(-time.Minute))
+	record(reporting, "pressure", now.Add(-5*time.Minute))
+	record(silent, "temperature", now.Add(-2*time.Hour))
+	record(foreign, "temperature", now.Add(-time.Minute))
+
+	alertSeq := 0
+	alert := func(twin *models.Twin, severity string, acknowledged bool) {
+		alertSeq++
+		require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+			Time:         now.Add(-time.Duration(alertSeq) * time.Second),
+			AlertID:      fmt.Sprintf("alert-%d", alertSeq),
+			TwinID:       twin.DittoID,
+			Severity:     severity,
+			Message:      "threshold exceeded",
+			Acknowledged: acknowledged,
+		}))
+	}
+	alert(reporting, "warning", false)
+	alert(reporting, "critical", false)
+	alert(reporting, "info", false)
+	alert(reporting, "critical", true)
+	alert(silent, "error", true)
+	alert(neverSeen, "info", false)
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	twinService.SetStatusConfig(&config.TwinStatusConfig{MaxTwins: 5, StaleAfter: 900})
+	group := ts.Router.Group("/api/v1/twins", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinController(twinService, ts.Logger).RegisterRoutes(group)
+
+	memberToken := ts.CreateTestAuthToken(memberID, "member@example.com", models.RoleUser)
+	query := func(token string, body interface{}) (int, controllers.TwinStatusResponse) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/twins/status", body, map[string]string{"Authorization": "Bearer " + token})
+		var response controllers.TwinStatusResponse
+		ts.ParseResponse(resp, &response)
+		return resp.Code, response
+	}
+	byTwin := func(response controllers.TwinStatusResponse) map[uint]services.TwinStatus {
+		statuses := make(map[uint]services.TwinStatus)
+		for _, status := range response.Twins {
+			statuses[status.TwinID] = status
+		}
+		return statuses
+	}
+
+	t.Run("Should aggregate last seen and active alerts per twin", func(t *testing.T) {
+		code, response := query(memberToken, map[string]interface{}{
+			"twin_ids": []uint{reporting.ID, silent.ID, neverSeen.ID, reporting.ID},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, response.Twins, 3)
+		assert.Empty(t, response.Missing)
+		statuses := byTwin(response)
+
+		status := statuses[reporting.ID]
+		require.NotNil(t, status.LastSeen)
+		assert.WithinDuration(t, now.Add(-time.Minute), *status.LastSeen, time.Second)
+		assert.Equal(t, int64(3), status.ActiveAlertCount)
+		assert.Equal(t, "critical", status.HighestSeverity)
+		assert.False(t, status.Stale)
+
+		status = statuses[silent.ID]
+		require.NotNil(t, status.LastSeen)
+		assert.WithinDuration(t, now.Add(-2*time.Hour), *status.LastSeen, time.Second)
+		assert.Zero(t, status.ActiveAlertCount)
+		assert.Empty(t, status.HighestSeverity)
+		assert.True(t, status.Stale)
+
+		status = statuses[neverSeen.ID]
+		assert.Nil(t, status.LastSeen)
+		assert.Equal(t, int64(1), status.ActiveAlertCount)
+		assert.Equal(t, "info", status.HighestSeverity)
+		assert.True(t, status.Stale)
+	})
+
+	t.Run("Should report inaccessible and unknown twins as missing", func(t *testing.T) {
+		code, response := query(memberToken, map[string]interface{}{
+			"twin_ids": []uint{reporting.ID, foreign.ID, 9999},
+		})
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, response.Twins, 1)
+		assert.Equal(t, reporting.ID, response.Twins[0].TwinID)
+		assert.ElementsMatch(t, []uint{foreign.ID, 9999}, response.Missing)
+
+		// Admins see the twins of every project
+		adminToken := ts.CreateTestAuthToken(adminID, "admin@example.com", models.RoleAdmin)
+		code, response = query(adminToken, map[string]interface{}{"twin_ids": []uint{reporting.ID, foreign.ID}})
+		require.Equal(t, http.StatusOK, code)
+		assert.Len(t, response.Twins, 2)
+		assert.Empty(t, response.Missing)
+	})
+
+	t.Run("Should report every twin of a project", func(t *testing.T) {
+		code, response := query(memberToken, map[string]interface{}{"project_id": plant.ID})
+		require.Equal(t, http.StatusOK, code)
+		statuses := byTwin(response)
+		assert.Len(t, statuses, 3)
+		assert.Contains(t, statuses, reporting.ID)
+		assert.Contains(t, statuses, silent.ID)
+		assert.Contains(t, statuses, neverSeen.ID)
+
+		outsiderToken := ts.CreateTestAuthToken(outsiderID, "outsider@example.com", models.RoleUser)
+		code, _ = query(outsiderToken, map[string]interface{}{"project_id": plant.ID})
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Should reject requests over the twin limit", func(t *testing.T) {
+		code, _ := query(memberToken, map[string]interface{}{"twin_ids": []uint{1, 2, 3, 4, 5, 6}})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = query(memberToken, map[string]interface{}{})
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
@@ -0,0 +1,153 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeVersionCompatibility(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	ts.CreateTimeseriesTables()
+
+	// pumpSchema is a Ditto thing schema with the given speed feature schema, and a legacy
+	// counter unless it is dropped
+	pumpSchema := func(speed map[string]interface{}, legacy bool) map[string]interface{} {
+		features := map[string]interface{}{
+			"pump": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"speed": speed},
+					},
+				},
+			},
+			"mode": map[string]interface{}{"type": "string"},
+		}
+		if legacy {
+			features["legacy"] = map[string]interface{}{"type": "number"}
+		}
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"features": map[string]interface{}{"type": "object", "properties": features}},
+		}
+	}
+	current := pumpSchema(map[string]interface{}{"type": "number"}, true)
+	currentJSON, err := json.Marshal(current)
+	require.NoError(t, err)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(currentJSON)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+
+	now := time.Now().UTC().Truncate(time.Second)
+	twins := map[string]*models.Twin{}
+	for i, name := range []string{"slow", "fast", "legacy", "miscoded"} {
+		twin := &models.Twin{Name: name, DittoID: fmt.Sprintf("org.digitalegiz.plant:compat-%s", name), TypeID: twinType.ID, ProjectID: project.ID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		twins[name] = twin
+
+		// An older point that the latest one supersedes
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: now.Add(-time.Hour), TwinID: twin.DittoID, FeaturePath: "pump/speed", ValueType: "number", ValueNum: float64(5000 + i),
+		}))
+	}
+	insert := func(twin, path string, point models.TimeseriesData) {
+		point.Time, point.TwinID, point.FeaturePath = now, twins[twin].DittoID, path
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&point))
+	}
+	insert("slow", "pump/speed", models.TimeseriesData{ValueType: "number", ValueNum: 1500})
+	insert("slow", "mode", models.TimeseriesData{ValueType: "string", ValueStr: "auto"})
+	insert("fast", "pump/speed", models.TimeseriesData{ValueType: "number", ValueNum: 3600})
+	insert("legacy", "pump/speed", models.TimeseriesData{ValueType: "number", ValueNum: 3200})
+	insert("legacy", "legacy", models.TimeseriesData{ValueType: "number", ValueNum: 1})
+	insert("miscoded", "pump/speed", models.TimeseriesData{ValueType: "number", ValueNum: 1200})
+	// The current schema already rejects this value, so the new version does not break it
+	insert("miscoded", "mode", models.TimeseriesData{ValueType: "number", ValueNum: 2})
+
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1"))
+
+	check := func(typeID uint, version, query string, schema interface{}) (int, services.SchemaCompatReport) {
+		resp := ts.ExecuteRequest("POST", fmt.Sprintf("/api/v1/twin-types/%d/versions/%s/compat-check%s", typeID, version, query),
+			map[string]interface{}{"schema_json": schema}, nil)
+		var report services.SchemaCompatReport
+		if resp.Code == http.StatusOK {
+			ts.ParseResponse(resp, &report)
+		}
+		return resp.Code, report
+	}
+
+	t.Run("Should flag twins whose state a tightened schema rejects", func(t *testing.T) {
+		code, report := check(twinType.ID, "2.0", "", pumpSchema(map[string]interface{}{"type": "number", "maximum": 3000}, false))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, twinType.ID, report.TwinTypeID)
+		assert.Equal(t, "1.0", report.CurrentVersion)
+		assert.Equal(t, "2.0", report.Version)
+		assert.Equal(t, int64(4), report.TotalTwins)
+		assert.Equal(t, 4, report.SampledTwins)
+		assert.False(t, report.Compatible)
+
+		require.Len(t, report.Breaking, 2)
+		fast, legacy := report.Breaking[0], report.Breaking[1]
+		assert.Equal(t, twins["fast"].ID, fast.TwinID)
+		assert.Equal(t, twins["fast"].DittoID, fast.DittoID)
+		require.Len(t, fast.Fields, 1)
+		assert.Equal(t, "pump/speed", fast.Fields[0].FeaturePath)
+		assert.JSONEq(t, "3600", string(fast.Fields[0].Value))
+		assert.NotEmpty(t, fast.Fields[0].Errors)
+
+		assert.Equal(t, twins["legacy"].ID, legacy.TwinID)
+		require.Len(t, legacy.Fields, 2)
+		assert.Equal(t, "legacy", legacy.Fields[0].FeaturePath)
+		assert.Equal(t, "feature is no longer declared by the schema", legacy.Fields[0].Errors[0].Message)
+		assert.Equal(t, "pump/speed", legacy.Fields[1].FeaturePath)
+	})
+
+	t.Run("Should report a loosened schema as compatible", func(t *testing.T) {
+		code, report := check(twinType.ID, "1.1", "", pumpSchema(map[string]interface{}{"type": "number", "minimum": 0}, true))
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, report.Compatible)
+		assert.Empty(t, report.Breaking)
+
+		code, report = check(twinType.ID, "1.1", "", current)
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, report.Compatible)
+	})
+
+	t.Run("Should bound the sample", func(t *testing.T) {
+		code, report := check(twinType.ID, "2.0", "?sample=1", pumpSchema(map[string]interface{}{"type": "number"}, false))
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, int64(4), report.TotalTwins)
+		assert.Equal(t, 1, report.SampledTwins)
+
+		for _, sample := range []string{"501", "-1", "all"} {
+			code, _ = check(twinType.ID, "2.0", "?sample="+sample, current)
+			assert.Equal(t, http.StatusBadRequest, code, sample)
+		}
+	})
+
+	t.Run("Should reject invalid checks", func(t *testing.T) {
+		code, _ := check(twinType.ID, "1.0", "", current)
+		assert.Equal(t, http.StatusBadRequest, code, "the current version is not a new one")
+		code, _ = check(twinType.ID, "2.0", "", map[string]interface{}{"type": "number", "minimum": "zero"})
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = check(9999, "2.0", "", current)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
@@ -0,0 +1,144 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeFeatureMetadata(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.ModelBinding{}, &models.FeatureBinding{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+	controllers.NewTwinDetailController(
+		services.NewTwinDetailService(
+			twinService,
+			services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger),
+			services.NewProjectService(ts.DB, ts.Logger),
+			ts.Logger,
+		),
+		ts.Logger,
+	).RegisterRoutes(group.Group("/twins"))
+
+	headers := map[string]string{"Authorization": "Bearer " + ts.CreateTestAuthToken(ownerID, "owner@example.com", models.RoleUser)}
+	// A Ditto thing schema whose pump feature keeps its values under properties
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"features": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"temperature": map[string]interface{}{"type": "object"},
+					"pressure":    map[string]interface{}{"type": "object"},
+					"pump": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"properties": map[string]interface{}{
+								"type":       "object",
+								"properties": map[string]interface{}{"speed": map[string]interface{}{"type": "number"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	save := func(method, path string, metadata interface{}) (int, controllers.TwinTypeResponse, string) {
+		resp := ts.ExecuteRequest(method, path, map[string]interface{}{
+			"name": "Pump", "version": "1.0", "schema_json": schema, "feature_metadata": metadata,
+		}, headers)
+		var body controllers.TwinTypeResponse
+		if resp.Code < http.StatusMultipleChoices {
+			ts.ParseResponse(resp, &body)
+		}
+		return resp.Code, body, resp.Body.String()
+	}
+
+	code, twinType, raw := save("POST", "/api/v1/twin-types", []map[string]interface{}{
+		{"feature_path": "pump/speed", "order": 2, "group": "Drive", "icon": "gauge", "unit": "rpm", "min": 0, "max": 3000},
+		{"feature_path": "temperature", "order": 1, "group": "Process", "unit": "celsius", "min": -20, "max": 120},
+		{"feature_path": "pressure", "order": 1, "group": "Process"},
+	})
+	require.Equal(t, http.StatusCreated, code, raw)
+
+	t.Run("Should store feature metadata in display order", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twin-types/%d", twinType.ID), nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var body controllers.TwinTypeResponse
+		ts.ParseResponse(resp, &body)
+
+		require.Len(t, body.FeatureMetadata, 3)
+		paths := []string{body.FeatureMetadata[0].FeaturePath, body.FeatureMetadata[1].FeaturePath, body.FeatureMetadata[2].FeaturePath}
+		assert.Equal(t, []string{"pressure", "temperature", "pump/speed"}, paths)
+
+		temperature := body.FeatureMetadata[1]
+		assert.Equal(t, "Process", temperature.Group)
+		assert.Equal(t, "C", temperature.Unit, "registered units are stored by symbol")
+		require.NotNil(t, temperature.Min)
+		assert.Equal(t, float64(-20), *temperature.Min)
+
+		speed := body.FeatureMetadata[2]
+		assert.Equal(t, "rpm", speed.Unit)
+		assert.Equal(t, "gauge", speed.Icon)
+		require.NotNil(t, speed.Max)
+		assert.Equal(t, float64(3000), *speed.Max)
+		assert.Nil(t, body.FeatureMetadata[0].Min)
+	})
+
+	t.Run("Should reject metadata of features the schema does not declare", func(t *testing.T) {
+		path := fmt.Sprintf("/api/v1/twin-types/%d", twinType.ID)
+		for name, metadata := range map[string][]map[string]interface{}{
+			"unknown feature":  {{"feature_path": "humidity"}},
+			"unknown property": {{"feature_path": "pump/torque"}},
+			"empty path":       {{"feature_path": " "}},
+			"duplicate path":   {{"feature_path": "pressure"}, {"feature_path": "pressure", "order": 3}},
+			"inverted range":   {{"feature_path": "pressure", "min": 10, "max": 1}},
+		} {
+			code, _, body := save("PUT", path, metadata)
+			assert.Equal(t, http.StatusBadRequest, code, name)
+			assert.Contains(t, body, "invalid feature metadata", name)
+		}
+
+		// Metadata left unchanged is kept
+		code, body, raw := save("PUT", path, nil)
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Len(t, body.FeatureMetadata, 3)
+	})
+
+	t.Run("Should return the feature metadata of a twin's type with the twin's units", func(t *testing.T) {
+		repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+		project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+		require.NoError(t, repoFactory.Project().Create(project))
+		twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: ownerID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		require.NoError(t, twinService.SaveFeatureBinding(&models.FeatureBinding{TwinID: twin.ID, FeaturePath: "pressure", Unit: "bar"}))
+
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/detail?include=features", twin.ID), nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+		var body struct {
+			Features []models.FeatureMetadata `json:"features"`
+		}
+		ts.ParseResponse(resp, &body)
+
+		require.Len(t, body.Features, 3)
+		assert.Equal(t, "pressure", body.Features[0].FeaturePath)
+		assert.Equal(t, "bar", body.Features[0].Unit)
+		assert.Equal(t, "C", body.Features[1].Unit)
+	})
+}
@@ -0,0 +1,161 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeUpsert(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.TwinType{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+	headers := map[string]string{"Authorization": "Bearer " + ts.CreateTestAuthToken(ownerID, "owner@example.com", models.RoleUser)}
+
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"features": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"temperature": map[string]interface{}{"type": "object"}},
+			},
+		},
+	}
+	apply := func(body map[string]interface{}) (int, controllers.UpsertTwinTypeResponse, string) {
+		resp := ts.ExecuteRequest("PUT", "/api/v1/twin-types", body, headers)
+		var result controllers.UpsertTwinTypeResponse
+		if resp.Code < http.StatusMultipleChoices {
+			ts.ParseResponse(resp, &result)
+		}
+		return resp.Code, result, resp.Body.String()
+	}
+	sensor := func(version, description string, schema interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name": "Sensor", "version": version, "description": description, "schema_json": schema,
+			"primary_features": []string{"temperature"},
+		}
+	}
+	count := func() int64 {
+		var total int64
+		require.NoError(t, ts.DB.DB.Model(&models.TwinType{}).Count(&total).Error)
+		return total
+	}
+
+	code, created, raw := apply(sensor("1.0", "A sensor", schema))
+	require.Equal(t, http.StatusCreated, code, raw)
+
+	t.Run("Should create a twin type that does not exist", func(t *testing.T) {
+		assert.Equal(t, services.TwinTypeCreated, created.Result)
+		assert.NotZero(t, created.ID)
+		assert.Equal(t, "1.0", created.Version)
+		assert.Equal(t, ownerID, created.CreatedBy)
+		assert.Equal(t, []string{"temperature"}, created.PrimaryFeatures)
+	})
+
+	t.Run("Should leave a re-applied identical twin type unchanged", func(t *testing.T) {
+		// The same schema, formatted differently
+		code, body, raw := apply(sensor("1.0", "A sensor",
+			json.RawMessage(`{"properties": {"features": {"properties": {"temperature": {"type": "object"}}, "type": "object"}}, "type": "object"}`)))
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, services.TwinTypeUnchanged, body.Result)
+		assert.Equal(t, created.ID, body.ID)
+		assert.Equal(t, created.UpdatedAt, body.UpdatedAt)
+		assert.Equal(t, int64(1), count())
+	})
+
+	t.Run("Should update the mutable fields of an existing version", func(t *testing.T) {
+		code, body, raw := apply(sensor("1.0", "An environment sensor", schema))
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, services.TwinTypeUpdated, body.Result)
+		assert.Equal(t, created.ID, body.ID)
+		assert.Equal(t, "An environment sensor", body.Description)
+		assert.Equal(t, int64(1), count())
+	})
+
+	t.Run("Should save the retention of an existing version", func(t *testing.T) {
+		body := sensor("1.0", "An environment sensor", schema)
+		body["raw_retention_days"] = 30
+		body["aggregated_retention_days"] = 365
+		code, applied, raw := apply(body)
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, services.TwinTypeUpdated, applied.Result)
+
+		var stored models.TwinType
+		require.NoError(t, ts.DB.DB.First(&stored, created.ID).Error)
+		require.NotNil(t, stored.RawRetentionDays)
+		assert.Equal(t, 30, *stored.RawRetentionDays)
+		require.NotNil(t, stored.AggregatedRetentionDays)
+		assert.Equal(t, 365, *stored.AggregatedRetentionDays)
+
+		// Re-applying the saved retention changes nothing
+		code, applied, raw = apply(body)
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, services.TwinTypeUnchanged, applied.Result)
+	})
+
+	t.Run("Should reject a changed schema for an existing version", func(t *testing.T) {
+		changed := map[string]interface{}{"type": "object", "required": []string{"features"}}
+		code, _, raw := apply(sensor("1.0", "An environment sensor", changed))
+		assert.Equal(t, http.StatusConflict, code)
+		assert.Contains(t, raw, "twin type version conflict")
+
+		stored, err := services.NewTwinTypeService(ts.DB, ts.Logger).GetByID(created.ID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type": "object", "properties": {"features": {"type": "object", "properties": {"temperature": {"type": "object"}}}}}`,
+			string(stored.SchemaJSON))
+	})
+
+	t.Run("Should publish a schema change as a new version", func(t *testing.T) {
+		changed := map[string]interface{}{"type": "object", "required": []string{"features"}}
+		code, body, raw := apply(sensor("2.0", "An environment sensor", changed))
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, services.TwinTypeUpdated, body.Result)
+		assert.Equal(t, created.ID, body.ID)
+		assert.Equal(t, "2.0", body.Version)
+		assert.JSONEq(t, `{"type": "object", "required": ["features"]}`, string(body.SchemaJSON))
+		assert.Equal(t, int64(1), count())
+	})
+
+	t.Run("Should reject a version older than the stored one", func(t *testing.T) {
+		code, _, raw := apply(sensor("1.0", "A sensor", schema))
+		assert.Equal(t, http.StatusConflict, code)
+		assert.Contains(t, raw, "version 1.0 is not newer than the stored version 2.0")
+
+		stored, err := services.NewTwinTypeService(ts.DB, ts.Logger).GetByID(created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "2.0", stored.Version)
+		assert.Equal(t, "An environment sensor", stored.Description)
+	})
+
+	t.Run("Should compare versions numerically", func(t *testing.T) {
+		code, body, raw := apply(sensor("10.0", "An environment sensor", schema))
+		require.Equal(t, http.StatusOK, code, raw)
+		assert.Equal(t, "10.0", body.Version)
+
+		code, _, raw = apply(sensor("9.1", "An environment sensor", schema))
+		assert.Equal(t, http.StatusConflict, code, raw)
+		code, _, raw = apply(sensor("v10.0.0", "An environment sensor", schema))
+		assert.Equal(t, http.StatusConflict, code, raw)
+	})
+
+	t.Run("Should validate the applied twin type", func(t *testing.T) {
+		body := sensor("11.0", "", schema)
+		body["feature_metadata"] = []map[string]interface{}{{"feature_path": "humidity"}}
+		code, _, raw := apply(body)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, raw, "invalid feature metadata")
+	})
+}
@@ -0,0 +1,97 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeValidateSchema(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1"))
+
+	validate := func(body interface{}) (int, utils.SchemaCheck) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/twin-types/validate", body, nil)
+		var check utils.SchemaCheck
+		if resp.Code == http.StatusOK {
+			ts.ParseResponse(resp, &check)
+		}
+		return resp.Code, check
+	}
+	pumpSchema := map[string]interface{}{
+		"$schema":  "http://json-schema.org/draft-07/schema#",
+		"type":     "object",
+		"required": []string{"pressure"},
+		"properties": map[string]interface{}{
+			"pressure": map[string]interface{}{"type": "number", "minimum": 0},
+		},
+	}
+
+	t.Run("Should accept a valid schema", func(t *testing.T) {
+		code, check := validate(map[string]interface{}{"schema_json": pumpSchema})
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, check.Valid)
+		assert.Empty(t, check.Errors)
+	})
+
+	t.Run("Should locate the syntax error of malformed JSON", func(t *testing.T) {
+		code, check := validate(map[string]interface{}{"schema_json": "{\n  \"type\": \"object\",\n  \"properties\": {,}\n}"})
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, check.Valid)
+		require.Len(t, check.Errors, 1)
+		assert.Equal(t, 3, check.Errors[0].Line)
+		assert.Equal(t, 18, check.Errors[0].Column)
+		assert.Contains(t, check.Errors[0].Message, "malformed JSON")
+	})
+
+	t.Run("Should report where a schema breaks the draft", func(t *testing.T) {
+		code, check := validate(map[string]interface{}{"schema_json": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"pressure": map[string]interface{}{"type": "decimal"},
+			},
+			"required": "pressure",
+		}})
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, check.Valid)
+
+		locations := make([]string, 0, len(check.Errors))
+		for _, schemaErr := range check.Errors {
+			locations = append(locations, schemaErr.Location)
+			assert.NotEmpty(t, schemaErr.Message)
+		}
+		assert.Contains(t, locations, "/properties/pressure/type")
+		assert.Contains(t, locations, "/required")
+	})
+
+	t.Run("Should validate a sample instance against the schema", func(t *testing.T) {
+		code, check := validate(map[string]interface{}{"schema_json": pumpSchema, "instance": map[string]interface{}{"pressure": 4.2}})
+		require.Equal(t, http.StatusOK, code)
+		assert.True(t, check.Valid)
+
+		code, check = validate(map[string]interface{}{"schema_json": pumpSchema, "instance": map[string]interface{}{"pressure": -1}})
+		require.Equal(t, http.StatusOK, code)
+		assert.False(t, check.Valid)
+		assert.Empty(t, check.Errors)
+		require.Len(t, check.InstanceErrors, 1)
+		assert.Equal(t, "/pressure", check.InstanceErrors[0].Location)
+
+		_, check = validate(map[string]interface{}{"schema_json": pumpSchema, "instance": "{\"pressure\": }"})
+		assert.False(t, check.Valid)
+		require.Len(t, check.InstanceErrors, 1)
+		assert.Contains(t, check.InstanceErrors[0].Message, "malformed JSON")
+	})
+
+	t.Run("Should require a schema", func(t *testing.T) {
+		code, _ := validate(map[string]interface{}{"instance": map[string]interface{}{}})
+		assert.Equal(t, http.StatusUnprocessableEntity, code)
+	})
+}
@@ -0,0 +1,106 @@
+package controllers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryUnitConversion(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Unit Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Boiler", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Boiler 1", DittoID: "org.digitalegiz.project1:boiler-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	require.NoError(t, twinService.SaveFeatureBinding(&models.FeatureBinding{TwinID: twin.ID, FeaturePath: "temperature", Unit: "celsius"}))
+
+	for i, value := range []float64{100, 20} {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time:        time.Now().Add(-time.Duration(i) * time.Minute),
+			TwinID:      twin.DittoID,
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    value,
+			Source:      services.SourceHTTP,
+		}))
+	}
+
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
+	controllers.NewHistoryController(historyService, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/twins/:id/history"))
+
+	// The time column is left out since sqlite does not scan timestamptz values
+	type response struct {
+		Data []map[string]interface{} `json:"data"`
+		Meta map[string]interface{}   `json:"meta"`
+	}
+	query := func(feature, params string) (int, response) {
+		resp := ts.ExecuteRequest("GET", fmt.Sprintf("/api/v1/twins/%d/history/timeseries?feature_path=%s&fields=value_num&order=desc%s", twin.ID, feature, params), nil, nil)
+		var body response
+		ts.ParseResponse(resp, &body)
+		return resp.Code, body
+	}
+
+	t.Run("Should store the normalized unit on the feature binding", func(t *testing.T) {
+		binding, err := repoFactory.Twin().GetFeatureBinding(twin.ID, "temperature")
+		require.NoError(t, err)
+		assert.Equal(t, "C", binding.Unit)
+
+		err = twinService.SaveFeatureBinding(&models.FeatureBinding{TwinID: twin.ID, FeaturePath: "pressure", Unit: "furlongs"})
+		assert.Error(t, err)
+	})
+
+	t.Run("Should return stored values without convert", func(t *testing.T) {
+		code, body := query("temperature", "")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Data, 2)
+		assert.Equal(t, float64(100), body.Data[0]["value_num"])
+		assert.NotContains(t, body.Meta, "unit")
+	})
+
+	t.Run("Should convert Celsius to Fahrenheit and back", func(t *testing.T) {
+		code, body := query("temperature", "&convert=F")
+		require.Equal(t, http.StatusOK, code)
+		require.Len(t, body.Data, 2)
+		assert.InDelta(t, 212, body.Data[0]["value_num"], 1e-9)
+		assert.InDelta(t, 68, body.Data[1]["value_num"], 1e-9)
+		assert.Equal(t, "F", body.Meta["unit"])
+
+		code, body = query("temperature", "&convert=C")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(100), body.Data[0]["value_num"])
+
+		// Repeated reads come from the cache, which must hold the stored values
+		code, body = query("temperature", "")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, float64(100), body.Data[0]["value_num"])
+	})
+
+	t.Run("Should reject conversions incompatible with the feature's unit", func(t *testing.T) {
+		code, _ := query("temperature", "&convert=psi")
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = query("temperature", "&convert=lightyears")
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = query("humidity", "&convert=F")
+		assert.Equal(t, http.StatusBadRequest, code, "features without a unit cannot be converted")
+	})
+}
@@ -0,0 +1,73 @@
+package controllers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/digital-egiz/backend/internal/utils"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthController_ValidationErrors(t *testing.T) {
+	// Setup test environment
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{})
+
+	// Create auth controller
+	userService := services.NewUserService(ts.DB, ts.Logger)
+	authController := controllers.NewAuthController(userService, &ts.Config.JWT, ts.Logger)
+	authController.RegisterRoutes(ts.Router.Group("/api/v1"))
+
+	t.Run("Should return field error for missing required field", func(t *testing.T) {
+		// Register request without last_name
+		resp := ts.ExecuteRequest("POST", "/api/v1/auth/register", map[string]interface{}{
+			"email":      "validation@example.com",
+			"password":   "securePassword123",
+			"first_name": "Test",
+		}, nil)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+		var response utils.ValidationErrorResponse
+		ts.ParseResponse(resp, &response)
+
+		assert.Equal(t, "Validation failed", response.Error)
+		assert.Equal(t, []utils.ValidationError{{
+			Field:   "last_name",
+			Rule:    "required",
+			Message: "This field is required",
+		}}, response.Errors)
+	})
+
+	t.Run("Should return field error for too short password", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/auth/register", map[string]interface{}{
+			"email":      "validation@example.com",
+			"password":   "short",
+			"first_name": "Test",
+			"last_name":  "User",
+		}, nil)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+		var response utils.ValidationErrorResponse
+		ts.ParseResponse(resp, &response)
+
+		assert.Equal(t, []utils.ValidationError{{
+			Field:   "password",
+			Rule:    "min",
+			Message: "Must be at least 8 characters long",
+		}}, response.Errors)
+	})
+
+	t.Run("Should return 400 for malformed JSON", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/auth/login", "not-an-object", nil)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+	})
+}
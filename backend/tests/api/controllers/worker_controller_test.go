@@ -0,0 +1,230 @@
+package controllers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerController(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	// The hourly worker only runs when triggered during the test, failing its first run
+	var hourlyRuns, frequentRuns atomic.Int64
+	hourly := lifecycle.NewScheduledWorker("hourly", time.Hour, func(ctx context.Context) error {
+		if hourlyRuns.Add(1) == 1 {
+			return errors.New("archive unavailable")
+		}
+		return nil
+	})
+	frequent := lifecycle.NewScheduledWorker("frequent", 10*time.Millisecond, func(ctx context.Context) error {
+		frequentRuns.Add(1)
+		return nil
+	})
+	disabled := lifecycle.NewScheduledWorker("disabled", 0, func(ctx context.Context) error { return nil })
+
+	registry := lifecycle.NewRegistry(ts.Logger)
+	registry.Register(
+		&lifecycle.Hook{ComponentName: "connections"},
+		hourly,
+		frequent,
+		disabled,
+	)
+	require.NoError(t, registry.Start(context.Background()))
+	defer registry.Stop(context.Background())
+
+	controllers.NewWorkerController(registry, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/admin"))
+
+	status := func(name string) lifecycle.WorkerStatus {
+		resp := ts.ExecuteRequest("GET", "/api/v1/admin/workers", nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var body struct {
+			Data []lifecycle.WorkerStatus `json:"data"`
+		}
+		ts.ParseResponse(resp, &body)
+		for _, worker := range body.Data {
+			if worker.Name == name {
+				return worker
+			}
+		}
+		t.Fatalf("worker %s not listed", name)
+		return lifecycle.WorkerStatus{}
+	}
+	post := func(name, action string) int {
+		return ts.ExecuteRequest("POST", "/api/v1/admin/workers/"+name+"/"+action, nil, nil).Code
+	}
+
+	t.Run("Should list the workers of the registry", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/admin/workers", nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var body struct {
+			Data []lifecycle.WorkerStatus `json:"data"`
+		}
+		ts.ParseResponse(resp, &body)
+		require.Len(t, body.Data, 3, "components that are not workers are not listed")
+		assert.Equal(t, "hourly", body.Data[0].Name)
+		assert.Equal(t, lifecycle.WorkerIdle, body.Data[0].State)
+		assert.Equal(t, int64(3600), body.Data[0].IntervalSeconds)
+		assert.Nil(t, body.Data[0].LastRun)
+		require.NotNil(t, body.Data[0].NextRun)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *body.Data[0].NextRun, time.Minute)
+		assert.Equal(t, lifecycle.WorkerDisabled, body.Data[2].State)
+	})
+
+	t.Run("Should run a triggered worker", func(t *testing.T) {
+		assert.Equal(t, http.StatusAccepted, post("hourly", "trigger"))
+		require.Eventually(t, func() bool { return status("hourly").Runs == 1 }, time.Second, 5*time.Millisecond)
+		assert.Equal(t, int64(1), hourlyRuns.Load())
+
+		worker := status("hourly")
+		require.NotNil(t, worker.LastRun)
+		assert.WithinDuration(t, time.Now(), *worker.LastRun, time.Second)
+		assert.Equal(t, "archive unavailable", worker.LastError)
+
+		// A successful run clears the error
+		assert.Equal(t, http.StatusAccepted, post("hourly", "trigger"))
+		require.Eventually(t, func() bool { return status("hourly").Runs == 2 }, time.Second, 5*time.Millisecond)
+		assert.Empty(t, status("hourly").LastError)
+	})
+
+	t.Run("Should skip the scheduled runs of a paused worker", func(t *testing.T) {
+		require.Eventually(t, func() bool { return frequentRuns.Load() > 0 }, time.Second, 5*time.Millisecond)
+
+		assert.Equal(t, http.StatusOK, post("frequent", "pause"))
+		// Let a run in progress when pausing finish
+		require.Eventually(t, func() bool { return status("frequent").State == lifecycle.WorkerPaused }, time.Second, time.Millisecond)
+		paused := frequentRuns.Load()
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, paused, frequentRuns.Load())
+
+		worker := status("frequent")
+		assert.True(t, worker.Paused)
+		assert.Nil(t, worker.NextRun)
+
+		// Paused workers still run on demand
+		assert.Equal(t, http.StatusAccepted, post("frequent", "trigger"))
+		require.Eventually(t, func() bool { return frequentRuns.Load() == paused+1 }, time.Second, 5*time.Millisecond)
+
+		assert.Equal(t, http.StatusOK, post("frequent", "resume"))
+		require.Eventually(t, func() bool { return frequentRuns.Load() > paused+2 }, time.Second, 5*time.Millisecond)
+		assert.False(t, status("frequent").Paused)
+	})
+
+	t.Run("Should reject unknown and disabled workers", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, post("connections", "trigger"))
+		assert.Equal(t, http.StatusNotFound, post("missing", "pause"))
+		assert.Equal(t, http.StatusConflict, post("disabled", "trigger"))
+	})
+}
+
+func TestWorkerController_ServiceWorkers(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.NotificationRecord{}, &models.MLBackfillJob{})
+
+	kafkaCfg := &config.KafkaConfig{DLQAlertThreshold: 3, DLQAlertWindow: 60}
+	history := services.NewNotificationHistory(ts.DB, &config.NotificationConfig{
+		HistoryTypes:         []string{"system_event"},
+		HistoryBatchSize:     1,
+		HistoryFlushInterval: int(time.Hour / time.Millisecond),
+	}, ts.Logger)
+	notifications := services.NewNotificationService(nil, ts.Logger)
+	defer notifications.Close()
+	notifications.SetHistory(history)
+	dittoCfg := &config.DittoConfig{WritebackEnabled: true, WritebackInterval: 1}
+
+	// Workers driven by events or by their own loops are listed alongside the scheduled ones
+	registry := lifecycle.NewRegistry(ts.Logger)
+	registry.Register(
+		kafka.NewDLQReprocessor(nil, kafkaCfg, ts.Logger),
+		kafka.NewConsumerMonitor(nil, kafkaCfg, nil, ts.Logger),
+		kafka.NewDLQWatcher(kafkaCfg, nil, ts.Logger),
+		history,
+		services.NewWritebackService(ts.DB, dittoCfg, ditto.NewManager(dittoCfg, ts.Logger), ts.Logger),
+		services.NewMLBackfillService(ts.DB, ts.Logger),
+	)
+	require.NoError(t, registry.Start(context.Background()))
+	defer registry.Stop(context.Background())
+
+	controllers.NewWorkerController(registry, ts.Logger).RegisterRoutes(ts.Router.Group("/api/v1/admin"))
+
+	list := func() map[string]lifecycle.WorkerStatus {
+		resp := ts.ExecuteRequest("GET", "/api/v1/admin/workers", nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		var body struct {
+			Data []lifecycle.WorkerStatus `json:"data"`
+		}
+		ts.ParseResponse(resp, &body)
+		workers := make(map[string]lifecycle.WorkerStatus, len(body.Data))
+		for _, worker := range body.Data {
+			workers[worker.Name] = worker
+		}
+		return workers
+	}
+	post := func(name, action string) int {
+		return ts.ExecuteRequest("POST", "/api/v1/admin/workers/"+name+"/"+action, nil, nil).Code
+	}
+	stored := func() int64 {
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.NotificationRecord{}).Count(&count).Error)
+		return count
+	}
+
+	t.Run("Should list the workers running their own loops", func(t *testing.T) {
+		workers := list()
+		require.Len(t, workers, 6)
+		assert.Equal(t, lifecycle.WorkerDisabled, workers["dlq-reprocessor"].State)
+		assert.Equal(t, lifecycle.WorkerDisabled, workers["kafka-consumer-monitor"].State)
+		assert.Equal(t, lifecycle.WorkerIdle, workers["dlq-watcher"].State)
+		assert.Equal(t, int64(10), workers["dlq-watcher"].IntervalSeconds)
+		assert.Equal(t, lifecycle.WorkerIdle, workers["notification-history"].State)
+		assert.NotNil(t, workers["notification-history"].NextRun)
+		assert.Equal(t, lifecycle.WorkerIdle, workers["ml-writeback"].State)
+		assert.Equal(t, lifecycle.WorkerIdle, workers["ml-backfill"].State)
+	})
+
+	t.Run("Should run a triggered loop worker", func(t *testing.T) {
+		assert.Equal(t, http.StatusAccepted, post("dlq-watcher", "trigger"))
+		require.Eventually(t, func() bool { return list()["dlq-watcher"].Runs == 1 }, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("Should hold notifications while the history is paused", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, post("notification-history", "pause"))
+		notifications.Notify(services.NotificationTypeSystemEvent, "kafka/consumers/ingest", map[string]interface{}{"status": "failing"})
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, int64(0), stored())
+		assert.Equal(t, lifecycle.WorkerPaused, list()["notification-history"].State)
+
+		// Triggering writes the queued notifications, even while paused
+		assert.Equal(t, http.StatusAccepted, post("notification-history", "trigger"))
+		require.Eventually(t, func() bool { return stored() == 1 }, time.Second, 5*time.Millisecond)
+		worker := list()["notification-history"]
+		assert.Equal(t, int64(1), worker.Runs)
+		require.NotNil(t, worker.LastRun)
+
+		assert.Equal(t, http.StatusOK, post("notification-history", "resume"))
+		notifications.Notify(services.NotificationTypeSystemEvent, "kafka/consumers/ingest", map[string]interface{}{"status": "ok"})
+		require.Eventually(t, func() bool { return stored() == 2 }, 5*time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("Should reject triggering workers that only run on request", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, post("ml-backfill", "trigger"))
+		assert.Equal(t, http.StatusConflict, post("dlq-reprocessor", "trigger"))
+	})
+}
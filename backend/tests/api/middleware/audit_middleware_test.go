@@ -0,0 +1,56 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.AuditEntry{})
+	auditService := services.NewAuditService(ts.DB, &config.AuditConfig{Enabled: true, SigningKey: "audit-test-key"}, nil, ts.Logger)
+
+	// Stands in for RequireAuth
+	authenticated := func(c *gin.Context) {
+		c.Set("user_id", uint(42))
+		c.Next()
+	}
+	group := ts.Router.Group("/api/v1", authenticated, middleware.AuditMiddleware(auditService))
+	group.GET("/twins/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	group.PUT("/twins/:id", func(c *gin.Context) { c.Status(http.StatusForbidden) })
+
+	t.Run("Should not record reads", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/twins/1", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.AuditEntry{}).Count(&count).Error)
+		assert.Zero(t, count)
+	})
+
+	t.Run("Should record mutating requests with the user and outcome", func(t *testing.T) {
+		resp := ts.ExecuteRequest("PUT", "/api/v1/twins/1", map[string]string{"name": "Pump"}, nil)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+
+		var entries []models.AuditEntry
+		require.NoError(t, ts.DB.DB.Find(&entries).Error)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "PUT", entries[0].Method)
+		assert.Equal(t, "/api/v1/twins/1", entries[0].Path)
+		assert.Equal(t, http.StatusForbidden, entries[0].Status)
+		require.NotNil(t, entries[0].UserID)
+		assert.Equal(t, uint(42), *entries[0].UserID)
+		assert.Equal(t, entries[0].ComputeHash(), entries[0].Hash)
+	})
+}
@@ -0,0 +1,119 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/controllers"
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheControlMiddleware(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.TwinType{})
+	userID := ts.SeedTestUser("user@example.com", "password123", false)
+	headers := map[string]string{"Authorization": "Bearer " + ts.CreateTestAuthToken(userID, "user@example.com", models.RoleUser)}
+
+	ts.Config.Server.CacheControl = map[string]int{
+		"/api/v1/twin-types":    60,
+		"/api/v1/model-formats": 3600,
+		"/api/v1/users/me":      -1,
+		"/public":               0,
+	}
+	ts.Router.Use(middleware.CacheControlMiddleware(&ts.Config.Server))
+
+	group := ts.Router.Group("/api/v1", middleware.NewAuthMiddleware(&ts.Config.JWT).RequireAuth())
+	controllers.NewTwinTypeController(services.NewTwinTypeService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+	controllers.NewUserController(services.NewUserService(ts.DB, ts.Logger), ts.Logger).RegisterRoutes(group)
+	controllers.NewModelFormatController(ts.Logger).RegisterRoutes(group)
+	version := "1"
+	ts.Router.GET("/public/version", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": version})
+	})
+
+	t.Run("Should let clients cache the twin type list for a minute", func(t *testing.T) {
+		before := time.Now().UTC().Truncate(time.Second)
+		resp := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		assert.Equal(t, "private, max-age=60", resp.Header().Get("Cache-Control"))
+		expires, err := http.ParseTime(resp.Header().Get("Expires"))
+		require.NoError(t, err)
+		assert.WithinDuration(t, before.Add(time.Minute), expires, 2*time.Second)
+		assert.NotEmpty(t, resp.Header().Get("ETag"))
+		assert.Contains(t, resp.Body.String(), "twin_types")
+	})
+
+	t.Run("Should cache the model format list for longer", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/model-formats", nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "private, max-age=3600", resp.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Should never store the current user", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/users/me", nil, headers)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "no-store", resp.Header().Get("Cache-Control"))
+		assert.Equal(t, "Thu, 01 Jan 1970 00:00:00 GMT", resp.Header().Get("Expires"))
+		assert.Empty(t, resp.Header().Get("ETag"))
+	})
+
+	t.Run("Should answer a matching If-None-Match with 304", func(t *testing.T) {
+		first := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, headers)
+		etag := first.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+
+		revalidate := map[string]string{"Authorization": headers["Authorization"], "If-None-Match": etag}
+		resp := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, revalidate)
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+		assert.Empty(t, resp.Body.String())
+		assert.Equal(t, etag, resp.Header().Get("ETag"))
+		assert.Equal(t, "private, max-age=60", resp.Header().Get("Cache-Control"))
+
+		// A new twin type changes the list and its ETag
+		require.NoError(t, ts.DB.DB.Create(&models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID}).Error)
+		resp = ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, revalidate)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.NotEqual(t, etag, resp.Header().Get("ETag"))
+		assert.Contains(t, resp.Body.String(), "Pump")
+	})
+
+	t.Run("Should make unauthenticated responses cacheable by shared caches", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/public/version", nil, nil)
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "public, no-cache", resp.Header().Get("Cache-Control"))
+		etag := resp.Header().Get("ETag")
+
+		resp = ts.ExecuteRequest("GET", "/public/version", nil, map[string]string{"If-None-Match": `"other", ` + etag})
+		assert.Equal(t, http.StatusNotModified, resp.Code)
+
+		version = "2"
+		resp = ts.ExecuteRequest("GET", "/public/version", nil, map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"version": "2"}`, resp.Body.String())
+	})
+
+	t.Run("Should not cache failed or unsafe requests", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, nil)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+		assert.Empty(t, resp.Header().Get("Cache-Control"))
+		assert.Empty(t, resp.Header().Get("ETag"))
+
+		resp = ts.ExecuteRequest("GET", "/api/v1/twin-types/999", nil, headers)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+		assert.Empty(t, resp.Header().Get("Cache-Control"))
+		assert.Contains(t, resp.Body.String(), "Twin type not found")
+
+		resp = ts.ExecuteRequest("POST", "/api/v1/twin-types", map[string]interface{}{"name": "Valve"}, headers)
+		assert.Empty(t, resp.Header().Get("Cache-Control"))
+	})
+}
@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Create matcher with exact and wildcard origins
+	matcher := middleware.NewOriginMatcher([]string{
+		"https://app.acme.dev",
+		"https://*.preview.acme.dev",
+	})
+
+	router := gin.New()
+	router.Use(middleware.CORSMiddleware(matcher))
+	router.GET("/resource", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "https://api.acme.dev/resource", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("Should allow credentials for exact origin match", func(t *testing.T) {
+		resp := request("GET", "https://app.acme.dev")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "https://app.acme.dev", resp.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", resp.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("Should allow wildcard origin match without credentials", func(t *testing.T) {
+		resp := request("GET", "https://pr-42.preview.acme.dev")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "https://pr-42.preview.acme.dev", resp.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("Should answer preflight for allowed origin", func(t *testing.T) {
+		resp := request("OPTIONS", "https://pr-42.preview.acme.dev")
+
+		assert.Equal(t, http.StatusNoContent, resp.Code)
+		assert.Contains(t, resp.Header().Get("Access-Control-Allow-Methods"), "PATCH")
+	})
+
+	t.Run("Should reject non-matching origins", func(t *testing.T) {
+		for _, origin := range []string{
+			"https://evil.dev",
+			"https://app.acme.dev.evil.dev",
+			"https://a.b.preview.acme.dev",
+			"http://pr-42.preview.acme.dev",
+		} {
+			resp := request("GET", origin)
+
+			assert.Equal(t, http.StatusForbidden, resp.Code, origin)
+			assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+	})
+
+	t.Run("Should pass through same-origin requests", func(t *testing.T) {
+		for _, origin := range []string{"https://api.acme.dev", "http://API.acme.dev"} {
+			resp := request("GET", origin)
+
+			assert.Equal(t, http.StatusOK, resp.Code, origin)
+			assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"), origin)
+		}
+
+		resp := request("GET", "https://api.acme.dev:8443")
+		assert.Equal(t, http.StatusForbidden, resp.Code, "a different port is another origin")
+	})
+
+	t.Run("Should pass through requests without origin", func(t *testing.T) {
+		resp := request("GET", "")
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestOriginMatcher_CheckOrigin(t *testing.T) {
+	matcher := middleware.NewOriginMatcher([]string{"https://*.preview.acme.dev", "http://localhost:*"})
+
+	check := func(origin string) bool {
+		req := httptest.NewRequest("GET", "https://api.acme.dev/api/v1/ws", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		return matcher.CheckOrigin(req)
+	}
+
+	t.Run("Should accept matching websocket origins", func(t *testing.T) {
+		assert.True(t, check("https://feature-x.preview.acme.dev"))
+		assert.True(t, check("http://localhost:5173"))
+		assert.True(t, check(""))
+		assert.True(t, check("https://api.acme.dev"), "same origin")
+	})
+
+	t.Run("Should reject non-matching websocket origins", func(t *testing.T) {
+		assert.False(t, check("https://preview.acme.dev"))
+		assert.False(t, check("http://localhost.evil.dev:80"))
+	})
+}
@@ -0,0 +1,44 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeprecationMiddleware(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	since := time.Date(2026, time.October, 14, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.January, 14, 0, 0, 0, 0, time.UTC)
+
+	ts.Router.GET("/old/items", middleware.DeprecationMiddleware(middleware.Deprecation{
+		Since:     since,
+		Sunset:    sunset,
+		Successor: func(path string) string { return "/new" + path },
+	}), func(c *gin.Context) { c.Status(http.StatusOK) })
+	ts.Router.GET("/legacy", middleware.DeprecationMiddleware(middleware.Deprecation{}), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	t.Run("Should send the deprecation, sunset and successor headers", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/old/items", nil, nil)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "@1791936000", resp.Header().Get("Deprecation"))
+		assert.Equal(t, "Thu, 14 Jan 2027 00:00:00 GMT", resp.Header().Get("Sunset"))
+		assert.Equal(t, `</new/old/items>; rel="successor-version"`, resp.Header().Get("Link"))
+	})
+
+	t.Run("Should only mark the route deprecated without dates or successor", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/legacy", nil, nil)
+
+		assert.Equal(t, "true", resp.Header().Get("Deprecation"))
+		assert.Empty(t, resp.Header().Get("Sunset"))
+		assert.Empty(t, resp.Header().Get("Link"))
+	})
+}
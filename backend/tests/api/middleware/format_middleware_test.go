@@ -0,0 +1,139 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ugorji/go/codec"
+)
+
+// samplePoint is a response value with the field kinds of time-series data
+type samplePoint struct {
+	Time     time.Time `json:"time"`
+	TwinID   string    `json:"twin_id"`
+	ValueNum float64   `json:"value_num,omitempty"`
+	ValueStr string    `json:"value_str,omitempty"`
+	Flag     *bool     `json:"flag,omitempty"`
+	Internal string    `json:"-"`
+}
+
+type sampleResponse struct {
+	Data []samplePoint          `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
+func TestResponseFormatMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	flag := true
+	at := time.Date(2026, 3, 1, 12, 30, 15, 250_000_000, time.UTC)
+	response := sampleResponse{
+		Data: []samplePoint{
+			{Time: at, TwinID: "org.digitalegiz.project1:pump-1", ValueNum: 21.5, Internal: "secret"},
+			{Time: at.Add(time.Second), TwinID: "org.digitalegiz.project1:pump-1", ValueStr: "running", Flag: &flag},
+		},
+		Meta: map[string]interface{}{"count": 2, "feature_path": "temperature"},
+	}
+
+	newRouter := func(cfg *config.ServerConfig) *gin.Engine {
+		router := gin.New()
+		router.Use(middleware.ResponseFormatMiddleware(cfg))
+		router.GET("/points", func(c *gin.Context) {
+			utils.Render(c, http.StatusOK, response)
+		})
+		return router
+	}
+	router := newRouter(&config.ServerConfig{MsgPackEnabled: true})
+
+	get := func(router *gin.Engine, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/points", nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	decodeMsgPack := func(t *testing.T, data []byte, target interface{}) {
+		handle := &codec.MsgpackHandle{}
+		handle.RawToString = true
+		handle.TypeInfos = codec.NewTypeInfos([]string{"json"})
+		require.NoError(t, codec.NewDecoderBytes(data, handle).Decode(target))
+	}
+
+	t.Run("Should respond with JSON by default", func(t *testing.T) {
+		for _, accept := range []string{"", "*/*", "application/json", "text/html"} {
+			w := get(router, accept)
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), "application/json", accept)
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+		}
+	})
+
+	t.Run("Should respond with equivalent MessagePack when requested", func(t *testing.T) {
+		jsonResp := get(router, "application/json")
+		var fromJSON sampleResponse
+		require.NoError(t, json.Unmarshal(jsonResp.Body.Bytes(), &fromJSON))
+
+		msgpackResp := get(router, "application/msgpack")
+		require.Equal(t, http.StatusOK, msgpackResp.Code)
+		assert.Equal(t, "application/msgpack", msgpackResp.Header().Get("Content-Type"))
+		assert.Less(t, msgpackResp.Body.Len(), jsonResp.Body.Len())
+
+		var fromMsgPack sampleResponse
+		decodeMsgPack(t, msgpackResp.Body.Bytes(), &fromMsgPack)
+
+		require.Len(t, fromMsgPack.Data, 2)
+		for i := range fromJSON.Data {
+			assert.True(t, fromJSON.Data[i].Time.Equal(fromMsgPack.Data[i].Time))
+			fromMsgPack.Data[i].Time = fromJSON.Data[i].Time
+		}
+		assert.Equal(t, fromJSON.Data, fromMsgPack.Data)
+		assert.Empty(t, fromMsgPack.Data[0].Internal)
+		assert.EqualValues(t, 2, fromMsgPack.Meta["count"])
+		assert.Equal(t, "temperature", fromMsgPack.Meta["feature_path"])
+
+		// The same keys are present in both encodings
+		var jsonDoc, msgpackDoc struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(jsonResp.Body.Bytes(), &jsonDoc))
+		decodeMsgPack(t, msgpackResp.Body.Bytes(), &msgpackDoc)
+		for i := range jsonDoc.Data {
+			assert.ElementsMatch(t, keys(jsonDoc.Data[i]), keys(msgpackDoc.Data[i]))
+		}
+	})
+
+	t.Run("Should honour Accept quality values", func(t *testing.T) {
+		w := get(router, "application/json;q=0.5, application/x-msgpack")
+		assert.Equal(t, "application/msgpack", w.Header().Get("Content-Type"))
+
+		w = get(router, "application/msgpack;q=0.2, application/json")
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	})
+
+	t.Run("Should keep JSON when MessagePack is disabled", func(t *testing.T) {
+		w := get(newRouter(&config.ServerConfig{}), "application/msgpack")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+		assert.Empty(t, w.Header().Get("Vary"))
+	})
+}
+
+func keys(m map[string]interface{}) []string {
+	var result []string
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, err := utils.NewLogger(&config.LogConfig{Level: "error", Format: "console", OutputPath: "stdout"})
+	require.NoError(t, err)
+
+	cfg := &config.ServerConfig{
+		RequestTimeout: 1,
+		RouteTimeouts:  map[string]int{"/unbounded": 0},
+	}
+
+	queryCanceled := make(chan bool, 1)
+
+	router := gin.New()
+	router.Use(middleware.TimeoutMiddleware(cfg, logger))
+	router.GET("/fast", func(c *gin.Context) {
+		c.Header("X-Handler", "fast")
+		c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	})
+	router.GET("/slow-query", func(c *gin.Context) {
+		// Stands in for a query that honours the request context
+		select {
+		case <-c.Request.Context().Done():
+			queryCanceled <- true
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
+		case <-time.After(5 * time.Second):
+			queryCanceled <- false
+			c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		}
+	})
+	router.GET("/slow-handler", func(c *gin.Context) {
+		time.Sleep(1500 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	router.GET("/unbounded", func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": hasDeadline})
+	})
+
+	request := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	t.Run("Should pass fast responses through", func(t *testing.T) {
+		resp := request("/fast", nil)
+
+		assert.Equal(t, http.StatusCreated, resp.Code)
+		assert.Equal(t, "fast", resp.Header().Get("X-Handler"))
+		assert.JSONEq(t, `{"status":"ok"}`, resp.Body.String())
+	})
+
+	t.Run("Should cancel the request context and return 504", func(t *testing.T) {
+		started := time.Now()
+		resp := request("/slow-query", nil)
+
+		assert.Equal(t, http.StatusGatewayTimeout, resp.Code)
+		assert.JSONEq(t, `{"error":"Request exceeded the time limit of 1s"}`, resp.Body.String())
+		assert.True(t, <-queryCanceled)
+		assert.Less(t, time.Since(started), 3*time.Second)
+	})
+
+	t.Run("Should return 504 when the handler ignores cancellation", func(t *testing.T) {
+		resp := request("/slow-handler", nil)
+
+		assert.Equal(t, http.StatusGatewayTimeout, resp.Code)
+		assert.Contains(t, resp.Body.String(), "time limit")
+	})
+
+	t.Run("Should not time out routes with the timeout disabled", func(t *testing.T) {
+		resp := request("/unbounded", nil)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `{"deadline":false}`, resp.Body.String())
+	})
+
+	t.Run("Should not time out websocket upgrades", func(t *testing.T) {
+		resp := request("/slow-handler", http.Header{"Upgrade": {"websocket"}})
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+}
+
+func TestTimeoutMiddleware_StreamedExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	logger, err := utils.NewLogger(&config.LogConfig{Level: "error", Format: "console", OutputPath: "stdout"})
+	require.NoError(t, err)
+
+	for name, configPath := range map[string]string{
+		"defaults":       t.TempDir(),
+		"shipped config": "../../../config",
+	} {
+		t.Run("Should not cut off a slow export with the "+name, func(t *testing.T) {
+			cfg, err := config.LoadConfig(configPath)
+			require.NoError(t, err)
+			cfg.Server.RequestTimeout = 1
+
+			router := gin.New()
+			router.Use(middleware.TimeoutMiddleware(&cfg.Server, logger))
+			router.GET("/api/v1/twins/:id/history/export", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+				// Rows keep coming after the request timeout has passed
+				for i := 0; i < 6; i++ {
+					if c.Request.Context().Err() != nil {
+						return
+					}
+					_, _ = c.Writer.WriteString("row\n")
+					c.Writer.Flush()
+					time.Sleep(250 * time.Millisecond)
+				}
+			})
+
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, httptest.NewRequest("GET", "/api/v1/twins/1/history/export", nil))
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, strings.Repeat("row\n", 6), resp.Body.String())
+		})
+	}
+}
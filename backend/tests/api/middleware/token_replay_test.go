@@ -0,0 +1,146 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/api/middleware"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddleware_ReplayProtection(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TokenSighting{})
+
+	const laptop = "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"
+	const attacker = "curl/8.5.0"
+
+	// Two instances behind a load balancer share the sightings through the database
+	newInstance := func(mode string) *gin.Engine {
+		jwtConfig := &config.JWTConfig{Secret: "test-secret-key", ExpirationHours: 1, ReplayProtection: mode}
+		authMiddleware := middleware.NewAuthMiddleware(jwtConfig)
+		authMiddleware.SetReplayGuard(services.NewTokenReplayGuard(ts.DB, jwtConfig, ts.Logger))
+
+		// The load balancer passes the client address in X-Real-IP
+		router := gin.New()
+		router.TrustedPlatform = "X-Real-IP"
+		router.GET("/protected", authMiddleware.RequireAuth(), func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.GetUint("user_id")})
+		})
+		return router
+	}
+	issue := func(userID uint) string {
+		user := &models.User{ID: userID, Email: "replay@example.com", Role: models.RoleUser}
+		token, err := user.GenerateToken("test-secret-key", 3600)
+		require.NoError(t, err)
+		return token
+	}
+	request := func(router *gin.Engine, token, ip, userAgent string) (int, map[string]string) {
+		ts.Router = router
+		resp := ts.ExecuteRequest("GET", "/protected", nil, map[string]string{
+			"Authorization": "Bearer " + token,
+			"X-Real-IP":     ip,
+			"User-Agent":    userAgent,
+		})
+		response := map[string]string{}
+		if resp.Code != http.StatusOK {
+			ts.ParseResponse(resp, &response)
+		}
+		return resp.Code, response
+	}
+
+	t.Run("Should accept a token reused by the client it was issued to", func(t *testing.T) {
+		first, second := newInstance(config.JWTReplayStrict), newInstance(config.JWTReplayStrict)
+		token := issue(1)
+
+		for _, router := range []*gin.Engine{first, second, first} {
+			code, body := request(router, token, "203.0.113.10", laptop)
+			assert.Equal(t, http.StatusOK, code, body)
+		}
+	})
+
+	t.Run("Should reject a token replayed from another client on any instance", func(t *testing.T) {
+		first, second := newInstance(config.JWTReplayStrict), newInstance(config.JWTReplayStrict)
+		token := issue(2)
+
+		code, _ := request(first, token, "203.0.113.10", laptop)
+		require.Equal(t, http.StatusOK, code)
+
+		code, body := request(second, token, "198.51.100.7", attacker)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "token_replayed", body["code"])
+
+		code, body = request(second, token, "198.51.100.7", laptop)
+		assert.Equal(t, http.StatusUnauthorized, code, "strict mode binds the IP address as well")
+		assert.Equal(t, "token_replayed", body["code"])
+
+		// The replay does not lock out the legitimate client
+		code, _ = request(first, token, "203.0.113.10", laptop)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("Should tolerate IP changes in fingerprint mode", func(t *testing.T) {
+		router := newInstance(config.JWTReplayFingerprint)
+		token := issue(3)
+
+		code, _ := request(router, token, "203.0.113.10", laptop)
+		require.Equal(t, http.StatusOK, code)
+		code, _ = request(router, token, "192.0.2.44", laptop)
+		assert.Equal(t, http.StatusOK, code, "a roaming client keeps its token")
+
+		code, body := request(router, token, "203.0.113.10", attacker)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "token_replayed", body["code"])
+	})
+
+	t.Run("Should not track tokens when replay protection is off", func(t *testing.T) {
+		router := newInstance(config.JWTReplayOff)
+		token := issue(4)
+
+		code, _ := request(router, token, "203.0.113.10", laptop)
+		assert.Equal(t, http.StatusOK, code)
+		code, _ = request(router, token, "198.51.100.7", attacker)
+		assert.Equal(t, http.StatusOK, code)
+
+		var sightings int64
+		require.NoError(t, ts.DB.DB.Model(&models.TokenSighting{}).Where("user_id = ?", 4).Count(&sightings).Error)
+		assert.Zero(t, sightings)
+	})
+
+	t.Run("Should reject tokens without an ID", func(t *testing.T) {
+		claims := &models.Claims{UserID: 5, Role: string(models.RoleUser), RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		}}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret-key"))
+		require.NoError(t, err)
+
+		code, body := request(newInstance(config.JWTReplayFingerprint), token, "203.0.113.10", laptop)
+		assert.Equal(t, http.StatusUnauthorized, code)
+		assert.Equal(t, "token_unidentified", body["code"])
+	})
+
+	t.Run("Should purge the sightings of expired tokens", func(t *testing.T) {
+		guard := services.NewTokenReplayGuard(ts.DB, &config.JWTConfig{ReplayProtection: config.JWTReplayStrict}, ts.Logger)
+		expires := time.Now().Add(time.Hour)
+		claims := &models.Claims{UserID: 6, RegisteredClaims: jwt.RegisteredClaims{ID: "purge-me", ExpiresAt: jwt.NewNumericDate(expires)}}
+		require.NoError(t, guard.Check(claims, "203.0.113.10", laptop))
+
+		guard.SetClock(func() time.Time { return expires.Add(time.Minute) })
+		_, err := guard.PurgeExpired()
+		require.NoError(t, err)
+
+		var sightings int64
+		require.NoError(t, ts.DB.DB.Model(&models.TokenSighting{}).Where("jti = ?", "purge-me").Count(&sightings).Error)
+		assert.Zero(t, sightings)
+	})
+}
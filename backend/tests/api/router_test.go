@@ -0,0 +1,164 @@
+package api_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/api"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_KafkaUnavailable(t *testing.T) {
+	// Setup test environment
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.TwinType{})
+	userID := ts.SeedTestUser("reader@example.com", "password123", false)
+	token := ts.CreateTestAuthToken(userID, "reader@example.com", models.RoleUser)
+
+	// Service provider whose Kafka connection never came up
+	serviceProvider := services.NewServiceProvider(ts.Logger, ts.Config, ts.DB)
+	router := api.NewRouter(ts.Config, ts.Logger, ts.DB, serviceProvider)
+	router.SetupRoutes()
+	ts.Router = router.GetEngine()
+
+	t.Run("Should serve read endpoints while Kafka is down", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, map[string]string{
+			"Authorization": "Bearer " + token,
+		})
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+
+	t.Run("Should report not ready for ingest", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/readyz", nil, nil)
+
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+
+		var response map[string]interface{}
+		ts.ParseResponse(resp, &response)
+		assert.Equal(t, false, response["ingest"])
+		assert.Equal(t, true, response["read"])
+		assert.Equal(t, "unavailable", response["checks"].(map[string]interface{})["kafka"])
+	})
+
+	t.Run("Should report ready for reads", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/readyz?scope=read", nil, nil)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+	})
+}
+
+func TestRouter_Versioning(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.TwinType{})
+	userID := ts.SeedTestUser("versioned@example.com", "password123", false)
+	token := ts.CreateTestAuthToken(userID, "versioned@example.com", models.RoleUser)
+
+	serviceProvider := services.NewServiceProvider(ts.Logger, ts.Config, ts.DB)
+	router := api.NewRouter(ts.Config, ts.Logger, ts.DB, serviceProvider)
+	router.SetupRoutes()
+	ts.Router = router.GetEngine()
+
+	// Missing credentials are rejected by the auth controller itself, proving the route exists
+	login := map[string]string{"email": "versioned@example.com"}
+
+	t.Run("Should serve routes under the versioned prefix", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/auth/login", login, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		assert.Empty(t, resp.Header().Get("Deprecation"))
+
+		resp = ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, map[string]string{
+			"Authorization": "Bearer " + token,
+		})
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Empty(t, resp.Header().Get("Deprecation"))
+	})
+
+	t.Run("Should keep the unversioned auth routes as deprecated aliases", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/auth/login", login, nil)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		assert.NotEmpty(t, resp.Header().Get("Deprecation"))
+		assert.NotEmpty(t, resp.Header().Get("Sunset"))
+		assert.Equal(t, `</api/v1/auth/login>; rel="successor-version"`, resp.Header().Get("Link"))
+	})
+
+	t.Run("Should not serve other routes without the version", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/twin-types", nil, map[string]string{
+			"Authorization": "Bearer " + token,
+		})
+
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	})
+}
+
+func TestRouter_MaintenanceMode(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.TwinType{})
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+	auth := map[string]string{
+		"Authorization": "Bearer " + ts.CreateTestAuthToken(adminID, "admin@example.com", models.RoleAdmin),
+	}
+
+	ts.Config.Maintenance.RetryAfter = 120
+	serviceProvider := services.NewServiceProvider(ts.Logger, ts.Config, ts.DB)
+	router := api.NewRouter(ts.Config, ts.Logger, ts.DB, serviceProvider)
+	router.SetupRoutes()
+	ts.Router = router.GetEngine()
+
+	// Missing fields are rejected by the controller, proving the request got through
+	invalidTwinType := map[string]string{"description": "no name"}
+
+	resp := ts.ExecuteRequest("PUT", "/api/v1/admin/maintenance", map[string]interface{}{"enabled": true, "reason": "database migration"}, auth)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	t.Run("Should reject writes with Retry-After", func(t *testing.T) {
+		resp := ts.ExecuteRequest("POST", "/api/v1/twin-types", invalidTwinType, auth)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+		assert.Equal(t, "120", resp.Header().Get("Retry-After"))
+	})
+
+	t.Run("Should keep serving reads and logins", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/api/v1/twin-types", nil, auth)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = ts.ExecuteRequest("POST", "/api/v1/auth/login", map[string]string{"email": "admin@example.com"}, nil)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+	})
+
+	t.Run("Should report maintenance in readiness", func(t *testing.T) {
+		resp := ts.ExecuteRequest("GET", "/readyz?scope=read", nil, nil)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var response map[string]interface{}
+		ts.ParseResponse(resp, &response)
+		assert.Equal(t, true, response["maintenance"])
+		assert.Equal(t, false, response["ingest"])
+
+		resp = ts.ExecuteRequest("GET", "/api/v1/admin/maintenance", nil, auth)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var status services.MaintenanceStatus
+		ts.ParseResponse(resp, &status)
+		assert.True(t, status.Enabled)
+		assert.Equal(t, "database migration", status.Reason)
+		assert.NotNil(t, status.Since)
+	})
+
+	t.Run("Should accept writes again once disabled", func(t *testing.T) {
+		resp := ts.ExecuteRequest("PUT", "/api/v1/admin/maintenance", map[string]interface{}{"enabled": false}, auth)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		resp = ts.ExecuteRequest("POST", "/api/v1/twin-types", invalidTwinType, auth)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+		assert.Empty(t, resp.Header().Get("Retry-After"))
+	})
+}
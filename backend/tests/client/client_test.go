@@ -0,0 +1,312 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/client"
+	"github.com/digital-egiz/backend/internal/api"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	// Setup test environment
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.Config.Ditto.NamespacePrefix = "org.digitalegiz"
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.FeatureBinding{},
+		&models.TimeseriesData{},
+	)
+
+	// Serve the full router over HTTP
+	serviceProvider := services.NewServiceProvider(ts.Logger, ts.Config, ts.DB)
+	router := api.NewRouter(ts.Config, ts.Logger, ts.DB, serviceProvider)
+	router.SetupRoutes()
+	server := httptest.NewServer(router.GetEngine())
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL)
+
+	t.Run("Should reject requests before authentication", func(t *testing.T) {
+		_, err := c.ListProjects(ctx, 1, 10)
+		assert.ErrorIs(t, err, client.ErrNotAuthenticated)
+	})
+
+	t.Run("Should register and login", func(t *testing.T) {
+		tokens, err := c.Register(ctx, client.RegisterRequest{
+			Email:     "client@example.com",
+			Password:  "password123",
+			FirstName: "Client",
+			LastName:  "User",
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.Token)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		tokens, err = c.Login(ctx, "client@example.com", "password123")
+		require.NoError(t, err)
+		assert.Equal(t, "client@example.com", tokens.Email)
+
+		user, err := c.GetCurrentUser(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, tokens.UserID, user.ID)
+	})
+
+	t.Run("Should return API errors for invalid credentials", func(t *testing.T) {
+		_, err := client.New(server.URL).Login(ctx, "client@example.com", "wrong-password")
+
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 401, apiErr.StatusCode)
+		assert.Equal(t, "Invalid email or password", apiErr.Message)
+	})
+
+	var projectID uint
+	t.Run("Should manage projects", func(t *testing.T) {
+		project, err := c.CreateProject(ctx, client.ProjectRequest{Name: "Client Project", Description: "Created by the client"})
+		require.NoError(t, err)
+		projectID = project.ID
+
+		project, err = c.UpdateProject(ctx, projectID, client.ProjectRequest{Name: "Renamed Project"})
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed Project", project.Name)
+
+		project, err = c.GetProject(ctx, projectID)
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed Project", project.Name)
+
+		members, err := c.ListProjectMembers(ctx, projectID)
+		require.NoError(t, err)
+		assert.Len(t, members, 1)
+	})
+
+	t.Run("Should iterate all project pages", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			_, err := c.CreateProject(ctx, client.ProjectRequest{Name: fmt.Sprintf("Extra Project %d", i)})
+			require.NoError(t, err)
+		}
+
+		page, err := c.ListProjects(ctx, 1, 2)
+		require.NoError(t, err)
+		assert.Len(t, page.Projects, 2)
+		assert.Equal(t, int64(5), page.Pagination.Total)
+
+		projects, err := c.ListAllProjects(ctx, 2)
+		require.NoError(t, err)
+		assert.Len(t, projects, 5)
+	})
+
+	var twinTypeID uint
+	t.Run("Should manage twin types", func(t *testing.T) {
+		twinType, err := c.CreateTwinType(ctx, client.TwinTypeRequest{
+			Name:       "Pump",
+			Version:    "1.0",
+			SchemaJSON: json.RawMessage(`{"type":"object"}`),
+		})
+		require.NoError(t, err)
+		twinTypeID = twinType.ID
+
+		twinType, err = c.GetTwinType(ctx, twinTypeID)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"type":"object"}`, string(twinType.SchemaJSON))
+
+		twinTypes, err := c.ListAllTwinTypes(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, twinTypes, 1)
+	})
+
+	var twin *client.Twin
+	t.Run("Should manage twins", func(t *testing.T) {
+		var err error
+		for i := 0; i < 3; i++ {
+			twin, err = c.CreateTwin(ctx, client.CreateTwinRequest{
+				Name:      fmt.Sprintf("Pump %d", i),
+				TypeID:    twinTypeID,
+				ProjectID: projectID,
+				LocalName: fmt.Sprintf("pump-%d", i),
+			})
+			require.NoError(t, err)
+		}
+
+		twins, err := c.ListAllTwins(ctx, projectID, 2)
+		require.NoError(t, err)
+		assert.Len(t, twins, 3)
+
+		updated, err := c.UpdateTwin(ctx, twin.ID, client.UpdateTwinRequest{Name: "Main Pump", DittoID: twin.DittoID})
+		require.NoError(t, err)
+		assert.Equal(t, "Main Pump", updated.Name)
+
+		fields, err := c.GetTwinFields(ctx, twin.ID, "name")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"name": "Main Pump"}, fields)
+
+		require.NoError(t, c.DeleteTwin(ctx, twins[0].ID))
+		_, err = c.GetTwin(ctx, twins[0].ID)
+		assert.True(t, client.IsNotFound(err))
+	})
+
+	t.Run("Should tag twins and filter by tags", func(t *testing.T) {
+		tags, err := c.AddTwinTags(ctx, twin.ID, "line:A", "zone:north")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"line:A", "zone:north"}, tags)
+
+		twins, err := c.ListAllTwins(ctx, projectID, 10, "line:A", "zone:north")
+		require.NoError(t, err)
+		require.Len(t, twins, 1)
+		assert.Equal(t, twin.ID, twins[0].ID)
+
+		projectTags, err := c.ListProjectTwinTags(ctx, projectID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"line:A", "zone:north"}, projectTags)
+
+		tags, err = c.RemoveTwinTag(ctx, twin.ID, "zone:north")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"line:A"}, tags)
+
+		_, err = c.AddTwinTags(ctx, twin.ID, " ")
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 400, apiErr.StatusCode)
+	})
+
+	t.Run("Should list supported model formats", func(t *testing.T) {
+		formats, err := c.ListModelFormats(ctx)
+		require.NoError(t, err)
+		require.NotEmpty(t, formats)
+		assert.Equal(t, "gltf", formats[0].ID)
+		assert.Equal(t, []string{".gltf"}, formats[0].Extensions)
+
+		_, err = c.UpdateTwin(ctx, twin.ID, client.UpdateTwinRequest{
+			Name:     twin.Name,
+			DittoID:  twin.DittoID,
+			ModelURL: "https://cdn.example.com/models/pump.blend",
+		})
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 400, apiErr.StatusCode)
+		assert.Contains(t, apiErr.Message, "unsupported model format")
+	})
+
+	t.Run("Should ingest feature values", func(t *testing.T) {
+		value, err := client.NewIngestValue("pressure", 1.5, time.Time{})
+		require.NoError(t, err)
+		result, err := c.Ingest(ctx, twin.ID, value)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+
+		var values []client.IngestValue
+		for i := 0; i < 3; i++ {
+			value, err := client.NewIngestValue("pressure", 2+float64(i), time.Now().Add(-time.Duration(i+1)*time.Minute))
+			require.NoError(t, err)
+			values = append(values, value)
+		}
+		result, err = c.IngestBatch(ctx, twin.ID, values)
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Stored)
+
+		points, err := c.GetTimeseries(ctx, twin.ID, client.TimeseriesQuery{
+			FeaturePath: "pressure",
+			Fields:      []string{"value_num"},
+		})
+		require.NoError(t, err)
+		assert.Len(t, points, 4)
+
+		_, err = c.IngestBatch(ctx, twin.ID, nil)
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 422, apiErr.StatusCode)
+	})
+
+	t.Run("Should read twin history", func(t *testing.T) {
+		repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+				Time:        time.Now().Add(-time.Duration(i) * time.Minute),
+				TwinID:      twin.DittoID,
+				FeaturePath: "temperature",
+				ValueType:   "number",
+				ValueNum:    20 + float64(i),
+				Source:      "ditto",
+			}))
+		}
+
+		points, err := c.GetTimeseries(ctx, twin.ID, client.TimeseriesQuery{
+			FeaturePath: "temperature",
+			Fields:      []string{"value_num"},
+		})
+		require.NoError(t, err)
+		assert.Len(t, points, 3)
+
+		earliest, err := c.GetTimeseries(ctx, twin.ID, client.TimeseriesQuery{
+			FeaturePath: "temperature",
+			Limit:       2,
+			Ascending:   true,
+			Fields:      []string{"value_num"},
+		})
+		require.NoError(t, err)
+		require.Len(t, earliest, 2)
+		assert.Equal(t, 22.0, earliest[0].ValueNum)
+		assert.Equal(t, 21.0, earliest[1].ValueNum)
+
+		latest, err := c.GetLatestTimeseries(ctx, twin.ID, "temperature", "value_num")
+		require.NoError(t, err)
+		assert.Equal(t, 20.0, latest.ValueNum)
+	})
+
+	t.Run("Should refresh an expired access token", func(t *testing.T) {
+		tokens, ok := c.Tokens()
+		require.True(t, ok)
+
+		tokens.ExpiresAt = time.Now().Add(-time.Minute)
+		c.SetTokens(tokens)
+
+		_, err := c.GetCurrentUser(ctx)
+		require.NoError(t, err)
+
+		refreshed, _ := c.Tokens()
+		assert.True(t, refreshed.ExpiresAt.After(time.Now()))
+	})
+
+	t.Run("Should refresh and retry when the token is rejected", func(t *testing.T) {
+		tokens, _ := c.Tokens()
+		tokens.Token = "invalid-token"
+		c.SetTokens(tokens)
+
+		user, err := c.GetCurrentUser(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "client@example.com", user.Email)
+
+		refreshed, _ := c.Tokens()
+		assert.NotEqual(t, "invalid-token", refreshed.Token)
+	})
+
+	t.Run("Should fail when the refresh token is invalid", func(t *testing.T) {
+		other := client.New(server.URL, client.WithTokens(client.Tokens{
+			Token:        "invalid-token",
+			RefreshToken: "invalid-refresh-token",
+		}))
+
+		_, err := other.GetCurrentUser(ctx)
+
+		var apiErr *client.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, 401, apiErr.StatusCode)
+	})
+}
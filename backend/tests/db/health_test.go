@@ -0,0 +1,202 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// droppingPool is a connection pool whose idle connections went stale: pings fail until
+// they are dropped, and while the server is down
+type droppingPool struct {
+	mu      sync.Mutex
+	stale   bool
+	down    bool
+	dropped int
+	idle    int
+}
+
+func (p *droppingPool) PingContext(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.down {
+		return errors.New("dial tcp 10.0.0.5:5432: connect: connection refused")
+	}
+	if p.stale {
+		return errors.New("read tcp 10.0.0.1:49152->10.0.0.5:5432: read: connection reset by peer")
+	}
+	return nil
+}
+
+func (p *droppingPool) SetMaxIdleConns(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n <= 0 {
+		p.stale = false
+		p.dropped++
+	}
+	p.idle = n
+}
+
+func (p *droppingPool) set(stale, down bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stale, p.down = stale, down
+}
+
+func TestHealthChecker(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	pool := &droppingPool{idle: 10}
+	checker := db.NewHealthChecker(pool, time.Second, 10, ts.Logger)
+	ctx := context.Background()
+
+	t.Run("Should stay healthy while pings succeed", func(t *testing.T) {
+		assert.True(t, checker.Check(ctx))
+		assert.True(t, checker.Healthy())
+		assert.Zero(t, pool.dropped)
+	})
+
+	t.Run("Should drop stale connections and recover at once", func(t *testing.T) {
+		pool.set(true, false)
+
+		assert.True(t, checker.Check(ctx))
+		assert.True(t, checker.Healthy())
+		assert.Equal(t, 1, pool.dropped)
+		assert.Equal(t, 10, pool.idle, "the idle connection limit is restored")
+		assert.Equal(t, int64(1), checker.Status().Reconnects)
+	})
+
+	t.Run("Should be unhealthy while the database is down and recover after", func(t *testing.T) {
+		pool.set(true, true)
+
+		assert.False(t, checker.Check(ctx))
+		require.NotNil(t, checker.Status().UnhealthySince)
+		since := *checker.Status().UnhealthySince
+
+		assert.False(t, checker.Check(ctx))
+		status := checker.Status()
+		assert.False(t, status.Healthy)
+		assert.Contains(t, status.LastError, "connection refused")
+		require.NotNil(t, status.UnhealthySince)
+		assert.Equal(t, since, *status.UnhealthySince, "an outage keeps the time it started")
+
+		pool.set(false, false)
+		assert.True(t, checker.Check(ctx))
+		status = checker.Status()
+		assert.True(t, status.Healthy)
+		assert.Empty(t, status.LastError)
+		assert.Nil(t, status.UnhealthySince)
+		assert.Equal(t, int64(2), status.Reconnects)
+	})
+
+	t.Run("Should check periodically until cancelled", func(t *testing.T) {
+		pool.set(false, true)
+		periodic := db.NewHealthChecker(pool, 10*time.Millisecond, 10, ts.Logger)
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			periodic.Run(runCtx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool { return !periodic.Healthy() }, time.Second, 5*time.Millisecond)
+		pool.set(false, false)
+		assert.Eventually(t, periodic.Healthy, time.Second, 5*time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("health checker did not stop")
+		}
+	})
+}
+
+// flakyPool fails the next queries as if their pooled connection had been reset
+type flakyPool struct {
+	gorm.ConnPool
+	failures int
+	queries  int
+}
+
+func (p *flakyPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	p.queries++
+	if p.failures > 0 {
+		p.failures--
+		return nil, fmt.Errorf("read tcp 10.0.0.1:49152->10.0.0.5:5432: %w", syscall.ECONNRESET)
+	}
+	return p.ConnPool.QueryContext(ctx, query, args...)
+}
+
+func TestStaleConnectionRetry(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{})
+	require.NoError(t, ts.DB.DB.Create(&models.Project{Name: "Plant"}).Error)
+	require.NoError(t, db.RegisterStaleRetry(ts.DB.DB, 2, ts.Logger))
+
+	withPool := func(pool *flakyPool) *gorm.DB {
+		session := ts.DB.DB.Session(&gorm.Session{})
+		pool.ConnPool = session.Statement.ConnPool
+		session.Statement.ConnPool = pool
+		return session
+	}
+
+	t.Run("Should retry reads failing on a reset connection", func(t *testing.T) {
+		var expected []models.Project
+		require.NoError(t, ts.DB.DB.Find(&expected).Error)
+		require.NotEmpty(t, expected)
+
+		pool := &flakyPool{failures: 2}
+		var projects []models.Project
+		require.NoError(t, withPool(pool).Find(&projects).Error)
+
+		assert.Equal(t, expected, projects)
+		assert.Equal(t, 3, pool.queries)
+	})
+
+	t.Run("Should give up after the configured retries", func(t *testing.T) {
+		pool := &flakyPool{failures: 3}
+		var projects []models.Project
+		err := withPool(pool).Find(&projects).Error
+
+		require.Error(t, err)
+		assert.True(t, db.IsStaleConnection(err))
+		assert.Equal(t, 3, pool.queries)
+	})
+
+	t.Run("Should recognize stale connection errors", func(t *testing.T) {
+		for _, err := range []error{
+			driver.ErrBadConn,
+			fmt.Errorf("query failed: %w", syscall.ECONNRESET),
+			errors.New("write tcp 10.0.0.1:49152->10.0.0.5:5432: write: broken pipe"),
+			errors.New("FATAL: terminating connection due to administrator command (SQLSTATE 57P01)"),
+			errors.New("unexpected EOF"),
+		} {
+			assert.True(t, db.IsStaleConnection(err), err.Error())
+		}
+		for _, err := range []error{
+			nil,
+			gorm.ErrRecordNotFound,
+			errors.New(`ERROR: relation "projects" does not exist (SQLSTATE 42P01)`),
+		} {
+			assert.False(t, db.IsStaleConnection(err))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributeHistoryRepository_LatestValues(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.AttributeChange{})
+	repo := repository.NewAttributeHistoryRepository(ts.DB.DB)
+
+	now := time.Now().Truncate(time.Second)
+	record := func(twinID uint, path, value string, at time.Time) {
+		require.NoError(t, ts.DB.DB.Create(&models.AttributeChange{
+			TwinID: twinID, Path: path, NewValue: models.JSON(value), Time: at,
+		}).Error)
+	}
+	// Recorded out of time order, with a tie on the latest location
+	record(1, "location", `"hall 1"`, now.Add(-time.Hour))
+	record(1, "location", `"hall 3"`, now)
+	record(1, "location", `"hall 2"`, now.Add(-time.Minute))
+	record(1, "location", `"hall 4"`, now)
+	record(1, "serial", `"A-1"`, now.Add(-2*time.Hour))
+	record(1, "owner", `"ops"`, now)
+	record(2, "location", `"yard"`, now.Add(time.Hour))
+
+	t.Run("Should return the latest value of each requested path", func(t *testing.T) {
+		values, err := repo.LatestValues(1, []string{"location", "serial", "firmware"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]models.JSON{
+			"location": models.JSON(`"hall 4"`),
+			"serial":   models.JSON(`"A-1"`),
+		}, values)
+	})
+
+	t.Run("Should read only the latest changes through the index", func(t *testing.T) {
+		sql, vars := captureQuery(ts.DB.DB)
+		_, err := repo.LatestValues(1, []string{"location"})
+		require.NoError(t, err)
+
+		plan := queryPlan(t, ts.DB.DB, *sql, *vars)
+		assert.Contains(t, plan, "idx_attribute_changes_twin_path_time")
+		assert.NotContains(t, plan, "SCAN")
+		assert.NotContains(t, plan, "USE TEMP B-TREE")
+	})
+}
@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMLRepository_MissingRecords(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.MLTask{}, &models.MLTaskBinding{}, &models.MLModelMetadata{})
+	repo := repository.NewMLRepository(ts.DB.DB)
+
+	t.Run("Should return not found when changing a missing ML task", func(t *testing.T) {
+		task := &models.MLTask{ID: 9999, Name: "Ghost", Type: models.MLTaskTypeAnomaly, ModelID: "ghost", Version: "1.0"}
+		assert.ErrorIs(t, repo.UpdateMLTask(task), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.ActivateMLTask(9999, false), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteMLTask(9999), repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing a missing ML task binding", func(t *testing.T) {
+		binding := &models.MLTaskBinding{ID: 9999, OutputPathJSON: `{"feature":"health"}`}
+		assert.ErrorIs(t, repo.UpdateMLTaskBinding(binding), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.ActivateMLTaskBinding(9999, false), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteMLTaskBinding(9999), repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing missing model metadata", func(t *testing.T) {
+		metadata := &models.MLModelMetadata{ID: 9999, ModelID: "ghost", Name: "Ghost", Type: models.MLTaskTypeAnomaly, Version: "1.0"}
+		assert.ErrorIs(t, repo.UpdateMLModelMetadata(metadata), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteMLModelMetadata(9999), repository.ErrNotFound)
+	})
+
+	t.Run("Should update an existing ML task binding", func(t *testing.T) {
+		binding := &models.MLTaskBinding{TaskID: 1, TwinID: 1, OutputPathJSON: `{"feature":"health"}`}
+		require.NoError(t, repo.CreateMLTaskBinding(binding))
+
+		binding.OutputPathJSON = `{"feature":"status"}`
+		require.NoError(t, repo.UpdateMLTaskBinding(binding))
+
+		var stored models.MLTaskBinding
+		require.NoError(t, ts.DB.DB.First(&stored, binding.ID).Error)
+		assert.Equal(t, `{"feature":"status"}`, stored.OutputPathJSON)
+	})
+}
@@ -0,0 +1,137 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// captureQuery records the last SELECT statement issued through db
+func captureQuery(db *gorm.DB) (*string, *[]interface{}) {
+	var sql string
+	var vars []interface{}
+	_ = db.Callback().Query().After("gorm:query").Register("test:capture_query", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+		vars = append([]interface{}{}, tx.Statement.Vars...)
+	})
+	return &sql, &vars
+}
+
+// queryPlan returns the SQLite query plan details for a statement
+func queryPlan(t *testing.T, db *gorm.DB, sql string, vars []interface{}) string {
+	rows, err := db.Raw("EXPLAIN QUERY PLAN "+sql, vars...).Rows()
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var details []string
+	for rows.Next() {
+		var id, parent, notUsed int
+		var detail string
+		require.NoError(t, rows.Scan(&id, &parent, &notUsed, &detail))
+		details = append(details, detail)
+	}
+	return strings.Join(details, "\n")
+}
+
+func TestTimeseriesRepository_QueriesUseCompositeIndexes(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TimeseriesData{}, &models.AlertData{}, &models.MLPredictionData{})
+
+	sql, vars := captureQuery(ts.DB.DB)
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	end := time.Now()
+	start := end.Add(-time.Hour)
+
+	t.Run("Should use timeseries index for history queries", func(t *testing.T) {
+		_, err := repo.GetTimeseriesData(context.Background(), "thing-1", "temperature", start, end, repository.TimeseriesPage{Limit: 100})
+		require.NoError(t, err)
+
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_timeseries_twin_feature_time")
+	})
+
+	t.Run("Should use timeseries index for latest value queries", func(t *testing.T) {
+		_, _ = repo.GetLatestTimeseriesData(context.Background(), "thing-1", "temperature")
+
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_timeseries_twin_feature_time")
+	})
+
+	t.Run("Should use ML prediction index", func(t *testing.T) {
+		_, _, err := repo.GetMLPredictionData(context.Background(), "thing-1", "task-1", start, end, repository.MLPredictionFilter{}, 100, 0)
+		require.NoError(t, err)
+
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_ml_prediction_twin_task_time")
+	})
+
+	t.Run("Should use ML prediction type index when filtering by type", func(t *testing.T) {
+		minScore := 0.9
+		filter := repository.MLPredictionFilter{PredictionType: "anomaly", MinScore: &minScore}
+		_, _, err := repo.GetMLPredictionData(context.Background(), "thing-1", "task-1", start, end, filter, 100, 0)
+		require.NoError(t, err)
+
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_ml_prediction_twin_task_type_time")
+	})
+
+	t.Run("Should use alert index with and without severity", func(t *testing.T) {
+		_, err := repo.GetAlertData(context.Background(), "thing-1", start, end, "", 100)
+		require.NoError(t, err)
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_alert_twin_time_severity")
+
+		_, err = repo.GetAlertData(context.Background(), "thing-1", start, end, "critical", 100)
+		require.NoError(t, err)
+		assert.Contains(t, queryPlan(t, ts.DB.DB, *sql, *vars), "idx_alert_twin_time_severity")
+	})
+}
+
+func BenchmarkTimeseriesRepository_GetTimeseriesData(b *testing.B) {
+	ts := testutils.NewTestSetup(b)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TimeseriesData{})
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	// Many twins and features so an index-less scan would be noticeably slower
+	base := time.Now().Add(-24 * time.Hour)
+	points := make([]models.TimeseriesData, 0, 100)
+	for twin := 0; twin < 50; twin++ {
+		for i := 0; i < 200; i++ {
+			points = append(points, models.TimeseriesData{
+				Time:        base.Add(time.Duration(i) * time.Minute),
+				TwinID:      fmt.Sprintf("thing-%d", twin),
+				FeaturePath: "temperature",
+				ValueType:   "number",
+				ValueNum:    float64(i),
+			})
+			if len(points) == cap(points) {
+				require.NoError(b, repo.InsertTimeseriesBatch(points))
+				points = points[:0]
+			}
+		}
+	}
+
+	// Same filter and ordering as GetTimeseriesData; SQLite cannot scan timestamptz
+	// columns back into time.Time, so only the values are read
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var values []float64
+		err := ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("twin_id = ? AND feature_path = ? AND time >= ? AND time <= ?", "thing-25", "temperature", base, base.Add(time.Hour)).
+			Order("time desc").
+			Limit(100).
+			Pluck("value_num", &values).Error
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
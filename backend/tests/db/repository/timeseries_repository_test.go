@@ -0,0 +1,221 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeseriesRepository_ColumnSelection(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TimeseriesData{})
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	require.NoError(t, repo.InsertTimeseriesData(&models.TimeseriesData{
+		Time:        time.Now(),
+		TwinID:      "thing-1",
+		FeaturePath: "temperature",
+		ValueType:   "number",
+		ValueNum:    21.5,
+		Source:      "ditto",
+	}))
+
+	t.Run("Should only read selected columns", func(t *testing.T) {
+		data, err := repo.GetTimeseriesData(context.Background(), "thing-1", "temperature", time.Now().Add(-time.Hour), time.Now(), repository.TimeseriesPage{Limit: 10}, "value_num")
+		require.NoError(t, err)
+
+		require.Len(t, data, 1)
+		assert.Equal(t, 21.5, data[0].ValueNum)
+		assert.Empty(t, data[0].TwinID)
+		assert.Empty(t, data[0].Source)
+	})
+}
+
+func TestTimeseriesRepository_MissingRecords(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TimeseriesData{}, &models.AlertData{}, &models.MLPredictionData{})
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	now := time.Now()
+	require.NoError(t, repo.InsertTimeseriesData(&models.TimeseriesData{
+		Time:        now,
+		TwinID:      "thing-1",
+		FeaturePath: "temperature",
+		ValueType:   "number",
+		ValueNum:    21.5,
+	}))
+
+	t.Run("Should return not found when no time-series data is in the range", func(t *testing.T) {
+		err := repo.DeleteTimeseriesData("thing-1", "temperature", now.Add(-2*time.Hour), now.Add(-time.Hour))
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		err = repo.DeleteTimeseriesData("thing-1", "temperature", now.Add(-time.Hour), now.Add(time.Hour))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should return not found when no predictions are in the range", func(t *testing.T) {
+		err := repo.DeleteMLPredictionData("thing-1", "pump-anomaly", now.Add(-time.Hour), now.Add(time.Hour))
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing a missing alert", func(t *testing.T) {
+		assert.ErrorIs(t, repo.AcknowledgeAlert("missing-alert", "operator", ""), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteAlertData("missing-alert"), repository.ErrNotFound)
+	})
+}
+
+func TestTimeseriesRepository_Ordering(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TimeseriesData{})
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	// Values 1 to 5, one minute apart, oldest first
+	start := time.Now().Add(-time.Hour)
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, repo.InsertTimeseriesData(&models.TimeseriesData{
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			TwinID:      "thing-1",
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    float64(i),
+		}))
+	}
+
+	values := func(t *testing.T, page repository.TimeseriesPage) []float64 {
+		data, err := repo.GetTimeseriesData(context.Background(), "thing-1", "temperature", start, time.Now(), page, "value_num")
+		require.NoError(t, err)
+
+		result := make([]float64, 0, len(data))
+		for _, point := range data {
+			result = append(result, point.ValueNum)
+		}
+		return result
+	}
+
+	t.Run("Should return the latest points first by default", func(t *testing.T) {
+		assert.Equal(t, []float64{5, 4, 3, 2, 1}, values(t, repository.TimeseriesPage{}))
+		assert.Equal(t, []float64{5, 4}, values(t, repository.TimeseriesPage{Limit: 2}))
+	})
+
+	t.Run("Should return the earliest points when ascending", func(t *testing.T) {
+		assert.Equal(t, []float64{1, 2, 3, 4, 5}, values(t, repository.TimeseriesPage{Ascending: true}))
+		assert.Equal(t, []float64{1, 2}, values(t, repository.TimeseriesPage{Limit: 2, Ascending: true}))
+	})
+
+	t.Run("Should apply the offset in the requested order", func(t *testing.T) {
+		assert.Equal(t, []float64{3, 2}, values(t, repository.TimeseriesPage{Limit: 2, Offset: 2}))
+		assert.Equal(t, []float64{3, 4}, values(t, repository.TimeseriesPage{Limit: 2, Offset: 2, Ascending: true}))
+		assert.Empty(t, values(t, repository.TimeseriesPage{Limit: 2, Offset: 5}))
+	})
+}
+
+func TestTimeseriesRepository_AlertOccurrences(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.CreateTimeseriesTables()
+	repo := repository.NewTimeseriesRepository(ts.DB.DB)
+
+	first := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	condition := func(at time.Time) *models.AlertData {
+		return &models.AlertData{Time: at, TwinID: "thing-1", FeaturePath: "pressure", Severity: "warning", Source: "ml"}
+	}
+
+	t.Run("Should return not found without an active alert", func(t *testing.T) {
+		_, err := repo.IncrementAlertOccurrence(context.Background(), condition(first))
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	alert := condition(first)
+	alert.AlertID = "alert-1"
+	require.NoError(t, repo.InsertAlertData(alert))
+
+	t.Run("Should count every concurrent occurrence", func(t *testing.T) {
+		const occurrences = 50
+		var wg sync.WaitGroup
+		errs := make(chan error, occurrences)
+		for i := 1; i <= occurrences; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repo.IncrementAlertOccurrence(context.Background(), condition(first.Add(time.Duration(i)*time.Second)))
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		stored, err := repo.GetAlertByID("alert-1")
+		require.NoError(t, err)
+		assert.Equal(t, occurrences+1, stored.OccurrenceCount)
+		assert.True(t, stored.LastSeen.Equal(first.Add(occurrences*time.Second)), stored.LastSeen)
+		assert.True(t, stored.Time.Equal(first))
+	})
+
+	t.Run("Should not move last seen back for late occurrences", func(t *testing.T) {
+		stored, err := repo.IncrementAlertOccurrence(context.Background(), condition(first))
+		require.NoError(t, err)
+		assert.Equal(t, 52, stored.OccurrenceCount)
+		assert.True(t, stored.LastSeen.Equal(first.Add(50*time.Second)), stored.LastSeen)
+	})
+
+	t.Run("Should not count occurrences on acknowledged alerts", func(t *testing.T) {
+		require.NoError(t, repo.AcknowledgeAlert("alert-1", "1", "handled"))
+		_, err := repo.IncrementAlertOccurrence(context.Background(), condition(first.Add(time.Hour)))
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Should raise one alert for concurrent first occurrences", func(t *testing.T) {
+		const occurrences = 20
+		var wg sync.WaitGroup
+		var prepared, inserted atomic.Int32
+		errs := make(chan error, occurrences)
+		for i := 1; i <= occurrences; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				alert := condition(first.Add(2*time.Hour + time.Duration(i)*time.Second))
+				alert.AlertID = fmt.Sprintf("raised-%d", i)
+				_, isNew, err := repo.RaiseAlert(context.Background(), alert, func(*models.AlertData) {
+					// Widens the window between finding no active alert and inserting one
+					time.Sleep(10 * time.Millisecond)
+					prepared.Add(1)
+				})
+				if isNew {
+					inserted.Add(1)
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, int32(1), inserted.Load())
+		assert.Equal(t, int32(1), prepared.Load())
+		active, err := repo.ListActiveAlerts(context.Background(), "thing-1", 0)
+		require.NoError(t, err)
+		require.Len(t, active, 1)
+		assert.Equal(t, occurrences, active[0].OccurrenceCount)
+	})
+}
@@ -215,3 +215,140 @@ func TestTwinRepository_CRUD(t *testing.T) {
 		assert.Nil(t, retrievedTwin)
 	})
 }
+
+func TestTwinRepository_Tags(t *testing.T) {
+	// Setup test environment
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.Twin{}, &models.TwinType{}, &models.ProjectMember{})
+
+	repo := repository.NewTwinRepository(ts.DB.DB)
+	projectRepo := repository.NewProjectRepository(ts.DB.DB)
+	twinTypeRepo := repository.NewTwinTypeRepository(ts.DB.DB)
+
+	project := &models.Project{Name: "Tag Project"}
+	assert.NoError(t, projectRepo.Create(project))
+	otherProject := &models.Project{Name: "Other Project"}
+	assert.NoError(t, projectRepo.Create(otherProject))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	assert.NoError(t, twinTypeRepo.Create(twinType))
+
+	// createTwin creates a twin in a project with the given tags
+	createTwin := func(name string, projectID uint, tags ...string) *models.Twin {
+		twin := &models.Twin{
+			Name:      name,
+			DittoID:   "org.digitalegiz.project" + strconv.Itoa(int(projectID)) + ":" + name,
+			TypeID:    twinType.ID,
+			ProjectID: projectID,
+			Tags:      tags,
+		}
+		assert.NoError(t, repo.Create(twin))
+		return twin
+	}
+
+	pumpA := createTwin("pump-a", project.ID, "line:A", "zone:north")
+	createTwin("pump-b", project.ID, "line:A", "zone:south")
+	createTwin("pump-c", project.ID, "line:B", "zone:north")
+	createTwin("pump-d", project.ID)
+	createTwin("pump-e", otherProject.ID, "line:A", "zone:north", "site:remote")
+
+	names := func(twins []models.Twin) []string {
+		result := make([]string, len(twins))
+		for i, twin := range twins {
+			result[i] = twin.Name
+		}
+		return result
+	}
+
+	t.Run("Should filter twins by a single tag", func(t *testing.T) {
+		twins, total, err := repo.ListByProjectID(project.ID, 0, 10, "line:A")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, []string{"pump-a", "pump-b"}, names(twins))
+	})
+
+	t.Run("Should require all tags when filtering by several", func(t *testing.T) {
+		twins, total, err := repo.ListByProjectID(project.ID, 0, 10, "line:A", "zone:north")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, []string{"pump-a"}, names(twins))
+
+		twins, total, err = repo.ListByProjectID(project.ID, 0, 10, "line:B", "zone:south")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), total)
+		assert.Empty(t, twins)
+	})
+
+	t.Run("Should paginate filtered twins with the filtered total", func(t *testing.T) {
+		twins, total, err := repo.ListByProjectID(project.ID, 1, 1, "line:A")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), total)
+		assert.Equal(t, []string{"pump-b"}, names(twins))
+	})
+
+	t.Run("Should list all twins without tags", func(t *testing.T) {
+		_, total, err := repo.ListByProjectID(project.ID, 0, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(4), total)
+	})
+
+	t.Run("Should list distinct tags of a project", func(t *testing.T) {
+		tags, err := repo.ListProjectTags(project.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"line:A", "line:B", "zone:north", "zone:south"}, tags)
+	})
+
+	t.Run("Should replace the tags of a twin", func(t *testing.T) {
+		assert.NoError(t, repo.UpdateTags(pumpA.ID, []string{"line:B"}))
+
+		twin, err := repo.GetByID(pumpA.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.StringList{"line:B"}, twin.Tags)
+
+		twins, _, err := repo.ListByProjectID(project.ID, 0, 10, "line:B")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"pump-a", "pump-c"}, names(twins))
+	})
+
+	t.Run("Should return not found when tagging a missing twin", func(t *testing.T) {
+		assert.ErrorIs(t, repo.UpdateTags(9999, []string{"line:A"}), repository.ErrNotFound)
+	})
+}
+
+func TestTwinRepository_MissingRecords(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.Twin{}, &models.ModelBinding{}, &models.FeatureBinding{})
+	repo := repository.NewTwinRepository(ts.DB.DB)
+
+	project := &models.Project{Name: "Missing Records"}
+	assert.NoError(t, repository.NewProjectRepository(ts.DB.DB).Create(project))
+
+	// A soft-deleted twin counts as missing
+	deleted := &models.Twin{Name: "Deleted Twin", DittoID: "org.example:deleted-twin", ProjectID: project.ID}
+	assert.NoError(t, repo.Create(deleted))
+	assert.NoError(t, repo.Delete(deleted.ID))
+
+	t.Run("Should return not found when updating a missing twin", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Update(&models.Twin{ID: 9999, Name: "Ghost"}), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Update(&models.Twin{ID: deleted.ID, Name: "Ghost"}), repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when deleting a missing twin", func(t *testing.T) {
+		assert.ErrorIs(t, repo.Delete(9999), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(deleted.ID), repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing a missing model binding", func(t *testing.T) {
+		binding := &models.ModelBinding{ID: 9999, PartID: "rotor", FeaturePath: "speed", BindingType: "rotation"}
+		assert.ErrorIs(t, repo.UpdateModelBinding(binding), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteModelBinding(9999), repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing a missing feature binding", func(t *testing.T) {
+		assert.ErrorIs(t, repo.IncrementTypeViolations(9999, 1), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteFeatureBinding(9999), repository.ErrNotFound)
+	})
+}
@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeRepository_MissingRecords(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.TwinType{})
+	repo := repository.NewTwinTypeRepository(ts.DB.DB)
+
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON([]byte("{}"))}
+	require.NoError(t, repo.Create(twinType))
+
+	t.Run("Should update an existing twin type", func(t *testing.T) {
+		twinType.Description = "Centrifugal pump"
+		require.NoError(t, repo.Update(twinType))
+
+		stored, err := repo.GetByID(twinType.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Centrifugal pump", stored.Description)
+	})
+
+	t.Run("Should return not found when updating a missing twin type", func(t *testing.T) {
+		err := repo.Update(&models.TwinType{ID: 9999, Name: "Ghost", Version: "1.0"})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Should return not found when changing a deleted twin type", func(t *testing.T) {
+		require.NoError(t, repo.Delete(twinType.ID))
+
+		assert.ErrorIs(t, repo.Update(twinType), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(twinType.ID), repository.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(9999), repository.ErrNotFound)
+	})
+}
@@ -0,0 +1,80 @@
+package db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/utils"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// slowCount counts to a million in SQLite, taking well over the test threshold
+const slowCount = `WITH RECURSIVE counter(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM counter WHERE n < 1000000)
+SELECT count(*) FROM counter`
+
+func TestSlowQueryLog(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{})
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	slowQueries := db.NewSlowQueryLog(20*time.Millisecond, &utils.Logger{Logger: zap.New(core)})
+	require.NoError(t, slowQueries.Register(ts.DB.DB))
+
+	ctx := utils.WithRequestID(context.Background(), "req-42")
+
+	t.Run("Should not log fast queries", func(t *testing.T) {
+		var projects []models.Project
+		require.NoError(t, ts.DB.DB.WithContext(ctx).Find(&projects).Error)
+
+		assert.Zero(t, logs.Len())
+		assert.Zero(t, slowQueries.Stats().Total)
+	})
+
+	t.Run("Should log a slow query with its SQL, call site and request ID", func(t *testing.T) {
+		var count int64
+		require.NoError(t, ts.DB.DB.WithContext(ctx).Raw(slowCount).Find(&count).Error)
+		require.Equal(t, int64(1000000), count)
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		entry := entries[0]
+		assert.Equal(t, "Slow query", entry.Message)
+		assert.Equal(t, zapcore.WarnLevel, entry.Level)
+
+		fields := entry.ContextMap()
+		assert.Equal(t, "query", fields["operation"])
+		assert.Contains(t, fields["sql"], "WITH RECURSIVE counter(n)")
+		assert.Contains(t, fields["caller"], "slow_query_test.go")
+		assert.Equal(t, "req-42", fields["request_id"])
+		assert.GreaterOrEqual(t, fields["duration"], 20*time.Millisecond)
+	})
+
+	t.Run("Should count slow queries by operation", func(t *testing.T) {
+		require.NoError(t, ts.DB.DB.Exec(slowCount).Error)
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.Project{}).Where("id IN (?)", ts.DB.DB.Raw(slowCount)).Count(&count).Error)
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 2)
+		assert.NotContains(t, entries[0].ContextMap(), "request_id")
+
+		stats := slowQueries.Stats()
+		assert.Equal(t, int64(20), stats.ThresholdMs)
+		assert.Equal(t, int64(3), stats.Total)
+		assert.Equal(t, []db.SlowQueryCount{
+			{Operation: "query", Count: 1},
+			{Operation: "query projects", Count: 1},
+			{Operation: "raw", Count: 1},
+		}, stats.Operations)
+	})
+}
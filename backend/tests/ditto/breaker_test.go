@@ -0,0 +1,167 @@
+package ditto_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced time source
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	unavailable := &ditto.DittoError{Status: http.StatusServiceUnavailable}
+
+	t.Run("Should go from closed to open to half-open to closed", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		breaker := ditto.NewCircuitBreaker(3, 30*time.Second)
+		breaker.SetClock(clock.Now)
+
+		var transitions []ditto.BreakerState
+		breaker.OnStateChange(func(from, to ditto.BreakerState) {
+			transitions = append(transitions, to)
+		})
+
+		// Closed: failures below the threshold let requests through
+		for i := 0; i < 2; i++ {
+			require.NoError(t, breaker.Allow())
+			breaker.Record(unavailable)
+		}
+		assert.Equal(t, ditto.BreakerClosed, breaker.State())
+
+		// The third consecutive failure opens it
+		require.NoError(t, breaker.Allow())
+		breaker.Record(errors.New("failed to execute request: connection refused"))
+		assert.Equal(t, ditto.BreakerOpen, breaker.State())
+
+		// Open: requests fail fast until the timeout has passed
+		assert.ErrorIs(t, breaker.Allow(), ditto.ErrDittoUnavailable)
+		clock.Advance(29 * time.Second)
+		assert.ErrorIs(t, breaker.Allow(), ditto.ErrDittoUnavailable)
+
+		// Half-open: one probe is let through, others still fail fast
+		clock.Advance(time.Second)
+		require.NoError(t, breaker.Allow())
+		assert.Equal(t, ditto.BreakerHalfOpen, breaker.State())
+		assert.ErrorIs(t, breaker.Allow(), ditto.ErrDittoUnavailable)
+
+		// A successful probe closes it
+		breaker.Record(nil)
+		assert.Equal(t, ditto.BreakerClosed, breaker.State())
+		assert.NoError(t, breaker.Allow())
+		breaker.Record(nil)
+
+		assert.Equal(t, []ditto.BreakerState{ditto.BreakerOpen, ditto.BreakerHalfOpen, ditto.BreakerClosed}, transitions)
+
+		stats := breaker.Stats()
+		assert.Equal(t, ditto.BreakerClosed, stats.State)
+		assert.Equal(t, int64(1), stats.Opened)
+		assert.Equal(t, int64(3), stats.Rejected)
+		assert.Zero(t, stats.ConsecutiveFailures)
+	})
+
+	t.Run("Should reopen when the probe fails", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		breaker := ditto.NewCircuitBreaker(1, 10*time.Second)
+		breaker.SetClock(clock.Now)
+
+		require.NoError(t, breaker.Allow())
+		breaker.Record(unavailable)
+		require.Equal(t, ditto.BreakerOpen, breaker.State())
+
+		clock.Advance(10 * time.Second)
+		require.NoError(t, breaker.Allow())
+		breaker.Record(unavailable)
+		assert.Equal(t, ditto.BreakerOpen, breaker.State())
+		assert.ErrorIs(t, breaker.Allow(), ditto.ErrDittoUnavailable)
+		assert.Equal(t, int64(2), breaker.Stats().Opened)
+	})
+
+	t.Run("Should not count client errors or cancelled requests as failures", func(t *testing.T) {
+		breaker := ditto.NewCircuitBreaker(1, time.Minute)
+
+		for _, err := range []error{
+			&ditto.DittoError{Status: http.StatusNotFound},
+			&ditto.HTTPStatusError{Status: http.StatusBadRequest},
+			context.Canceled,
+		} {
+			require.NoError(t, breaker.Allow())
+			breaker.Record(err)
+		}
+		assert.Equal(t, ditto.BreakerClosed, breaker.State())
+	})
+
+	t.Run("Should never open when disabled", func(t *testing.T) {
+		breaker := ditto.NewCircuitBreaker(0, time.Minute)
+		for i := 0; i < 10; i++ {
+			require.NoError(t, breaker.Allow())
+			breaker.Record(unavailable)
+		}
+		assert.Equal(t, ditto.BreakerClosed, breaker.State())
+	})
+}
+
+func TestClient_CircuitBreaker(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+
+	cfg := fakeDitto.Config()
+	cfg.BreakerThreshold = 2
+	cfg.BreakerOpenTimeout = 1
+	manager := ditto.NewManager(cfg, ts.Logger)
+
+	thingID := "org.digitalegiz.project1:pump-1"
+	fakeDitto.PutThing(ditto.Thing{ThingID: thingID})
+
+	t.Run("Should fail fast without calling Ditto while open", func(t *testing.T) {
+		fakeDitto.SetFailure(http.StatusServiceUnavailable)
+
+		for i := 0; i < 2; i++ {
+			_, err := manager.GetThing(context.Background(), thingID)
+			var dittoErr *ditto.DittoError
+			require.ErrorAs(t, err, &dittoErr)
+		}
+		requests := len(fakeDitto.Requests())
+
+		_, err := manager.GetThing(context.Background(), thingID)
+		assert.ErrorIs(t, err, ditto.ErrDittoUnavailable)
+		assert.Len(t, fakeDitto.Requests(), requests)
+		assert.Equal(t, ditto.BreakerOpen, manager.BreakerStats().State)
+	})
+
+	t.Run("Should close again once Ditto recovers", func(t *testing.T) {
+		fakeDitto.SetFailure(0)
+
+		require.Eventually(t, func() bool {
+			_, err := manager.GetThing(context.Background(), thingID)
+			return err == nil
+		}, 5*time.Second, 50*time.Millisecond)
+		assert.Equal(t, ditto.BreakerClosed, manager.BreakerStats().State)
+	})
+}
@@ -0,0 +1,177 @@
+package ditto_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modelServer serves Thing Models by path and counts the requests for each
+type modelServer struct {
+	*httptest.Server
+	mu     sync.Mutex
+	models map[string]string
+	hits   map[string]int
+}
+
+func newModelServer(models map[string]string) *modelServer {
+	server := &modelServer{models: models, hits: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.hits[r.URL.Path]++
+		body, ok := server.models[r.URL.Path]
+		server.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/tm+json")
+		_, _ = w.Write([]byte(body))
+	}))
+	return server
+}
+
+func (s *modelServer) Hits(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+func (s *modelServer) Host() string {
+	parsed, _ := url.Parse(s.URL)
+	return parsed.Hostname()
+}
+
+const pumpModel = `{
+	"@context": ["https://www.w3.org/2022/wot/td/v1.1"],
+	"@type": "tm:ThingModel",
+	"title": "Pump",
+	"description": "A circulation pump",
+	"version": {"model": "2.1.0"},
+	"properties": {"serial": {"type": "string", "readOnly": true}},
+	"links": [
+		{"rel": "tm:submodel", "href": "./drive.tm.jsonld", "instanceName": "drive", "type": "application/tm+json"},
+		{"rel": "type", "href": "https://example.com/pumps"}
+	]
+}`
+
+const driveModel = `{
+	"@type": ["tm:ThingModel"],
+	"title": "Drive",
+	"properties": {
+		"speed": {"type": "number", "unit": "rpm", "minimum": 0, "maximum": 3000, "observable": true, "forms": [{"href": "/speed"}]}
+	}
+}`
+
+func TestDefinitionResolver(t *testing.T) {
+	server := newModelServer(map[string]string{
+		"/models/pump.tm.jsonld":  pumpModel,
+		"/models/drive.tm.jsonld": driveModel,
+		"/models/invalid.json":    `{"title": `,
+		"/models/td.json":         `{"@type": "Thing", "title": "Not a model"}`,
+		"/vorto/com.acme/Pump/1":  pumpModel,
+		// Submodels are linked relative to the model
+		"/vorto/com.acme/Pump/drive.tm.jsonld": driveModel,
+	})
+	defer server.Close()
+	pumpURL := server.URL + "/models/pump.tm.jsonld"
+
+	t.Run("Should resolve a Thing Model with its submodels", func(t *testing.T) {
+		resolver := ditto.NewDefinitionResolver([]string{server.Host()}, "", time.Hour)
+		model, err := resolver.Resolve(context.Background(), pumpURL)
+		require.NoError(t, err)
+
+		assert.Equal(t, "Pump", model.Title)
+		assert.Equal(t, "A circulation pump", model.Description)
+		assert.Equal(t, "2.1.0", model.Version)
+		assert.Equal(t, "string", model.Properties["serial"]["type"])
+
+		require.Contains(t, model.Submodels, "drive")
+		drive := model.Submodels["drive"]
+		assert.Equal(t, server.URL+"/models/drive.tm.jsonld", drive.Definition)
+		assert.Equal(t, "Drive", drive.Title)
+		assert.Equal(t, "rpm", drive.Properties["speed"]["unit"])
+	})
+
+	t.Run("Should cache resolved models for the TTL", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		resolver := ditto.NewDefinitionResolver([]string{server.Host()}, "", time.Hour)
+		resolver.SetClock(clock.Now)
+		before := server.Hits("/models/pump.tm.jsonld")
+
+		for i := 0; i < 3; i++ {
+			_, err := resolver.Resolve(context.Background(), pumpURL)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, before+1, server.Hits("/models/pump.tm.jsonld"))
+
+		clock.Advance(time.Hour)
+		_, err := resolver.Resolve(context.Background(), pumpURL)
+		require.NoError(t, err)
+		assert.Equal(t, before+2, server.Hits("/models/pump.tm.jsonld"))
+	})
+
+	t.Run("Should resolve namespace:name:version definitions with the model repository", func(t *testing.T) {
+		resolver := ditto.NewDefinitionResolver([]string{server.Host()}, server.URL+"/vorto/{namespace}/{name}/{version}", time.Hour)
+		model, err := resolver.Resolve(context.Background(), "com.acme:Pump:1")
+		require.NoError(t, err)
+		assert.Equal(t, "Pump", model.Title)
+		assert.Contains(t, model.Submodels, "drive")
+
+		// Without a repository such definitions cannot be resolved
+		_, err = ditto.NewDefinitionResolver([]string{server.Host()}, "", time.Hour).Resolve(context.Background(), "com.acme:Pump:1")
+		assert.ErrorIs(t, err, ditto.ErrUnresolvableDefinition)
+	})
+
+	t.Run("Should report definitions that cannot be resolved", func(t *testing.T) {
+		unreachable := httptest.NewServer(http.NotFoundHandler())
+		unreachableURL := unreachable.URL + "/models/pump.tm.jsonld"
+		unreachable.Close()
+
+		resolver := ditto.NewDefinitionResolver([]string{server.Host()}, "", time.Hour)
+		for name, definition := range map[string]string{
+			"unreachable":     unreachableURL,
+			"missing":         server.URL + "/models/missing.tm.jsonld",
+			"invalid JSON":    server.URL + "/models/invalid.json",
+			"not a model":     server.URL + "/models/td.json",
+			"host not listed": "https://models.example.com/pump.tm.jsonld",
+			"not a URL":       "pump",
+			"other scheme":    "file:///etc/passwd",
+		} {
+			_, err := resolver.Resolve(context.Background(), definition)
+			assert.ErrorIs(t, err, ditto.ErrUnresolvableDefinition, name)
+		}
+	})
+
+	t.Run("Should retry failed definitions after a minute", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		resolver := ditto.NewDefinitionResolver([]string{server.Host()}, "", time.Hour)
+		resolver.SetClock(clock.Now)
+		path := "/models/late.tm.jsonld"
+
+		_, err := resolver.Resolve(context.Background(), server.URL+path)
+		require.ErrorIs(t, err, ditto.ErrUnresolvableDefinition)
+
+		// The model is published, but the failure is remembered for a while
+		server.mu.Lock()
+		server.models[path] = strings.Replace(driveModel, "Drive", "Late", 1)
+		server.mu.Unlock()
+		_, err = resolver.Resolve(context.Background(), server.URL+path)
+		assert.ErrorIs(t, err, ditto.ErrUnresolvableDefinition)
+		assert.Equal(t, 1, server.Hits(path))
+
+		clock.Advance(time.Minute)
+		model, err := resolver.Resolve(context.Background(), server.URL+path)
+		require.NoError(t, err)
+		assert.Equal(t, "Late", model.Title)
+	})
+}
@@ -0,0 +1,49 @@
+package ditto_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEchoTracker(t *testing.T) {
+	echoOf := func(id string) *ditto.DittoEvent {
+		return &ditto.DittoEvent{Headers: map[string]interface{}{ditto.HeaderCorrelationID: id}}
+	}
+
+	t.Run("Should recognise echoes of tracked writes within the window", func(t *testing.T) {
+		clock := &fakeClock{now: time.Now()}
+		tracker := ditto.NewEchoTracker(10 * time.Second)
+		tracker.SetClock(clock.Now)
+
+		id := tracker.Track()
+		require.True(t, strings.HasPrefix(id, "digital-egiz-"))
+		assert.NotEqual(t, id, tracker.Track())
+
+		assert.True(t, tracker.IsEcho(echoOf(id)))
+		clock.Advance(10 * time.Second)
+		assert.True(t, tracker.IsEcho(echoOf(id)))
+
+		// Past the window the event is processed like any other
+		clock.Advance(time.Second)
+		assert.False(t, tracker.IsEcho(echoOf(id)))
+	})
+
+	t.Run("Should not treat other events as echoes", func(t *testing.T) {
+		tracker := ditto.NewEchoTracker(10 * time.Second)
+		tracker.Track()
+
+		assert.False(t, tracker.IsEcho(&ditto.DittoEvent{}))
+		assert.False(t, tracker.IsEcho(echoOf("device-command-1")))
+	})
+
+	t.Run("Should not tag writes when disabled", func(t *testing.T) {
+		tracker := ditto.NewEchoTracker(0)
+		assert.Empty(t, tracker.Track())
+		assert.False(t, tracker.IsEcho(echoOf("")))
+	})
+}
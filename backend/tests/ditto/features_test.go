@@ -0,0 +1,99 @@
+package ditto_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_GetAllFeatures(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	manager := fakeDitto.NewManager(ts.Logger)
+
+	thingID := "org.digitalegiz.project1:pump-1"
+	fakeDitto.PutThing(ditto.Thing{
+		ThingID: thingID,
+		Features: map[string]ditto.Feature{
+			"temperature": {Properties: map[string]interface{}{"value": 21.5, "unit": "C"}},
+			"pressure":    {Definition: "org.digitalegiz:pressure:1.0", Properties: map[string]interface{}{"value": 3.2}},
+			"status":      {Properties: map[string]interface{}{"running": true}},
+		},
+	})
+	fakeDitto.PutThing(ditto.Thing{ThingID: "org.digitalegiz.project1:empty"})
+
+	t.Run("Should fetch every feature of a thing in one request", func(t *testing.T) {
+		before := len(fakeDitto.Requests())
+
+		features, err := manager.GetAllFeatures(context.Background(), thingID)
+		require.NoError(t, err)
+		require.Len(t, features, 3)
+		assert.Equal(t, 21.5, features["temperature"].Properties["value"])
+		assert.Equal(t, "C", features["temperature"].Properties["unit"])
+		assert.Equal(t, "org.digitalegiz:pressure:1.0", features["pressure"].Definition)
+		assert.Equal(t, true, features["status"].Properties["running"])
+
+		requests := fakeDitto.Requests()[before:]
+		require.Len(t, requests, 1)
+		assert.Equal(t, "/api/2/things/"+thingID+"/features", requests[0].Path)
+	})
+
+	t.Run("Should fetch only the selected feature and property paths", func(t *testing.T) {
+		features, err := manager.GetFeaturesProjected(context.Background(), thingID, []string{"temperature/properties/value", "status"})
+		require.NoError(t, err)
+		require.Len(t, features, 2)
+		assert.Equal(t, map[string]interface{}{"value": 21.5}, features["temperature"].Properties)
+		assert.Equal(t, true, features["status"].Properties["running"])
+
+		requests := fakeDitto.Requests()
+		query, err := url.ParseQuery(requests[len(requests)-1].Query)
+		require.NoError(t, err)
+		assert.Equal(t, "temperature/properties/value,status", query.Get("fields"))
+	})
+
+	t.Run("Should return no features for a thing without any", func(t *testing.T) {
+		features, err := manager.GetAllFeatures(context.Background(), "org.digitalegiz.project1:empty")
+		require.NoError(t, err)
+		assert.Empty(t, features)
+	})
+
+	t.Run("Should fail for an unknown thing", func(t *testing.T) {
+		_, err := manager.GetAllFeatures(context.Background(), "org.digitalegiz.project1:missing")
+		var dittoErr *ditto.DittoError
+		require.ErrorAs(t, err, &dittoErr)
+		assert.Equal(t, "things:thing.notfound", dittoErr.ErrorCode)
+	})
+}
+
+func TestFeaturePropertyCondition(t *testing.T) {
+	t.Run("Should build an equality condition on the property", func(t *testing.T) {
+		for value, expected := range map[interface{}]string{
+			"idle":     `eq(features/machine/properties/status/state,"idle")`,
+			`say "hi"`: `eq(features/machine/properties/status/state,"say \"hi\"")`,
+			12.5:       `eq(features/machine/properties/status/state,12.5)`,
+			true:       `eq(features/machine/properties/status/state,true)`,
+			nil:        `eq(features/machine/properties/status/state,null)`,
+		} {
+			condition, err := ditto.FeaturePropertyCondition("machine", "/status/state", value)
+			require.NoError(t, err)
+			assert.Equal(t, expected, condition)
+		}
+	})
+
+	t.Run("Should reject values and paths that would break the condition", func(t *testing.T) {
+		_, err := ditto.FeaturePropertyCondition("machine", "state", []interface{}{1})
+		assert.Error(t, err)
+		_, err = ditto.FeaturePropertyCondition("machine/x", "state", "idle")
+		assert.Error(t, err)
+		_, err = ditto.FeaturePropertyCondition("machine", "state),eq(x", "idle")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,69 @@
+package ditto_test
+
+import (
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThingIDHelpers(t *testing.T) {
+	t.Run("Should build project namespace and thing ID", func(t *testing.T) {
+		namespace := ditto.ProjectNamespace("org.digitalegiz", 42)
+		assert.Equal(t, "org.digitalegiz.project42", namespace)
+
+		thingID, err := ditto.BuildThingID(namespace, "pump-01")
+		assert.NoError(t, err)
+		assert.Equal(t, "org.digitalegiz.project42:pump-01", thingID)
+	})
+
+	t.Run("Should reject invalid namespace or name", func(t *testing.T) {
+		_, err := ditto.BuildThingID("1invalid", "pump-01")
+		assert.Error(t, err)
+
+		_, err = ditto.BuildThingID("org.digitalegiz.project42", "")
+		assert.Error(t, err)
+
+		_, err = ditto.BuildThingID("org.digitalegiz.project42", "pump/01")
+		assert.Error(t, err)
+	})
+
+	t.Run("Should parse namespace and name from thing ID", func(t *testing.T) {
+		namespace, name, err := ditto.ParseThingID("org.digitalegiz.project7:sensor:a")
+		assert.NoError(t, err)
+		assert.Equal(t, "org.digitalegiz.project7", namespace)
+		assert.Equal(t, "sensor:a", name)
+
+		_, _, err = ditto.ParseThingID("no-namespace")
+		assert.Error(t, err)
+
+		assert.Equal(t, "org.digitalegiz.project7", ditto.NamespaceOf("org.digitalegiz.project7:sensor"))
+		assert.Empty(t, ditto.NamespaceOf("invalid"))
+	})
+
+	t.Run("Should normalize thing IDs to a lowercase namespace", func(t *testing.T) {
+		for _, variant := range []string{
+			"org.digitalegiz.project7:Pump-1",
+			"Org.DigitalEgiz.Project7:Pump-1",
+			"  ORG.DIGITALEGIZ.PROJECT7 :Pump-1\n",
+		} {
+			assert.Equal(t, "org.digitalegiz.project7:Pump-1", ditto.NormalizeThingID(variant), variant)
+		}
+
+		// The local name stays case-sensitive, as in Ditto
+		assert.NotEqual(t, ditto.NormalizeThingID("org.digitalegiz.project7:pump-1"), ditto.NormalizeThingID("org.digitalegiz.project7:Pump-1"))
+		assert.Equal(t, "no-namespace", ditto.NormalizeThingID(" no-namespace "))
+	})
+
+	t.Run("Should extract project ID from namespace", func(t *testing.T) {
+		projectID, ok := ditto.ProjectIDFromNamespace("org.digitalegiz", "org.digitalegiz.project7")
+		assert.True(t, ok)
+		assert.Equal(t, uint(7), projectID)
+
+		_, ok = ditto.ProjectIDFromNamespace("org.digitalegiz", "org.other.project7")
+		assert.False(t, ok)
+
+		_, ok = ditto.ProjectIDFromNamespace("org.digitalegiz", "org.digitalegiz.projectX")
+		assert.False(t, ok)
+	})
+}
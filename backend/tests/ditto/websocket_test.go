@@ -0,0 +1,309 @@
+package ditto_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/ditto"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureEventFilter(t *testing.T) {
+	t.Run("Should scope events to the thing and the feature path", func(t *testing.T) {
+		filter, err := ditto.FeatureEventFilter("org.digitalegiz.project1:pump-1", "temperature")
+		require.NoError(t, err)
+		assert.Equal(t, `and(eq(thingId,"org.digitalegiz.project1:pump-1"),or(eq(resource:path,"/features/temperature"),like(resource:path,"/features/temperature/*"),and(in(resource:path,"/","/features"),exists(features/temperature))))`, filter)
+	})
+
+	t.Run("Should reject feature IDs that would break the filter", func(t *testing.T) {
+		for _, featureID := range []string{"", "a/b", `a"b`, "temp*"} {
+			_, err := ditto.FeatureEventFilter("org.digitalegiz.project1:pump-1", featureID)
+			assert.Error(t, err, featureID)
+		}
+	})
+}
+
+func TestWebSocketClient_SubscribeToFeature(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	manager := fakeDitto.NewManager(ts.Logger)
+
+	thingID := "org.digitalegiz.project1:pump-1"
+	otherThingID := "org.digitalegiz.project1:pump-2"
+	for _, id := range []string{thingID, otherThingID} {
+		fakeDitto.PutThing(ditto.Thing{
+			ThingID: id,
+			Features: map[string]ditto.Feature{
+				"temperature": {Properties: map[string]interface{}{"value": 20.0}},
+				"humidity":    {Properties: map[string]interface{}{"value": 40.0}},
+			},
+		})
+	}
+
+	var (
+		mu     sync.Mutex
+		events []ditto.DittoEvent
+	)
+	manager.SetEventHandler(func(event *ditto.DittoEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, *event)
+	})
+	received := func() []ditto.DittoEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ditto.DittoEvent(nil), events...)
+	}
+
+	require.NoError(t, manager.Connect())
+	defer manager.Disconnect()
+
+	t.Run("Should send the feature filter with the subscription", func(t *testing.T) {
+		require.NoError(t, manager.SubscribeToFeature(thingID, "temperature"))
+		require.Eventually(t, func() bool { return len(fakeDitto.Subscriptions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		var command struct {
+			Type    string `json:"type"`
+			Payload struct {
+				Topic      string   `json:"topic"`
+				Filter     string   `json:"filter"`
+				Namespaces []string `json:"namespaces"`
+			} `json:"payload"`
+		}
+		require.NoError(t, json.Unmarshal(fakeDitto.Subscriptions()[0], &command))
+
+		filter, err := ditto.FeatureEventFilter(thingID, "temperature")
+		require.NoError(t, err)
+		assert.Equal(t, "START-SEND-EVENTS", command.Type)
+		assert.Equal(t, "/_/things/twin/events", command.Payload.Topic)
+		assert.Equal(t, filter, command.Payload.Filter)
+		assert.Equal(t, []string{"org.digitalegiz.project1"}, command.Payload.Namespaces)
+	})
+
+	t.Run("Should only deliver events of the subscribed feature", func(t *testing.T) {
+		ctx := context.Background()
+		require.NoError(t, manager.UpdateFeatureProperty(ctx, thingID, "humidity", "value", 41.0))
+		require.NoError(t, manager.UpdateFeatureProperty(ctx, otherThingID, "temperature", "value", 22.0))
+		require.NoError(t, manager.UpdateFeatureProperty(ctx, thingID, "temperature", "value", 21.5))
+
+		require.Eventually(t, func() bool { return len(received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+
+		delivered := received()
+		require.Len(t, delivered, 1)
+		assert.Equal(t, thingID, delivered[0].ThingID)
+		assert.Equal(t, "temperature", delivered[0].FeatureID)
+		assert.Equal(t, "/features/temperature/properties/value", delivered[0].Path)
+	})
+
+	t.Run("Should reject an invalid thing ID without subscribing", func(t *testing.T) {
+		assert.Error(t, manager.SubscribeToFeature("pump-1", "temperature"))
+	})
+}
+
+func TestWebSocketClient_OversizedMessage(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	cfg := fakeDitto.Config()
+	cfg.MaxMessageSize = 1024
+	manager := ditto.NewManager(cfg, ts.Logger)
+
+	var (
+		mu     sync.Mutex
+		events []ditto.DittoEvent
+	)
+	manager.SetEventHandler(func(event *ditto.DittoEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, *event)
+	})
+	received := func() []ditto.DittoEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]ditto.DittoEvent(nil), events...)
+	}
+
+	require.NoError(t, manager.Connect())
+	defer manager.Disconnect()
+	require.NoError(t, manager.SubscribeToThings("", nil))
+	require.Eventually(t, func() bool { return len(fakeDitto.Subscriptions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	thingID := "org.digitalegiz.project1:pump-1"
+	path := "/features/camera/properties/frame"
+
+	t.Run("Should skip an oversized message and keep receiving events", func(t *testing.T) {
+		require.NoError(t, fakeDitto.EmitEvent(thingID, "modified", path, strings.Repeat("x", 64*1024)))
+
+		// The client reconnects and restores its subscription
+		require.Eventually(t, func() bool {
+			return len(fakeDitto.Subscriptions()) == 2 && fakeDitto.ConnectionCount() == 1
+		}, 10*time.Second, 10*time.Millisecond)
+		assert.JSONEq(t, string(fakeDitto.Subscriptions()[0]), string(fakeDitto.Subscriptions()[1]))
+		assert.True(t, manager.IsConnected())
+
+		require.NoError(t, fakeDitto.EmitEvent(thingID, "modified", path, "small"))
+		require.Eventually(t, func() bool { return len(received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		delivered := received()
+		assert.Equal(t, "small", delivered[0].Value)
+		assert.Equal(t, "camera", delivered[0].FeatureID)
+	})
+
+	t.Run("Should accept messages within the default limit", func(t *testing.T) {
+		require.NoError(t, fakeDitto.EmitEvent(thingID, "modified", path, strings.Repeat("y", 512)))
+		require.Eventually(t, func() bool { return len(received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.Len(t, fakeDitto.Subscriptions(), 2, "no reconnect for messages within the limit")
+	})
+}
+
+func TestWebSocketClient_TokenRefresh(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	manager := fakeDitto.NewManager(ts.Logger)
+
+	// The identity provider issues a new token on every request
+	var (
+		mu        sync.Mutex
+		issued    int
+		refreshes []bool
+		lifetime  time.Duration
+	)
+	manager.SetTokenProvider(func(ctx context.Context, forceRefresh bool) (ditto.Token, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		issued++
+		refreshes = append(refreshes, forceRefresh)
+		token := ditto.Token{Value: fmt.Sprintf("token-%d", issued)}
+		if lifetime > 0 {
+			token.ExpiresAt = time.Now().Add(lifetime)
+		}
+		return token, nil
+	})
+	forced := func() []bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]bool(nil), refreshes...)
+	}
+	// Every accepted handshake is followed by the restored subscription
+	reconnected := func(handshakes, subscriptions int) func() bool {
+		return func() bool {
+			return len(fakeDitto.WebSocketAuthorizations()) == handshakes &&
+				len(fakeDitto.Subscriptions()) == subscriptions && fakeDitto.ConnectionCount() == 1
+		}
+	}
+
+	require.NoError(t, manager.Connect())
+	defer manager.Disconnect()
+	require.NoError(t, manager.SubscribeToThings("", nil))
+	require.Eventually(t, reconnected(1, 1), 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"Bearer token-1"}, fakeDitto.WebSocketAuthorizations())
+
+	t.Run("Should fetch a new token when reconnecting", func(t *testing.T) {
+		fakeDitto.CloseWebSockets(websocket.CloseGoingAway, "restarting")
+
+		require.Eventually(t, reconnected(2, 2), 10*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Bearer token-2", fakeDitto.WebSocketAuthorizations()[1])
+		assert.Equal(t, []bool{false, false}, forced(), "a network close does not force a refresh")
+	})
+
+	t.Run("Should force a token refresh after an auth-failure close", func(t *testing.T) {
+		fakeDitto.CloseWebSockets(4401, "token expired")
+
+		require.Eventually(t, reconnected(3, 3), 10*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Bearer token-3", fakeDitto.WebSocketAuthorizations()[2])
+		assert.Equal(t, []bool{false, false, true}, forced())
+		assert.JSONEq(t, string(fakeDitto.Subscriptions()[0]), string(fakeDitto.Subscriptions()[2]))
+	})
+
+	t.Run("Should retry with a fresh token after a rejected handshake", func(t *testing.T) {
+		fakeDitto.SetWebSocketAuth(func(authorization string) bool { return authorization != "Bearer token-4" })
+		defer fakeDitto.SetWebSocketAuth(nil)
+		fakeDitto.CloseWebSockets(websocket.CloseGoingAway, "restarting")
+
+		require.Eventually(t, reconnected(5, 4), 15*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Bearer token-5", fakeDitto.WebSocketAuthorizations()[4])
+		assert.Equal(t, []bool{false, false, true, false, true}, forced())
+	})
+
+	t.Run("Should renew the connection before the token expires", func(t *testing.T) {
+		mu.Lock()
+		lifetime = 2 * time.Second
+		mu.Unlock()
+		fakeDitto.CloseWebSockets(websocket.CloseGoingAway, "restarting")
+		require.Eventually(t, reconnected(6, 5), 10*time.Second, 10*time.Millisecond)
+
+		// Tokens issued from now on do not expire, so the connection is renewed once
+		mu.Lock()
+		lifetime = 0
+		mu.Unlock()
+		require.Eventually(t, reconnected(7, 6), 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Bearer token-7", fakeDitto.WebSocketAuthorizations()[6])
+		assert.True(t, forced()[6], "a renewal does not reuse the expiring token")
+		assert.True(t, manager.IsConnected())
+
+		var (
+			eventsMu sync.Mutex
+			events   []ditto.DittoEvent
+		)
+		manager.SetEventHandler(func(event *ditto.DittoEvent) {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			events = append(events, *event)
+		})
+		require.NoError(t, fakeDitto.EmitEvent("org.digitalegiz.project1:pump-1", "modified", "/features/temperature/properties/value", 21.5))
+		require.Eventually(t, func() bool {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			return len(events) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestFileTokenProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	provider := ditto.FileTokenProvider(path)
+
+	t.Run("Should read the rotated token and its JWT expiry", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+		claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"backend","exp":%d}`, expiresAt.Unix())))
+		jwt := "eyJhbGciOiJSUzI1NiJ9." + claims + ".c2lnbmF0dXJl"
+		require.NoError(t, os.WriteFile(path, []byte(jwt+"\n"), 0o600))
+
+		token, err := provider(context.Background(), false)
+		require.NoError(t, err)
+		assert.Equal(t, jwt, token.Value)
+		assert.True(t, expiresAt.Equal(token.ExpiresAt))
+
+		require.NoError(t, os.WriteFile(path, []byte("opaque-token"), 0o600))
+		token, err = provider(context.Background(), true)
+		require.NoError(t, err)
+		assert.Equal(t, "opaque-token", token.Value)
+		assert.True(t, token.ExpiresAt.IsZero())
+	})
+
+	t.Run("Should fail on an empty token file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		_, err := provider(context.Background(), false)
+		assert.Error(t, err)
+	})
+}
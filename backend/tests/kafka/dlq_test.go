@@ -0,0 +1,143 @@
+package kafka_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/kafka"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDLQReprocessor(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	cfg := &config.KafkaConfig{
+		Brokers:        cluster.BootstrapServers(),
+		ConsumerGroup:  "digital-egiz-test",
+		DLQMaxAttempts: 2,
+	}
+	manager, err := kafka.NewManager(cfg, ts.Logger)
+	require.NoError(t, err)
+	reprocessor := kafka.NewDLQReprocessor(manager, cfg, ts.Logger)
+
+	// The handler fails for the keys in failing and records the keys it processed
+	var (
+		mu        sync.Mutex
+		failing   = map[string]bool{}
+		processed []string
+	)
+	topic := "dlq-test-events"
+	require.NoError(t, manager.AddConsumer("events", []string{topic}, map[string][]kafka.MessageHandler{
+		topic: {func(msg *confluent.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if failing[string(msg.Key)] {
+				return errors.New("handler failed")
+			}
+			processed = append(processed, string(msg.Key))
+			return nil
+		}},
+	}))
+
+	require.NoError(t, manager.Start())
+	defer manager.Stop()
+
+	setFailing := func(key string, fail bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		failing[key] = fail
+	}
+	wasProcessed := func(key string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, k := range processed {
+			if k == key {
+				return true
+			}
+		}
+		return false
+	}
+	pending := func() int64 {
+		_, stats, err := reprocessor.Inspect(context.Background(), topic, 10)
+		require.NoError(t, err)
+		return stats.Pending
+	}
+
+	t.Run("Should replay a dead-lettered message once the handler succeeds", func(t *testing.T) {
+		setFailing("thing-1", true)
+		require.NoError(t, manager.ProduceMessage(topic, "thing-1", map[string]string{"status": "ok"}, nil))
+		require.Eventually(t, func() bool { return pending() == 1 }, 30*time.Second, 100*time.Millisecond)
+
+		messages, _, err := reprocessor.Inspect(context.Background(), topic, 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, "thing-1", messages[0].Key)
+		assert.Equal(t, "handler failed", messages[0].Error)
+		assert.Equal(t, "events", messages[0].Consumer)
+		assert.JSONEq(t, `{"status":"ok"}`, string(messages[0].Value))
+
+		setFailing("thing-1", false)
+		result, err := reprocessor.Replay(context.Background(), topic)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Replayed)
+		assert.Zero(t, result.Requeued)
+		assert.True(t, wasProcessed("thing-1"))
+		assert.Zero(t, pending())
+
+		// Committed messages are not replayed again
+		result, err = reprocessor.Replay(context.Background(), topic)
+		require.NoError(t, err)
+		assert.Zero(t, result.Replayed)
+	})
+
+	t.Run("Should count a permanent failure after the maximum attempts", func(t *testing.T) {
+		setFailing("thing-2", true)
+		require.NoError(t, manager.ProduceMessage(topic, "thing-2", map[string]string{"status": "bad"}, nil))
+		require.Eventually(t, func() bool { return pending() == 1 }, 30*time.Second, 100*time.Millisecond)
+
+		// The first failed replay requeues the message
+		result, err := reprocessor.Replay(context.Background(), topic)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Requeued)
+		messages, _, err := reprocessor.Inspect(context.Background(), topic, 10)
+		require.NoError(t, err)
+		require.Len(t, messages, 1)
+		assert.Equal(t, 1, messages[0].ReplayAttempts)
+
+		// The second one reaches the maximum and parks it
+		result, err = reprocessor.Replay(context.Background(), topic)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.PermanentFailures)
+		assert.Zero(t, pending())
+		assert.False(t, wasProcessed("thing-2"))
+
+		stats, err := reprocessor.Stats()
+		require.NoError(t, err)
+		require.Len(t, stats, 1)
+		assert.Equal(t, topic, stats[0].Topic)
+		assert.Equal(t, int64(1), stats[0].Replayed)
+		assert.Equal(t, int64(1), stats[0].Requeued)
+		assert.Equal(t, int64(1), stats[0].PermanentFailures)
+		assert.Zero(t, stats[0].Pending)
+	})
+
+	t.Run("Should refuse to replay while Kafka is stopped", func(t *testing.T) {
+		stopped, err := kafka.NewManager(cfg, ts.Logger)
+		require.NoError(t, err)
+
+		_, err = kafka.NewDLQReprocessor(stopped, cfg, ts.Logger).Replay(context.Background(), topic)
+		assert.ErrorIs(t, err, kafka.ErrKafkaNotRunning)
+	})
+}
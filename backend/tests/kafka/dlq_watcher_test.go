@@ -0,0 +1,175 @@
+package kafka_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/kafka"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDLQWatcher(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	var (
+		mu     sync.Mutex
+		alerts []kafka.DLQAlert
+	)
+	collect := func(alert kafka.DLQAlert) {
+		mu.Lock()
+		defer mu.Unlock()
+		alerts = append(alerts, alert)
+	}
+	raised := func() []kafka.DLQAlert {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]kafka.DLQAlert(nil), alerts...)
+	}
+
+	t.Run("Should alert when a handler dead-letters messages past the threshold", func(t *testing.T) {
+		cluster, err := confluent.NewMockCluster(1)
+		require.NoError(t, err)
+		defer cluster.Close()
+
+		cfg := &config.KafkaConfig{
+			Brokers:           cluster.BootstrapServers(),
+			ConsumerGroup:     "digital-egiz-test",
+			DLQAlertThreshold: 3,
+			DLQAlertWindow:    60,
+		}
+		manager, err := kafka.NewManager(cfg, ts.Logger)
+		require.NoError(t, err)
+		manager.SetDLQWatcher(kafka.NewDLQWatcher(cfg, collect, ts.Logger))
+
+		topic := "dlq-watch-events"
+		require.NoError(t, manager.AddConsumer("events", []string{topic}, map[string][]kafka.MessageHandler{
+			topic: {func(msg *confluent.Message) error {
+				return errors.New("unexpected payload")
+			}},
+		}))
+		require.NoError(t, manager.Start())
+		defer manager.Stop()
+
+		for i := 1; i <= 2; i++ {
+			require.NoError(t, manager.ProduceMessage(topic, fmt.Sprintf("thing-%d", i), map[string]string{"status": "ok"}, nil))
+		}
+		// Below the threshold nothing is raised
+		time.Sleep(500 * time.Millisecond)
+		assert.Empty(t, raised())
+
+		require.NoError(t, manager.ProduceMessage(topic, "thing-3", map[string]string{"status": "ok"}, nil))
+		require.Eventually(t, func() bool { return len(raised()) == 1 }, 10*time.Second, 20*time.Millisecond)
+
+		alert := raised()[0]
+		assert.Equal(t, kafka.DLQAlertFiring, alert.Status)
+		assert.Equal(t, topic, alert.Topic)
+		assert.Equal(t, kafka.DLQTopic(topic), alert.DLQTopic)
+		assert.Equal(t, 3, alert.Count)
+		assert.Equal(t, 60, alert.Window)
+		assert.Equal(t, "unexpected payload", alert.SampleError)
+
+		// A firing alert is not raised again while messages keep failing
+		require.NoError(t, manager.ProduceMessage(topic, "thing-4", map[string]string{"status": "ok"}, nil))
+		time.Sleep(500 * time.Millisecond)
+		assert.Len(t, raised(), 1)
+	})
+
+	t.Run("Should stop while a message is dead-lettered during the drain", func(t *testing.T) {
+		cluster, err := confluent.NewMockCluster(1)
+		require.NoError(t, err)
+		defer cluster.Close()
+
+		cfg := &config.KafkaConfig{
+			Brokers:           cluster.BootstrapServers(),
+			ConsumerGroup:     "digital-egiz-test",
+			DLQAlertThreshold: 1,
+			DLQAlertWindow:    60,
+		}
+		manager, err := kafka.NewManager(cfg, ts.Logger)
+		require.NoError(t, err)
+		manager.SetDLQWatcher(kafka.NewDLQWatcher(cfg, func(kafka.DLQAlert) {}, ts.Logger))
+
+		// The handler holds the message until the manager is stopping, then fails it
+		topic := "dlq-drain-events"
+		handling := make(chan struct{})
+		release := make(chan struct{})
+		require.NoError(t, manager.AddConsumer("events", []string{topic}, map[string][]kafka.MessageHandler{
+			topic: {func(msg *confluent.Message) error {
+				close(handling)
+				<-release
+				return errors.New("unexpected payload")
+			}},
+		}))
+		require.NoError(t, manager.Start())
+		require.NoError(t, manager.ProduceMessage(topic, "thing-1", map[string]string{"status": "ok"}, nil))
+
+		select {
+		case <-handling:
+		case <-time.After(30 * time.Second):
+			t.Fatal("message was not consumed")
+		}
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- manager.Stop() }()
+		time.Sleep(200 * time.Millisecond)
+		close(release)
+
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("stopping deadlocked on the dead-lettered message")
+		}
+	})
+
+	t.Run("Should clear the alert once the rate subsides", func(t *testing.T) {
+		mu.Lock()
+		alerts = nil
+		mu.Unlock()
+
+		watcher := kafka.NewDLQWatcher(&config.KafkaConfig{DLQAlertThreshold: 2, DLQAlertWindow: 60}, collect, ts.Logger)
+		start := time.Now()
+		watcher.Record("timeseries-data", errors.New("bad value"), start)
+		watcher.Record("ml-output", errors.New("bad prediction"), start)
+		assert.Empty(t, raised())
+
+		watcher.Record("timeseries-data", errors.New("bad timestamp"), start.Add(10*time.Second))
+		require.Len(t, raised(), 1)
+		assert.Equal(t, "bad timestamp", raised()[0].SampleError)
+		require.Len(t, watcher.Firing(), 1)
+
+		// Still one message within the window
+		assert.Empty(t, watcher.Check(start.Add(30*time.Second)))
+
+		cleared := watcher.Check(start.Add(61 * time.Second))
+		require.Len(t, cleared, 1)
+		assert.Equal(t, kafka.DLQAlertCleared, cleared[0].Status)
+		assert.Equal(t, "timeseries-data", cleared[0].Topic)
+		assert.Equal(t, 1, cleared[0].Count)
+		assert.Empty(t, watcher.Firing())
+		assert.Len(t, raised(), 2)
+
+		// Messages spread wider than the window never cross the threshold
+		watcher.Record("ml-output", errors.New("bad prediction"), start.Add(61*time.Second))
+		assert.Len(t, raised(), 2)
+	})
+
+	t.Run("Should not alert when disabled", func(t *testing.T) {
+		watcher := kafka.NewDLQWatcher(&config.KafkaConfig{DLQAlertWindow: 60}, func(alert kafka.DLQAlert) {
+			t.Errorf("unexpected alert for %s", alert.Topic)
+		}, ts.Logger)
+		assert.False(t, watcher.Enabled())
+		for i := 0; i < 100; i++ {
+			watcher.Record("timeseries-data", errors.New("bad value"), time.Now())
+		}
+		assert.Empty(t, watcher.Check(time.Now()))
+	})
+}
@@ -0,0 +1,332 @@
+package kafka_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/kafka"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManager_AddConsumerWhileRunning(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	// Start an in-process mock Kafka cluster
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	topic := "ml-output-task-42"
+
+	manager, err := kafka.NewManager(&config.KafkaConfig{
+		Brokers:       cluster.BootstrapServers(),
+		ConsumerGroup: "digital-egiz-test",
+	}, ts.Logger)
+	require.NoError(t, err)
+
+	// Start the manager without any consumers
+	require.NoError(t, manager.Start())
+	defer manager.Stop()
+
+	t.Run("Should start consumer added at runtime and consume messages", func(t *testing.T) {
+		received := make(chan string, 1)
+		err := manager.AddConsumer("task-42", []string{topic}, map[string][]kafka.MessageHandler{
+			topic: {func(msg *confluent.Message) error {
+				received <- string(msg.Key)
+				return nil
+			}},
+		})
+		require.NoError(t, err)
+
+		// Consumer is listed as running
+		consumers := manager.ListConsumers()
+		require.Len(t, consumers, 1)
+		assert.Equal(t, "task-42", consumers[0].Name)
+		assert.Equal(t, []string{topic}, consumers[0].Topics)
+		assert.Equal(t, "digital-egiz-test", consumers[0].Group)
+		assert.True(t, consumers[0].Running)
+
+		// Produce a message and wait for the handler
+		require.NoError(t, manager.ProduceMessage(topic, "thing-1", map[string]string{"status": "ok"}, nil))
+
+		select {
+		case key := <-received:
+			assert.Equal(t, "thing-1", key)
+		case <-time.After(30 * time.Second):
+			t.Fatal("message was not consumed")
+		}
+	})
+
+	t.Run("Should reject duplicate consumer names", func(t *testing.T) {
+		err := manager.AddConsumer("task-42", []string{topic}, map[string][]kafka.MessageHandler{
+			topic: {func(msg *confluent.Message) error { return nil }},
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Should remove consumer at runtime", func(t *testing.T) {
+		require.NoError(t, manager.RemoveConsumer("task-42"))
+		assert.Empty(t, manager.ListConsumers())
+		assert.Error(t, manager.RemoveConsumer("task-42"))
+	})
+}
+
+func TestManager_Ping(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	t.Run("Should fail when brokers are unreachable", func(t *testing.T) {
+		manager, err := kafka.NewManager(&config.KafkaConfig{
+			Brokers:       "127.0.0.1:1",
+			ConsumerGroup: "digital-egiz-test",
+		}, ts.Logger)
+		require.NoError(t, err)
+
+		assert.Error(t, manager.Ping(time.Second))
+		assert.False(t, manager.IsRunning())
+	})
+
+	t.Run("Should succeed when brokers are reachable", func(t *testing.T) {
+		cluster, err := confluent.NewMockCluster(1)
+		require.NoError(t, err)
+		defer cluster.Close()
+
+		manager, err := kafka.NewManager(&config.KafkaConfig{
+			Brokers:       cluster.BootstrapServers(),
+			ConsumerGroup: "digital-egiz-test",
+		}, ts.Logger)
+		require.NoError(t, err)
+
+		assert.NoError(t, manager.Ping(5*time.Second))
+	})
+}
+
+func TestManager_Pause(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	topic := "maintenance-events"
+	manager, err := kafka.NewManager(&config.KafkaConfig{
+		Brokers:       cluster.BootstrapServers(),
+		ConsumerGroup: "digital-egiz-test",
+	}, ts.Logger)
+	require.NoError(t, err)
+
+	received := make(chan string, 10)
+	require.NoError(t, manager.AddConsumer("events", []string{topic}, map[string][]kafka.MessageHandler{
+		topic: {func(msg *confluent.Message) error {
+			received <- string(msg.Key)
+			return nil
+		}},
+	}))
+
+	// Consumers added before Start begin paused
+	require.NoError(t, manager.Pause())
+	require.NoError(t, manager.Start())
+	defer manager.Stop()
+
+	t.Run("Should hold messages back while paused", func(t *testing.T) {
+		assert.True(t, manager.IsPaused())
+		assert.True(t, manager.ListConsumers()[0].Paused)
+
+		require.NoError(t, manager.ProduceMessage(topic, "thing-1", map[string]string{"status": "ok"}, nil))
+		select {
+		case key := <-received:
+			t.Fatalf("message %s was handled while paused", key)
+		case <-time.After(3 * time.Second):
+		}
+	})
+
+	t.Run("Should handle the held back messages after resuming", func(t *testing.T) {
+		require.NoError(t, manager.Resume())
+		assert.False(t, manager.IsPaused())
+
+		select {
+		case key := <-received:
+			assert.Equal(t, "thing-1", key)
+		case <-time.After(30 * time.Second):
+			t.Fatal("message was not consumed after resuming")
+		}
+	})
+}
+
+func TestManager_StopConsumersKeepsProducers(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	kafkaConfig := &config.KafkaConfig{
+		Brokers:       cluster.BootstrapServers(),
+		ConsumerGroup: "digital-egiz-test",
+	}
+	manager, err := kafka.NewManager(kafkaConfig, ts.Logger)
+	require.NoError(t, err)
+	require.NoError(t, manager.Start())
+
+	topic := "shutdown-events"
+
+	t.Run("Should produce after the consumers stopped", func(t *testing.T) {
+		require.NoError(t, manager.StopConsumers())
+		assert.False(t, manager.IsRunning())
+		require.NoError(t, manager.ProduceMessage(topic, "last-flush", map[string]string{"status": "ok"}, nil))
+
+		// Closing delivers the message produced during shutdown
+		manager.Close()
+
+		reader, err := kafka.NewManager(kafkaConfig, ts.Logger)
+		require.NoError(t, err)
+		received := make(chan string, 1)
+		require.NoError(t, reader.AddConsumer("reader", []string{topic}, map[string][]kafka.MessageHandler{
+			topic: {func(msg *confluent.Message) error {
+				received <- string(msg.Key)
+				return nil
+			}},
+		}))
+		require.NoError(t, reader.Start())
+		defer reader.Stop()
+
+		select {
+		case key := <-received:
+			assert.Equal(t, "last-flush", key)
+		case <-time.After(30 * time.Second):
+			t.Fatal("message produced after stopping the consumers was not delivered")
+		}
+	})
+
+	t.Run("Should fail to produce once closed", func(t *testing.T) {
+		assert.Error(t, manager.ProduceMessage(topic, "too-late", map[string]string{"status": "ok"}, nil))
+		// Closing again is harmless
+		manager.Close()
+	})
+}
+
+func TestManager_ConsumerDiagnostics(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	kafkaConfig := &config.KafkaConfig{
+		Brokers:                  cluster.BootstrapServers(),
+		ConsumerGroup:            "digital-egiz-test",
+		ConsumerFailureThreshold: 2,
+		ConsumerIdleTimeout:      60,
+	}
+	manager, err := kafka.NewManager(kafkaConfig, ts.Logger)
+	require.NoError(t, err)
+
+	// The handler fails for messages keyed "bad"
+	topic := "diagnostics-events"
+	handled := make(chan struct{}, 10)
+	require.NoError(t, manager.AddConsumer("events", []string{topic}, map[string][]kafka.MessageHandler{
+		topic: {func(msg *confluent.Message) error {
+			defer func() { handled <- struct{}{} }()
+			if string(msg.Key) == "bad" {
+				return errors.New("database unavailable")
+			}
+			return nil
+		}},
+	}))
+
+	var alerts []kafka.ConsumerDiagnostics
+	monitor := kafka.NewConsumerMonitor(manager, kafkaConfig, func(diagnostics kafka.ConsumerDiagnostics) {
+		alerts = append(alerts, diagnostics)
+	}, ts.Logger)
+
+	require.NoError(t, manager.Start())
+	defer manager.Stop()
+
+	// produce sends a message and waits until the consumer has recorded its outcome
+	messages := int64(0)
+	produce := func(key string) *kafka.ConsumerDiagnostics {
+		require.NoError(t, manager.ProduceMessage(topic, key, map[string]string{"status": "ok"}, nil))
+		select {
+		case <-handled:
+		case <-time.After(30 * time.Second):
+			t.Fatalf("message %s was not consumed", key)
+		}
+		messages++
+
+		var result *kafka.ConsumerDiagnostics
+		require.Eventually(t, func() bool {
+			var err error
+			result, err = manager.GetConsumer("events")
+			require.NoError(t, err)
+			return result.Processed+result.Failed == messages
+		}, 5*time.Second, 10*time.Millisecond)
+		return result
+	}
+
+	t.Run("Should report recent progress of a healthy consumer", func(t *testing.T) {
+		result := produce("good")
+		assert.Equal(t, kafka.ConsumerStatusOK, result.Status)
+		assert.True(t, result.Running)
+		assert.False(t, result.Paused)
+		assert.Equal(t, []string{topic}, result.Topics)
+		assert.Equal(t, int64(1), result.Processed)
+		assert.Equal(t, topic, result.LastTopic)
+		assert.GreaterOrEqual(t, result.LastOffset, int64(0))
+		require.NotNil(t, result.LastProcessedAt)
+		assert.WithinDuration(t, time.Now(), *result.LastProcessedAt, 30*time.Second)
+		assert.Zero(t, result.ConsecutiveFailures)
+	})
+
+	t.Run("Should record the errors of a failing handler", func(t *testing.T) {
+		result := produce("bad")
+		assert.Equal(t, kafka.ConsumerStatusOK, result.Status, "one failure is below the threshold")
+		assert.Equal(t, int64(1), result.Failed)
+		assert.Equal(t, "database unavailable", result.LastError)
+		require.NotNil(t, result.LastErrorAt)
+		assert.WithinDuration(t, time.Now(), *result.LastErrorAt, 30*time.Second)
+		assert.Equal(t, 1, result.ConsecutiveFailures)
+
+		result = produce("bad")
+		assert.Equal(t, kafka.ConsumerStatusFailing, result.Status)
+		assert.Equal(t, int64(2), result.Failed)
+		assert.Equal(t, 2, result.ConsecutiveFailures)
+	})
+
+	t.Run("Should alert once when a consumer is failing", func(t *testing.T) {
+		alerted := monitor.Check(time.Now())
+		require.Len(t, alerted, 1)
+		assert.Equal(t, "events", alerted[0].Name)
+		assert.Equal(t, kafka.ConsumerStatusFailing, alerted[0].Status)
+		assert.Len(t, alerts, 1)
+
+		assert.Empty(t, monitor.Check(time.Now()), "a consumer still failing is not alerted again")
+	})
+
+	t.Run("Should reset failures after a success and alert when idle", func(t *testing.T) {
+		result := produce("good")
+		assert.Equal(t, kafka.ConsumerStatusOK, result.Status)
+		assert.Zero(t, result.ConsecutiveFailures)
+		assert.Equal(t, "database unavailable", result.LastError, "the last error is kept")
+		assert.Empty(t, monitor.Check(time.Now()))
+
+		// Without messages past the idle timeout, the consumer is idle
+		alerted := monitor.Check(time.Now().Add(2 * time.Minute))
+		require.Len(t, alerted, 1)
+		assert.Equal(t, kafka.ConsumerStatusIdle, alerted[0].Status)
+		assert.Len(t, alerts, 2)
+	})
+
+	t.Run("Should return not found for unknown consumers", func(t *testing.T) {
+		_, err := manager.GetConsumer("unknown")
+		assert.ErrorIs(t, err, kafka.ErrConsumerNotFound)
+	})
+}
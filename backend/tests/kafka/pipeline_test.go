@@ -0,0 +1,170 @@
+package kafka_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/kafka"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineRegistry(t *testing.T) {
+	noop := func(msg *confluent.Message) error { return nil }
+	newRegistry := func(t *testing.T) *kafka.PipelineRegistry {
+		registry := kafka.NewPipelineRegistry()
+		require.NoError(t, registry.Register(kafka.Pipeline{Name: "events", Topic: kafka.TopicDittoEvents, Handler: noop}))
+		require.NoError(t, registry.Register(kafka.Pipeline{Name: "points", Topic: kafka.TopicTimeSeriesData, Handler: noop}))
+		return registry
+	}
+	disabled := false
+
+	t.Run("Should reject incomplete and duplicate pipelines", func(t *testing.T) {
+		registry := newRegistry(t)
+		assert.Error(t, registry.Register(kafka.Pipeline{Name: "events", Topic: kafka.TopicMLOutput, Handler: noop}))
+		assert.Error(t, registry.Register(kafka.Pipeline{Name: "output", Handler: noop}))
+		assert.Error(t, registry.Register(kafka.Pipeline{Name: "output", Topic: kafka.TopicMLOutput}))
+	})
+
+	t.Run("Should apply defaults without config", func(t *testing.T) {
+		specs, err := newRegistry(t).Resolve(&config.KafkaConfig{ConsumerGroup: "digital-egiz"})
+		require.NoError(t, err)
+		require.Len(t, specs, 2)
+
+		assert.Equal(t, "events", specs[0].Name)
+		assert.Equal(t, kafka.TopicDittoEvents, specs[0].Topic)
+		assert.Equal(t, "digital-egiz", specs[0].Group)
+		assert.Equal(t, 1, specs[0].Concurrency)
+		assert.True(t, specs[0].DLQ)
+		assert.Equal(t, []string{"events-ditto-events"}, specs[0].Consumers)
+	})
+
+	t.Run("Should apply the configured settings", func(t *testing.T) {
+		specs, err := newRegistry(t).Resolve(&config.KafkaConfig{
+			ConsumerGroup: "digital-egiz",
+			ExtraTopics:   []string{"timeseries-data-v2"},
+			Pipelines: map[string]config.KafkaPipelineConfig{
+				"points": {Topic: "timeseries-data-v2", Group: "digital-egiz-points", Concurrency: 3, DLQ: &disabled},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, specs, 2)
+
+		points := specs[1]
+		assert.Equal(t, "timeseries-data-v2", points.Topic)
+		assert.Equal(t, "digital-egiz-points", points.Group)
+		assert.Equal(t, 3, points.Concurrency)
+		assert.False(t, points.DLQ)
+		assert.Equal(t, []string{"points-timeseries-data", "points-timeseries-data-2", "points-timeseries-data-3"}, points.Consumers)
+	})
+
+	t.Run("Should reject invalid config", func(t *testing.T) {
+		for name, cfg := range map[string]*config.KafkaConfig{
+			"unknown pipeline": {Pipelines: map[string]config.KafkaPipelineConfig{"alarms": {Concurrency: 2}}},
+			"unknown topic":    {Pipelines: map[string]config.KafkaPipelineConfig{"points": {Topic: "timeseries-data-v2"}}},
+			"shared group": {Pipelines: map[string]config.KafkaPipelineConfig{
+				"events": {Group: "digital-egiz-ingest"},
+				"points": {Group: "digital-egiz-ingest"},
+			}},
+			"negative concurrency": {Pipelines: map[string]config.KafkaPipelineConfig{"points": {Concurrency: -1}}},
+		} {
+			_, err := newRegistry(t).Resolve(cfg)
+			assert.Error(t, err, name)
+		}
+	})
+
+	t.Run("Should allow pipelines to join the shared consumer group explicitly", func(t *testing.T) {
+		_, err := newRegistry(t).Resolve(&config.KafkaConfig{
+			ConsumerGroup: "digital-egiz",
+			Pipelines: map[string]config.KafkaPipelineConfig{
+				"events": {Group: "digital-egiz"},
+				"points": {Group: "digital-egiz"},
+			},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Should add no consumers for invalid config", func(t *testing.T) {
+		bus := testutils.NewFakeKafka()
+		_, err := newRegistry(t).Wire(bus, &config.KafkaConfig{
+			Pipelines: map[string]config.KafkaPipelineConfig{"points": {Topic: "unknown"}},
+		})
+		require.Error(t, err)
+
+		_, ok := bus.ConsumerOptions("events-ditto-events")
+		assert.False(t, ok)
+	})
+}
+
+func TestPipelineRegistry_Wire(t *testing.T) {
+	bus := testutils.NewFakeKafka()
+	disabled := false
+
+	var received []string
+	registry := kafka.NewPipelineRegistry()
+	require.NoError(t, registry.Register(kafka.Pipeline{
+		Name:  "points",
+		Topic: kafka.TopicTimeSeriesData,
+		Handler: kafka.TimeSeriesDataHandler(func(thingID, featureID string, timestamp time.Time, data json.RawMessage, source string) error {
+			received = append(received, thingID+"/"+featureID)
+			return nil
+		}),
+	}))
+
+	specs, err := registry.Wire(bus, &config.KafkaConfig{
+		ConsumerGroup: "digital-egiz",
+		Pipelines: map[string]config.KafkaPipelineConfig{
+			"points": {Group: "digital-egiz-points", Concurrency: 2, DLQ: &disabled},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, specs, 1)
+
+	t.Run("Should add the pipeline's consumers with its settings", func(t *testing.T) {
+		for _, consumer := range specs[0].Consumers {
+			opts, ok := bus.ConsumerOptions(consumer)
+			require.True(t, ok, consumer)
+			assert.Equal(t, "digital-egiz-points", opts.Group)
+			assert.True(t, opts.DisableDLQ)
+		}
+	})
+
+	t.Run("Should deliver each message once to the pipeline's group", func(t *testing.T) {
+		require.NoError(t, bus.ProduceTimeSeriesData("org.digitalegiz:pump-1", "pressure", 4.2, ""))
+		assert.Equal(t, []string{"org.digitalegiz:pump-1/pressure"}, received)
+	})
+}
+
+func TestManager_ConsumerOptions(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	cluster, err := confluent.NewMockCluster(1)
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	manager, err := kafka.NewManager(&config.KafkaConfig{
+		Brokers:       cluster.BootstrapServers(),
+		ConsumerGroup: "digital-egiz-test",
+	}, ts.Logger)
+	require.NoError(t, err)
+
+	noop := map[string][]kafka.MessageHandler{kafka.TopicMLOutput: {func(msg *confluent.Message) error { return nil }}}
+	require.NoError(t, manager.AddConsumer("shared", []string{kafka.TopicMLOutput}, noop))
+	require.NoError(t, manager.AddConsumerWithOptions("own", []string{kafka.TopicMLOutput}, noop,
+		kafka.ConsumerOptions{Group: "digital-egiz-own", DisableDLQ: true}))
+	defer manager.RemoveConsumer("shared")
+	defer manager.RemoveConsumer("own")
+
+	t.Run("Should join the consumer group of the options", func(t *testing.T) {
+		groups := make(map[string]string)
+		for _, consumer := range manager.ListConsumers() {
+			groups[consumer.Name] = consumer.Group
+		}
+		assert.Equal(t, map[string]string{"shared": "digital-egiz-test", "own": "digital-egiz-own"}, groups)
+	})
+}
@@ -0,0 +1,105 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	// component records its start and stop in events
+	component := func(name string, events *[]string, startErr, stopErr error) *lifecycle.Hook {
+		return &lifecycle.Hook{
+			ComponentName: name,
+			OnStart: func(ctx context.Context) error {
+				*events = append(*events, "start "+name)
+				return startErr
+			},
+			OnStop: func(ctx context.Context) error {
+				*events = append(*events, "stop "+name)
+				return stopErr
+			},
+		}
+	}
+
+	t.Run("Should start in order and stop in reverse", func(t *testing.T) {
+		var events []string
+		registry := lifecycle.NewRegistry(ts.Logger)
+		registry.Register(
+			component("connections", &events, nil, nil),
+			component("buffers", &events, nil, nil),
+			component("ingest", &events, nil, nil),
+		)
+
+		require.NoError(t, registry.Start(context.Background()))
+		require.NoError(t, registry.Stop(context.Background()))
+
+		assert.Equal(t, []string{
+			"start connections", "start buffers", "start ingest",
+			"stop ingest", "stop buffers", "stop connections",
+		}, events)
+	})
+
+	t.Run("Should stop started components when a start fails", func(t *testing.T) {
+		var events []string
+		registry := lifecycle.NewRegistry(ts.Logger)
+		registry.Register(
+			component("connections", &events, nil, nil),
+			component("ingest", &events, errors.New("unreachable"), nil),
+			component("never", &events, nil, nil),
+		)
+
+		err := registry.Start(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, "failed to start ingest: unreachable", err.Error())
+		assert.Equal(t, []string{"start connections", "start ingest", "stop connections"}, events)
+	})
+
+	t.Run("Should stop every component and report the failures", func(t *testing.T) {
+		var events []string
+		registry := lifecycle.NewRegistry(ts.Logger)
+		registry.Register(
+			component("connections", &events, nil, nil),
+			component("ingest", &events, nil, errors.New("stuck")),
+		)
+
+		require.NoError(t, registry.Start(context.Background()))
+		err := registry.Stop(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to stop ingest: stuck")
+		assert.Equal(t, []string{"start connections", "start ingest", "stop ingest", "stop connections"}, events)
+
+		// Stopped components are not stopped twice
+		require.NoError(t, registry.Stop(context.Background()))
+		assert.Len(t, events, 4)
+	})
+
+	t.Run("Should pass the shutdown deadline to the components", func(t *testing.T) {
+		registry := lifecycle.NewRegistry(ts.Logger)
+		registry.Register(&lifecycle.Hook{
+			ComponentName: "buffer",
+			OnStop: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		})
+		require.NoError(t, registry.Start(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := registry.Stop(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
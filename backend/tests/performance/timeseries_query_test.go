@@ -1,6 +1,7 @@
 package performance
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -30,7 +31,7 @@ func TestTimeseriesDataQueryPerformance(t *testing.T) {
 	twinID := createTestTwin(t, ts, projectID)
 
 	// Create history service
-	historyService := services.NewHistoryService(ts.DB, ts.Logger)
+	historyService := services.NewHistoryService(ts.DB, &ts.Config.Cache, &ts.Config.Alerts, &ts.Config.History, ts.Logger)
 
 	// Create test time-series data
 	featurePath := "temperature"
@@ -58,7 +59,7 @@ func TestTimeseriesDataQueryPerformance(t *testing.T) {
 
 				// Measure query time
 				startQuery := time.Now()
-				data, err := historyService.GetTimeseriesData(twinID, featurePath, startTime, endTime, tc.limit)
+				data, err := historyService.GetTimeseriesData(context.Background(), twinID, featurePath, startTime, endTime, services.TimeseriesPage{Limit: tc.limit})
 				queryDuration := time.Since(startQuery)
 
 				// Assert query success
@@ -94,7 +95,7 @@ func TestTimeseriesDataQueryPerformance(t *testing.T) {
 
 				// Measure query time
 				startQuery := time.Now()
-				data, err := historyService.GetAggregatedData(twinID, featurePath, startTime, endTime, tc.interval)
+				data, err := historyService.GetAggregatedData(context.Background(), twinID, featurePath, startTime, endTime, tc.interval)
 				queryDuration := time.Since(startQuery)
 
 				// Assert query success
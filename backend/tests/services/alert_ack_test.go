@@ -0,0 +1,93 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryService_AcknowledgeAlertPolicy(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.AlertData{})
+	userID := ts.SeedTestUser("operator@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	insertAlert := func(alertID, severity string) {
+		require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+			Time:     time.Now(),
+			AlertID:  alertID,
+			TwinID:   "org.digitalegiz.project1:pump-1",
+			Severity: severity,
+			Message:  "Pressure out of range",
+			Source:   "rule",
+		}))
+	}
+
+	// ackNote reads the stored acknowledgement of an alert
+	ackNote := func(alertID string) (bool, string) {
+		var row struct {
+			Acknowledged bool
+			AckNote      string
+		}
+		require.NoError(t, ts.DB.DB.Model(&models.AlertData{}).
+			Select("acknowledged", "ack_note").
+			Where("alert_id = ?", alertID).
+			Scan(&row).Error)
+		return row.Acknowledged, row.AckNote
+	}
+
+	service := services.NewHistoryService(ts.DB, nil, &config.AlertConfig{
+		AckNoteRequired: []string{"critical", "error"},
+	}, nil, ts.Logger)
+
+	t.Run("Should require a note for critical alerts", func(t *testing.T) {
+		insertAlert("alert-critical", "critical")
+
+		err := service.AcknowledgeAlert("alert-critical", userID, "  ")
+		require.Error(t, err)
+		assert.Equal(t, "ack note required for critical alerts", err.Error())
+
+		acknowledged, _ := ackNote("alert-critical")
+		assert.False(t, acknowledged)
+	})
+
+	t.Run("Should store the note for critical alerts", func(t *testing.T) {
+		require.NoError(t, service.AcknowledgeAlert("alert-critical", userID, "Valve replaced on site"))
+
+		acknowledged, note := ackNote("alert-critical")
+		assert.True(t, acknowledged)
+		assert.Equal(t, "Valve replaced on site", note)
+	})
+
+	t.Run("Should allow acknowledging warnings without a note", func(t *testing.T) {
+		insertAlert("alert-warning", "warning")
+
+		require.NoError(t, service.AcknowledgeAlert("alert-warning", userID, ""))
+
+		acknowledged, note := ackNote("alert-warning")
+		assert.True(t, acknowledged)
+		assert.Empty(t, note)
+	})
+
+	t.Run("Should not acknowledge twice", func(t *testing.T) {
+		err := service.AcknowledgeAlert("alert-warning", userID, "again")
+		require.Error(t, err)
+		assert.Equal(t, "alert not found or already acknowledged", err.Error())
+	})
+
+	t.Run("Should allow any alert without a note when no policy is configured", func(t *testing.T) {
+		insertAlert("alert-error", "error")
+
+		lenient := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+		require.NoError(t, lenient.AcknowledgeAlert("alert-error", userID, ""))
+	})
+}
@@ -0,0 +1,136 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertEnricher(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{})
+	ts.CreateTimeseriesTables()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	thingID := "org.digitalegiz.project1:boiler-1"
+	alertTime := time.Now().UTC().Truncate(time.Second)
+	record := func(featurePath string, ago time.Duration, value float64) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time: alertTime.Add(-ago), TwinID: thingID, FeaturePath: featurePath, ValueType: "number", ValueNum: value,
+		}))
+	}
+	for i, value := range []float64{70, 72, 75, 81, 96} {
+		record("temperature", time.Duration(5-i)*time.Minute, value)
+	}
+	// Recorded after the alert, so not part of its context
+	record("temperature", -time.Minute, 99)
+	record("pressure", 10*time.Minute, 2.1)
+	record("pressure", 2*time.Minute, 2.4)
+	record("pressure", -time.Minute, 3)
+	burning := true
+	require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+		Time: alertTime.Add(-3 * time.Minute), TwinID: thingID, FeaturePath: "burner", ValueType: "boolean", ValueBool: &burning,
+	}))
+
+	cfg := &config.AlertConfig{ContextPoints: 3, ContextFeatures: []string{"pressure", "burner", "humidity", "temperature"}}
+	enricher := services.NewAlertEnricher(ts.DB, cfg, ts.Logger)
+
+	// stored inserts an enriched alert and reads its context back
+	stored := func(alert *models.AlertData) *services.AlertContext {
+		enricher.Enrich(context.Background(), alert)
+		require.NoError(t, repoFactory.Timeseries().InsertAlertData(alert))
+
+		read, err := repoFactory.Timeseries().GetAlertByID(alert.AlertID)
+		require.NoError(t, err)
+		if len(read.Context) == 0 || string(read.Context) == "null" {
+			return nil
+		}
+		var snapshot services.AlertContext
+		require.NoError(t, json.Unmarshal(read.Context, &snapshot))
+		return &snapshot
+	}
+
+	t.Run("Should capture the latest points of the triggering feature and related values", func(t *testing.T) {
+		snapshot := stored(&models.AlertData{Time: alertTime, AlertID: "overheat", TwinID: thingID, FeaturePath: "temperature",
+			Severity: "critical", Message: "Temperature above 90", Source: "ml"})
+		require.NotNil(t, snapshot)
+
+		require.Len(t, snapshot.RecentPoints, 3)
+		for i, value := range []string{"75", "81", "96"} {
+			assert.JSONEq(t, value, string(snapshot.RecentPoints[i].Value))
+		}
+		assert.True(t, snapshot.RecentPoints[0].Time.Equal(alertTime.Add(-3*time.Minute)))
+		assert.True(t, snapshot.RecentPoints[2].Time.Equal(alertTime.Add(-time.Minute)))
+
+		// The triggering feature and features the twin does not record are not repeated as related
+		require.Len(t, snapshot.RelatedFeatures, 2)
+		assert.JSONEq(t, "2.4", string(snapshot.RelatedFeatures["pressure"].Value))
+		assert.True(t, snapshot.RelatedFeatures["pressure"].Time.Equal(alertTime.Add(-2*time.Minute)))
+		assert.JSONEq(t, "true", string(snapshot.RelatedFeatures["burner"].Value))
+	})
+
+	t.Run("Should capture the context of the alert's time", func(t *testing.T) {
+		snapshot := stored(&models.AlertData{Time: alertTime.Add(-4 * time.Minute), AlertID: "backfilled", TwinID: thingID,
+			FeaturePath: "temperature", Severity: "warning", Source: "ml-backfill"})
+		require.NotNil(t, snapshot)
+
+		require.Len(t, snapshot.RecentPoints, 2)
+		assert.JSONEq(t, "72", string(snapshot.RecentPoints[1].Value))
+		assert.JSONEq(t, "2.1", string(snapshot.RelatedFeatures["pressure"].Value))
+		assert.NotContains(t, snapshot.RelatedFeatures, "burner")
+	})
+
+	t.Run("Should capture related values of alerts without a feature", func(t *testing.T) {
+		snapshot := stored(&models.AlertData{Time: alertTime, AlertID: "clock", TwinID: thingID, Severity: "warning", Source: "ingest"})
+		require.NotNil(t, snapshot)
+
+		assert.Empty(t, snapshot.RecentPoints)
+		assert.Len(t, snapshot.RelatedFeatures, 3)
+		assert.JSONEq(t, "96", string(snapshot.RelatedFeatures["temperature"].Value))
+	})
+
+	t.Run("Should leave alerts without data uncontextualized", func(t *testing.T) {
+		assert.Nil(t, stored(&models.AlertData{Time: alertTime, AlertID: "unknown", TwinID: "org.digitalegiz.project1:unknown",
+			FeaturePath: "temperature", Severity: "info", Source: "ml"}))
+	})
+
+	t.Run("Should store the context on alerts raised during ingestion", func(t *testing.T) {
+		project := &models.Project{Name: "Plant"}
+		require.NoError(t, ts.DB.DB.Create(project).Error)
+		twin := &models.Twin{Name: "Boiler", DittoID: thingID, ProjectID: project.ID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID:                  twin.ID,
+			FeaturePath:             "pressure",
+			ExpectedType:            "number",
+			TypeViolationMode:       models.TypeViolationDrop,
+			ViolationAlertThreshold: 1,
+		}))
+
+		ingestService := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+		ingestService.SetAlertEnricher(enricher)
+		_, err := ingestService.Ingest(twin, []services.FeatureValue{{FeatureID: "pressure", Data: json.RawMessage(`"high"`)}})
+		require.NoError(t, err)
+
+		var alerts []models.AlertData
+		require.NoError(t, ts.DB.DB.Where("twin_id = ? AND source = ?", thingID, "ingest").Order("time desc").Find(&alerts).Error)
+		require.NotEmpty(t, alerts)
+		var snapshot services.AlertContext
+		require.NoError(t, json.Unmarshal(alerts[0].Context, &snapshot))
+		// The rejected value is not stored, and points timestamped ahead are not captured yet
+		require.Len(t, snapshot.RecentPoints, 2)
+		assert.JSONEq(t, "2.4", string(snapshot.RecentPoints[1].Value))
+		assert.JSONEq(t, "96", string(snapshot.RelatedFeatures["temperature"].Value))
+	})
+}
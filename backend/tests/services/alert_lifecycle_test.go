@@ -0,0 +1,162 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertLifecycleEvents(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.WebhookSubscription{}, &models.Notification{}, &models.NotificationDelivery{}, &models.AlertRoute{}, &models.AlertData{})
+	userID := ts.SeedTestUser("lifecycle@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	plant := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(plant))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	pump := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.plant:lifecycle-pump", TypeID: twinType.ID, ProjectID: plant.ID}
+	require.NoError(t, repoFactory.Twin().Create(pump))
+
+	// The ticketing system only subscribes to acknowledgements
+	var mu sync.Mutex
+	var received []services.WebhookEvent
+	ticketing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event services.WebhookEvent
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &event)
+		mu.Lock()
+		received = append(received, event)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ticketing.Close()
+
+	webhookService := services.NewWebhookService(ts.DB, ts.Logger)
+	webhookService.SetAllowPrivateNetworks(true)
+	require.NoError(t, webhookService.CreateSubscription(&models.WebhookSubscription{
+		ProjectID: plant.ID, URL: ticketing.URL, EventTypes: models.WebhookEventAlertAcknowledged,
+	}))
+
+	bus := testutils.NewFakeKafka()
+	now := time.Now()
+	deliveryService := services.NewDeliveryService(ts.DB, &config.NotificationConfig{MaxAttempts: 3, RetryBaseDelay: 30}, ts.Logger)
+	deliveryService.SetClock(func() time.Time { return now })
+	deliveryService.RegisterChannel(services.NewWebhookChannel(webhookService))
+	deliveryService.RegisterChannel(services.NewKafkaChannel(bus, "alert-events"))
+
+	historyService := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+	historyService.SetAlertRouting(services.NewAlertRoutingService(ts.DB, deliveryService, nil, ts.Logger))
+
+	insertAlert := func(alertID string) {
+		require.NoError(t, repoFactory.Timeseries().InsertAlertData(&models.AlertData{
+			Time:        time.Now(),
+			AlertID:     alertID,
+			TwinID:      pump.DittoID,
+			FeaturePath: "pressure",
+			Severity:    "critical",
+			Message:     "Pressure out of range",
+			Source:      "rule",
+		}))
+	}
+	eventsOf := func(alertID string) []models.Notification {
+		var notifications []models.Notification
+		require.NoError(t, ts.DB.DB.Where("event_type = ? AND payload LIKE ?",
+			models.WebhookEventAlertAcknowledged, `%"`+alertID+`"%`).Find(&notifications).Error)
+		return notifications
+	}
+
+	t.Run("Should publish the acknowledgement to webhooks and Kafka", func(t *testing.T) {
+		insertAlert("lifecycle-ack")
+		kafkaBefore := len(bus.Messages("alert-events"))
+
+		require.NoError(t, historyService.AcknowledgeAlert("lifecycle-ack", userID, "  Valve replaced on site "))
+
+		notifications := eventsOf("lifecycle-ack")
+		require.Len(t, notifications, 1)
+		assert.Equal(t, plant.ID, notifications[0].ProjectID)
+
+		var event services.AlertLifecycleEvent
+		require.NoError(t, json.Unmarshal(notifications[0].Payload, &event))
+		assert.Equal(t, "lifecycle-ack", event.AlertID)
+		assert.Equal(t, pump.DittoID, event.DittoID)
+		assert.Equal(t, "pressure", event.FeaturePath)
+		assert.Equal(t, "critical", event.Severity)
+		assert.Equal(t, services.AlertStateAcknowledged, event.State)
+		assert.Equal(t, "Test User", event.Actor)
+		assert.Equal(t, "Valve replaced on site", event.Note)
+		assert.WithinDuration(t, time.Now(), event.Time, time.Minute)
+
+		mu.Lock()
+		require.NotEmpty(t, received)
+		webhook := received[len(received)-1]
+		mu.Unlock()
+		assert.Equal(t, models.WebhookEventAlertAcknowledged, webhook.Type)
+		assert.Equal(t, notifications[0].EventID, webhook.ID)
+		payload, err := json.Marshal(webhook.Payload)
+		require.NoError(t, err)
+		assert.JSONEq(t, string(notifications[0].Payload), string(payload))
+
+		messages := bus.Messages("alert-events")
+		require.Len(t, messages, kafkaBefore+1)
+		message := messages[len(messages)-1]
+		assert.Equal(t, strconv.FormatUint(uint64(plant.ID), 10), string(message.Key))
+		require.Len(t, message.Headers, 1)
+		assert.Equal(t, models.WebhookEventAlertAcknowledged, string(message.Headers[0].Value))
+		var published services.WebhookEvent
+		require.NoError(t, json.Unmarshal(message.Value, &published))
+		assert.Equal(t, notifications[0].EventID, published.ID)
+	})
+
+	t.Run("Should not publish rejected acknowledgements", func(t *testing.T) {
+		require.Error(t, historyService.AcknowledgeAlert("lifecycle-ack", userID, "again"))
+		assert.Len(t, eventsOf("lifecycle-ack"), 1)
+
+		require.Error(t, historyService.AcknowledgeAlert("lifecycle-unknown", userID, ""))
+		assert.Empty(t, eventsOf("lifecycle-unknown"))
+	})
+
+	t.Run("Should retry the event while Kafka is unavailable", func(t *testing.T) {
+		insertAlert("lifecycle-retry")
+		kafkaBefore := len(bus.Messages("alert-events"))
+		bus.SetFailure(errors.New("broker unavailable"))
+
+		require.NoError(t, historyService.AcknowledgeAlert("lifecycle-retry", userID, ""))
+		notifications := eventsOf("lifecycle-retry")
+		require.Len(t, notifications, 1)
+		receipt, err := deliveryService.Deliveries(notifications[0].ID)
+		require.NoError(t, err)
+		statuses := map[string]string{}
+		for _, delivery := range receipt.Deliveries {
+			statuses[delivery.Channel] = delivery.Status
+		}
+		assert.Equal(t, models.DeliveryStatusDelivered, statuses[services.DeliveryChannelWebhook])
+		assert.Equal(t, models.DeliveryStatusPending, statuses[services.DeliveryChannelKafka])
+		assert.Len(t, bus.Messages("alert-events"), kafkaBefore)
+
+		bus.SetFailure(nil)
+		now = now.Add(time.Hour)
+		_, err = deliveryService.RetryDue(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, bus.Messages("alert-events"), kafkaBefore+1)
+	})
+}
@@ -0,0 +1,257 @@
+package services_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlertRoutingService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.WebhookSubscription{},
+		&models.Notification{}, &models.NotificationDelivery{}, &models.AlertRoute{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	plant := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(plant))
+	other := &models.Project{Name: "Other Plant"}
+	require.NoError(t, repoFactory.Project().Create(other))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	newTwin := func(projectID uint, dittoID string) *models.Twin {
+		twin := &models.Twin{Name: dittoID, DittoID: dittoID, TypeID: twinType.ID, ProjectID: projectID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		return twin
+	}
+	pump := newTwin(plant.ID, "org.digitalegiz.plant:pump-1")
+	valve := newTwin(plant.ID, "org.digitalegiz.plant:valve-1")
+	foreign := newTwin(other.ID, "org.digitalegiz.other:pump-1")
+
+	// The maintenance team's pager and the operations dashboard receive webhooks
+	var mu sync.Mutex
+	received := make(map[string][]services.WebhookEvent)
+	receiver := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var event services.WebhookEvent
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &event)
+			mu.Lock()
+			received[name] = append(received[name], event)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}))
+	}
+	pager := receiver("pager")
+	defer pager.Close()
+	dashboard := receiver("dashboard")
+	defer dashboard.Close()
+	receivedBy := func(name string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received[name])
+	}
+
+	webhookService := services.NewWebhookService(ts.DB, ts.Logger)
+	webhookService.SetAllowPrivateNetworks(true)
+	pagerSub := &models.WebhookSubscription{ProjectID: plant.ID, URL: pager.URL}
+	require.NoError(t, webhookService.CreateSubscription(pagerSub))
+	dashboardSub := &models.WebhookSubscription{ProjectID: plant.ID, URL: dashboard.URL}
+	require.NoError(t, webhookService.CreateSubscription(dashboardSub))
+	foreignSub := &models.WebhookSubscription{ProjectID: other.ID, URL: dashboard.URL}
+	require.NoError(t, webhookService.CreateSubscription(foreignSub))
+
+	notificationService := services.NewNotificationService(nil, ts.Logger)
+	defer notificationService.Close()
+	deliveryService := services.NewDeliveryService(ts.DB, &ts.Config.Notifications, ts.Logger)
+	deliveryService.RegisterChannel(services.NewWebhookChannel(webhookService))
+	deliveryService.RegisterChannel(services.NewWebSocketChannel(notificationService))
+
+	routing := services.NewAlertRoutingService(ts.DB, deliveryService, notificationService, ts.Logger)
+	subID := func(subscription *models.WebhookSubscription) string {
+		return strconv.FormatUint(uint64(subscription.ID), 10)
+	}
+	inApp := "project:" + strconv.FormatUint(uint64(plant.ID), 10)
+	targets := func(receipt *services.NotificationReceipt) []string {
+		var result []string
+		for _, delivery := range receipt.Deliveries {
+			result = append(result, delivery.Channel+"/"+delivery.Recipient)
+		}
+		return result
+	}
+	alert := func(twin *models.Twin, severity, featurePath string) *models.AlertData {
+		return &models.AlertData{
+			Time:        time.Now(),
+			AlertID:     twin.DittoID + "-" + severity,
+			TwinID:      twin.DittoID,
+			FeaturePath: featurePath,
+			Severity:    severity,
+			Message:     "pressure out of range",
+			Source:      "ml",
+		}
+	}
+
+	t.Run("Should validate routing targets", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			route models.AlertRoute
+			err   string
+		}{
+			"unknown channel":       {models.AlertRoute{Channel: "sms"}, "unknown delivery channel: sms"},
+			"unknown subscription":  {models.AlertRoute{Channel: services.DeliveryChannelWebhook, Recipients: "999"}, "webhook subscription not found"},
+			"foreign subscription":  {models.AlertRoute{Channel: services.DeliveryChannelWebhook, Recipients: subID(foreignSub)}, "webhook subscription not found"},
+			"other project clients": {models.AlertRoute{Channel: services.DeliveryChannelWebSocket, Recipients: "project:999"}, "can only be sent to " + inApp},
+			"unknown severity":      {models.AlertRoute{Channel: services.DeliveryChannelWebSocket, Severities: "critical,fatal"}, "unknown severity: fatal"},
+			"foreign twin":          {models.AlertRoute{Channel: services.DeliveryChannelWebSocket, TwinID: &foreign.ID}, "twin not found in project"},
+		} {
+			route := tc.route
+			route.ProjectID = plant.ID
+			err := routing.CreateRoute(&route)
+			require.Error(t, err, name)
+			assert.Contains(t, err.Error(), tc.err, name)
+		}
+
+		routes, err := routing.ListRoutes(plant.ID)
+		require.NoError(t, err)
+		assert.Empty(t, routes)
+	})
+
+	t.Run("Should deliver alerts according to the matching rule", func(t *testing.T) {
+		// Critical pump alerts page the maintenance team, info alerts only show in-app
+		require.NoError(t, routing.CreateRoute(&models.AlertRoute{
+			ProjectID: plant.ID, TwinID: &pump.ID, Severities: "error, critical",
+			Channel: services.DeliveryChannelWebhook, Recipients: subID(pagerSub),
+		}))
+		require.NoError(t, routing.CreateRoute(&models.AlertRoute{
+			ProjectID: plant.ID, Severities: "info", Channel: services.DeliveryChannelWebSocket,
+		}))
+
+		receipt, err := routing.Route(pump, alert(pump, "critical", "pressure"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebhook + "/" + subID(pagerSub)}, targets(receipt))
+		assert.Equal(t, models.DeliveryStatusDelivered, receipt.Deliveries[0].Status)
+		assert.Equal(t, models.WebhookEventAlertCreated, receipt.Notification.EventType)
+		assert.Equal(t, 1, receivedBy("pager"))
+		assert.Equal(t, 0, receivedBy("dashboard"))
+
+		receipt, err = routing.Route(pump, alert(pump, "info", "pressure"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebSocket + "/" + inApp}, targets(receipt))
+		assert.Equal(t, 1, receivedBy("pager"))
+
+		routes, err := routing.ListRoutes(plant.ID)
+		require.NoError(t, err)
+		require.Len(t, routes, 2)
+		assert.Equal(t, "error,critical", routes[0].Severities)
+	})
+
+	t.Run("Should prefer the twin's routes over the project's", func(t *testing.T) {
+		require.NoError(t, routing.CreateRoute(&models.AlertRoute{
+			ProjectID: plant.ID, Severities: "critical", Channel: services.DeliveryChannelWebhook,
+			Recipients: subID(dashboardSub),
+		}))
+
+		receipt, err := routing.Route(pump, alert(pump, "critical", "pressure"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebhook + "/" + subID(pagerSub)}, targets(receipt))
+
+		// The valve has no route of its own, so the project's applies
+		receipt, err = routing.Route(valve, alert(valve, "critical", "position"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebhook + "/" + subID(dashboardSub)}, targets(receipt))
+		assert.Equal(t, 2, receivedBy("pager"))
+		assert.Equal(t, 1, receivedBy("dashboard"))
+	})
+
+	t.Run("Should match routes by feature path", func(t *testing.T) {
+		require.NoError(t, routing.CreateRoute(&models.AlertRoute{
+			ProjectID: plant.ID, TwinID: &valve.ID, Position: -1, FeaturePath: "actuator*",
+			Channel: services.DeliveryChannelWebSocket, Recipients: inApp,
+		}))
+
+		receipt, err := routing.Route(valve, alert(valve, "critical", "actuator/current"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebSocket + "/" + inApp}, targets(receipt))
+
+		receipt, err = routing.Route(valve, alert(valve, "critical", "position"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{services.DeliveryChannelWebhook + "/" + subID(dashboardSub)}, targets(receipt))
+	})
+
+	t.Run("Should push unrouted alerts to the project's clients and webhooks", func(t *testing.T) {
+		pagerBefore, dashboardBefore := receivedBy("pager"), receivedBy("dashboard")
+
+		// A websocket client of the plant subscribed to twin alerts before routing existed
+		upgrader := websocket.Upgrader{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			notificationService.RegisterClient(conn, 1, plant.ID, false)
+		}))
+		defer server.Close()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		require.NoError(t, err)
+		defer conn.Close()
+		require.Eventually(t, func() bool { return notificationService.ClientCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		unrouted := alert(pump, "warning", "pressure")
+		receipt, err := routing.Route(pump, unrouted)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{
+			services.DeliveryChannelWebhook + "/" + subID(pagerSub),
+			services.DeliveryChannelWebhook + "/" + subID(dashboardSub),
+		}, targets(receipt))
+		assert.Equal(t, pagerBefore+1, receivedBy("pager"))
+		assert.Equal(t, dashboardBefore+1, receivedBy("dashboard"))
+
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		var message struct {
+			Type    services.NotificationType `json:"type"`
+			Topic   string                    `json:"topic"`
+			Payload models.AlertData          `json:"payload"`
+		}
+		require.NoError(t, conn.ReadJSON(&message))
+		assert.Equal(t, services.NotificationTypeAlert, message.Type)
+		assert.Equal(t, "twins/"+pump.DittoID, message.Topic)
+		assert.Equal(t, unrouted.AlertID, message.Payload.AlertID)
+	})
+
+	t.Run("Should route stored alerts by the twin's Ditto ID", func(t *testing.T) {
+		pagerBefore := receivedBy("pager")
+		routing.RouteStored(alert(pump, "error", "pressure"))
+		assert.Equal(t, pagerBefore+1, receivedBy("pager"))
+
+		// Alerts of unknown twins are not delivered
+		routing.RouteStored(&models.AlertData{TwinID: "org.digitalegiz.plant:unknown", Severity: "critical"})
+		assert.Equal(t, pagerBefore+1, receivedBy("pager"))
+	})
+
+	t.Run("Should delete routes of the project only", func(t *testing.T) {
+		routes, err := routing.ListRoutes(plant.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, routes)
+
+		assert.EqualError(t, routing.DeleteRoute(other.ID, routes[0].ID), "alert route not found")
+		require.NoError(t, routing.DeleteRoute(plant.ID, routes[0].ID))
+
+		remaining, err := routing.ListRoutes(plant.ID)
+		require.NoError(t, err)
+		assert.Len(t, remaining, len(routes)-1)
+	})
+}
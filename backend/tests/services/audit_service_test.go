@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.AuditEntry{})
+	cfg := &config.AuditConfig{Enabled: true, SigningKey: "audit-test-key"}
+	service := services.NewAuditService(ts.DB, cfg, nil, ts.Logger)
+
+	userID := uint(7)
+	start := time.Now().UTC().Add(-time.Minute)
+	for i, path := range []string{"/api/v1/projects", "/api/v1/twins/1", "/api/v1/twins/1/tags"} {
+		require.NoError(t, service.Record(&models.AuditEntry{
+			Time:     start.Add(time.Duration(i) * time.Second),
+			UserID:   &userID,
+			Method:   "POST",
+			Path:     path,
+			Status:   200,
+			ClientIP: "10.0.0.1",
+		}))
+	}
+
+	export := func(t *testing.T) *services.AuditArchive {
+		archive, err := service.Export(start.Add(-time.Second), time.Now().UTC().Add(time.Minute))
+		require.NoError(t, err)
+		return archive
+	}
+
+	t.Run("Should export a chain that validates", func(t *testing.T) {
+		archive := export(t)
+		require.Len(t, archive.Entries, 3)
+		assert.Empty(t, archive.Entries[0].PrevHash)
+		for i := 1; i < len(archive.Entries); i++ {
+			assert.Equal(t, archive.Entries[i-1].Hash, archive.Entries[i].PrevHash)
+		}
+		assert.NoError(t, service.VerifyArchive(archive))
+	})
+
+	t.Run("Should still validate after a JSON round trip", func(t *testing.T) {
+		data, err := json.Marshal(export(t))
+		require.NoError(t, err)
+
+		var decoded services.AuditArchive
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.NoError(t, service.VerifyArchive(&decoded))
+	})
+
+	t.Run("Should detect an entry modified in an archive", func(t *testing.T) {
+		archive := export(t)
+		archive.Entries[1].Status = 403
+		assert.ErrorIs(t, service.VerifyArchive(archive), services.ErrAuditTampered)
+	})
+
+	t.Run("Should detect a removed entry", func(t *testing.T) {
+		archive := export(t)
+		archive.Entries = append(archive.Entries[:1], archive.Entries[2:]...)
+		assert.ErrorIs(t, services.VerifyAuditChain(archive.Entries), services.ErrAuditTampered)
+	})
+
+	t.Run("Should detect a re-hashed entry by the signature", func(t *testing.T) {
+		archive := export(t)
+		last := &archive.Entries[len(archive.Entries)-1]
+		last.Path = "/api/v1/users/1"
+		last.Hash = last.ComputeHash()
+
+		require.NoError(t, services.VerifyAuditChain(archive.Entries))
+		assert.ErrorIs(t, service.VerifyArchive(archive), services.ErrAuditTampered)
+	})
+
+	t.Run("Should detect an entry modified in the database", func(t *testing.T) {
+		var first models.AuditEntry
+		require.NoError(t, ts.DB.DB.Order("id asc").First(&first).Error)
+		require.NoError(t, ts.DB.DB.Model(&models.AuditEntry{}).Where("id = ?", first.ID).Update("path", "/api/v1/other").Error)
+
+		err := service.VerifyArchive(export(t))
+		assert.ErrorIs(t, err, services.ErrAuditTampered)
+		assert.Contains(t, err.Error(), "has been modified")
+	})
+
+	t.Run("Should reject an empty range", func(t *testing.T) {
+		_, err := service.Export(start, start)
+		assert.Error(t, err)
+	})
+}
+
+func TestAuditService_Retention(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.AuditEntry{})
+	dir := t.TempDir()
+	cfg := &config.AuditConfig{Enabled: true, RetentionDays: 30, SigningKey: "audit-test-key"}
+	service := services.NewAuditService(ts.DB, cfg, services.NewDirectoryArchiver(dir), ts.Logger)
+
+	now := time.Now().UTC()
+	for _, at := range []time.Time{now.AddDate(0, 0, -40), now.AddDate(0, 0, -35), now.Add(-time.Hour), now} {
+		require.NoError(t, service.Record(&models.AuditEntry{Time: at, Method: "DELETE", Path: "/api/v1/twins/1", Status: 204}))
+	}
+
+	require.NoError(t, service.ApplyRetention(context.Background()))
+
+	t.Run("Should archive expired entries as a signed archive", func(t *testing.T) {
+		files, err := filepath.Glob(filepath.Join(dir, "audit-*.json"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		var archive services.AuditArchive
+		require.NoError(t, json.Unmarshal(data, &archive))
+		assert.Len(t, archive.Entries, 2)
+		assert.NoError(t, service.VerifyArchive(&archive))
+	})
+
+	t.Run("Should keep recent entries chained to the archived ones", func(t *testing.T) {
+		var remaining []models.AuditEntry
+		require.NoError(t, ts.DB.DB.Order("id asc").Find(&remaining).Error)
+		require.Len(t, remaining, 2)
+		assert.NotEmpty(t, remaining[0].PrevHash)
+		assert.NoError(t, services.VerifyAuditChain(remaining))
+
+		// New entries continue the chain
+		require.NoError(t, service.Record(&models.AuditEntry{Time: time.Now(), Method: "POST", Path: "/api/v1/projects", Status: 201}))
+		archive, err := service.Export(now.Add(-2*time.Hour), time.Now().UTC().Add(time.Minute))
+		require.NoError(t, err)
+		require.Len(t, archive.Entries, 3)
+		assert.NoError(t, service.VerifyArchive(archive))
+	})
+}
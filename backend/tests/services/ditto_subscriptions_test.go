@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDittoSubscriptions(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{})
+	userID := ts.SeedTestUser("subscriptions@example.com", "password123", false)
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	manager := fakeDitto.NewManager(ts.Logger)
+
+	var (
+		mu     sync.Mutex
+		events []string
+	)
+	manager.SetEventHandler(func(event *ditto.DittoEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event.ThingID)
+	})
+	received := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events...)
+	}
+
+	// lastCommand returns the last command sent to Ditto once count commands were sent
+	lastCommand := func(count int) (string, []string) {
+		require.Eventually(t, func() bool { return len(fakeDitto.Subscriptions()) == count }, 5*time.Second, 10*time.Millisecond)
+		var command struct {
+			Type    string `json:"type"`
+			Payload struct {
+				Namespaces []string `json:"namespaces"`
+			} `json:"payload"`
+		}
+		commands := fakeDitto.Subscriptions()
+		require.NoError(t, json.Unmarshal(commands[len(commands)-1], &command))
+		return command.Type, command.Payload.Namespaces
+	}
+
+	require.NoError(t, manager.Connect())
+	defer manager.Disconnect()
+
+	subscriptions := services.NewDittoSubscriptions(ts.DB, manager, ts.Logger)
+	projectService := services.NewProjectService(ts.DB, ts.Logger)
+	projectService.SetDittoSubscriptions(subscriptions)
+
+	t.Run("Should subscribe to nothing without projects", func(t *testing.T) {
+		require.NoError(t, subscriptions.Refresh())
+		command, namespaces := lastCommand(1)
+		assert.Equal(t, "STOP-SEND-EVENTS", command)
+		assert.Empty(t, namespaces)
+
+		_, err := manager.CreateThing(context.Background(), &ditto.Thing{ThingID: "org.digitalegiz.project99:stray"})
+		require.NoError(t, err)
+		assert.Never(t, func() bool { return len(received()) > 0 }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+
+	t.Run("Should subscribe to a created project's namespace", func(t *testing.T) {
+		require.NoError(t, projectService.Create(project))
+		namespace := manager.ProjectNamespace(project.ID)
+		command, namespaces := lastCommand(2)
+		assert.Equal(t, "START-SEND-EVENTS", command)
+		assert.Equal(t, []string{namespace}, namespaces)
+
+		_, err := manager.CreateThing(context.Background(), &ditto.Thing{ThingID: namespace + ":pump-1"})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(received()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, namespace+":pump-1", received()[0])
+	})
+
+	t.Run("Should add the namespaces of further projects", func(t *testing.T) {
+		other := &models.Project{Name: "Warehouse", CreatedBy: userID}
+		require.NoError(t, projectService.Create(other))
+		_, namespaces := lastCommand(3)
+		assert.ElementsMatch(t, []string{manager.ProjectNamespace(project.ID), manager.ProjectNamespace(other.ID)}, namespaces)
+
+		require.NoError(t, projectService.Delete(other.ID))
+		_, namespaces = lastCommand(4)
+		assert.Equal(t, []string{manager.ProjectNamespace(project.ID)}, namespaces)
+	})
+
+	t.Run("Should stop the subscription when the last project is deleted", func(t *testing.T) {
+		require.NoError(t, projectService.Delete(project.ID))
+		command, _ := lastCommand(5)
+		assert.Equal(t, "STOP-SEND-EVENTS", command)
+
+		_, err := manager.CreateThing(context.Background(), &ditto.Thing{ThingID: manager.ProjectNamespace(project.ID) + ":pump-2"})
+		require.NoError(t, err)
+		assert.Never(t, func() bool { return len(received()) > 1 }, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	t.Run("Should send a subscription refreshed while disconnected once reconnected", func(t *testing.T) {
+		fakeDitto.SetWebSocketAuth(func(string) bool { return false })
+		fakeDitto.CloseWebSockets(websocket.CloseGoingAway, "restarting")
+		require.Eventually(t, func() bool { return !manager.IsConnected() }, 5*time.Second, 10*time.Millisecond)
+
+		restored := &models.Project{Name: "Depot", CreatedBy: userID}
+		require.NoError(t, projectService.Create(restored))
+		fakeDitto.SetWebSocketAuth(nil)
+
+		command, namespaces := lastCommand(6)
+		assert.Equal(t, "START-SEND-EVENTS", command)
+		assert.Equal(t, []string{manager.ProjectNamespace(restored.ID)}, namespaces)
+	})
+}
@@ -0,0 +1,130 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureCatalogService_Rebuild(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.TimeseriesData{}, &models.FeatureCatalogEntry{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	pump := &models.Twin{Name: "Pump", DittoID: "org.digitalegiz.plant:pump-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(pump))
+	valve := &models.Twin{Name: "Valve", DittoID: "org.digitalegiz.plant:valve-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(valve))
+
+	ingest := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+	catalogService := services.NewFeatureCatalogService(ts.DB, ts.Logger)
+
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	value := func(feature string, offset time.Duration, data interface{}) services.FeatureValue {
+		raw, err := json.Marshal(data)
+		require.NoError(t, err)
+		return services.FeatureValue{FeatureID: feature, Timestamp: base.Add(offset), Data: raw}
+	}
+	catalog := func(thingID string) map[string]models.FeatureCatalogEntry {
+		var entries []models.FeatureCatalogEntry
+		require.NoError(t, ts.DB.DB.Where("twin_id = ?", thingID).Find(&entries).Error)
+		result := make(map[string]models.FeatureCatalogEntry, len(entries))
+		for _, entry := range entries {
+			result[entry.FeaturePath] = entry
+		}
+		return result
+	}
+
+	_, err := ingest.Ingest(pump, []services.FeatureValue{
+		value("pressure", 0, 2.5), value("pressure", time.Minute, 2.7), value("status", 0, "running"),
+	})
+	require.NoError(t, err)
+	_, err = ingest.Ingest(valve, []services.FeatureValue{value("position", 0, 40), value("open", time.Minute, true)})
+	require.NoError(t, err)
+
+	t.Run("Should record ingested features in the catalog", func(t *testing.T) {
+		entries := catalog(pump.DittoID)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "number", entries["pressure"].ValueType)
+		assert.Equal(t, "string", entries["status"].ValueType)
+		assert.True(t, base.Equal(entries["status"].LastSeen))
+		assert.Len(t, catalog(valve.DittoID), 2)
+
+		// Last-seen times of a feature are written at most once per touch interval
+		assert.True(t, base.Equal(entries["pressure"].LastSeen))
+	})
+
+	// The catalog drifts: an entry is lost, another has a stale type and time, and one refers
+	// to data deleted meanwhile
+	require.NoError(t, ts.DB.DB.Where("twin_id = ? AND feature_path = ?", pump.DittoID, "status").
+		Delete(&models.FeatureCatalogEntry{}).Error)
+	require.NoError(t, ts.DB.DB.Model(&models.FeatureCatalogEntry{}).
+		Where("twin_id = ? AND feature_path = ?", pump.DittoID, "pressure").
+		Updates(map[string]interface{}{"value_type": "string", "last_seen": base.Add(-24 * time.Hour)}).Error)
+	require.NoError(t, ts.DB.DB.Create(&models.FeatureCatalogEntry{
+		TwinID: valve.DittoID, FeaturePath: "flow", ValueType: "number", LastSeen: base,
+	}).Error)
+	require.NoError(t, ts.DB.DB.Create(&models.FeatureCatalogEntry{
+		TwinID: "org.digitalegiz.plant:removed", FeaturePath: "pressure", ValueType: "number", LastSeen: base,
+	}).Error)
+
+	t.Run("Should rebuild the catalog of a single twin", func(t *testing.T) {
+		result, err := catalogService.Rebuild(context.Background(), pump.ID)
+		require.NoError(t, err)
+		assert.Equal(t, &services.FeatureCatalogRebuild{Twins: 1, Features: 2}, result)
+
+		entries := catalog(pump.DittoID)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "number", entries["pressure"].ValueType)
+		assert.True(t, base.Add(time.Minute).Equal(entries["pressure"].LastSeen))
+		assert.Equal(t, "string", entries["status"].ValueType)
+		assert.True(t, base.Equal(entries["status"].LastSeen))
+
+		// Other twins are left alone
+		assert.Contains(t, catalog(valve.DittoID), "flow")
+	})
+
+	t.Run("Should rebuild the catalog of every twin to match the data", func(t *testing.T) {
+		result, err := catalogService.Rebuild(context.Background(), 0)
+		require.NoError(t, err)
+		assert.Equal(t, &services.FeatureCatalogRebuild{Twins: 3, Features: 4}, result)
+
+		entries := catalog(valve.DittoID)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "number", entries["position"].ValueType)
+		assert.Equal(t, "boolean", entries["open"].ValueType)
+		assert.True(t, base.Add(time.Minute).Equal(entries["open"].LastSeen))
+		assert.Empty(t, catalog("org.digitalegiz.plant:removed"))
+		assert.Len(t, catalog(pump.DittoID), 2)
+	})
+
+	t.Run("Should take the type of a feature's latest value", func(t *testing.T) {
+		_, err := ingest.Ingest(pump, []services.FeatureValue{value("status", 2*time.Minute, 3)})
+		require.NoError(t, err)
+		assert.Equal(t, "number", catalog(pump.DittoID)["status"].ValueType)
+
+		_, err = catalogService.Rebuild(context.Background(), pump.ID)
+		require.NoError(t, err)
+		entry := catalog(pump.DittoID)["status"]
+		assert.Equal(t, "number", entry.ValueType)
+		assert.True(t, base.Add(2*time.Minute).Equal(entry.LastSeen))
+	})
+
+	t.Run("Should report unknown twins", func(t *testing.T) {
+		_, err := catalogService.Rebuild(context.Background(), 9999)
+		assert.EqualError(t, err, "twin not found")
+	})
+}
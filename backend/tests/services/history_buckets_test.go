@@ -0,0 +1,75 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryService_MaxBuckets(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.TimeseriesData{}, &models.AggregatedData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Buckets Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	// One day at 1m is 1440 buckets
+	end := time.Now().Truncate(time.Minute)
+	start := end.Add(-24 * time.Hour)
+	service := services.NewHistoryService(ts.DB, nil, nil, &config.HistoryConfig{MaxBuckets: 1440}, ts.Logger)
+
+	t.Run("Should count the buckets covering a range", func(t *testing.T) {
+		assert.Equal(t, int64(1440), services.BucketCount(start, end, time.Minute))
+		assert.Equal(t, int64(1441), services.BucketCount(start, end.Add(time.Second), time.Minute))
+		assert.Zero(t, services.BucketCount(end, start, time.Minute))
+	})
+
+	t.Run("Should run a query just under the limit", func(t *testing.T) {
+		_, err := service.GetAggregatedData(context.Background(), twin.ID, "temperature", start, end, "1m")
+		assert.NotErrorIs(t, err, services.ErrTooManyBuckets)
+	})
+
+	t.Run("Should reject a query over the limit and suggest a coarser interval", func(t *testing.T) {
+		_, err := service.GetAggregatedData(context.Background(), twin.ID, "temperature", start.Add(-time.Minute), end, "1m")
+		require.ErrorIs(t, err, services.ErrTooManyBuckets)
+		assert.Contains(t, err.Error(), "1441 buckets requested, the maximum is 1440")
+		assert.Contains(t, err.Error(), "use an interval of 5m or coarser")
+
+		yearStart := end.AddDate(-1, 0, 0)
+		_, err = service.GetAggregatedData(context.Background(), twin.ID, "temperature", yearStart, end, "1m")
+		require.ErrorIs(t, err, services.ErrTooManyBuckets)
+		assert.Contains(t, err.Error(), "use an interval of 12h or coarser")
+	})
+
+	t.Run("Should ask for a narrower range when no interval fits", func(t *testing.T) {
+		tight := services.NewHistoryService(ts.DB, nil, nil, &config.HistoryConfig{MaxBuckets: 1}, ts.Logger)
+		_, err := tight.GetAggregatedData(context.Background(), twin.ID, "temperature", end.AddDate(-1, 0, 0), end, "1d")
+		require.ErrorIs(t, err, services.ErrTooManyBuckets)
+		assert.Contains(t, err.Error(), "narrow the time range")
+	})
+
+	t.Run("Should not limit buckets when the maximum is 0", func(t *testing.T) {
+		unlimited := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+		_, err := unlimited.GetAggregatedData(context.Background(), twin.ID, "temperature", end.AddDate(-1, 0, 0), end, "1m")
+		assert.NotErrorIs(t, err, services.ErrTooManyBuckets)
+	})
+
+	t.Run("Should still reject unknown intervals", func(t *testing.T) {
+		_, err := service.GetAggregatedData(context.Background(), twin.ID, "temperature", start, end, "2m")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid interval")
+	})
+}
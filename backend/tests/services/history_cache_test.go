@@ -0,0 +1,126 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryService_QueryCache(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+
+	// Seed a twin
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Cache Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON(`{}`)}
+	require.NoError(t, repoFactory.TwinType().Create(twinType))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", TypeID: twinType.ID, ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	insertPoint := func(at time.Time) {
+		require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+			Time:        at,
+			TwinID:      twin.DittoID,
+			FeaturePath: "temperature",
+			ValueType:   "number",
+			ValueNum:    21.5,
+		}))
+	}
+
+	service := services.NewHistoryService(ts.DB, &config.CacheConfig{Enabled: true, TTL: 60}, nil, nil, ts.Logger)
+
+	t.Run("Should cache closed-window queries", func(t *testing.T) {
+		start := time.Now().Add(-3 * time.Hour)
+		end := time.Now().Add(-2 * time.Hour)
+		insertPoint(start.Add(time.Minute))
+
+		first, err := service.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+
+		// A late point inside the window is not visible until the entry expires
+		insertPoint(start.Add(2 * time.Minute))
+
+		second, err := service.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+		assert.Len(t, second, 1)
+
+		stats := service.CacheStats()
+		assert.Equal(t, int64(1), stats.Hits)
+		assert.Equal(t, int64(1), stats.Misses)
+		assert.Equal(t, 1, stats.Entries)
+	})
+
+	t.Run("Should not cache windows that include now", func(t *testing.T) {
+		start := time.Now().Add(-time.Hour)
+		end := time.Now().Add(time.Hour)
+		insertPoint(time.Now().Add(-30 * time.Minute))
+
+		first, err := service.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+		require.Len(t, first, 1)
+
+		insertPoint(time.Now().Add(-10 * time.Minute))
+
+		second, err := service.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+		assert.Len(t, second, 2)
+
+		// Open windows neither hit nor populate the cache
+		stats := service.CacheStats()
+		assert.Equal(t, int64(1), stats.Hits)
+		assert.Equal(t, 1, stats.Entries)
+	})
+
+	t.Run("Should not cache when disabled", func(t *testing.T) {
+		disabled := services.NewHistoryService(ts.DB, &config.CacheConfig{Enabled: false}, nil, nil, ts.Logger)
+		start := time.Now().Add(-3 * time.Hour)
+		end := time.Now().Add(-2 * time.Hour)
+
+		_, err := disabled.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+		_, err = disabled.GetTimeseriesData(context.Background(), twin.ID, "temperature", start, end, services.TimeseriesPage{Limit: 100}, "value_num")
+		require.NoError(t, err)
+
+		stats := disabled.CacheStats()
+		assert.False(t, stats.Enabled)
+		assert.Zero(t, stats.Hits)
+		assert.Zero(t, stats.Entries)
+	})
+}
+
+func TestQueryCache(t *testing.T) {
+	t.Run("Should expire entries after TTL", func(t *testing.T) {
+		cache := services.NewQueryCache(&config.CacheConfig{Enabled: true, TTL: 1})
+		cache.Set("key", "value")
+
+		value, ok := cache.Get("key")
+		require.True(t, ok)
+		assert.Equal(t, "value", value)
+
+		time.Sleep(1100 * time.Millisecond)
+		_, ok = cache.Get("key")
+		assert.False(t, ok)
+	})
+
+	t.Run("Should stay within max entries", func(t *testing.T) {
+		cache := services.NewQueryCache(&config.CacheConfig{Enabled: true, TTL: 60, MaxEntries: 2})
+		cache.Set("a", 1)
+		cache.Set("b", 2)
+		cache.Set("c", 3)
+
+		assert.Equal(t, 2, cache.Stats().Entries)
+	})
+}
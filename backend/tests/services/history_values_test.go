@@ -0,0 +1,121 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryService_ValuePredicates(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.TimeseriesData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Furnace Project"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twin := &models.Twin{Name: "Furnace 1", DittoID: "org.digitalegiz.project1:furnace-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	end := time.Now().UTC().Truncate(time.Second)
+	start := end.Add(-time.Hour)
+	var points []models.TimeseriesData
+	for i, temperature := range []float64{72, 81, 95, 79, 80, 88} {
+		points = append(points, models.TimeseriesData{
+			Time: start.Add(time.Duration(i+1) * time.Minute), TwinID: twin.DittoID, FeaturePath: "temperature",
+			ValueType: "number", ValueNum: temperature, Source: "http-ingest",
+		})
+	}
+	for i, open := range []bool{false, true, true, false} {
+		open := open
+		points = append(points, models.TimeseriesData{
+			Time: start.Add(time.Duration(i+1) * time.Minute), TwinID: twin.DittoID, FeaturePath: "door_open",
+			ValueType: "boolean", ValueBool: &open, Source: "http-ingest",
+		})
+	}
+	for i, mode := range []string{"idle", "heating", "idle"} {
+		points = append(points, models.TimeseriesData{
+			Time: start.Add(time.Duration(i+1) * time.Minute), TwinID: twin.DittoID, FeaturePath: "mode",
+			ValueType: "string", ValueStr: mode, Source: "http-ingest",
+		})
+	}
+	require.NoError(t, repoFactory.Timeseries().InsertTimeseriesBatch(points))
+
+	service := services.NewHistoryService(ts.DB, nil, nil, &config.HistoryConfig{}, ts.Logger)
+	ctx := context.Background()
+	query := func(featurePath string, filter services.ValueFilter) []models.TimeseriesData {
+		predicate, err := service.ParseValuePredicate(ctx, twin.ID, featurePath, filter)
+		require.NoError(t, err)
+		page := services.TimeseriesPage{Limit: 100, Ascending: true, Value: predicate}
+		data, err := service.GetTimeseriesData(ctx, twin.ID, featurePath, start, end, page, "value_num", "value_bool", "value_str")
+		require.NoError(t, err)
+		return data
+	}
+	temperatures := func(data []models.TimeseriesData) []float64 {
+		values := []float64{}
+		for _, point := range data {
+			values = append(values, point.ValueNum)
+		}
+		return values
+	}
+
+	t.Run("Should filter numeric features by bounds and equality", func(t *testing.T) {
+		assert.Equal(t, []float64{81, 95, 88}, temperatures(query("temperature", services.ValueFilter{GreaterThan: "80"})))
+		assert.Equal(t, []float64{81, 79, 80}, temperatures(query("temperature", services.ValueFilter{GreaterThan: "75", LessThan: "85.5"})))
+		assert.Equal(t, []float64{80}, temperatures(query("temperature", services.ValueFilter{Equal: "80"})))
+		assert.Len(t, query("temperature", services.ValueFilter{}), 6)
+	})
+
+	t.Run("Should filter boolean and string features by equality", func(t *testing.T) {
+		opened := query("door_open", services.ValueFilter{Equal: "true"})
+		require.Len(t, opened, 2)
+		for _, point := range opened {
+			assert.True(t, *point.ValueBool)
+		}
+		assert.Len(t, query("door_open", services.ValueFilter{Equal: "false"}), 2)
+
+		heating := query("mode", services.ValueFilter{Equal: "heating"})
+		require.Len(t, heating, 1)
+		assert.Equal(t, "heating", heating[0].ValueStr)
+	})
+
+	t.Run("Should reject predicates not suiting the feature's type", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			featurePath string
+			filter      services.ValueFilter
+			err         string
+		}{
+			"bound on boolean":     {"door_open", services.ValueFilter{GreaterThan: "0"}, "value_gt and value_lt need a numeric feature, door_open holds boolean values"},
+			"bound on string":      {"mode", services.ValueFilter{LessThan: "5"}, "value_gt and value_lt need a numeric feature, mode holds string values"},
+			"non-numeric bound":    {"temperature", services.ValueFilter{GreaterThan: "hot"}, "value_gt must be a number"},
+			"non-numeric equal":    {"temperature", services.ValueFilter{Equal: "true"}, "value_eq must be a number"},
+			"non-boolean equal":    {"door_open", services.ValueFilter{Equal: "ajar"}, "value_eq must be true or false"},
+			"feature without data": {"pressure", services.ValueFilter{Equal: "1"}, "feature pressure has no stored values"},
+		} {
+			_, err := service.ParseValuePredicate(ctx, twin.ID, tc.featurePath, tc.filter)
+			require.ErrorIs(t, err, services.ErrInvalidValuePredicate, name)
+			assert.Contains(t, err.Error(), tc.err, name)
+		}
+	})
+
+	t.Run("Should reject numeric predicates on features calibrated on read", func(t *testing.T) {
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "temperature", CalibrationMode: models.CalibrationQuery,
+			Calibrations: models.Calibrations{{EffectiveFrom: start, Multiplier: 1, Offset: 2}},
+		}))
+
+		_, err := service.ParseValuePredicate(ctx, twin.ID, "temperature", services.ValueFilter{GreaterThan: "80"})
+		require.ErrorIs(t, err, services.ErrInvalidValuePredicate)
+		assert.Contains(t, err.Error(), "feature temperature is calibrated on read")
+	})
+}
@@ -0,0 +1,192 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollupAccumulator(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sample := func(offset time.Duration, value float64) models.TimeseriesData {
+		return models.TimeseriesData{
+			Time:        start.Add(offset),
+			TwinID:      "org.digitalegiz.project1:motor-1",
+			FeaturePath: "vibration",
+			ValueType:   "number",
+			ValueNum:    value,
+			Source:      services.SourceMQTT,
+		}
+	}
+
+	t.Run("Should summarize the samples of a window and keep the peaks", func(t *testing.T) {
+		acc := services.NewRollupAccumulator(sample(1500*time.Millisecond, 0.2), 10*time.Second, true)
+		for i, value := range []float64{0.4, 9.7, 0.3, -4.1, 0.2} {
+			acc.Add(sample(time.Duration(2+i)*time.Second, value))
+		}
+
+		summary := acc.Summary()
+		assert.Equal(t, 6, summary.Count)
+		assert.Equal(t, 9.7, summary.Max)
+		assert.Equal(t, start.Add(3*time.Second), summary.MaxTime)
+		assert.Equal(t, -4.1, summary.Min)
+		assert.Equal(t, start.Add(5*time.Second), summary.MinTime)
+		assert.InDelta(t, (0.2+0.4+9.7+0.3-4.1+0.2)/6, summary.Avg, 1e-9)
+		require.NotNil(t, summary.Last)
+		assert.Equal(t, 0.2, *summary.Last)
+
+		point := acc.Point()
+		assert.Equal(t, start, point.Time)
+		assert.Equal(t, "number", point.ValueType)
+		assert.InDelta(t, summary.Avg, point.ValueNum, 1e-9)
+		assert.Equal(t, services.SourceMQTT, point.Source)
+
+		var stored services.RollupSummary
+		require.NoError(t, json.Unmarshal([]byte(point.ValueJSON), &stored))
+		assert.Equal(t, 9.7, stored.Max)
+		assert.Equal(t, -4.1, stored.Min)
+	})
+
+	t.Run("Should take the last value by sample time", func(t *testing.T) {
+		acc := services.NewRollupAccumulator(sample(5*time.Second, 3), 10*time.Second, true)
+		acc.Add(sample(time.Second, 7))
+
+		summary := acc.Summary()
+		require.NotNil(t, summary.Last)
+		assert.Equal(t, 3.0, *summary.Last)
+	})
+
+	t.Run("Should omit the last value unless kept", func(t *testing.T) {
+		acc := services.NewRollupAccumulator(sample(0, 1), 10*time.Second, false)
+		assert.Nil(t, acc.Summary().Last)
+		assert.NotContains(t, acc.Point().ValueJSON, "last")
+	})
+
+	t.Run("Should align windows to the window length", func(t *testing.T) {
+		acc := services.NewRollupAccumulator(sample(14*time.Second, 1), 10*time.Second, false)
+		assert.Equal(t, start.Add(20*time.Second), acc.End())
+		assert.True(t, acc.Covers(start.Add(10*time.Second)))
+		assert.True(t, acc.Covers(start.Add(19*time.Second)))
+		assert.False(t, acc.Covers(start.Add(20*time.Second)))
+		assert.False(t, acc.Covers(start.Add(9*time.Second)))
+	})
+}
+
+func TestIngestService_Rollup(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{})
+	userID := ts.SeedTestUser("rollup@example.com", "password123", false)
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	twin := &models.Twin{Name: "motor", DittoID: "org.digitalegiz.project1:motor", ProjectID: project.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+	require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+		TwinID:         twin.ID,
+		FeaturePath:    "vibration",
+		RollupWindow:   10,
+		RollupKeepLast: true,
+	}))
+
+	service := services.NewIngestService(ts.DB, &config.IngestConfig{}, nil, ts.Logger)
+
+	// storedPoint holds the stored columns read back; sqlite cannot scan timestamptz into time.Time
+	type storedPoint struct {
+		ValueType string
+		ValueNum  float64
+		ValueJSON string
+	}
+	// stored reads the stored points of a feature, oldest first
+	stored := func(featurePath string) []storedPoint {
+		var points []storedPoint
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Select("value_type, value_num, value_json").
+			Where("twin_id = ? AND feature_path = ?", twin.DittoID, featurePath).
+			Order("time").
+			Scan(&points).Error)
+		return points
+	}
+	summaryOf := func(point storedPoint) services.RollupSummary {
+		var summary services.RollupSummary
+		require.NoError(t, json.Unmarshal([]byte(point.ValueJSON), &summary))
+		return summary
+	}
+
+	start := time.Now().UTC().Truncate(time.Hour)
+	ingest := func(featurePath string, offset time.Duration, value string) {
+		result, err := service.Ingest(twin, []services.FeatureValue{
+			{FeatureID: featurePath, Timestamp: start.Add(offset), Data: json.RawMessage(value)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+	}
+
+	t.Run("Should store one rolled-up point per window instead of every sample", func(t *testing.T) {
+		for i := 0; i < 1000; i++ {
+			value := `0.5`
+			if i == 637 {
+				value = `42.5`
+			}
+			ingest("vibration", time.Duration(i)*10*time.Millisecond, value)
+		}
+		assert.Empty(t, stored("vibration"), "the window is still open")
+
+		// A sample in the next window closes the previous one
+		ingest("vibration", 12*time.Second, `1`)
+		points := stored("vibration")
+		require.Len(t, points, 1)
+
+		summary := summaryOf(points[0])
+		assert.Equal(t, 1000, summary.Count)
+		assert.Equal(t, 42.5, summary.Max)
+		assert.True(t, start.Add(6370*time.Millisecond).Equal(summary.MaxTime))
+		assert.Equal(t, 0.5, summary.Min)
+		assert.InDelta(t, (999*0.5+42.5)/1000, summary.Avg, 1e-9)
+		assert.InDelta(t, summary.Avg, points[0].ValueNum, 1e-9)
+		require.NotNil(t, summary.Last)
+		assert.Equal(t, 0.5, *summary.Last)
+	})
+
+	t.Run("Should keep late and non-numeric samples raw", func(t *testing.T) {
+		ingest("vibration", 3*time.Second, `2`)
+		ingest("vibration", 15*time.Second, `"sensor fault"`)
+
+		points := stored("vibration")
+		require.Len(t, points, 3)
+		assert.Equal(t, 2.0, points[1].ValueNum)
+		assert.Empty(t, points[1].ValueJSON)
+		assert.Equal(t, "string", points[2].ValueType)
+	})
+
+	t.Run("Should store ended windows on flush and the open ones on stop", func(t *testing.T) {
+		assert.Zero(t, service.FlushRollups(start.Add(19*time.Second)))
+		assert.Equal(t, 1, service.FlushRollups(start.Add(20*time.Second)))
+
+		points := stored("vibration")
+		require.Len(t, points, 4)
+		assert.Equal(t, 1, summaryOf(points[2]).Count)
+
+		ingest("vibration", 25*time.Second, `3`)
+		require.NoError(t, service.Stop(context.Background()))
+		assert.Len(t, stored("vibration"), 5)
+	})
+
+	t.Run("Should store every sample of features without a rollup", func(t *testing.T) {
+		for i := 0; i < 5; i++ {
+			ingest("temperature", time.Duration(i)*time.Second, `21`)
+		}
+		assert.Len(t, stored("temperature"), 5)
+	})
+}
@@ -0,0 +1,150 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestService_Sequences(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.IngestSequence{}, &models.TimeseriesData{}, &models.AlertData{})
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twin := &models.Twin{Name: "Sensor", DittoID: "org.digitalegiz.plant:sensor-1", ProjectID: project.ID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+	require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+		TwinID: twin.ID, FeaturePath: "temperature", ExpectedType: "number", TypeViolationMode: models.TypeViolationReject,
+	}))
+
+	service := services.NewIngestService(ts.DB, &config.IngestConfig{}, nil, ts.Logger)
+
+	base := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	value := func(feature string, sequence uint64, data interface{}) services.FeatureValue {
+		raw, err := json.Marshal(data)
+		require.NoError(t, err)
+		return services.FeatureValue{
+			FeatureID: feature,
+			Timestamp: base.Add(time.Duration(sequence) * time.Second),
+			Data:      raw,
+			Sequence:  sequence,
+		}
+	}
+	stored := func(feature string) []float64 {
+		values := []float64{}
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("twin_id = ? AND feature_path = ?", twin.DittoID, feature).
+			Order("time asc").Pluck("value_num", &values).Error)
+		return values
+	}
+	lastSequence := func(feature string) uint64 {
+		sequence, err := repoFactory.Twin().GetIngestSequence(twin.ID, feature)
+		require.NoError(t, err)
+		return sequence
+	}
+
+	t.Run("Should drop a resent batch's values already ingested", func(t *testing.T) {
+		result, err := service.Ingest(twin, []services.FeatureValue{
+			value("temperature", 1, 20.1), value("temperature", 2, 20.2), value("temperature", 3, 20.3),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Stored)
+		assert.Zero(t, result.Duplicates)
+
+		// The device reconnects and resends from its buffer
+		result, err = service.Ingest(twin, []services.FeatureValue{
+			value("temperature", 2, 20.2), value("temperature", 3, 20.3), value("temperature", 4, 20.4),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Equal(t, 2, result.Duplicates)
+		assert.Empty(t, result.Rejected)
+
+		assert.Equal(t, []float64{20.1, 20.2, 20.3, 20.4}, stored("temperature"))
+		assert.Equal(t, uint64(4), lastSequence("temperature"))
+	})
+
+	t.Run("Should drop duplicates within a batch", func(t *testing.T) {
+		result, err := service.Ingest(twin, []services.FeatureValue{value("temperature", 5, 20.5), value("temperature", 5, 20.5)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Equal(t, 1, result.Duplicates)
+	})
+
+	t.Run("Should accept gaps and drop values arriving out of order", func(t *testing.T) {
+		result, err := service.Ingest(twin, []services.FeatureValue{value("temperature", 9, 20.9), value("temperature", 7, 20.7)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Equal(t, 1, result.Duplicates)
+		assert.Equal(t, uint64(9), lastSequence("temperature"))
+
+		result, err = service.Ingest(twin, []services.FeatureValue{value("temperature", 8, 20.8)})
+		require.NoError(t, err)
+		assert.Zero(t, result.Stored)
+		assert.Equal(t, 1, result.Duplicates)
+		assert.Equal(t, []float64{20.1, 20.2, 20.3, 20.4, 20.5, 20.9}, stored("temperature"))
+	})
+
+	t.Run("Should number each feature on its own", func(t *testing.T) {
+		result, err := service.Ingest(twin, []services.FeatureValue{value("humidity", 1, 40), value("humidity", 2, 41)})
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Stored)
+		assert.Zero(t, result.Duplicates)
+		assert.Equal(t, uint64(2), lastSequence("humidity"))
+		assert.Equal(t, uint64(9), lastSequence("temperature"))
+	})
+
+	t.Run("Should store every unnumbered value", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			unnumbered := value("pressure", 0, 1.2)
+			unnumbered.Timestamp = base.Add(time.Duration(i) * time.Second)
+			result, err := service.Ingest(twin, []services.FeatureValue{unnumbered})
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.Stored)
+			assert.Zero(t, result.Duplicates)
+		}
+		assert.Len(t, stored("pressure"), 2)
+		assert.Zero(t, lastSequence("pressure"))
+	})
+
+	t.Run("Should let a rejected value be resent with its sequence", func(t *testing.T) {
+		result, err := service.Ingest(twin, []services.FeatureValue{value("temperature", 10, "hot")})
+		require.NoError(t, err)
+		require.Len(t, result.Rejected, 1)
+		assert.ErrorIs(t, result.Rejected[0].Err, services.ErrTypeViolation)
+		assert.Equal(t, uint64(9), lastSequence("temperature"))
+
+		result, err = service.Ingest(twin, []services.FeatureValue{value("temperature", 10, 21.0)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Equal(t, uint64(10), lastSequence("temperature"))
+
+		// The first numbered value of a feature failing leaves the feature unnumbered
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "current", ExpectedType: "number", TypeViolationMode: models.TypeViolationReject,
+		}))
+		result, err = service.Ingest(twin, []services.FeatureValue{value("current", 1, "high"), value("voltage", 1, 230)})
+		require.NoError(t, err)
+		assert.Len(t, result.Rejected, 1)
+		assert.Equal(t, 1, result.Stored)
+		assert.Zero(t, lastSequence("current"))
+
+		result, err = service.Ingest(twin, []services.FeatureValue{value("current", 1, 4.2)})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Equal(t, []float64{4.2}, stored("current"))
+	})
+}
@@ -0,0 +1,264 @@
+package services_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.FeatureBinding{},
+		&models.TimeseriesData{},
+		&models.AlertData{},
+	)
+	userID := ts.SeedTestUser("ingest@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	newTwin := func(dittoID string) *models.Twin {
+		twin := &models.Twin{Name: dittoID, DittoID: dittoID, ProjectID: project.ID, CreatedBy: userID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		return twin
+	}
+
+	notificationService := services.NewNotificationService(nil, ts.Logger)
+	defer notificationService.Close()
+
+	// A websocket client of the project receives the ingest notifications
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		notificationService.RegisterClient(conn, userID, project.ID, false)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool { return notificationService.ClientCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// nextNotification returns the next notification sent to the client;
+	// queued notifications arrive newline-separated in one websocket message
+	var pending []string
+	nextNotification := func() services.NotificationMessage {
+		if len(pending) == 0 {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			pending = strings.Split(string(data), "\n")
+		}
+
+		var message services.NotificationMessage
+		require.NoError(t, json.Unmarshal([]byte(pending[0]), &message))
+		pending = pending[1:]
+		return message
+	}
+
+	// storedValues reads the stored numeric values of a twin feature, oldest first
+	storedValues := func(thingID, featurePath string) []float64 {
+		var values []float64
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("twin_id = ? AND feature_path = ?", thingID, featurePath).
+			Order("time").
+			Pluck("value_num", &values).Error)
+		return values
+	}
+
+	service := services.NewIngestService(ts.DB, &config.IngestConfig{
+		MaxBatchSize:       3,
+		MaxFeaturesPerTwin: 2,
+		RateLimit:          6,
+	}, notificationService, ts.Logger)
+
+	t.Run("Should store a single value and notify the project", func(t *testing.T) {
+		twin := newTwin("org.digitalegiz.project1:pump-1")
+
+		result, err := service.Ingest(twin, []services.FeatureValue{
+			{FeatureID: "temperature", Data: json.RawMessage(`21.5`)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Empty(t, result.Rejected)
+		assert.Equal(t, []float64{21.5}, storedValues(twin.DittoID, "temperature"))
+
+		var source string
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("twin_id = ?", twin.DittoID).
+			Pluck("source", &source).Error)
+		assert.Equal(t, services.SourceHTTP, source)
+
+		message := nextNotification()
+		assert.Equal(t, services.NotificationTypeTwinUpdate, message.Type)
+		assert.Equal(t, "twins/"+twin.DittoID, message.Topic)
+		assert.Equal(t, "temperature", message.Payload.(map[string]interface{})["featureId"])
+	})
+
+	t.Run("Should store a batch with explicit timestamps", func(t *testing.T) {
+		twin := newTwin("org.digitalegiz.project1:pump-2")
+		now := time.Now().Truncate(time.Second)
+
+		result, err := service.Ingest(twin, []services.FeatureValue{
+			{FeatureID: "pressure", Timestamp: now.Add(-2 * time.Minute), Data: json.RawMessage(`1.1`)},
+			{FeatureID: "pressure", Timestamp: now.Add(-time.Minute), Data: json.RawMessage(`1.2`)},
+			{FeatureID: "flow", Timestamp: now, Data: json.RawMessage(`[{"time":"` + now.Format(time.RFC3339) + `","value":7}]`)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, result.Stored)
+		assert.Equal(t, []float64{1.1, 1.2}, storedValues(twin.DittoID, "pressure"))
+		assert.Equal(t, []float64{7}, storedValues(twin.DittoID, "flow"))
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, services.NotificationTypeTwinUpdate, nextNotification().Type)
+		}
+	})
+
+	t.Run("Should process HTTP values like values from Kafka", func(t *testing.T) {
+		binding := func(twin *models.Twin) {
+			require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+				TwinID:                  twin.ID,
+				FeaturePath:             "level",
+				ExpectedType:            "number",
+				TypeViolationMode:       models.TypeViolationDrop,
+				ViolationAlertThreshold: 1,
+			}))
+		}
+		viaHTTP := newTwin("org.digitalegiz.project1:tank-http")
+		viaKafka := newTwin("org.digitalegiz.project1:tank-kafka")
+		binding(viaHTTP)
+		binding(viaKafka)
+
+		result, err := service.Ingest(viaHTTP, []services.FeatureValue{
+			{FeatureID: "level", Data: json.RawMessage(`"high"`)},
+			{FeatureID: "level", Data: json.RawMessage(`42`)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+
+		_, err = service.ProcessFeatureValue(viaKafka.DittoID, "level", time.Now(), json.RawMessage(`"high"`), services.SourceDittoKafka)
+		require.NoError(t, err)
+		_, err = service.ProcessFeatureValue(viaKafka.DittoID, "level", time.Now(), json.RawMessage(`42`), services.SourceDittoKafka)
+		require.NoError(t, err)
+
+		for _, twin := range []*models.Twin{viaHTTP, viaKafka} {
+			assert.Equal(t, []float64{42}, storedValues(twin.DittoID, "level"))
+
+			var alerts int64
+			require.NoError(t, ts.DB.DB.Model(&models.AlertData{}).Where("twin_id = ?", twin.DittoID).Count(&alerts).Error)
+			assert.Equal(t, int64(1), alerts)
+		}
+
+		// Each path sends the type violation alert followed by the update
+		var types []services.NotificationType
+		for i := 0; i < 4; i++ {
+			types = append(types, nextNotification().Type)
+		}
+		assert.Equal(t, []services.NotificationType{
+			services.NotificationTypeAlert, services.NotificationTypeTwinUpdate,
+			services.NotificationTypeAlert, services.NotificationTypeTwinUpdate,
+		}, types)
+	})
+
+	t.Run("Should round values to the binding precision and keep the raw value", func(t *testing.T) {
+		precision := 2
+		binding := func(twin *models.Twin) {
+			require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+				TwinID:       twin.ID,
+				FeaturePath:  "vibration",
+				Precision:    &precision,
+				KeepRawValue: true,
+			}))
+		}
+		viaHTTP := newTwin("org.digitalegiz.project1:motor-http")
+		viaKafka := newTwin("org.digitalegiz.project1:motor-kafka")
+		binding(viaHTTP)
+		binding(viaKafka)
+
+		_, err := service.Ingest(viaHTTP, []services.FeatureValue{
+			{FeatureID: "vibration", Data: json.RawMessage(`0.123456789012345`)},
+		})
+		require.NoError(t, err)
+		_, err = service.ProcessFeatureValue(viaKafka.DittoID, "vibration", time.Now(), json.RawMessage(`0.123456789012345`), services.SourceDittoKafka)
+		require.NoError(t, err)
+
+		for _, twin := range []*models.Twin{viaHTTP, viaKafka} {
+			assert.Equal(t, []float64{0.12}, storedValues(twin.DittoID, "vibration"))
+
+			var raw string
+			require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+				Where("twin_id = ? AND feature_path = ?", twin.DittoID, "vibration").
+				Pluck("value_json", &raw).Error)
+			assert.Equal(t, "0.123456789012345", raw)
+
+			assert.Equal(t, services.NotificationTypeTwinUpdate, nextNotification().Type)
+		}
+	})
+
+	t.Run("Should report values rejected by the type policy", func(t *testing.T) {
+		twin := newTwin("org.digitalegiz.project1:valve-1")
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID:            twin.ID,
+			FeaturePath:       "open",
+			ExpectedType:      "boolean",
+			TypeViolationMode: models.TypeViolationReject,
+		}))
+
+		result, err := service.Ingest(twin, []services.FeatureValue{
+			{FeatureID: "open", Data: json.RawMessage(`"maybe"`)},
+			{FeatureID: "open", Data: json.RawMessage(`true`)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		require.Len(t, result.Rejected, 1)
+		assert.Equal(t, 0, result.Rejected[0].Index)
+		assert.ErrorIs(t, result.Rejected[0].Err, services.ErrTypeViolation)
+	})
+
+	t.Run("Should enforce the batch, feature and rate limits", func(t *testing.T) {
+		twin := newTwin("org.digitalegiz.project1:pump-3")
+		value := func(featureID string) services.FeatureValue {
+			return services.FeatureValue{FeatureID: featureID, Data: json.RawMessage(`1`)}
+		}
+
+		_, err := service.Ingest(twin, []services.FeatureValue{value("a"), value("a"), value("a"), value("a")})
+		require.Error(t, err)
+		assert.Equal(t, "batch of 4 values exceeds the limit of 3", err.Error())
+
+		_, err = service.Ingest(twin, []services.FeatureValue{value("a"), value("b"), value("c")})
+		assert.ErrorIs(t, err, services.ErrIngestFeatureLimit)
+
+		_, err = service.Ingest(twin, []services.FeatureValue{value("a"), value("b")})
+		require.NoError(t, err)
+		_, err = service.Ingest(twin, []services.FeatureValue{value("c")})
+		assert.ErrorIs(t, err, services.ErrIngestFeatureLimit)
+
+		_, err = service.Ingest(twin, []services.FeatureValue{value("a"), value("b"), value("a")})
+		require.NoError(t, err)
+		_, err = service.Ingest(twin, []services.FeatureValue{value("a"), value("b")})
+		assert.ErrorIs(t, err, services.ErrIngestRateLimited)
+	})
+}
@@ -0,0 +1,123 @@
+package services_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestService_Timestamps(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.FeatureBinding{}, &models.TimeseriesData{}, &models.AlertData{})
+	userID := ts.SeedTestUser("clocks@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	newTwin := func(name, policy string) *models.Twin {
+		project := &models.Project{Name: name, CreatedBy: userID, TimestampPolicy: policy}
+		require.NoError(t, repoFactory.Project().Create(project))
+		twin := &models.Twin{Name: name, DittoID: "org.digitalegiz.project1:" + name, ProjectID: project.ID, CreatedBy: userID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		return twin
+	}
+	accepting := newTwin("accepting", "")
+	rejecting := newTwin("rejecting", models.TimestampPolicyReject)
+	clamping := newTwin("clamping", models.TimestampPolicyClamp)
+
+	service := services.NewIngestService(ts.DB, &config.IngestConfig{
+		MaxFutureSkew:           60,
+		MaxLateness:             3600,
+		TimestampPolicy:         models.TimestampPolicyAccept,
+		TimestampAlertThreshold: 2,
+	}, nil, ts.Logger)
+
+	// storedPoint holds the stored columns read back; sqlite cannot scan timestamptz into time.Time
+	type storedPoint struct {
+		ValueNum float64
+		Time     string
+	}
+	stored := func(twin *models.Twin) []storedPoint {
+		var points []storedPoint
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Select("value_num, time").
+			Where("twin_id = ?", twin.DittoID).
+			Order("value_num").
+			Scan(&points).Error)
+		return points
+	}
+	ingest := func(twin *models.Twin, timestamp time.Time, value float64) (*services.IngestResult, error) {
+		data, _ := json.Marshal(value)
+		return service.Ingest(twin, []services.FeatureValue{{FeatureID: "temperature", Timestamp: timestamp, Data: data}})
+	}
+
+	t.Run("Should store points within the window under every policy", func(t *testing.T) {
+		for _, twin := range []*models.Twin{accepting, rejecting, clamping} {
+			result, err := ingest(twin, time.Now().Add(-30*time.Minute), 1)
+			require.NoError(t, err)
+			assert.Equal(t, 1, result.Stored)
+			assert.Empty(t, result.Rejected)
+		}
+		assert.Equal(t, services.TimestampStats{}, service.TimestampStats())
+	})
+
+	t.Run("Should reject future-dated and very late points for rejecting projects", func(t *testing.T) {
+		result, err := ingest(rejecting, time.Now().Add(10*time.Minute), 2)
+		require.NoError(t, err)
+		require.Len(t, result.Rejected, 1)
+		assert.True(t, errors.Is(result.Rejected[0].Err, services.ErrTimestampOutOfRange))
+
+		result, err = ingest(rejecting, time.Now().Add(-2*time.Hour), 3)
+		require.NoError(t, err)
+		require.Len(t, result.Rejected, 1)
+		assert.True(t, errors.Is(result.Rejected[0].Err, services.ErrTimestampOutOfRange))
+
+		assert.Len(t, stored(rejecting), 1)
+	})
+
+	t.Run("Should move future-dated and very late points into the window for clamping projects", func(t *testing.T) {
+		before := time.Now()
+		result, err := ingest(clamping, before.Add(24*time.Hour), 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		result, err = ingest(clamping, before.Add(-30*24*time.Hour), 3)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		after := time.Now()
+
+		points := stored(clamping)
+		require.Len(t, points, 3)
+		future, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", points[1].Time)
+		require.NoError(t, err)
+		assert.False(t, future.Before(before.Add(time.Minute)))
+		assert.False(t, future.After(after.Add(time.Minute)))
+		late, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", points[2].Time)
+		require.NoError(t, err)
+		assert.False(t, late.Before(before.Add(-time.Hour)))
+		assert.False(t, late.After(after.Add(-time.Hour)))
+	})
+
+	t.Run("Should store out-of-window points as received for accepting projects", func(t *testing.T) {
+		result, err := ingest(accepting, time.Now().Add(24*time.Hour), 2)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Stored)
+		assert.Len(t, stored(accepting), 2)
+	})
+
+	t.Run("Should count out-of-window points and alert per twin", func(t *testing.T) {
+		assert.Equal(t, services.TimestampStats{Future: 3, Late: 2, Rejected: 2, Clamped: 2}, service.TimestampStats())
+
+		var alerts []string
+		require.NoError(t, ts.DB.DB.Model(&models.AlertData{}).Order("twin_id").Pluck("twin_id", &alerts).Error)
+		assert.Equal(t, []string{clamping.DittoID, rejecting.DittoID}, alerts)
+	})
+}
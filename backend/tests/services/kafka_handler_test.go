@@ -0,0 +1,762 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaHandler(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.FeatureBinding{},
+		&models.TimeseriesData{},
+		&models.AlertData{},
+		&models.MLTask{},
+		&models.MLTaskBinding{},
+		&models.MLPredictionData{},
+		&models.AttributeChange{},
+	)
+	userID := ts.SeedTestUser("pipeline@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	// Ditto and Kafka are replaced by the in-memory fakes
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	bus := testutils.NewFakeKafka()
+
+	dittoCfg := fakeDitto.Config()
+	dittoCfg.WritebackEnabled = true
+	dittoCfg.WritebackInterval = 1
+	dittoCfg.EchoSuppressionWindow = 30
+	dittoManager := ditto.NewManager(dittoCfg, ts.Logger)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	ingestService := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+	ingestService.SetKafkaManager(bus)
+	writebackService := services.NewWritebackService(ts.DB, dittoCfg, dittoManager, ts.Logger)
+	defer writebackService.Stop(context.Background())
+
+	handler := services.NewKafkaHandler(ts.Logger, bus, dittoManager, ts.DB, repoFactory, ingestService, writebackService)
+	require.NoError(t, handler.Initialize(context.Background()))
+	require.NoError(t, handler.Start(context.Background()))
+	defer handler.Stop(context.Background())
+
+	require.NoError(t, dittoManager.Connect())
+	defer dittoManager.Disconnect()
+	require.NoError(t, dittoManager.SubscribeToProjects("", []uint{project.ID}))
+	require.Eventually(t, func() bool { return len(fakeDitto.Subscriptions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	thingID := ditto.ProjectNamespace(dittoCfg.NamespacePrefix, project.ID) + ":pump-1"
+
+	t.Run("Should register a twin for a thing created in Ditto", func(t *testing.T) {
+		_, err := dittoManager.CreateThing(context.Background(), &ditto.Thing{
+			ThingID:    thingID,
+			Attributes: map[string]interface{}{"name": "Pump 1"},
+		})
+		require.NoError(t, err)
+
+		var twin *models.Twin
+		require.Eventually(t, func() bool {
+			twin, err = repoFactory.Twin().GetByDittoID(thingID)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Pump 1", twin.Name)
+		assert.Equal(t, project.ID, twin.ProjectID)
+		assert.Len(t, bus.Messages(kafka.TopicDittoEvents), 1)
+	})
+
+	t.Run("Should record the history of attributes changed in Ditto", func(t *testing.T) {
+		twin, err := repoFactory.Twin().GetByDittoID(thingID)
+		require.NoError(t, err)
+		historyService := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+		history := func(path string) []models.AttributeChange {
+			changes, err := historyService.GetAttributeHistory(twin.ID, path, time.Time{}, time.Time{}, 0)
+			require.NoError(t, err)
+			return changes
+		}
+
+		// WebSocket events may be handled out of order, so each is awaited before the next
+		emit := func(action, path string, value interface{}, path2 string, changes int) {
+			require.NoError(t, fakeDitto.EmitEvent(thingID, action, path, value))
+			require.Eventually(t, func() bool { return len(history(path2)) == changes }, 5*time.Second, 10*time.Millisecond)
+		}
+		encoded := func(value models.JSON) string {
+			data, err := json.Marshal(value)
+			require.NoError(t, err)
+			return string(data)
+		}
+
+		emit("created", "/attributes/firmwareVersion", "1.0.0", "firmwareVersion", 1)
+		emit("modified", "/attributes/firmwareVersion", "1.1.0", "firmwareVersion", 2)
+
+		changes := history("firmwareVersion")
+		assert.Equal(t, "firmwareVersion", changes[0].Path)
+		assert.JSONEq(t, `"1.0.0"`, encoded(changes[0].OldValue))
+		assert.JSONEq(t, `"1.1.0"`, encoded(changes[0].NewValue))
+		assert.JSONEq(t, `null`, encoded(changes[1].OldValue))
+		assert.JSONEq(t, `"1.0.0"`, encoded(changes[1].NewValue))
+
+		// Nested attributes are recorded per leaf, and unchanged values are not recorded again
+		emit("modified", "/attributes/location", map[string]interface{}{"lat": 51.1, "lon": 71.4}, "location", 2)
+		require.NoError(t, fakeDitto.EmitEvent(thingID, "modified", "/attributes", map[string]interface{}{
+			"firmwareVersion": "1.1.0",
+			"location":        map[string]interface{}{"lat": 51.2, "lon": 71.4},
+		}))
+		require.Eventually(t, func() bool { return len(history("location")) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+		changes = history("/attributes/location/lat")
+		require.Len(t, changes, 2)
+		assert.JSONEq(t, `51.1`, encoded(changes[0].OldValue))
+		assert.JSONEq(t, `51.2`, encoded(changes[0].NewValue))
+		assert.Len(t, history("location/lon"), 1)
+		assert.Len(t, history("firmwareVersion"), 2)
+
+		// The name given when the thing was created is the baseline of that attribute
+		changes = history("name")
+		require.Len(t, changes, 1)
+		assert.JSONEq(t, `"Pump 1"`, encoded(changes[0].NewValue))
+	})
+
+	t.Run("Should store feature values changed in Ditto", func(t *testing.T) {
+		require.NoError(t, dittoManager.UpdateFeatureProperty(context.Background(), thingID, "temperature", "value", 21.5))
+
+		var values []float64
+		require.Eventually(t, func() bool {
+			values = nil
+			require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+				Where("twin_id = ? AND feature_path = ?", thingID, "temperature").
+				Pluck("value_num", &values).Error)
+			return len(values) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 21.5, values[0])
+
+		var source string
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("twin_id = ? AND feature_path = ?", thingID, "temperature").
+			Pluck("source", &source).Error)
+		assert.Equal(t, services.SourceDittoWS, source)
+	})
+
+	t.Run("Should tag points with the source the producer reported", func(t *testing.T) {
+		publish := func(featureID string, source string) {
+			message := map[string]interface{}{
+				"thingId":   thingID,
+				"featureId": featureID,
+				"timestamp": time.Now().Format(time.RFC3339),
+				"data":      1,
+			}
+			if source != "" {
+				message["source"] = source
+			}
+			require.NoError(t, bus.ProduceMessage(kafka.TopicTimeSeriesData, thingID, message, nil))
+		}
+		publish("flow", "")
+		publish("pressure", services.SourceSimulator)
+		publish("speed", "unknown-bridge")
+
+		sources := map[string]string{}
+		for _, featureID := range []string{"flow", "pressure", "speed"} {
+			var source string
+			require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+				Where("twin_id = ? AND feature_path = ?", thingID, featureID).
+				Pluck("source", &source).Error)
+			sources[featureID] = source
+		}
+		assert.Equal(t, map[string]string{
+			"flow":     services.SourceDittoKafka,
+			"pressure": services.SourceSimulator,
+			"speed":    services.SourceDittoKafka,
+		}, sources)
+	})
+
+	t.Run("Should key and store every spelling of a thing ID as the normalized ID", func(t *testing.T) {
+		namespace, name, err := ditto.ParseThingID(thingID)
+		require.NoError(t, err)
+		variants := []string{
+			strings.ToUpper(namespace) + ":" + name,
+			"  " + thingID + "\t",
+			strings.ToUpper(namespace[:1]) + namespace[1:] + " :" + name,
+		}
+
+		for i, variant := range variants {
+			require.NoError(t, bus.ProduceTimeSeriesData(variant, fmt.Sprintf("level-%d", i), float64(i), ""))
+
+			// Producers outside the backend may key and name the thing differently
+			require.NoError(t, bus.ProduceMessage(kafka.TopicTimeSeriesData, variant, map[string]interface{}{
+				"thingId":   variant,
+				"featureId": fmt.Sprintf("external-level-%d", i),
+				"timestamp": time.Now().Format(time.RFC3339),
+				"data":      i,
+			}, nil))
+		}
+
+		// The backend's own messages are keyed by the normalized ID
+		var keys []string
+		for _, message := range bus.Messages(kafka.TopicTimeSeriesData) {
+			var value struct {
+				FeatureID string `json:"featureId"`
+			}
+			require.NoError(t, json.Unmarshal(message.Value, &value))
+			if strings.HasPrefix(value.FeatureID, "level-") {
+				keys = append(keys, string(message.Key))
+			}
+		}
+		assert.Equal(t, []string{thingID, thingID, thingID}, keys)
+
+		// Every point is stored under the normalized ID
+		var twinIDs []string
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Where("feature_path LIKE ? OR feature_path LIKE ?", "level-%", "external-level-%").
+			Pluck("twin_id", &twinIDs).Error)
+		require.Len(t, twinIDs, 2*len(variants))
+		for _, twinID := range twinIDs {
+			assert.Equal(t, thingID, twinID)
+		}
+	})
+
+	t.Run("Should store ML output and write it back to Ditto", func(t *testing.T) {
+		twin, err := repoFactory.Twin().GetByDittoID(thingID)
+		require.NoError(t, err)
+
+		task := &models.MLTask{Name: "Anomalies", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0", CreatedBy: userID}
+		require.NoError(t, ts.DB.DB.Create(task).Error)
+		require.NoError(t, ts.DB.DB.Create(&models.MLTaskBinding{
+			TaskID:         task.ID,
+			TwinID:         twin.ID,
+			OutputPathJSON: `{"feature":"health","property":"anomaly"}`,
+			Active:         true,
+		}).Error)
+
+		require.NoError(t, bus.ProduceMessage(kafka.TopicMLOutput, task.ModelID, map[string]interface{}{
+			"modelId":   task.ModelID,
+			"timestamp": time.Now().Format(time.RFC3339),
+			"output": map[string]interface{}{
+				"thingId": thingID,
+				"result":  map[string]interface{}{"threshold": 0.8},
+			},
+		}, nil))
+
+		var predictions int64
+		require.NoError(t, ts.DB.DB.Model(&models.MLPredictionData{}).Where("twin_id = ?", thingID).Count(&predictions).Error)
+		assert.Equal(t, int64(1), predictions)
+
+		require.Eventually(t, func() bool {
+			_, ok := fakeDitto.FeatureProperty(thingID, "health", "anomaly")
+			return ok
+		}, 5*time.Second, 10*time.Millisecond)
+		value, _ := fakeDitto.FeatureProperty(thingID, "health", "anomaly/details/threshold")
+		assert.Equal(t, 0.8, value)
+	})
+
+	t.Run("Should store backfilled ML output without writing it back", func(t *testing.T) {
+		require.NoError(t, bus.ProduceMessage(kafka.TopicMLOutput, "pump-anomaly", map[string]interface{}{
+			"modelId":   "pump-anomaly",
+			"timestamp": time.Now().Add(-time.Hour).Format(time.RFC3339),
+			"output": map[string]interface{}{
+				"thingId":   thingID,
+				"featureId": "level",
+				"result":    map[string]interface{}{"threshold": 0.3},
+				"alert":     map[string]interface{}{"type": "anomaly", "severity": "warning", "description": "Level drop"},
+				"backfill":  map[string]interface{}{"job_id": 7},
+			},
+		}, nil))
+
+		var details []string
+		require.NoError(t, ts.DB.DB.Model(&models.MLPredictionData{}).
+			Where("twin_id = ? AND details_json LIKE ?", thingID, "%backfill%").
+			Pluck("details_json", &details).Error)
+		require.Len(t, details, 1)
+		assert.JSONEq(t, `{"result":{"threshold":0.3},"backfill":{"job_id":7}}`, details[0])
+
+		var sources []string
+		require.NoError(t, ts.DB.DB.Model(&models.AlertData{}).Where("twin_id = ?", thingID).Pluck("source", &sources).Error)
+		assert.Equal(t, []string{"ml-backfill"}, sources)
+
+		assert.Never(t, func() bool {
+			value, _ := fakeDitto.FeatureProperty(thingID, "health", "anomaly/details/threshold")
+			return value == 0.3
+		}, 1500*time.Millisecond, 50*time.Millisecond)
+	})
+
+	t.Run("Should not store the echo of its own Ditto writes", func(t *testing.T) {
+		countPoints := func(featureID string) int64 {
+			var count int64
+			require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+				Where("twin_id = ? AND feature_path = ?", thingID, featureID).
+				Count(&count).Error)
+			return count
+		}
+
+		// A write of the backend, echoed back by Ditto over the WebSocket
+		require.NoError(t, dittoManager.UpdateFeatureProperty(ditto.SuppressEcho(context.Background()), thingID, "setpoint", "value", 42))
+
+		// Events arrive in order, so once a later external change is stored the echo was handled
+		require.NoError(t, dittoManager.UpdateFeatureProperty(context.Background(), thingID, "setpoint-marker", "value", 1))
+		require.Eventually(t, func() bool { return countPoints("setpoint-marker") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		assert.Zero(t, countPoints("setpoint"))
+		// Predictions written back to Ditto are not stored again as time-series points either
+		assert.Zero(t, countPoints("health"))
+
+		// Only the backend's own write was tagged
+		tagged := map[string]bool{}
+		for _, request := range fakeDitto.Requests() {
+			if request.CorrelationID != "" {
+				tagged[request.Path] = true
+			}
+		}
+		assert.True(t, tagged["/api/2/things/"+thingID+"/features/setpoint/properties/value"])
+		assert.False(t, tagged["/api/2/things/"+thingID+"/features/setpoint-marker/properties/value"])
+	})
+
+	t.Run("Should keep messages the handlers fail to process", func(t *testing.T) {
+		require.NoError(t, bus.ProduceMessage(kafka.TopicTimeSeriesData, thingID, map[string]interface{}{
+			"thingId":   thingID,
+			"featureId": "temperature",
+			"timestamp": "yesterday",
+		}, nil))
+
+		deadLetters := bus.DeadLetters()
+		require.NotEmpty(t, deadLetters)
+		last := deadLetters[len(deadLetters)-1]
+		assert.Equal(t, kafka.TopicTimeSeriesData, last.Topic)
+		assert.Contains(t, last.Err.Error(), "failed to parse timestamp")
+	})
+
+	t.Run("Should fail Ditto requests while Ditto is unavailable", func(t *testing.T) {
+		fakeDitto.SetFailure(http.StatusServiceUnavailable)
+		defer fakeDitto.SetFailure(0)
+
+		_, err := dittoManager.GetThing(context.Background(), thingID)
+		require.Error(t, err)
+		var dittoErr *ditto.DittoError
+		require.ErrorAs(t, err, &dittoErr)
+		assert.Equal(t, http.StatusServiceUnavailable, dittoErr.Status)
+	})
+}
+
+func TestKafkaHandler_DittoForwardFilter(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.TimeseriesData{}, &models.MLTaskBinding{})
+	userID := ts.SeedTestUser("forwarding@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+	other := &models.Project{Name: "Lab", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(other).Error)
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	bus := testutils.NewFakeKafka()
+
+	dittoCfg := fakeDitto.Config()
+	dittoCfg.ForwardNamespaces = []string{"org.digitalegiz.*"}
+	dittoCfg.DropNamespaces = []string{ditto.ProjectNamespace(dittoCfg.NamespacePrefix, other.ID)}
+	dittoCfg.ForwardKnownTwinsOnly = true
+	dittoManager := ditto.NewManager(dittoCfg, ts.Logger)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	namespace := ditto.ProjectNamespace(dittoCfg.NamespacePrefix, project.ID)
+	require.NoError(t, repoFactory.Twin().Create(&models.Twin{Name: "Pump 1", DittoID: namespace + ":pump-1", ProjectID: project.ID, CreatedBy: userID}))
+
+	_, err := services.NewDittoForwardFilter(&config.DittoConfig{ForwardNamespaces: []string{"org.[digitalegiz"}}, repoFactory.Twin())
+	require.Error(t, err)
+	filter, err := services.NewDittoForwardFilter(dittoCfg, repoFactory.Twin())
+	require.NoError(t, err)
+
+	ingestService := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+	handler := services.NewKafkaHandler(ts.Logger, bus, dittoManager, ts.DB, repoFactory, ingestService, nil)
+	handler.SetDittoForwardFilter(filter)
+	require.NoError(t, handler.Initialize(context.Background()))
+
+	require.NoError(t, dittoManager.Connect())
+	defer dittoManager.Disconnect()
+	require.NoError(t, dittoManager.SubscribeToThings("", nil))
+	require.Eventually(t, func() bool { return len(fakeDitto.Subscriptions()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	forwarded := func() []string {
+		var keys []string
+		for _, message := range bus.Messages(kafka.TopicDittoEvents) {
+			keys = append(keys, string(message.Key))
+		}
+		return keys
+	}
+
+	t.Run("Should forward the events of known twins and of things created in project namespaces", func(t *testing.T) {
+		require.NoError(t, fakeDitto.EmitEvent(namespace+":pump-1", "modified", "/features/temperature/properties/value", 21.5))
+		require.NoError(t, fakeDitto.EmitEvent(namespace+":pump-2", "created", "/", map[string]interface{}{"thingId": namespace + ":pump-2"}))
+
+		require.Eventually(t, func() bool { return len(forwarded()) == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.ElementsMatch(t, []string{namespace + ":pump-1", namespace + ":pump-2"}, forwarded())
+	})
+
+	t.Run("Should drop events of filtered namespaces and unmanaged things", func(t *testing.T) {
+		require.NoError(t, fakeDitto.EmitEvent("com.vendor:sensor-1", "modified", "/features/level/properties/value", 1))
+		require.NoError(t, fakeDitto.EmitEvent(ditto.ProjectNamespace(dittoCfg.NamespacePrefix, other.ID)+":scope-1", "created", "/", map[string]interface{}{}))
+		require.NoError(t, fakeDitto.EmitEvent(namespace+":pump-3", "modified", "/features/temperature/properties/value", 20))
+
+		require.Eventually(t, func() bool {
+			stats := handler.DittoForwardStats()
+			return stats.Unlisted+stats.Denied+stats.Unmanaged == 3
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, services.DittoForwardStats{Forwarded: 2, Denied: 1, Unlisted: 1, Unmanaged: 1}, handler.DittoForwardStats())
+		assert.Len(t, forwarded(), 2)
+	})
+}
+
+func TestKafkaHandler_Pipelines(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	dittoManager := ditto.NewManager(&ts.Config.Ditto, ts.Logger)
+
+	t.Run("Should wire the configured pipelines", func(t *testing.T) {
+		bus := testutils.NewFakeKafka()
+		handler := services.NewKafkaHandler(ts.Logger, bus, dittoManager, ts.DB, repoFactory, nil, nil)
+		handler.SetPipelineConfig(&config.KafkaConfig{
+			ConsumerGroup: "digital-egiz",
+			Pipelines: map[string]config.KafkaPipelineConfig{
+				services.PipelineMLOutput: {Group: "digital-egiz-ml", Concurrency: 2},
+			},
+		})
+		require.NoError(t, handler.Initialize(context.Background()))
+
+		pipelines := make(map[string]kafka.PipelineSpec)
+		for _, pipeline := range handler.Pipelines() {
+			pipelines[pipeline.Name] = pipeline
+		}
+		require.Len(t, pipelines, 3)
+		assert.Equal(t, []string{"timeseries-processor-timeseries-data"}, pipelines[services.PipelineTimeSeriesData].Consumers)
+		assert.Equal(t, "digital-egiz", pipelines[services.PipelineTimeSeriesData].Group)
+		assert.Equal(t, "digital-egiz-ml", pipelines[services.PipelineMLOutput].Group)
+		assert.Len(t, pipelines[services.PipelineMLOutput].Consumers, 2)
+
+		opts, ok := bus.ConsumerOptions("ml-output-processor-ml-output-2")
+		require.True(t, ok)
+		assert.Equal(t, "digital-egiz-ml", opts.Group)
+	})
+
+	t.Run("Should fail to initialize with an invalid mapping", func(t *testing.T) {
+		handler := services.NewKafkaHandler(ts.Logger, testutils.NewFakeKafka(), dittoManager, ts.DB, repoFactory, nil, nil)
+		handler.SetPipelineConfig(&config.KafkaConfig{
+			Pipelines: map[string]config.KafkaPipelineConfig{
+				services.PipelineDittoEvents:    {Group: "digital-egiz-ingest"},
+				services.PipelineTimeSeriesData: {Group: "digital-egiz-ingest"},
+			},
+		})
+		assert.Error(t, handler.Initialize(context.Background()))
+	})
+}
+
+func TestKafkaHandler_EventDebounce(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.TwinType{}, &models.Twin{}, &models.AttributeChange{})
+	project := &models.Project{Name: "Provisioning"}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	dittoManager := ditto.NewManager(&ts.Config.Ditto, ts.Logger)
+	bus := testutils.NewFakeKafka()
+
+	handler := services.NewKafkaHandler(ts.Logger, bus, dittoManager, ts.DB, repoFactory, nil, nil)
+	handler.SetEventDebounce(300 * time.Millisecond)
+	require.NoError(t, handler.Initialize(context.Background()))
+	require.NoError(t, handler.Start(context.Background()))
+
+	historyService := services.NewHistoryService(ts.DB, nil, nil, nil, ts.Logger)
+	history := func(twinID uint, path string) []models.AttributeChange {
+		changes, err := historyService.GetAttributeHistory(twinID, path, time.Time{}, time.Time{}, 0)
+		require.NoError(t, err)
+		return changes
+	}
+	thingID := "org.digitalegiz.provisioning:pump-7"
+	produce := func(action string, attributes map[string]interface{}) {
+		require.NoError(t, bus.ProduceDittoEvent(thingID, action, map[string]interface{}{"attributes": attributes}))
+	}
+
+	var twin *models.Twin
+	t.Run("Should apply a burst of created and modified events once with the latest state", func(t *testing.T) {
+		produce("created", map[string]interface{}{"name": "Pump 7", "firmwareVersion": "1.0.0"})
+		produce("modified", map[string]interface{}{"firmwareVersion": "1.1.0"})
+		produce("modified", map[string]interface{}{"name": "Pump 7b"})
+
+		// Nothing is applied until the burst's window has passed
+		_, err := repoFactory.Twin().GetByDittoID(thingID)
+		assert.Error(t, err)
+
+		require.Eventually(t, func() bool {
+			twin, err = repoFactory.Twin().GetByDittoID(thingID)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, "Pump 7b", twin.Name)
+		assert.Equal(t, project.ID, twin.ProjectID)
+
+		// Intermediate values of the burst are never recorded
+		changes := history(twin.ID, "firmwareVersion")
+		require.Len(t, changes, 1)
+		assert.JSONEq(t, `"1.1.0"`, string(changes[0].NewValue))
+		assert.Len(t, history(twin.ID, "name"), 1)
+	})
+
+	t.Run("Should apply a later event separately", func(t *testing.T) {
+		produce("modified", map[string]interface{}{"firmwareVersion": "1.2.0"})
+		require.Eventually(t, func() bool { return len(history(twin.ID, "firmwareVersion")) == 2 }, 5*time.Second, 10*time.Millisecond)
+		assert.JSONEq(t, `"1.2.0"`, string(history(twin.ID, "firmwareVersion")[0].NewValue))
+	})
+
+	t.Run("Should apply a pending burst when stopped", func(t *testing.T) {
+		produce("modified", map[string]interface{}{"firmwareVersion": "1.3.0"})
+		require.NoError(t, handler.Stop(context.Background()))
+		assert.Len(t, history(twin.ID, "firmwareVersion"), 3)
+	})
+}
+
+// countingTwinRepository counts the twin lookups by Ditto ID
+type countingTwinRepository struct {
+	repository.TwinRepository
+	lookups atomic.Int64
+}
+
+func (r *countingTwinRepository) GetByDittoID(dittoID string) (*models.Twin, error) {
+	r.lookups.Add(1)
+	return r.TwinRepository.GetByDittoID(dittoID)
+}
+
+func TestKafkaHandler_PayloadTransforms(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.TimeseriesData{}, &models.FeatureCatalogEntry{}, &models.MLTaskBinding{})
+	userID := ts.SeedTestUser("transforms@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	plant := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(plant).Error)
+	lab := &models.Project{Name: "Lab", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(lab).Error)
+	pump := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.plant:transform-pump", ProjectID: plant.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(pump))
+	bench := &models.Twin{Name: "Bench 1", DittoID: "org.digitalegiz.lab:transform-bench", ProjectID: lab.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(bench))
+
+	twinRepo := &countingTwinRepository{TwinRepository: repoFactory.Twin()}
+
+	// The plant's legacy pumps report over MQTT in tenths of a revolution, with readings nested
+	// in a telemetry document
+	transformer, err := services.NewPayloadTransformer([]config.IngestTransformConfig{{
+		Name:      "legacy-pumps",
+		ProjectID: plant.ID,
+		Source:    services.SourceMQTT,
+		Feature:   "telemetry",
+		TimePath:  "$.ts",
+		Mappings: []config.IngestMappingConfig{
+			{Path: "$.motor.rpm_x10", Feature: "pump/speed", Scale: 0.1},
+			{Path: "$.sensors[0]['temp.c']", Feature: "temperature", Optional: true},
+			{Path: "status.state", Feature: "state"},
+		},
+	}}, twinRepo)
+	require.NoError(t, err)
+
+	bus := testutils.NewFakeKafka()
+	handler := services.NewKafkaHandler(ts.Logger, bus, ditto.NewManager(&ts.Config.Ditto, ts.Logger), ts.DB, repoFactory,
+		services.NewIngestService(ts.DB, nil, nil, ts.Logger), nil)
+	handler.SetPayloadTransformer(transformer)
+	require.NoError(t, handler.Initialize(context.Background()))
+
+	publish := func(thingID, featureID, source string, data interface{}) {
+		require.NoError(t, bus.ProduceMessage(kafka.TopicTimeSeriesData, thingID, map[string]interface{}{
+			"thingId":   thingID,
+			"featureId": featureID,
+			"timestamp": time.Now().Format(time.RFC3339),
+			"data":      data,
+			"source":    source,
+		}, nil))
+	}
+	// storedPoint holds the stored columns read back; sqlite cannot scan timestamptz into time.Time
+	type storedPoint struct {
+		FeaturePath string
+		ValueType   string
+		ValueNum    float64
+		ValueStr    string
+		Source      string
+		Time        string
+	}
+	points := func(twinID string) map[string][]storedPoint {
+		var stored []storedPoint
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).
+			Select("feature_path, value_type, value_num, value_str, source, time").
+			Where("twin_id = ?", twinID).
+			Order("time").
+			Scan(&stored).Error)
+		byFeature := make(map[string][]storedPoint)
+		for _, point := range stored {
+			byFeature[point.FeaturePath] = append(byFeature[point.FeaturePath], point)
+		}
+		return byFeature
+	}
+
+	sampled := time.Now().Add(-time.Minute).Truncate(time.Millisecond).UTC()
+
+	t.Run("Should store a nested and scaled payload as feature points", func(t *testing.T) {
+		publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{
+			"ts":      sampled.UnixMilli(),
+			"motor":   map[string]interface{}{"rpm_x10": 14505},
+			"sensors": []interface{}{map[string]interface{}{"temp.c": 61.5}},
+			"status":  map[string]interface{}{"state": "running"},
+		})
+		require.Empty(t, bus.DeadLetters())
+
+		stored := points(pump.DittoID)
+		assert.NotContains(t, stored, "telemetry")
+		require.Len(t, stored["pump/speed"], 1)
+		speed := stored["pump/speed"][0]
+		assert.Equal(t, "number", speed.ValueType)
+		assert.InDelta(t, 1450.5, speed.ValueNum, 1e-9)
+		storedTime, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", speed.Time)
+		require.NoError(t, err)
+		assert.True(t, sampled.Equal(storedTime), "the sample time is taken from the payload")
+		assert.Equal(t, services.SourceMQTT, speed.Source)
+
+		require.Len(t, stored["temperature"], 1)
+		assert.Equal(t, 61.5, stored["temperature"][0].ValueNum)
+		require.Len(t, stored["state"], 1)
+		assert.Equal(t, "string", stored["state"][0].ValueType)
+		assert.Equal(t, "running", stored["state"][0].ValueStr)
+	})
+
+	t.Run("Should skip optional values the payload lacks", func(t *testing.T) {
+		publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{
+			"ts":      sampled.Add(time.Second).UnixMilli(),
+			"motor":   map[string]interface{}{"rpm_x10": 900},
+			"sensors": []interface{}{},
+			"status":  map[string]interface{}{"state": "idle"},
+		})
+		require.Empty(t, bus.DeadLetters())
+
+		stored := points(pump.DittoID)
+		assert.Len(t, stored["pump/speed"], 2)
+		assert.Len(t, stored["temperature"], 1)
+	})
+
+	t.Run("Should reject payloads the transform cannot map", func(t *testing.T) {
+		publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{"ts": sampled.UnixMilli(), "status": map[string]interface{}{"state": "idle"}})
+		publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{"ts": sampled.UnixMilli(), "motor": map[string]interface{}{"rpm_x10": "fast"}, "status": map[string]interface{}{"state": "idle"}})
+
+		deadLetters := bus.DeadLetters()
+		require.Len(t, deadLetters, 2)
+		assert.Contains(t, deadLetters[0].Err.Error(), "payload has no value at $.motor.rpm_x10")
+		assert.Contains(t, deadLetters[1].Err.Error(), "cannot scale the non-numeric value")
+		assert.Len(t, points(pump.DittoID)["pump/speed"], 2)
+	})
+
+	t.Run("Should store none of a payload's values when one is rejected", func(t *testing.T) {
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID:            pump.ID,
+			FeaturePath:       "state",
+			ExpectedType:      "number",
+			TypeViolationMode: models.TypeViolationReject,
+		}))
+		defer func() {
+			require.NoError(t, ts.DB.DB.Where("twin_id = ? AND feature_path = ?", pump.ID, "state").Delete(&models.FeatureBinding{}).Error)
+		}()
+
+		before := len(bus.DeadLetters())
+		publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{
+			"ts":      sampled.Add(2 * time.Second).UnixMilli(),
+			"motor":   map[string]interface{}{"rpm_x10": 1000},
+			"sensors": []interface{}{map[string]interface{}{"temp.c": 62}},
+			"status":  map[string]interface{}{"state": "stopped"},
+		})
+
+		deadLetters := bus.DeadLetters()
+		require.Len(t, deadLetters, before+1)
+		assert.ErrorIs(t, deadLetters[before].Err, services.ErrTypeViolation)
+		stored := points(pump.DittoID)
+		assert.Len(t, stored["pump/speed"], 2, "values mapped before the rejected one are not stored")
+		assert.Len(t, stored["temperature"], 1)
+		assert.Len(t, stored["state"], 2)
+	})
+
+	t.Run("Should look up the project of a thing once for its messages", func(t *testing.T) {
+		lookups := twinRepo.lookups.Load()
+		for i := 0; i < 3; i++ {
+			publish(pump.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{
+				"ts":     sampled.Add(time.Duration(3+i) * time.Second).UnixMilli(),
+				"motor":  map[string]interface{}{"rpm_x10": 1000},
+				"status": map[string]interface{}{"state": "running"},
+			})
+		}
+		assert.Equal(t, lookups, twinRepo.lookups.Load(), "the project of a thing seen before is cached")
+
+		unknown := "org.digitalegiz.plant:transform-unknown"
+		publish(unknown, "telemetry", services.SourceMQTT, map[string]interface{}{"motor": map[string]interface{}{"rpm_x10": 100}})
+		publish(unknown, "telemetry", services.SourceMQTT, map[string]interface{}{"motor": map[string]interface{}{"rpm_x10": 100}})
+		assert.Equal(t, lookups+1, twinRepo.lookups.Load(), "things without a twin are cached too")
+		assert.Len(t, points(pump.DittoID)["pump/speed"], 5)
+	})
+
+	t.Run("Should pass through messages no transform matches", func(t *testing.T) {
+		before := len(bus.DeadLetters())
+		publish(pump.DittoID, "telemetry", services.SourceSimulator, map[string]interface{}{"motor": map[string]interface{}{"rpm_x10": 100}})
+		publish(pump.DittoID, "flow", services.SourceMQTT, 12.5)
+		publish(bench.DittoID, "telemetry", services.SourceMQTT, map[string]interface{}{"motor": map[string]interface{}{"rpm_x10": 100}})
+		assert.Len(t, bus.DeadLetters(), before)
+
+		stored := points(pump.DittoID)
+		require.Len(t, stored["telemetry"], 1)
+		assert.Equal(t, services.SourceSimulator, stored["telemetry"][0].Source)
+		require.Len(t, stored["flow"], 1)
+		assert.Equal(t, 12.5, stored["flow"][0].ValueNum)
+		assert.Len(t, points(bench.DittoID)["telemetry"], 1, "transforms restricted to a project skip the twins of others")
+	})
+
+	t.Run("Should reject invalid transforms", func(t *testing.T) {
+		mapping := []config.IngestMappingConfig{{Path: "$.value", Feature: "value"}}
+		for name, transforms := range map[string][]config.IngestTransformConfig{
+			"unnamed":         {{Mappings: mapping}},
+			"duplicate name":  {{Name: "a", Mappings: mapping}, {Name: "a", Mappings: mapping}},
+			"no mappings":     {{Name: "a"}},
+			"unknown source":  {{Name: "a", Source: "lorawan", Mappings: mapping}},
+			"unclosed path":   {{Name: "a", Mappings: []config.IngestMappingConfig{{Path: "$.values[0", Feature: "value"}}}},
+			"negative index":  {{Name: "a", Mappings: []config.IngestMappingConfig{{Path: "$.values[-1]", Feature: "value"}}}},
+			"empty path":      {{Name: "a", Mappings: []config.IngestMappingConfig{{Path: "$", Feature: "value"}}}},
+			"no feature":      {{Name: "a", Mappings: []config.IngestMappingConfig{{Path: "$.value"}}}},
+			"feature twice":   {{Name: "a", Mappings: append(mapping, mapping[0])}},
+			"empty time path": {{Name: "a", TimePath: "$..ts", Mappings: mapping}},
+		} {
+			_, err := services.NewPayloadTransformer(transforms, repoFactory.Twin())
+			assert.Error(t, err, name)
+		}
+	})
+}
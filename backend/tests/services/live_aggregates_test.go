@@ -0,0 +1,253 @@
+package services_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// batchAggregates recomputes the aggregates of numeric points per bucket of the given width
+func batchAggregates(points []models.TimeseriesData, width time.Duration) map[time.Time]models.AggregatedData {
+	buckets := make(map[time.Time]models.AggregatedData)
+	for _, point := range points {
+		start := point.Time.Truncate(width)
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = models.AggregatedData{TimeInterval: start, Min: point.ValueNum, Max: point.ValueNum, FirstTime: point.Time, LastTime: point.Time}
+		}
+		if point.ValueNum < bucket.Min {
+			bucket.Min = point.ValueNum
+		}
+		if point.ValueNum > bucket.Max {
+			bucket.Max = point.ValueNum
+		}
+		if point.Time.Before(bucket.FirstTime) {
+			bucket.FirstTime = point.Time
+		}
+		if point.Time.After(bucket.LastTime) {
+			bucket.LastTime = point.Time
+		}
+		bucket.Sum += point.ValueNum
+		bucket.Count++
+		bucket.Avg = bucket.Sum / float64(bucket.Count)
+		buckets[start] = bucket
+	}
+	return buckets
+}
+
+// assertAggregate checks a streamed aggregate against its batch recomputation
+func assertAggregate(t *testing.T, expected, actual models.AggregatedData) {
+	t.Helper()
+	assert.True(t, expected.TimeInterval.Equal(actual.TimeInterval), "bucket %s, got %s", expected.TimeInterval, actual.TimeInterval)
+	assert.Equal(t, expected.Count, actual.Count)
+	assert.InDelta(t, expected.Min, actual.Min, 1e-9)
+	assert.InDelta(t, expected.Max, actual.Max, 1e-9)
+	assert.InDelta(t, expected.Sum, actual.Sum, 1e-9)
+	assert.InDelta(t, expected.Avg, actual.Avg, 1e-9)
+	assert.True(t, expected.FirstTime.Equal(actual.FirstTime))
+	assert.True(t, expected.LastTime.Equal(actual.LastTime))
+}
+
+func TestLiveAggregates(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{},
+		&models.FeatureBinding{}, &models.TimeseriesData{}, &models.AlertData{})
+	memberID := ts.SeedTestUser("member@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+	adminID := ts.SeedTestUser("admin@example.com", "password123", true)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: memberID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+	require.NoError(t, ts.DB.DB.Create(&models.ProjectMember{ProjectID: project.ID, UserID: memberID, Role: models.ProjectRoleViewer}).Error)
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.plant:pump-1", ProjectID: project.ID, CreatedBy: memberID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	notificationService := services.NewNotificationService(nil, ts.Logger)
+	defer notificationService.Close()
+	liveAggregates := services.NewLiveAggregates(ts.DB, notificationService, ts.Logger)
+	notificationService.SetLiveAggregates(liveAggregates)
+	ingestService := services.NewIngestService(ts.DB, nil, notificationService, ts.Logger)
+	ingestService.SetLiveAggregates(liveAggregates)
+
+	// Websocket clients connect as the user given in the query
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.ParseUint(r.URL.Query().Get("user_id"), 10, 32)
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		notificationService.RegisterClient(conn, uint(userID), 0, false)
+	}))
+	defer server.Close()
+
+	type client struct {
+		conn    *websocket.Conn
+		pending []string
+	}
+	connect := func(userID uint) *client {
+		conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("ws%s?user_id=%d", strings.TrimPrefix(server.URL, "http"), userID), nil)
+		require.NoError(t, err)
+		return &client{conn: conn}
+	}
+	// next returns the next notification sent to a client, or false if none arrives in time;
+	// queued notifications arrive newline-separated in one websocket message
+	next := func(c *client, wait time.Duration) (services.NotificationMessage, bool) {
+		var message services.NotificationMessage
+		if len(c.pending) == 0 {
+			require.NoError(t, c.conn.SetReadDeadline(time.Now().Add(wait)))
+			_, data, err := c.conn.ReadMessage()
+			if err != nil {
+				return message, false
+			}
+			c.pending = strings.Split(string(data), "\n")
+		}
+		require.NoError(t, json.Unmarshal([]byte(c.pending[0]), &message))
+		c.pending = c.pending[1:]
+		return message, true
+	}
+	subscribe := func(c *client, twinID uint, featurePath, interval string) services.NotificationMessage {
+		require.NoError(t, c.conn.WriteJSON(map[string]interface{}{
+			"action": "subscribe_aggregate", "twin_id": twinID, "feature_path": featurePath, "interval": interval,
+		}))
+		message, ok := next(c, 5*time.Second)
+		require.True(t, ok, "no reply to the subscription")
+		return message
+	}
+
+	member := connect(memberID)
+	defer member.conn.Close()
+
+	base := time.Now().UTC().Truncate(10 * time.Minute).Add(-20 * time.Minute)
+	topic := services.LiveAggregateTopic(twin.ID, "temperature", "1m")
+
+	t.Run("Should stream the current bucket aggregate matching a batch recomputation", func(t *testing.T) {
+		reply := subscribe(member, twin.ID, "temperature", "1m")
+		require.Equal(t, services.NotificationTypeSubscribed, reply.Type)
+		assert.Equal(t, topic, reply.Topic)
+		assert.Equal(t, 1, liveAggregates.Subscriptions())
+
+		// Samples over three minutes, unevenly spread, with a string value in between
+		offsets := []time.Duration{5, 12, 30, 59, 61, 75, 130, 140, 170, 179}
+		values := []float64{21.5, 22, 19.75, 23, 24, 18.5, 20, 20.25, 26, 17}
+		var points []models.TimeseriesData
+		for i, offset := range offsets {
+			at := base.Add(offset * time.Second)
+			_, err := ingestService.ProcessFeatureValue(twin.DittoID, "temperature", at, json.RawMessage(strconv.FormatFloat(values[i], 'f', -1, 64)), services.SourceHTTP)
+			require.NoError(t, err)
+			points = append(points, models.TimeseriesData{Time: at, ValueNum: values[i]})
+		}
+		_, err := ingestService.ProcessFeatureValue(twin.DittoID, "temperature", base.Add(180*time.Second), json.RawMessage(`"offline"`), services.SourceHTTP)
+		require.NoError(t, err)
+
+		var streamed []models.AggregatedData
+		for len(streamed) < len(points) {
+			message, ok := next(member, 5*time.Second)
+			require.True(t, ok, "missing aggregate %d", len(streamed))
+			if message.Type != services.NotificationTypeLiveAggregate {
+				continue
+			}
+			assert.Equal(t, topic, message.Topic)
+			data, err := json.Marshal(message.Payload)
+			require.NoError(t, err)
+			var aggregate models.AggregatedData
+			require.NoError(t, json.Unmarshal(data, &aggregate))
+			streamed = append(streamed, aggregate)
+		}
+
+		// Every update is the aggregate of the samples of its bucket so far
+		for i, aggregate := range streamed {
+			assert.Equal(t, twin.DittoID, aggregate.TwinID)
+			assert.Equal(t, "temperature", aggregate.FeaturePath)
+			assert.Equal(t, "1m", aggregate.IntervalType)
+			expected := batchAggregates(points[:i+1], time.Minute)[points[i].Time.Truncate(time.Minute)]
+			assertAggregate(t, expected, aggregate)
+		}
+
+		// The aggregate resets at each bucket boundary
+		assert.Equal(t, 1, streamed[4].Count)
+		assert.Equal(t, 1, streamed[6].Count)
+		final := batchAggregates(points, time.Minute)
+		assertAggregate(t, final[base], streamed[3])
+		assertAggregate(t, final[base.Add(time.Minute)], streamed[5])
+		assertAggregate(t, final[base.Add(2*time.Minute)], streamed[9])
+	})
+
+	t.Run("Should refuse subscriptions to twins the user may not view", func(t *testing.T) {
+		outsider := connect(outsiderID)
+		defer outsider.conn.Close()
+
+		reply := subscribe(outsider, twin.ID, "temperature", "1m")
+		assert.Equal(t, services.NotificationTypeSubscriptionError, reply.Type)
+		assert.Equal(t, "access denied", reply.Payload.(map[string]interface{})["error"])
+
+		// Live aggregate topics cannot be subscribed to directly; the invalid subscription
+		// replied to afterwards shows the request was handled
+		require.NoError(t, outsider.conn.WriteJSON(map[string]string{"action": "subscribe", "topic": topic}))
+		reply = subscribe(outsider, twin.ID, "temperature", "2m")
+		assert.Equal(t, services.NotificationTypeSubscriptionError, reply.Type)
+		assert.Equal(t, "invalid interval: 2m", reply.Payload.(map[string]interface{})["error"])
+
+		_, err := ingestService.ProcessFeatureValue(twin.DittoID, "temperature", base.Add(185*time.Second), json.RawMessage(`16`), services.SourceHTTP)
+		require.NoError(t, err)
+		message, ok := next(member, 5*time.Second)
+		require.True(t, ok)
+		assert.Equal(t, services.NotificationTypeLiveAggregate, message.Type)
+		_, ok = next(outsider, 300*time.Millisecond)
+		assert.False(t, ok, "the outsider must not receive the aggregate")
+
+		// Admins view every twin
+		admin := connect(adminID)
+		defer admin.conn.Close()
+		assert.Equal(t, services.NotificationTypeSubscribed, subscribe(admin, twin.ID, "temperature", "1m").Type)
+		assert.Equal(t, services.NotificationTypeSubscriptionError, subscribe(admin, 999, "temperature", "1m").Type)
+	})
+
+	t.Run("Should drop the aggregate once every subscriber left", func(t *testing.T) {
+		member.conn.Close()
+		require.Eventually(t, func() bool { return notificationService.ClientCount() == 0 }, 5*time.Second, 10*time.Millisecond)
+		assert.Zero(t, liveAggregates.Subscriptions())
+	})
+
+	t.Run("Should aggregate points added directly and ignore those of past buckets", func(t *testing.T) {
+		direct := services.NewLiveAggregates(ts.DB, nil, ts.Logger)
+		_, err := direct.Subscribe(memberID, twin.ID, "pressure", "5m")
+		require.NoError(t, err)
+
+		point := func(offset time.Duration, value float64) models.TimeseriesData {
+			return models.TimeseriesData{Time: base.Add(offset), TwinID: twin.DittoID, FeaturePath: "pressure", ValueType: "number", ValueNum: value}
+		}
+		inOrder := []models.TimeseriesData{point(0, 1.5), point(time.Minute, 2.5), point(6*time.Minute, 3)}
+		updates := direct.Add(inOrder)
+		require.Len(t, updates, 3)
+		batch := batchAggregates(inOrder, 5*time.Minute)
+		assertAggregate(t, batch[base], updates[1])
+		assertAggregate(t, batch[base.Add(5*time.Minute)], updates[2])
+
+		// A late point of the closed bucket and points of other features are left out
+		assert.Empty(t, direct.Add([]models.TimeseriesData{point(2*time.Minute, 100)}))
+		other := point(7*time.Minute, 5)
+		other.FeaturePath = "flow"
+		assert.Empty(t, direct.Add([]models.TimeseriesData{other}))
+
+		direct.Unsubscribe(services.LiveAggregateTopic(twin.ID, "pressure", "5m"))
+		assert.Zero(t, direct.Subscriptions())
+		assert.Empty(t, direct.Add([]models.TimeseriesData{point(8*time.Minute, 4)}))
+	})
+}
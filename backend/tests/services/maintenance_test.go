@@ -0,0 +1,78 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	// recorder registers a component recording its pause and resume calls
+	recorder := func(service *services.MaintenanceService, name string, failPause bool) *[]string {
+		calls := &[]string{}
+		require.NoError(t, service.Register(name,
+			func() error {
+				*calls = append(*calls, "pause")
+				if failPause {
+					return errors.New(name + " did not pause")
+				}
+				return nil
+			},
+			func() error {
+				*calls = append(*calls, "resume")
+				return nil
+			},
+		))
+		return calls
+	}
+
+	t.Run("Should pause and resume the registered components", func(t *testing.T) {
+		service := services.NewMaintenanceService(&config.MaintenanceConfig{RetryAfter: 60}, ts.Logger)
+		calls := recorder(service, "kafka", false)
+		assert.False(t, service.Enabled())
+		assert.Empty(t, *calls)
+
+		require.NoError(t, service.Enable("migration"))
+		require.NoError(t, service.Enable("still migrating"))
+		assert.True(t, service.Enabled())
+		assert.Equal(t, []string{"pause"}, *calls)
+
+		status := service.Status()
+		assert.Equal(t, "still migrating", status.Reason)
+		assert.Equal(t, []string{"kafka"}, status.Paused)
+		assert.Equal(t, 60, status.RetryAfterSeconds)
+
+		require.NoError(t, service.Disable())
+		assert.False(t, service.Enabled())
+		assert.Equal(t, []string{"pause", "resume"}, *calls)
+		assert.Empty(t, service.Status().Paused)
+	})
+
+	t.Run("Should pause components registered while enabled from configuration", func(t *testing.T) {
+		service := services.NewMaintenanceService(&config.MaintenanceConfig{Enabled: true}, ts.Logger)
+		calls := recorder(service, "kafka", false)
+		assert.True(t, service.Enabled())
+		assert.Equal(t, []string{"pause"}, *calls)
+	})
+
+	t.Run("Should stay enabled and report components that failed to pause", func(t *testing.T) {
+		service := services.NewMaintenanceService(&config.MaintenanceConfig{}, ts.Logger)
+		failing := recorder(service, "kafka", true)
+		other := recorder(service, "ditto-forwarding", false)
+
+		err := service.Enable("incident")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "kafka did not pause")
+		assert.True(t, service.Enabled())
+		assert.Equal(t, []string{"pause"}, *failing)
+		assert.Equal(t, []string{"pause"}, *other)
+	})
+}
@@ -0,0 +1,158 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMLModelService_ExportImport(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.MLTask{}, &models.MLModelMetadata{})
+
+	mlRepo := repository.NewRepositoryFactory(ts.DB.DB).ML()
+	require.NoError(t, mlRepo.CreateMLModelMetadata(&models.MLModelMetadata{
+		ModelID: "pump-anomaly", Name: "Pump anomalies", Type: models.MLTaskTypeAnomaly, Version: "1.0",
+		InputSchema:  `{"type": "object", "properties": {"pressure": {"type": "number"}}}`,
+		OutputSchema: `{"type": "object", "properties": {"score": {"type": "number"}}}`,
+	}))
+	require.NoError(t, mlRepo.CreateMLModelMetadata(&models.MLModelMetadata{
+		ModelID: "bearing-rul", Name: "Bearing wear", Type: models.MLTaskTypePrediction, Version: "2.1",
+	}))
+	require.NoError(t, mlRepo.CreateMLTask(&models.MLTask{
+		Name: "Pump watch", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0",
+	}))
+
+	service := services.NewMLModelService(ts.DB, ts.Logger)
+
+	// Bundles travel as files between environments
+	export := func() *services.MLModelBundle {
+		bundle, err := service.Export()
+		require.NoError(t, err)
+		data, err := json.Marshal(bundle)
+		require.NoError(t, err)
+		var decoded services.MLModelBundle
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		return &decoded
+	}
+	stored := func(modelID string) models.MLModelMetadata {
+		var metadata models.MLModelMetadata
+		require.NoError(t, ts.DB.DB.Where("model_id = ?", modelID).First(&metadata).Error)
+		return metadata
+	}
+
+	t.Run("Should export every model with its schemas", func(t *testing.T) {
+		bundle := export()
+		assert.Equal(t, services.MLModelBundleFormat, bundle.Format)
+		require.Len(t, bundle.Models, 2)
+		assert.Equal(t, "bearing-rul", bundle.Models[0].ModelID)
+		assert.Empty(t, bundle.Models[0].InputSchema)
+
+		pump := bundle.Models[1]
+		assert.Equal(t, "pump-anomaly", pump.ModelID)
+		assert.Equal(t, models.MLTaskTypeAnomaly, pump.Type)
+		assert.Equal(t, "1.0", pump.Version)
+		assert.JSONEq(t, `{"type": "object", "properties": {"pressure": {"type": "number"}}}`, string(pump.InputSchema))
+	})
+
+	t.Run("Should round-trip a bundle without changes", func(t *testing.T) {
+		result, err := service.Import(export())
+		require.NoError(t, err)
+		assert.True(t, result.Applied)
+		assert.Empty(t, result.Created)
+		assert.Empty(t, result.Updated)
+		assert.ElementsMatch(t, []string{"pump-anomaly", "bearing-rul"}, result.Unchanged)
+	})
+
+	t.Run("Should upsert models by model ID", func(t *testing.T) {
+		bundle := export()
+		bundle.Models[1].Version = "1.1"
+		bundle.Models[1].OutputSchema = json.RawMessage(`{"type": "object", "required": ["score"]}`)
+		bundle.Models = append(bundle.Models, services.MLModelDefinition{
+			ModelID: "valve-state", Name: "Valve state", Type: models.MLTaskTypeClassification, Version: "0.3",
+			InputSchema: json.RawMessage(`{"type": "array", "items": {"type": "number"}}`),
+		})
+
+		result, err := service.Import(bundle)
+		require.NoError(t, err)
+		assert.True(t, result.Applied)
+		assert.Equal(t, []string{"valve-state"}, result.Created)
+		assert.Equal(t, []string{"pump-anomaly"}, result.Updated)
+		assert.Equal(t, []string{"bearing-rul"}, result.Unchanged)
+
+		pump := stored("pump-anomaly")
+		assert.Equal(t, "1.1", pump.Version)
+		assert.JSONEq(t, `{"type": "object", "required": ["score"]}`, pump.OutputSchema)
+		assert.JSONEq(t, `{"type": "array", "items": {"type": "number"}}`, stored("valve-state").InputSchema)
+
+		// Importing the new registry into another environment yields the same models
+		again, err := service.Import(export())
+		require.NoError(t, err)
+		assert.Len(t, again.Unchanged, 3)
+	})
+
+	t.Run("Should reject bundles with invalid schemas", func(t *testing.T) {
+		bundle := export()
+		bundle.Models[0].Version = "3.0"
+		bundle.Models[1].InputSchema = json.RawMessage(`{"type": "object", "properties": {"pressure": {"type": 7}}}`)
+		bundle.Models[2].OutputSchema = json.RawMessage(`{"type": "object",`)
+		bundle.Models = append(bundle.Models, services.MLModelDefinition{ModelID: "unnamed", Type: "regression"})
+
+		result, err := service.Import(bundle)
+		require.NoError(t, err)
+		assert.False(t, result.Applied)
+
+		fields := map[string]string{}
+		for _, problem := range result.Errors {
+			fields[problem.ModelID+"/"+problem.Field] = problem.Message
+		}
+		assert.Equal(t, map[string]string{
+			"pump-anomaly/input_schema": "input schema is not a valid JSON Schema",
+			"valve-state/output_schema": "output schema is not a valid JSON Schema",
+			"unnamed/name":              "name is required",
+			"unnamed/version":           "version is required",
+			"unnamed/type":              `unknown model type: "regression"`,
+		}, fields)
+		for _, problem := range result.Errors {
+			if problem.Field == "input_schema" || problem.Field == "output_schema" {
+				assert.NotEmpty(t, problem.SchemaErrors)
+			}
+		}
+
+		// Nothing is applied, not even the valid change
+		assert.Equal(t, "2.1", stored("bearing-rul").Version)
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.MLModelMetadata{}).Count(&count).Error)
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("Should report conflicts", func(t *testing.T) {
+		bundle := export()
+		bundle.Models[1].Type = models.MLTaskTypeClassification
+		bundle.Models = append(bundle.Models, bundle.Models[0])
+
+		result, err := service.Import(bundle)
+		require.NoError(t, err)
+		assert.False(t, result.Applied)
+		assert.Empty(t, result.Errors)
+		require.Len(t, result.Conflicts, 2)
+		assert.Equal(t, "bearing-rul", result.Conflicts[0].ModelID)
+		assert.Equal(t, 3, result.Conflicts[0].Index)
+		assert.Equal(t, "pump-anomaly", result.Conflicts[1].ModelID)
+		assert.Equal(t, `ML task "Pump watch" uses the model for anomaly_detection`, result.Conflicts[1].Message)
+		assert.Equal(t, models.MLTaskTypeAnomaly, stored("pump-anomaly").Type)
+	})
+
+	t.Run("Should reject unknown bundle formats", func(t *testing.T) {
+		_, err := service.Import(&services.MLModelBundle{Format: "models/v0"})
+		assert.EqualError(t, err, `unsupported bundle format: "models/v0"`)
+	})
+}
@@ -0,0 +1,307 @@
+package services_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/kafka"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMLTriggerGate(t *testing.T) {
+	number := func(v float64) *models.TimeseriesData {
+		return &models.TimeseriesData{ValueType: "number", ValueNum: v}
+	}
+	now := time.Now()
+
+	t.Run("Should forward only changes above the minimum delta", func(t *testing.T) {
+		gate := services.NewMLTriggerGate()
+		binding := &models.MLTaskBinding{ID: 1, ScheduleType: services.MLScheduleEvent, ScheduleConfig: `{"min_delta":0.5}`}
+
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20), now))
+		assert.False(t, gate.Admit(binding, "thing-1", "temperature", number(20.3), now))
+		assert.False(t, gate.Admit(binding, "thing-1", "temperature", number(19.6), now))
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20.6), now))
+
+		// The delta is measured from the last forwarded value, so slow drift is caught
+		assert.False(t, gate.Admit(binding, "thing-1", "temperature", number(20.9), now))
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(21.2), now))
+
+		// Other features and twins are tracked separately
+		assert.True(t, gate.Admit(binding, "thing-1", "pressure", number(20), now))
+		assert.True(t, gate.Admit(binding, "thing-2", "temperature", number(21.2), now))
+	})
+
+	t.Run("Should forward non-numeric values only when they change", func(t *testing.T) {
+		gate := services.NewMLTriggerGate()
+		binding := &models.MLTaskBinding{ID: 1, ScheduleConfig: `{"min_delta":1}`}
+		state := func(s string) *models.TimeseriesData {
+			return &models.TimeseriesData{ValueType: "string", ValueStr: s}
+		}
+
+		assert.True(t, gate.Admit(binding, "thing-1", "mode", state("auto"), now))
+		assert.False(t, gate.Admit(binding, "thing-1", "mode", state("auto"), now))
+		assert.True(t, gate.Admit(binding, "thing-1", "mode", state("manual"), now))
+	})
+
+	t.Run("Should forward at most once per interval", func(t *testing.T) {
+		gate := services.NewMLTriggerGate()
+		binding := &models.MLTaskBinding{ID: 1, ScheduleType: services.MLScheduleInterval, ScheduleConfig: `{"interval":60}`}
+
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20), now))
+		assert.False(t, gate.Admit(binding, "thing-1", "temperature", number(80), now.Add(59*time.Second)))
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20), now.Add(60*time.Second)))
+	})
+
+	t.Run("Should forward every value without a trigger config", func(t *testing.T) {
+		gate := services.NewMLTriggerGate()
+		binding := &models.MLTaskBinding{ID: 1}
+
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20), now))
+		assert.True(t, gate.Admit(binding, "thing-1", "temperature", number(20), now))
+	})
+
+	t.Run("Should only cover the mapped features of active event bindings", func(t *testing.T) {
+		mapped := &models.MLTaskBinding{Active: true, InputMappingJSON: `{"features":["temperature"]}`}
+		assert.True(t, services.BindingCoversFeature(mapped, "temperature"))
+		assert.False(t, services.BindingCoversFeature(mapped, "pressure"))
+
+		assert.True(t, services.BindingCoversFeature(&models.MLTaskBinding{Active: true}, "pressure"))
+		assert.False(t, services.BindingCoversFeature(&models.MLTaskBinding{Active: false}, "pressure"))
+		assert.False(t, services.BindingCoversFeature(&models.MLTaskBinding{Active: true, ScheduleType: services.MLScheduleCron}, "pressure"))
+	})
+}
+
+func TestIngestService_MLForwarding(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.FeatureBinding{},
+		&models.TimeseriesData{},
+		&models.MLTask{},
+		&models.MLTaskBinding{},
+		&models.QuarantinedPoint{},
+	)
+	userID := ts.SeedTestUser("ml-trigger@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", ProjectID: project.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	task := &models.MLTask{Name: "Anomalies", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0", Active: true, CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(task).Error)
+	require.NoError(t, ts.DB.DB.Create(&models.MLTaskBinding{
+		TaskID:           task.ID,
+		TwinID:           twin.ID,
+		InputMappingJSON: `{"features":["temperature"]}`,
+		ScheduleType:     services.MLScheduleEvent,
+		ScheduleConfig:   `{"min_delta":0.5}`,
+		Active:           true,
+	}).Error)
+
+	bus := testutils.NewFakeKafka()
+	service := services.NewIngestService(ts.DB, nil, nil, ts.Logger)
+	service.SetKafkaManager(bus)
+	// Pauses set through the twin and project services take effect at once
+	pauses := services.NewMLPauseCache(ts.DB, ts.Logger)
+	service.SetMLPauseCache(pauses)
+
+	ingest := func(featureID, value string) {
+		_, err := service.ProcessFeatureValue(twin.DittoID, featureID, time.Now(), json.RawMessage(value), services.SourceDittoKafka)
+		require.NoError(t, err)
+	}
+
+	t.Run("Should not trigger inference for sub-threshold changes", func(t *testing.T) {
+		ingest("temperature", `20.0`)
+		ingest("temperature", `20.2`)
+		ingest("temperature", `19.8`)
+
+		messages := bus.Messages(kafka.TopicMLInput)
+		require.Len(t, messages, 1)
+		assert.Equal(t, task.ModelID, string(messages[0].Key))
+	})
+
+	t.Run("Should trigger inference for significant changes", func(t *testing.T) {
+		ingest("temperature", `21.0`)
+
+		messages := bus.Messages(kafka.TopicMLInput)
+		require.Len(t, messages, 2)
+
+		var message struct {
+			ModelID string `json:"modelId"`
+			Input   struct {
+				FeatureID string          `json:"featureId"`
+				Data      json.RawMessage `json:"data"`
+			} `json:"input"`
+		}
+		require.NoError(t, json.Unmarshal(messages[1].Value, &message))
+		assert.Equal(t, task.ModelID, message.ModelID)
+		assert.Equal(t, "temperature", message.Input.FeatureID)
+		assert.JSONEq(t, `21.0`, string(message.Input.Data))
+	})
+
+	t.Run("Should not forward features no binding takes as input", func(t *testing.T) {
+		ingest("pressure", `3.5`)
+
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 2)
+	})
+
+	stored := func() int64 {
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.TimeseriesData{}).Where("feature_path = ?", "temperature").Count(&count).Error)
+		return count
+	}
+	twinService := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+	twinService.SetMLPauseCache(pauses)
+	projectService := services.NewProjectService(ts.DB, ts.Logger)
+	projectService.SetMLPauseCache(pauses)
+
+	t.Run("Should store but not forward the values of a paused twin", func(t *testing.T) {
+		_, err := twinService.SetMLPause(twin.ID, true, nil)
+		require.NoError(t, err)
+
+		before := stored()
+		ingest("temperature", `30.0`)
+
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 2)
+		assert.Equal(t, before+1, stored())
+
+		_, err = twinService.SetMLPause(twin.ID, false, nil)
+		require.NoError(t, err)
+		ingest("temperature", `40.0`)
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 3)
+	})
+
+	t.Run("Should forward again once the pause expires", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		_, err := twinService.SetMLPause(twin.ID, true, &past)
+		assert.ErrorIs(t, err, services.ErrInvalidMLPause)
+
+		// A pause that has run out since it was set
+		require.NoError(t, repoFactory.Twin().SetMLPause(twin.ID, true, &past))
+		ingest("temperature", `50.0`)
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 4)
+		require.NoError(t, repoFactory.Twin().SetMLPause(twin.ID, false, nil))
+	})
+
+	t.Run("Should not forward the values of twins in a paused project", func(t *testing.T) {
+		until := time.Now().Add(time.Hour)
+		_, err := projectService.SetMLPause(project.ID, true, &until)
+		require.NoError(t, err)
+
+		before := stored()
+		ingest("temperature", `60.0`)
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 4)
+		assert.Equal(t, before+1, stored())
+
+		pause, err := twinService.GetMLPause(twin)
+		require.NoError(t, err)
+		require.NotNil(t, pause)
+		assert.Equal(t, services.MLPauseScopeProject, pause.Scope)
+
+		_, err = projectService.SetMLPause(project.ID, false, nil)
+		require.NoError(t, err)
+		ingest("temperature", `70.0`)
+		assert.Len(t, bus.Messages(kafka.TopicMLInput), 5)
+	})
+
+	t.Run("Should not forward quarantined samples", func(t *testing.T) {
+		plausibleMax := 150.0
+		require.NoError(t, repoFactory.Twin().SaveFeatureBinding(&models.FeatureBinding{
+			TwinID: twin.ID, FeaturePath: "temperature", PlausibleMax: &plausibleMax,
+		}))
+
+		start := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+		samples := fmt.Sprintf(`[{"time":%q,"value":80},{"time":%q,"value":9999},{"time":%q,"value":85}]`,
+			start.Format(time.RFC3339), start.Add(10*time.Second).Format(time.RFC3339), start.Add(20*time.Second).Format(time.RFC3339))
+		ingest("temperature", samples)
+
+		messages := bus.Messages(kafka.TopicMLInput)
+		require.Len(t, messages, 6)
+		var message struct {
+			Input struct {
+				Data []struct {
+					Time  time.Time `json:"time"`
+					Value float64   `json:"value"`
+				} `json:"data"`
+			} `json:"input"`
+		}
+		require.NoError(t, json.Unmarshal(messages[5].Value, &message))
+		require.Len(t, message.Input.Data, 2)
+		assert.Equal(t, 80.0, message.Input.Data[0].Value)
+		assert.True(t, message.Input.Data[0].Time.Equal(start))
+		assert.Equal(t, 85.0, message.Input.Data[1].Value)
+
+		// A payload with every sample in range is forwarded as it was sent
+		ingest("temperature", `90.0`)
+		messages = bus.Messages(kafka.TopicMLInput)
+		require.Len(t, messages, 7)
+		assert.NotContains(t, string(messages[6].Value), "9999")
+	})
+}
+
+func TestMLPauseCache(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	userID := ts.SeedTestUser("ml-pause@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, repoFactory.Project().Create(project))
+	twin := &models.Twin{Name: "Pump 1", DittoID: "org.digitalegiz.project1:pump-1", ProjectID: project.ID, CreatedBy: userID}
+	require.NoError(t, repoFactory.Twin().Create(twin))
+
+	cache := services.NewMLPauseCache(ts.DB, ts.Logger)
+	now := time.Now()
+
+	t.Run("Should keep the pause state for a short time", func(t *testing.T) {
+		assert.False(t, cache.Paused(twin.DittoID, now))
+
+		// Changed without invalidating the cache, as by another instance
+		require.NoError(t, repoFactory.Twin().SetMLPause(twin.ID, true, nil))
+		assert.False(t, cache.Paused(twin.DittoID, now.Add(time.Second)))
+		assert.True(t, cache.Paused(twin.DittoID, now.Add(10*time.Second)))
+	})
+
+	t.Run("Should reload the state of an invalidated twin", func(t *testing.T) {
+		require.NoError(t, repoFactory.Twin().SetMLPause(twin.ID, false, nil))
+		assert.True(t, cache.Paused(twin.DittoID, now.Add(11*time.Second)))
+
+		cache.InvalidateTwin(twin.DittoID)
+		assert.False(t, cache.Paused(twin.DittoID, now.Add(11*time.Second)))
+	})
+
+	t.Run("Should reload the state of an invalidated project", func(t *testing.T) {
+		until := now.Add(13 * time.Second)
+		require.NoError(t, repoFactory.Project().SetMLPause(project.ID, true, &until))
+		assert.False(t, cache.Paused(twin.DittoID, now.Add(12*time.Second)))
+
+		cache.InvalidateProject(project.ID)
+		assert.True(t, cache.ProjectPaused(project.ID, now.Add(12*time.Second)))
+		assert.True(t, cache.Paused(twin.DittoID, now.Add(12*time.Second)))
+
+		// The cached pause still ends on time
+		assert.False(t, cache.ProjectPaused(project.ID, until))
+	})
+
+	t.Run("Should not pause things without a twin", func(t *testing.T) {
+		assert.False(t, cache.Paused("org.digitalegiz.project1:unknown", now))
+	})
+}
@@ -0,0 +1,198 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingChannel is a delivery channel whose sends always fail
+type failingChannel struct{}
+
+func (failingChannel) Name() string { return "sms" }
+
+func (failingChannel) Recipients(notification *models.Notification) ([]string, error) {
+	return []string{"+10000000000"}, nil
+}
+
+func (failingChannel) Send(recipient string, notification *models.Notification) error {
+	return errors.New("gateway unavailable")
+}
+
+func TestDeliveryService_Broadcast(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.WebhookSubscription{}, &models.Notification{}, &models.NotificationDelivery{})
+
+	var received []services.WebhookEvent
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event services.WebhookEvent
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &event)
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer healthy.Close()
+
+	// Recovers after failing its first two deliveries
+	var flakyCalls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flakyCalls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	webhookService := services.NewWebhookService(ts.DB, ts.Logger)
+	webhookService.SetAllowPrivateNetworks(true)
+	subscribe := func(url, eventTypes string) *models.WebhookSubscription {
+		subscription := &models.WebhookSubscription{ProjectID: 1, URL: url, EventTypes: eventTypes}
+		require.NoError(t, webhookService.CreateSubscription(subscription))
+		return subscription
+	}
+	healthySub := subscribe(healthy.URL, "")
+	flakySub := subscribe(flaky.URL, models.WebhookEventAlertCreated)
+	brokenSub := subscribe(broken.URL, "")
+	subscribe(healthy.URL, models.WebhookEventTwinDeleted)
+
+	notificationService := services.NewNotificationService(nil, ts.Logger)
+	defer notificationService.Close()
+
+	now := time.Now()
+	service := services.NewDeliveryService(ts.DB, &config.NotificationConfig{
+		MaxAttempts:    3,
+		RetryBaseDelay: 10,
+		RetryMaxDelay:  15,
+	}, ts.Logger)
+	service.SetClock(func() time.Time { return now })
+	service.RegisterChannel(services.NewWebhookChannel(webhookService))
+	service.RegisterChannel(services.NewWebSocketChannel(notificationService))
+	service.RegisterChannel(failingChannel{})
+
+	// byRecipient indexes receipts by channel and recipient
+	byRecipient := func(deliveries []models.NotificationDelivery) map[string]models.NotificationDelivery {
+		indexed := make(map[string]models.NotificationDelivery)
+		for _, delivery := range deliveries {
+			indexed[delivery.Channel+"/"+delivery.Recipient] = delivery
+		}
+		return indexed
+	}
+	webhookKey := func(subscription *models.WebhookSubscription) string {
+		return services.DeliveryChannelWebhook + "/" + strconv.FormatUint(uint64(subscription.ID), 10)
+	}
+
+	var notificationID uint
+	t.Run("Should record a receipt per recipient and channel", func(t *testing.T) {
+		receipt, err := service.Broadcast(1, models.WebhookEventAlertCreated, map[string]interface{}{"severity": "critical"})
+		require.NoError(t, err)
+		notificationID = receipt.Notification.ID
+
+		deliveries := byRecipient(receipt.Deliveries)
+		require.Len(t, deliveries, 5)
+
+		delivered := deliveries[webhookKey(healthySub)]
+		assert.Equal(t, models.DeliveryStatusDelivered, delivered.Status)
+		assert.Equal(t, 1, delivered.Attempts)
+		assert.Empty(t, delivered.LastError)
+		require.NotNil(t, delivered.DeliveredAt)
+		assert.Nil(t, delivered.NextAttemptAt)
+
+		assert.Equal(t, models.DeliveryStatusDelivered, deliveries[services.DeliveryChannelWebSocket+"/project:1"].Status)
+
+		for _, key := range []string{webhookKey(flakySub), webhookKey(brokenSub), "sms/+10000000000"} {
+			pending := deliveries[key]
+			assert.Equal(t, models.DeliveryStatusPending, pending.Status, key)
+			assert.Equal(t, 1, pending.Attempts)
+			assert.NotEmpty(t, pending.LastError)
+			require.NotNil(t, pending.NextAttemptAt)
+			assert.WithinDuration(t, now.Add(10*time.Second), *pending.NextAttemptAt, time.Millisecond)
+		}
+		assert.Contains(t, deliveries[webhookKey(brokenSub)].LastError, "500")
+
+		require.Len(t, received, 1)
+		assert.Equal(t, receipt.Notification.EventID, received[0].ID)
+		assert.Equal(t, models.WebhookEventAlertCreated, received[0].Type)
+	})
+
+	t.Run("Should retry failed deliveries with backoff until they run out of attempts", func(t *testing.T) {
+		// Nothing is due before the first retry delay has passed
+		attempted, err := service.RetryDue(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, attempted)
+
+		now = now.Add(10 * time.Second)
+		attempted, err = service.RetryDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempted)
+
+		receipt, err := service.Deliveries(notificationID)
+		require.NoError(t, err)
+		deliveries := byRecipient(receipt.Deliveries)
+		broken := deliveries[webhookKey(brokenSub)]
+		assert.Equal(t, models.DeliveryStatusPending, broken.Status)
+		assert.Equal(t, 2, broken.Attempts)
+		require.NotNil(t, broken.NextAttemptAt)
+		// The doubled delay is capped at the maximum
+		assert.WithinDuration(t, now.Add(15*time.Second), *broken.NextAttemptAt, time.Millisecond)
+
+		now = now.Add(15 * time.Second)
+		attempted, err = service.RetryDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempted)
+
+		receipt, err = service.Deliveries(notificationID)
+		require.NoError(t, err)
+		deliveries = byRecipient(receipt.Deliveries)
+
+		recovered := deliveries[webhookKey(flakySub)]
+		assert.Equal(t, models.DeliveryStatusDelivered, recovered.Status)
+		assert.Equal(t, 3, recovered.Attempts)
+		assert.Empty(t, recovered.LastError)
+
+		for _, key := range []string{webhookKey(brokenSub), "sms/+10000000000"} {
+			failed := deliveries[key]
+			assert.Equal(t, models.DeliveryStatusFailed, failed.Status, key)
+			assert.Equal(t, 3, failed.Attempts)
+			assert.NotEmpty(t, failed.LastError)
+			assert.Nil(t, failed.NextAttemptAt)
+		}
+
+		// Permanently failed deliveries are not retried again
+		now = now.Add(time.Hour)
+		attempted, err = service.RetryDue(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, attempted)
+
+		// Every webhook attempt carries the same event ID so receivers can drop duplicates
+		for _, event := range received {
+			assert.Equal(t, receipt.Notification.EventID, event.ID)
+		}
+	})
+
+	t.Run("Should report unknown notifications", func(t *testing.T) {
+		_, err := service.Deliveries(9999)
+		assert.EqualError(t, err, "notification not found")
+	})
+}
@@ -0,0 +1,161 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationHistory(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.NotificationRecord{})
+	memberID := ts.SeedTestUser("member@example.com", "password123", false)
+	outsiderID := ts.SeedTestUser("outsider@example.com", "password123", false)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	plant := &models.Project{Name: "Plant", CreatedBy: memberID}
+	require.NoError(t, repoFactory.Project().Create(plant))
+	lab := &models.Project{Name: "Lab", CreatedBy: outsiderID}
+	require.NoError(t, repoFactory.Project().Create(lab))
+
+	stored := func() int64 {
+		var count int64
+		require.NoError(t, ts.DB.DB.Model(&models.NotificationRecord{}).Count(&count).Error)
+		return count
+	}
+	newHistory := func(batchSize, flushInterval, queueSize int) (*services.NotificationHistory, *services.NotificationService) {
+		history := services.NewNotificationHistory(ts.DB, &config.NotificationConfig{
+			HistoryTypes:         []string{"alert", "system_event"},
+			HistoryBatchSize:     batchSize,
+			HistoryFlushInterval: flushInterval,
+			HistoryQueueSize:     queueSize,
+		}, ts.Logger)
+		notifications := services.NewNotificationService(nil, ts.Logger)
+		notifications.SetHistory(history)
+		return history, notifications
+	}
+
+	t.Run("Should write full batches without waiting for the flush interval", func(t *testing.T) {
+		history, notifications := newHistory(3, int(time.Hour/time.Millisecond), 100)
+		defer notifications.Close()
+		require.NoError(t, history.Start(context.Background()))
+
+		for i := 0; i < 4; i++ {
+			notifications.NotifyProject(plant.ID, services.NotificationTypeAlert, "twins/pump-1", map[string]interface{}{"severity": "warning"})
+		}
+		// Other types are not kept
+		notifications.NotifyProject(plant.ID, services.NotificationTypeTwinUpdate, "twins/pump-1", map[string]interface{}{})
+
+		require.Eventually(t, func() bool { return stored() == 3 }, 5*time.Second, 10*time.Millisecond)
+
+		// Stopping writes the partial batch
+		require.NoError(t, history.Stop(context.Background()))
+		assert.Equal(t, int64(4), stored())
+	})
+
+	t.Run("Should write partial batches once the flush interval passes", func(t *testing.T) {
+		history, notifications := newHistory(100, 50, 100)
+		defer notifications.Close()
+		require.NoError(t, history.Start(context.Background()))
+		defer history.Stop(context.Background())
+
+		before := stored()
+		notifications.Notify(services.NotificationTypeSystemEvent, "maintenance", map[string]interface{}{"status": "scheduled"})
+		require.Eventually(t, func() bool { return stored() == before+1 }, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Should not keep admin notifications", func(t *testing.T) {
+		history, notifications := newHistory(100, 50, 100)
+		defer notifications.Close()
+		require.NoError(t, history.Start(context.Background()))
+
+		before := stored()
+		notifications.NotifyAdmins(services.NotificationTypeSystemEvent, "kafka/consumers/ingest", map[string]interface{}{"last_error": "connection refused"})
+		require.NoError(t, history.Stop(context.Background()))
+
+		assert.Equal(t, before, stored())
+		var leaked int64
+		require.NoError(t, ts.DB.DB.Model(&models.NotificationRecord{}).Where("topic = ?", "kafka/consumers/ingest").Count(&leaked).Error)
+		assert.Zero(t, leaked)
+	})
+
+	t.Run("Should drop notifications rather than block when the queue is full", func(t *testing.T) {
+		history, notifications := newHistory(100, 50, 2)
+		defer notifications.Close()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 5; i++ {
+				notifications.NotifyProject(lab.ID, services.NotificationTypeAlert, "twins/scope-1", map[string]interface{}{"severity": "critical"})
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("notifying blocked on the history")
+		}
+		assert.Equal(t, int64(3), history.Dropped())
+
+		before := stored()
+		require.NoError(t, history.Start(context.Background()))
+		require.NoError(t, history.Stop(context.Background()))
+		assert.Equal(t, before+2, stored())
+	})
+
+	t.Run("Should list the notifications visible to a user, newest first", func(t *testing.T) {
+		history, notifications := newHistory(100, 50, 100)
+		notifications.Close()
+		require.NoError(t, ts.DB.DB.Where("1 = 1").Delete(&models.NotificationRecord{}).Error)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		plantID, labID := plant.ID, lab.ID
+		require.NoError(t, repoFactory.Notification().CreateRecords([]models.NotificationRecord{
+			{ProjectID: &plantID, Type: "alert", Severity: "warning", Topic: "twins/pump-1", Time: now.Add(-3 * time.Hour)},
+			{ProjectID: &plantID, Type: "alert", Severity: "critical", Topic: "twins/pump-1", Time: now.Add(-2 * time.Hour)},
+			{ProjectID: &labID, Type: "alert", Severity: "critical", Topic: "twins/scope-1", Time: now.Add(-time.Hour)},
+			{Type: "system_event", Topic: "kafka/consumers/ingest", Time: now},
+		}))
+
+		list := func(filter repository.NotificationRecordFilter, page, size int) *services.NotificationHistoryPage {
+			result, err := history.List(services.NotificationHistoryQuery{NotificationRecordFilter: filter, Page: page, PageSize: size})
+			require.NoError(t, err)
+			return result
+		}
+		topics := func(result *services.NotificationHistoryPage) []string {
+			var names []string
+			for _, record := range result.Notifications {
+				names = append(names, record.Topic)
+			}
+			return names
+		}
+
+		result := list(repository.NotificationRecordFilter{UserID: memberID}, 1, 10)
+		assert.Equal(t, int64(3), result.Total)
+		assert.Equal(t, []string{"kafka/consumers/ingest", "twins/pump-1", "twins/pump-1"}, topics(result))
+
+		result = list(repository.NotificationRecordFilter{}, 2, 3)
+		assert.Equal(t, int64(4), result.Total)
+		assert.Equal(t, []string{"twins/pump-1"}, topics(result))
+
+		result = list(repository.NotificationRecordFilter{Types: []string{"alert"}, Severities: []string{"critical"}}, 1, 10)
+		assert.Equal(t, []string{"twins/scope-1", "twins/pump-1"}, topics(result))
+
+		result = list(repository.NotificationRecordFilter{ProjectID: plant.ID, Start: now.Add(-150 * time.Minute), End: now}, 1, 10)
+		require.Len(t, result.Notifications, 1)
+		assert.Equal(t, "critical", result.Notifications[0].Severity)
+
+		_, err := history.List(services.NotificationHistoryQuery{NotificationRecordFilter: repository.NotificationRecordFilter{Start: now, End: now}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,265 @@
+package services_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationService_StalledClient(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	service := services.NewNotificationService(nil, ts.Logger)
+	defer service.Close()
+
+	// Websocket server registering every connection with the service
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		service.RegisterClient(conn, 1, 0, false)
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	// The stalled client connects but never reads
+	stalled, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer stalled.Close()
+
+	// The healthy client reads everything and reports the final marker
+	healthy, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer healthy.Close()
+
+	gotFinal := make(chan struct{})
+	go func() {
+		for {
+			_, data, err := healthy.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(data), "final-marker") {
+				close(gotFinal)
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool { return service.ClientCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("Should keep broadcasting and drop the stalled client", func(t *testing.T) {
+		// Large payloads fill the stalled client's socket and send buffer,
+		// paced so the healthy client can keep up
+		payload := strings.Repeat("x", 64*1024)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 5000 && service.ClientCount() > 1; i++ {
+				service.Notify(services.NotificationTypeSystemEvent, "load", payload)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(30 * time.Second):
+			t.Fatal("broadcast stalled on slow client")
+		}
+
+		assert.Equal(t, 1, service.ClientCount())
+
+		// The healthy client still receives new notifications
+		service.Notify(services.NotificationTypeSystemEvent, "load", "final-marker")
+
+		select {
+		case <-gotFinal:
+		case <-time.After(10 * time.Second):
+			t.Fatal("healthy client did not receive notification")
+		}
+	})
+}
+
+func TestNotificationService_ConnectionLimits(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	// newServer serves websockets registered with the service; the user ID comes from the query
+	newServer := func(service *services.NotificationService) (string, func()) {
+		upgrader := websocket.Upgrader{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			userID := uint(1)
+			if r.URL.Query().Get("user") == "2" {
+				userID = 2
+			}
+			service.RegisterClient(conn, userID, 0, false)
+		}))
+		return "ws" + strings.TrimPrefix(server.URL, "http"), server.Close
+	}
+
+	// expectClose reads until the connection closes and returns the close error
+	expectClose := func(t *testing.T, conn *websocket.Conn) *websocket.CloseError {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closeErr, ok := err.(*websocket.CloseError)
+				require.True(t, ok, "expected close frame, got %v", err)
+				return closeErr
+			}
+		}
+	}
+
+	t.Run("Should reject connections over the per-user limit", func(t *testing.T) {
+		service := services.NewNotificationService(&config.WebSocketConfig{MaxConnectionsPerUser: 2}, ts.Logger)
+		defer service.Close()
+		wsURL, closeServer := newServer(service)
+		defer closeServer()
+
+		for i := 0; i < 2; i++ {
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+		}
+		require.Eventually(t, func() bool { return service.UserClientCount(1) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+		rejected, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		defer rejected.Close()
+
+		closeErr := expectClose(t, rejected)
+		assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+		assert.Equal(t, "user connection limit reached", closeErr.Text)
+		assert.Equal(t, 2, service.UserClientCount(1))
+
+		// Other users are not affected by user 1's limit
+		other, _, err := websocket.DefaultDialer.Dial(wsURL+"?user=2", nil)
+		require.NoError(t, err)
+		defer other.Close()
+		require.Eventually(t, func() bool { return service.UserClientCount(2) == 1 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, map[uint]int{1: 2, 2: 1}, service.ConnectionCounts())
+	})
+
+	t.Run("Should reject connections over the global limit", func(t *testing.T) {
+		service := services.NewNotificationService(&config.WebSocketConfig{MaxConnections: 1}, ts.Logger)
+		defer service.Close()
+		wsURL, closeServer := newServer(service)
+		defer closeServer()
+
+		first, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		defer first.Close()
+		require.Eventually(t, func() bool { return service.ClientCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		rejected, _, err := websocket.DefaultDialer.Dial(wsURL+"?user=2", nil)
+		require.NoError(t, err)
+		defer rejected.Close()
+
+		closeErr := expectClose(t, rejected)
+		assert.Equal(t, websocket.CloseTryAgainLater, closeErr.Code)
+		assert.Equal(t, 1, service.ClientCount())
+	})
+
+	t.Run("Should evict the oldest connection when configured", func(t *testing.T) {
+		service := services.NewNotificationService(&config.WebSocketConfig{MaxConnectionsPerUser: 1, EvictOldest: true}, ts.Logger)
+		defer service.Close()
+		wsURL, closeServer := newServer(service)
+		defer closeServer()
+
+		oldest, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		defer oldest.Close()
+		require.Eventually(t, func() bool { return service.UserClientCount(1) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		newest, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+		require.NoError(t, err)
+		defer newest.Close()
+
+		closeErr := expectClose(t, oldest)
+		assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+		assert.Equal(t, 1, service.UserClientCount(1))
+
+		// The newest connection keeps receiving notifications
+		service.Notify(services.NotificationTypeSystemEvent, "status", "still-connected")
+		newest.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := newest.ReadMessage()
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "still-connected")
+	})
+}
+
+func TestNotificationService_NotifyAdmins(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	service := services.NewNotificationService(nil, ts.Logger)
+	defer service.Close()
+
+	// Websocket server registering connections as admins when asked to
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		service.RegisterClient(conn, 1, 0, r.URL.Query().Get("admin") == "true")
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	admin, _, err := websocket.DefaultDialer.Dial(wsURL+"?admin=true", nil)
+	require.NoError(t, err)
+	defer admin.Close()
+	user, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer user.Close()
+
+	require.Eventually(t, func() bool { return service.ClientCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// next returns the topic of the next message a client receives; queued messages arrive
+	// newline-separated in one websocket message
+	pending := make(map[*websocket.Conn][]string)
+	next := func(conn *websocket.Conn) string {
+		if len(pending[conn]) == 0 {
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, data, err := conn.ReadMessage()
+			require.NoError(t, err)
+			pending[conn] = strings.Split(string(data), "\n")
+		}
+
+		var message services.NotificationMessage
+		require.NoError(t, json.Unmarshal([]byte(pending[conn][0]), &message))
+		pending[conn] = pending[conn][1:]
+		return message.Topic
+	}
+
+	service.NotifyAdmins(services.NotificationTypeSystemEvent, "kafka/dlq/timeseries-data", map[string]string{"sample_error": "bad value"})
+	service.Notify(services.NotificationTypeSystemEvent, "maintenance", nil)
+
+	t.Run("Should send admin notifications to admins", func(t *testing.T) {
+		assert.Equal(t, "kafka/dlq/timeseries-data", next(admin))
+		assert.Equal(t, "maintenance", next(admin))
+	})
+
+	t.Run("Should not send admin notifications to other users", func(t *testing.T) {
+		assert.Equal(t, "maintenance", next(user))
+	})
+}
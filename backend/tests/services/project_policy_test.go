@@ -0,0 +1,172 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildProjectPolicy(t *testing.T) {
+	cfg := &config.DittoConfig{PolicySubjectIssuer: "digital-egiz", PolicyServiceSubject: "nginx:ditto"}
+
+	t.Run("Should map members to subjects of their role's entry", func(t *testing.T) {
+		policy := services.BuildProjectPolicy("org.digitalegiz.project1:policy", cfg, []models.ProjectMember{
+			{UserID: 1, Role: models.ProjectRoleOwner},
+			{UserID: 2, Role: models.ProjectRoleEditor},
+			{UserID: 3, Role: models.ProjectRoleViewer},
+			{UserID: 4, Role: models.ProjectRoleViewer},
+			{UserID: 5, Role: "guest"},
+		})
+
+		assert.Equal(t, "org.digitalegiz.project1:policy", policy.PolicyID)
+		require.Len(t, policy.Entries, 4)
+
+		backend := policy.Entries[services.PolicyEntryBackend]
+		assert.Contains(t, backend.Subjects, "nginx:ditto")
+		assert.Equal(t, []string{"READ", "WRITE"}, backend.Resources["policy:/"].Grant)
+
+		owner := policy.Entries[services.PolicyEntryOwner]
+		assert.Equal(t, []string{"digital-egiz:1"}, subjectIDs(owner))
+		assert.Equal(t, []string{"READ"}, owner.Resources["policy:/"].Grant)
+		assert.Equal(t, []string{"READ", "WRITE"}, owner.Resources["thing:/"].Grant)
+
+		editor := policy.Entries[services.PolicyEntryEditor]
+		assert.Equal(t, []string{"digital-egiz:2"}, subjectIDs(editor))
+		assert.NotContains(t, editor.Resources, "policy:/")
+		assert.Equal(t, []string{"READ", "WRITE"}, editor.Resources["thing:/"].Grant)
+
+		viewer := policy.Entries[services.PolicyEntryViewer]
+		assert.ElementsMatch(t, []string{"digital-egiz:3", "digital-egiz:4"}, subjectIDs(viewer))
+		assert.Equal(t, []string{"READ"}, viewer.Resources["thing:/"].Grant)
+	})
+
+	t.Run("Should leave out roles without members", func(t *testing.T) {
+		policy := services.BuildProjectPolicy("org.digitalegiz.project1:policy", cfg, []models.ProjectMember{
+			{UserID: 1, Role: models.ProjectRoleOwner},
+		})
+		assert.Len(t, policy.Entries, 2)
+		assert.NotContains(t, policy.Entries, services.PolicyEntryEditor)
+		assert.NotContains(t, policy.Entries, services.PolicyEntryViewer)
+	})
+}
+
+func TestProjectPolicyService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{})
+	ownerID := ts.SeedTestUser("owner@example.com", "password123", false)
+	memberID := ts.SeedTestUser("member@example.com", "password123", false)
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	dittoCfg := fakeDitto.Config()
+	dittoCfg.PolicySubjectIssuer = "digital-egiz"
+	dittoCfg.PolicyServiceSubject = "nginx:ditto"
+	policies := services.NewProjectPolicyService(ts.DB, dittoCfg, fakeDitto.NewManager(ts.Logger), ts.Logger)
+
+	projectService := services.NewProjectService(ts.DB, ts.Logger)
+	projectService.SetPolicyService(policies)
+	twinService := services.NewTwinService(ts.DB, dittoCfg, ts.Logger)
+	twinService.SetPolicyService(policies)
+
+	project := &models.Project{Name: "Plant", CreatedBy: ownerID}
+	require.NoError(t, projectService.Create(project))
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", CreatedBy: ownerID}
+	require.NoError(t, ts.DB.DB.Create(twinType).Error)
+
+	policyID := policies.PolicyID(project.ID)
+	memberSubject := services.MemberSubject("digital-egiz", memberID)
+	storedPolicy := func() *ditto.Policy {
+		policy, ok := fakeDitto.Policy(policyID)
+		require.True(t, ok, "policy %s not in Ditto", policyID)
+		return policy
+	}
+	newTwin := func(localName string) *models.Twin {
+		dittoID, err := twinService.BuildDittoID(project.ID, localName)
+		require.NoError(t, err)
+		return &models.Twin{Name: localName, DittoID: dittoID, TypeID: twinType.ID, ProjectID: project.ID, CreatedBy: ownerID}
+	}
+
+	t.Run("Should create a new twin's thing under the project policy", func(t *testing.T) {
+		twin := newTwin("pump-1")
+		require.NoError(t, twinService.Create(twin))
+
+		thing, ok := fakeDitto.Thing(twin.DittoID)
+		require.True(t, ok)
+		assert.Equal(t, policyID, thing.PolicyID)
+		assert.Equal(t, "org.digitalegiz.project1:policy", policyID)
+		assert.Equal(t, []string{services.MemberSubject("digital-egiz", ownerID)}, subjectIDs(storedPolicy().Entries[services.PolicyEntryOwner]))
+	})
+
+	t.Run("Should move an existing thing to the project policy", func(t *testing.T) {
+		twin := newTwin("pump-2")
+		fakeDitto.PutThing(ditto.Thing{ThingID: twin.DittoID, PolicyID: twin.DittoID + ":policy"})
+		require.NoError(t, twinService.Create(twin))
+
+		thing, ok := fakeDitto.Thing(twin.DittoID)
+		require.True(t, ok)
+		assert.Equal(t, policyID, thing.PolicyID)
+	})
+
+	t.Run("Should not keep the twin when Ditto fails", func(t *testing.T) {
+		fakeDitto.SetFailure(http.StatusServiceUnavailable)
+		defer fakeDitto.SetFailure(0)
+
+		twin := newTwin("pump-3")
+		err := twinService.Create(twin)
+		require.Error(t, err)
+		assert.Equal(t, "failed to create ditto thing", err.Error())
+
+		_, err = repository.NewRepositoryFactory(ts.DB.DB).Twin().GetByDittoID(twin.DittoID)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+
+	t.Run("Should update the policy when members are added, changed and removed", func(t *testing.T) {
+		_, err := projectService.AddMember(project.ID, memberID, models.ProjectRoleViewer)
+		require.NoError(t, err)
+		assert.Equal(t, []string{memberSubject}, subjectIDs(storedPolicy().Entries[services.PolicyEntryViewer]))
+
+		_, err = projectService.UpdateMemberRole(project.ID, memberID, models.ProjectRoleEditor)
+		require.NoError(t, err)
+		policy := storedPolicy()
+		assert.NotContains(t, policy.Entries, services.PolicyEntryViewer)
+		assert.Equal(t, []string{memberSubject}, subjectIDs(policy.Entries[services.PolicyEntryEditor]))
+
+		require.NoError(t, projectService.RemoveMember(project.ID, memberID))
+		policy = storedPolicy()
+		assert.NotContains(t, policy.Entries, services.PolicyEntryEditor)
+		assert.Contains(t, policy.Entries, services.PolicyEntryOwner)
+	})
+
+	t.Run("Should keep the membership change when the policy update fails", func(t *testing.T) {
+		fakeDitto.SetFailure(http.StatusServiceUnavailable)
+		_, err := projectService.AddMember(project.ID, memberID, models.ProjectRoleViewer)
+		require.NoError(t, err)
+		fakeDitto.SetFailure(0)
+
+		assert.NotContains(t, storedPolicy().Entries, services.PolicyEntryViewer)
+
+		// The next sync catches up
+		require.NoError(t, policies.Sync(context.Background(), project.ID))
+		assert.Equal(t, []string{memberSubject}, subjectIDs(storedPolicy().Entries[services.PolicyEntryViewer]))
+	})
+}
+
+// subjectIDs returns the subject IDs of a policy entry
+func subjectIDs(entry ditto.PolicyEntry) []string {
+	ids := make([]string, 0, len(entry.Subjects))
+	for id := range entry.Subjects {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,156 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKafkaHandler_ThingDefinitions(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.Project{}, &models.TwinType{}, &models.Twin{}, &models.AttributeChange{})
+	project := &models.Project{Name: "Provisioning"}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	// A model server with a sensor Thing Model whose environment submodel holds its readings
+	thingModels := map[string]string{
+		"/models/sensor.tm.jsonld": `{
+			"@type": "tm:ThingModel",
+			"title": "Environment Sensor",
+			"version": {"model": "1.2.0"},
+			"properties": {"location": {"type": "string"}},
+			"links": [{"rel": "tm:submodel", "href": "environment.tm.jsonld", "instanceName": "environment"}]
+		}`,
+		"/models/environment.tm.jsonld": `{
+			"@type": "tm:ThingModel",
+			"title": "Environment",
+			"properties": {
+				"temperature": {"type": "number", "unit": "celsius", "minimum": -40, "maximum": 85, "forms": [{"href": "/temperature"}]},
+				"humidity": {"type": "number", "unit": "%", "minimum": 0, "maximum": 100},
+				"status": {"type": "string"}
+			}
+		}`,
+	}
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		body, ok := thingModels[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	bus := testutils.NewFakeKafka()
+	handler := services.NewKafkaHandler(ts.Logger, bus, ditto.NewManager(&ts.Config.Ditto, ts.Logger), ts.DB, repoFactory, nil, nil)
+	resolver := ditto.NewDefinitionResolver([]string{serverURL.Hostname()}, "", time.Hour)
+	handler.SetDefinitionService(services.NewThingDefinitionService(ts.DB, resolver, ts.Logger))
+	require.NoError(t, handler.Initialize(context.Background()))
+	require.NoError(t, handler.Start(context.Background()))
+	defer handler.Stop(context.Background())
+
+	definition := server.URL + "/models/sensor.tm.jsonld"
+	create := func(thingID, definition string) *models.Twin {
+		require.NoError(t, bus.ProduceDittoEvent(thingID, "created", map[string]interface{}{
+			"definition": definition,
+			"attributes": map[string]interface{}{"name": thingID},
+		}))
+		var twin *models.Twin
+		require.Eventually(t, func() bool {
+			twin, err = repoFactory.Twin().GetByDittoID(thingID)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		return twin
+	}
+
+	var sensorType *models.TwinType
+	t.Run("Should type an imported twin by the Thing Model of its definition", func(t *testing.T) {
+		twin := create("org.digitalegiz.provisioning:sensor-1", definition)
+		require.NotZero(t, twin.TypeID)
+
+		sensorType, err = repoFactory.TwinType().GetByID(twin.TypeID)
+		require.NoError(t, err)
+		assert.Equal(t, "Environment Sensor", sensorType.Name)
+		assert.Equal(t, "1.2.0", sensorType.Version)
+		assert.Equal(t, definition, sensorType.Definition)
+
+		var schema struct {
+			Properties struct {
+				Attributes struct {
+					Properties map[string]map[string]interface{} `json:"properties"`
+				} `json:"attributes"`
+				Features struct {
+					Properties map[string]struct {
+						Properties struct {
+							Properties struct {
+								Properties map[string]map[string]interface{} `json:"properties"`
+							} `json:"properties"`
+						} `json:"properties"`
+					} `json:"properties"`
+				} `json:"features"`
+			} `json:"properties"`
+		}
+		require.NoError(t, json.Unmarshal(sensorType.SchemaJSON, &schema))
+		assert.Contains(t, schema.Properties.Attributes.Properties, "location")
+		readings := schema.Properties.Features.Properties["environment"].Properties.Properties.Properties
+		require.Contains(t, readings, "temperature")
+		assert.Equal(t, "number", readings["temperature"]["type"])
+		assert.NotContains(t, readings["temperature"], "forms", "interaction details are not part of the schema")
+		assert.Contains(t, readings, "status")
+
+		// Numeric properties are described for display, grouped by submodel
+		require.Len(t, sensorType.FeatureMetadata, 2)
+		humidity, temperature := sensorType.FeatureMetadata[0], sensorType.FeatureMetadata[1]
+		assert.Equal(t, "environment/humidity", humidity.FeaturePath)
+		assert.Equal(t, "environment/temperature", temperature.FeaturePath)
+		assert.Equal(t, "Environment", temperature.Group)
+		assert.Equal(t, "C", temperature.Unit)
+		require.NotNil(t, temperature.Min)
+		assert.Equal(t, float64(-40), *temperature.Min)
+		require.NotNil(t, humidity.Max)
+		assert.Equal(t, float64(100), *humidity.Max)
+	})
+
+	t.Run("Should reuse the type of a known definition", func(t *testing.T) {
+		before := hits.Load()
+		twin := create("org.digitalegiz.provisioning:sensor-2", definition)
+		assert.Equal(t, sensorType.ID, twin.TypeID)
+		assert.Equal(t, before, hits.Load())
+
+		_, total, err := repoFactory.TwinType().List(0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), total)
+	})
+
+	t.Run("Should register twins with unresolvable definitions without a type", func(t *testing.T) {
+		for thingID, definition := range map[string]string{
+			"org.digitalegiz.provisioning:sensor-3": server.URL + "/models/missing.tm.jsonld",
+			"org.digitalegiz.provisioning:sensor-4": "https://models.example.com/sensor.tm.jsonld",
+			"org.digitalegiz.provisioning:sensor-5": "com.acme:Sensor:1.0.0",
+		} {
+			twin := create(thingID, definition)
+			assert.Zero(t, twin.TypeID, definition)
+			assert.Equal(t, project.ID, twin.ProjectID)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package services_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTimeseriesPayload(t *testing.T) {
+	thingID := "org.digitalegiz.project1:pump-01"
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Should store single value as one point", func(t *testing.T) {
+		points := services.ParseTimeseriesPayload(thingID, "temperature", timestamp, json.RawMessage(`21.5`), nil)
+
+		require.Len(t, points, 1)
+		assert.Equal(t, timestamp, points[0].Time)
+		assert.Equal(t, "number", points[0].ValueType)
+		assert.Equal(t, 21.5, points[0].ValueNum)
+	})
+
+	t.Run("Should expand array payload into points with own timestamps", func(t *testing.T) {
+		data := json.RawMessage(`[
+			{"time": "2024-05-01T10:00:00Z", "value": 20.1},
+			{"time": "2024-05-01T10:05:00Z", "value": true},
+			{"time": 1714558200000, "value": "ok"}
+		]`)
+
+		points := services.ParseTimeseriesPayload(thingID, "temperature", timestamp, data, nil)
+
+		require.Len(t, points, 3)
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), points[0].Time)
+		assert.Equal(t, 20.1, points[0].ValueNum)
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 5, 0, 0, time.UTC), points[1].Time.UTC())
+		assert.Equal(t, "boolean", points[1].ValueType)
+		assert.Equal(t, time.UnixMilli(1714558200000).UTC(), points[2].Time)
+		assert.Equal(t, "ok", points[2].ValueStr)
+	})
+
+	t.Run("Should use field names from feature binding", func(t *testing.T) {
+		data := json.RawMessage(`[{"ts": "2024-05-01T10:00:00Z", "v": 1}]`)
+		binding := &models.FeatureBinding{ArrayTimeField: "ts", ArrayValueField: "v"}
+
+		points := services.ParseTimeseriesPayload(thingID, "level", timestamp, data, binding)
+
+		require.Len(t, points, 1)
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), points[0].Time)
+		assert.Equal(t, float64(1), points[0].ValueNum)
+	})
+
+	t.Run("Should store array as object when it does not match schema or expansion is disabled", func(t *testing.T) {
+		data := json.RawMessage(`[{"time": "2024-05-01T10:00:00Z", "value": 1}, {"value": 2}]`)
+
+		points := services.ParseTimeseriesPayload(thingID, "level", timestamp, data, nil)
+		require.Len(t, points, 1)
+		assert.Equal(t, "object", points[0].ValueType)
+		assert.Equal(t, timestamp, points[0].Time)
+
+		valid := json.RawMessage(`[{"time": "2024-05-01T10:00:00Z", "value": 1}]`)
+		binding := &models.FeatureBinding{ArrayMode: models.ArrayModeObject}
+
+		points = services.ParseTimeseriesPayload(thingID, "level", timestamp, valid, binding)
+		require.Len(t, points, 1)
+		assert.Equal(t, "object", points[0].ValueType)
+	})
+}
+
+func TestApplyTypePolicy(t *testing.T) {
+	thingID := "org.digitalegiz.project1:pump-01"
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	parse := func(raw string) models.TimeseriesData {
+		return services.ParseTimeseriesPayload(thingID, "temperature", timestamp, json.RawMessage(raw), nil)[0]
+	}
+	numberBinding := func(mode string) *models.FeatureBinding {
+		return &models.FeatureBinding{FeaturePath: "temperature", ExpectedType: "number", TypeViolationMode: mode}
+	}
+
+	t.Run("Should accept values without expected type", func(t *testing.T) {
+		point := parse(`"offline"`)
+		store, violation, err := services.ApplyTypePolicy(&point, &models.FeatureBinding{})
+
+		require.NoError(t, err)
+		assert.True(t, store)
+		assert.False(t, violation)
+		assert.Equal(t, "string", point.ValueType)
+	})
+
+	t.Run("Should coerce convertible values", func(t *testing.T) {
+		point := parse(`" 21.5 "`)
+		store, violation, err := services.ApplyTypePolicy(&point, numberBinding(models.TypeViolationReject))
+
+		require.NoError(t, err)
+		assert.True(t, store)
+		assert.False(t, violation)
+		assert.Equal(t, "number", point.ValueType)
+		assert.Equal(t, 21.5, point.ValueNum)
+		assert.Empty(t, point.ValueStr)
+
+		point = parse(`1`)
+		_, violation, err = services.ApplyTypePolicy(&point, &models.FeatureBinding{ExpectedType: "boolean"})
+		require.NoError(t, err)
+		assert.False(t, violation)
+		require.NotNil(t, point.ValueBool)
+		assert.True(t, *point.ValueBool)
+
+		point = parse(`42`)
+		_, violation, err = services.ApplyTypePolicy(&point, &models.FeatureBinding{ExpectedType: "string"})
+		require.NoError(t, err)
+		assert.False(t, violation)
+		assert.Equal(t, "42", point.ValueStr)
+	})
+
+	t.Run("Should reject off-type values in reject mode", func(t *testing.T) {
+		point := parse(`"offline"`)
+		store, violation, err := services.ApplyTypePolicy(&point, numberBinding(models.TypeViolationReject))
+
+		assert.ErrorIs(t, err, services.ErrTypeViolation)
+		assert.False(t, store)
+		assert.True(t, violation)
+	})
+
+	t.Run("Should drop off-type values in drop mode", func(t *testing.T) {
+		point := parse(`"offline"`)
+		store, violation, err := services.ApplyTypePolicy(&point, numberBinding(models.TypeViolationDrop))
+
+		require.NoError(t, err)
+		assert.False(t, store)
+		assert.True(t, violation)
+	})
+
+	t.Run("Should store null in null mode", func(t *testing.T) {
+		point := parse(`{"state": "offline"}`)
+		store, violation, err := services.ApplyTypePolicy(&point, numberBinding(models.TypeViolationNull))
+
+		require.NoError(t, err)
+		assert.True(t, store)
+		assert.True(t, violation)
+		assert.Equal(t, "null", point.ValueType)
+		assert.Empty(t, point.ValueJSON)
+	})
+
+	t.Run("Should keep original value marked as error in error mode", func(t *testing.T) {
+		point := parse(`"offline"`)
+		store, violation, err := services.ApplyTypePolicy(&point, numberBinding(models.TypeViolationError))
+
+		require.NoError(t, err)
+		assert.True(t, store)
+		assert.True(t, violation)
+		assert.Equal(t, "error", point.ValueType)
+		assert.Equal(t, "offline", point.ValueStr)
+	})
+}
+
+func TestApplyPrecision(t *testing.T) {
+	thingID := "org.digitalegiz.project1:pump-01"
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	parse := func(raw string) models.TimeseriesData {
+		return services.ParseTimeseriesPayload(thingID, "temperature", timestamp, json.RawMessage(raw), nil)[0]
+	}
+	precision := func(places int) *int {
+		return &places
+	}
+
+	t.Run("Should leave values unrounded without a precision", func(t *testing.T) {
+		point := parse(`21.123456789012345`)
+		services.ApplyPrecision(&point, &models.FeatureBinding{})
+
+		assert.Equal(t, 21.123456789012345, point.ValueNum)
+		assert.Empty(t, point.ValueJSON)
+	})
+
+	t.Run("Should round numeric values to the precision", func(t *testing.T) {
+		point := parse(`21.123456789012345`)
+		services.ApplyPrecision(&point, &models.FeatureBinding{Precision: precision(2)})
+		assert.Equal(t, 21.12, point.ValueNum)
+		assert.Empty(t, point.ValueJSON)
+
+		point = parse(`-0.5678`)
+		services.ApplyPrecision(&point, &models.FeatureBinding{Precision: precision(0)})
+		assert.Equal(t, -1.0, point.ValueNum)
+	})
+
+	t.Run("Should keep the raw value when configured", func(t *testing.T) {
+		point := parse(`21.1234567`)
+		services.ApplyPrecision(&point, &models.FeatureBinding{Precision: precision(3), KeepRawValue: true})
+
+		assert.Equal(t, 21.123, point.ValueNum)
+		assert.Equal(t, "21.1234567", point.ValueJSON)
+	})
+
+	t.Run("Should not round other value types", func(t *testing.T) {
+		point := parse(`"21.123456"`)
+		services.ApplyPrecision(&point, &models.FeatureBinding{Precision: precision(1), KeepRawValue: true})
+
+		assert.Equal(t, "21.123456", point.ValueStr)
+		assert.Empty(t, point.ValueJSON)
+	})
+}
+
+func TestTypeViolationTracker(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("Should alert once when violations reach threshold within a minute", func(t *testing.T) {
+		tracker := services.NewTypeViolationTracker()
+
+		assert.Zero(t, tracker.Record(1, 2, 3, now))
+		assert.Equal(t, 3, tracker.Record(1, 1, 3, now.Add(10*time.Second)))
+		assert.Zero(t, tracker.Record(1, 5, 3, now.Add(20*time.Second)))
+	})
+
+	t.Run("Should reset count after the window", func(t *testing.T) {
+		tracker := services.NewTypeViolationTracker()
+
+		assert.Zero(t, tracker.Record(1, 2, 3, now))
+		assert.Zero(t, tracker.Record(1, 2, 3, now.Add(2*time.Minute)))
+		assert.Zero(t, tracker.Record(2, 2, 3, now.Add(2*time.Minute)))
+	})
+}
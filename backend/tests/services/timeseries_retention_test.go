@@ -0,0 +1,139 @@
+package services_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeseriesRetention(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{}, &models.TwinType{}, &models.Twin{}, &models.TimeseriesData{}, &models.AggregatedData{})
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	userID := ts.SeedTestUser("retention@example.com", "password123", false)
+	project := &models.Project{Name: "Plant"}
+	require.NoError(t, repoFactory.Project().Create(project))
+
+	days := func(n int) *int { return &n }
+	twinTypes := services.NewTwinTypeService(ts.DB, ts.Logger)
+	newType := func(name string, raw, aggregated *int) *models.TwinType {
+		twinType := &models.TwinType{Name: name, Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID,
+			RawRetentionDays: raw, AggregatedRetentionDays: aggregated}
+		require.NoError(t, twinTypes.Create(twinType))
+		return twinType
+	}
+	safety := newType("Pressure Relief", days(365), days(0))
+	ambient := newType("Ambient Temperature", days(7), days(30))
+	untyped := newType("Light", nil, nil)
+
+	newTwin := func(name string, twinType *models.TwinType, raw *int) *models.Twin {
+		twin := &models.Twin{Name: name, DittoID: "org.digitalegiz.project1:" + name, TypeID: twinType.ID, ProjectID: project.ID,
+			CreatedBy: userID, RawRetentionDays: raw}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		return twin
+	}
+	valve := newTwin("valve", safety, nil)
+	hall := newTwin("hall", ambient, nil)
+	// Kept for audits longer than the rest of its type
+	office := newTwin("office", ambient, days(60))
+	lamp := newTwin("lamp", untyped, nil)
+
+	now := time.Now().UTC()
+	ages := []int{1, 10, 45, 90, 400}
+	for _, twin := range []*models.Twin{valve, hall, office, lamp} {
+		for _, age := range ages {
+			at := now.AddDate(0, 0, -age)
+			require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+				Time: at, TwinID: twin.DittoID, FeaturePath: "temperature", ValueType: "number", ValueNum: float64(age),
+			}))
+			require.NoError(t, repoFactory.Timeseries().InsertAggregatedData(&models.AggregatedData{
+				TimeInterval: at.Truncate(time.Hour), TwinID: twin.DittoID, FeaturePath: "temperature", IntervalType: "hour",
+				Avg: float64(age), Count: 1,
+			}))
+		}
+	}
+	// Data of things not registered as twins is left alone
+	require.NoError(t, repoFactory.Timeseries().InsertTimeseriesData(&models.TimeseriesData{
+		Time: now.AddDate(0, 0, -400), TwinID: "org.digitalegiz.project1:unknown", FeaturePath: "temperature", ValueType: "number",
+	}))
+
+	// remaining returns the ages of the points of a twin left in a table
+	remaining := func(table, twin string) []int {
+		var values []float64
+		column := "value_num"
+		if table == "aggregated_data" {
+			column = "avg"
+		}
+		require.NoError(t, ts.DB.DB.Table(table).Where("twin_id = ?", twin).Pluck(column, &values).Error)
+		result := make([]int, len(values))
+		for i, value := range values {
+			result[i] = int(value)
+		}
+		sort.Ints(result)
+		return result
+	}
+
+	cfg := &config.HistoryConfig{RawRetentionDays: 30, AggregatedRetentionDays: 180}
+	service := services.NewTimeseriesRetentionService(ts.DB, cfg, ts.Logger)
+	run, err := service.ApplyRetention(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 4, run.Twins)
+
+	t.Run("Should keep raw data within the window of the twin type", func(t *testing.T) {
+		assert.Equal(t, []int{1, 10, 45, 90}, remaining("timeseries_data", valve.DittoID))
+		assert.Equal(t, []int{1}, remaining("timeseries_data", hall.DittoID))
+	})
+
+	t.Run("Should let a twin override the window of its type", func(t *testing.T) {
+		assert.Equal(t, []int{1, 10, 45}, remaining("timeseries_data", office.DittoID))
+		// The type's aggregated window still applies to it
+		assert.Equal(t, []int{1, 10}, remaining("aggregated_data", office.DittoID))
+	})
+
+	t.Run("Should fall back to the global windows", func(t *testing.T) {
+		assert.Equal(t, []int{1, 10}, remaining("timeseries_data", lamp.DittoID))
+		assert.Equal(t, []int{1, 10, 45, 90}, remaining("aggregated_data", lamp.DittoID))
+	})
+
+	t.Run("Should keep data forever with a window of 0", func(t *testing.T) {
+		assert.Equal(t, ages, remaining("aggregated_data", valve.DittoID))
+		assert.Equal(t, []int{1, 10}, remaining("aggregated_data", hall.DittoID))
+		assert.Equal(t, []int{0}, remaining("timeseries_data", "org.digitalegiz.project1:unknown"))
+	})
+
+	t.Run("Should count the deleted data", func(t *testing.T) {
+		// valve 1 + hall 4 + office 2 + lamp 3 raw points; hall 3 + office 3 + lamp 1 buckets
+		assert.Equal(t, int64(10), run.RawDeleted)
+		assert.Equal(t, int64(7), run.AggregatedDeleted)
+
+		run, err := service.ApplyRetention(context.Background())
+		require.NoError(t, err)
+		assert.Zero(t, run.RawDeleted)
+		assert.Zero(t, run.AggregatedDeleted)
+	})
+
+	t.Run("Should validate retention windows", func(t *testing.T) {
+		for _, windows := range [][2]*int{{days(-1), nil}, {nil, days(36501)}, {days(90), days(30)}} {
+			twinType := &models.TwinType{Name: "Invalid", Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID,
+				RawRetentionDays: windows[0], AggregatedRetentionDays: windows[1]}
+			err := twinTypes.Create(twinType)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid retention")
+		}
+
+		// A shorter raw window than the aggregated one, or keeping either forever, is fine
+		assert.NoError(t, twinTypes.Create(&models.TwinType{Name: "Valid", Version: "1.0", SchemaJSON: models.JSON(`{}`), CreatedBy: userID,
+			RawRetentionDays: days(0), AggregatedRetentionDays: days(30)}))
+	})
+}
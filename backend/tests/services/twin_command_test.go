@@ -0,0 +1,86 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinCommandService_ConditionalUpdate(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	fakeDitto := testutils.NewFakeDitto()
+	defer fakeDitto.Close()
+	twin := &models.Twin{Name: "Press", DittoID: "org.digitalegiz.project1:press-1", ProjectID: 1}
+	fakeDitto.PutThing(ditto.Thing{
+		ThingID: twin.DittoID,
+		Features: map[string]ditto.Feature{
+			"machine": {Properties: map[string]interface{}{"state": "idle", "cycles": 12.0, "locked": false}},
+		},
+	})
+
+	manager := fakeDitto.NewManager(ts.Logger)
+	commands := services.NewTwinCommandService(manager, ts.Logger)
+	ctx := context.Background()
+	condition := func(property string, value interface{}) *services.FeatureCondition {
+		raw, err := json.Marshal(value)
+		require.NoError(t, err)
+		return &services.FeatureCondition{Feature: "machine", Property: property, Value: raw}
+	}
+	state := func() interface{} {
+		value, _ := fakeDitto.FeatureProperty(twin.DittoID, "machine", "state")
+		return value
+	}
+
+	t.Run("Should apply the change when the condition holds", func(t *testing.T) {
+		err := commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"running"`), condition("state", "idle"))
+		require.NoError(t, err)
+		assert.Equal(t, "running", state())
+	})
+
+	t.Run("Should refuse the change when the condition fails", func(t *testing.T) {
+		err := commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"running"`), condition("state", "idle"))
+		assert.ErrorIs(t, err, services.ErrConditionFailed)
+
+		err = commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"stopped"`), condition("cycles", 13))
+		assert.ErrorIs(t, err, services.ErrConditionFailed)
+		assert.Equal(t, "running", state(), "a refused change leaves the thing unchanged")
+
+		// A failed condition says nothing about Ditto's health
+		assert.Zero(t, manager.BreakerStats().ConsecutiveFailures)
+	})
+
+	t.Run("Should compare numbers and booleans", func(t *testing.T) {
+		require.NoError(t, commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"stopped"`), condition("cycles", 12)))
+		require.NoError(t, commands.SetFeatureProperty(ctx, twin, "machine", "locked", json.RawMessage(`true`), condition("locked", false)))
+		assert.Equal(t, "stopped", state())
+
+		locked, _ := fakeDitto.FeatureProperty(twin.DittoID, "machine", "locked")
+		assert.Equal(t, true, locked)
+	})
+
+	t.Run("Should apply unconditional changes", func(t *testing.T) {
+		require.NoError(t, commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"idle"`), nil))
+		assert.Equal(t, "idle", state())
+	})
+
+	t.Run("Should reject conditions that cannot be expressed", func(t *testing.T) {
+		err := commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"running"`), condition("state", map[string]string{"a": "b"}))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid condition")
+
+		err = commands.SetFeatureProperty(ctx, twin, "machine", "state", json.RawMessage(`"running"`),
+			&services.FeatureCondition{Feature: "machine/x", Property: "state", Value: json.RawMessage(`"idle"`)})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid condition")
+		assert.Equal(t, "idle", state())
+	})
+}
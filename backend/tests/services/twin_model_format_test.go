@@ -0,0 +1,103 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelFormatForURL(t *testing.T) {
+	t.Run("Should detect supported formats by extension", func(t *testing.T) {
+		cases := map[string]string{
+			"https://cdn.example.com/models/pump.gltf":          models.ModelFormatGLTF,
+			"https://cdn.example.com/models/pump.GLB?version=3": models.ModelFormatGLB,
+			"/static/models/valve.obj":                          models.ModelFormatOBJ,
+			"https://cdn.example.com/models/motor.fbx#part-1":   models.ModelFormatFBX,
+			"https://cdn.example.com/models/housing.stl":        models.ModelFormatSTL,
+			"https://cdn.example.com/models/conveyor-belt.usdz": models.ModelFormatUSDZ,
+		}
+		for modelURL, formatID := range cases {
+			format, ok := models.ModelFormatForURL(modelURL)
+			require.True(t, ok, modelURL)
+			assert.Equal(t, formatID, format.ID, modelURL)
+		}
+	})
+
+	t.Run("Should reject unknown or missing extensions", func(t *testing.T) {
+		for _, modelURL := range []string{
+			"https://cdn.example.com/models/pump.blend",
+			"https://cdn.example.com/models/pump",
+			"https://cdn.example.com/download?file=pump.glb",
+		} {
+			_, ok := models.ModelFormatForURL(modelURL)
+			assert.False(t, ok, modelURL)
+		}
+	})
+
+	t.Run("Should look up formats by ID", func(t *testing.T) {
+		format, ok := models.LookupModelFormat("GLB")
+		require.True(t, ok)
+		assert.Equal(t, []string{"model/gltf-binary"}, format.MIMETypes)
+
+		_, ok = models.LookupModelFormat("blend")
+		assert.False(t, ok)
+	})
+}
+
+func TestTwinService_ModelURLValidation(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.Config.Ditto.NamespacePrefix = "org.digitalegiz"
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{})
+	userID := ts.SeedTestUser("modeler@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(twinType).Error)
+
+	service := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+
+	newTwin := func(localName, modelURL string) *models.Twin {
+		dittoID, err := service.BuildDittoID(project.ID, localName)
+		require.NoError(t, err)
+		return &models.Twin{
+			Name:      localName,
+			DittoID:   dittoID,
+			TypeID:    twinType.ID,
+			ProjectID: project.ID,
+			CreatedBy: userID,
+			ModelURL:  modelURL,
+		}
+	}
+
+	t.Run("Should accept supported model formats", func(t *testing.T) {
+		require.NoError(t, service.Create(newTwin("pump-1", "https://cdn.example.com/models/pump.glb")))
+		require.NoError(t, service.Create(newTwin("pump-2", "")))
+	})
+
+	t.Run("Should reject unsupported model formats on create", func(t *testing.T) {
+		err := service.Create(newTwin("pump-3", "https://cdn.example.com/models/pump.blend"))
+		require.Error(t, err)
+		assert.Equal(t, "unsupported model format: .blend (supported: gltf, glb, obj, fbx, stl, usdz)", err.Error())
+	})
+
+	t.Run("Should reject unsupported model formats on update", func(t *testing.T) {
+		twin := newTwin("pump-4", "https://cdn.example.com/models/pump.gltf")
+		require.NoError(t, service.Create(twin))
+
+		twin.ModelURL = "https://cdn.example.com/models/pump"
+		err := service.Update(twin)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported model format: none")
+
+		stored, err := service.GetByID(twin.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "https://cdn.example.com/models/pump.gltf", stored.ModelURL)
+	})
+}
@@ -0,0 +1,104 @@
+package services_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwinTypeService_Usage(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{}, &models.MLTask{}, &models.MLTaskBinding{})
+	userID := ts.SeedTestUser("types@example.com", "password123", false)
+	service := services.NewTwinTypeService(ts.DB, ts.Logger)
+
+	pump := &models.TwinType{Name: "Pump", Version: "1.0", SchemaJSON: models.JSON([]byte("{}")), CreatedBy: userID}
+	valve := &models.TwinType{Name: "Valve", Version: "1.0", SchemaJSON: models.JSON([]byte("{}")), CreatedBy: userID}
+	require.NoError(t, service.Create(pump))
+	require.NoError(t, service.Create(valve))
+
+	plant := &models.Project{Name: "Plant", CreatedBy: userID}
+	depot := &models.Project{Name: "Depot", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(plant).Error)
+	require.NoError(t, ts.DB.DB.Create(depot).Error)
+
+	anomaly := &models.MLTask{Name: "Anomalies", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0", CreatedBy: userID}
+	forecast := &models.MLTask{Name: "Forecast", Type: models.MLTaskTypePrediction, ModelID: "pump-forecast", Version: "1.0", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(anomaly).Error)
+	require.NoError(t, ts.DB.DB.Create(forecast).Error)
+
+	// Three pumps across two projects, the first bound to both tasks and the second to one
+	var pumps []*models.Twin
+	for i, project := range []*models.Project{plant, plant, depot} {
+		twin := &models.Twin{Name: fmt.Sprintf("pump-%d", i+1), DittoID: fmt.Sprintf("org.digitalegiz:pump-%d", i+1), TypeID: pump.ID, ProjectID: project.ID, CreatedBy: userID}
+		require.NoError(t, ts.DB.DB.Create(twin).Error)
+		pumps = append(pumps, twin)
+	}
+	for _, binding := range []*models.MLTaskBinding{
+		{TaskID: anomaly.ID, TwinID: pumps[0].ID, Active: true},
+		{TaskID: forecast.ID, TwinID: pumps[0].ID, Active: true},
+		{TaskID: anomaly.ID, TwinID: pumps[1].ID, Active: true},
+	} {
+		require.NoError(t, ts.DB.DB.Create(binding).Error)
+	}
+
+	// A valve and a deleted pump do not count
+	require.NoError(t, ts.DB.DB.Create(&models.Twin{Name: "valve-1", DittoID: "org.digitalegiz:valve-1", TypeID: valve.ID, ProjectID: plant.ID, CreatedBy: userID}).Error)
+	deleted := &models.Twin{Name: "pump-old", DittoID: "org.digitalegiz:pump-old", TypeID: pump.ID, ProjectID: depot.ID, CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(deleted).Error)
+	require.NoError(t, ts.DB.DB.Delete(deleted).Error)
+
+	t.Run("Should count the twins, projects, bindings and tasks depending on a type", func(t *testing.T) {
+		report, err := service.Usage(pump.ID, 1, 20)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(3), report.Usage.Twins)
+		assert.Equal(t, int64(2), report.Usage.Projects)
+		assert.Equal(t, int64(3), report.Usage.Bindings)
+		assert.Equal(t, int64(2), report.Usage.Tasks)
+
+		require.Len(t, report.Twins, 3)
+		assert.Equal(t, "pump-1", report.Twins[0].Name)
+
+		bindings := report.Bindings[pumps[0].ID]
+		require.Len(t, bindings, 2)
+		assert.Equal(t, "Anomalies", bindings[0].Task.Name)
+		assert.Equal(t, "pump-forecast", bindings[1].Task.ModelID)
+		assert.Len(t, report.Bindings[pumps[1].ID], 1)
+		assert.Empty(t, report.Bindings[pumps[2].ID])
+	})
+
+	t.Run("Should paginate the twins but keep the totals", func(t *testing.T) {
+		report, err := service.Usage(pump.ID, 2, 2)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(3), report.Usage.Twins)
+		require.Len(t, report.Twins, 1)
+		assert.Equal(t, "pump-3", report.Twins[0].Name)
+		assert.Empty(t, report.Bindings)
+	})
+
+	t.Run("Should report an unused type", func(t *testing.T) {
+		unused := &models.TwinType{Name: "Tank", Version: "1.0", SchemaJSON: models.JSON([]byte("{}")), CreatedBy: userID}
+		require.NoError(t, service.Create(unused))
+
+		report, err := service.Usage(unused.ID, 1, 20)
+		require.NoError(t, err)
+		assert.Zero(t, report.Usage.Twins)
+		assert.Zero(t, report.Usage.Bindings)
+		assert.Empty(t, report.Twins)
+	})
+
+	t.Run("Should return not found for a missing type", func(t *testing.T) {
+		_, err := service.Usage(9999, 1, 20)
+		require.Error(t, err)
+		assert.Equal(t, "twin type not found", err.Error())
+	})
+}
@@ -0,0 +1,231 @@
+package services_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// uniqueNameIndexes are the unique name indexes of the migrations by table, which AutoMigrate
+// does not create
+var uniqueNameIndexes = map[string]string{
+	"twins":    "CREATE UNIQUE INDEX idx_twins_project_name ON twins(project_id, LOWER(name)) WHERE deleted_at IS NULL",
+	"projects": "CREATE UNIQUE INDEX idx_projects_name ON projects(LOWER(name)) WHERE deleted_at IS NULL",
+}
+
+// createUniqueNameIndexes creates the unique name indexes of the tables
+func createUniqueNameIndexes(ts *testutils.TestSetup, tables ...string) {
+	for _, table := range tables {
+		ts.Requires.NoError(ts.DB.DB.Exec(uniqueNameIndexes[table]).Error)
+	}
+}
+
+// raceNameCheck runs insert once right after the next name check on the table, as a
+// concurrent create that passed the same check would
+func raceNameCheck(t *testing.T, ts *testutils.TestSetup, table string, insert func(db *gorm.DB) error) {
+	var once sync.Once
+	name := "test:race_" + t.Name()
+	require.NoError(t, ts.DB.DB.Callback().Query().After("gorm:query").Register(name, func(db *gorm.DB) {
+		if db.Statement.Table != table || !strings.Contains(db.Statement.SQL.String(), "LOWER(name)") {
+			return
+		}
+		once.Do(func() { require.NoError(t, insert(ts.DB.DB.Session(&gorm.Session{NewDB: true}))) })
+	}))
+	t.Cleanup(func() { _ = ts.DB.DB.Callback().Query().Remove(name) })
+}
+
+func TestTwinService_UniqueNames(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.Config.Ditto.NamespacePrefix = "org.digitalegiz"
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{})
+	createUniqueNameIndexes(ts, "twins")
+	userID := ts.SeedTestUser("names@example.com", "password123", false)
+
+	plant := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(plant).Error)
+	warehouse := &models.Project{Name: "Warehouse", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(warehouse).Error)
+	twinType := &models.TwinType{Name: "Pump", Version: "1.0", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(twinType).Error)
+
+	service := services.NewTwinService(ts.DB, &ts.Config.Ditto, ts.Logger)
+
+	newTwin := func(projectID uint, localName, name string) *models.Twin {
+		dittoID, err := service.BuildDittoID(projectID, localName)
+		require.NoError(t, err)
+		return &models.Twin{
+			Name:      name,
+			DittoID:   dittoID,
+			TypeID:    twinType.ID,
+			ProjectID: projectID,
+			CreatedBy: userID,
+		}
+	}
+
+	require.NoError(t, service.Create(newTwin(plant.ID, "pump-1", "Pump 1")))
+
+	t.Run("Should reject a duplicate name in the same project", func(t *testing.T) {
+		err := service.Create(newTwin(plant.ID, "pump-1-copy", "pump 1"))
+		require.Error(t, err)
+		assert.Equal(t, "twin with this name already exists in the project", err.Error())
+	})
+
+	t.Run("Should allow the same name in another project", func(t *testing.T) {
+		assert.NoError(t, service.Create(newTwin(warehouse.ID, "pump-1", "Pump 1")))
+	})
+
+	t.Run("Should reject renaming a twin to a taken name", func(t *testing.T) {
+		twin := newTwin(plant.ID, "pump-2", "Pump 2")
+		require.NoError(t, service.Create(twin))
+
+		twin.Name = "PUMP 1"
+		err := service.Update(twin)
+		require.Error(t, err)
+		assert.Equal(t, "twin with this name already exists in the project", err.Error())
+
+		// Changing only the case of its own name is allowed
+		twin.Name = "pump 2"
+		assert.NoError(t, service.Update(twin))
+	})
+
+	t.Run("Should allow reusing the name of a deleted twin", func(t *testing.T) {
+		twin := newTwin(plant.ID, "pump-3", "Pump 3")
+		require.NoError(t, service.Create(twin))
+		require.NoError(t, service.Delete(twin.ID))
+
+		assert.NoError(t, service.Create(newTwin(plant.ID, "pump-3-new", "Pump 3")))
+	})
+
+	t.Run("Should reject a name taken concurrently after it was checked", func(t *testing.T) {
+		raceNameCheck(t, ts, "twins", func(db *gorm.DB) error {
+			return db.Create(newTwin(plant.ID, "pump-4-other", "Pump 4")).Error
+		})
+
+		err := service.Create(newTwin(plant.ID, "pump-4", "pump 4"))
+		require.Error(t, err)
+		assert.Equal(t, "twin with this name already exists in the project", err.Error())
+	})
+
+	t.Run("Should reject renaming to a name taken concurrently", func(t *testing.T) {
+		twin := newTwin(plant.ID, "pump-5", "Pump 5")
+		require.NoError(t, service.Create(twin))
+		raceNameCheck(t, ts, "twins", func(db *gorm.DB) error {
+			return db.Create(newTwin(plant.ID, "pump-6", "Pump 6")).Error
+		})
+
+		twin.Name = "Pump 6"
+		err := service.Update(twin)
+		require.Error(t, err)
+		assert.Equal(t, "twin with this name already exists in the project", err.Error())
+	})
+}
+
+func TestProjectService_UniqueNames(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.ProjectMember{})
+	createUniqueNameIndexes(ts, "projects")
+	userID := ts.SeedTestUser("projects@example.com", "password123", false)
+
+	service := services.NewProjectService(ts.DB, ts.Logger)
+	require.NoError(t, service.Create(&models.Project{Name: "Plant", CreatedBy: userID}))
+
+	t.Run("Should reject a duplicate project name", func(t *testing.T) {
+		err := service.Create(&models.Project{Name: "plant", CreatedBy: userID})
+		require.Error(t, err)
+		assert.Equal(t, "project with this name already exists", err.Error())
+	})
+
+	t.Run("Should reject renaming a project to a taken name", func(t *testing.T) {
+		project := &models.Project{Name: "Warehouse", CreatedBy: userID}
+		require.NoError(t, service.Create(project))
+
+		project.Name = "Plant"
+		err := service.Update(project)
+		require.Error(t, err)
+		assert.Equal(t, "project with this name already exists", err.Error())
+
+		project.Name = "Warehouse"
+		project.Description = "Storage"
+		assert.NoError(t, service.Update(project))
+	})
+
+	t.Run("Should allow reusing the name of a deleted project", func(t *testing.T) {
+		project := &models.Project{Name: "Depot", CreatedBy: userID}
+		require.NoError(t, service.Create(project))
+		require.NoError(t, service.Delete(project.ID))
+
+		assert.NoError(t, service.Create(&models.Project{Name: "Depot", CreatedBy: userID}))
+	})
+
+	t.Run("Should reject a project name taken concurrently after it was checked", func(t *testing.T) {
+		raceNameCheck(t, ts, "projects", func(db *gorm.DB) error {
+			return db.Create(&models.Project{Name: "Yard", CreatedBy: userID}).Error
+		})
+
+		err := service.Create(&models.Project{Name: "yard", CreatedBy: userID})
+		require.Error(t, err)
+		assert.Equal(t, "project with this name already exists", err.Error())
+
+		var members int64
+		require.NoError(t, ts.DB.DB.Model(&models.ProjectMember{}).Count(&members).Error)
+		var projects int64
+		require.NoError(t, ts.DB.DB.Model(&models.Project{}).Count(&projects).Error)
+		assert.Equal(t, projects, members, "the failed project adds no owner")
+	})
+}
+
+func TestKafkaHandler_UniqueNames(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.Config.Ditto.NamespacePrefix = "org.digitalegiz"
+	ts.SetupTestDatabase(&models.User{}, &models.Project{}, &models.TwinType{}, &models.Twin{}, &models.AttributeChange{})
+	createUniqueNameIndexes(ts, "twins")
+	userID := ts.SeedTestUser("events@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	dittoManager := ditto.NewManager(&ts.Config.Ditto, ts.Logger)
+	bus := testutils.NewFakeKafka()
+	handler := services.NewKafkaHandler(ts.Logger, bus, dittoManager, ts.DB, repoFactory, nil, nil)
+	require.NoError(t, handler.Initialize(context.Background()))
+	require.NoError(t, handler.Start(context.Background()))
+	defer handler.Stop(context.Background())
+
+	namespace := ditto.ProjectNamespace(ts.Config.Ditto.NamespacePrefix, project.ID)
+
+	t.Run("Should name a twin after its thing when its name is taken concurrently", func(t *testing.T) {
+		raceNameCheck(t, ts, "twins", func(db *gorm.DB) error {
+			return db.Create(&models.Twin{Name: "Pump 1", DittoID: namespace + ":pump-1-api", ProjectID: project.ID, CreatedBy: userID}).Error
+		})
+
+		thingID := namespace + ":pump-1"
+		require.NoError(t, bus.ProduceDittoEvent(thingID, "created", map[string]interface{}{"attributes": map[string]interface{}{"name": "Pump 1"}}))
+
+		var twin *models.Twin
+		require.Eventually(t, func() bool {
+			var err error
+			twin, err = repoFactory.Twin().GetByDittoID(thingID)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, thingID, twin.Name)
+		assert.Empty(t, bus.DeadLetters())
+	})
+}
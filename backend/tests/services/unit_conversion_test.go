@@ -0,0 +1,71 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitConversion(t *testing.T) {
+	t.Run("Should convert between Celsius and Fahrenheit", func(t *testing.T) {
+		toFahrenheit, err := services.NewUnitConversion("C", "F")
+		require.NoError(t, err)
+		assert.InDelta(t, 212, toFahrenheit.Convert(100), 1e-9)
+		assert.InDelta(t, 32, toFahrenheit.Convert(0), 1e-9)
+		assert.InDelta(t, -40, toFahrenheit.Convert(-40), 1e-9)
+
+		toCelsius, err := services.NewUnitConversion("fahrenheit", "celsius")
+		require.NoError(t, err)
+		assert.Equal(t, "F", toCelsius.From)
+		assert.Equal(t, "C", toCelsius.To)
+		assert.InDelta(t, 37, toCelsius.Convert(98.6), 1e-9)
+	})
+
+	t.Run("Should convert pressure and length", func(t *testing.T) {
+		conversion, err := services.NewUnitConversion("bar", "kPa")
+		require.NoError(t, err)
+		assert.InDelta(t, 250, conversion.Convert(2.5), 1e-9)
+
+		conversion, err = services.NewUnitConversion("ft", "m")
+		require.NoError(t, err)
+		assert.InDelta(t, 3.048, conversion.Convert(10), 1e-9)
+	})
+
+	t.Run("Should reject incompatible and unknown units", func(t *testing.T) {
+		_, err := services.NewUnitConversion("C", "bar")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, services.ErrUnitConversion))
+		assert.Contains(t, err.Error(), "temperature")
+
+		_, err = services.NewUnitConversion("C", "furlong")
+		assert.True(t, errors.Is(err, services.ErrUnitConversion))
+	})
+
+	t.Run("Should convert numeric points and aggregates without touching the input", func(t *testing.T) {
+		conversion, err := services.NewUnitConversion("C", "F")
+		require.NoError(t, err)
+
+		points := []models.TimeseriesData{
+			{ValueType: "number", ValueNum: 20, ValueJSON: "20.04"},
+			{ValueType: "number", ValueNum: 10, ValueJSON: `{"min":0,"min_time":"0001-01-01T00:00:00Z","max":20,"max_time":"0001-01-01T00:00:00Z","avg":10,"count":3}`},
+			{ValueType: "string", ValueStr: "off"},
+		}
+		converted := conversion.Timeseries(points)
+		require.Len(t, converted, 3)
+		assert.InDelta(t, 68, converted[0].ValueNum, 1e-9)
+		assert.Equal(t, "68.072", converted[0].ValueJSON)
+		assert.JSONEq(t, `{"min":32,"min_time":"0001-01-01T00:00:00Z","max":68,"max_time":"0001-01-01T00:00:00Z","avg":50,"count":3}`, converted[1].ValueJSON)
+		assert.Equal(t, points[2], converted[2])
+		assert.Equal(t, float64(20), points[0].ValueNum, "stored values are left untouched")
+
+		buckets := conversion.Aggregated([]models.AggregatedData{{Min: 0, Max: 100, Avg: 50, Sum: 150, Count: 3}})
+		assert.InDelta(t, 32, buckets[0].Min, 1e-9)
+		assert.InDelta(t, 212, buckets[0].Max, 1e-9)
+		assert.InDelta(t, 122, buckets[0].Avg, 1e-9)
+		assert.InDelta(t, 3*122, buckets[0].Sum, 1e-9)
+	})
+}
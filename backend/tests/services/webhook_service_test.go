@@ -0,0 +1,166 @@
+package services_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	t.Run("Should sign timestamp and body with HMAC-SHA256", func(t *testing.T) {
+		body := []byte(`{"type":"twin.created"}`)
+
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte("1714564800." + string(body)))
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+		assert.Equal(t, expected, services.SignWebhookPayload("secret", 1714564800, body))
+	})
+
+	t.Run("Should change signature with secret or timestamp", func(t *testing.T) {
+		body := []byte(`{}`)
+		signature := services.SignWebhookPayload("secret", 1, body)
+
+		assert.NotEqual(t, signature, services.SignWebhookPayload("other", 1, body))
+		assert.NotEqual(t, signature, services.SignWebhookPayload("secret", 2, body))
+	})
+}
+
+func TestWebhookService_SendTestEvent(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.WebhookSubscription{})
+	service := services.NewWebhookService(ts.DB, ts.Logger)
+	service.SetAllowPrivateNetworks(true)
+
+	// Receiver verifying the signature like an integrator would
+	var received services.WebhookEvent
+	var headers http.Header
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers = r.Header.Clone()
+
+		timestamp, _ := strconv.ParseInt(r.Header.Get(services.WebhookHeaderTimestamp), 10, 64)
+		if services.SignWebhookPayload("integrator-secret-123", timestamp, body) != r.Header.Get(services.WebhookHeaderSignature) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer receiver.Close()
+
+	subscription := &models.WebhookSubscription{
+		ProjectID: 1,
+		URL:       receiver.URL,
+		Secret:    "integrator-secret-123",
+	}
+	require.NoError(t, service.CreateSubscription(subscription))
+
+	t.Run("Should deliver signed sample event and report only the receiver's status", func(t *testing.T) {
+		result, err := service.SendTestEvent(1, subscription.ID, models.WebhookEventAlertCreated)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, result.StatusCode)
+		encoded, err := json.Marshal(result)
+		require.NoError(t, err)
+		assert.NotContains(t, string(encoded), "ok\"")
+		assert.Empty(t, result.Error)
+		assert.GreaterOrEqual(t, result.LatencyMs, int64(0))
+
+		assert.Equal(t, models.WebhookEventAlertCreated, received.Type)
+		assert.True(t, received.Test)
+		assert.NotNil(t, received.Payload)
+		assert.Equal(t, "true", headers.Get(services.WebhookHeaderTest))
+		assert.Equal(t, result.DeliveryID, headers.Get(services.WebhookHeaderDelivery))
+	})
+
+	t.Run("Should report signature failures from receiver", func(t *testing.T) {
+		other := &models.WebhookSubscription{ProjectID: 1, URL: receiver.URL, Secret: "wrong-secret-4567890"}
+		require.NoError(t, service.CreateSubscription(other))
+
+		result, err := service.SendTestEvent(1, other.ID, models.WebhookEventTwinCreated)
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+	})
+
+	t.Run("Should report unreachable receivers in result", func(t *testing.T) {
+		unreachable := &models.WebhookSubscription{ProjectID: 1, URL: "http://127.0.0.1:1/hook"}
+		require.NoError(t, service.CreateSubscription(unreachable))
+		assert.NotEmpty(t, unreachable.Secret)
+
+		result, err := service.SendTestEvent(1, unreachable.ID, models.WebhookEventTwinCreated)
+
+		require.NoError(t, err)
+		assert.Zero(t, result.StatusCode)
+		assert.NotEmpty(t, result.Error)
+	})
+
+	t.Run("Should reject unknown event types and foreign subscriptions", func(t *testing.T) {
+		_, err := service.SendTestEvent(1, subscription.ID, "unknown.event")
+		assert.Error(t, err)
+
+		_, err = service.SendTestEvent(2, subscription.ID, models.WebhookEventTwinCreated)
+		assert.EqualError(t, err, "webhook subscription not found")
+	})
+}
+
+func TestWebhookService_InternalAddresses(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(&models.WebhookSubscription{})
+	service := services.NewWebhookService(ts.DB, ts.Logger)
+
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer receiver.Close()
+
+	t.Run("Should reject subscriptions to internal addresses", func(t *testing.T) {
+		for _, url := range []string{
+			"http://169.254.169.254/latest/meta-data",
+			"http://10.0.0.1/hook",
+			"http://[::1]:8080/hook",
+			receiver.URL,
+		} {
+			err := service.CreateSubscription(&models.WebhookSubscription{ProjectID: 1, URL: url})
+			assert.ErrorIs(t, err, services.ErrWebhookAddressNotAllowed, url)
+		}
+	})
+
+	t.Run("Should refuse to deliver to names resolving to internal addresses", func(t *testing.T) {
+		subscription := &models.WebhookSubscription{
+			ProjectID: 1,
+			URL:       strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1),
+		}
+		require.NoError(t, service.CreateSubscription(subscription))
+
+		result, err := service.SendTestEvent(1, subscription.ID, models.WebhookEventTwinCreated)
+
+		require.NoError(t, err)
+		assert.Zero(t, result.StatusCode)
+		assert.Contains(t, result.Error, services.ErrWebhookAddressNotAllowed.Error())
+		assert.Zero(t, calls)
+	})
+
+}
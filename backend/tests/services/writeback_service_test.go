@@ -0,0 +1,269 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/db/models"
+	"github.com/digital-egiz/backend/internal/db/repository"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/lifecycle"
+	"github.com/digital-egiz/backend/internal/services"
+	testutils "github.com/digital-egiz/backend/tests/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dittoWrite is a property write received by the fake Ditto server
+type dittoWrite struct {
+	Path  string
+	Value services.WritebackValue
+}
+
+func TestWritebackService(t *testing.T) {
+	ts := testutils.NewTestSetup(t)
+	defer ts.Cleanup()
+
+	ts.SetupTestDatabase(
+		&models.User{},
+		&models.Project{},
+		&models.TwinType{},
+		&models.Twin{},
+		&models.MLTask{},
+		&models.MLTaskBinding{},
+		&models.MLPredictionData{},
+	)
+	userID := ts.SeedTestUser("writeback@example.com", "password123", false)
+
+	project := &models.Project{Name: "Plant", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(project).Error)
+
+	// A fake Ditto records property writes, failing while failing is set
+	var (
+		mu      sync.Mutex
+		writes  []dittoWrite
+		failing bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":503,"error":"gateway:service.unavailable","message":"unavailable"}`))
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		write := dittoWrite{Path: r.Method + " " + r.URL.Path}
+		_ = json.Unmarshal(body, &write.Value)
+		writes = append(writes, write)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	recorded := func() []dittoWrite {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]dittoWrite(nil), writes...)
+	}
+
+	dittoCfg := &config.DittoConfig{URL: server.URL, WritebackEnabled: true, WritebackInterval: 1}
+	service := services.NewWritebackService(ts.DB, dittoCfg, ditto.NewManager(dittoCfg, ts.Logger), ts.Logger)
+	defer service.Stop(context.Background())
+
+	repoFactory := repository.NewRepositoryFactory(ts.DB.DB)
+	task := &models.MLTask{Name: "Anomalies", Type: models.MLTaskTypeAnomaly, ModelID: "pump-anomaly", Version: "1.0", CreatedBy: userID}
+	require.NoError(t, ts.DB.DB.Create(task).Error)
+
+	newTwin := func(dittoID, outputPath string) *models.Twin {
+		twin := &models.Twin{Name: dittoID, DittoID: dittoID, ProjectID: project.ID, CreatedBy: userID}
+		require.NoError(t, repoFactory.Twin().Create(twin))
+		require.NoError(t, ts.DB.DB.Create(&models.MLTaskBinding{
+			TaskID:         task.ID,
+			TwinID:         twin.ID,
+			OutputPathJSON: outputPath,
+			Active:         true,
+		}).Error)
+		return twin
+	}
+
+	// store keeps a prediction locally and submits it for write-back, as the ML output handler does
+	store := func(twin *models.Twin, at time.Time, score float64) *models.MLPredictionData {
+		prediction := &models.MLPredictionData{
+			Time:           at,
+			TwinID:         twin.DittoID,
+			TaskID:         task.ModelID,
+			PredictionType: "anomaly",
+			ScoreNum:       score,
+			DetailsJSON:    `{"threshold":0.8}`,
+			ModelVersion:   "1.0",
+		}
+		require.NoError(t, repoFactory.Timeseries().InsertMLPredictionData(prediction))
+		service.Submit(prediction)
+		return prediction
+	}
+
+	t.Run("Should write a prediction to the bound Ditto feature property", func(t *testing.T) {
+		twin := newTwin("org.digitalegiz.project1:pump-1", `{"feature":"health","property":"anomaly"}`)
+		at := time.Now().Add(-time.Minute).Truncate(time.Second)
+		store(twin, at, 0.93)
+
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		write := recorded()[0]
+		assert.Equal(t, "PUT /api/2/things/"+twin.DittoID+"/features/health/properties/anomaly", write.Path)
+		assert.Equal(t, 0.93, write.Value.Score)
+		assert.Equal(t, "anomaly", write.Value.Type)
+		assert.JSONEq(t, `{"threshold":0.8}`, string(write.Value.Details))
+		assert.True(t, at.Equal(write.Value.Time))
+	})
+
+	t.Run("Should skip redelivered predictions and rate limit to the latest", func(t *testing.T) {
+		mu.Lock()
+		writes = nil
+		mu.Unlock()
+
+		twin := newTwin("org.digitalegiz.project1:pump-2", `{"feature":"health"}`)
+		at := time.Now().Truncate(time.Second)
+		first := store(twin, at, 0.1)
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		// Redelivery of the same prediction is not written again
+		service.Submit(first)
+		store(twin, at.Add(time.Second), 0.2)
+		store(twin, at.Add(2*time.Second), 0.3)
+
+		require.Eventually(t, func() bool { return len(recorded()) == 2 }, 5*time.Second, 10*time.Millisecond)
+		time.Sleep(1500 * time.Millisecond)
+
+		written := recorded()
+		require.Len(t, written, 2)
+		assert.Equal(t, "PUT /api/2/things/"+twin.DittoID+"/features/health/properties/pump-anomaly", written[1].Path)
+		assert.Equal(t, 0.3, written[1].Value.Score)
+	})
+
+	t.Run("Should keep the local prediction when Ditto fails", func(t *testing.T) {
+		mu.Lock()
+		writes = nil
+		failing = true
+		mu.Unlock()
+
+		twin := newTwin("org.digitalegiz.project1:pump-3", `{"feature":"health","property":"anomaly"}`)
+		at := time.Now().Truncate(time.Second)
+		store(twin, at, 0.5)
+		time.Sleep(200 * time.Millisecond)
+
+		var stored int64
+		require.NoError(t, ts.DB.DB.Model(&models.MLPredictionData{}).Where("twin_id = ?", twin.DittoID).Count(&stored).Error)
+		assert.Equal(t, int64(1), stored)
+		assert.Empty(t, recorded())
+
+		// The next prediction is written once Ditto recovers
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+		store(twin, at.Add(time.Second), 0.6)
+
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 0.6, recorded()[0].Value.Score)
+	})
+
+	t.Run("Should retry predictions while the Ditto circuit breaker is open", func(t *testing.T) {
+		mu.Lock()
+		writes = nil
+		failing = true
+		mu.Unlock()
+
+		breakerCfg := &config.DittoConfig{URL: server.URL, WritebackEnabled: true, WritebackInterval: 1, BreakerThreshold: 1, BreakerOpenTimeout: 2}
+		dittoManager := ditto.NewManager(breakerCfg, ts.Logger)
+		service := services.NewWritebackService(ts.DB, breakerCfg, dittoManager, ts.Logger)
+		defer service.Stop(context.Background())
+
+		// The failed write opens the breaker
+		twin := newTwin("org.digitalegiz.project1:pump-5", `{"feature":"health","property":"anomaly"}`)
+		at := time.Now().Truncate(time.Second)
+		service.Submit(&models.MLPredictionData{Time: at, TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.1})
+		require.Eventually(t, func() bool { return dittoManager.BreakerStats().State == ditto.BreakerOpen }, 5*time.Second, 10*time.Millisecond)
+
+		// While open the prediction is kept and written once Ditto is back
+		mu.Lock()
+		failing = false
+		mu.Unlock()
+		service.Submit(&models.MLPredictionData{Time: at.Add(time.Second), TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.2})
+
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 8*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 0.2, recorded()[0].Value.Score)
+		stats := dittoManager.BreakerStats()
+		assert.Equal(t, ditto.BreakerClosed, stats.State)
+		assert.NotZero(t, stats.Rejected)
+	})
+
+	t.Run("Should hold predictions while paused and write them when triggered", func(t *testing.T) {
+		mu.Lock()
+		writes = nil
+		mu.Unlock()
+
+		slowCfg := &config.DittoConfig{URL: server.URL, WritebackEnabled: true, WritebackInterval: 3600}
+		service := services.NewWritebackService(ts.DB, slowCfg, ditto.NewManager(slowCfg, ts.Logger), ts.Logger)
+		defer service.Stop(context.Background())
+
+		service.Pause()
+		twin := newTwin("org.digitalegiz.project1:pump-6", `{"feature":"health","property":"anomaly"}`)
+		at := time.Now().Truncate(time.Second)
+		service.Submit(&models.MLPredictionData{Time: at, TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.1})
+		service.Submit(&models.MLPredictionData{Time: at.Add(time.Second), TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.2})
+		time.Sleep(100 * time.Millisecond)
+		assert.Empty(t, recorded())
+		assert.Equal(t, lifecycle.WorkerPaused, service.Status().State)
+
+		// Triggering writes the latest prediction held back, even while paused
+		require.NoError(t, service.Trigger())
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, 0.2, recorded()[0].Value.Score)
+		require.Eventually(t, func() bool { return service.Status().Runs == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, service.Stop(context.Background()))
+		assert.ErrorIs(t, service.Trigger(), lifecycle.ErrWorkerNotRunning)
+		assert.Equal(t, lifecycle.WorkerStopped, service.Status().State)
+	})
+
+	t.Run("Should flush predictions held back by the rate limit on shutdown", func(t *testing.T) {
+		mu.Lock()
+		writes = nil
+		mu.Unlock()
+
+		slowCfg := &config.DittoConfig{URL: server.URL, WritebackEnabled: true, WritebackInterval: 3600}
+		service := services.NewWritebackService(ts.DB, slowCfg, ditto.NewManager(slowCfg, ts.Logger), ts.Logger)
+
+		twin := newTwin("org.digitalegiz.project1:pump-4", `{"feature":"health","property":"anomaly"}`)
+		at := time.Now().Truncate(time.Second)
+		prediction := &models.MLPredictionData{Time: at, TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.1}
+		service.Submit(prediction)
+		require.Eventually(t, func() bool { return len(recorded()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+		// The next prediction waits for the hour-long interval
+		service.Submit(&models.MLPredictionData{Time: at.Add(time.Second), TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.2})
+		time.Sleep(100 * time.Millisecond)
+		require.Len(t, recorded(), 1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, service.Stop(ctx))
+
+		written := recorded()
+		require.Len(t, written, 2)
+		assert.Equal(t, 0.2, written[1].Value.Score)
+
+		// Predictions submitted after shutdown are not written
+		service.Submit(&models.MLPredictionData{Time: at.Add(2 * time.Second), TwinID: twin.DittoID, TaskID: task.ModelID, PredictionType: "anomaly", ScoreNum: 0.3})
+		time.Sleep(100 * time.Millisecond)
+		assert.Len(t, recorded(), 2)
+	})
+}
@@ -0,0 +1,810 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/digital-egiz/backend/internal/config"
+	"github.com/digital-egiz/backend/internal/ditto"
+	"github.com/digital-egiz/backend/internal/utils"
+	"github.com/gorilla/websocket"
+)
+
+// FakeDittoRequest is an HTTP request received by the FakeDitto
+type FakeDittoRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Body   json.RawMessage
+	// CorrelationID is the request's correlation-id header
+	CorrelationID string
+}
+
+// fakeEventSubscription is the START-SEND-EVENTS subscription of a WebSocket connection
+type fakeEventSubscription struct {
+	namespaces []string
+	filter     *rqlNode
+}
+
+// FakeDitto is an httptest server implementing the Ditto HTTP endpoints used by ditto.Client
+// on in-memory things and policies, and the /ws/2 endpoint of the WebSocket client. Changes
+// made over HTTP are pushed as Ditto events to the WebSocket clients whose subscription
+// namespaces and RQL filter match, like Ditto does.
+type FakeDitto struct {
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu            sync.Mutex
+	things        map[string]*ditto.Thing
+	policies      map[string]*ditto.Policy
+	requests      []FakeDittoRequest
+	failure       int
+	conns         []*websocket.Conn
+	subscriptions []json.RawMessage
+	eventSubs     map[*websocket.Conn]*fakeEventSubscription
+	wsAuth        []string
+	acceptAuth    func(authorization string) bool
+}
+
+// NewFakeDitto starts a fake Ditto server; Close it when done
+func NewFakeDitto() *FakeDitto {
+	f := &FakeDitto{
+		things:    make(map[string]*ditto.Thing),
+		policies:  make(map[string]*ditto.Policy),
+		eventSubs: make(map[*websocket.Conn]*fakeEventSubscription),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /ws/2", f.handleWebSocket)
+	mux.HandleFunc("POST /api/2/things", f.createThing)
+	mux.HandleFunc("GET /api/2/search/things", f.searchThings)
+	mux.HandleFunc("GET /api/2/things/{thingID}", f.getThing)
+	mux.HandleFunc("PUT /api/2/things/{thingID}", f.putThing)
+	mux.HandleFunc("DELETE /api/2/things/{thingID}", f.deleteThing)
+	mux.HandleFunc("PUT /api/2/things/{thingID}/policyId", f.putThingPolicyID)
+	mux.HandleFunc("GET /api/2/things/{thingID}/features", f.getFeatures)
+	mux.HandleFunc("GET /api/2/things/{thingID}/features/{featureID}", f.getFeature)
+	mux.HandleFunc("PUT /api/2/things/{thingID}/features/{featureID}", f.putFeature)
+	mux.HandleFunc("DELETE /api/2/things/{thingID}/features/{featureID}", f.deleteFeature)
+	mux.HandleFunc("GET /api/2/things/{thingID}/features/{featureID}/properties", f.getProperties)
+	mux.HandleFunc("PUT /api/2/things/{thingID}/features/{featureID}/properties", f.putProperties)
+	mux.HandleFunc("GET /api/2/things/{thingID}/features/{featureID}/properties/{property...}", f.getProperty)
+	mux.HandleFunc("PUT /api/2/things/{thingID}/features/{featureID}/properties/{property...}", f.putProperty)
+	mux.HandleFunc("POST /api/2/policies", f.createPolicy)
+	mux.HandleFunc("GET /api/2/policies/{policyID}", f.getPolicy)
+	mux.HandleFunc("PUT /api/2/policies/{policyID}", f.putPolicy)
+	mux.HandleFunc("DELETE /api/2/policies/{policyID}", f.deletePolicy)
+
+	f.server = httptest.NewServer(f.record(mux))
+	return f
+}
+
+// URL returns the base URL of the server
+func (f *FakeDitto) URL() string {
+	return f.server.URL
+}
+
+// Config returns a Ditto configuration pointing at the server
+func (f *FakeDitto) Config() *config.DittoConfig {
+	return &config.DittoConfig{
+		URL:             f.server.URL,
+		Username:        "ditto",
+		Password:        "ditto",
+		NamespacePrefix: "org.digitalegiz",
+	}
+}
+
+// NewManager creates a Ditto manager using the server
+func (f *FakeDitto) NewManager(logger *utils.Logger) *ditto.Manager {
+	return ditto.NewManager(f.Config(), logger)
+}
+
+// Close disconnects the WebSocket clients and stops the server
+func (f *FakeDitto) Close() {
+	f.mu.Lock()
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+	f.conns = nil
+	f.mu.Unlock()
+
+	f.server.Close()
+}
+
+// PutThing stores a thing without emitting an event, for seeding test data
+func (f *FakeDitto) PutThing(thing ditto.Thing) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.things[thing.ThingID] = copyThing(&thing)
+}
+
+// Thing returns a copy of a stored thing
+func (f *FakeDitto) Thing(thingID string) (*ditto.Thing, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	thing, ok := f.things[thingID]
+	if !ok {
+		return nil, false
+	}
+	return copyThing(thing), true
+}
+
+// Policy returns a copy of a stored policy
+func (f *FakeDitto) Policy(policyID string) (*ditto.Policy, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, ok := f.policies[policyID]
+	if !ok {
+		return nil, false
+	}
+	data, _ := json.Marshal(policy)
+	var copied ditto.Policy
+	_ = json.Unmarshal(data, &copied)
+	return &copied, true
+}
+
+// FeatureProperty returns a feature property of a stored thing; the path may be nested ("a/b")
+func (f *FakeDitto) FeatureProperty(thingID, featureID, propertyPath string) (interface{}, bool) {
+	thing, ok := f.Thing(thingID)
+	if !ok {
+		return nil, false
+	}
+	feature, ok := thing.Features[featureID]
+	if !ok {
+		return nil, false
+	}
+
+	var value interface{} = feature.Properties
+	for _, key := range strings.Split(strings.Trim(propertyPath, "/"), "/") {
+		properties, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = properties[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Requests returns the HTTP API requests received, oldest first
+func (f *FakeDitto) Requests() []FakeDittoRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeDittoRequest(nil), f.requests...)
+}
+
+// SetFailure makes API requests fail with the given HTTP status; zero restores normal responses
+func (f *FakeDitto) SetFailure(status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failure = status
+}
+
+// ConnectionCount returns the number of connected WebSocket clients
+func (f *FakeDitto) ConnectionCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.conns)
+}
+
+// WebSocketAuthorizations returns the Authorization headers of the WebSocket handshakes,
+// oldest first, including rejected ones
+func (f *FakeDitto) WebSocketAuthorizations() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.wsAuth...)
+}
+
+// SetWebSocketAuth makes WebSocket handshakes whose Authorization header is not accepted
+// fail with 401; nil accepts every handshake
+func (f *FakeDitto) SetWebSocketAuth(accept func(authorization string) bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.acceptAuth = accept
+}
+
+// CloseWebSockets closes the WebSocket connections with the close code and reason, like
+// Ditto does e.g. when a connection's token expires
+func (f *FakeDitto) CloseWebSockets(code int, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range f.conns {
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+		conn.Close()
+	}
+}
+
+// Subscriptions returns the commands WebSocket clients sent, such as START-SEND-EVENTS
+func (f *FakeDitto) Subscriptions() []json.RawMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]json.RawMessage(nil), f.subscriptions...)
+}
+
+// EmitEvent sends a twin event to the subscribed WebSocket clients, e.g. action "modified"
+// with path "/features/temperature/properties/value"
+func (f *FakeDitto) EmitEvent(thingID, action, path string, value interface{}) error {
+	return f.emitEvent(thingID, action, path, value, nil)
+}
+
+// emitEvent sends a twin event with the given headers to the subscribed WebSocket clients
+func (f *FakeDitto) emitEvent(thingID, action, path string, value interface{}, headers map[string]interface{}) error {
+	namespace, name, err := ditto.ParseThingID(thingID)
+	if err != nil {
+		return err
+	}
+
+	event, err := json.Marshal(map[string]interface{}{
+		"topic":   fmt.Sprintf("%s/%s/things/twin/events/%s", namespace, name, action),
+		"path":    path,
+		"value":   value,
+		"headers": headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Filters see the thing as stored after the change
+	filterEvent := &rqlEvent{thingID: thingID, action: action, path: path}
+	if thing, ok := f.things[thingID]; ok {
+		data, _ := json.Marshal(thing)
+		_ = json.Unmarshal(data, &filterEvent.thing)
+	}
+
+	for _, conn := range f.conns {
+		if !f.eventSubs[conn].matches(namespace, filterEvent) {
+			continue
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matches reports whether an event in the namespace is sent to the subscription
+func (s *fakeEventSubscription) matches(namespace string, event *rqlEvent) bool {
+	if s == nil {
+		return false
+	}
+	if len(s.namespaces) > 0 && !slices.Contains(s.namespaces, namespace) {
+		return false
+	}
+	return s.filter == nil || s.filter.eval(event)
+}
+
+// record logs API requests and applies the configured failure
+func (f *FakeDitto) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws/2" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		f.mu.Lock()
+		f.requests = append(f.requests, FakeDittoRequest{
+			Method:        r.Method,
+			Path:          r.URL.Path,
+			Query:         r.URL.RawQuery,
+			Body:          body,
+			CorrelationID: r.Header.Get(ditto.HeaderCorrelationID),
+		})
+		failure := f.failure
+		f.mu.Unlock()
+
+		if failure != 0 {
+			writeDittoError(w, failure, "gateway:service.unavailable", "the fake Ditto is failing requests")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeDitto) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	authorization := r.Header.Get("Authorization")
+	f.mu.Lock()
+	f.wsAuth = append(f.wsAuth, authorization)
+	accept := f.acceptAuth
+	f.mu.Unlock()
+	if accept != nil && !accept(authorization) {
+		writeDittoError(w, http.StatusUnauthorized, "gateway:authentication.failed", "the token is not valid")
+		return
+	}
+
+	conn, err := f.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	f.conns = append(f.conns, conn)
+	f.mu.Unlock()
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		f.mu.Lock()
+		f.subscriptions = append(f.subscriptions, message)
+		f.handleCommand(conn, message)
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	delete(f.eventSubs, conn)
+	for i, c := range f.conns {
+		if c == conn {
+			f.conns = append(f.conns[:i], f.conns[i+1:]...)
+			break
+		}
+	}
+	f.mu.Unlock()
+	conn.Close()
+}
+
+// handleCommand applies a START-SEND-EVENTS or STOP-SEND-EVENTS command; like in Ditto a new
+// subscription replaces the connection's previous one. The caller must hold the lock.
+func (f *FakeDitto) handleCommand(conn *websocket.Conn, message []byte) {
+	var command struct {
+		Type    string `json:"type"`
+		Payload struct {
+			Filter     string   `json:"filter"`
+			Namespaces []string `json:"namespaces"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(message, &command); err != nil {
+		return
+	}
+
+	switch command.Type {
+	case "START-SEND-EVENTS":
+		subscription := &fakeEventSubscription{namespaces: command.Payload.Namespaces}
+		if command.Payload.Filter != "" {
+			filter, err := parseRQL(command.Payload.Filter)
+			if err != nil {
+				delete(f.eventSubs, conn)
+				return
+			}
+			subscription.filter = filter
+		}
+		f.eventSubs[conn] = subscription
+	case "STOP-SEND-EVENTS":
+		delete(f.eventSubs, conn)
+	}
+}
+
+func (f *FakeDitto) createThing(w http.ResponseWriter, r *http.Request) {
+	var thing ditto.Thing
+	if !decodeDittoBody(w, r, &thing) {
+		return
+	}
+
+	f.mu.Lock()
+	if _, exists := f.things[thing.ThingID]; exists {
+		f.mu.Unlock()
+		writeDittoError(w, http.StatusConflict, "things:thing.conflict", "thing already exists")
+		return
+	}
+	thing.Revision = 1
+	f.things[thing.ThingID] = copyThing(&thing)
+	f.mu.Unlock()
+
+	f.emit(r, thing.ThingID, "created", "/", thing)
+	writeDittoJSON(w, http.StatusCreated, thing)
+}
+
+func (f *FakeDitto) searchThings(w http.ResponseWriter, r *http.Request) {
+	var namespaces []string
+	if query := r.URL.Query().Get("namespaces"); query != "" {
+		namespaces = strings.Split(query, ",")
+	}
+
+	f.mu.Lock()
+	things := make([]ditto.Thing, 0, len(f.things))
+	for _, thing := range f.things {
+		if len(namespaces) == 0 || containsString(namespaces, ditto.NamespaceOf(thing.ThingID)) {
+			things = append(things, *copyThing(thing))
+		}
+	}
+	f.mu.Unlock()
+
+	writeDittoJSON(w, http.StatusOK, things)
+}
+
+func (f *FakeDitto) getThing(w http.ResponseWriter, r *http.Request) {
+	thing, ok := f.Thing(r.PathValue("thingID"))
+	if !ok {
+		writeThingNotFound(w)
+		return
+	}
+	writeDittoJSON(w, http.StatusOK, thing)
+}
+
+func (f *FakeDitto) putThing(w http.ResponseWriter, r *http.Request) {
+	var thing ditto.Thing
+	if !decodeDittoBody(w, r, &thing) {
+		return
+	}
+	thing.ThingID = r.PathValue("thingID")
+
+	f.mu.Lock()
+	existing, exists := f.things[thing.ThingID]
+	thing.Revision = 1
+	if exists {
+		thing.Revision = existing.Revision + 1
+	}
+	f.things[thing.ThingID] = copyThing(&thing)
+	f.mu.Unlock()
+
+	if exists {
+		f.emit(r, thing.ThingID, "modified", "/", thing)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	f.emit(r, thing.ThingID, "created", "/", thing)
+	writeDittoJSON(w, http.StatusCreated, thing)
+}
+
+func (f *FakeDitto) putThingPolicyID(w http.ResponseWriter, r *http.Request) {
+	var policyID string
+	if !decodeDittoBody(w, r, &policyID) {
+		return
+	}
+	thingID := r.PathValue("thingID")
+
+	f.mu.Lock()
+	thing, exists := f.things[thingID]
+	if !exists {
+		f.mu.Unlock()
+		writeThingNotFound(w)
+		return
+	}
+	thing.PolicyID = policyID
+	thing.Revision++
+	f.mu.Unlock()
+
+	f.emit(r, thingID, "modified", "/policyId", policyID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeDitto) deleteThing(w http.ResponseWriter, r *http.Request) {
+	thingID := r.PathValue("thingID")
+
+	f.mu.Lock()
+	_, exists := f.things[thingID]
+	delete(f.things, thingID)
+	f.mu.Unlock()
+
+	if !exists {
+		writeThingNotFound(w)
+		return
+	}
+	f.emit(r, thingID, "deleted", "/", nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getFeatures returns a thing's features, projected to the comma-separated paths of the
+// "fields" query parameter if given
+func (f *FakeDitto) getFeatures(w http.ResponseWriter, r *http.Request) {
+	thing, ok := f.Thing(r.PathValue("thingID"))
+	if !ok {
+		writeThingNotFound(w)
+		return
+	}
+	if len(thing.Features) == 0 {
+		writeDittoError(w, http.StatusNotFound, "things:features.notfound", "features not found")
+		return
+	}
+
+	fields := r.URL.Query().Get("fields")
+	if fields == "" {
+		writeDittoJSON(w, http.StatusOK, thing.Features)
+		return
+	}
+
+	data, _ := json.Marshal(thing.Features)
+	var features map[string]interface{}
+	_ = json.Unmarshal(data, &features)
+
+	projected := make(map[string]interface{})
+	for _, field := range strings.Split(fields, ",") {
+		projectPath(features, projected, strings.Split(strings.Trim(field, "/"), "/"))
+	}
+	writeDittoJSON(w, http.StatusOK, projected)
+}
+
+func (f *FakeDitto) getFeature(w http.ResponseWriter, r *http.Request) {
+	thing, ok := f.Thing(r.PathValue("thingID"))
+	if !ok {
+		writeThingNotFound(w)
+		return
+	}
+	feature, ok := thing.Features[r.PathValue("featureID")]
+	if !ok {
+		writeDittoError(w, http.StatusNotFound, "things:feature.notfound", "feature not found")
+		return
+	}
+	writeDittoJSON(w, http.StatusOK, feature)
+}
+
+func (f *FakeDitto) putFeature(w http.ResponseWriter, r *http.Request) {
+	var feature ditto.Feature
+	if !decodeDittoBody(w, r, &feature) {
+		return
+	}
+
+	featureID := r.PathValue("featureID")
+	f.modifyThing(w, r, r.PathValue("thingID"), "modified", "/features/"+featureID, feature, func(thing *ditto.Thing) {
+		if thing.Features == nil {
+			thing.Features = make(map[string]ditto.Feature)
+		}
+		thing.Features[featureID] = feature
+	})
+}
+
+func (f *FakeDitto) deleteFeature(w http.ResponseWriter, r *http.Request) {
+	featureID := r.PathValue("featureID")
+	f.modifyThing(w, r, r.PathValue("thingID"), "deleted", "/features/"+featureID, nil, func(thing *ditto.Thing) {
+		delete(thing.Features, featureID)
+	})
+}
+
+func (f *FakeDitto) getProperties(w http.ResponseWriter, r *http.Request) {
+	thing, ok := f.Thing(r.PathValue("thingID"))
+	if !ok {
+		writeThingNotFound(w)
+		return
+	}
+	feature, ok := thing.Features[r.PathValue("featureID")]
+	if !ok || feature.Properties == nil {
+		writeDittoError(w, http.StatusNotFound, "things:feature.properties.notfound", "feature properties not found")
+		return
+	}
+	writeDittoJSON(w, http.StatusOK, feature.Properties)
+}
+
+func (f *FakeDitto) putProperties(w http.ResponseWriter, r *http.Request) {
+	var properties map[string]interface{}
+	if !decodeDittoBody(w, r, &properties) {
+		return
+	}
+
+	featureID := r.PathValue("featureID")
+	f.modifyThing(w, r, r.PathValue("thingID"), "modified", "/features/"+featureID+"/properties", properties, func(thing *ditto.Thing) {
+		feature := thing.Features[featureID]
+		feature.Properties = properties
+		if thing.Features == nil {
+			thing.Features = make(map[string]ditto.Feature)
+		}
+		thing.Features[featureID] = feature
+	})
+}
+
+func (f *FakeDitto) getProperty(w http.ResponseWriter, r *http.Request) {
+	value, ok := f.FeatureProperty(r.PathValue("thingID"), r.PathValue("featureID"), r.PathValue("property"))
+	if !ok {
+		writeDittoError(w, http.StatusNotFound, "things:feature.property.notfound", "feature property not found")
+		return
+	}
+	writeDittoJSON(w, http.StatusOK, value)
+}
+
+func (f *FakeDitto) putProperty(w http.ResponseWriter, r *http.Request) {
+	var value interface{}
+	if !decodeDittoBody(w, r, &value) {
+		return
+	}
+
+	featureID := r.PathValue("featureID")
+	property := strings.Trim(r.PathValue("property"), "/")
+	f.modifyThing(w, r, r.PathValue("thingID"), "modified", "/features/"+featureID+"/properties/"+property, value, func(thing *ditto.Thing) {
+		if thing.Features == nil {
+			thing.Features = make(map[string]ditto.Feature)
+		}
+		feature := thing.Features[featureID]
+		if feature.Properties == nil {
+			feature.Properties = make(map[string]interface{})
+		}
+
+		keys := strings.Split(property, "/")
+		properties := feature.Properties
+		for _, key := range keys[:len(keys)-1] {
+			nested, ok := properties[key].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				properties[key] = nested
+			}
+			properties = nested
+		}
+		properties[keys[len(keys)-1]] = value
+		thing.Features[featureID] = feature
+	})
+}
+
+// modifyThing applies a change to a stored thing and emits the event for the path. Like
+// Ditto, a change with a condition header is only applied if the thing matches the condition.
+func (f *FakeDitto) modifyThing(w http.ResponseWriter, r *http.Request, thingID, action, path string, value interface{}, change func(thing *ditto.Thing)) {
+	f.mu.Lock()
+	thing, ok := f.things[thingID]
+	if !ok {
+		f.mu.Unlock()
+		writeThingNotFound(w)
+		return
+	}
+	if condition := r.Header.Get(ditto.HeaderCondition); condition != "" {
+		filter, err := parseRQL(condition)
+		if err != nil {
+			f.mu.Unlock()
+			writeDittoError(w, http.StatusBadRequest, "rql.expression.invalid", err.Error())
+			return
+		}
+		event := &rqlEvent{thingID: thingID}
+		data, _ := json.Marshal(thing)
+		_ = json.Unmarshal(data, &event.thing)
+		if !filter.eval(event) {
+			f.mu.Unlock()
+			writeDittoError(w, http.StatusPreconditionFailed, "things:precondition.failed", "the condition is not met")
+			return
+		}
+	}
+	change(thing)
+	thing.Revision++
+	f.mu.Unlock()
+
+	f.emit(r, thingID, action, path, value)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeDitto) createPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy ditto.Policy
+	if !decodeDittoBody(w, r, &policy) {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, exists := f.policies[policy.PolicyID]; exists {
+		writeDittoError(w, http.StatusConflict, "policies:policy.conflict", "policy already exists")
+		return
+	}
+	policy.Revision = 1
+	f.policies[policy.PolicyID] = &policy
+	writeDittoJSON(w, http.StatusCreated, policy)
+}
+
+func (f *FakeDitto) getPolicy(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policy, ok := f.policies[r.PathValue("policyID")]
+	if !ok {
+		writeDittoError(w, http.StatusNotFound, "policies:policy.notfound", "policy not found")
+		return
+	}
+	writeDittoJSON(w, http.StatusOK, policy)
+}
+
+func (f *FakeDitto) putPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy ditto.Policy
+	if !decodeDittoBody(w, r, &policy) {
+		return
+	}
+	policy.PolicyID = r.PathValue("policyID")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	existing, exists := f.policies[policy.PolicyID]
+	policy.Revision = 1
+	if exists {
+		policy.Revision = existing.Revision + 1
+	}
+	f.policies[policy.PolicyID] = &policy
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeDittoJSON(w, http.StatusCreated, policy)
+}
+
+func (f *FakeDitto) deletePolicy(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	policyID := r.PathValue("policyID")
+	if _, ok := f.policies[policyID]; !ok {
+		writeDittoError(w, http.StatusNotFound, "policies:policy.notfound", "policy not found")
+		return
+	}
+	delete(f.policies, policyID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emit sends an event for a change made over HTTP, carrying the request's correlation ID
+// as Ditto does, and ignores WebSocket write errors
+func (f *FakeDitto) emit(r *http.Request, thingID, action, path string, value interface{}) {
+	var headers map[string]interface{}
+	if id := r.Header.Get(ditto.HeaderCorrelationID); id != "" {
+		headers = map[string]interface{}{ditto.HeaderCorrelationID: id}
+	}
+	_ = f.emitEvent(thingID, action, path, value, headers)
+}
+
+// copyThing deep-copies a thing through JSON so callers cannot modify the stored state
+func copyThing(thing *ditto.Thing) *ditto.Thing {
+	data, _ := json.Marshal(thing)
+	var copied ditto.Thing
+	_ = json.Unmarshal(data, &copied)
+	return &copied
+}
+
+func decodeDittoBody(w http.ResponseWriter, r *http.Request, target interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		writeDittoError(w, http.StatusBadRequest, "json.invalid", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeDittoJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeDittoError(w http.ResponseWriter, status int, code, message string) {
+	writeDittoJSON(w, status, ditto.DittoError{Status: status, ErrorCode: code, Message: message})
+}
+
+func writeThingNotFound(w http.ResponseWriter) {
+	writeDittoError(w, http.StatusNotFound, "things:thing.notfound", "thing not found")
+}
+
+// projectPath copies the value at a path of source into target, creating the parent objects
+func projectPath(source, target map[string]interface{}, path []string) {
+	value, ok := source[path[0]]
+	if !ok {
+		return
+	}
+	if len(path) == 1 {
+		target[path[0]] = value
+		return
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	child, ok := target[path[0]].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+	}
+	projectPath(nested, child, path[1:])
+	if len(child) > 0 {
+		target[path[0]] = child
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rqlNode is a parsed RQL expression: an operator with arguments, or a literal or field argument
+type rqlNode struct {
+	op      string
+	args    []*rqlNode
+	literal interface{}
+	field   string
+}
+
+// rqlEvent is what the FakeDitto evaluates an event subscription filter against
+type rqlEvent struct {
+	thingID string
+	action  string
+	path    string
+	thing   map[string]interface{}
+}
+
+// parseRQL parses the subset of RQL the FakeDitto supports: and, or, not, eq, ne, like, in
+// and exists over the thingId, resource:path and topic:action placeholders and thing fields
+func parseRQL(filter string) (*rqlNode, error) {
+	p := &rqlParser{input: filter}
+	node, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+type rqlParser struct {
+	input string
+	pos   int
+}
+
+func (p *rqlParser) parseNode() (*rqlNode, error) {
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte("(),", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	if p.pos >= len(p.input) || p.input[p.pos] != '(' {
+		return nil, fmt.Errorf("expected operator at %d", start)
+	}
+
+	node := &rqlNode{op: p.input[start:p.pos]}
+	p.pos++
+	for {
+		arg, err := p.parseArg(node.op)
+		if err != nil {
+			return nil, err
+		}
+		node.args = append(node.args, arg)
+
+		if p.pos >= len(p.input) {
+			return nil, fmt.Errorf("unterminated %s", node.op)
+		}
+		p.pos++
+		if p.input[p.pos-1] == ')' {
+			return node, nil
+		}
+	}
+}
+
+func (p *rqlParser) parseArg(op string) (*rqlNode, error) {
+	if p.pos < len(p.input) && p.input[p.pos] == '"' {
+		var value strings.Builder
+		for p.pos++; p.pos < len(p.input); p.pos++ {
+			switch c := p.input[p.pos]; c {
+			case '\\':
+				p.pos++
+				if p.pos < len(p.input) {
+					value.WriteByte(p.input[p.pos])
+				}
+			case '"':
+				p.pos++
+				return &rqlNode{literal: value.String()}, nil
+			default:
+				value.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string")
+	}
+
+	if op == "and" || op == "or" || op == "not" {
+		return p.parseNode()
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte("(),", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	token := p.input[start:p.pos]
+	if number, err := strconv.ParseFloat(token, 64); err == nil {
+		return &rqlNode{literal: number}, nil
+	}
+	switch token {
+	case "true", "false":
+		return &rqlNode{literal: token == "true"}, nil
+	case "null":
+		return &rqlNode{literal: nil}, nil
+	}
+	return &rqlNode{field: token}, nil
+}
+
+// eval reports whether the event matches the expression
+func (n *rqlNode) eval(event *rqlEvent) bool {
+	switch n.op {
+	case "and":
+		for _, arg := range n.args {
+			if !arg.eval(event) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, arg := range n.args {
+			if arg.eval(event) {
+				return true
+			}
+		}
+		return false
+	case "not":
+		return !n.args[0].eval(event)
+	case "exists":
+		_, ok := event.value(n.args[0].field)
+		return ok
+	}
+
+	if len(n.args) < 2 {
+		return false
+	}
+	value, ok := event.value(n.args[0].field)
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "eq":
+		return value == n.args[1].literal
+	case "ne":
+		return value != n.args[1].literal
+	case "like":
+		pattern, _ := n.args[1].literal.(string)
+		text, _ := value.(string)
+		// * matches any characters and ? a single one, including slashes
+		expr := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))
+		matched, _ := regexp.MatchString("^"+expr+"$", text)
+		return matched
+	case "in":
+		for _, arg := range n.args[1:] {
+			if value == arg.literal {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// value resolves a placeholder or a slash-separated field of the thing
+func (e *rqlEvent) value(field string) (interface{}, bool) {
+	switch field {
+	case "thingId":
+		return e.thingID, true
+	case "resource:path":
+		return e.path, true
+	case "topic:action":
+		return e.action, true
+	}
+
+	var value interface{} = e.thing
+	for _, key := range strings.Split(field, "/") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
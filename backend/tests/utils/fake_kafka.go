@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	confluent "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/digital-egiz/backend/internal/kafka"
+)
+
+// DeadLetter is a message a consumer handler of the FakeKafka failed to process
+type DeadLetter struct {
+	Topic   string
+	Message *confluent.Message
+	Err     error
+}
+
+// fakeConsumer holds the handlers registered under a consumer name
+type fakeConsumer struct {
+	topics   []string
+	handlers map[string][]kafka.MessageHandler
+	opts     kafka.ConsumerOptions
+}
+
+// FakeKafka is an in-memory kafka.Bus. Produced messages are encoded as the Kafka producer
+// encodes them and delivered synchronously to the consumers registered for their topic,
+// so handlers can be tested end-to-end without a broker. Failed deliveries are kept as
+// dead letters instead of being sent to the DLQ topic. Consumers in the same named group
+// share messages, which only the consumer with the lowest name receives.
+type FakeKafka struct {
+	kafka.Topics
+
+	mu          sync.Mutex
+	consumers   map[string]*fakeConsumer
+	produced    []*confluent.Message
+	deadLetters []DeadLetter
+	failure     error
+}
+
+// NewFakeKafka creates an empty in-memory message bus
+func NewFakeKafka() *FakeKafka {
+	bus := &FakeKafka{
+		consumers: make(map[string]*fakeConsumer),
+	}
+	bus.Topics = kafka.Topics{Transport: bus}
+	return bus
+}
+
+// ProduceMessage records a message and delivers it to the consumers of its topic
+func (f *FakeKafka) ProduceMessage(topic string, key string, value interface{}, headers map[string]string) error {
+	f.mu.Lock()
+	if f.failure != nil {
+		err := f.failure
+		f.mu.Unlock()
+		return err
+	}
+	f.mu.Unlock()
+
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message value: %w", err)
+	}
+
+	msg := &confluent.Message{
+		TopicPartition: confluent.TopicPartition{Topic: &topic, Partition: 0},
+		Value:          valueBytes,
+		Timestamp:      time.Now(),
+	}
+	if key != "" {
+		msg.Key = []byte(key)
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, confluent.Header{Key: k, Value: []byte(v)})
+	}
+
+	f.mu.Lock()
+	msg.TopicPartition.Offset = confluent.Offset(len(f.produced))
+	f.produced = append(f.produced, msg)
+	var handlers []kafka.MessageHandler
+	groups := make(map[string]string)
+	for name, consumer := range f.consumers {
+		if group := consumer.opts.Group; group != "" && len(consumer.handlers[topic]) > 0 {
+			if other, ok := groups[group]; !ok || name < other {
+				groups[group] = name
+			}
+		}
+	}
+	for name, consumer := range f.consumers {
+		if group := consumer.opts.Group; group != "" && groups[group] != name {
+			continue
+		}
+		handlers = append(handlers, consumer.handlers[topic]...)
+	}
+	f.mu.Unlock()
+
+	// Deliver outside the lock so handlers may produce messages themselves
+	for _, handler := range handlers {
+		if err := handler(msg); err != nil {
+			f.mu.Lock()
+			f.deadLetters = append(f.deadLetters, DeadLetter{Topic: topic, Message: msg, Err: err})
+			f.mu.Unlock()
+		}
+	}
+
+	return nil
+}
+
+// AddConsumer registers handlers for messages produced from now on
+func (f *FakeKafka) AddConsumer(name string, topics []string, handlers map[string][]kafka.MessageHandler) error {
+	return f.AddConsumerWithOptions(name, topics, handlers, kafka.ConsumerOptions{})
+}
+
+// AddConsumerWithOptions registers handlers like AddConsumer, in the given consumer group
+func (f *FakeKafka) AddConsumerWithOptions(name string, topics []string, handlers map[string][]kafka.MessageHandler, opts kafka.ConsumerOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.consumers[name]; exists {
+		return fmt.Errorf("consumer with name %s already exists", name)
+	}
+
+	f.consumers[name] = &fakeConsumer{topics: topics, handlers: handlers, opts: opts}
+	return nil
+}
+
+// ConsumerOptions returns the options a consumer was registered with
+func (f *FakeKafka) ConsumerOptions(name string) (kafka.ConsumerOptions, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	consumer, ok := f.consumers[name]
+	if !ok {
+		return kafka.ConsumerOptions{}, false
+	}
+	return consumer.opts, true
+}
+
+// RemoveConsumer unregisters a consumer
+func (f *FakeKafka) RemoveConsumer(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.consumers[name]; !exists {
+		return fmt.Errorf("consumer with name %s not found", name)
+	}
+
+	delete(f.consumers, name)
+	return nil
+}
+
+// SetFailure makes producing fail with err, as when the brokers are unreachable; nil restores it
+func (f *FakeKafka) SetFailure(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failure = err
+}
+
+// Messages returns the messages produced to a topic, oldest first
+func (f *FakeKafka) Messages(topic string) []*confluent.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var messages []*confluent.Message
+	for _, msg := range f.produced {
+		if *msg.TopicPartition.Topic == topic {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// DeadLetters returns the messages consumer handlers failed to process
+func (f *FakeKafka) DeadLetters() []DeadLetter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]DeadLetter(nil), f.deadLetters...)
+}
@@ -217,3 +217,33 @@ func (ts *TestSetup) SeedTestUser(email, password string, isAdmin bool) uint {
 
 	return user.ID
 }
+
+// CreateTimeseriesTables creates the hypertables of the time-series store. They are created
+// by hand rather than migrated, as sqlite only scans times back from datetime columns.
+func (ts *TestSetup) CreateTimeseriesTables() {
+	tables := []string{
+		`CREATE TABLE timeseries_data (
+			time datetime NOT NULL, twin_id text NOT NULL, feature_path text NOT NULL, value_type text NOT NULL,
+			value_num real, value_bool numeric, value_str text, value_json text, source text,
+			PRIMARY KEY (time, twin_id, feature_path))`,
+		`CREATE TABLE aggregated_data (
+			time_interval datetime NOT NULL, twin_id text NOT NULL, feature_path text NOT NULL, interval_type text NOT NULL,
+			min real, max real, avg real, sum real, count integer, first_time datetime, last_time datetime,
+			PRIMARY KEY (time_interval, twin_id, feature_path, interval_type))`,
+		`CREATE TABLE alert_data (
+			time datetime NOT NULL, alert_id text NOT NULL, twin_id text NOT NULL, feature_path text, severity text NOT NULL,
+			message text, value_json text, source text, acknowledged numeric DEFAULT false, ack_by text, ack_time datetime,
+			ack_note text, occurrence_count integer NOT NULL DEFAULT 1, last_seen datetime, context text,
+			PRIMARY KEY (time, alert_id))`,
+		`CREATE TABLE ml_prediction_data (
+			time datetime NOT NULL, twin_id text NOT NULL, task_id text NOT NULL, prediction_type text NOT NULL,
+			score_num real, label_str text, details_json text, model_version text,
+			PRIMARY KEY (time, twin_id, task_id))`,
+		`CREATE TABLE quarantined_points (
+			id integer PRIMARY KEY AUTOINCREMENT, time datetime NOT NULL, twin_id text NOT NULL, feature_path text NOT NULL,
+			value_num real NOT NULL, source text, reason text, quarantined_at datetime NOT NULL)`,
+	}
+	for _, table := range tables {
+		ts.Requires.NoError(ts.DB.DB.Exec(table).Error, "Failed to create time-series table")
+	}
+}